@@ -0,0 +1,289 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Agent defaults, used for zero values in AgentConfig.
+const (
+	DefaultAgentMaxSteps      = 8
+	DefaultAgentTimeout       = 2 * time.Minute
+	DefaultAgentMaxToolOutput = 4096
+)
+
+// Reasons an agent run stopped, in AgentResult.StopReason.
+const (
+	StopAnswer   = "answer"    // the model replied without calling a tool
+	StopMaxSteps = "max_steps" // the step budget ran out
+	StopTimeout  = "timeout"   // the time budget ran out
+)
+
+// ErrAgentBudget is returned when a run uses its step or time budget without
+// the model giving an answer.
+var ErrAgentBudget = errors.New("agent budget exhausted")
+
+// AgentModel generates the agent's turns. ModelLoader implements it.
+type AgentModel interface {
+	GenerateWithTools(ctx context.Context, messages []ChatMessage, tools []Tool, params ControlParameters) (*GenerateResult, error)
+}
+
+// ToolExecutor lists and runs the tools an agent may call on behalf of a
+// user. ghostcommand.AgentTools implements it over the CommandRouter.
+type ToolExecutor interface {
+	// Tools returns the tools username is allowed to call.
+	Tools(username string) []Tool
+	// ExecuteTool runs call with username's permissions and returns its output.
+	ExecuteTool(ctx context.Context, username string, call ToolCall) (string, error)
+}
+
+// AgentRecorder receives each step of an agent run as it completes, e.g. to
+// write it to the command audit trail.
+type AgentRecorder interface {
+	RecordAgentStep(step AgentStep)
+}
+
+// AgentStep is one model turn or tool call of an agent run.
+type AgentStep struct {
+	RunID     string        `json:"run_id"`
+	Step      int           `json:"step"` // model turn number; a turn's tool calls share it
+	Kind      string        `json:"kind"` // "model" or "tool"
+	Username  string        `json:"username"`
+	Tool      string        `json:"tool,omitempty"`
+	Arguments string        `json:"arguments,omitempty"`
+	Output    string        `json:"output,omitempty"` // the model's text or the tool's output
+	Error     string        `json:"error,omitempty"`
+	Started   time.Time     `json:"started"`
+	Duration  time.Duration `json:"duration_ns"`
+}
+
+// AgentConfig sets an agent's budgets and instructions.
+type AgentConfig struct {
+	MaxSteps      int           // model turns per run
+	Timeout       time.Duration // wall time per run
+	MaxToolOutput int           // bytes of each tool's output fed back to the model
+	SystemPrompt  string        // prepended to the tool instructions
+}
+
+// AgentResult is the outcome of an agent run.
+type AgentResult struct {
+	RunID      string        `json:"run_id"`
+	Answer     string        `json:"answer"`
+	StopReason string        `json:"stop_reason"`
+	Steps      []AgentStep   `json:"steps"`
+	Messages   []ChatMessage `json:"messages"` // the whole conversation, including tool results
+}
+
+// Agent lets a model answer a prompt by calling tools in a loop: each reply's
+// tool calls are run and their results fed back, until the model answers
+// without calling a tool or the run's budget is used.
+type Agent struct {
+	model    AgentModel
+	tools    ToolExecutor
+	recorder AgentRecorder
+	config   AgentConfig
+}
+
+var agentRuns atomic.Uint64
+
+// NewAgent returns an agent that generates with model and runs tools through
+// tools. recorder may be nil.
+func NewAgent(model AgentModel, tools ToolExecutor, recorder AgentRecorder, config AgentConfig) *Agent {
+	if config.MaxSteps <= 0 {
+		config.MaxSteps = DefaultAgentMaxSteps
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = DefaultAgentTimeout
+	}
+	if config.MaxToolOutput <= 0 {
+		config.MaxToolOutput = DefaultAgentMaxToolOutput
+	}
+	return &Agent{model: model, tools: tools, recorder: recorder, config: config}
+}
+
+// Run answers prompt for username, who must be allowed to run every tool the
+// model calls. If the budget runs out, the partial result is returned with an
+// error wrapping ErrAgentBudget.
+func (a *Agent) Run(ctx context.Context, username, prompt string, params ControlParameters) (*AgentResult, error) {
+	ctx, cancel := context.WithTimeout(ctx, a.config.Timeout)
+	defer cancel()
+
+	tools := a.tools.Tools(username)
+	allowed := make(map[string]bool, len(tools))
+	for _, t := range tools {
+		allowed[t.Name] = true
+	}
+
+	result := &AgentResult{
+		RunID: fmt.Sprintf("agent-%s-%d", time.Now().UTC().Format("20060102T150405"), agentRuns.Add(1)),
+		Messages: []ChatMessage{
+			{Role: "system", Content: a.systemPrompt(tools)},
+			{Role: "user", Content: prompt},
+		},
+	}
+	record := func(step AgentStep) {
+		step.RunID = result.RunID
+		step.Username = username
+		result.Steps = append(result.Steps, step)
+		if a.recorder != nil {
+			a.recorder.RecordAgentStep(step)
+		}
+	}
+
+	for turn := 1; turn <= a.config.MaxSteps; turn++ {
+		if ctx.Err() != nil {
+			return a.stopped(ctx, result, turn-1)
+		}
+
+		started := time.Now()
+		res, err := a.model.GenerateWithTools(ctx, result.Messages, tools, params)
+		step := AgentStep{Step: turn, Kind: "model", Started: started, Duration: time.Since(started)}
+		if err != nil {
+			step.Error = err.Error()
+			record(step)
+			if ctx.Err() != nil {
+				return a.stopped(ctx, result, turn)
+			}
+			return result, fmt.Errorf("agent step %d failed: %w", turn, err)
+		}
+		step.Output = res.Text
+		record(step)
+
+		calls := res.ToolCalls
+		if len(calls) == 0 {
+			calls = ParseToolCalls(res.Text, allowed)
+		}
+		if len(calls) == 0 {
+			result.Answer = strings.TrimSpace(res.Text)
+			result.StopReason = StopAnswer
+			result.Messages = append(result.Messages, ChatMessage{Role: "assistant", Content: res.Text})
+			return result, nil
+		}
+
+		for i := range calls {
+			if calls[i].ID == "" {
+				calls[i].ID = fmt.Sprintf("call_%d_%d", turn, i+1)
+			}
+			calls[i].Type = "function"
+		}
+		result.Messages = append(result.Messages, ChatMessage{Role: "assistant", Content: res.Text, ToolCalls: calls})
+
+		for _, call := range calls {
+			output := a.runTool(ctx, username, call, allowed, turn, record)
+			result.Messages = append(result.Messages, ChatMessage{Role: "tool", ToolCallID: call.ID, Content: output})
+		}
+	}
+
+	result.StopReason = StopMaxSteps
+	return result, fmt.Errorf("%w: no answer after %d steps", ErrAgentBudget, a.config.MaxSteps)
+}
+
+// runTool runs one call and returns what is fed back to the model: the
+// tool's output, or the reason it failed.
+func (a *Agent) runTool(ctx context.Context, username string, call ToolCall, allowed map[string]bool, turn int, record func(AgentStep)) string {
+	// Backends leave the arguments empty for calls without parameters
+	if args := strings.TrimSpace(call.Function.Arguments); args == "" || args == "null" {
+		call.Function.Arguments = "{}"
+	}
+	step := AgentStep{Step: turn, Kind: "tool", Tool: call.Function.Name, Arguments: call.Function.Arguments, Started: time.Now()}
+
+	var output string
+	var err error
+	switch {
+	case !allowed[call.Function.Name]:
+		err = fmt.Errorf("tool not available: %s", call.Function.Name)
+	case !json.Valid([]byte(call.Function.Arguments)):
+		err = fmt.Errorf("arguments for %s are not valid JSON", call.Function.Name)
+	default:
+		output, err = a.tools.ExecuteTool(ctx, username, call)
+	}
+	step.Duration = time.Since(step.Started)
+
+	if len(output) > a.config.MaxToolOutput {
+		output = output[:a.config.MaxToolOutput] + "\n[output truncated]"
+	}
+	step.Output = output
+	if err != nil {
+		step.Error = err.Error()
+		record(step)
+		return "error: " + err.Error()
+	}
+	record(step)
+	return output
+}
+
+// stopped ends a run whose time budget, or ctx, has run out.
+func (a *Agent) stopped(ctx context.Context, result *AgentResult, turns int) (*AgentResult, error) {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		result.StopReason = StopTimeout
+		return result, fmt.Errorf("%w: timed out after %d steps", ErrAgentBudget, turns)
+	}
+	return result, ctx.Err()
+}
+
+// systemPrompt describes the tools in text as well, for backends that don't
+// accept tool definitions.
+func (a *Agent) systemPrompt(tools []Tool) string {
+	var b strings.Builder
+	if a.config.SystemPrompt != "" {
+		b.WriteString(a.config.SystemPrompt)
+		b.WriteString("\n\n")
+	}
+	if len(tools) == 0 {
+		b.WriteString("No tools are available. Answer from what you know.")
+		return b.String()
+	}
+	b.WriteString("You can run GhostShell commands for the user by calling these tools:\n")
+	for _, t := range tools {
+		schema, _ := json.Marshal(t.Parameters)
+		fmt.Fprintf(&b, "- %s: %s Arguments: %s\n", t.Name, t.Description, schema)
+	}
+	b.WriteString("\nTo call a tool, reply with only <tool_call>{\"name\": \"...\", \"arguments\": {...}}</tool_call>. " +
+		"Tool results are returned in the next message. When you have what you need, reply with the answer in plain text.")
+	return b.String()
+}
+
+var toolCallTag = regexp.MustCompile(`(?s)<tool_call>\s*(.*?)\s*</tool_call>`)
+
+// ParseToolCalls extracts tool calls written as text, for models that don't
+// return structured calls: <tool_call>{...}</tool_call> blocks, or a reply
+// that is just a {"name": ..., "arguments": ...} object, optionally in a code
+// fence. Calls to names not in tools are ignored, so an answer that happens
+// to be JSON is not mistaken for a call.
+func ParseToolCalls(text string, tools map[string]bool) []ToolCall {
+	var candidates []string
+	if matches := toolCallTag.FindAllStringSubmatch(text, -1); len(matches) > 0 {
+		for _, m := range matches {
+			candidates = append(candidates, m[1])
+		}
+	} else {
+		trimmed := strings.TrimSpace(text)
+		trimmed = strings.TrimPrefix(trimmed, "```json")
+		trimmed = strings.TrimPrefix(trimmed, "```")
+		trimmed = strings.TrimSuffix(trimmed, "```")
+		candidates = append(candidates, strings.TrimSpace(trimmed))
+	}
+
+	var calls []ToolCall
+	for _, c := range candidates {
+		var parsed struct {
+			Name      string          `json:"name"`
+			Arguments json.RawMessage `json:"arguments"`
+		}
+		if err := json.Unmarshal([]byte(c), &parsed); err != nil || !tools[parsed.Name] {
+			continue
+		}
+		args := string(parsed.Arguments)
+		if args == "" || args == "null" {
+			args = "{}"
+		}
+		calls = append(calls, ToolCall{Type: "function", Function: ToolCallFunction{Name: parsed.Name, Arguments: args}})
+	}
+	return calls
+}
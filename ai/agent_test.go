@@ -0,0 +1,195 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// scriptedModel replies with its script in order, remembering the
+// conversation it was sent each turn.
+type scriptedModel struct {
+	replies []GenerateResult
+	seen    [][]ChatMessage
+	delay   time.Duration
+}
+
+func (m *scriptedModel) GenerateWithTools(ctx context.Context, messages []ChatMessage, tools []Tool, params ControlParameters) (*GenerateResult, error) {
+	m.seen = append(m.seen, append([]ChatMessage(nil), messages...))
+	if err := sleepContext(ctx, m.delay); err != nil {
+		return nil, err
+	}
+	if len(m.seen) > len(m.replies) {
+		return nil, errors.New("script exhausted")
+	}
+	res := m.replies[len(m.seen)-1]
+	return &res, nil
+}
+
+// fakeTools serves commands that echo their arguments, to users with permission.
+type fakeTools struct {
+	permissions map[string][]string
+	calls       []string
+}
+
+func (f *fakeTools) Tools(username string) []Tool {
+	var tools []Tool
+	for _, name := range f.permissions[username] {
+		tools = append(tools, Tool{Name: name, Description: "Runs " + name + ".", Parameters: map[string]interface{}{"type": "object"}})
+	}
+	return tools
+}
+
+func (f *fakeTools) ExecuteTool(ctx context.Context, username string, call ToolCall) (string, error) {
+	for _, name := range f.permissions[username] {
+		if name == call.Function.Name {
+			f.calls = append(f.calls, call.Function.Name)
+			return fmt.Sprintf("%s ran with %s", call.Function.Name, call.Function.Arguments), nil
+		}
+	}
+	return "", fmt.Errorf("user %s is not authorized to run %s", username, call.Function.Name)
+}
+
+type stepLog struct {
+	steps []AgentStep
+}
+
+func (l *stepLog) RecordAgentStep(step AgentStep) {
+	l.steps = append(l.steps, step)
+}
+
+func toolCall(id, name, args string) ToolCall {
+	return ToolCall{ID: id, Type: "function", Function: ToolCallFunction{Name: name, Arguments: args}}
+}
+
+func TestAgentRunsToolsAndAnswers(t *testing.T) {
+	model := &scriptedModel{replies: []GenerateResult{
+		{ToolCalls: []ToolCall{toolCall("a", "status", `{"args":["vpn"]}`)}},
+		{Text: `<tool_call>{"name": "scan", "arguments": {"args": ["10.0.0.1"]}}</tool_call>`},
+		{Text: "The VPN is up and the host is reachable."},
+	}}
+	tools := &fakeTools{permissions: map[string][]string{"alice": {"status", "scan"}}}
+	log := &stepLog{}
+
+	res, err := NewAgent(model, tools, log, AgentConfig{}).Run(context.Background(), "alice", "Is everything up?", ControlParameters{})
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if res.StopReason != StopAnswer || res.Answer != "The VPN is up and the host is reachable." {
+		t.Errorf("unexpected result %q (%s)", res.Answer, res.StopReason)
+	}
+	if strings.Join(tools.calls, ",") != "status,scan" {
+		t.Errorf("expected status then scan to run, got %v", tools.calls)
+	}
+
+	// Each tool result is fed back to the model under its call's ID
+	last := model.seen[2]
+	fed := last[len(last)-1]
+	if fed.Role != "tool" || fed.ToolCallID != "call_2_1" || !strings.Contains(fed.Content, `scan ran with {"args": ["10.0.0.1"]}`) {
+		t.Errorf("unexpected tool message %+v", fed)
+	}
+	if !strings.Contains(model.seen[0][0].Content, "- status: Runs status.") {
+		t.Errorf("system prompt doesn't describe the tools: %q", model.seen[0][0].Content)
+	}
+
+	var kinds []string
+	for _, s := range log.steps {
+		if s.Username != "alice" || s.RunID != res.RunID {
+			t.Errorf("step not attributed to the run: %+v", s)
+		}
+		kinds = append(kinds, fmt.Sprintf("%d:%s", s.Step, s.Kind))
+	}
+	if got := strings.Join(kinds, " "); got != "1:model 1:tool 2:model 2:tool 3:model" {
+		t.Errorf("unexpected audit trail %s", got)
+	}
+}
+
+func TestAgentRefusesUnauthorizedTools(t *testing.T) {
+	model := &scriptedModel{replies: []GenerateResult{
+		{ToolCalls: []ToolCall{toolCall("a", "shutdown", `{}`)}},
+		{Text: "I'm not allowed to do that."},
+	}}
+	tools := &fakeTools{permissions: map[string][]string{"bob": {"status"}, "alice": {"shutdown"}}}
+	log := &stepLog{}
+
+	res, err := NewAgent(model, tools, log, AgentConfig{}).Run(context.Background(), "bob", "Shut it down", ControlParameters{})
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if len(tools.calls) != 0 {
+		t.Errorf("unauthorized tool ran: %v", tools.calls)
+	}
+	if log.steps[1].Kind != "tool" || !strings.Contains(log.steps[1].Error, "not available") {
+		t.Errorf("expected the refusal in the audit trail, got %+v", log.steps[1])
+	}
+	if fed := res.Messages[3]; !strings.HasPrefix(fed.Content, "error: ") {
+		t.Errorf("expected the model to be told of the refusal, got %+v", fed)
+	}
+}
+
+func TestAgentRunsToolsWithoutArguments(t *testing.T) {
+	model := &scriptedModel{replies: []GenerateResult{
+		{ToolCalls: []ToolCall{toolCall("a", "status", "")}},
+		{Text: "All good."},
+	}}
+	tools := &fakeTools{permissions: map[string][]string{"alice": {"status"}}}
+	log := &stepLog{}
+
+	if _, err := NewAgent(model, tools, log, AgentConfig{}).Run(context.Background(), "alice", "Status?", ControlParameters{}); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if strings.Join(tools.calls, ",") != "status" {
+		t.Errorf("expected status to run, got %v", tools.calls)
+	}
+	if step := log.steps[1]; step.Arguments != "{}" || step.Error != "" || step.Output != "status ran with {}" {
+		t.Errorf("expected empty arguments to run as {}, got %+v", step)
+	}
+}
+
+func TestAgentStepBudget(t *testing.T) {
+	loop := GenerateResult{ToolCalls: []ToolCall{toolCall("", "status", `{}`)}}
+	model := &scriptedModel{replies: []GenerateResult{loop, loop, loop, loop}}
+	tools := &fakeTools{permissions: map[string][]string{"alice": {"status"}}}
+
+	res, err := NewAgent(model, tools, nil, AgentConfig{MaxSteps: 3}).Run(context.Background(), "alice", "status?", ControlParameters{})
+	if !errors.Is(err, ErrAgentBudget) || res.StopReason != StopMaxSteps {
+		t.Fatalf("expected the step budget to stop the run, got %v (%s)", err, res.StopReason)
+	}
+	if len(model.seen) != 3 || len(tools.calls) != 3 {
+		t.Errorf("expected 3 turns, got %d turns and %d calls", len(model.seen), len(tools.calls))
+	}
+}
+
+func TestAgentTimeBudget(t *testing.T) {
+	model := &scriptedModel{replies: []GenerateResult{{Text: "too late"}}, delay: time.Second}
+	tools := &fakeTools{}
+
+	res, err := NewAgent(model, tools, nil, AgentConfig{Timeout: 20 * time.Millisecond}).Run(context.Background(), "alice", "hi", ControlParameters{})
+	if !errors.Is(err, ErrAgentBudget) || res.StopReason != StopTimeout {
+		t.Fatalf("expected the time budget to stop the run, got %v (%s)", err, res.StopReason)
+	}
+}
+
+func TestParseToolCalls(t *testing.T) {
+	tools := map[string]bool{"status": true}
+	for text, want := range map[string]int{
+		"```json\n{\"name\": \"status\", \"arguments\": {}}\n```": 1,
+		`{"name": "status"}`:                       1,
+		`{"name": "format_disk", "arguments": {}}`: 0,
+		"Sure. <tool_call>{\"name\":\"status\"}</tool_call><tool_call>{\"name\":\"status\"}</tool_call>": 2,
+		"The status is fine.": 0,
+	} {
+		calls := ParseToolCalls(text, tools)
+		if len(calls) != want {
+			t.Errorf("ParseToolCalls(%q) = %d calls, want %d", text, len(calls), want)
+		}
+		for _, c := range calls {
+			if c.Function.Arguments != "{}" {
+				t.Errorf("missing arguments should default to {}, got %q", c.Function.Arguments)
+			}
+		}
+	}
+}
@@ -1,34 +1,130 @@
 package ai
 
 import (
-	"oqs"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
 	"os"
 )
 
+// encryptedModelMagic starts a model encrypted by EncryptFile. It is followed
+// by the GCM nonce and the sealed model.
+var encryptedModelMagic = []byte("GSMODEL1")
+
+// ModelKeySize is the length of a model encryption key (AES-256).
+const ModelKeySize = 32
+
+// EncryptFile encrypts the model at inputPath with key for storage at rest.
 func EncryptFile(inputPath, outputPath string, key []byte) error {
 	data, err := os.ReadFile(inputPath)
 	if err != nil {
 		return err
 	}
-
-	encryptedData, err := oqs.Encrypt(data, key)
+	gcm, err := newModelCipher(key)
 	if err != nil {
 		return err
 	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return fmt.Errorf("failed to generate nonce: %w", err)
+	}
 
-	return os.WriteFile(outputPath, encryptedData, 0644)
+	out := make([]byte, 0, len(encryptedModelMagic)+len(nonce)+len(data)+gcm.Overhead())
+	out = append(out, encryptedModelMagic...)
+	out = append(out, nonce...)
+	out = gcm.Seal(out, nonce, data, encryptedModelMagic)
+	return os.WriteFile(outputPath, out, 0600)
 }
 
+// DecryptFile decrypts a model encrypted by EncryptFile to outputPath. To
+// load an encrypted model, use DecryptModel, which doesn't write the
+// plaintext to disk.
 func DecryptFile(inputPath, outputPath string, key []byte) error {
-	encryptedData, err := os.ReadFile(inputPath)
+	data, err := DecryptModel(inputPath, key)
 	if err != nil {
 		return err
 	}
+	defer zeroizeMemory(data)
+	return os.WriteFile(outputPath, data, 0600)
+}
 
-	data, err := oqs.Decrypt(encryptedData, key)
+// IsEncryptedModel reports whether the file at path was written by EncryptFile.
+func IsEncryptedModel(path string) (bool, error) {
+	f, err := os.Open(path)
 	if err != nil {
-		return err
+		return false, fmt.Errorf("failed to open model file: %w", err)
+	}
+	defer f.Close()
+	header := make([]byte, len(encryptedModelMagic))
+	if _, err := io.ReadFull(f, header); err != nil {
+		return false, nil
+	}
+	return bytes.Equal(header, encryptedModelMagic), nil
+}
+
+// DecryptModel decrypts the model at path. The model is too large to lock
+// into memory, so the caller zeroizes it with zeroizeMemory when the model
+// is unloaded.
+func DecryptModel(path string, key []byte) ([]byte, error) {
+	sealed, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read model file: %w", err)
+	}
+	if !bytes.HasPrefix(sealed, encryptedModelMagic) {
+		return nil, fmt.Errorf("%s is not an encrypted model", path)
+	}
+	gcm, err := newModelCipher(key)
+	if err != nil {
+		return nil, err
 	}
+	sealed = sealed[len(encryptedModelMagic):]
+	if len(sealed) < gcm.NonceSize()+gcm.Overhead() {
+		return nil, errors.New("encrypted model is truncated")
+	}
+	nonce, sealed := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+
+	// Open into a buffer of its own, so the plaintext is only where it is wiped
+	plain := make([]byte, len(sealed)-gcm.Overhead())
+	if _, err := gcm.Open(plain[:0], nonce, sealed, encryptedModelMagic); err != nil {
+		zeroizeMemory(plain)
+		return nil, errors.New("failed to decrypt model: wrong key or corrupt file")
+	}
+	return plain, nil
+}
+
+// ModelKeyFromEnv reads a hex-encoded model key from the environment variable
+// name into secure memory. The caller zeroizes it with zeroizeMemory.
+func ModelKeyFromEnv(name string) ([]byte, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return nil, fmt.Errorf("model is encrypted but %s is not set", name)
+	}
+	if hex.DecodedLen(len(value)) != ModelKeySize {
+		return nil, fmt.Errorf("%s must be %d hex-encoded bytes", name, ModelKeySize)
+	}
+	key, err := allocateSecureMemory(ModelKeySize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to allocate secure memory: %w", err)
+	}
+	if _, err := hex.Decode(key, []byte(value)); err != nil {
+		zeroizeMemory(key)
+		return nil, fmt.Errorf("%s must be %d hex-encoded bytes", name, ModelKeySize)
+	}
+	return key, nil
+}
 
-	return os.WriteFile(outputPath, data, 0644)
+func newModelCipher(key []byte) (cipher.AEAD, error) {
+	if len(key) != ModelKeySize {
+		return nil, fmt.Errorf("model key must be %d bytes, got %d", ModelKeySize, len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	return cipher.NewGCM(block)
 }
@@ -1,26 +1,280 @@
 package ai
 
 import (
+	"crypto/ecdsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"oqs"
 	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"ghostshell/oqs/sig"
+)
+
+// Integrity policies, applied when a model is loaded or selected.
+const (
+	IntegrityOff  = "off"  // don't check manifests
+	IntegrityWarn = "warn" // log models that fail verification, but load them
+	IntegrityDeny = "deny" // refuse to load models that fail verification
 )
 
-func SignModel(filePath string, privateKey []byte) ([]byte, error) {
-	data, err := os.ReadFile(filePath)
+// ManifestSuffix is appended to a model's path to find its manifest.
+const ManifestSuffix = ".manifest.json"
+
+// ErrModelUntrusted is returned by VerifyModel for a model without a valid
+// manifest signed by a trusted signer.
+var ErrModelUntrusted = errors.New("model is not trusted")
+
+// ModelManifest describes a model file and who vouches for it. The hash and
+// size are of the file as stored, so an encrypted model is verified without
+// decrypting it.
+type ModelManifest struct {
+	File      string    `json:"file"` // base name of the model file
+	SHA256    string    `json:"sha256"`
+	Size      int64     `json:"size"`
+	Source    string    `json:"source,omitempty"` // e.g. the Hugging Face repository it came from
+	License   string    `json:"license,omitempty"`
+	Encrypted bool      `json:"encrypted,omitempty"`
+	Signer    string    `json:"signer"`
+	Created   time.Time `json:"created"`
+	Signature string    `json:"signature,omitempty"` // hex ASN.1 ECDSA signature over the manifest without it
+}
+
+// signedBytes is the manifest as it is signed: its JSON without the signature.
+func (m ModelManifest) signedBytes() ([]byte, error) {
+	m.Signature = ""
+	return json.Marshal(m)
+}
+
+// NewModelManifest hashes the model at path into an unsigned manifest.
+func NewModelManifest(path, source, license string) (*ModelManifest, error) {
+	stat, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat model file: %w", err)
+	}
+	hash, err := hashFile(path)
+	if err != nil {
+		return nil, err
+	}
+	encrypted, err := IsEncryptedModel(path)
+	if err != nil {
+		return nil, err
+	}
+	return &ModelManifest{
+		File:      filepath.Base(path),
+		SHA256:    hash,
+		Size:      stat.Size(),
+		Source:    source,
+		License:   license,
+		Encrypted: encrypted,
+		Created:   time.Now().UTC(),
+	}, nil
+}
+
+// SignModel writes a manifest for the model at path, signed by signer with
+// key, next to the model.
+func SignModel(path, source, license, signer string, key *sig.Signature) (*ModelManifest, error) {
+	manifest, err := NewModelManifest(path, source, license)
 	if err != nil {
 		return nil, err
 	}
-	return oqs.Sign(data, privateKey)
+	manifest.Signer = signer
+	data, err := manifest.signedBytes()
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode manifest: %w", err)
+	}
+	if manifest.Signature, err = key.Sign(data); err != nil {
+		return nil, fmt.Errorf("failed to sign manifest: %w", err)
+	}
+
+	out, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode manifest: %w", err)
+	}
+	if err := os.WriteFile(path+ManifestSuffix, out, 0644); err != nil {
+		return nil, fmt.Errorf("failed to write manifest: %w", err)
+	}
+	return manifest, nil
+}
+
+// ReadModelManifest reads the manifest next to the model at path.
+func ReadModelManifest(path string) (*ModelManifest, error) {
+	data, err := os.ReadFile(path + ManifestSuffix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+	var manifest ModelManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest: %w", err)
+	}
+	return &manifest, nil
 }
 
-func VerifyModel(filePath string, signature, publicKey []byte) error {
-	data, err := os.ReadFile(filePath)
+// VerifyModel checks the model at path against its manifest, and the
+// manifest's signature against the trust store. Failures wrap ErrModelUntrusted.
+func VerifyModel(path string, trust *TrustStore) (*ModelManifest, error) {
+	manifest, err := ReadModelManifest(path)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrModelUntrusted, err)
+	}
+	if err := trust.Verify(manifest); err != nil {
+		return manifest, err
+	}
+
+	stat, err := os.Stat(path)
+	if err != nil {
+		return manifest, fmt.Errorf("failed to stat model file: %w", err)
+	}
+	if stat.Size() != manifest.Size {
+		return manifest, fmt.Errorf("%w: %s is %d bytes, its manifest says %d", ErrModelUntrusted, path, stat.Size(), manifest.Size)
+	}
+	hash, err := hashFile(path)
+	if err != nil {
+		return manifest, err
+	}
+	if hash != manifest.SHA256 {
+		return manifest, fmt.Errorf("%w: %s does not match its manifest's hash", ErrModelUntrusted, path)
+	}
+	return manifest, nil
+}
+
+// TrustStore holds the public keys of the signers whose models may be loaded.
+type TrustStore struct {
+	mu      sync.RWMutex
+	signers map[string]*ecdsa.PublicKey
+}
+
+// trustedSigner is a trust store entry as saved to disk.
+type trustedSigner struct {
+	Name      string `json:"name"`
+	PublicKey string `json:"public_key"` // base64 PKIX DER
+}
+
+// NewTrustStore returns an empty trust store.
+func NewTrustStore() *TrustStore {
+	return &TrustStore{signers: make(map[string]*ecdsa.PublicKey)}
+}
+
+// LoadTrustStore reads a trust store saved by Save. A missing file is an
+// empty trust store.
+func LoadTrustStore(path string) (*TrustStore, error) {
+	trust := NewTrustStore()
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return trust, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read trust store: %w", err)
+	}
+	var saved struct {
+		Signers []trustedSigner `json:"signers"`
+	}
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return nil, fmt.Errorf("failed to parse trust store: %w", err)
+	}
+	for _, s := range saved.Signers {
+		der, err := base64.StdEncoding.DecodeString(s.PublicKey)
+		if err != nil {
+			return nil, fmt.Errorf("invalid public key for signer %s: %w", s.Name, err)
+		}
+		key, err := x509.ParsePKIXPublicKey(der)
+		if err != nil {
+			return nil, fmt.Errorf("invalid public key for signer %s: %w", s.Name, err)
+		}
+		ecKey, ok := key.(*ecdsa.PublicKey)
+		if !ok {
+			return nil, fmt.Errorf("public key for signer %s is not an ECDSA key", s.Name)
+		}
+		trust.signers[s.Name] = ecKey
+	}
+	return trust, nil
+}
+
+// Save writes the trust store to path.
+func (t *TrustStore) Save(path string) error {
+	t.mu.RLock()
+	var saved struct {
+		Signers []trustedSigner `json:"signers"`
+	}
+	for name, key := range t.signers {
+		der, err := x509.MarshalPKIXPublicKey(key)
+		if err != nil {
+			t.mu.RUnlock()
+			return fmt.Errorf("failed to encode public key for signer %s: %w", name, err)
+		}
+		saved.Signers = append(saved.Signers, trustedSigner{Name: name, PublicKey: base64.StdEncoding.EncodeToString(der)})
+	}
+	t.mu.RUnlock()
+	sort.Slice(saved.Signers, func(i, j int) bool { return saved.Signers[i].Name < saved.Signers[j].Name })
+
+	data, err := json.MarshalIndent(saved, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode trust store: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create trust store directory: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write trust store: %w", err)
+	}
+	return nil
+}
+
+// Trust adds or replaces a signer's public key.
+func (t *TrustStore) Trust(name string, key *ecdsa.PublicKey) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.signers[name] = key
+}
+
+// Revoke removes a signer.
+func (t *TrustStore) Revoke(name string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.signers, name)
+}
+
+// Signers returns the names of the trusted signers, sorted.
+func (t *TrustStore) Signers() []string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	names := make([]string, 0, len(t.signers))
+	for name := range t.signers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Verify checks the manifest was signed by the trusted signer it names.
+func (t *TrustStore) Verify(manifest *ModelManifest) error {
+	t.mu.RLock()
+	key, ok := t.signers[manifest.Signer]
+	t.mu.RUnlock()
+	if !ok {
+		return fmt.Errorf("%w: signer %q is not in the trust store", ErrModelUntrusted, manifest.Signer)
+	}
+	if manifest.Signature == "" {
+		return fmt.Errorf("%w: manifest is not signed", ErrModelUntrusted)
+	}
+
+	data, err := manifest.signedBytes()
+	if err != nil {
+		return fmt.Errorf("failed to encode manifest: %w", err)
+	}
+	verifier := sig.NewSignature("ECDSA-P256")
+	verifier.PublicKey = key
+	valid, err := verifier.Verify(data, manifest.Signature)
 	if err != nil {
-		return err
+		return fmt.Errorf("%w: %v", ErrModelUntrusted, err)
 	}
-	if !oqs.VerifySignature(data, signature, publicKey) {
-		return fmt.Errorf("signature verification failed for %s", filePath)
+	if !valid {
+		return fmt.Errorf("%w: bad signature from %q", ErrModelUntrusted, manifest.Signer)
 	}
 	return nil
 }
@@ -0,0 +1,145 @@
+package ai
+
+import (
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"ghostshell/oqs/sig"
+
+	"go.uber.org/zap"
+)
+
+func testSigner(t *testing.T) *sig.Signature {
+	key := sig.NewSignature("ECDSA-P256")
+	if err := key.GenerateKeypair(); err != nil {
+		t.Fatalf("GenerateKeypair: %v", err)
+	}
+	return key
+}
+
+func TestSignAndVerifyModel(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "tiny.gguf")
+	os.WriteFile(path, testLlamaGGUF(3), 0600)
+
+	release := testSigner(t)
+	manifest, err := SignModel(path, "hf://ghostshell/tiny", "apache-2.0", "release", release)
+	if err != nil {
+		t.Fatalf("SignModel: %v", err)
+	}
+
+	trust := NewTrustStore()
+	if _, err := VerifyModel(path, trust); !errors.Is(err, ErrModelUntrusted) {
+		t.Errorf("expected an unknown signer to be untrusted, got %v", err)
+	}
+
+	// The trust store survives a round trip to disk
+	trust.Trust("release", release.PublicKey)
+	storePath := filepath.Join(dir, "config", "signers.json")
+	if err := trust.Save(storePath); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	if trust, err = LoadTrustStore(storePath); err != nil {
+		t.Fatalf("LoadTrustStore: %v", err)
+	}
+	verified, err := VerifyModel(path, trust)
+	if err != nil {
+		t.Fatalf("VerifyModel: %v", err)
+	}
+	if verified.SHA256 != manifest.SHA256 || verified.License != "apache-2.0" || verified.Source != "hf://ghostshell/tiny" {
+		t.Errorf("unexpected manifest %+v", verified)
+	}
+
+	// Changing the manifest breaks the signature
+	tampered := *verified
+	tampered.License = "mit"
+	if err := trust.Verify(&tampered); !errors.Is(err, ErrModelUntrusted) {
+		t.Errorf("expected a tampered manifest to fail, got %v", err)
+	}
+	// Another key claiming to be the release signer
+	forged, _ := SignModel(path, "", "", "release", testSigner(t))
+	if err := trust.Verify(forged); !errors.Is(err, ErrModelUntrusted) {
+		t.Errorf("expected a forged signature to fail, got %v", err)
+	}
+
+	// Changing the model breaks the hash
+	SignModel(path, "", "", "release", release)
+	data := testLlamaGGUF(3)
+	data[len(data)-1] = 1
+	os.WriteFile(path, data, 0600)
+	if _, err := VerifyModel(path, trust); !errors.Is(err, ErrModelUntrusted) {
+		t.Errorf("expected a modified model to fail, got %v", err)
+	}
+}
+
+func TestEncryptedModel(t *testing.T) {
+	dir := t.TempDir()
+	plain := filepath.Join(dir, "tiny.gguf")
+	sealed := filepath.Join(dir, "tiny.gguf.enc")
+	data := testLlamaGGUF(3)
+	os.WriteFile(plain, data, 0600)
+
+	key := make([]byte, ModelKeySize)
+	key[0] = 7
+	if err := EncryptFile(plain, sealed, key); err != nil {
+		t.Fatalf("EncryptFile: %v", err)
+	}
+	if encrypted, _ := IsEncryptedModel(sealed); !encrypted {
+		t.Error("expected the encrypted model to be recognized")
+	}
+	if encrypted, _ := IsEncryptedModel(plain); encrypted {
+		t.Error("expected the plain model not to be recognized as encrypted")
+	}
+
+	decrypted, err := DecryptModel(sealed, key)
+	if err != nil || string(decrypted) != string(data) {
+		t.Fatalf("DecryptModel: %v", err)
+	}
+	key[0] = 8
+	if _, err := DecryptModel(sealed, key); err == nil {
+		t.Error("expected the wrong key to fail")
+	}
+}
+
+func TestLoaderIntegrityPolicy(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "tiny.gguf.enc")
+	os.WriteFile(filepath.Join(dir, "tiny.gguf"), testLlamaGGUF(3), 0600)
+	key := make([]byte, ModelKeySize)
+	if err := EncryptFile(filepath.Join(dir, "tiny.gguf"), path, key); err != nil {
+		t.Fatalf("EncryptFile: %v", err)
+	}
+	t.Setenv("TEST_MODEL_KEY", hex.EncodeToString(key))
+
+	cfg := GetDefaultConfig()
+	cfg.ModelPath = path
+	cfg.Integrity = IntegrityConfig{Policy: IntegrityDeny, KeyEnv: "TEST_MODEL_KEY"}
+	loader := &ModelLoader{config: cfg, logger: zap.NewNop(), trust: NewTrustStore()}
+
+	// Unsigned models are refused under deny, and loaded under warn
+	if err := loader.LoadModel(); !errors.Is(err, ErrModelUntrusted) {
+		t.Fatalf("expected deny to refuse an unsigned model, got %v", err)
+	}
+	cfg.Integrity.Policy = IntegrityWarn
+	if err := loader.LoadModel(); err != nil {
+		t.Fatalf("expected warn to load an unsigned model: %v", err)
+	}
+	if string(loader.modelData[:4]) != "GGUF" {
+		t.Error("expected the decrypted model to be kept")
+	}
+	loader.UnloadModel()
+
+	signer := testSigner(t)
+	if _, err := SignModel(path, "", "", "ops", signer); err != nil {
+		t.Fatalf("SignModel: %v", err)
+	}
+	loader.trust.Trust("ops", signer.PublicKey)
+	cfg.Integrity.Policy = IntegrityDeny
+	if err := loader.LoadModel(); err != nil {
+		t.Fatalf("expected a signed model to load under deny: %v", err)
+	}
+	loader.UnloadModel()
+}
@@ -2,12 +2,16 @@ package ai
 
 import (
 	"bytes"
+	"context"
+	"encoding/binary"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 
 	"go.uber.org/zap"
@@ -15,9 +19,68 @@ import (
 
 const (
 	elevenLabsAPIURL = "https://api.elevenlabs.io/v1/text-to-speech"
-	freeTTSAPIURL    = "https://api.freetts.com/v1/tts"
+	// elevenLabsSampleRate is the rate of the raw PCM ElevenLabs is asked for
+	elevenLabsSampleRate = 16000
 )
 
+// Speech engines, chosen by VoiceConfig.Engine.
+const (
+	SpeechLocal      = "local"      // piper, whisper.cpp or similar, run as commands
+	SpeechElevenLabs = "elevenlabs" // ElevenLabs' API; synthesis only
+	SpeechNull       = "null"       // silence and a fixed transcript, for tests
+)
+
+// ErrSpeechUnsupported is returned by engines that can't do what was asked,
+// e.g. transcription with a synthesis-only service.
+var ErrSpeechUnsupported = errors.New("not supported by this speech engine")
+
+// Speech turns text into audio and audio into text.
+type Speech interface {
+	// Synthesize speaks text.
+	Synthesize(ctx context.Context, text string) (*Audio, error)
+	// Transcribe returns the words spoken in audio.
+	Transcribe(ctx context.Context, audio *Audio) (string, error)
+}
+
+// DetermineTTS returns the speech engine the configuration selects.
+func DetermineTTS(config VoiceConfig, logger *zap.Logger) (Speech, error) {
+	switch config.Engine {
+	case "", SpeechLocal:
+		return NewLocalSpeech(config, logger)
+	case SpeechElevenLabs:
+		return NewElevenLabs(ElevenLabsConfig{
+			APIKey:      config.ElevenLabsAPIKey,
+			VoiceID:     config.ElevenLabsVoiceID,
+			OutputDir:   config.OutputDir,
+			DefaultLang: "en-US",
+		}, logger)
+	case SpeechNull:
+		return &NullSpeech{}, nil
+	default:
+		return nil, fmt.Errorf("unknown speech engine: %s", config.Engine)
+	}
+}
+
+// SaveSpeech synthesizes text and writes it as a WAV file at path.
+func SaveSpeech(ctx context.Context, speech Speech, text, path string) error {
+	audio, err := speech.Synthesize(ctx, text)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create output file: %w", err)
+	}
+	defer f.Close()
+	if err := EncodeWAV(f, audio); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
 type ElevenLabsConfig struct {
 	APIKey      string
 	VoiceID     string
@@ -25,15 +88,11 @@ type ElevenLabsConfig struct {
 	DefaultLang string
 }
 
-type FreeTTSConfig struct {
-	OutputDir   string
-	DefaultLang string
-}
-
 type ElevenLabs struct {
 	config ElevenLabsConfig
 	logger *zap.Logger
 	mu     sync.Mutex
+	url    string // the API's base URL
 }
 
 // NewElevenLabs initializes the ElevenLabs TTS client.
@@ -50,187 +109,104 @@ func NewElevenLabs(config ElevenLabsConfig, logger *zap.Logger) (*ElevenLabs, er
 	return &ElevenLabs{
 		config: config,
 		logger: logger,
+		url:    elevenLabsAPIURL,
 	}, nil
 }
 
-// SynthesizeSpeech sends a request to ElevenLabs API and saves the resulting audio.
-func (el *ElevenLabs) SynthesizeSpeech(text, filename string) (string, error) {
+// Synthesize asks ElevenLabs to speak text, as 16 kHz mono PCM.
+func (el *ElevenLabs) Synthesize(ctx context.Context, text string) (*Audio, error) {
 	el.mu.Lock()
 	defer el.mu.Unlock()
 
 	if text == "" {
-		return "", fmt.Errorf("text cannot be empty")
+		return nil, fmt.Errorf("text cannot be empty")
 	}
 
 	// Prepare the request body
 	requestBody := map[string]interface{}{
-		"text":      text,
-		"voice_id":  el.config.VoiceID,
-		"lang":      el.config.DefaultLang,
-		"stability": 0.75, // Optional TTS parameters
-		"clarity":   0.8,
+		"text":          text,
+		"language_code": strings.SplitN(el.config.DefaultLang, "-", 2)[0],
+		"voice_settings": map[string]interface{}{
+			"stability":        0.75,
+			"similarity_boost": 0.8,
+		},
 	}
 	bodyBytes, err := json.Marshal(requestBody)
 	if err != nil {
-		return "", fmt.Errorf("failed to marshal request body: %w", err)
+		return nil, fmt.Errorf("failed to marshal request body: %w", err)
 	}
 
 	// Create the HTTP request
-	req, err := http.NewRequest("POST", elevenLabsAPIURL, bytes.NewBuffer(bodyBytes))
+	url := fmt.Sprintf("%s/%s?output_format=pcm_%d", el.url, el.config.VoiceID, elevenLabsSampleRate)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(bodyBytes))
 	if err != nil {
-		return "", fmt.Errorf("failed to create HTTP request: %w", err)
+		return nil, fmt.Errorf("failed to create HTTP request: %w", err)
 	}
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", el.config.APIKey))
+	req.Header.Set("xi-api-key", el.config.APIKey)
 	req.Header.Set("Content-Type", "application/json")
 
 	// Send the request
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("failed to send HTTP request: %w", err)
+		return nil, fmt.Errorf("failed to send HTTP request: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("received non-OK response: %d, %s", resp.StatusCode, string(body))
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+		return nil, fmt.Errorf("received non-OK response: %d, %s", resp.StatusCode, string(body))
 	}
 
-	// Save the audio file
-	outputPath := filepath.Join(el.config.OutputDir, filename)
-	file, err := os.Create(outputPath)
+	pcm, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return "", fmt.Errorf("failed to create output file: %w", err)
+		return nil, fmt.Errorf("failed to read audio: %w", err)
 	}
-	defer file.Close()
-
-	_, err = io.Copy(file, resp.Body)
-	if err != nil {
-		return "", fmt.Errorf("failed to save audio file: %w", err)
+	samples := make([]int16, len(pcm)/2)
+	if err := binary.Read(bytes.NewReader(pcm[:len(samples)*2]), binary.LittleEndian, samples); err != nil {
+		return nil, fmt.Errorf("failed to decode audio: %w", err)
 	}
-
-	el.logger.Info("Audio file saved successfully", zap.String("path", outputPath))
-	return outputPath, nil
+	return &Audio{SampleRate: elevenLabsSampleRate, Channels: 1, Samples: samples}, nil
 }
 
-// FreeTTS handles free text-to-speech synthesis.
-type FreeTTS struct {
-	config FreeTTSConfig
-	logger *zap.Logger
+// Transcribe is not offered by this client.
+func (el *ElevenLabs) Transcribe(ctx context.Context, audio *Audio) (string, error) {
+	return "", fmt.Errorf("ElevenLabs transcription: %w", ErrSpeechUnsupported)
 }
 
-// NewFreeTTS initializes a FreeTTS client.
-func NewFreeTTS(config FreeTTSConfig, logger *zap.Logger) (*FreeTTS, error) {
-	// Ensure the output directory exists
-	if err := os.MkdirAll(config.OutputDir, 0755); err != nil {
-		return nil, fmt.Errorf("failed to create output directory: %w", err)
-	}
-
-	return &FreeTTS{
-		config: config,
-		logger: logger,
-	}, nil
-}
-
-// SynthesizeSpeech sends a request to FreeTTS API and saves the resulting audio.
-func (ft *FreeTTS) SynthesizeSpeech(text, filename string) (string, error) {
-	if text == "" {
-		return "", fmt.Errorf("text cannot be empty")
-	}
-
-	// Prepare the request body
-	requestBody := map[string]interface{}{
-		"text": text,
-		"lang": ft.config.DefaultLang,
-	}
-	bodyBytes, err := json.Marshal(requestBody)
-	if err != nil {
-		return "", fmt.Errorf("failed to marshal request body: %w", err)
-	}
-
-	// Create the HTTP request
-	req, err := http.NewRequest("POST", freeTTSAPIURL, bytes.NewBuffer(bodyBytes))
-	if err != nil {
-		return "", fmt.Errorf("failed to create HTTP request: %w", err)
-	}
-	req.Header.Set("Content-Type", "application/json")
-
-	// Send the request
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return "", fmt.Errorf("failed to send HTTP request: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("received non-OK response: %d, %s", resp.StatusCode, string(body))
-	}
-
-	// Save the audio file
-	outputPath := filepath.Join(ft.config.OutputDir, filename)
-	file, err := os.Create(outputPath)
-	if err != nil {
-		return "", fmt.Errorf("failed to create output file: %w", err)
-	}
-	defer file.Close()
-
-	_, err = io.Copy(file, resp.Body)
-	if err != nil {
-		return "", fmt.Errorf("failed to save audio file: %w", err)
+// SynthesizeSpeech speaks text and saves it as a WAV file in the output directory.
+func (el *ElevenLabs) SynthesizeSpeech(text, filename string) (string, error) {
+	outputPath := filepath.Join(el.config.OutputDir, filename)
+	if err := SaveSpeech(context.Background(), el, text, outputPath); err != nil {
+		return "", err
 	}
-
-	ft.logger.Info("Audio file saved successfully", zap.String("path", outputPath))
+	el.logger.Info("Audio file saved successfully", zap.String("path", outputPath))
 	return outputPath, nil
 }
 
-// DetermineTTS determines which TTS service to use based on the configuration.
-func DetermineTTS(aiConfigPath string, logger *zap.Logger) (interface{}, error) {
-	config, err := LoadConfig(aiConfigPath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to load AI configuration: %w", err)
-	}
-
-	if config.ControlParams != nil && config.ControlParams["elevenlabs_api_key"] != nil {
-		elevenLabsConfig := ElevenLabsConfig{
-			APIKey:      config.ControlParams["elevenlabs_api_key"].(string),
-			VoiceID:     config.ControlParams["elevenlabs_voice_id"].(string),
-			OutputDir:   "./ai/audio",
-			DefaultLang: "en-US",
-		}
-		return NewElevenLabs(elevenLabsConfig, logger)
-	}
-
-	// Default to FreeTTS if ElevenLabs is not configured
-	freeTTSConfig := FreeTTSConfig{
-		OutputDir:   "./ai/audio",
-		DefaultLang: "en-US",
-	}
-	return NewFreeTTS(freeTTSConfig, logger)
+// NullSpeech synthesizes silence and transcribes everything as Transcript.
+// It stands in for a real engine in tests.
+type NullSpeech struct {
+	Transcript string
+	SampleRate int // of synthesized audio; 16 kHz if zero
 }
 
-// Example usage in the GhostShell system.
-func main() {
-	logger, _ := zap.NewProduction()
-	defer logger.Sync()
-
-	ttsService, err := DetermineTTS("./ghostshell/config/ai.yaml", logger)
-	if err != nil {
-		logger.Fatal("Failed to initialize TTS service", zap.Error(err))
+// Synthesize returns a short silence for each word of text.
+func (n *NullSpeech) Synthesize(ctx context.Context, text string) (*Audio, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
 	}
-
-	var speechFile string
-	switch tts := ttsService.(type) {
-	case *ElevenLabs:
-		speechFile, err = tts.SynthesizeSpeech("Welcome to GhostShell, your AI-driven terminal.", "welcome_message.mp3")
-	case *FreeTTS:
-		speechFile, err = tts.SynthesizeSpeech("Welcome to GhostShell, your AI-driven terminal.", "welcome_message.mp3")
+	rate := n.SampleRate
+	if rate == 0 {
+		rate = 16000
 	}
+	words := len(strings.Fields(text))
+	return &Audio{SampleRate: rate, Channels: 1, Samples: make([]int16, words*rate/4)}, nil
+}
 
-	if err != nil {
-		logger.Fatal("Failed to synthesize speech", zap.Error(err))
+// Transcribe returns Transcript.
+func (n *NullSpeech) Transcribe(ctx context.Context, audio *Audio) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
 	}
-
-	logger.Info("Speech synthesis complete", zap.String("file", speechFile))
+	return n.Transcript, nil
 }
@@ -0,0 +1,243 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Backend types accepted in BackendConfig.Type.
+const (
+	BackendSimulated = "simulated"
+	BackendOpenAI    = "openai" // any OpenAI-compatible server: llama.cpp, ollama, vLLM, ...
+)
+
+// ErrTokenizeUnsupported is returned by backends whose server cannot tokenize text.
+var ErrTokenizeUnsupported = errors.New("backend does not support tokenization")
+
+// ErrEmbeddingsUnsupported is returned by backends that cannot embed text.
+var ErrEmbeddingsUnsupported = errors.New("backend does not support embeddings")
+
+// ChatMessage is one turn of a conversation, in the OpenAI chat format.
+type ChatMessage struct {
+	Role       string     `json:"role"` // "system", "user", "assistant" or "tool"
+	Content    string     `json:"content"`
+	ToolCalls  []ToolCall `json:"tool_calls,omitempty"`   // assistant turns that call tools
+	ToolCallID string     `json:"tool_call_id,omitempty"` // tool turns, answering the call with this ID
+}
+
+// Tool describes a function the model may call, with its arguments as a JSON schema.
+type Tool struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description"`
+	Parameters  map[string]interface{} `json:"parameters"`
+}
+
+// ToolCall is a request from the model to run a tool, in the OpenAI format.
+type ToolCall struct {
+	ID       string           `json:"id"`
+	Type     string           `json:"type"` // always "function"
+	Function ToolCallFunction `json:"function"`
+}
+
+// ToolCallFunction names the tool to call. Arguments is a JSON object encoded as a string.
+type ToolCallFunction struct {
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+}
+
+// GenerateResult is a completed generation with its token counts and timing.
+type GenerateResult struct {
+	Text             string        `json:"text"`
+	Model            string        `json:"model"`         // model that answered, as reported by the backend
+	FinishReason     string        `json:"finish_reason"` // e.g. "stop" or "length"
+	PromptTokens     int           `json:"prompt_tokens"`
+	CompletionTokens int           `json:"completion_tokens"`
+	Latency          time.Duration `json:"latency_ns"` // from sending the request to the last token
+	ToolCalls        []ToolCall    `json:"tool_calls,omitempty"`
+}
+
+// InferenceBackend runs generation for a LanguageModel. Implementations must
+// be safe for concurrent use once loaded.
+type InferenceBackend interface {
+	// Name identifies the backend type, e.g. in metrics labels.
+	Name() string
+	// Load prepares the model, or checks the server that hosts it is reachable.
+	Load(ctx context.Context) error
+	// Generate returns the complete reply to messages.
+	Generate(ctx context.Context, messages []ChatMessage, params ControlParameters) (*GenerateResult, error)
+	// Stream calls onToken with each piece of the reply as it is produced, and
+	// returns the complete result. An error from onToken stops the generation.
+	Stream(ctx context.Context, messages []ChatMessage, params ControlParameters, onToken func(string) error) (*GenerateResult, error)
+	// Tokenize returns the model's token ids for text.
+	Tokenize(ctx context.Context, text string) ([]int, error)
+	// Unload releases the model or any connections to its server.
+	Unload() error
+}
+
+// ToolCallingBackend is implemented by backends whose server accepts tool
+// definitions and returns structured tool calls. Other backends see the tools
+// only as text in the system prompt, and their calls are parsed from the reply.
+type ToolCallingBackend interface {
+	GenerateWithTools(ctx context.Context, messages []ChatMessage, tools []Tool, params ControlParameters) (*GenerateResult, error)
+}
+
+// ModelDataBackend is implemented by local backends that can load a model
+// from memory. An encrypted model is decrypted into memory and handed to the
+// backend before Load, so the plaintext never touches disk.
+type ModelDataBackend interface {
+	SetModelData(data []byte)
+}
+
+// EmbeddingBackend is implemented by backends that can embed text as vectors.
+type EmbeddingBackend interface {
+	Embed(ctx context.Context, texts []string) ([][]float32, error)
+}
+
+// InferenceRecorder receives the outcome of each generation. metrics.InferenceMetrics
+// implements it.
+type InferenceRecorder interface {
+	ObserveInference(backend, model string, promptTokens, completionTokens int, latency time.Duration, err error)
+}
+
+// BackendConfig selects and configures the inference backend.
+type BackendConfig struct {
+	Type           string `yaml:"type"`            // "simulated" (default) or "openai"
+	URL            string `yaml:"url"`             // e.g. http://127.0.0.1:8080 (llama.cpp) or http://127.0.0.1:11434 (ollama)
+	Model          string `yaml:"model"`           // model name sent to the server; empty uses the first it serves
+	APIKey         string `yaml:"api_key"`         // sent as a bearer token if set
+	TimeoutSeconds int    `yaml:"timeout_seconds"` // per request; 0 means no timeout
+}
+
+// Remote reports whether the model is served over HTTP rather than loaded from ModelPath.
+func (b BackendConfig) Remote() bool {
+	return b.Type == BackendOpenAI
+}
+
+// Validate checks the backend type and its required settings.
+func (b BackendConfig) Validate() error {
+	switch b.Type {
+	case "", BackendSimulated:
+	case BackendOpenAI:
+		if b.URL == "" {
+			return fmt.Errorf("backend url cannot be empty for the %s backend", b.Type)
+		}
+		if !strings.HasPrefix(b.URL, "http://") && !strings.HasPrefix(b.URL, "https://") {
+			return fmt.Errorf("backend url must start with http:// or https://: %s", b.URL)
+		}
+	default:
+		return fmt.Errorf("unknown backend type: %s", b.Type)
+	}
+	if b.TimeoutSeconds < 0 {
+		return fmt.Errorf("backend timeout_seconds must be non-negative")
+	}
+	return nil
+}
+
+// NewBackend constructs the backend selected by config.
+func NewBackend(config *Config) (InferenceBackend, error) {
+	switch config.Backend.Type {
+	case "", BackendSimulated:
+		return newSimulatedBackend(config.ModelPath), nil
+	case BackendOpenAI:
+		return NewOpenAIBackend(config.Backend), nil
+	default:
+		return nil, fmt.Errorf("unknown backend type: %s", config.Backend.Type)
+	}
+}
+
+// simulatedBackend stands in for a real model so the rest of the stack can be
+// exercised without one. Replies echo the prompt and parameters.
+type simulatedBackend struct {
+	path string
+	data []byte // the decrypted model, if it was encrypted
+}
+
+func newSimulatedBackend(path string) *simulatedBackend {
+	return &simulatedBackend{path: path}
+}
+
+func (b *simulatedBackend) Name() string {
+	return BackendSimulated
+}
+
+func (b *simulatedBackend) SetModelData(data []byte) {
+	b.data = data
+}
+
+func (b *simulatedBackend) Load(ctx context.Context) error {
+	// Simulate loading time
+	return sleepContext(ctx, 500*time.Millisecond)
+}
+
+func (b *simulatedBackend) Generate(ctx context.Context, messages []ChatMessage, params ControlParameters) (*GenerateResult, error) {
+	return b.Stream(ctx, messages, params, nil)
+}
+
+func (b *simulatedBackend) Stream(ctx context.Context, messages []ChatMessage, params ControlParameters, onToken func(string) error) (*GenerateResult, error) {
+	start := time.Now()
+	prompt := ""
+	if len(messages) > 0 {
+		prompt = messages[len(messages)-1].Content
+	}
+	response := fmt.Sprintf("Simulated response to prompt: \"%s\"\n(temperature=%.2f, max_tokens=%d, top_p=%.2f, top_k=%d)",
+		prompt, params.Temperature, params.MaxTokens, params.TopP, params.TopK)
+
+	// Sleep to mimic some compute time
+	if err := sleepContext(ctx, 300*time.Millisecond); err != nil {
+		return nil, err
+	}
+	words := strings.SplitAfter(response, " ")
+	if onToken != nil {
+		for _, w := range words {
+			if err := onToken(w); err != nil {
+				return nil, err
+			}
+			// Pace the words like a model producing tokens
+			if err := sleepContext(ctx, 20*time.Millisecond); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	promptTokens := 0
+	for _, m := range messages {
+		promptTokens += len(strings.Fields(m.Content))
+	}
+	return &GenerateResult{
+		Text:             response,
+		Model:            b.path,
+		FinishReason:     "stop",
+		PromptTokens:     promptTokens,
+		CompletionTokens: len(words),
+		Latency:          time.Since(start),
+	}, nil
+}
+
+// Tokenize approximates tokens as whitespace-separated words.
+func (b *simulatedBackend) Tokenize(ctx context.Context, text string) ([]int, error) {
+	words := strings.Fields(text)
+	tokens := make([]int, len(words))
+	for i := range words {
+		tokens[i] = i
+	}
+	return tokens, nil
+}
+
+func (b *simulatedBackend) Unload() error {
+	return nil
+}
+
+// sleepContext sleeps for d, returning early with the context's error if it is cancelled.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
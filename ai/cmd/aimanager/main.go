@@ -359,7 +359,7 @@ func (app *Application) initializeVault() error {
 
 // loadAIConfig loads the AI configuration from the specified path or creates defaults
 func (app *Application) loadAIConfig(path string) error {
-	aiCfg, err := ai.LoadConfig(path)
+	aiCfg, err := ai.LoadConfig(path, app.Logger)
 	if err != nil {
 		app.Logger.Warn("No existing AI config found or error reading it. Creating defaults.",
 			zap.String("path", path),
@@ -372,7 +372,7 @@ func (app *Application) loadAIConfig(path string) error {
 				MaxTokens:   512,
 			},
 		}
-		if saveErr := ai.SaveConfig(aiCfg, path); saveErr != nil {
+		if saveErr := ai.SaveConfig(aiCfg, path, app.Logger); saveErr != nil {
 			return fmt.Errorf("failed to create default AI config: %w", saveErr)
 		}
 	}
@@ -210,7 +210,7 @@ func main() {
 	// Define converter configuration
 	config := ConverterConfig{
 		PythonPath: "/usr/bin/python3", // Adjust path as necessary
-		ScriptPath: filepath.Join("ghostshell", "converter", "converter.py"),
+		ScriptPath: filepath.Join("ai", "cmd", "converter", "converter.py"),
 		LogDir:     filepath.Join("ghostshell", "logging"),
 		Timeout:    5 * time.Minute, // Adjust timeout as necessary
 		NativeMode: false,           // Set to true for native conversion
@@ -2,6 +2,7 @@ package ai
 
 import (
 	"fmt"
+	"net"
 	"os"
 	"path/filepath"
 	"sync"
@@ -19,40 +20,161 @@ type ControlParameters struct {
 	// Add more parameters as needed
 }
 
+// Validate ensures the parameters are within the ranges backends accept.
+func (p ControlParameters) Validate() error {
+	if p.Temperature < 0.0 || p.Temperature > 1.0 {
+		return fmt.Errorf("temperature must be between 0.0 and 1.0")
+	}
+	if p.MaxTokens <= 0 {
+		return fmt.Errorf("max_tokens must be greater than zero")
+	}
+	if p.TopP < 0.0 || p.TopP > 1.0 {
+		return fmt.Errorf("top_p must be between 0.0 and 1.0")
+	}
+	if p.TopK < 0 {
+		return fmt.Errorf("top_k must be non-negative")
+	}
+	return nil
+}
+
 // Config represents the overall AI configuration.
 type Config struct {
 	ModelPath     string            `yaml:"model_path"`
+	ModelsDir     string            `yaml:"models_dir"` // GGUF models listed in the model catalog
 	ControlParams ControlParameters `yaml:"control_params"`
 	LogLevel      string            `yaml:"log_level"`
 	CacheEnabled  bool              `yaml:"cache_enabled"`
 	CachePath     string            `yaml:"cache_path"`
+	Backend       BackendConfig     `yaml:"backend"`
+	// Generations run at once by the server routes, and how many more may wait
+	MaxConcurrentRequests int `yaml:"max_concurrent_requests"`
+	MaxQueuedRequests     int `yaml:"max_queued_requests"`
+	// Seconds a request that doesn't stream may queue and generate for; 0 means
+	// no limit. Such requests can't tell when their client disconnects.
+	RequestTimeoutSeconds int `yaml:"request_timeout_seconds"`
+	// Scan results and reports indexed for question answering
+	Retrieval RetrievalConfig `yaml:"retrieval"`
+	// Signed manifests and at-rest encryption of model files
+	Integrity IntegrityConfig `yaml:"integrity"`
+	// Named system and opening prompts, with {{variable}} placeholders
+	Templates []PromptTemplate `yaml:"templates"`
+	// Where conversations are kept, and how long ones are fitted to the model
+	Conversations ConversationConfig `yaml:"conversations"`
+	// Text-to-speech and speech-to-text
+	Voice VoiceConfig `yaml:"voice"`
+	// Address the server listens on, and the bearer token its routes require.
+	// A token is needed to listen on anything but loopback.
+	ListenAddr string `yaml:"listen_addr"`
+	AuthToken  string `yaml:"auth_token"`
 	// Add more configuration fields as needed
 }
 
+// RetrievalConfig sets where the retrieval index is kept and what it ingests.
+type RetrievalConfig struct {
+	IndexPath string   `yaml:"index_path"` // empty keeps the index in memory only
+	Sources   []string `yaml:"sources"`    // directories of scan results and reports, ingested at startup
+}
+
+// IntegrityConfig sets how model manifests are enforced and where model
+// keys come from.
+type IntegrityConfig struct {
+	Policy     string `yaml:"policy"`      // off, warn or deny; empty is warn
+	TrustStore string `yaml:"trust_store"` // trusted signer keys
+	KeyEnv     string `yaml:"key_env"`     // environment variable holding the hex key of encrypted models
+}
+
+// ConversationConfig sets where conversations are stored and how they are
+// fitted to the model's context window.
+type ConversationConfig struct {
+	Dir           string `yaml:"dir"`
+	ContextWindow int    `yaml:"context_window"` // tokens; 0 reads it from the GGUF metadata
+	Strategy      string `yaml:"strategy"`       // truncate or summarize old turns
+}
+
+// VoiceConfig selects the speech engine. The local engine runs the commands,
+// whose arguments may use {text}, {input} and {output} placeholders.
+type VoiceConfig struct {
+	Engine            string   `yaml:"engine"` // local, elevenlabs or null
+	SynthesizeCommand []string `yaml:"synthesize_command"`
+	TranscribeCommand []string `yaml:"transcribe_command"`
+	TimeoutSeconds    int      `yaml:"timeout_seconds"`
+	OutputDir         string   `yaml:"output_dir"`
+	ElevenLabsAPIKey  string   `yaml:"elevenlabs_api_key"`
+	ElevenLabsVoiceID string   `yaml:"elevenlabs_voice_id"`
+}
+
 // Validate ensures the config is logically valid.
 func (c *Config) Validate() error {
-	if c.ModelPath == "" {
+	if c.ModelPath == "" && !c.Backend.Remote() {
 		return fmt.Errorf("model_path cannot be empty")
 	}
-	if c.ControlParams.Temperature < 0.0 || c.ControlParams.Temperature > 1.0 {
-		return fmt.Errorf("temperature must be between 0.0 and 1.0")
+	if err := c.ControlParams.Validate(); err != nil {
+		return err
 	}
-	if c.ControlParams.MaxTokens <= 0 {
-		return fmt.Errorf("max_tokens must be greater than zero")
+	if c.CacheEnabled && c.CachePath == "" {
+		return fmt.Errorf("cache_path must be set if caching is enabled")
 	}
-	if c.ControlParams.TopP < 0.0 || c.ControlParams.TopP > 1.0 {
-		return fmt.Errorf("top_p must be between 0.0 and 1.0")
+	if err := c.Backend.Validate(); err != nil {
+		return err
 	}
-	if c.ControlParams.TopK < 0 {
-		return fmt.Errorf("top_k must be non-negative")
+	if c.MaxConcurrentRequests < 0 || c.MaxQueuedRequests < 0 {
+		return fmt.Errorf("max_concurrent_requests and max_queued_requests must be non-negative")
 	}
-	if c.CacheEnabled && c.CachePath == "" {
-		return fmt.Errorf("cache_path must be set if caching is enabled")
+	if c.RequestTimeoutSeconds < 0 {
+		return fmt.Errorf("request_timeout_seconds must be non-negative")
+	}
+	switch c.Integrity.Policy {
+	case "", IntegrityOff, IntegrityWarn, IntegrityDeny:
+	default:
+		return fmt.Errorf("integrity.policy must be off, warn or deny, got %q", c.Integrity.Policy)
+	}
+	if err := validateTemplates(c.Templates); err != nil {
+		return err
+	}
+	switch c.Conversations.Strategy {
+	case "", ContextTruncate, ContextSummarize:
+	default:
+		return fmt.Errorf("conversations.strategy must be truncate or summarize, got %q", c.Conversations.Strategy)
+	}
+	if c.Conversations.ContextWindow < 0 {
+		return fmt.Errorf("conversations.context_window must be non-negative")
+	}
+	switch c.Voice.Engine {
+	case "", SpeechLocal, SpeechElevenLabs, SpeechNull:
+	default:
+		return fmt.Errorf("voice.engine must be local, elevenlabs or null, got %q", c.Voice.Engine)
+	}
+	if c.AuthToken == "" && !loopbackAddr(c.Listen()) {
+		return fmt.Errorf("auth_token must be set to listen on %s", c.Listen())
 	}
 	// Add more validation rules as needed
 	return nil
 }
 
+// DefaultListenAddr only accepts local connections.
+const DefaultListenAddr = "127.0.0.1:8080"
+
+// Listen returns the address the server listens on.
+func (c *Config) Listen() string {
+	if c.ListenAddr == "" {
+		return DefaultListenAddr
+	}
+	return c.ListenAddr
+}
+
+// loopbackAddr reports whether addr only accepts local connections.
+func loopbackAddr(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
 // GetDefaultConfigPath returns the default path for ai_config.yaml
 func GetDefaultConfigPath() string {
 	return filepath.Join("ghostshell", "config", "ai_config.yaml")
@@ -132,6 +254,7 @@ func LoadConfig(filePath string, logger *zap.Logger) (*Config, error) {
 func GetDefaultConfig() *Config {
 	return &Config{
 		ModelPath: "ai/models/default.gguf",
+		ModelsDir: "ai/models",
 		ControlParams: ControlParameters{
 			Temperature: 0.7,
 			MaxTokens:   512,
@@ -141,6 +264,34 @@ func GetDefaultConfig() *Config {
 		LogLevel:     "info",
 		CacheEnabled: true,
 		CachePath:    "ai/cache",
+		Backend: BackendConfig{
+			Type: BackendSimulated,
+		},
+		MaxConcurrentRequests: 1,
+		MaxQueuedRequests:     8,
+		RequestTimeoutSeconds: 300,
+		Retrieval: RetrievalConfig{
+			IndexPath: "ai/cache/retrieval_index.json",
+			Sources:   []string{"ghostshell/reporting"},
+		},
+		Integrity: IntegrityConfig{
+			Policy:     IntegrityWarn,
+			TrustStore: "ghostshell/config/ai_trusted_signers.json",
+			KeyEnv:     "GHOSTSHELL_MODEL_KEY",
+		},
+		Templates: defaultTemplates(),
+		Conversations: ConversationConfig{
+			Dir:      "ai/conversations",
+			Strategy: ContextSummarize,
+		},
+		Voice: VoiceConfig{
+			Engine:            SpeechLocal,
+			SynthesizeCommand: []string{"piper", "--model", "ai/voices/en_US-lessac-medium.onnx", "--output_file", "{output}"},
+			TranscribeCommand: []string{"whisper-cli", "--model", "ai/models/ggml-base.en.bin", "--no-timestamps", "--file", "{input}"},
+			TimeoutSeconds:    60,
+			OutputDir:         "ai/audio",
+		},
+		ListenAddr: DefaultListenAddr,
 		// Initialize other default fields as needed
 	}
 }
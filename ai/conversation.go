@@ -0,0 +1,457 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Context strategies, for conversations longer than the model's context window.
+const (
+	ContextTruncate  = "truncate"  // drop the oldest turns
+	ContextSummarize = "summarize" // fold the oldest turns into a running summary
+)
+
+// DefaultContextWindow is assumed when neither the config nor the model's
+// metadata gives a context length.
+const DefaultContextWindow = 4096
+
+// defaultEngagement holds conversations started without an engagement.
+const defaultEngagement = "general"
+
+// TokenUsage counts the tokens a conversation has used.
+type TokenUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+}
+
+// ConversationMessage is a turn of a conversation. Replies record the model
+// and parameters that produced them.
+type ConversationMessage struct {
+	Role             string             `json:"role"` // "user" or "assistant"
+	Content          string             `json:"content"`
+	Time             time.Time          `json:"time"`
+	Model            string             `json:"model,omitempty"`
+	Params           *ControlParameters `json:"params,omitempty"`
+	PromptTokens     int                `json:"prompt_tokens,omitempty"`
+	CompletionTokens int                `json:"completion_tokens,omitempty"`
+	FinishReason     string             `json:"finish_reason,omitempty"`
+}
+
+// Conversation is a persisted chat with the model, filed under an engagement.
+type Conversation struct {
+	ID         string                `json:"id"`
+	Engagement string                `json:"engagement"`
+	Title      string                `json:"title"`
+	Template   string                `json:"template,omitempty"` // the prompt template it was started from
+	System     string                `json:"system,omitempty"`
+	Params     *ControlParameters    `json:"params,omitempty"` // overrides for every turn; nil uses the server's
+	Messages   []ConversationMessage `json:"messages"`
+	Summary    string                `json:"summary,omitempty"`    // of the first Summarized messages
+	Summarized int                   `json:"summarized,omitempty"` // messages no longer sent to the model
+	Usage      TokenUsage            `json:"usage"`
+	Created    time.Time             `json:"created"`
+	Updated    time.Time             `json:"updated"`
+}
+
+// NewConversation starts an empty conversation.
+func NewConversation(engagement, title string) *Conversation {
+	engagement = strings.Join(strings.Fields(engagement), "-")
+	if engagement == "" {
+		engagement = defaultEngagement
+	}
+	if title == "" {
+		title = "Untitled"
+	}
+	now := time.Now().UTC()
+	return &Conversation{
+		ID:         GenerateID(),
+		Engagement: engagement,
+		Title:      title,
+		Created:    now,
+		Updated:    now,
+	}
+}
+
+// ApplyTemplate sets the conversation's system prompt from t, and returns the
+// rendered opening prompt for the caller to send.
+func (c *Conversation) ApplyTemplate(t PromptTemplate, vars map[string]string) (string, error) {
+	system, prompt, err := t.Render(vars)
+	if err != nil {
+		return "", err
+	}
+	c.Template = t.Name
+	c.System = system
+	return prompt, nil
+}
+
+// AddUser appends a user turn.
+func (c *Conversation) AddUser(content string) {
+	c.Messages = append(c.Messages, ConversationMessage{Role: "user", Content: content, Time: time.Now().UTC()})
+}
+
+// AddReply appends the model's reply and counts its tokens. params are the
+// parameters it was generated with, if known.
+func (c *Conversation) AddReply(res *GenerateResult, params *ControlParameters) {
+	c.Messages = append(c.Messages, ConversationMessage{
+		Role:             "assistant",
+		Content:          res.Text,
+		Time:             time.Now().UTC(),
+		Model:            res.Model,
+		Params:           params,
+		PromptTokens:     res.PromptTokens,
+		CompletionTokens: res.CompletionTokens,
+		FinishReason:     res.FinishReason,
+	})
+	c.Usage.PromptTokens += res.PromptTokens
+	c.Usage.CompletionTokens += res.CompletionTokens
+}
+
+// TokenCounter counts the tokens of a piece of text.
+type TokenCounter func(text string) int
+
+// EstimateTokens approximates a token count at four characters a token,
+// which is close for English with BPE and SentencePiece vocabularies.
+func EstimateTokens(text string) int {
+	return (len(text) + 3) / 4
+}
+
+// messageOverhead is the tokens a chat template adds around each message.
+const messageOverhead = 4
+
+// Context returns the messages to send the model: the system prompt and
+// summary, then as many of the latest turns as fit in budget tokens. The
+// latest turn is always sent. It also returns how many turns, after those
+// already summarized, were left out.
+func (c *Conversation) Context(budget int, count TokenCounter) ([]ChatMessage, int) {
+	if count == nil {
+		count = EstimateTokens
+	}
+	var head []ChatMessage
+	if system := c.systemPrompt(); system != "" {
+		head = append(head, ChatMessage{Role: "system", Content: system})
+		budget -= count(system) + messageOverhead
+	}
+
+	live := c.Messages[c.Summarized:]
+	first := len(live)
+	for first > 0 {
+		cost := count(live[first-1].Content) + messageOverhead
+		if cost > budget && first < len(live) {
+			break
+		}
+		budget -= cost
+		first--
+	}
+
+	messages := head
+	for _, m := range live[first:] {
+		messages = append(messages, ChatMessage{Role: m.Role, Content: m.Content})
+	}
+	return messages, first
+}
+
+func (c *Conversation) systemPrompt() string {
+	switch {
+	case c.Summary == "":
+		return c.System
+	case c.System == "":
+		return "Summary of the conversation so far:\n" + c.Summary
+	default:
+		return c.System + "\n\nSummary of the conversation so far:\n" + c.Summary
+	}
+}
+
+// Prepare returns the messages for the next reply within window tokens,
+// leaving room for params.MaxTokens of reply. Turns that don't fit are
+// dropped, or with ContextSummarize and a model, summarized first.
+func (c *Conversation) Prepare(ctx context.Context, window int, params ControlParameters, strategy string, model AnswerModel, count TokenCounter) ([]ChatMessage, error) {
+	budget := window - params.MaxTokens
+	if budget <= 0 {
+		return nil, fmt.Errorf("max_tokens %d leaves no room for the conversation in a %d token context", params.MaxTokens, window)
+	}
+	messages, dropped := c.Context(budget, count)
+	if dropped == 0 || strategy != ContextSummarize || model == nil {
+		return messages, nil
+	}
+	if err := c.summarize(ctx, model, dropped); err != nil {
+		return nil, err
+	}
+	messages, _ = c.Context(budget, count)
+	return messages, nil
+}
+
+// summarize folds the n oldest unsummarized turns into the summary.
+func (c *Conversation) summarize(ctx context.Context, model AnswerModel, n int) error {
+	var transcript strings.Builder
+	if c.Summary != "" {
+		fmt.Fprintf(&transcript, "Summary so far:\n%s\n\n", c.Summary)
+	}
+	for _, m := range c.Messages[c.Summarized : c.Summarized+n] {
+		fmt.Fprintf(&transcript, "%s: %s\n\n", m.Role, m.Content)
+	}
+	res, err := model.Generate(ctx, []ChatMessage{
+		{Role: "system", Content: "Summarize this conversation for a colleague taking it over. Keep every host, port, credential reference, CVE, finding and decision; drop pleasantries. Reply with the summary only."},
+		{Role: "user", Content: transcript.String()},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to summarize conversation: %w", err)
+	}
+	c.Summary = strings.TrimSpace(res.Text)
+	c.Summarized += n
+	c.Usage.PromptTokens += res.PromptTokens
+	c.Usage.CompletionTokens += res.CompletionTokens
+	return nil
+}
+
+// Markdown renders the conversation for a report or a ticket.
+func (c *Conversation) Markdown() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n\n", c.Title)
+	fmt.Fprintf(&b, "- Engagement: %s\n", c.Engagement)
+	if c.Template != "" {
+		fmt.Fprintf(&b, "- Template: %s\n", c.Template)
+	}
+	fmt.Fprintf(&b, "- Started: %s\n", c.Created.Format(time.RFC3339))
+	fmt.Fprintf(&b, "- Tokens: %d prompt, %d completion\n", c.Usage.PromptTokens, c.Usage.CompletionTokens)
+	if c.System != "" {
+		fmt.Fprintf(&b, "\n## System prompt\n\n%s\n", c.System)
+	}
+	if c.Summary != "" {
+		fmt.Fprintf(&b, "\n## Summary of earlier turns\n\n%s\n", c.Summary)
+	}
+	b.WriteString("\n## Conversation\n")
+	for _, m := range c.Messages {
+		if m.Role == "user" {
+			fmt.Fprintf(&b, "\n### You (%s)\n\n%s\n", m.Time.Format("2006-01-02 15:04"), m.Content)
+			continue
+		}
+		details := []string{m.Time.Format("2006-01-02 15:04")}
+		if m.Model != "" {
+			details = append(details, m.Model)
+		}
+		if m.Params != nil {
+			details = append(details, fmt.Sprintf("temperature %.2f", m.Params.Temperature))
+		}
+		if m.CompletionTokens > 0 {
+			details = append(details, fmt.Sprintf("%d tokens", m.CompletionTokens))
+		}
+		fmt.Fprintf(&b, "\n### Assistant (%s)\n\n%s\n", strings.Join(details, ", "), m.Content)
+	}
+	return b.String()
+}
+
+// JSON renders the conversation as indented JSON.
+func (c *Conversation) JSON() ([]byte, error) {
+	return json.MarshalIndent(c, "", "  ")
+}
+
+// ConversationInfo describes a stored conversation without its messages.
+type ConversationInfo struct {
+	ID         string     `json:"id"`
+	Engagement string     `json:"engagement"`
+	Title      string     `json:"title"`
+	Messages   int        `json:"messages"`
+	Usage      TokenUsage `json:"usage"`
+	Updated    time.Time  `json:"updated"`
+}
+
+// ConversationStore keeps conversations as JSON files, one directory per
+// engagement.
+type ConversationStore struct {
+	dir string
+	mu  sync.Mutex
+}
+
+// NewConversationStore returns a store in dir.
+func NewConversationStore(dir string) *ConversationStore {
+	return &ConversationStore{dir: dir}
+}
+
+// ErrConversationNotFound is returned by Load for an unknown conversation.
+var ErrConversationNotFound = errors.New("conversation not found")
+
+// Save writes the conversation, replacing any earlier copy.
+func (s *ConversationStore) Save(c *Conversation) error {
+	path, err := s.path(c.Engagement, c.ID)
+	if err != nil {
+		return err
+	}
+	c.Updated = time.Now().UTC()
+	data, err := c.JSON()
+	if err != nil {
+		return fmt.Errorf("failed to encode conversation: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create conversation directory: %w", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write conversation: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to write conversation: %w", err)
+	}
+	return nil
+}
+
+// Load reads a conversation.
+func (s *ConversationStore) Load(engagement, id string) (*Conversation, error) {
+	path, err := s.path(engagement, id)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	data, err := os.ReadFile(path)
+	s.mu.Unlock()
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrConversationNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read conversation: %w", err)
+	}
+	var c Conversation
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("failed to parse conversation: %w", err)
+	}
+	return &c, nil
+}
+
+// Delete removes a conversation.
+func (s *ConversationStore) Delete(engagement, id string) error {
+	path, err := s.path(engagement, id)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := os.Remove(path); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return ErrConversationNotFound
+		}
+		return fmt.Errorf("failed to delete conversation: %w", err)
+	}
+	return nil
+}
+
+// Export writes the conversation as Markdown ("markdown" or "md") or JSON to
+// the engagement's exports directory, and returns the file's path.
+func (s *ConversationStore) Export(c *Conversation, format string) (string, error) {
+	path, err := s.path(c.Engagement, c.ID)
+	if err != nil {
+		return "", err
+	}
+	var data []byte
+	switch format {
+	case "markdown", "md":
+		data = []byte(c.Markdown())
+		format = "md"
+	case "json":
+		if data, err = c.JSON(); err != nil {
+			return "", fmt.Errorf("failed to encode conversation: %w", err)
+		}
+	default:
+		return "", fmt.Errorf("unknown export format %q", format)
+	}
+
+	out := filepath.Join(filepath.Dir(path), "exports", c.ID+"."+format)
+	if err := os.MkdirAll(filepath.Dir(out), 0700); err != nil {
+		return "", fmt.Errorf("failed to create exports directory: %w", err)
+	}
+	if err := os.WriteFile(out, data, 0600); err != nil {
+		return "", fmt.Errorf("failed to write export: %w", err)
+	}
+	return out, nil
+}
+
+// Engagements returns the engagements that have conversations, sorted.
+func (s *ConversationStore) Engagements() ([]string, error) {
+	entries, err := os.ReadDir(s.dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list engagements: %w", err)
+	}
+	var names []string
+	for _, e := range entries {
+		if e.IsDir() {
+			names = append(names, e.Name())
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// List describes the conversations of an engagement, or of every engagement
+// if it is empty, most recently updated first.
+func (s *ConversationStore) List(engagement string) ([]ConversationInfo, error) {
+	engagements := []string{engagement}
+	if engagement == "" {
+		var err error
+		if engagements, err = s.Engagements(); err != nil {
+			return nil, err
+		}
+	}
+
+	var list []ConversationInfo
+	for _, name := range engagements {
+		if !validStoreName(name) {
+			return nil, fmt.Errorf("invalid engagement name %q", name)
+		}
+		files, err := filepath.Glob(filepath.Join(s.dir, name, "*.json"))
+		if err != nil {
+			return nil, fmt.Errorf("failed to list conversations: %w", err)
+		}
+		for _, file := range files {
+			c, err := s.Load(name, strings.TrimSuffix(filepath.Base(file), ".json"))
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, ConversationInfo{
+				ID:         c.ID,
+				Engagement: c.Engagement,
+				Title:      c.Title,
+				Messages:   len(c.Messages),
+				Usage:      c.Usage,
+				Updated:    c.Updated,
+			})
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Updated.After(list[j].Updated) })
+	return list, nil
+}
+
+func (s *ConversationStore) path(engagement, id string) (string, error) {
+	if !validStoreName(engagement) {
+		return "", fmt.Errorf("invalid engagement name %q", engagement)
+	}
+	if !validStoreName(id) {
+		return "", fmt.Errorf("invalid conversation id %q", id)
+	}
+	return filepath.Join(s.dir, engagement, id+".json"), nil
+}
+
+// validStoreName reports whether name can be used as a file name in the
+// store: letters, digits, '.', '-' and '_', not starting with a dot.
+func validStoreName(name string) bool {
+	if name == "" || name[0] == '.' || len(name) > 128 {
+		return false
+	}
+	for _, r := range name {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '.' || r == '-' || r == '_') {
+			return false
+		}
+	}
+	return true
+}
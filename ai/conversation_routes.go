@@ -0,0 +1,230 @@
+package ai
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/gofiber/fiber/v2"
+	"go.uber.org/zap"
+)
+
+// ConversationRequest is the body of the /conversations routes.
+type ConversationRequest struct {
+	Engagement string             `json:"engagement,omitempty"`
+	Title      string             `json:"title,omitempty"`
+	Template   string             `json:"template,omitempty"`  // start from a prompt template
+	Variables  map[string]string  `json:"variables,omitempty"` // the template's variables
+	System     string             `json:"system,omitempty"`    // system prompt, if not from a template
+	Params     *ControlParameters `json:"params,omitempty"`    // overrides for every turn
+	Content    string             `json:"content,omitempty"`   // a message to send
+}
+
+// SetupConversationRoutes adds the routes for prompt templates and persisted
+// conversations, filed by engagement.
+//
+//	GET    /templates
+//	GET    /conversations?engagement=acme
+//	POST   /conversations                          => { "engagement": "acme", "template": "recon-summary", "variables": {...} }
+//	GET    /conversations/:engagement/:id
+//	DELETE /conversations/:engagement/:id
+//	POST   /conversations/:engagement/:id/messages => { "content": "what about port 445?" }
+//	GET    /conversations/:engagement/:id/export?format=markdown
+func SetupConversationRoutes(app *fiber.App, loader *ModelLoader, store *ConversationStore, templates []PromptTemplate, config ConversationConfig, logger *zap.SugaredLogger) {
+	// A conversation takes one message at a time
+	var locksMu sync.Mutex
+	locks := make(map[string]*sync.Mutex)
+	lock := func(key string) func() {
+		locksMu.Lock()
+		l, ok := locks[key]
+		if !ok {
+			l = &sync.Mutex{}
+			locks[key] = l
+		}
+		locksMu.Unlock()
+		l.Lock()
+		return l.Unlock
+	}
+
+	parse := func(c *fiber.Ctx) (*ConversationRequest, error) {
+		var req ConversationRequest
+		if err := c.BodyParser(&req); err != nil {
+			logger.Errorw("Failed to parse conversation request", "error", err)
+			return nil, errors.New("Invalid request payload")
+		}
+		return &req, nil
+	}
+	load := func(c *fiber.Ctx) (*Conversation, error) {
+		conv, err := store.Load(c.Params("engagement"), c.Params("id"))
+		if err != nil {
+			status := fiber.StatusBadRequest
+			if errors.Is(err, ErrConversationNotFound) {
+				status = fiber.StatusNotFound
+			}
+			return nil, errorJSON(c, status, err)
+		}
+		return conv, nil
+	}
+
+	app.Get("/templates", func(c *fiber.Ctx) error {
+		type templateInfo struct {
+			PromptTemplate
+			Variables []string `json:"variables"`
+		}
+		list := make([]templateInfo, 0, len(templates))
+		for _, t := range templates {
+			list = append(list, templateInfo{t, t.Variables()})
+		}
+		return c.JSON(fiber.Map{
+			"status":    "success",
+			"templates": list,
+		})
+	})
+
+	app.Get("/conversations", func(c *fiber.Ctx) error {
+		list, err := store.List(c.Query("engagement"))
+		if err != nil {
+			return errorJSON(c, fiber.StatusBadRequest, err)
+		}
+		engagements, err := store.Engagements()
+		if err != nil {
+			return errorJSON(c, fiber.StatusInternalServerError, err)
+		}
+		return c.JSON(fiber.Map{
+			"status":        "success",
+			"engagements":   engagements,
+			"conversations": list,
+		})
+	})
+
+	app.Post("/conversations", func(c *fiber.Ctx) error {
+		req, err := parse(c)
+		if err != nil {
+			return errorJSON(c, fiber.StatusBadRequest, err)
+		}
+		if req.Params != nil {
+			if err := req.Params.Validate(); err != nil {
+				return errorJSON(c, fiber.StatusBadRequest, err)
+			}
+		}
+		conv := NewConversation(req.Engagement, req.Title)
+		conv.System = req.System
+		conv.Params = req.Params
+
+		prompt := ""
+		if req.Template != "" {
+			t, err := FindTemplate(templates, req.Template)
+			if err != nil {
+				return errorJSON(c, fiber.StatusBadRequest, err)
+			}
+			if prompt, err = conv.ApplyTemplate(*t, req.Variables); err != nil {
+				return errorJSON(c, fiber.StatusBadRequest, err)
+			}
+			if req.Title == "" {
+				conv.Title = t.Description
+			}
+		}
+		if err := store.Save(conv); err != nil {
+			logger.Errorw("Failed to save conversation", "error", err)
+			return errorJSON(c, fiber.StatusBadRequest, err)
+		}
+		logger.Infow("Started conversation", "engagement", conv.Engagement, "id", conv.ID, "template", conv.Template)
+		return c.JSON(fiber.Map{
+			"status":       "success",
+			"conversation": conv,
+			"prompt":       prompt, // the template's opening prompt, to send as the first message
+		})
+	})
+
+	app.Get("/conversations/:engagement/:id", func(c *fiber.Ctx) error {
+		conv, err := load(c)
+		if conv == nil {
+			return err
+		}
+		return c.JSON(fiber.Map{
+			"status":       "success",
+			"conversation": conv,
+		})
+	})
+
+	app.Delete("/conversations/:engagement/:id", func(c *fiber.Ctx) error {
+		if err := store.Delete(c.Params("engagement"), c.Params("id")); err != nil {
+			status := fiber.StatusBadRequest
+			if errors.Is(err, ErrConversationNotFound) {
+				status = fiber.StatusNotFound
+			}
+			return errorJSON(c, status, err)
+		}
+		return c.JSON(fiber.Map{
+			"status":  "success",
+			"message": "Conversation deleted",
+		})
+	})
+
+	app.Post("/conversations/:engagement/:id/messages", func(c *fiber.Ctx) error {
+		req, err := parse(c)
+		if err != nil {
+			return errorJSON(c, fiber.StatusBadRequest, err)
+		}
+		if strings.TrimSpace(req.Content) == "" {
+			return errorJSON(c, fiber.StatusBadRequest, errors.New("content cannot be empty"))
+		}
+
+		unlock := lock(c.Params("engagement") + "/" + c.Params("id"))
+		defer unlock()
+		conv, err := load(c)
+		if conv == nil {
+			return err
+		}
+
+		params := loader.ControlParameters()
+		if conv.Params != nil {
+			params = *conv.Params
+		}
+		conv.AddUser(req.Content)
+		messages, err := conv.Prepare(c.Context(), loader.ContextWindow(), params, config.Strategy, loader, nil)
+		if err != nil {
+			return errorJSON(c, fiber.StatusBadRequest, err)
+		}
+		res, err := loader.GenerateWith(c.Context(), messages, params)
+		if err != nil {
+			logger.Errorw("Failed to generate conversation reply", "engagement", conv.Engagement, "id", conv.ID, "error", err)
+			return errorJSON(c, fiber.StatusInternalServerError, err)
+		}
+		conv.AddReply(res, &params)
+		if err := store.Save(conv); err != nil {
+			logger.Errorw("Failed to save conversation", "error", err)
+			return errorJSON(c, fiber.StatusInternalServerError, err)
+		}
+		return c.JSON(fiber.Map{
+			"status":     "success",
+			"reply":      conv.Messages[len(conv.Messages)-1],
+			"usage":      conv.Usage,
+			"summarized": conv.Summarized,
+		})
+	})
+
+	app.Get("/conversations/:engagement/:id/export", func(c *fiber.Ctx) error {
+		conv, err := load(c)
+		if conv == nil {
+			return err
+		}
+		switch c.Query("format", "markdown") {
+		case "markdown", "md":
+			c.Set(fiber.HeaderContentType, "text/markdown; charset=utf-8")
+			c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="%s.md"`, conv.ID))
+			return c.SendString(conv.Markdown())
+		case "json":
+			data, err := conv.JSON()
+			if err != nil {
+				return errorJSON(c, fiber.StatusInternalServerError, err)
+			}
+			c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+			c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="%s.json"`, conv.ID))
+			return c.Send(data)
+		default:
+			return errorJSON(c, fiber.StatusBadRequest, errors.New("format must be markdown or json"))
+		}
+	})
+}
@@ -0,0 +1,148 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestPromptTemplateRender(t *testing.T) {
+	tmpl, err := FindTemplate(defaultTemplates(), "recon-summary")
+	if err != nil {
+		t.Fatalf("FindTemplate: %v", err)
+	}
+	if got := strings.Join(tmpl.Variables(), ","); got != "engagement,results,target" {
+		t.Errorf("Variables() = %s", got)
+	}
+
+	if _, _, err := tmpl.Render(map[string]string{"target": "10.0.0.5"}); err == nil || !strings.Contains(err.Error(), "results") {
+		t.Errorf("expected the missing variable to be named, got %v", err)
+	}
+	system, prompt, err := tmpl.Render(map[string]string{"target": "10.0.0.5", "results": "3389/tcp open"})
+	if err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+	if !strings.Contains(system, "the current engagement") || !strings.Contains(prompt, "10.0.0.5") || strings.Contains(prompt, "{{") {
+		t.Errorf("unexpected render:\n%s\n%s", system, prompt)
+	}
+
+	if err := validateTemplates([]PromptTemplate{{Name: "a"}, {Name: "a"}}); err == nil {
+		t.Error("expected duplicate template names to be rejected")
+	}
+}
+
+func TestConversationContext(t *testing.T) {
+	conv := NewConversation("Acme Corp", "RDP exposure")
+	if conv.Engagement != "Acme-Corp" {
+		t.Errorf("engagement %q", conv.Engagement)
+	}
+	conv.System = "You are a pentest assistant."
+	for i := 0; i < 10; i++ {
+		conv.AddUser(strings.Repeat("question ", 20))
+		conv.AddReply(&GenerateResult{Text: strings.Repeat("answer ", 40), Model: "tiny", PromptTokens: 50, CompletionTokens: 70}, &ControlParameters{Temperature: 0.2, MaxTokens: 256})
+	}
+	if conv.Usage.PromptTokens != 500 || conv.Usage.CompletionTokens != 700 {
+		t.Errorf("usage %+v", conv.Usage)
+	}
+
+	// Each turn is about 50 or 75 tokens, so only the latest few fit in 300
+	messages, dropped := conv.Context(300, nil)
+	if messages[0].Role != "system" || len(messages) != 5 || dropped != 16 {
+		t.Errorf("expected the system prompt and 4 turns with 16 dropped, got %d messages, %d dropped", len(messages), dropped)
+	}
+	if messages[len(messages)-1].Role != "assistant" {
+		t.Error("expected the latest turn last")
+	}
+
+	// The latest turn is sent even if it alone overflows the budget
+	if messages, _ := conv.Context(10, nil); len(messages) != 2 {
+		t.Errorf("expected the system prompt and the latest turn, got %d", len(messages))
+	}
+
+	// Truncating leaves the conversation alone
+	params := ControlParameters{MaxTokens: 200}
+	if _, err := conv.Prepare(context.Background(), 500, params, ContextTruncate, &cannedAnswer{}, nil); err != nil || conv.Summarized != 0 {
+		t.Errorf("expected truncation not to summarize: %v", err)
+	}
+
+	// Summarizing folds the dropped turns into the system prompt
+	model := &cannedAnswer{text: "Found RDP open on 10.0.0.5."}
+	messages, err := conv.Prepare(context.Background(), 500, params, ContextSummarize, model, nil)
+	if err != nil {
+		t.Fatalf("Prepare: %v", err)
+	}
+	if conv.Summarized != 16 || conv.Summary != model.text {
+		t.Errorf("expected 16 turns summarized, got %d: %q", conv.Summarized, conv.Summary)
+	}
+	if !strings.Contains(messages[0].Content, "Found RDP open") || len(messages) != 5 {
+		t.Errorf("expected the summary in the system prompt and 4 turns, got %d messages: %q", len(messages), messages[0].Content)
+	}
+	if !strings.Contains(model.messages[1].Content, "question") {
+		t.Error("expected the dropped turns in the summary request")
+	}
+
+	if _, err := conv.Prepare(context.Background(), 100, params, ContextTruncate, nil, nil); err == nil {
+		t.Error("expected max_tokens larger than the window to fail")
+	}
+}
+
+func TestConversationStore(t *testing.T) {
+	store := NewConversationStore(t.TempDir())
+	conv := NewConversation("acme", "Initial recon")
+	conv.AddUser("Which hosts run SMB?")
+	conv.AddReply(&GenerateResult{Text: "10.0.0.4 runs SMB on 445.", Model: "tiny", CompletionTokens: 9}, &ControlParameters{Temperature: 0.7})
+	if err := store.Save(conv); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	other := NewConversation("globex", "")
+	store.Save(other)
+
+	loaded, err := store.Load("acme", conv.ID)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if len(loaded.Messages) != 2 || loaded.Messages[1].Model != "tiny" || loaded.Messages[1].Params.Temperature != 0.7 {
+		t.Errorf("unexpected conversation %+v", loaded)
+	}
+	if _, err := store.Load("acme", "../globex/"+other.ID); err == nil {
+		t.Error("expected a path in the id to be rejected")
+	}
+
+	list, _ := store.List("acme")
+	if len(list) != 1 || list[0].Title != "Initial recon" || list[0].Messages != 2 {
+		t.Errorf("unexpected list %+v", list)
+	}
+	if engagements, _ := store.Engagements(); strings.Join(engagements, ",") != "acme,globex" {
+		t.Errorf("unexpected engagements %v", engagements)
+	}
+
+	path, err := store.Export(loaded, "md")
+	if err != nil {
+		t.Fatalf("Export: %v", err)
+	}
+	markdown, _ := os.ReadFile(path)
+	for _, want := range []string{"# Initial recon", "- Engagement: acme", "### You", "10.0.0.4 runs SMB", "tiny, temperature 0.70, 9 tokens"} {
+		if !strings.Contains(string(markdown), want) {
+			t.Errorf("Markdown export is missing %q:\n%s", want, markdown)
+		}
+	}
+	path, _ = store.Export(loaded, "json")
+	data, _ := os.ReadFile(path)
+	var exported Conversation
+	if err := json.Unmarshal(data, &exported); err != nil || exported.ID != conv.ID {
+		t.Errorf("JSON export: %v", err)
+	}
+	// Exports aren't listed as conversations
+	if list, _ := store.List("acme"); len(list) != 1 {
+		t.Errorf("expected exports not to be listed, got %+v", list)
+	}
+
+	if err := store.Delete("acme", conv.ID); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := store.Load("acme", conv.ID); err != ErrConversationNotFound {
+		t.Errorf("expected the conversation to be gone, got %v", err)
+	}
+}
@@ -0,0 +1,455 @@
+package ai
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strings"
+)
+
+// ggufMagic is "GGUF" read as a little-endian uint32.
+const ggufMagic = 0x46554747
+
+const (
+	// ggufDefaultAlignment applies when general.alignment is not set.
+	ggufDefaultAlignment = 32
+	// ggufMaxArrayValues is how many values of a metadata array are kept;
+	// longer arrays, like the tokenizer's vocabulary, keep only their length.
+	ggufMaxArrayValues = 1024
+	// ggufMaxStringLength guards against a corrupt length allocating gigabytes.
+	ggufMaxStringLength = 16 << 20
+)
+
+// GGUF metadata value types.
+const (
+	ggufTypeUint8 uint32 = iota
+	ggufTypeInt8
+	ggufTypeUint16
+	ggufTypeInt16
+	ggufTypeUint32
+	ggufTypeInt32
+	ggufTypeFloat32
+	ggufTypeBool
+	ggufTypeString
+	ggufTypeArray
+	ggufTypeUint64
+	ggufTypeInt64
+	ggufTypeFloat64
+)
+
+// GGUFArray is an array metadata value. Values is nil if the array was too
+// long to keep.
+type GGUFArray struct {
+	Type   uint32        `json:"type"`
+	Len    uint64        `json:"len"`
+	Values []interface{} `json:"values,omitempty"`
+}
+
+// GGUFTensor is an entry of a GGUF file's tensor table.
+type GGUFTensor struct {
+	Name       string   `json:"name"`
+	Dimensions []uint64 `json:"dimensions"`
+	Type       GGMLType `json:"type"`
+	Offset     uint64   `json:"offset"` // from the start of the tensor data
+}
+
+// Elements returns the number of values in the tensor.
+func (t GGUFTensor) Elements() uint64 {
+	n := uint64(1)
+	for _, d := range t.Dimensions {
+		n *= d
+	}
+	return n
+}
+
+// Size returns the tensor's size in bytes, or 0 if its type is unknown.
+func (t GGUFTensor) Size() uint64 {
+	layout, ok := ggmlTypeLayouts[t.Type]
+	if !ok {
+		return 0
+	}
+	return t.Elements() / layout.blockSize * layout.typeSize
+}
+
+// GGUFFile is the header, metadata and tensor table of a GGUF model file.
+type GGUFFile struct {
+	Version    uint32                 `json:"version"`
+	Metadata   map[string]interface{} `json:"metadata"`
+	Tensors    []GGUFTensor           `json:"tensors"`
+	DataOffset uint64                 `json:"data_offset"` // where the tensor data starts in the file
+}
+
+// ReadGGUF parses the header, metadata and tensor table of the GGUF file at
+// path, without reading the tensor data.
+func ReadGGUF(path string) (*GGUFFile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open model file: %w", err)
+	}
+	defer f.Close()
+	gguf, err := ParseGGUF(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return gguf, nil
+}
+
+// ParseGGUF parses a GGUF file from its first byte up to the tensor data.
+func ParseGGUF(r io.Reader) (*GGUFFile, error) {
+	d := &ggufDecoder{r: bufio.NewReaderSize(r, 64*1024)}
+
+	magic := d.uint32()
+	if d.err == nil && magic != ggufMagic {
+		if magic == 0x47475546 {
+			return nil, errors.New("big-endian GGUF files are not supported")
+		}
+		return nil, errors.New("not a GGUF file")
+	}
+	gguf := &GGUFFile{Version: d.uint32(), Metadata: make(map[string]interface{})}
+	if d.err != nil {
+		return nil, fmt.Errorf("failed to read header: %w", d.err)
+	}
+	if gguf.Version < 1 || gguf.Version > 3 {
+		return nil, fmt.Errorf("unsupported GGUF version %d", gguf.Version)
+	}
+	// Version 1 used 32-bit counts and lengths
+	d.v1 = gguf.Version == 1
+
+	tensorCount, kvCount := d.count(), d.count()
+	if d.err != nil {
+		return nil, fmt.Errorf("failed to read header: %w", d.err)
+	}
+
+	for i := uint64(0); i < kvCount; i++ {
+		key := d.string()
+		valueType := d.uint32()
+		value := d.value(valueType)
+		if d.err != nil {
+			return nil, fmt.Errorf("failed to read metadata entry %d (%q): %w", i, key, d.err)
+		}
+		gguf.Metadata[key] = value
+	}
+
+	for i := uint64(0); i < tensorCount; i++ {
+		t := GGUFTensor{Name: d.string()}
+		dims := d.uint32()
+		if dims > 8 {
+			return nil, fmt.Errorf("tensor %q has %d dimensions", t.Name, dims)
+		}
+		for j := uint32(0); j < dims; j++ {
+			t.Dimensions = append(t.Dimensions, d.count())
+		}
+		t.Type = GGMLType(d.uint32())
+		t.Offset = d.uint64()
+		if d.err != nil {
+			return nil, fmt.Errorf("failed to read tensor %d: %w", i, d.err)
+		}
+		gguf.Tensors = append(gguf.Tensors, t)
+	}
+
+	alignment := uint64(ggufDefaultAlignment)
+	if a, ok := gguf.UintValue("general.alignment"); ok && a > 0 {
+		alignment = a
+	}
+	gguf.DataOffset = (d.read + alignment - 1) / alignment * alignment
+	return gguf, nil
+}
+
+// ggufDecoder reads little-endian GGUF values, remembering the first error.
+type ggufDecoder struct {
+	r    *bufio.Reader
+	v1   bool
+	read uint64
+	err  error
+	buf  [8]byte
+}
+
+func (d *ggufDecoder) bytes(n int) []byte {
+	if d.err != nil {
+		return d.buf[:n]
+	}
+	_, d.err = io.ReadFull(d.r, d.buf[:n])
+	if errors.Is(d.err, io.EOF) {
+		d.err = io.ErrUnexpectedEOF
+	}
+	d.read += uint64(n)
+	return d.buf[:n]
+}
+
+func (d *ggufDecoder) uint8() uint8   { return d.bytes(1)[0] }
+func (d *ggufDecoder) uint16() uint16 { return binary.LittleEndian.Uint16(d.bytes(2)) }
+func (d *ggufDecoder) uint32() uint32 { return binary.LittleEndian.Uint32(d.bytes(4)) }
+func (d *ggufDecoder) uint64() uint64 { return binary.LittleEndian.Uint64(d.bytes(8)) }
+
+// count reads a count or length, which is 32-bit in version 1.
+func (d *ggufDecoder) count() uint64 {
+	if d.v1 {
+		return uint64(d.uint32())
+	}
+	return d.uint64()
+}
+
+func (d *ggufDecoder) string() string {
+	n := d.count()
+	if d.err != nil {
+		return ""
+	}
+	if n > ggufMaxStringLength {
+		d.err = fmt.Errorf("string length %d is too long", n)
+		return ""
+	}
+	b := make([]byte, n)
+	if _, d.err = io.ReadFull(d.r, b); errors.Is(d.err, io.EOF) {
+		d.err = io.ErrUnexpectedEOF
+	}
+	d.read += n
+	return string(b)
+}
+
+func (d *ggufDecoder) value(valueType uint32) interface{} {
+	switch valueType {
+	case ggufTypeUint8:
+		return d.uint8()
+	case ggufTypeInt8:
+		return int8(d.uint8())
+	case ggufTypeUint16:
+		return d.uint16()
+	case ggufTypeInt16:
+		return int16(d.uint16())
+	case ggufTypeUint32:
+		return d.uint32()
+	case ggufTypeInt32:
+		return int32(d.uint32())
+	case ggufTypeFloat32:
+		return math.Float32frombits(d.uint32())
+	case ggufTypeBool:
+		return d.uint8() != 0
+	case ggufTypeString:
+		return d.string()
+	case ggufTypeUint64:
+		return d.uint64()
+	case ggufTypeInt64:
+		return int64(d.uint64())
+	case ggufTypeFloat64:
+		return math.Float64frombits(d.uint64())
+	case ggufTypeArray:
+		arr := GGUFArray{Type: d.uint32(), Len: d.count()}
+		if arr.Type == ggufTypeArray {
+			d.err = errors.New("nested metadata arrays are not supported")
+		}
+		keep := arr.Len <= ggufMaxArrayValues
+		for i := uint64(0); i < arr.Len && d.err == nil; i++ {
+			v := d.value(arr.Type)
+			if keep {
+				arr.Values = append(arr.Values, v)
+			}
+		}
+		return arr
+	default:
+		if d.err == nil {
+			d.err = fmt.Errorf("unknown metadata value type %d", valueType)
+		}
+		return nil
+	}
+}
+
+// StringValue returns a metadata string value.
+func (g *GGUFFile) StringValue(key string) (string, bool) {
+	s, ok := g.Metadata[key].(string)
+	return s, ok
+}
+
+// UintValue returns a non-negative integer metadata value of any width.
+func (g *GGUFFile) UintValue(key string) (uint64, bool) {
+	switch v := g.Metadata[key].(type) {
+	case uint8:
+		return uint64(v), true
+	case uint16:
+		return uint64(v), true
+	case uint32:
+		return uint64(v), true
+	case uint64:
+		return v, true
+	case int8:
+		return uint64(v), v >= 0
+	case int16:
+		return uint64(v), v >= 0
+	case int32:
+		return uint64(v), v >= 0
+	case int64:
+		return uint64(v), v >= 0
+	}
+	return 0, false
+}
+
+// GGUFInfo is the summary of a GGUF model shown in the catalog and checked
+// before loading.
+type GGUFInfo struct {
+	Version         uint32 `json:"version"`
+	Architecture    string `json:"architecture"`
+	Name            string `json:"name,omitempty"`
+	ContextLength   uint64 `json:"context_length"`
+	EmbeddingLength uint64 `json:"embedding_length,omitempty"`
+	BlockCount      uint64 `json:"block_count,omitempty"`
+	HeadCount       uint64 `json:"head_count,omitempty"`
+	Quantization    string `json:"quantization"`
+	TokenizerModel  string `json:"tokenizer_model,omitempty"` // e.g. "llama" (SentencePiece) or "gpt2" (BPE)
+	VocabularySize  uint64 `json:"vocabulary_size,omitempty"`
+	ChatTemplate    bool   `json:"chat_template"`
+	TensorCount     int    `json:"tensor_count"`
+	ParameterCount  uint64 `json:"parameter_count"`
+	DataOffset      uint64 `json:"data_offset"`
+	DataSize        uint64 `json:"data_size"`               // bytes of tensor data the header describes
+	UnknownTypes    []int  `json:"unknown_types,omitempty"` // tensor types this reader doesn't know
+}
+
+// Info summarizes the file's metadata and tensor table.
+func (g *GGUFFile) Info() GGUFInfo {
+	info := GGUFInfo{Version: g.Version, TensorCount: len(g.Tensors), DataOffset: g.DataOffset}
+	info.Architecture, _ = g.StringValue("general.architecture")
+	info.Name, _ = g.StringValue("general.name")
+	arch := info.Architecture
+	info.ContextLength, _ = g.UintValue(arch + ".context_length")
+	info.EmbeddingLength, _ = g.UintValue(arch + ".embedding_length")
+	info.BlockCount, _ = g.UintValue(arch + ".block_count")
+	info.HeadCount, _ = g.UintValue(arch + ".attention.head_count")
+	info.TokenizerModel, _ = g.StringValue("tokenizer.ggml.model")
+	if tokens, ok := g.Metadata["tokenizer.ggml.tokens"].(GGUFArray); ok {
+		info.VocabularySize = tokens.Len
+	}
+	_, info.ChatTemplate = g.StringValue("tokenizer.chat_template")
+
+	// Tensor data ends at the end of the tensor furthest into it
+	typeCounts := make(map[GGMLType]uint64)
+	unknown := make(map[int]bool)
+	for _, t := range g.Tensors {
+		info.ParameterCount += t.Elements()
+		if _, ok := ggmlTypeLayouts[t.Type]; !ok {
+			unknown[int(t.Type)] = true
+			continue
+		}
+		typeCounts[t.Type] += t.Elements()
+		if end := t.Offset + t.Size(); end > info.DataSize {
+			info.DataSize = end
+		}
+	}
+	for t := range unknown {
+		info.UnknownTypes = append(info.UnknownTypes, t)
+	}
+	sort.Ints(info.UnknownTypes)
+
+	if ft, ok := g.UintValue("general.file_type"); ok {
+		if name, known := llamaFileTypes[ft]; known {
+			info.Quantization = name
+		}
+	}
+	if info.Quantization == "" {
+		// Name it after the type holding most of the weights
+		var most GGMLType
+		var mostCount uint64
+		for t, n := range typeCounts {
+			if n > mostCount || (n == mostCount && t < most) {
+				most, mostCount = t, n
+			}
+		}
+		if mostCount > 0 {
+			info.Quantization = most.String()
+		}
+	}
+	return info
+}
+
+// Summary describes the model in one line, e.g. "llama 8.0B Q4_K_M, 8192 context, gpt2 tokenizer".
+func (info GGUFInfo) Summary() string {
+	parts := []string{info.Architecture}
+	if info.ParameterCount > 0 {
+		parts[0] += " " + formatParameterCount(info.ParameterCount)
+	}
+	if info.Quantization != "" {
+		parts[0] += " " + info.Quantization
+	}
+	if info.ContextLength > 0 {
+		parts = append(parts, fmt.Sprintf("%d context", info.ContextLength))
+	}
+	if info.TokenizerModel != "" {
+		parts = append(parts, info.TokenizerModel+" tokenizer")
+	}
+	return strings.Join(parts, ", ")
+}
+
+func formatParameterCount(n uint64) string {
+	switch {
+	case n >= 1e9:
+		return fmt.Sprintf("%.1fB", float64(n)/1e9)
+	case n >= 1e6:
+		return fmt.Sprintf("%.0fM", float64(n)/1e6)
+	default:
+		return fmt.Sprintf("%d", n)
+	}
+}
+
+// GGMLType is the element type of a tensor.
+type GGMLType uint32
+
+// ggmlLayout is how many values a block of a type holds, and its size in bytes.
+type ggmlLayout struct {
+	name      string
+	blockSize uint64
+	typeSize  uint64
+}
+
+// ggmlTypeLayouts lists the tensor types of ggml, by their ids in the file.
+var ggmlTypeLayouts = map[GGMLType]ggmlLayout{
+	0:  {"F32", 1, 4},
+	1:  {"F16", 1, 2},
+	2:  {"Q4_0", 32, 18},
+	3:  {"Q4_1", 32, 20},
+	6:  {"Q5_0", 32, 22},
+	7:  {"Q5_1", 32, 24},
+	8:  {"Q8_0", 32, 34},
+	9:  {"Q8_1", 32, 36},
+	10: {"Q2_K", 256, 84},
+	11: {"Q3_K", 256, 110},
+	12: {"Q4_K", 256, 144},
+	13: {"Q5_K", 256, 176},
+	14: {"Q6_K", 256, 210},
+	15: {"Q8_K", 256, 292},
+	16: {"IQ2_XXS", 256, 66},
+	17: {"IQ2_XS", 256, 74},
+	18: {"IQ3_XXS", 256, 98},
+	19: {"IQ1_S", 256, 50},
+	20: {"IQ4_NL", 32, 18},
+	21: {"IQ3_S", 256, 110},
+	22: {"IQ2_S", 256, 82},
+	23: {"IQ4_XS", 256, 136},
+	24: {"I8", 1, 1},
+	25: {"I16", 1, 2},
+	26: {"I32", 1, 4},
+	27: {"I64", 1, 8},
+	28: {"F64", 1, 8},
+	29: {"IQ1_M", 256, 56},
+	30: {"BF16", 1, 2},
+	34: {"TQ1_0", 256, 54},
+	35: {"TQ2_0", 256, 66},
+}
+
+func (t GGMLType) String() string {
+	if layout, ok := ggmlTypeLayouts[t]; ok {
+		return layout.name
+	}
+	return fmt.Sprintf("type %d", uint32(t))
+}
+
+// llamaFileTypes names the values of general.file_type, llama.cpp's quantization presets.
+var llamaFileTypes = map[uint64]string{
+	0: "F32", 1: "F16", 2: "Q4_0", 3: "Q4_1", 7: "Q8_0", 8: "Q5_0", 9: "Q5_1",
+	10: "Q2_K", 11: "Q3_K_S", 12: "Q3_K_M", 13: "Q3_K_L", 14: "Q4_K_S", 15: "Q4_K_M",
+	16: "Q5_K_S", 17: "Q5_K_M", 18: "Q6_K", 19: "IQ2_XXS", 20: "IQ2_XS", 21: "Q2_K_S",
+	22: "IQ3_XS", 23: "IQ3_XXS", 24: "IQ1_S", 25: "IQ4_NL", 26: "IQ3_S", 27: "IQ3_M",
+	28: "IQ2_S", 29: "IQ2_M", 30: "IQ4_XS", 31: "IQ1_M", 32: "BF16", 36: "TQ1_0", 37: "TQ2_0",
+}
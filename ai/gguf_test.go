@@ -0,0 +1,233 @@
+package ai
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// ggufWriter builds a small GGUF file: the header, metadata and tensor table
+// as llama.cpp writes them, followed by zeroed tensor data.
+type ggufWriter struct {
+	buf bytes.Buffer
+	v1  bool
+}
+
+func (w *ggufWriter) put(v interface{}) { binary.Write(&w.buf, binary.LittleEndian, v) }
+
+func (w *ggufWriter) count(n int) {
+	if w.v1 {
+		w.put(uint32(n))
+	} else {
+		w.put(uint64(n))
+	}
+}
+
+func (w *ggufWriter) str(s string) {
+	w.count(len(s))
+	w.buf.WriteString(s)
+}
+
+type ggufTestKV struct {
+	key   string
+	value interface{} // string, uint32, []string
+}
+
+type ggufTestTensor struct {
+	name string
+	dims []uint64
+	typ  GGMLType
+}
+
+func testGGUF(version uint32, kvs []ggufTestKV, tensors []ggufTestTensor) []byte {
+	w := &ggufWriter{v1: version == 1}
+	w.put(uint32(ggufMagic))
+	w.put(version)
+	w.count(len(tensors))
+	w.count(len(kvs))
+	for _, kv := range kvs {
+		w.str(kv.key)
+		switch v := kv.value.(type) {
+		case string:
+			w.put(ggufTypeString)
+			w.str(v)
+		case uint32:
+			w.put(ggufTypeUint32)
+			w.put(v)
+		case []string:
+			w.put(ggufTypeArray)
+			w.put(ggufTypeString)
+			w.count(len(v))
+			for _, s := range v {
+				w.str(s)
+			}
+		}
+	}
+
+	var offset uint64
+	for _, t := range tensors {
+		w.str(t.name)
+		w.put(uint32(len(t.dims)))
+		for _, d := range t.dims {
+			w.count(int(d))
+		}
+		w.put(uint32(t.typ))
+		w.put(offset)
+		size := GGUFTensor{Dimensions: t.dims, Type: t.typ}.Size()
+		offset += (size + ggufDefaultAlignment - 1) / ggufDefaultAlignment * ggufDefaultAlignment
+	}
+	for w.buf.Len()%ggufDefaultAlignment != 0 {
+		w.buf.WriteByte(0)
+	}
+	w.buf.Write(make([]byte, offset))
+	return w.buf.Bytes()
+}
+
+func testLlamaGGUF(version uint32) []byte {
+	vocab := make([]string, 2000)
+	for i := range vocab {
+		vocab[i] = "tok"
+	}
+	return testGGUF(version, []ggufTestKV{
+		{"general.architecture", "llama"},
+		{"general.name", "tiny-llama"},
+		{"general.file_type", uint32(15)},
+		{"llama.context_length", uint32(4096)},
+		{"llama.embedding_length", uint32(256)},
+		{"llama.block_count", uint32(2)},
+		{"tokenizer.ggml.model", "llama"},
+		{"tokenizer.ggml.tokens", vocab},
+	}, []ggufTestTensor{
+		{"token_embd.weight", []uint64{256, 2000}, 12},
+		{"output_norm.weight", []uint64{256}, 0},
+	})
+}
+
+func TestParseGGUF(t *testing.T) {
+	for _, version := range []uint32{1, 3} {
+		data := testLlamaGGUF(version)
+		gguf, err := ParseGGUF(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("v%d: ParseGGUF: %v", version, err)
+		}
+		if len(gguf.Tensors) != 2 || gguf.Tensors[0].Name != "token_embd.weight" || gguf.Tensors[0].Type.String() != "Q4_K" {
+			t.Fatalf("v%d: unexpected tensors %+v", version, gguf.Tensors)
+		}
+		if gguf.DataOffset%ggufDefaultAlignment != 0 {
+			t.Errorf("v%d: data offset %d is not aligned", version, gguf.DataOffset)
+		}
+		// The vocabulary is longer than the arrays kept in full
+		if tokens := gguf.Metadata["tokenizer.ggml.tokens"].(GGUFArray); tokens.Len != 2000 || tokens.Values != nil {
+			t.Errorf("v%d: expected only the vocabulary's length, got %d values", version, len(tokens.Values))
+		}
+
+		info := gguf.Info()
+		if info.ContextLength != 4096 || info.Quantization != "Q4_K_M" || info.VocabularySize != 2000 || info.ParameterCount != 256*2000+256 {
+			t.Errorf("v%d: unexpected info %+v", version, info)
+		}
+		if info.DataOffset+info.DataSize > uint64(len(data)) {
+			t.Errorf("v%d: tensor data runs past the end of the file", version)
+		}
+		if got, want := info.Summary(), "llama 512256 Q4_K_M, 4096 context, llama tokenizer"; version == 3 && got != want {
+			t.Errorf("Summary() = %q, want %q", got, want)
+		}
+	}
+
+	if _, err := ParseGGUF(strings.NewReader("GGML not a gguf file")); err == nil {
+		t.Error("expected an error for a non-GGUF file")
+	}
+	if _, err := ParseGGUF(bytes.NewReader(testLlamaGGUF(3)[:100])); err == nil {
+		t.Error("expected an error for a header cut short")
+	}
+}
+
+func TestCheckGGUFCompatibility(t *testing.T) {
+	dir := t.TempDir()
+	params := ControlParameters{Temperature: 0.7, MaxTokens: 512, TopP: 0.9, TopK: 40}
+
+	good := filepath.Join(dir, "good.gguf")
+	data := testLlamaGGUF(3)
+	os.WriteFile(good, data, 0600)
+	if info, err := ValidateModelFile(good, params); err != nil || info.Architecture != "llama" {
+		t.Fatalf("ValidateModelFile(good) = %+v, %v", info, err)
+	}
+
+	// An interrupted download has the whole header but not all the tensor data
+	truncated := filepath.Join(dir, "truncated.gguf")
+	os.WriteFile(truncated, data[:len(data)-64], 0600)
+	if _, err := ValidateModelFile(truncated, params); err == nil || !strings.Contains(err.Error(), "truncated") {
+		t.Errorf("expected a truncated file error, got %v", err)
+	}
+
+	params.MaxTokens = 8192
+	if _, err := ValidateModelFile(good, params); err == nil || !strings.Contains(err.Error(), "context length") {
+		t.Errorf("expected a context length error, got %v", err)
+	}
+
+	old := filepath.Join(dir, "old.gguf")
+	os.WriteFile(old, testLlamaGGUF(1), 0600)
+	params.MaxTokens = 512
+	if _, err := ValidateModelFile(old, params); err == nil || !strings.Contains(err.Error(), "version 1") {
+		t.Errorf("expected a version error, got %v", err)
+	}
+
+	unknown := filepath.Join(dir, "unknown.gguf")
+	os.WriteFile(unknown, testGGUF(3, []ggufTestKV{{"general.architecture", "llama"}}, []ggufTestTensor{{"w", []uint64{32}, 99}}), 0600)
+	if _, err := ValidateModelFile(unknown, params); err == nil || !strings.Contains(err.Error(), "unsupported tensor types [99]") {
+		t.Errorf("expected an unknown type error, got %v", err)
+	}
+
+	// Other formats aren't checked
+	if info, err := ValidateModelFile(filepath.Join(dir, "model.bin"), params); info != nil || err != nil {
+		t.Errorf("expected no check of a .bin file, got %+v, %v", info, err)
+	}
+}
+
+func TestModelCatalog(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "models", "chat"), 0700)
+	os.WriteFile(filepath.Join(dir, "models", "chat", "tiny.gguf"), testLlamaGGUF(3), 0600)
+	os.WriteFile(filepath.Join(dir, "models", "broken.gguf"), []byte("GGUF"), 0600)
+	os.WriteFile(filepath.Join(dir, "models", "README.md"), []byte("models"), 0600)
+	params := ControlParameters{MaxTokens: 512}
+
+	cachePath := filepath.Join(dir, "cache", "model_catalog.json")
+	catalog := NewModelCatalog(filepath.Join(dir, "models"), cachePath)
+	entries, err := catalog.Refresh(params)
+	if err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 models, got %+v", entries)
+	}
+	broken, tiny := entries[0], entries[1]
+	if broken.Error == "" || broken.Info != nil {
+		t.Errorf("expected the broken model to have an error, got %+v", broken)
+	}
+	if tiny.Error != "" || tiny.Info == nil || tiny.Info.Name != "tiny-llama" || len(tiny.SHA256) != 64 {
+		t.Fatalf("unexpected entry %+v", tiny)
+	}
+
+	entry, err := catalog.Lookup(strings.ToUpper(tiny.SHA256[:12]))
+	if err != nil || entry.Path != tiny.Path {
+		t.Errorf("Lookup by prefix = %+v, %v", entry, err)
+	}
+	if _, err := catalog.Lookup(tiny.SHA256[:4]); err == nil {
+		t.Error("expected a short prefix to be rejected")
+	}
+
+	// A new catalog reads hashes from the cache rather than the files
+	cached := NewModelCatalog(filepath.Join(dir, "models"), cachePath)
+	cached.loadCacheLocked()
+	if e := cached.entries[tiny.Path]; e == nil || e.SHA256 != tiny.SHA256 {
+		t.Errorf("expected the hash in the cache, got %+v", e)
+	}
+
+	os.Remove(tiny.Path)
+	if entries, _ := cached.Refresh(params); len(entries) != 1 {
+		t.Errorf("expected the removed model to be dropped, got %+v", entries)
+	}
+}
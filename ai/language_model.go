@@ -1,16 +1,18 @@
 package ai
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"sync"
 	"time"
 )
 
-// LanguageModel simulates an underlying AI model object, storing its path, hyperparameters,
+// LanguageModel wraps an InferenceBackend, storing its path, hyperparameters,
 // and states like "is loading/loaded".
 type LanguageModel struct {
 	path              string
+	backend           InferenceBackend
 	loaded            bool
 	loading           bool
 	temperature       float64
@@ -26,14 +28,24 @@ type LanguageModel struct {
 	mu sync.Mutex
 }
 
-// NewLanguageModel constructs a new instance with a path and default hyperparameters.
+// NewLanguageModel constructs a new instance with a path and default hyperparameters,
+// backed by the simulated backend.
 // In a real system, you might parse these from an AI config file (ai.yaml).
 func NewLanguageModel(path string) (*LanguageModel, error) {
+	return NewLanguageModelWithBackend(path, newSimulatedBackend(path))
+}
+
+// NewLanguageModelWithBackend constructs a new instance that generates with backend.
+func NewLanguageModelWithBackend(path string, backend InferenceBackend) (*LanguageModel, error) {
 	if path == "" {
 		return nil, errors.New("model path cannot be empty")
 	}
+	if backend == nil {
+		return nil, errors.New("inference backend cannot be nil")
+	}
 	lm := &LanguageModel{
 		path:              path,
+		backend:           backend,
 		loaded:            false,
 		loading:           false,
 		temperature:       0.7,
@@ -48,33 +60,39 @@ func NewLanguageModel(path string) (*LanguageModel, error) {
 	return lm, nil
 }
 
-// LoadModel simulates model initialization by reading weights, allocating memory, etc.
-// For real usage, you'd integrate your LLM logic or calls to library methods here.
+// LoadModel initializes the model through its backend, which may read weights
+// or just check that the server hosting the model is reachable.
 func (lm *LanguageModel) LoadModel() error {
 	lm.mu.Lock()
-	defer lm.mu.Unlock()
-
 	if lm.loading {
+		lm.mu.Unlock()
 		return errors.New("model is already in the process of loading")
 	}
 	if lm.loaded {
+		lm.mu.Unlock()
 		return errors.New("model is already loaded")
 	}
-
 	lm.loading = true
-	// Simulate loading time
-	time.Sleep(500 * time.Millisecond)
+	lm.mu.Unlock()
+
+	err := lm.backend.Load(context.Background())
+
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+	lm.loading = false
+	if err != nil {
+		return err
+	}
 
 	// Set additional metadata after loading
-	lm.modelInfo = fmt.Sprintf("Model loaded from path: %s", lm.path)
+	lm.modelInfo = fmt.Sprintf("Model loaded from path: %s (backend: %s)", lm.path, lm.backend.Name())
 
 	// Mark loaded
-	lm.loading = false
 	lm.loaded = true
 	return nil
 }
 
-// UnloadModel simulates freeing model resources.
+// UnloadModel frees the backend's resources.
 func (lm *LanguageModel) UnloadModel() error {
 	lm.mu.Lock()
 	defer lm.mu.Unlock()
@@ -82,7 +100,9 @@ func (lm *LanguageModel) UnloadModel() error {
 	if !lm.loaded {
 		return errors.New("model is not loaded, cannot unload")
 	}
-	// In real usage, you'd free GPU memory, close files, etc.
+	if err := lm.backend.Unload(); err != nil {
+		return fmt.Errorf("failed to unload backend: %w", err)
+	}
 	lm.loaded = false
 	lm.modelInfo = "Model unloaded"
 	return nil
@@ -95,23 +115,79 @@ func (lm *LanguageModel) IsLoaded() bool {
 	return lm.loaded
 }
 
-// RunInference simulates generating a response from the model given a prompt.
-// Real usage would call into your LLM library or bridging code.
+// Backend returns the backend the model generates with.
+func (lm *LanguageModel) Backend() InferenceBackend {
+	return lm.backend
+}
+
+// RunInference generates a response to a single prompt using the model's own
+// hyperparameters.
 func (lm *LanguageModel) RunInference(prompt string) (string, error) {
-	lm.mu.Lock()
-	defer lm.mu.Unlock()
+	res, err := lm.Generate(context.Background(), []ChatMessage{{Role: "user", Content: prompt}}, lm.ControlParameters())
+	if err != nil {
+		return "", err
+	}
+	return res.Text, nil
+}
 
-	if !lm.loaded {
-		return "", errors.New("model is not loaded, cannot run inference")
+// Generate returns the complete reply to messages, sampled with params.
+func (lm *LanguageModel) Generate(ctx context.Context, messages []ChatMessage, params ControlParameters) (*GenerateResult, error) {
+	if !lm.IsLoaded() {
+		return nil, errors.New("model is not loaded, cannot run inference")
+	}
+	return lm.backend.Generate(ctx, messages, params)
+}
+
+// GenerateWithTools is Generate, offering the model tools to call. Backends
+// without native tool calling generate as usual, and any calls are left in the text.
+func (lm *LanguageModel) GenerateWithTools(ctx context.Context, messages []ChatMessage, tools []Tool, params ControlParameters) (*GenerateResult, error) {
+	if !lm.IsLoaded() {
+		return nil, errors.New("model is not loaded, cannot run inference")
 	}
+	if tb, ok := lm.backend.(ToolCallingBackend); ok {
+		return tb.GenerateWithTools(ctx, messages, tools, params)
+	}
+	return lm.backend.Generate(ctx, messages, params)
+}
 
-	// In a real system, you'd feed 'prompt' into the model, specifying temperature, etc.
-	response := fmt.Sprintf("Simulated response to prompt: \"%s\"\n(temperature=%.2f, max_tokens=%d, top_p=%.2f, top_k=%d)",
-		prompt, lm.temperature, lm.maxTokens, lm.topP, lm.topK)
+// Stream is Generate, calling onToken with each piece of the reply as it is produced.
+func (lm *LanguageModel) Stream(ctx context.Context, messages []ChatMessage, params ControlParameters, onToken func(string) error) (*GenerateResult, error) {
+	if !lm.IsLoaded() {
+		return nil, errors.New("model is not loaded, cannot run inference")
+	}
+	return lm.backend.Stream(ctx, messages, params, onToken)
+}
 
-	// Sleep to mimic some compute time
-	time.Sleep(300 * time.Millisecond)
-	return response, nil
+// Tokenize returns the model's token ids for text.
+func (lm *LanguageModel) Tokenize(ctx context.Context, text string) ([]int, error) {
+	if !lm.IsLoaded() {
+		return nil, errors.New("model is not loaded, cannot tokenize")
+	}
+	return lm.backend.Tokenize(ctx, text)
+}
+
+// Embed returns the model's embedding of each text, or ErrEmbeddingsUnsupported.
+func (lm *LanguageModel) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	if !lm.IsLoaded() {
+		return nil, errors.New("model is not loaded, cannot embed")
+	}
+	eb, ok := lm.backend.(EmbeddingBackend)
+	if !ok {
+		return nil, ErrEmbeddingsUnsupported
+	}
+	return eb.Embed(ctx, texts)
+}
+
+// ControlParameters returns the model's current sampling hyperparameters.
+func (lm *LanguageModel) ControlParameters() ControlParameters {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+	return ControlParameters{
+		Temperature: lm.temperature,
+		MaxTokens:   lm.maxTokens,
+		TopP:        lm.topP,
+		TopK:        lm.topK,
+	}
 }
 
 // SetParameters updates the model hyperparameters (e.g., temperature, max tokens, etc.).
@@ -0,0 +1,107 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrQueueFull is returned when a request arrives with every slot busy and the queue full.
+var ErrQueueFull = errors.New("too many inference requests queued")
+
+// RequestLimiter bounds how many generations run at once, queueing the rest
+// in arrival order up to a limit.
+type RequestLimiter struct {
+	slots     chan struct{}
+	maxQueued int
+
+	mu      sync.Mutex
+	queued  int
+	running int
+}
+
+// NewRequestLimiter allows maxConcurrent generations at once and maxQueued waiting.
+func NewRequestLimiter(maxConcurrent, maxQueued int) *RequestLimiter {
+	if maxConcurrent <= 0 {
+		maxConcurrent = 1
+	}
+	if maxQueued < 0 {
+		maxQueued = 0
+	}
+	return &RequestLimiter{
+		slots:     make(chan struct{}, maxConcurrent),
+		maxQueued: maxQueued,
+	}
+}
+
+// Ticket is a place in the limiter's queue.
+type Ticket struct {
+	limiter *RequestLimiter
+	once    sync.Once
+}
+
+// Enqueue takes a place in the queue, or returns ErrQueueFull. The ticket
+// must be passed to Wait, or to Cancel if the request is abandoned first.
+func (l *RequestLimiter) Enqueue() (*Ticket, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.running+l.queued >= cap(l.slots)+l.maxQueued {
+		return nil, ErrQueueFull
+	}
+	l.queued++
+	return &Ticket{limiter: l}, nil
+}
+
+// Wait blocks until a slot is free or ctx is done. On success, release must
+// be called when the generation finishes.
+func (t *Ticket) Wait(ctx context.Context) (release func(), err error) {
+	l := t.limiter
+	select {
+	case l.slots <- struct{}{}:
+	case <-ctx.Done():
+		t.Cancel()
+		return nil, ctx.Err()
+	}
+
+	t.once.Do(func() {
+		l.mu.Lock()
+		l.queued--
+		l.running++
+		l.mu.Unlock()
+	})
+
+	var releaseOnce sync.Once
+	return func() {
+		releaseOnce.Do(func() {
+			l.mu.Lock()
+			l.running--
+			l.mu.Unlock()
+			<-l.slots
+		})
+	}, nil
+}
+
+// Cancel gives up the ticket's place in the queue. It does nothing once Wait has succeeded.
+func (t *Ticket) Cancel() {
+	t.once.Do(func() {
+		t.limiter.mu.Lock()
+		t.limiter.queued--
+		t.limiter.mu.Unlock()
+	})
+}
+
+// Acquire is Enqueue then Wait.
+func (l *RequestLimiter) Acquire(ctx context.Context) (release func(), err error) {
+	ticket, err := l.Enqueue()
+	if err != nil {
+		return nil, err
+	}
+	return ticket.Wait(ctx)
+}
+
+// Stats returns how many generations are running and how many are waiting.
+func (l *RequestLimiter) Stats() (running, queued int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.running, l.queued
+}
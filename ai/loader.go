@@ -1,25 +1,30 @@
 package ai
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 
-	"oqs"
-
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 )
 
 // ModelLoader manages the loading/unloading of AI models and configuration with post-quantum security.
 type ModelLoader struct {
-	config       *Config
-	model        *LanguageModel
-	secureMemory []byte
-	mutex        sync.Mutex
-	logger       *zap.Logger
+	config    *Config
+	model     *LanguageModel
+	modelData []byte // decrypted model, wiped on unload
+	mutex     sync.Mutex
+	logger    *zap.Logger
+	metrics   InferenceRecorder
+	catalog   *ModelCatalog
+	trust     *TrustStore
 }
 
 // NewModelLoader initializes a new ModelLoader instance with a separate dynamic logger.
@@ -48,9 +53,18 @@ func NewModelLoader(config *Config) (*ModelLoader, error) {
 		return nil, err
 	}
 
+	trust := NewTrustStore()
+	if config.Integrity.TrustStore != "" {
+		if trust, err = LoadTrustStore(config.Integrity.TrustStore); err != nil {
+			return nil, err
+		}
+	}
+
 	return &ModelLoader{
-		config: config,
-		logger: logger,
+		config:  config,
+		logger:  logger,
+		catalog: newModelCatalog(config),
+		trust:   trust,
 	}, nil
 }
 
@@ -58,15 +72,23 @@ func NewModelLoader(config *Config) (*ModelLoader, error) {
 func ensureConfigFileExists(config *Config, path string, slog *zap.SugaredLogger) error {
 	if _, err := os.Stat(path); os.IsNotExist(err) {
 		slog.Infof("Creating default config file at %s", path)
-		if err := SaveConfig(config, path); err != nil {
+		if err := SaveConfig(config, path, slog.Desugar()); err != nil {
 			return fmt.Errorf("failed to create default config file: %w", err)
 		}
 	}
 	return nil
 }
 
-// LoadModel loads the AI model based on config.ModelPath and allocates secure memory.
+// LoadModel loads the AI model based on config.ModelPath. The model's
+// manifest is checked under the integrity policy, and an encrypted model is
+// decrypted into memory that is wiped when it is unloaded.
 func (loader *ModelLoader) LoadModel() error {
+	return loader.loadModel(false)
+}
+
+// loadModel loads the configured model; verified skips the manifest check
+// when the caller has just done it.
+func (loader *ModelLoader) loadModel(verified bool) error {
 	loader.mutex.Lock()
 	defer loader.mutex.Unlock()
 
@@ -74,33 +96,107 @@ func (loader *ModelLoader) LoadModel() error {
 		return errors.New("a model is already loaded")
 	}
 
-	loader.logger.Info("Loading model", zap.String("modelPath", loader.config.ModelPath))
-	if err := checkModelFileExists(loader.config.ModelPath); err != nil {
-		return err
+	loader.logger.Info("Loading model", zap.String("modelPath", loader.modelName()), zap.String("backend", loader.config.Backend.Type))
+	var modelData []byte
+	if !loader.config.Backend.Remote() {
+		path := loader.config.ModelPath
+		if err := checkModelFileExists(path); err != nil {
+			return err
+		}
+		if !verified {
+			if err := loader.verifyModel(path, loader.config.Integrity.Policy); err != nil {
+				return err
+			}
+		}
+		encrypted, err := IsEncryptedModel(path)
+		if err != nil {
+			return err
+		}
+		if encrypted {
+			if modelData, err = loader.decryptModel(path, loader.config.ControlParams); err != nil {
+				return err
+			}
+		}
 	}
 
-	// Allocate secure memory for the model
-	secureMemory, err := oqs.AllocateSecureMemory(1024 * 1024) // Allocate 1MB secure memory
-	if err != nil {
-		return fmt.Errorf("failed to allocate secure memory: %w", err)
+	// A decrypted model is kept to be wiped when it is unloaded
+	loader.modelData = modelData
+	fail := func(err error) error {
+		zeroizeMemory(loader.modelData)
+		loader.modelData = nil
+		return err
 	}
-	loader.secureMemory = secureMemory
 
 	// Load the model
-	lm, err := NewLanguageModel(loader.config.ModelPath)
+	backend, err := NewBackend(loader.config)
+	if err != nil {
+		return fail(fmt.Errorf("failed to create inference backend: %w", err))
+	}
+	if modelData != nil {
+		mb, ok := backend.(ModelDataBackend)
+		if !ok {
+			return fail(fmt.Errorf("the %s backend can't load encrypted models", backend.Name()))
+		}
+		mb.SetModelData(modelData)
+	}
+	lm, err := NewLanguageModelWithBackend(loader.modelName(), backend)
 	if err != nil {
-		return fmt.Errorf("failed to create LanguageModel: %w", err)
+		return fail(fmt.Errorf("failed to create LanguageModel: %w", err))
 	}
 
 	if err := lm.LoadModel(); err != nil {
-		return fmt.Errorf("failed to initialize model: %w", err)
+		return fail(fmt.Errorf("failed to initialize model: %w", err))
 	}
 
 	loader.model = lm
-	loader.logger.Info("Model loaded successfully with secure memory", zap.String("modelPath", loader.config.ModelPath))
+	loader.logger.Info("Model loaded successfully", zap.String("modelPath", loader.modelName()))
 	return nil
 }
 
+// verifyModel checks the model's manifest and applies policy to the result.
+func (loader *ModelLoader) verifyModel(path, policy string) error {
+	if policy == IntegrityOff {
+		return nil
+	}
+	manifest, err := VerifyModel(path, loader.trust)
+	if err == nil {
+		loader.logger.Info("Verified model manifest", zap.String("modelPath", path), zap.String("signer", manifest.Signer), zap.String("sha256", manifest.SHA256))
+		return nil
+	}
+	if policy == IntegrityDeny {
+		return fmt.Errorf("refusing to load %s: %w", path, err)
+	}
+	loader.logger.Warn("Loading model that failed verification", zap.String("modelPath", path), zap.Error(err))
+	return nil
+}
+
+// decryptModel decrypts an encrypted model with a key held in secure memory
+// and checks the GGUF inside it.
+func (loader *ModelLoader) decryptModel(path string, params ControlParameters) ([]byte, error) {
+	key, err := ModelKeyFromEnv(loader.config.Integrity.KeyEnv)
+	if err != nil {
+		return nil, err
+	}
+	defer zeroizeMemory(key)
+	data, err := DecryptModel(path, key)
+	if err != nil {
+		return nil, err
+	}
+
+	if bytes.HasPrefix(data, []byte("GGUF")) {
+		gguf, err := ParseGGUF(bytes.NewReader(data))
+		if err == nil {
+			err = CheckGGUFCompatibility(gguf.Info(), int64(len(data)), params)
+		}
+		if err != nil {
+			zeroizeMemory(data)
+			return nil, fmt.Errorf("model %s is not compatible: %w", path, err)
+		}
+	}
+	loader.logger.Info("Decrypted model", zap.String("modelPath", path), zap.Int("bytes", len(data)))
+	return data, nil
+}
+
 // UnloadModel frees resources from the currently loaded model and zeroizes memory.
 func (loader *ModelLoader) UnloadModel() error {
 	loader.mutex.Lock()
@@ -112,15 +208,18 @@ func (loader *ModelLoader) UnloadModel() error {
 
 	loader.logger.Info("Unloading model and zeroizing memory...")
 
-	// Zeroize secure memory
-	if loader.secureMemory != nil {
-		if err := oqs.ZeroizeMemory(loader.secureMemory); err != nil {
-			return fmt.Errorf("failed to zeroize secure memory: %w", err)
+	// Zeroize the decrypted model
+	if loader.modelData != nil {
+		if err := zeroizeMemory(loader.modelData); err != nil {
+			return fmt.Errorf("failed to zeroize model memory: %w", err)
 		}
-		loader.secureMemory = nil
+		loader.modelData = nil
 	}
 
 	// Unload model
+	if err := loader.model.UnloadModel(); err != nil {
+		loader.logger.Warn("Failed to unload model backend", zap.Error(err))
+	}
 	loader.model = nil
 	loader.logger.Info("Model unloaded securely")
 	return nil
@@ -145,37 +244,111 @@ func (loader *ModelLoader) ReloadModel() error {
 	return loader.LoadModel()
 }
 
-// LoadSelectedModel updates config.ModelPath, saves, and loads the new model.
+// LoadSelectedModel checks the new model is trusted and compatible, updates
+// config.ModelPath, saves, and loads the new model.
 func (loader *ModelLoader) LoadSelectedModel(newPath string) error {
 	loader.mutex.Lock()
-	defer loader.mutex.Unlock()
+	remote := loader.config.Backend.Remote()
+	params := loader.config.ControlParams
+	policy := loader.config.Integrity.Policy
+	loaded := loader.model != nil
+	loader.mutex.Unlock()
+
+	// Check the file before unloading the current model, so a bad choice
+	// leaves the old one running
+	if !remote {
+		if err := checkModelFileExists(newPath); err != nil {
+			return err
+		}
+		if err := loader.verifyModel(newPath, policy); err != nil {
+			return err
+		}
+		info, err := ValidateModelFile(newPath, params)
+		if err != nil {
+			return err
+		}
+		if info != nil {
+			loader.logger.Info("Validated model", zap.String("modelPath", newPath), zap.String("model", info.Summary()))
+		}
+	}
 
 	// Unload if there's a currently loaded model
-	if loader.model != nil {
+	if loaded {
 		if err := loader.UnloadModel(); err != nil {
 			return err
 		}
 	}
 
-	loader.config.ModelPath = newPath
+	loader.mutex.Lock()
+	// Remote backends select a model by name rather than by file
+	if remote {
+		loader.config.Backend.Model = newPath
+	} else {
+		loader.config.ModelPath = newPath
+	}
 	cfgPath := GetDefaultConfigPath()
-	if err := SaveConfig(loader.config, cfgPath); err != nil {
+	err := SaveConfig(loader.config, cfgPath, loader.logger)
+	loader.mutex.Unlock()
+	if err != nil {
 		return fmt.Errorf("failed to save updated config file: %w", err)
 	}
 
 	loader.logger.Info("Updated config with new model path", zap.String("modelPath", newPath))
 	// Now load the newly selected model
-	return loader.LoadModel()
+	return loader.loadModel(!remote)
+}
+
+// TrustStore returns the signers whose models are trusted.
+func (loader *ModelLoader) TrustStore() *TrustStore {
+	return loader.trust
+}
+
+// Catalog rescans the models directory and returns the models in it.
+func (loader *ModelLoader) Catalog() ([]CatalogEntry, error) {
+	loader.mutex.Lock()
+	params := loader.config.ControlParams
+	loader.mutex.Unlock()
+	return loader.catalog.Refresh(params)
+}
+
+// LoadModelByHash loads the catalogued model with the given SHA-256 or prefix.
+func (loader *ModelLoader) LoadModelByHash(hash string) error {
+	if _, err := loader.Catalog(); err != nil {
+		return err
+	}
+	entry, err := loader.catalog.Lookup(hash)
+	if err != nil {
+		return err
+	}
+	return loader.LoadSelectedModel(entry.Path)
+}
+
+// newModelCatalog catalogs config.ModelsDir, or the directory of
+// config.ModelPath if it isn't set.
+func newModelCatalog(config *Config) *ModelCatalog {
+	dir := config.ModelsDir
+	if dir == "" {
+		dir = filepath.Dir(config.ModelPath)
+	}
+	cachePath := ""
+	if config.CacheEnabled && config.CachePath != "" {
+		cachePath = filepath.Join(config.CachePath, "model_catalog.json")
+	}
+	return NewModelCatalog(dir, cachePath)
 }
 
 // SetControlParameters updates control params in config, saves them, and optionally reloads.
 func (loader *ModelLoader) SetControlParameters(params ControlParameters, reload bool) error {
+	if err := params.Validate(); err != nil {
+		return fmt.Errorf("invalid control parameters: %w", err)
+	}
+
 	loader.mutex.Lock()
 	defer loader.mutex.Unlock()
 
 	loader.config.ControlParams = params
 	cfgPath := GetDefaultConfigPath()
-	if err := SaveConfig(loader.config, cfgPath); err != nil {
+	if err := SaveConfig(loader.config, cfgPath, loader.logger); err != nil {
 		return fmt.Errorf("failed to save updated control parameters: %w", err)
 	}
 
@@ -189,6 +362,155 @@ func (loader *ModelLoader) SetControlParameters(params ControlParameters, reload
 	return nil
 }
 
+// ControlParameters returns a copy of the configured control parameters.
+func (loader *ModelLoader) ControlParameters() ControlParameters {
+	loader.mutex.Lock()
+	defer loader.mutex.Unlock()
+	return loader.config.ControlParams
+}
+
+// ContextWindow returns the tokens the model can attend to: the configured
+// window, else the context length in the model's GGUF metadata, else
+// DefaultContextWindow.
+func (loader *ModelLoader) ContextWindow() int {
+	loader.mutex.Lock()
+	window := loader.config.Conversations.ContextWindow
+	path := loader.config.ModelPath
+	remote := loader.config.Backend.Remote()
+	loader.mutex.Unlock()
+
+	if window > 0 {
+		return window
+	}
+	if !remote && strings.EqualFold(filepath.Ext(path), ".gguf") {
+		if gguf, err := ReadGGUF(path); err == nil {
+			if n := gguf.Info().ContextLength; n > 0 {
+				return int(n)
+			}
+		}
+	}
+	return DefaultContextWindow
+}
+
+// SetMetrics sets where the token counts and latency of each generation are reported.
+func (loader *ModelLoader) SetMetrics(recorder InferenceRecorder) {
+	loader.mutex.Lock()
+	defer loader.mutex.Unlock()
+	loader.metrics = recorder
+}
+
+// Generate returns the loaded model's reply to messages, sampled with the
+// configured control parameters.
+func (loader *ModelLoader) Generate(ctx context.Context, messages []ChatMessage) (*GenerateResult, error) {
+	return loader.GenerateWith(ctx, messages, loader.ControlParameters())
+}
+
+// GenerateWith is Generate with per-request control parameters.
+func (loader *ModelLoader) GenerateWith(ctx context.Context, messages []ChatMessage, params ControlParameters) (*GenerateResult, error) {
+	model, err := loader.activeModel()
+	if err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	res, err := model.Generate(ctx, messages, params)
+	loader.observe(model, start, res, err)
+	return res, err
+}
+
+// GenerateWithTools is GenerateWith, offering the model tools to call.
+func (loader *ModelLoader) GenerateWithTools(ctx context.Context, messages []ChatMessage, tools []Tool, params ControlParameters) (*GenerateResult, error) {
+	model, err := loader.activeModel()
+	if err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	res, err := model.GenerateWithTools(ctx, messages, tools, params)
+	loader.observe(model, start, res, err)
+	return res, err
+}
+
+// Stream is Generate, calling onToken with each piece of the reply as it is produced.
+func (loader *ModelLoader) Stream(ctx context.Context, messages []ChatMessage, onToken func(string) error) (*GenerateResult, error) {
+	return loader.StreamWith(ctx, messages, loader.ControlParameters(), onToken)
+}
+
+// StreamWith is Stream with per-request control parameters.
+func (loader *ModelLoader) StreamWith(ctx context.Context, messages []ChatMessage, params ControlParameters, onToken func(string) error) (*GenerateResult, error) {
+	model, err := loader.activeModel()
+	if err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	res, err := model.Stream(ctx, messages, params, onToken)
+	loader.observe(model, start, res, err)
+	return res, err
+}
+
+// Tokenize returns the loaded model's token ids for text.
+func (loader *ModelLoader) Tokenize(ctx context.Context, text string) ([]int, error) {
+	model, err := loader.activeModel()
+	if err != nil {
+		return nil, err
+	}
+	return model.Tokenize(ctx, text)
+}
+
+// Embed returns the loaded model's embedding of each text, or ErrEmbeddingsUnsupported.
+func (loader *ModelLoader) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	model, err := loader.activeModel()
+	if err != nil {
+		return nil, err
+	}
+	return model.Embed(ctx, texts)
+}
+
+// activeModel returns the loaded model. The loader's lock is not held while
+// generating, so a slow reply doesn't block unloading.
+func (loader *ModelLoader) activeModel() (*LanguageModel, error) {
+	loader.mutex.Lock()
+	defer loader.mutex.Unlock()
+	if loader.model == nil {
+		return nil, errors.New("no model currently loaded")
+	}
+	return loader.model, nil
+}
+
+// observe reports a generation to the metrics recorder, if there is one.
+func (loader *ModelLoader) observe(model *LanguageModel, start time.Time, res *GenerateResult, err error) {
+	loader.mutex.Lock()
+	recorder := loader.metrics
+	loader.mutex.Unlock()
+	if recorder == nil {
+		return
+	}
+
+	name := model.path
+	latency := time.Since(start)
+	prompt, completion := 0, 0
+	if res != nil {
+		if res.Model != "" {
+			name = res.Model
+		}
+		latency = res.Latency
+		prompt, completion = res.PromptTokens, res.CompletionTokens
+	}
+	recorder.ObserveInference(model.Backend().Name(), name, prompt, completion, latency, err)
+	if err != nil {
+		loader.logger.Warn("Inference failed", zap.String("model", name), zap.Error(err))
+	}
+}
+
+// modelName is the model path, or for remote backends the model name if one is configured.
+func (loader *ModelLoader) modelName() string {
+	if loader.config.Backend.Remote() {
+		if loader.config.Backend.Model != "" {
+			return loader.config.Backend.Model
+		}
+		return loader.config.Backend.URL
+	}
+	return loader.config.ModelPath
+}
+
 // checkModelFileExists ensures the model file is actually present on disk.
 func checkModelFileExists(modelPath string) error {
 	if _, err := os.Stat(modelPath); os.IsNotExist(err) {
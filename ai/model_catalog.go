@@ -0,0 +1,245 @@
+package ai
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CheckGGUFCompatibility reports why a model can't be loaded: a GGUF version
+// llama.cpp no longer reads, tensor types it doesn't know, a file shorter than
+// its tensor table says (usually an interrupted download), or a max_tokens
+// larger than the model's context.
+func CheckGGUFCompatibility(info GGUFInfo, fileSize int64, params ControlParameters) error {
+	var problems []string
+	if info.Version < 2 {
+		problems = append(problems, fmt.Sprintf("GGUF version %d is no longer supported; reconvert the model", info.Version))
+	}
+	if info.Architecture == "" {
+		problems = append(problems, "general.architecture is not set")
+	}
+	if info.TensorCount == 0 {
+		problems = append(problems, "the file has no tensors (vocabulary-only files can't be loaded)")
+	}
+	if len(info.UnknownTypes) > 0 {
+		problems = append(problems, fmt.Sprintf("unsupported tensor types %v", info.UnknownTypes))
+	}
+	if need := info.DataOffset + info.DataSize; fileSize >= 0 && uint64(fileSize) < need {
+		problems = append(problems, fmt.Sprintf("the file is truncated: %d bytes, but its tensors need %d", fileSize, need))
+	}
+	if info.ContextLength > 0 && uint64(params.MaxTokens) > info.ContextLength {
+		problems = append(problems, fmt.Sprintf("max_tokens %d exceeds the model's context length %d", params.MaxTokens, info.ContextLength))
+	}
+	if len(problems) > 0 {
+		return errors.New(strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// ValidateModelFile reads a GGUF model's header and checks it can be loaded
+// with params. Files without the .gguf extension aren't checked.
+func ValidateModelFile(path string, params ControlParameters) (*GGUFInfo, error) {
+	if !strings.EqualFold(filepath.Ext(path), ".gguf") {
+		return nil, nil
+	}
+	stat, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat model file: %w", err)
+	}
+	gguf, err := ReadGGUF(path)
+	if err != nil {
+		return nil, err
+	}
+	info := gguf.Info()
+	if err := CheckGGUFCompatibility(info, stat.Size(), params); err != nil {
+		return &info, fmt.Errorf("model %s is not compatible: %w", path, err)
+	}
+	return &info, nil
+}
+
+// CatalogEntry is a model file in the models directory.
+type CatalogEntry struct {
+	Path     string    `json:"path"`
+	SHA256   string    `json:"sha256"`
+	Size     int64     `json:"size"`
+	Modified time.Time `json:"modified"`
+	Info     *GGUFInfo `json:"info,omitempty"`
+	Summary  string    `json:"summary,omitempty"`
+	Error    string    `json:"error,omitempty"` // why the file can't be read or loaded
+}
+
+// ModelCatalog indexes the GGUF models in a directory by their SHA-256. Hashes
+// are cached, keyed by size and modification time, so only new or changed
+// files are read in full on refresh.
+type ModelCatalog struct {
+	dir       string
+	cachePath string
+	mu        sync.Mutex
+	entries   map[string]*CatalogEntry // by path
+}
+
+// NewModelCatalog returns a catalog of dir, caching hashes in cachePath. An
+// empty cachePath hashes every file on each refresh.
+func NewModelCatalog(dir, cachePath string) *ModelCatalog {
+	return &ModelCatalog{dir: dir, cachePath: cachePath, entries: make(map[string]*CatalogEntry)}
+}
+
+// Refresh rescans the directory and returns the catalog, sorted by path.
+func (mc *ModelCatalog) Refresh(params ControlParameters) ([]CatalogEntry, error) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+
+	if len(mc.entries) == 0 && mc.cachePath != "" {
+		mc.loadCacheLocked()
+	}
+
+	seen := make(map[string]bool)
+	err := filepath.WalkDir(mc.dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !strings.EqualFold(filepath.Ext(path), ".gguf") {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		seen[path] = true
+
+		if cached, ok := mc.entries[path]; ok && cached.Size == info.Size() && cached.Modified.Equal(info.ModTime()) {
+			mc.describe(cached, params)
+			return nil
+		}
+		entry := &CatalogEntry{Path: path, Size: info.Size(), Modified: info.ModTime()}
+		if entry.SHA256, err = hashFile(path); err != nil {
+			entry.Error = err.Error()
+		}
+		mc.describe(entry, params)
+		mc.entries[path] = entry
+		return nil
+	})
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to scan models directory: %w", err)
+	}
+
+	for path := range mc.entries {
+		if !seen[path] {
+			delete(mc.entries, path)
+		}
+	}
+	if mc.cachePath != "" {
+		if err := mc.saveCacheLocked(); err != nil {
+			return nil, err
+		}
+	}
+	return mc.listLocked(), nil
+}
+
+// describe reads the entry's GGUF header and checks it against params.
+func (mc *ModelCatalog) describe(entry *CatalogEntry, params ControlParameters) {
+	if entry.SHA256 == "" {
+		return
+	}
+	info, err := ValidateModelFile(entry.Path, params)
+	entry.Info = info
+	entry.Error = ""
+	if info != nil {
+		entry.Summary = info.Summary()
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+}
+
+// Entries returns the catalog as of the last refresh, sorted by path.
+func (mc *ModelCatalog) Entries() []CatalogEntry {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	return mc.listLocked()
+}
+
+// Lookup finds a model by its SHA-256, or a unique prefix of at least 8 hex digits.
+func (mc *ModelCatalog) Lookup(hash string) (*CatalogEntry, error) {
+	hash = strings.ToLower(hash)
+	if len(hash) < 8 {
+		return nil, errors.New("hash prefix must be at least 8 characters")
+	}
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+
+	var found *CatalogEntry
+	for _, e := range mc.entries {
+		if !strings.HasPrefix(e.SHA256, hash) {
+			continue
+		}
+		if found != nil && found.SHA256 != e.SHA256 {
+			return nil, fmt.Errorf("hash prefix %s matches more than one model", hash)
+		}
+		found = e
+	}
+	if found == nil {
+		return nil, fmt.Errorf("no model with hash %s in the catalog", hash)
+	}
+	entry := *found
+	return &entry, nil
+}
+
+func (mc *ModelCatalog) listLocked() []CatalogEntry {
+	list := make([]CatalogEntry, 0, len(mc.entries))
+	for _, e := range mc.entries {
+		list = append(list, *e)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Path < list[j].Path })
+	return list
+}
+
+func (mc *ModelCatalog) loadCacheLocked() {
+	data, err := os.ReadFile(mc.cachePath)
+	if err != nil {
+		return
+	}
+	var cached []*CatalogEntry
+	if json.Unmarshal(data, &cached) != nil {
+		return
+	}
+	for _, e := range cached {
+		mc.entries[e.Path] = e
+	}
+}
+
+func (mc *ModelCatalog) saveCacheLocked() error {
+	data, err := json.MarshalIndent(mc.listLocked(), "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode model catalog: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(mc.cachePath), 0755); err != nil {
+		return fmt.Errorf("failed to create model catalog directory: %w", err)
+	}
+	if err := os.WriteFile(mc.cachePath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write model catalog: %w", err)
+	}
+	return nil
+}
+
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open model file: %w", err)
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("failed to hash model file: %w", err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
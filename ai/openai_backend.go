@@ -0,0 +1,379 @@
+package ai
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OpenAIBackend talks to a server implementing the OpenAI /v1/chat/completions
+// protocol, such as llama.cpp's llama-server or ollama. top_k is not part of
+// the OpenAI API but both of those honour it.
+type OpenAIBackend struct {
+	baseURL string
+	apiKey  string
+	client  *http.Client
+
+	mu    sync.RWMutex
+	model string
+}
+
+// NewOpenAIBackend returns a backend for the server at cfg.URL. The URL may
+// include the /v1 suffix or not.
+func NewOpenAIBackend(cfg BackendConfig) *OpenAIBackend {
+	base := strings.TrimRight(cfg.URL, "/")
+	base = strings.TrimSuffix(base, "/v1")
+	return &OpenAIBackend{
+		baseURL: base,
+		apiKey:  cfg.APIKey,
+		model:   cfg.Model,
+		client: &http.Client{
+			Timeout: time.Duration(cfg.TimeoutSeconds) * time.Second,
+		},
+	}
+}
+
+func (b *OpenAIBackend) Name() string {
+	return BackendOpenAI
+}
+
+// Model returns the model name sent with each request.
+func (b *OpenAIBackend) Model() string {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.model
+}
+
+type openAIModelList struct {
+	Data []struct {
+		ID string `json:"id"`
+	} `json:"data"`
+}
+
+// Load checks the server is up and serves the configured model. If no model
+// was configured, the first one the server lists is used.
+func (b *OpenAIBackend) Load(ctx context.Context) error {
+	var list openAIModelList
+	if err := b.do(ctx, http.MethodGet, "/v1/models", nil, &list); err != nil {
+		return fmt.Errorf("failed to list models: %w", err)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(list.Data) == 0 {
+		// Some servers don't list models; trust the configuration.
+		return nil
+	}
+	if b.model == "" {
+		b.model = list.Data[0].ID
+		return nil
+	}
+	for _, m := range list.Data {
+		// ollama lists models with their tag, e.g. llama3:latest
+		if m.ID == b.model || strings.HasPrefix(m.ID, b.model+":") {
+			return nil
+		}
+	}
+	return fmt.Errorf("model %s is not served by %s", b.model, b.baseURL)
+}
+
+type chatCompletionRequest struct {
+	Model         string         `json:"model,omitempty"`
+	Messages      []ChatMessage  `json:"messages"`
+	Temperature   float64        `json:"temperature"`
+	TopP          float64        `json:"top_p,omitempty"`
+	TopK          int            `json:"top_k,omitempty"`
+	MaxTokens     int            `json:"max_tokens,omitempty"`
+	Stream        bool           `json:"stream,omitempty"`
+	StreamOptions *streamOptions `json:"stream_options,omitempty"`
+	Tools         []openAITool   `json:"tools,omitempty"`
+}
+
+type openAITool struct {
+	Type     string `json:"type"`
+	Function Tool   `json:"function"`
+}
+
+type streamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+type chatCompletionUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+}
+
+type chatCompletionResponse struct {
+	Model   string `json:"model"`
+	Choices []struct {
+		Message      ChatMessage `json:"message"`
+		Delta        ChatMessage `json:"delta"` // set instead of Message when streaming
+		FinishReason string      `json:"finish_reason"`
+	} `json:"choices"`
+	Usage *chatCompletionUsage `json:"usage"`
+}
+
+func (b *OpenAIBackend) newRequest(messages []ChatMessage, params ControlParameters, stream bool) chatCompletionRequest {
+	req := chatCompletionRequest{
+		Model:       b.Model(),
+		Messages:    messages,
+		Temperature: params.Temperature,
+		TopP:        params.TopP,
+		TopK:        params.TopK,
+		MaxTokens:   params.MaxTokens,
+		Stream:      stream,
+	}
+	if stream {
+		req.StreamOptions = &streamOptions{IncludeUsage: true}
+	}
+	return req
+}
+
+// Generate sends a non-streaming chat completion request.
+func (b *OpenAIBackend) Generate(ctx context.Context, messages []ChatMessage, params ControlParameters) (*GenerateResult, error) {
+	return b.GenerateWithTools(ctx, messages, nil, params)
+}
+
+// GenerateWithTools is Generate, offering the model tools to call. The calls
+// it makes are returned in the result's ToolCalls.
+func (b *OpenAIBackend) GenerateWithTools(ctx context.Context, messages []ChatMessage, tools []Tool, params ControlParameters) (*GenerateResult, error) {
+	start := time.Now()
+	req := b.newRequest(messages, params, false)
+	for _, tool := range tools {
+		req.Tools = append(req.Tools, openAITool{Type: "function", Function: tool})
+	}
+	var resp chatCompletionResponse
+	if err := b.do(ctx, http.MethodPost, "/v1/chat/completions", req, &resp); err != nil {
+		return nil, err
+	}
+	if len(resp.Choices) == 0 {
+		return nil, errors.New("chat completion returned no choices")
+	}
+
+	res := &GenerateResult{
+		Text:         resp.Choices[0].Message.Content,
+		Model:        resp.Model,
+		FinishReason: resp.Choices[0].FinishReason,
+		Latency:      time.Since(start),
+		ToolCalls:    resp.Choices[0].Message.ToolCalls,
+	}
+	if resp.Usage != nil {
+		res.PromptTokens = resp.Usage.PromptTokens
+		res.CompletionTokens = resp.Usage.CompletionTokens
+	}
+	return res, nil
+}
+
+// Stream sends a streaming chat completion request and reads the server-sent
+// events as they arrive. If the server does not report usage, the completion
+// token count is the number of content chunks received.
+func (b *OpenAIBackend) Stream(ctx context.Context, messages []ChatMessage, params ControlParameters, onToken func(string) error) (*GenerateResult, error) {
+	start := time.Now()
+	httpResp, err := b.send(ctx, http.MethodPost, "/v1/chat/completions", b.newRequest(messages, params, true))
+	if err != nil {
+		return nil, err
+	}
+	defer httpResp.Body.Close()
+
+	res := &GenerateResult{}
+	var text strings.Builder
+	chunks := 0
+	var usage *chatCompletionUsage
+
+	scanner := bufio.NewScanner(httpResp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "data:") {
+			// Blank separators, comments and event names
+			continue
+		}
+		data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		if data == "[DONE]" {
+			break
+		}
+
+		var chunk chatCompletionResponse
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return nil, fmt.Errorf("failed to decode stream chunk: %w", err)
+		}
+		if chunk.Model != "" {
+			res.Model = chunk.Model
+		}
+		if chunk.Usage != nil {
+			usage = chunk.Usage
+		}
+		if len(chunk.Choices) == 0 {
+			continue
+		}
+		if chunk.Choices[0].FinishReason != "" {
+			res.FinishReason = chunk.Choices[0].FinishReason
+		}
+		if piece := chunk.Choices[0].Delta.Content; piece != "" {
+			chunks++
+			text.WriteString(piece)
+			if onToken != nil {
+				if err := onToken(piece); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read stream: %w", err)
+	}
+
+	res.Text = text.String()
+	res.CompletionTokens = chunks
+	if usage != nil {
+		res.PromptTokens = usage.PromptTokens
+		res.CompletionTokens = usage.CompletionTokens
+	}
+	res.Latency = time.Since(start)
+	return res, nil
+}
+
+// Tokenize uses llama.cpp's /tokenize endpoint. Servers without it, such as
+// ollama, return ErrTokenizeUnsupported.
+func (b *OpenAIBackend) Tokenize(ctx context.Context, text string) ([]int, error) {
+	var resp struct {
+		Tokens []int `json:"tokens"`
+	}
+	err := b.do(ctx, http.MethodPost, "/tokenize", map[string]string{"content": text}, &resp)
+	var statusErr *openAIStatusError
+	if errors.As(err, &statusErr) && (statusErr.code == http.StatusNotFound || statusErr.code == http.StatusNotImplemented) {
+		return nil, ErrTokenizeUnsupported
+	}
+	if err != nil {
+		return nil, err
+	}
+	return resp.Tokens, nil
+}
+
+// Embed uses the /v1/embeddings endpoint. Servers that don't serve embeddings,
+// such as llama.cpp started without --embeddings, return ErrEmbeddingsUnsupported.
+func (b *OpenAIBackend) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	var resp struct {
+		Data []struct {
+			Index     int       `json:"index"`
+			Embedding []float32 `json:"embedding"`
+		} `json:"data"`
+	}
+	req := map[string]interface{}{"model": b.Model(), "input": texts}
+	err := b.do(ctx, http.MethodPost, "/v1/embeddings", req, &resp)
+	var statusErr *openAIStatusError
+	if errors.As(err, &statusErr) && (statusErr.code == http.StatusNotFound || statusErr.code == http.StatusNotImplemented) {
+		return nil, ErrEmbeddingsUnsupported
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	vectors := make([][]float32, len(texts))
+	for _, d := range resp.Data {
+		if d.Index < 0 || d.Index >= len(vectors) {
+			return nil, fmt.Errorf("embedding index %d out of range", d.Index)
+		}
+		vectors[d.Index] = d.Embedding
+	}
+	for i, v := range vectors {
+		if v == nil {
+			return nil, fmt.Errorf("no embedding returned for input %d", i)
+		}
+	}
+	return vectors, nil
+}
+
+// Unload drops idle connections; the model itself stays loaded in the server.
+func (b *OpenAIBackend) Unload() error {
+	b.client.CloseIdleConnections()
+	return nil
+}
+
+// openAIStatusError is a non-2xx reply, with the server's error message if it sent one.
+type openAIStatusError struct {
+	code    int
+	message string
+}
+
+// newOpenAIStatusError reads the message from an error body, which is
+// {"error": {"message": ...}} from OpenAI and llama.cpp but {"error": "..."} from ollama.
+func newOpenAIStatusError(code int, body []byte) *openAIStatusError {
+	res := &openAIStatusError{code: code}
+	var errBody struct {
+		Error json.RawMessage `json:"error"`
+	}
+	if json.Unmarshal(body, &errBody) != nil || len(errBody.Error) == 0 {
+		return res
+	}
+	var detail struct {
+		Message string `json:"message"`
+	}
+	if json.Unmarshal(errBody.Error, &res.message) != nil && json.Unmarshal(errBody.Error, &detail) == nil {
+		res.message = detail.Message
+	}
+	return res
+}
+
+func (e *openAIStatusError) Error() string {
+	if e.message == "" {
+		return fmt.Sprintf("server returned %d %s", e.code, http.StatusText(e.code))
+	}
+	return fmt.Sprintf("server returned %d: %s", e.code, e.message)
+}
+
+// send issues a request with an optional JSON body and returns the response
+// if its status is 2xx.
+func (b *OpenAIBackend) send(ctx context.Context, method, path string, body interface{}) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode request: %w", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, b.baseURL+path, reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if b.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+b.apiKey)
+	}
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request to %s failed: %w", path, err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+		return nil, newOpenAIStatusError(resp.StatusCode, data)
+	}
+	return resp, nil
+}
+
+// do sends a request and decodes the JSON reply into out.
+func (b *OpenAIBackend) do(ctx context.Context, method, path string, body, out interface{}) error {
+	resp, err := b.send(ctx, method, path, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response from %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,263 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newStandIn returns a server that answers like llama.cpp's llama-server,
+// recording the last chat completion request it received.
+func newStandIn(t *testing.T, last *chatCompletionRequest) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/models", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"object":"list","data":[{"id":"qwen2.5-0.5b-instruct"}]}`)
+	})
+	mux.HandleFunc("/v1/chat/completions", func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(last); err != nil {
+			t.Errorf("bad request body: %v", err)
+		}
+		if len(last.Messages) == 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"error":{"code":400,"message":"messages is empty","type":"invalid_request_error"}}`)
+			return
+		}
+		if len(last.Tools) > 0 {
+			fmt.Fprint(w, `{"model":"qwen2.5-0.5b-instruct","choices":[{"index":0,"message":{"role":"assistant","content":null,"tool_calls":[{"id":"call_0","type":"function","function":{"name":"status","arguments":"{\"args\":[\"vpn\"]}"}}]},"finish_reason":"tool_calls"}]}`)
+			return
+		}
+		if !last.Stream {
+			fmt.Fprint(w, `{"model":"qwen2.5-0.5b-instruct","choices":[{"index":0,"message":{"role":"assistant","content":"Hello there"},"finish_reason":"stop"}],"usage":{"prompt_tokens":9,"completion_tokens":2,"total_tokens":11}}`)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, piece := range []string{"Hel", "lo", " there"} {
+			fmt.Fprintf(w, "data: {\"model\":\"qwen2.5-0.5b-instruct\",\"choices\":[{\"index\":0,\"delta\":{\"content\":%q}}]}\n\n", piece)
+		}
+		fmt.Fprint(w, "data: {\"choices\":[{\"index\":0,\"delta\":{},\"finish_reason\":\"length\"}]}\n\n")
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	})
+	mux.HandleFunc("/v1/embeddings", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Input []string `json:"input"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		// Returned out of order, as some servers do
+		fmt.Fprint(w, `{"object":"list","data":[`)
+		for i := len(req.Input) - 1; i >= 0; i-- {
+			fmt.Fprintf(w, `{"object":"embedding","index":%d,"embedding":[%d,0.5]}`, i, len(req.Input[i]))
+			if i > 0 {
+				fmt.Fprint(w, ",")
+			}
+		}
+		fmt.Fprint(w, `]}`)
+	})
+	mux.HandleFunc("/tokenize", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Content string `json:"content"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		tokens := make([]int, len(strings.Fields(req.Content)))
+		for i := range tokens {
+			tokens[i] = 100 + i
+		}
+		json.NewEncoder(w).Encode(map[string][]int{"tokens": tokens})
+	})
+	return httptest.NewServer(mux)
+}
+
+func TestOpenAIBackendGenerate(t *testing.T) {
+	var last chatCompletionRequest
+	srv := newStandIn(t, &last)
+	defer srv.Close()
+
+	b := NewOpenAIBackend(BackendConfig{Type: BackendOpenAI, URL: srv.URL + "/v1/"})
+	if err := b.Load(context.Background()); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if b.Model() != "qwen2.5-0.5b-instruct" {
+		t.Errorf("expected the served model to be picked, got %q", b.Model())
+	}
+
+	params := ControlParameters{Temperature: 0.2, MaxTokens: 64, TopP: 0.8, TopK: 20}
+	res, err := b.Generate(context.Background(), []ChatMessage{{Role: "user", Content: "hi"}}, params)
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	if res.Text != "Hello there" || res.PromptTokens != 9 || res.CompletionTokens != 2 || res.FinishReason != "stop" {
+		t.Errorf("unexpected result %+v", res)
+	}
+	if last.Temperature != 0.2 || last.MaxTokens != 64 || last.TopP != 0.8 || last.TopK != 20 || last.Model != "qwen2.5-0.5b-instruct" {
+		t.Errorf("control parameters not sent: %+v", last)
+	}
+
+	_, err = b.Generate(context.Background(), nil, params)
+	if err == nil || !strings.Contains(err.Error(), "messages is empty") {
+		t.Errorf("expected the server's error message, got %v", err)
+	}
+}
+
+func TestOpenAIBackendToolCalls(t *testing.T) {
+	var last chatCompletionRequest
+	srv := newStandIn(t, &last)
+	defer srv.Close()
+
+	b := NewOpenAIBackend(BackendConfig{Type: BackendOpenAI, URL: srv.URL})
+	tools := []Tool{{Name: "status", Description: "Shows status.", Parameters: map[string]interface{}{"type": "object"}}}
+	res, err := b.GenerateWithTools(context.Background(), []ChatMessage{{Role: "user", Content: "is the vpn up?"}}, tools, ControlParameters{})
+	if err != nil {
+		t.Fatalf("GenerateWithTools: %v", err)
+	}
+	if len(last.Tools) != 1 || last.Tools[0].Type != "function" || last.Tools[0].Function.Name != "status" {
+		t.Errorf("tools not sent: %+v", last.Tools)
+	}
+	if len(res.ToolCalls) != 1 || res.ToolCalls[0].ID != "call_0" || res.ToolCalls[0].Function.Arguments != `{"args":["vpn"]}` {
+		t.Errorf("unexpected tool calls %+v", res.ToolCalls)
+	}
+}
+
+func TestOpenAIBackendStream(t *testing.T) {
+	var last chatCompletionRequest
+	srv := newStandIn(t, &last)
+	defer srv.Close()
+
+	b := NewOpenAIBackend(BackendConfig{Type: BackendOpenAI, URL: srv.URL, Model: "qwen2.5-0.5b-instruct"})
+	var pieces []string
+	res, err := b.Stream(context.Background(), []ChatMessage{{Role: "user", Content: "hi"}}, ControlParameters{MaxTokens: 3}, func(s string) error {
+		pieces = append(pieces, s)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Stream: %v", err)
+	}
+	if !last.Stream || last.StreamOptions == nil || !last.StreamOptions.IncludeUsage {
+		t.Errorf("expected a streaming request with usage, got %+v", last)
+	}
+	if strings.Join(pieces, "|") != "Hel|lo| there" {
+		t.Errorf("unexpected pieces %q", pieces)
+	}
+	// No usage in the stream, so completion tokens are counted from chunks
+	if res.Text != "Hello there" || res.CompletionTokens != 3 || res.FinishReason != "length" {
+		t.Errorf("unexpected result %+v", res)
+	}
+
+	stop := errors.New("stop")
+	_, err = b.Stream(context.Background(), []ChatMessage{{Role: "user", Content: "hi"}}, ControlParameters{MaxTokens: 3}, func(string) error {
+		return stop
+	})
+	if !errors.Is(err, stop) {
+		t.Errorf("expected the callback's error, got %v", err)
+	}
+}
+
+func TestOpenAIBackendTokenize(t *testing.T) {
+	var last chatCompletionRequest
+	srv := newStandIn(t, &last)
+	defer srv.Close()
+
+	b := NewOpenAIBackend(BackendConfig{Type: BackendOpenAI, URL: srv.URL})
+	tokens, err := b.Tokenize(context.Background(), "one two three")
+	if err != nil {
+		t.Fatalf("Tokenize: %v", err)
+	}
+	if len(tokens) != 3 || tokens[0] != 100 {
+		t.Errorf("unexpected tokens %v", tokens)
+	}
+
+	// ollama has no /tokenize endpoint
+	ollama := httptest.NewServer(http.NotFoundHandler())
+	defer ollama.Close()
+	b = NewOpenAIBackend(BackendConfig{Type: BackendOpenAI, URL: ollama.URL})
+	if _, err := b.Tokenize(context.Background(), "one"); !errors.Is(err, ErrTokenizeUnsupported) {
+		t.Errorf("expected ErrTokenizeUnsupported, got %v", err)
+	}
+}
+
+func TestOpenAIBackendEmbed(t *testing.T) {
+	var last chatCompletionRequest
+	srv := newStandIn(t, &last)
+	defer srv.Close()
+
+	b := NewOpenAIBackend(BackendConfig{Type: BackendOpenAI, URL: srv.URL})
+	vectors, err := b.Embed(context.Background(), []string{"a", "abc"})
+	if err != nil {
+		t.Fatalf("Embed: %v", err)
+	}
+	if len(vectors) != 2 || vectors[0][0] != 1 || vectors[1][0] != 3 {
+		t.Errorf("embeddings not matched to their inputs: %v", vectors)
+	}
+
+	// llama.cpp started without --embeddings
+	noEmbed := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotImplemented)
+		fmt.Fprint(w, `{"error":{"code":501,"message":"This server does not support embeddings. Start it with --embeddings","type":"not_supported_error"}}`)
+	}))
+	defer noEmbed.Close()
+	b = NewOpenAIBackend(BackendConfig{Type: BackendOpenAI, URL: noEmbed.URL})
+	if _, err := b.Embed(context.Background(), []string{"a"}); !errors.Is(err, ErrEmbeddingsUnsupported) {
+		t.Errorf("expected ErrEmbeddingsUnsupported, got %v", err)
+	}
+}
+
+type recordedInference struct {
+	backend, model     string
+	prompt, completion int
+	err                error
+}
+
+type fakeRecorder struct {
+	observed []recordedInference
+}
+
+func (f *fakeRecorder) ObserveInference(backend, model string, promptTokens, completionTokens int, latency time.Duration, err error) {
+	f.observed = append(f.observed, recordedInference{backend, model, promptTokens, completionTokens, err})
+}
+
+func TestLanguageModelWithBackend(t *testing.T) {
+	var last chatCompletionRequest
+	srv := newStandIn(t, &last)
+	defer srv.Close()
+
+	cfg := GetDefaultConfig()
+	cfg.Backend = BackendConfig{Type: BackendOpenAI, URL: srv.URL}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	backend, err := NewBackend(cfg)
+	if err != nil {
+		t.Fatalf("NewBackend: %v", err)
+	}
+	lm, err := NewLanguageModelWithBackend(cfg.Backend.URL, backend)
+	if err != nil {
+		t.Fatalf("NewLanguageModelWithBackend: %v", err)
+	}
+	if _, err := lm.RunInference("hi"); err == nil {
+		t.Errorf("expected an error before loading")
+	}
+	if err := lm.LoadModel(); err != nil {
+		t.Fatalf("LoadModel: %v", err)
+	}
+	out, err := lm.RunInference("hi")
+	if err != nil || out != "Hello there" {
+		t.Errorf("RunInference returned %q, %v", out, err)
+	}
+
+	rec := &fakeRecorder{}
+	loader := &ModelLoader{config: cfg, model: lm}
+	loader.SetMetrics(rec)
+	if _, err := loader.Generate(context.Background(), []ChatMessage{{Role: "user", Content: "hi"}}); err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	if last.Temperature != cfg.ControlParams.Temperature || last.TopK != cfg.ControlParams.TopK {
+		t.Errorf("configured control parameters not sent: %+v", last)
+	}
+	if len(rec.observed) != 1 || rec.observed[0] != (recordedInference{BackendOpenAI, "qwen2.5-0.5b-instruct", 9, 2, nil}) {
+		t.Errorf("unexpected metrics %+v", rec.observed)
+	}
+}
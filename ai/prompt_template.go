@@ -0,0 +1,114 @@
+package ai
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// PromptTemplate is a named system prompt and opening prompt, with {{name}}
+// variables filled in when a conversation is started from it.
+type PromptTemplate struct {
+	Name        string            `yaml:"name" json:"name"`
+	Description string            `yaml:"description,omitempty" json:"description,omitempty"`
+	System      string            `yaml:"system,omitempty" json:"system,omitempty"`
+	Prompt      string            `yaml:"prompt,omitempty" json:"prompt,omitempty"`
+	Defaults    map[string]string `yaml:"defaults,omitempty" json:"defaults,omitempty"` // values for variables the caller may omit
+}
+
+var templateVariable = regexp.MustCompile(`\{\{\s*([A-Za-z_][A-Za-z0-9_.-]*)\s*\}\}`)
+
+// Variables returns the names of the template's variables, sorted.
+func (t PromptTemplate) Variables() []string {
+	seen := make(map[string]bool)
+	for _, text := range []string{t.System, t.Prompt} {
+		for _, m := range templateVariable.FindAllStringSubmatch(text, -1) {
+			seen[m[1]] = true
+		}
+	}
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Render fills in the template's variables from vars, then its defaults. It
+// fails if any variable has no value.
+func (t PromptTemplate) Render(vars map[string]string) (system, prompt string, err error) {
+	var missing []string
+	for _, name := range t.Variables() {
+		if _, ok := vars[name]; !ok {
+			if _, ok := t.Defaults[name]; !ok {
+				missing = append(missing, name)
+			}
+		}
+	}
+	if len(missing) > 0 {
+		return "", "", fmt.Errorf("template %s needs values for %s", t.Name, strings.Join(missing, ", "))
+	}
+
+	fill := func(text string) string {
+		return templateVariable.ReplaceAllStringFunc(text, func(match string) string {
+			name := templateVariable.FindStringSubmatch(match)[1]
+			if value, ok := vars[name]; ok {
+				return value
+			}
+			return t.Defaults[name]
+		})
+	}
+	return fill(t.System), fill(t.Prompt), nil
+}
+
+// FindTemplate returns the template called name.
+func FindTemplate(templates []PromptTemplate, name string) (*PromptTemplate, error) {
+	for i := range templates {
+		if templates[i].Name == name {
+			return &templates[i], nil
+		}
+	}
+	return nil, fmt.Errorf("no prompt template named %q", name)
+}
+
+// validateTemplates checks template names are set and unique.
+func validateTemplates(templates []PromptTemplate) error {
+	seen := make(map[string]bool)
+	for _, t := range templates {
+		if t.Name == "" {
+			return fmt.Errorf("prompt templates must have a name")
+		}
+		if seen[t.Name] {
+			return fmt.Errorf("duplicate prompt template %q", t.Name)
+		}
+		seen[t.Name] = true
+	}
+	return nil
+}
+
+// defaultTemplates are the templates in a new config.
+func defaultTemplates() []PromptTemplate {
+	return []PromptTemplate{
+		{
+			Name:        "recon-summary",
+			Description: "Summarize scan results for a target",
+			System:      "You are a penetration testing assistant working on the {{engagement}} engagement. Be precise, cite hosts and ports, and flag anything out of scope.",
+			Prompt:      "Summarize the open services and likely attack surface of {{target}} from these results:\n\n{{results}}",
+			Defaults:    map[string]string{"engagement": "current"},
+		},
+		{
+			Name:        "cve-triage",
+			Description: "Triage a CVE against a service",
+			System:      "You are a vulnerability analyst. Rate exploitability for the environment described, and say what evidence would confirm it.",
+			Prompt:      "Is {{cve}} exploitable against {{service}} on {{target}}? List preconditions, detection steps and mitigations.",
+		},
+		{
+			Name:        "finding-writeup",
+			Description: "Write a report finding",
+			System:      "You write findings for penetration test reports: title, severity, description, impact, evidence and remediation, in plain language for {{audience}}.",
+			Prompt:      "Write up this finding:\n\n{{notes}}",
+			Defaults:    map[string]string{"audience": "a technical client"},
+		},
+	}
+}
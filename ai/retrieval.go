@@ -0,0 +1,615 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// BM25 parameters, and the constant of the reciprocal rank fusion that merges
+// keyword and vector rankings.
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+	rrfK   = 60
+
+	defaultSearchLimit = 8
+	embedBatchSize     = 32
+)
+
+// Embedder embeds text as vectors for similarity search. ModelLoader
+// implements it, returning ErrEmbeddingsUnsupported if its backend can't.
+type Embedder interface {
+	Embed(ctx context.Context, texts []string) ([][]float32, error)
+}
+
+// Chunk is an indexed piece of a source file, cited by its location within it.
+type Chunk struct {
+	ID       int       `json:"id"`
+	Source   string    `json:"source"`   // file path
+	Location string    `json:"location"` // e.g. "row 12", "page 3", "$.hosts[4]" or "lines 31-60"
+	Text     string    `json:"text"`
+	Modified time.Time `json:"modified"` // the source file's modification time
+	Vector   []float32 `json:"vector,omitempty"`
+}
+
+// Citation returns where the chunk came from, e.g. "reports/nmap.csv, row 12".
+func (c *Chunk) Citation() string {
+	return c.Source + ", " + c.Location
+}
+
+// IngestStats counts what an ingest added to the index.
+type IngestStats struct {
+	Files    int `json:"files"`
+	Chunks   int `json:"chunks"`
+	Embedded int `json:"embedded"` // chunks that also got a vector
+	Skipped  int `json:"skipped"`  // files unchanged since they were last ingested
+}
+
+// SearchOptions narrow a search.
+type SearchOptions struct {
+	Limit int       // results to return; 0 means defaultSearchLimit
+	Since time.Time // only chunks from files modified at or after this time
+}
+
+// SearchHit is a chunk matching a query, best first.
+type SearchHit struct {
+	Chunk Chunk   `json:"chunk"`
+	Score float64 `json:"score"`
+}
+
+// RetrievalIndex is an embedded search index over GhostShell's scan results
+// and reports. Chunks are ranked with BM25 and, when the embedder supports it,
+// by vector similarity as well.
+type RetrievalIndex struct {
+	mu          sync.RWMutex
+	embedder    Embedder
+	chunks      map[int]*Chunk
+	nextID      int
+	sources     map[string][]int     // source path => its chunk ids
+	modified    map[string]time.Time // source path => modification time when ingested
+	postings    map[string]map[int]int
+	lengths     map[int]int
+	totalLength int
+}
+
+// NewRetrievalIndex returns an empty index. embedder may be nil for keyword search only.
+func NewRetrievalIndex(embedder Embedder) *RetrievalIndex {
+	return &RetrievalIndex{
+		embedder: embedder,
+		chunks:   make(map[int]*Chunk),
+		sources:  make(map[string][]int),
+		modified: make(map[string]time.Time),
+		postings: make(map[string]map[int]int),
+		lengths:  make(map[int]int),
+	}
+}
+
+// Len returns the number of indexed chunks.
+func (ix *RetrievalIndex) Len() int {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	return len(ix.chunks)
+}
+
+// IngestDir ingests every supported file under dir, skipping files that
+// haven't changed since they were last ingested. Symlinks are not followed,
+// so nothing outside dir is read.
+func (ix *RetrievalIndex) IngestDir(ctx context.Context, dir string) (IngestStats, error) {
+	var stats IngestStats
+	err := filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || d.Type()&os.ModeSymlink != 0 || !SupportedRetrievalFile(path) {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		ix.mu.RLock()
+		last, seen := ix.modified[path]
+		ix.mu.RUnlock()
+		if seen && last.Equal(info.ModTime()) {
+			stats.Skipped++
+			return nil
+		}
+
+		fileStats, err := ix.IngestFile(ctx, path)
+		if err != nil {
+			return err
+		}
+		stats.Files += fileStats.Files
+		stats.Chunks += fileStats.Chunks
+		stats.Embedded += fileStats.Embedded
+		return nil
+	})
+	if err != nil {
+		return stats, fmt.Errorf("failed to ingest %s: %w", dir, err)
+	}
+	return stats, nil
+}
+
+// IngestFile chunks and indexes one file, replacing what was indexed from it
+// before. Vectors are added if the embedder supports them; if it doesn't, the
+// chunks are indexed for keyword search only.
+func (ix *RetrievalIndex) IngestFile(ctx context.Context, path string) (IngestStats, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return IngestStats{}, fmt.Errorf("failed to stat %s: %w", path, err)
+	}
+	pieces, err := chunkFile(path)
+	if err != nil {
+		return IngestStats{}, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	chunks := make([]*Chunk, len(pieces))
+	for i, p := range pieces {
+		chunks[i] = &Chunk{Source: path, Location: p.location, Text: p.text, Modified: info.ModTime()}
+	}
+	embedded := ix.embed(ctx, chunks)
+
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	ix.removeLocked(path)
+	for _, c := range chunks {
+		ix.addLocked(c)
+	}
+	ix.modified[path] = info.ModTime()
+	return IngestStats{Files: 1, Chunks: len(chunks), Embedded: embedded}, nil
+}
+
+// embed sets the chunks' vectors in batches, stopping at the first failure.
+// Returns how many were embedded.
+func (ix *RetrievalIndex) embed(ctx context.Context, chunks []*Chunk) int {
+	if ix.embedder == nil {
+		return 0
+	}
+	done := 0
+	for start := 0; start < len(chunks); start += embedBatchSize {
+		end := start + embedBatchSize
+		if end > len(chunks) {
+			end = len(chunks)
+		}
+		texts := make([]string, 0, end-start)
+		for _, c := range chunks[start:end] {
+			texts = append(texts, c.Text)
+		}
+		vectors, err := ix.embedder.Embed(ctx, texts)
+		if err != nil || len(vectors) != len(texts) {
+			return done
+		}
+		for i, v := range vectors {
+			chunks[start+i].Vector = v
+		}
+		done += len(vectors)
+	}
+	return done
+}
+
+// Remove drops everything indexed from source.
+func (ix *RetrievalIndex) Remove(source string) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	ix.removeLocked(source)
+}
+
+func (ix *RetrievalIndex) addLocked(c *Chunk) {
+	ix.nextID++
+	c.ID = ix.nextID
+	ix.chunks[c.ID] = c
+	ix.sources[c.Source] = append(ix.sources[c.Source], c.ID)
+
+	terms := retrievalTerms(c.Text + " " + filepath.Base(c.Source))
+	for _, t := range terms {
+		if ix.postings[t] == nil {
+			ix.postings[t] = make(map[int]int)
+		}
+		ix.postings[t][c.ID]++
+	}
+	ix.lengths[c.ID] = len(terms)
+	ix.totalLength += len(terms)
+}
+
+func (ix *RetrievalIndex) removeLocked(source string) {
+	for _, id := range ix.sources[source] {
+		c := ix.chunks[id]
+		for _, t := range retrievalTerms(c.Text + " " + filepath.Base(c.Source)) {
+			delete(ix.postings[t], id)
+			if len(ix.postings[t]) == 0 {
+				delete(ix.postings, t)
+			}
+		}
+		ix.totalLength -= ix.lengths[id]
+		delete(ix.lengths, id)
+		delete(ix.chunks, id)
+	}
+	delete(ix.sources, source)
+	delete(ix.modified, source)
+}
+
+// Search returns the chunks that best match query. Keyword and vector
+// rankings are merged with reciprocal rank fusion when vectors are available.
+func (ix *RetrievalIndex) Search(ctx context.Context, query string, opts SearchOptions) ([]SearchHit, error) {
+	if opts.Limit <= 0 {
+		opts.Limit = defaultSearchLimit
+	}
+	terms := expandQueryTerms(retrievalTerms(query))
+
+	var queryVector []float32
+	if ix.embedder != nil && ix.hasVectors() {
+		if vectors, err := ix.embedder.Embed(ctx, []string{query}); err == nil && len(vectors) == 1 {
+			queryVector = vectors[0]
+		}
+	}
+	if len(terms) == 0 && queryVector == nil {
+		return nil, errors.New("query has no searchable terms")
+	}
+
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+
+	keyword := ix.bm25Locked(terms, opts.Since)
+	ranked := keyword
+	if queryVector != nil {
+		ranked = fuseRankings(keyword, ix.similarLocked(queryVector, opts.Since))
+	}
+
+	if len(ranked) > opts.Limit {
+		ranked = ranked[:opts.Limit]
+	}
+	hits := make([]SearchHit, len(ranked))
+	for i, r := range ranked {
+		hits[i] = SearchHit{Chunk: *ix.chunks[r.id], Score: r.score}
+		hits[i].Chunk.Vector = nil
+	}
+	return hits, nil
+}
+
+func (ix *RetrievalIndex) hasVectors() bool {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	for _, c := range ix.chunks {
+		if c.Vector != nil {
+			return true
+		}
+	}
+	return false
+}
+
+type scoredChunk struct {
+	id    int
+	score float64
+}
+
+// bm25Locked scores the chunks containing any of terms, best first.
+func (ix *RetrievalIndex) bm25Locked(terms []string, since time.Time) []scoredChunk {
+	n := float64(len(ix.chunks))
+	if n == 0 {
+		return nil
+	}
+	avgLength := float64(ix.totalLength) / n
+	scores := make(map[int]float64)
+	for _, t := range terms {
+		postings := ix.postings[t]
+		if len(postings) == 0 {
+			continue
+		}
+		df := float64(len(postings))
+		idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+		for id, tf := range postings {
+			if ix.chunks[id].Modified.Before(since) {
+				continue
+			}
+			f := float64(tf)
+			norm := f + bm25K1*(1-bm25B+bm25B*float64(ix.lengths[id])/avgLength)
+			scores[id] += idf * f * (bm25K1 + 1) / norm
+		}
+	}
+	return sortScores(scores)
+}
+
+// similarLocked ranks the chunks with vectors by cosine similarity to v.
+func (ix *RetrievalIndex) similarLocked(v []float32, since time.Time) []scoredChunk {
+	scores := make(map[int]float64)
+	for id, c := range ix.chunks {
+		if c.Vector == nil || len(c.Vector) != len(v) || c.Modified.Before(since) {
+			continue
+		}
+		scores[id] = cosineSimilarity(v, c.Vector)
+	}
+	return sortScores(scores)
+}
+
+// fuseRankings merges rankings by reciprocal rank fusion, which needs no
+// calibration between BM25 scores and cosine similarities.
+func fuseRankings(rankings ...[]scoredChunk) []scoredChunk {
+	scores := make(map[int]float64)
+	for _, ranking := range rankings {
+		for rank, r := range ranking {
+			scores[r.id] += 1 / float64(rrfK+rank+1)
+		}
+	}
+	return sortScores(scores)
+}
+
+func sortScores(scores map[int]float64) []scoredChunk {
+	ranked := make([]scoredChunk, 0, len(scores))
+	for id, s := range scores {
+		ranked = append(ranked, scoredChunk{id, s})
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		if ranked[i].score != ranked[j].score {
+			return ranked[i].score > ranked[j].score
+		}
+		return ranked[i].id < ranked[j].id
+	})
+	return ranked
+}
+
+func cosineSimilarity(a, b []float32) float64 {
+	var dot, na, nb float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		na += float64(a[i]) * float64(a[i])
+		nb += float64(b[i]) * float64(b[i])
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(na) * math.Sqrt(nb))
+}
+
+// retrievalStopwords are left out of the index and of queries, along with the
+// time words that ParseTimeHint turns into a filter.
+var retrievalStopwords = map[string]bool{
+	"a": true, "an": true, "and": true, "are": true, "as": true, "at": true, "be": true, "by": true,
+	"did": true, "do": true, "does": true, "for": true, "from": true, "had": true, "has": true,
+	"have": true, "in": true, "is": true, "it": true, "of": true, "on": true, "or": true,
+	"that": true, "the": true, "this": true, "to": true, "was": true, "were": true, "what": true,
+	"when": true, "where": true, "which": true, "who": true, "with": true, "any": true, "all": true,
+	"show": true, "list": true, "me": true, "last": true, "past": true, "week": true, "month": true,
+	"today": true, "yesterday": true, "days": true, "ago": true,
+}
+
+// retrievalTerms lowercases text and splits it into terms. Dots, colons and
+// hyphens inside a term are kept, so addresses, versions and CVE ids stay whole.
+func retrievalTerms(text string) []string {
+	fields := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '.' && r != ':' && r != '-' && r != '_' && r != '/'
+	})
+	terms := make([]string, 0, len(fields))
+	for _, f := range fields {
+		f = strings.Trim(f, ".:-_/")
+		if f == "" || retrievalStopwords[f] {
+			continue
+		}
+		terms = append(terms, stemTerm(f))
+		// Also index the parts of compound terms, e.g. "3389/tcp" and "ms-wbt-server"
+		if strings.ContainsAny(f, "/-_") && !strings.HasPrefix(f, "cve-") {
+			for _, part := range strings.FieldsFunc(f, func(r rune) bool { return r == '/' || r == '-' || r == '_' }) {
+				if part != "" && !retrievalStopwords[part] {
+					terms = append(terms, part)
+				}
+			}
+		}
+	}
+	return terms
+}
+
+// stemTerm drops a plural "s" from plain words, so "hosts" matches "host".
+func stemTerm(t string) string {
+	if len(t) <= 3 || !strings.HasSuffix(t, "s") || strings.HasSuffix(t, "ss") {
+		return t
+	}
+	for _, r := range t {
+		if !unicode.IsLetter(r) {
+			return t
+		}
+	}
+	return t[:len(t)-1]
+}
+
+// serviceAliases maps the names people ask about to the names and ports
+// scanners report them under.
+var serviceAliases = map[string][]string{
+	"rdp":    {"ms-wbt-server", "3389"},
+	"smb":    {"microsoft-ds", "netbios-ssn", "445"},
+	"ssh":    {"22"},
+	"telnet": {"23"},
+	"ftp":    {"21"},
+	"http":   {"80", "8080"},
+	"https":  {"443", "ssl/http"},
+	"dns":    {"domain", "53"},
+	"vnc":    {"5900"},
+	"mysql":  {"3306"},
+	"mssql":  {"ms-sql-s", "1433"},
+	"ldap":   {"389"},
+	"snmp":   {"161"},
+	"winrm":  {"5985", "5986"},
+}
+
+func expandQueryTerms(terms []string) []string {
+	expanded := append([]string(nil), terms...)
+	for _, t := range terms {
+		expanded = append(expanded, serviceAliases[t]...)
+	}
+	return expanded
+}
+
+var lastNDays = regexp.MustCompile(`\b(?:last|past)\s+(\d+)\s+days?\b|\b(\d+)\s+days?\s+ago\b`)
+
+// ParseTimeHint finds a relative time range in a question, such as "last
+// week", "yesterday" or "last 3 days", and returns its start.
+func ParseTimeHint(question string, now time.Time) (time.Time, bool) {
+	q := strings.ToLower(question)
+	if m := lastNDays.FindStringSubmatch(q); m != nil {
+		digits := m[1]
+		if digits == "" {
+			digits = m[2]
+		}
+		if n, err := strconv.Atoi(digits); err == nil {
+			return now.AddDate(0, 0, -n), true
+		}
+	}
+	startOfDay := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	switch {
+	case strings.Contains(q, "today"):
+		return startOfDay, true
+	case strings.Contains(q, "yesterday"):
+		return startOfDay.AddDate(0, 0, -1), true
+	case strings.Contains(q, "last week"), strings.Contains(q, "past week"), strings.Contains(q, "this week"):
+		return now.AddDate(0, 0, -7), true
+	case strings.Contains(q, "last month"), strings.Contains(q, "past month"), strings.Contains(q, "this month"):
+		return now.AddDate(0, -1, 0), true
+	}
+	return time.Time{}, false
+}
+
+// retrievalIndexFile is the on-disk form of a RetrievalIndex.
+type retrievalIndexFile struct {
+	Chunks   []*Chunk             `json:"chunks"`
+	Modified map[string]time.Time `json:"modified"`
+}
+
+// Save writes the index to path as JSON.
+func (ix *RetrievalIndex) Save(path string) error {
+	ix.mu.RLock()
+	file := retrievalIndexFile{Modified: ix.modified}
+	for _, c := range ix.chunks {
+		file.Chunks = append(file.Chunks, c)
+	}
+	sort.Slice(file.Chunks, func(i, j int) bool { return file.Chunks[i].ID < file.Chunks[j].ID })
+	data, err := json.Marshal(file)
+	ix.mu.RUnlock()
+	if err != nil {
+		return fmt.Errorf("failed to encode retrieval index: %w", err)
+	}
+
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("failed to create retrieval index directory: %w", err)
+		}
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write retrieval index: %w", err)
+	}
+	return os.Rename(tmp, path)
+}
+
+// LoadRetrievalIndex reads an index saved with Save. A missing file gives an empty index.
+func LoadRetrievalIndex(path string, embedder Embedder) (*RetrievalIndex, error) {
+	ix := NewRetrievalIndex(embedder)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return ix, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read retrieval index: %w", err)
+	}
+
+	var file retrievalIndexFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse retrieval index: %w", err)
+	}
+	for _, c := range file.Chunks {
+		ix.addLocked(c)
+	}
+	for source, t := range file.Modified {
+		ix.modified[source] = t
+	}
+	return ix, nil
+}
+
+// AnswerModel generates the answer to a question from retrieved context.
+// ModelLoader implements it.
+type AnswerModel interface {
+	Generate(ctx context.Context, messages []ChatMessage) (*GenerateResult, error)
+}
+
+// Citation is a source the answer was drawn from, numbered as in the answer's [n] markers.
+type Citation struct {
+	Number   int       `json:"number"`
+	Source   string    `json:"source"`
+	Location string    `json:"location"`
+	Modified time.Time `json:"modified"`
+}
+
+// RetrievalAnswer is an answer with the sources it cites.
+type RetrievalAnswer struct {
+	Answer    string          `json:"answer"`
+	Citations []Citation      `json:"citations"`
+	Since     time.Time       `json:"since,omitempty"` // the time filter taken from the question, if any
+	Result    *GenerateResult `json:"result,omitempty"`
+}
+
+const retrievalSystemPrompt = "You answer questions about GhostShell scan results and reports using only the numbered sources given. " +
+	"Cite the sources each fact comes from as [n]. If the sources don't contain the answer, say so."
+
+var citationMarker = regexp.MustCompile(`\[(\d+)\]`)
+
+// Ask answers question from the best-matching chunks, citing each by file and
+// location. A time range in the question, such as "last week", limits the
+// search to files modified since, unless opts.Since is set.
+func (ix *RetrievalIndex) Ask(ctx context.Context, model AnswerModel, question string, opts SearchOptions) (*RetrievalAnswer, error) {
+	answer := &RetrievalAnswer{Since: opts.Since}
+	if opts.Since.IsZero() {
+		if since, ok := ParseTimeHint(question, time.Now()); ok {
+			opts.Since = since
+			answer.Since = since
+		}
+	}
+
+	hits, err := ix.Search(ctx, question, opts)
+	if err != nil {
+		return nil, err
+	}
+	if len(hits) == 0 {
+		answer.Answer = "No indexed scan results or reports match the question."
+		return answer, nil
+	}
+
+	var sources strings.Builder
+	for i, h := range hits {
+		fmt.Fprintf(&sources, "[%d] %s (modified %s)\n%s\n\n", i+1, h.Chunk.Citation(), h.Chunk.Modified.Format("2006-01-02 15:04"), h.Chunk.Text)
+	}
+	res, err := model.Generate(ctx, []ChatMessage{
+		{Role: "system", Content: retrievalSystemPrompt},
+		{Role: "user", Content: fmt.Sprintf("Sources:\n\n%sQuestion: %s", sources.String(), question)},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate answer: %w", err)
+	}
+	answer.Answer = strings.TrimSpace(res.Text)
+	answer.Result = res
+
+	// Cite the sources the answer refers to, or all of them if it refers to none
+	cited := make(map[int]bool)
+	for _, m := range citationMarker.FindAllStringSubmatch(answer.Answer, -1) {
+		if n, err := strconv.Atoi(m[1]); err == nil && n >= 1 && n <= len(hits) {
+			cited[n] = true
+		}
+	}
+	for i, h := range hits {
+		if len(cited) == 0 || cited[i+1] {
+			answer.Citations = append(answer.Citations, Citation{Number: i + 1, Source: h.Chunk.Source, Location: h.Chunk.Location, Modified: h.Chunk.Modified})
+		}
+	}
+	return answer, nil
+}
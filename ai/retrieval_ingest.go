@@ -0,0 +1,282 @@
+package ai
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	// maxChunkChars is the size above which a JSON value is split into its
+	// fields rather than indexed whole.
+	maxChunkChars = 2000
+	// textChunkLines is how many lines of a text file or PDF page go in a
+	// chunk, with textChunkOverlap lines repeated between neighbours.
+	textChunkLines   = 30
+	textChunkOverlap = 5
+)
+
+// rawChunk is a piece of a file before it is indexed.
+type rawChunk struct {
+	location string
+	text     string
+}
+
+// SupportedRetrievalFile reports whether the index can ingest path: CSV, JSON
+// and JSON lines from the scanners, PDF reports, and text, Markdown and logs.
+func SupportedRetrievalFile(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv", ".json", ".jsonl", ".ndjson", ".pdf", ".txt", ".md", ".log":
+		return true
+	}
+	return false
+}
+
+// chunkFile splits a file into chunks according to its format.
+func chunkFile(path string) ([]rawChunk, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		return chunkCSV(data)
+	case ".json":
+		return chunkJSON(data)
+	case ".jsonl", ".ndjson":
+		return chunkJSONLines(data), nil
+	case ".pdf":
+		return chunkPDF(data)
+	case ".txt", ".md", ".log":
+		return chunkText(string(data), ""), nil
+	}
+	return nil, fmt.Errorf("unsupported file type: %s", filepath.Ext(path))
+}
+
+// chunkCSV makes each row a chunk of "column: value" pairs, cited by its row
+// number counting from the first row after the header.
+func chunkCSV(data []byte) ([]rawChunk, error) {
+	r := csv.NewReader(bytes.NewReader(data))
+	r.FieldsPerRecord = -1
+	r.LazyQuotes = true
+	header, err := r.Read()
+	if err == io.EOF {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse CSV header: %w", err)
+	}
+
+	var chunks []rawChunk
+	for row := 1; ; row++ {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse CSV row %d: %w", row, err)
+		}
+		var fields []string
+		for i, value := range record {
+			if strings.TrimSpace(value) == "" {
+				continue
+			}
+			name := fmt.Sprintf("column %d", i+1)
+			if i < len(header) && header[i] != "" {
+				name = header[i]
+			}
+			fields = append(fields, name+": "+value)
+		}
+		if len(fields) > 0 {
+			chunks = append(chunks, rawChunk{location: fmt.Sprintf("row %d", row), text: strings.Join(fields, "; ")})
+		}
+	}
+	return chunks, nil
+}
+
+// chunkJSON makes each element of the document's arrays a chunk, cited by its
+// path, e.g. "$.hosts[3]". Elements too big for one chunk are split further.
+func chunkJSON(data []byte) ([]rawChunk, error) {
+	var doc interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse JSON: %w", err)
+	}
+	var chunks []rawChunk
+	walkJSON("$", doc, &chunks)
+	return chunks, nil
+}
+
+func walkJSON(path string, v interface{}, chunks *[]rawChunk) {
+	switch t := v.(type) {
+	case []interface{}:
+		for i, elem := range t {
+			elemPath := fmt.Sprintf("%s[%d]", path, i)
+			text := flattenJSON(elem)
+			if len(text) > maxChunkChars && isJSONContainer(elem) {
+				walkJSON(elemPath, elem, chunks)
+			} else if text != "" {
+				*chunks = append(*chunks, rawChunk{location: elemPath, text: text})
+			}
+		}
+	case map[string]interface{}:
+		// Scalars and small objects stay together; arrays and big objects get their own chunks
+		var inline []string
+		for _, key := range sortedJSONKeys(t) {
+			child := t[key]
+			_, isArray := child.([]interface{})
+			text := flattenJSON(child)
+			if isArray || (isJSONContainer(child) && len(text) > maxChunkChars) {
+				walkJSON(path+"."+key, child, chunks)
+				continue
+			}
+			if text != "" {
+				inline = append(inline, prefixJSONLines(key, text))
+			}
+		}
+		if len(inline) > 0 {
+			*chunks = append(*chunks, rawChunk{location: path, text: strings.Join(inline, "\n")})
+		}
+	default:
+		if text := flattenJSON(t); text != "" {
+			*chunks = append(*chunks, rawChunk{location: path, text: text})
+		}
+	}
+}
+
+// flattenJSON renders a value as "key: value" lines, with nested keys joined by dots.
+func flattenJSON(v interface{}) string {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		var lines []string
+		for _, key := range sortedJSONKeys(t) {
+			if text := flattenJSON(t[key]); text != "" {
+				lines = append(lines, prefixJSONLines(key, text))
+			}
+		}
+		return strings.Join(lines, "\n")
+	case []interface{}:
+		var parts []string
+		scalars := true
+		for _, elem := range t {
+			if isJSONContainer(elem) {
+				scalars = false
+			}
+			if text := flattenJSON(elem); text != "" {
+				parts = append(parts, text)
+			}
+		}
+		if scalars {
+			return strings.Join(parts, ", ")
+		}
+		return strings.Join(parts, "\n")
+	case nil:
+		return ""
+	case string:
+		return strings.TrimSpace(t)
+	default:
+		return fmt.Sprint(t)
+	}
+}
+
+// prefixJSONLines puts key in front of each line of a flattened value.
+func prefixJSONLines(key, text string) string {
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		if strings.Contains(line, ": ") {
+			lines[i] = key + "." + line
+		} else {
+			lines[i] = key + ": " + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func isJSONContainer(v interface{}) bool {
+	switch v.(type) {
+	case map[string]interface{}, []interface{}:
+		return true
+	}
+	return false
+}
+
+func sortedJSONKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// chunkJSONLines makes each line a chunk, flattened if it is a JSON value.
+func chunkJSONLines(data []byte) []rawChunk {
+	var chunks []rawChunk
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		var v interface{}
+		if json.Unmarshal([]byte(text), &v) == nil {
+			text = flattenJSON(v)
+		}
+		if text != "" {
+			chunks = append(chunks, rawChunk{location: fmt.Sprintf("line %d", line), text: text})
+		}
+	}
+	return chunks
+}
+
+// chunkPDF chunks the text of each page of a PDF report.
+func chunkPDF(data []byte) ([]rawChunk, error) {
+	pages, err := extractPDFText(data)
+	if err != nil {
+		return nil, err
+	}
+	var chunks []rawChunk
+	for i, page := range pages {
+		chunks = append(chunks, chunkText(page, fmt.Sprintf("page %d", i+1))...)
+	}
+	return chunks, nil
+}
+
+// chunkText splits text into overlapping windows of lines, cited by line
+// numbers after prefix, e.g. "page 2, lines 1-30".
+func chunkText(text, prefix string) []rawChunk {
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	for len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	var chunks []rawChunk
+	for start := 0; start < len(lines); start += textChunkLines - textChunkOverlap {
+		end := start + textChunkLines
+		if end > len(lines) {
+			end = len(lines)
+		}
+		body := strings.TrimSpace(strings.Join(lines[start:end], "\n"))
+		if body != "" {
+			location := fmt.Sprintf("lines %d-%d", start+1, end)
+			if prefix != "" {
+				location = prefix + ", " + location
+				if start == 0 && end == len(lines) {
+					location = prefix
+				}
+			}
+			chunks = append(chunks, rawChunk{location: location, text: body})
+		}
+		if end == len(lines) {
+			break
+		}
+	}
+	return chunks
+}
@@ -0,0 +1,247 @@
+package ai
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// extractPDFText returns the text of each page of a PDF, as the reports are
+// written by gofpdf: one content stream per page, usually Flate-compressed,
+// with text in literal strings. It is not a general PDF reader; streams it
+// can't decode, and text in hex-encoded glyph ids, are skipped.
+func extractPDFText(data []byte) ([]string, error) {
+	if !bytes.HasPrefix(bytes.TrimLeft(data, " \t\r\n"), []byte("%PDF")) {
+		return nil, errors.New("not a PDF file")
+	}
+
+	var pages []string
+	rest := data
+	for {
+		start := bytes.Index(rest, []byte("stream"))
+		if start < 0 {
+			break
+		}
+		// Skip the "stream" in "endstream"
+		if start >= 3 && bytes.Equal(rest[start-3:start], []byte("end")) {
+			rest = rest[start+len("stream"):]
+			continue
+		}
+		// The stream's dictionary, from the "N 0 obj" that opens it
+		dict := rest[:start]
+		if objStart := bytes.LastIndex(dict, []byte("obj")); objStart >= 0 {
+			dict = dict[objStart:]
+		}
+
+		body := rest[start+len("stream"):]
+		body = bytes.TrimPrefix(body, []byte("\r"))
+		body = bytes.TrimPrefix(body, []byte("\n"))
+		end := bytes.Index(body, []byte("endstream"))
+		if end < 0 {
+			break
+		}
+		content := body[:end]
+		rest = body[end+len("endstream"):]
+
+		if bytes.Contains(dict, []byte("/FlateDecode")) {
+			inflated, err := io.ReadAll(zlibReader(content))
+			if err != nil && len(inflated) == 0 {
+				continue
+			}
+			content = inflated
+		} else if bytes.Contains(dict, []byte("/Filter")) {
+			continue
+		}
+		if !isPDFTextStream(content) {
+			continue
+		}
+		if text := pdfContentText(content); strings.TrimSpace(text) != "" {
+			pages = append(pages, text)
+		}
+	}
+	return pages, nil
+}
+
+func zlibReader(data []byte) io.Reader {
+	r, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return bytes.NewReader(nil)
+	}
+	return r
+}
+
+// isPDFTextStream reports whether a decoded stream is page content with text,
+// rather than a font, image or object stream.
+func isPDFTextStream(content []byte) bool {
+	return bytes.Contains(content, []byte("BT")) && bytes.Contains(content, []byte("ET")) &&
+		(bytes.Contains(content, []byte("Tj")) || bytes.Contains(content, []byte("TJ")))
+}
+
+// pdfContentText interprets the text operators of a content stream. Each text
+// object, and each move to a new line within one, starts a new line.
+func pdfContentText(content []byte) string {
+	var out strings.Builder
+	var operands []string // strings since the last operator
+	inArray := false
+	wroteInObject := false
+
+	newline := func() {
+		if out.Len() > 0 && !strings.HasSuffix(out.String(), "\n") {
+			out.WriteByte('\n')
+		}
+	}
+
+	for i := 0; i < len(content); {
+		c := content[i]
+		switch {
+		case c == '%':
+			for i < len(content) && content[i] != '\n' && content[i] != '\r' {
+				i++
+			}
+		case c == '(':
+			s, next := readPDFLiteral(content, i)
+			operands = append(operands, s)
+			i = next
+		case c == '<' && i+1 < len(content) && content[i+1] == '<':
+			i += 2
+		case c == '>' && i+1 < len(content) && content[i+1] == '>':
+			i += 2
+		case c == '<':
+			end := bytes.IndexByte(content[i:], '>')
+			if end < 0 {
+				return out.String()
+			}
+			if s, ok := decodePDFHex(content[i+1 : i+end]); ok {
+				operands = append(operands, s)
+			}
+			i += end + 1
+		case c == '[':
+			inArray = true
+			i++
+		case c == ']':
+			inArray = false
+			i++
+		case c == '-' || c == '.' || (c >= '0' && c <= '9'):
+			start := i
+			for i < len(content) && (content[i] == '-' || content[i] == '.' || (content[i] >= '0' && content[i] <= '9')) {
+				i++
+			}
+			// A large negative adjustment inside TJ is a word gap
+			if inArray {
+				if n, err := strconv.ParseFloat(string(content[start:i]), 64); err == nil && n < -200 {
+					operands = append(operands, " ")
+				}
+			}
+		case isPDFOperatorByte(c):
+			start := i
+			for i < len(content) && isPDFOperatorByte(content[i]) {
+				i++
+			}
+			switch string(content[start:i]) {
+			case "BT":
+				newline()
+				wroteInObject = false
+			case "ET":
+				newline()
+			case "Td", "TD", "T*", "Tm":
+				if wroteInObject {
+					newline()
+				}
+			case "Tj", "TJ":
+				out.WriteString(strings.Join(operands, ""))
+				wroteInObject = true
+			case "'", "\"":
+				newline()
+				out.WriteString(strings.Join(operands, ""))
+				wroteInObject = true
+			}
+			operands = operands[:0]
+		default:
+			i++
+		}
+	}
+	return out.String()
+}
+
+func isPDFOperatorByte(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c == '*' || c == '\'' || c == '"'
+}
+
+// readPDFLiteral reads the literal string starting at content[start] == '(',
+// returning it and the index after its closing parenthesis.
+func readPDFLiteral(content []byte, start int) (string, int) {
+	var b strings.Builder
+	depth := 0
+	i := start
+	for i < len(content) {
+		c := content[i]
+		switch {
+		case c == '\\' && i+1 < len(content):
+			i++
+			switch e := content[i]; e {
+			case 'n':
+				b.WriteByte('\n')
+			case 'r':
+				b.WriteByte('\r')
+			case 't':
+				b.WriteByte('\t')
+			case 'b', 'f':
+			case '\r', '\n':
+				// Line continuation
+			default:
+				if e >= '0' && e <= '7' {
+					j := i
+					for j < len(content) && j < i+3 && content[j] >= '0' && content[j] <= '7' {
+						j++
+					}
+					n, _ := strconv.ParseUint(string(content[i:j]), 8, 8)
+					b.WriteByte(byte(n))
+					i = j
+					continue
+				}
+				b.WriteByte(e)
+			}
+		case c == '(':
+			if depth > 0 {
+				b.WriteByte(c)
+			}
+			depth++
+		case c == ')':
+			depth--
+			if depth == 0 {
+				return b.String(), i + 1
+			}
+			b.WriteByte(c)
+		default:
+			b.WriteByte(c)
+		}
+		i++
+	}
+	return b.String(), i
+}
+
+// decodePDFHex decodes a hex string, if it holds printable single-byte text
+// rather than glyph ids.
+func decodePDFHex(hex []byte) (string, bool) {
+	digits := strings.Map(func(r rune) rune {
+		if r == ' ' || r == '\n' || r == '\r' || r == '\t' {
+			return -1
+		}
+		return r
+	}, string(hex))
+	if len(digits)%2 == 1 {
+		digits += "0"
+	}
+	var b strings.Builder
+	for i := 0; i+1 < len(digits); i += 2 {
+		n, err := strconv.ParseUint(digits[i:i+2], 16, 8)
+		if err != nil || n < 0x20 || n > 0x7e {
+			return "", false
+		}
+		b.WriteByte(byte(n))
+	}
+	return b.String(), true
+}
@@ -0,0 +1,183 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.uber.org/zap"
+)
+
+// RetrievalRequest is the body of the /retrieval routes.
+type RetrievalRequest struct {
+	Path     string    `json:"path,omitempty"`     // /retrieval/ingest: a file or directory
+	Query    string    `json:"query,omitempty"`    // /retrieval/search and /retrieval/ask
+	Limit    int       `json:"limit,omitempty"`    // chunks to return or answer from
+	Since    time.Time `json:"since,omitempty"`    // only files modified since; /retrieval/ask also reads it from the question
+	Question string    `json:"question,omitempty"` // /retrieval/ask, if Query is empty
+}
+
+// OpenRetrievalIndex loads the configured index, embedding with loader when
+// its backend supports it.
+func OpenRetrievalIndex(config RetrievalConfig, loader *ModelLoader) (*RetrievalIndex, error) {
+	if config.IndexPath == "" {
+		return NewRetrievalIndex(loader), nil
+	}
+	return LoadRetrievalIndex(config.IndexPath, loader)
+}
+
+// IngestRetrievalSources ingests the configured source directories that
+// exist, and saves the index.
+func IngestRetrievalSources(ctx context.Context, config RetrievalConfig, index *RetrievalIndex, logger *zap.SugaredLogger) {
+	for _, dir := range config.Sources {
+		if _, err := os.Stat(dir); err != nil {
+			logger.Infow("Skipping retrieval source", "dir", dir, "error", err)
+			continue
+		}
+		stats, err := index.IngestDir(ctx, dir)
+		if err != nil {
+			logger.Errorw("Failed to ingest retrieval source", "dir", dir, "error", err)
+			continue
+		}
+		logger.Infow("Ingested retrieval source", "dir", dir, "files", stats.Files, "chunks", stats.Chunks, "embedded", stats.Embedded, "skipped", stats.Skipped)
+	}
+	if config.IndexPath != "" {
+		if err := index.Save(config.IndexPath); err != nil {
+			logger.Errorw("Failed to save retrieval index", "error", err)
+		}
+	}
+}
+
+// retrievalSourcePath resolves path and checks that it is one of the source
+// directories or lies under one. Symlinks are resolved first, so a link
+// can't lead out of the sources.
+func retrievalSourcePath(sources []string, path string) (string, error) {
+	if strings.TrimSpace(path) == "" {
+		return "", errors.New("path cannot be empty")
+	}
+	resolved, err := resolvePath(path)
+	if err != nil {
+		return "", err
+	}
+	for _, dir := range sources {
+		root, err := resolvePath(dir)
+		if err != nil {
+			continue
+		}
+		rel, err := filepath.Rel(root, resolved)
+		if err != nil {
+			continue
+		}
+		if rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return resolved, nil
+		}
+	}
+	return "", fmt.Errorf("%s is not under a configured retrieval source", path)
+}
+
+// resolvePath returns the clean absolute path with symlinks evaluated.
+func resolvePath(path string) (string, error) {
+	abs, err := filepath.Abs(filepath.Clean(path))
+	if err != nil {
+		return "", err
+	}
+	return filepath.EvalSymlinks(abs)
+}
+
+// SetupRetrievalRoutes adds the routes to ingest scan results and reports and
+// ask questions about them. Only paths under config.Sources can be ingested.
+//
+//	POST /retrieval/ingest => { "path": "ghostshell/reporting" }
+//	POST /retrieval/search => { "query": "rdp 10.0.0.5", "limit": 5 }
+//	POST /retrieval/ask    => { "question": "which hosts exposed RDP last week?" }
+func SetupRetrievalRoutes(app *fiber.App, loader *ModelLoader, index *RetrievalIndex, config RetrievalConfig, logger *zap.SugaredLogger) {
+	parse := func(c *fiber.Ctx) (*RetrievalRequest, error) {
+		var req RetrievalRequest
+		if err := c.BodyParser(&req); err != nil {
+			logger.Errorw("Failed to parse retrieval request", "error", err)
+			return nil, errors.New("Invalid request payload")
+		}
+		if req.Query == "" {
+			req.Query = req.Question
+		}
+		return &req, nil
+	}
+
+	app.Post("/retrieval/ingest", func(c *fiber.Ctx) error {
+		req, err := parse(c)
+		if err != nil {
+			return errorJSON(c, fiber.StatusBadRequest, err)
+		}
+		path, err := retrievalSourcePath(config.Sources, req.Path)
+		if err != nil {
+			logger.Warnw("Refused to ingest", "path", req.Path, "error", err)
+			return errorJSON(c, fiber.StatusForbidden, err)
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return errorJSON(c, fiber.StatusBadRequest, err)
+		}
+
+		var stats IngestStats
+		if info.IsDir() {
+			stats, err = index.IngestDir(c.Context(), path)
+		} else {
+			stats, err = index.IngestFile(c.Context(), path)
+		}
+		if err != nil {
+			logger.Errorw("Failed to ingest", "path", req.Path, "error", err)
+			return errorJSON(c, fiber.StatusInternalServerError, err)
+		}
+		if config.IndexPath != "" {
+			if err := index.Save(config.IndexPath); err != nil {
+				logger.Errorw("Failed to save retrieval index", "error", err)
+				return errorJSON(c, fiber.StatusInternalServerError, err)
+			}
+		}
+		logger.Infow("Ingested into retrieval index", "path", req.Path, "chunks", stats.Chunks)
+		return c.JSON(fiber.Map{
+			"status": "success",
+			"stats":  stats,
+			"total":  index.Len(),
+		})
+	})
+
+	app.Post("/retrieval/search", func(c *fiber.Ctx) error {
+		req, err := parse(c)
+		if err != nil {
+			return errorJSON(c, fiber.StatusBadRequest, err)
+		}
+		if strings.TrimSpace(req.Query) == "" {
+			return errorJSON(c, fiber.StatusBadRequest, errors.New("query cannot be empty"))
+		}
+		hits, err := index.Search(c.Context(), req.Query, SearchOptions{Limit: req.Limit, Since: req.Since})
+		if err != nil {
+			return errorJSON(c, fiber.StatusBadRequest, err)
+		}
+		return c.JSON(fiber.Map{
+			"status": "success",
+			"hits":   hits,
+		})
+	})
+
+	app.Post("/retrieval/ask", func(c *fiber.Ctx) error {
+		req, err := parse(c)
+		if err != nil {
+			return errorJSON(c, fiber.StatusBadRequest, err)
+		}
+		if strings.TrimSpace(req.Query) == "" {
+			return errorJSON(c, fiber.StatusBadRequest, errors.New("question cannot be empty"))
+		}
+		answer, err := index.Ask(c.Context(), loader, req.Query, SearchOptions{Limit: req.Limit, Since: req.Since})
+		if err != nil {
+			logger.Errorw("Failed to answer retrieval question", "error", err)
+			return errorJSON(c, fiber.StatusInternalServerError, err)
+		}
+		return c.JSON(answer)
+	})
+}
@@ -0,0 +1,258 @@
+package ai
+
+import (
+	"bytes"
+	"compress/zlib"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeReports writes scanner output like GhostShell's to a temporary
+// directory: an nmap CSV from this week, a CVE JSON from last month, and a
+// risk matrix PDF.
+func writeReports(t *testing.T) string {
+	dir := t.TempDir()
+	write := func(name, content string, age time.Duration) {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		modified := time.Now().Add(-age)
+		if err := os.Chtimes(path, modified, modified); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write("nmap_scan.csv", "host,port,service,state\n"+
+		"10.0.0.4,22/tcp,ssh,open\n"+
+		"10.0.0.5,3389/tcp,ms-wbt-server,open\n"+
+		"10.0.0.6,443/tcp,https,open\n", 2*24*time.Hour)
+	write("cvemap.json", `{"scan": "cvemap", "results": [
+		{"cve": "CVE-2019-0708", "product": "Remote Desktop Services", "host": "10.0.0.9", "port": 3389},
+		{"cve": "CVE-2021-44228", "product": "log4j", "host": "10.0.0.7"}
+	]}`, 40*24*time.Hour)
+	write("riskmatrix_report.pdf", string(testPDF(t, "Risk Matrix Report", "Host 10.0.0.8 allows anonymous FTP logins")), time.Hour)
+	write("notes.bin", "not indexed", 0)
+	return dir
+}
+
+// testPDF builds a one-page PDF with a Flate-compressed content stream, the
+// way gofpdf writes reports.
+func testPDF(t *testing.T, lines ...string) []byte {
+	var content bytes.Buffer
+	for i, line := range lines {
+		fmt.Fprintf(&content, "BT /F1 12 Tf 72 %d Td (%s) Tj ET\n", 720-20*i, line)
+	}
+	var compressed bytes.Buffer
+	w := zlib.NewWriter(&compressed)
+	w.Write(content.Bytes())
+	w.Close()
+
+	var pdf bytes.Buffer
+	pdf.WriteString("%PDF-1.3\n")
+	pdf.WriteString("1 0 obj\n<</Type /Catalog /Pages 2 0 R>>\nendobj\n")
+	fmt.Fprintf(&pdf, "3 0 obj\n<</Filter /FlateDecode /Length %d>>\nstream\n", compressed.Len())
+	pdf.Write(compressed.Bytes())
+	pdf.WriteString("\nendstream\nendobj\n%%EOF\n")
+	return pdf.Bytes()
+}
+
+type cannedAnswer struct {
+	text     string
+	messages []ChatMessage
+}
+
+func (m *cannedAnswer) Generate(ctx context.Context, messages []ChatMessage) (*GenerateResult, error) {
+	m.messages = messages
+	return &GenerateResult{Text: m.text}, nil
+}
+
+func TestRetrievalIngestAndSearch(t *testing.T) {
+	dir := writeReports(t)
+	index := NewRetrievalIndex(nil)
+	stats, err := index.IngestDir(context.Background(), dir)
+	if err != nil {
+		t.Fatalf("IngestDir: %v", err)
+	}
+	if stats.Files != 3 || stats.Chunks != 7 {
+		t.Errorf("expected 3 files in 7 chunks, got %+v", stats)
+	}
+
+	hits, err := index.Search(context.Background(), "which hosts exposed RDP", SearchOptions{})
+	if err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+	if len(hits) < 2 || hits[0].Chunk.Location != "row 2" || !strings.Contains(hits[0].Chunk.Text, "host: 10.0.0.5") {
+		t.Fatalf("expected the RDP row first, got %+v", hits)
+	}
+
+	hits, _ = index.Search(context.Background(), "anonymous ftp", SearchOptions{Limit: 1})
+	if len(hits) != 1 || hits[0].Chunk.Citation() != filepath.Join(dir, "riskmatrix_report.pdf")+", page 1" {
+		t.Errorf("expected the PDF page, got %+v", hits)
+	}
+
+	hits, _ = index.Search(context.Background(), "CVE-2021-44228", SearchOptions{Limit: 1})
+	if len(hits) != 1 || hits[0].Chunk.Location != "$.results[1]" {
+		t.Errorf("expected the log4j result, got %+v", hits)
+	}
+
+	// Unchanged files are skipped, and re-ingesting a file replaces its chunks
+	stats, _ = index.IngestDir(context.Background(), dir)
+	if stats.Skipped != 3 || stats.Chunks != 0 {
+		t.Errorf("expected unchanged files to be skipped, got %+v", stats)
+	}
+	if _, err := index.IngestFile(context.Background(), filepath.Join(dir, "nmap_scan.csv")); err != nil {
+		t.Fatalf("IngestFile: %v", err)
+	}
+	if index.Len() != 7 {
+		t.Errorf("re-ingesting duplicated chunks: %d", index.Len())
+	}
+}
+
+func TestRetrievalAskCitesSources(t *testing.T) {
+	dir := writeReports(t)
+	index := NewRetrievalIndex(nil)
+	if _, err := index.IngestDir(context.Background(), dir); err != nil {
+		t.Fatalf("IngestDir: %v", err)
+	}
+
+	model := &cannedAnswer{text: "10.0.0.5 exposed RDP on 3389/tcp [1]."}
+	answer, err := index.Ask(context.Background(), model, "Which hosts exposed RDP last week?", SearchOptions{})
+	if err != nil {
+		t.Fatalf("Ask: %v", err)
+	}
+	if answer.Since.IsZero() || time.Since(answer.Since) < 6*24*time.Hour {
+		t.Errorf("expected a filter from a week ago, got %v", answer.Since)
+	}
+	if len(answer.Citations) != 1 || answer.Citations[0].Location != "row 2" || filepath.Base(answer.Citations[0].Source) != "nmap_scan.csv" {
+		t.Errorf("unexpected citations %+v", answer.Citations)
+	}
+
+	// The CVE results are older than a week, so they aren't offered to the model
+	prompt := model.messages[len(model.messages)-1].Content
+	if !strings.Contains(prompt, "[1] "+filepath.Join(dir, "nmap_scan.csv")+", row 2") || strings.Contains(prompt, "CVE-2019-0708") {
+		t.Errorf("unexpected sources in prompt:\n%s", prompt)
+	}
+}
+
+// conceptEmbedder embeds text by the concepts it mentions, standing in for a
+// backend with an embeddings endpoint.
+type conceptEmbedder struct{}
+
+var embedConcepts = [][]string{
+	{"mstsc", "remote desktop", "3389", "ms-wbt-server"},
+	{"log4j", "log4shell"},
+	{"ssh", "openssh"},
+}
+
+func (conceptEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	vectors := make([][]float32, len(texts))
+	for i, text := range texts {
+		vectors[i] = make([]float32, len(embedConcepts))
+		for j, words := range embedConcepts {
+			for _, word := range words {
+				vectors[i][j] += float32(strings.Count(strings.ToLower(text), word))
+			}
+		}
+	}
+	return vectors, nil
+}
+
+func TestRetrievalVectorsAndPersistence(t *testing.T) {
+	dir := writeReports(t)
+	index := NewRetrievalIndex(conceptEmbedder{})
+	stats, err := index.IngestDir(context.Background(), dir)
+	if err != nil {
+		t.Fatalf("IngestDir: %v", err)
+	}
+	if stats.Embedded != stats.Chunks {
+		t.Errorf("expected every chunk embedded, got %+v", stats)
+	}
+
+	// No chunk contains "mstsc", so only vector similarity finds the RDP findings
+	hits, err := index.Search(context.Background(), "mstsc", SearchOptions{Limit: 2})
+	if err != nil {
+		t.Fatalf("Search: %v", err)
+	}
+	if len(hits) != 2 || !strings.Contains(hits[0].Chunk.Text, "3389") || !strings.Contains(hits[1].Chunk.Text, "3389") {
+		t.Errorf("expected the two RDP findings, got %+v", hits)
+	}
+
+	path := filepath.Join(t.TempDir(), "index", "retrieval.json")
+	if err := index.Save(path); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	loaded, err := LoadRetrievalIndex(path, conceptEmbedder{})
+	if err != nil {
+		t.Fatalf("LoadRetrievalIndex: %v", err)
+	}
+	if loaded.Len() != index.Len() {
+		t.Errorf("loaded %d chunks, saved %d", loaded.Len(), index.Len())
+	}
+	if stats, _ := loaded.IngestDir(context.Background(), dir); stats.Skipped != 3 {
+		t.Errorf("loaded index should know the files are unchanged, got %+v", stats)
+	}
+}
+
+func TestParseTimeHint(t *testing.T) {
+	now := time.Date(2026, 10, 18, 15, 0, 0, 0, time.UTC)
+	for question, want := range map[string]time.Time{
+		"which hosts exposed RDP last week":  now.AddDate(0, 0, -7),
+		"new CVEs in the past 3 days":        now.AddDate(0, 0, -3),
+		"what changed yesterday":             time.Date(2026, 10, 17, 0, 0, 0, 0, time.UTC),
+		"open ports on 10.0.0.5":             {},
+		"findings from last month, by host?": now.AddDate(0, -1, 0),
+	} {
+		got, _ := ParseTimeHint(question, now)
+		if !got.Equal(want) {
+			t.Errorf("ParseTimeHint(%q) = %v, want %v", question, got, want)
+		}
+	}
+}
+
+func TestRetrievalSourcePath(t *testing.T) {
+	dir := writeReports(t)
+	outside := t.TempDir()
+	secret := filepath.Join(outside, "secret.txt")
+	if err := os.WriteFile(secret, []byte("password"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, filepath.Join(dir, "escape")); err != nil {
+		t.Fatal(err)
+	}
+	sources := []string{dir}
+
+	for _, path := range []string{dir, filepath.Join(dir, "nmap_scan.csv"), dir + "/./"} {
+		if _, err := retrievalSourcePath(sources, path); err != nil {
+			t.Errorf("expected %s to be allowed: %v", path, err)
+		}
+	}
+	for _, path := range []string{
+		secret,
+		filepath.Join(dir, "..", filepath.Base(outside), "secret.txt"),
+		filepath.Join(dir, "escape", "secret.txt"),
+		filepath.Join(dir, "escape"),
+		"",
+	} {
+		if _, err := retrievalSourcePath(sources, path); err == nil {
+			t.Errorf("expected %s to be refused", path)
+		}
+	}
+
+	// A symlink inside a source is not followed when the directory is walked
+	index := NewRetrievalIndex(nil)
+	if err := os.Symlink(secret, filepath.Join(dir, "linked.txt")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := index.IngestDir(context.Background(), dir); err != nil {
+		t.Fatalf("IngestDir: %v", err)
+	}
+	if hits, _ := index.Search(context.Background(), "password", SearchOptions{}); len(hits) != 0 {
+		t.Errorf("expected the linked file to be skipped, got %+v", hits)
+	}
+}
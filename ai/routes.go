@@ -1,6 +1,8 @@
 package ai
 
 import (
+	"errors"
+
 	"github.com/gofiber/fiber/v2"
 	"go.uber.org/zap"
 )
@@ -25,7 +27,7 @@ func SetupRoutes(app *fiber.App, loader *ModelLoader, logger *zap.SugaredLogger)
 		logger.Info("Load model request received")
 		if err := loader.LoadModel(); err != nil {
 			logger.Errorw("Failed to load model", "error", err)
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			return c.Status(loadErrorStatus(err)).JSON(fiber.Map{
 				"status":  "error",
 				"message": err.Error(),
 			})
@@ -71,11 +73,30 @@ func SetupRoutes(app *fiber.App, loader *ModelLoader, logger *zap.SugaredLogger)
 		})
 	})
 
+	// List the models in the models directory, with their GGUF metadata
+	// GET /model/catalog
+	app.Get("/model/catalog", func(c *fiber.Ctx) error {
+		entries, err := loader.Catalog()
+		if err != nil {
+			logger.Errorw("Failed to refresh model catalog", "error", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"status":  "error",
+				"message": err.Error(),
+			})
+		}
+		return c.JSON(fiber.Map{
+			"status": "success",
+			"models": entries,
+		})
+	})
+
 	// Select a new model path (unload current, update config, load new)
 	// POST /model/select => { "model_path": "path/to/model.gguf" }
+	// or, from the catalog => { "model_hash": "3f2a9c1e" }
 	app.Post("/model/select", func(c *fiber.Ctx) error {
 		var req struct {
 			ModelPath string `json:"model_path"`
+			ModelHash string `json:"model_hash"`
 		}
 		if err := c.BodyParser(&req); err != nil {
 			logger.Errorw("Failed to parse JSON for model path", "error", err)
@@ -85,10 +106,16 @@ func SetupRoutes(app *fiber.App, loader *ModelLoader, logger *zap.SugaredLogger)
 			})
 		}
 
-		logger.Infow("Select model request", "model_path", req.ModelPath)
-		if err := loader.LoadSelectedModel(req.ModelPath); err != nil {
+		logger.Infow("Select model request", "model_path", req.ModelPath, "model_hash", req.ModelHash)
+		var err error
+		if req.ModelHash != "" {
+			err = loader.LoadModelByHash(req.ModelHash)
+		} else {
+			err = loader.LoadSelectedModel(req.ModelPath)
+		}
+		if err != nil {
 			logger.Errorw("Failed to select/load new model", "error", err)
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			return c.Status(loadErrorStatus(err)).JSON(fiber.Map{
 				"status":  "error",
 				"message": err.Error(),
 			})
@@ -100,13 +127,43 @@ func SetupRoutes(app *fiber.App, loader *ModelLoader, logger *zap.SugaredLogger)
 		})
 	})
 
+	// Check a model file against its signed manifest and the trust store
+	// POST /model/verify => { "model_path": "path/to/model.gguf" }
+	app.Post("/model/verify", func(c *fiber.Ctx) error {
+		var req struct {
+			ModelPath string `json:"model_path"`
+		}
+		if err := c.BodyParser(&req); err != nil || req.ModelPath == "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"status":  "error",
+				"message": "Invalid request payload",
+			})
+		}
+		manifest, err := VerifyModel(req.ModelPath, loader.TrustStore())
+		if err != nil {
+			logger.Warnw("Model failed verification", "model_path", req.ModelPath, "error", err)
+			return c.Status(loadErrorStatus(err)).JSON(fiber.Map{
+				"status":   "error",
+				"message":  err.Error(),
+				"manifest": manifest,
+			})
+		}
+		return c.JSON(fiber.Map{
+			"status":   "success",
+			"manifest": manifest,
+		})
+	})
+
 	// Update control parameters
-	// POST /model/control => { "temperature": 0.7, "max_tokens": 1024, "reload": true }
+	// POST /model/control => { "temperature": 0.7, "max_tokens": 1024, "top_p": 0.9, "top_k": 40, "reload": true }
+	// Omitted parameters keep their current values.
 	app.Post("/model/control", func(c *fiber.Ctx) error {
 		var req struct {
-			Temperature float64 `json:"temperature"`
-			MaxTokens   int     `json:"max_tokens"`
-			Reload      bool    `json:"reload"`
+			Temperature *float64 `json:"temperature"`
+			MaxTokens   *int     `json:"max_tokens"`
+			TopP        *float64 `json:"top_p"`
+			TopK        *int     `json:"top_k"`
+			Reload      bool     `json:"reload"`
 		}
 		if err := c.BodyParser(&req); err != nil {
 			logger.Errorw("Failed to parse JSON for control params", "error", err)
@@ -116,13 +173,22 @@ func SetupRoutes(app *fiber.App, loader *ModelLoader, logger *zap.SugaredLogger)
 			})
 		}
 
-		logger.Infow("Update control params request",
-			"temp", req.Temperature, "max_tokens", req.MaxTokens, "reload", req.Reload)
-
-		params := ControlParameters{
-			Temperature: req.Temperature,
-			MaxTokens:   req.MaxTokens,
+		params := loader.ControlParameters()
+		if req.Temperature != nil {
+			params.Temperature = *req.Temperature
+		}
+		if req.MaxTokens != nil {
+			params.MaxTokens = *req.MaxTokens
+		}
+		if req.TopP != nil {
+			params.TopP = *req.TopP
 		}
+		if req.TopK != nil {
+			params.TopK = *req.TopK
+		}
+		logger.Infow("Update control params request",
+			"temp", params.Temperature, "max_tokens", params.MaxTokens,
+			"top_p", params.TopP, "top_k", params.TopK, "reload", req.Reload)
 
 		if err := loader.SetControlParameters(params, req.Reload); err != nil {
 			logger.Errorw("Failed to update control parameters", "error", err)
@@ -151,8 +217,18 @@ func SetupRoutes(app *fiber.App, loader *ModelLoader, logger *zap.SugaredLogger)
 		return c.JSON(fiber.Map{
 			"status":         "active",
 			"message":        "Model is loaded and operational",
-			"model_path":     loader.config.ModelPath,
+			"model_path":     loader.modelName(),
+			"backend":        loader.model.Backend().Name(),
 			"control_params": loader.config.ControlParams,
 		})
 	})
 }
+
+// loadErrorStatus is the status for a failed load: 403 if the integrity
+// policy refused the model.
+func loadErrorStatus(err error) int {
+	if errors.Is(err, ErrModelUntrusted) {
+		return fiber.StatusForbidden
+	}
+	return fiber.StatusInternalServerError
+}
@@ -0,0 +1,66 @@
+package ai
+
+import (
+	"fmt"
+	"sync"
+	"unsafe"
+)
+
+// lockedBuffers records the buffers allocateSecureMemory locked, by their
+// first byte, so zeroizeMemory only unlocks memory it locked.
+var (
+	lockedBuffers   = make(map[*byte]int)
+	lockedBuffersMu sync.Mutex
+	lockWarning     sync.Once
+)
+
+// lockMemory locks buf into RAM; tests replace it to simulate failures.
+var lockMemory = mlock
+
+// allocateSecureMemory returns an n-byte buffer for key material, locked
+// into RAM so it never reaches swap. Where memory can't be locked, because
+// of RLIMIT_MEMLOCK, missing privileges or the platform, the buffer is
+// returned unlocked and a warning is logged once. It is released with
+// zeroizeMemory.
+func allocateSecureMemory(n int) ([]byte, error) {
+	buf := make([]byte, n)
+	if n == 0 {
+		return buf, nil
+	}
+	if err := lockMemory(buf); err != nil {
+		if !lockUnavailable(err) {
+			return nil, fmt.Errorf("failed to lock %d bytes: %w", n, err)
+		}
+		lockWarning.Do(func() {
+			logger.Warnw("Memory locking is unavailable, key material may be swapped to disk", "error", err)
+		})
+		return buf, nil
+	}
+
+	lockedBuffersMu.Lock()
+	lockedBuffers[unsafe.SliceData(buf)] = n
+	lockedBuffersMu.Unlock()
+	return buf, nil
+}
+
+// zeroizeMemory overwrites buf with zeros and unlocks it if it came from
+// allocateSecureMemory. Any other buffer, such as a decrypted model, is only
+// wiped.
+func zeroizeMemory(buf []byte) error {
+	if len(buf) == 0 {
+		return nil
+	}
+	clear(buf)
+
+	lockedBuffersMu.Lock()
+	n, locked := lockedBuffers[unsafe.SliceData(buf)]
+	delete(lockedBuffers, unsafe.SliceData(buf))
+	lockedBuffersMu.Unlock()
+	if !locked {
+		return nil
+	}
+	if err := munlock(buf[:n:n]); err != nil {
+		return fmt.Errorf("failed to unlock memory: %w", err)
+	}
+	return nil
+}
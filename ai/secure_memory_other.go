@@ -0,0 +1,21 @@
+//go:build !unix
+
+package ai
+
+import "errors"
+
+var errLockUnsupported = errors.New("memory locking is not supported on this platform")
+
+func mlock(buf []byte) error {
+	return errLockUnsupported
+}
+
+func munlock(buf []byte) error {
+	return nil
+}
+
+// lockUnavailable reports whether err means memory can't be locked here.
+// Nothing can be locked on this platform.
+func lockUnavailable(err error) bool {
+	return true
+}
@@ -0,0 +1,141 @@
+package ai
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+// lockedKB reads how much memory the process has locked from /proc.
+func lockedKB(t *testing.T) int {
+	t.Helper()
+	f, err := os.Open("/proc/self/status")
+	if err != nil {
+		t.Skipf("no /proc/self/status: %v", err)
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if value, ok := strings.CutPrefix(scanner.Text(), "VmLck:"); ok {
+			kb, err := strconv.Atoi(strings.TrimSuffix(strings.TrimSpace(value), " kB"))
+			if err != nil {
+				t.Fatalf("unexpected VmLck line %q", scanner.Text())
+			}
+			return kb
+		}
+	}
+	t.Skip("VmLck not reported")
+	return 0
+}
+
+func TestSecureMemoryLockedAndWiped(t *testing.T) {
+	before := lockedKB(t)
+	buf, err := allocateSecureMemory(1 << 20)
+	if err != nil {
+		t.Fatalf("allocateSecureMemory: %v", err)
+	}
+	lockedBuffersMu.Lock()
+	_, locked := lockedBuffers[&buf[0]]
+	lockedBuffersMu.Unlock()
+	if !locked {
+		zeroizeMemory(buf)
+		t.Skip("memory locking unavailable")
+	}
+	if locked := lockedKB(t) - before; locked < 1024 {
+		t.Errorf("expected 1024 kB more locked memory, got %d kB", locked)
+	}
+
+	copy(buf, "secret model bytes")
+	if err := zeroizeMemory(buf); err != nil {
+		t.Fatalf("zeroizeMemory: %v", err)
+	}
+	if !bytes.Equal(buf, make([]byte, len(buf))) {
+		t.Error("expected the buffer to be wiped")
+	}
+	if locked := lockedKB(t) - before; locked >= 1024 {
+		t.Errorf("expected the buffer to be unlocked, still %d kB locked", locked)
+	}
+
+	// Buffers that weren't locked are only wiped
+	key := []byte("key")
+	if err := zeroizeMemory(key); err != nil || !bytes.Equal(key, []byte{0, 0, 0}) {
+		t.Errorf("expected the key to be wiped, got %q, %v", key, err)
+	}
+}
+
+func TestSecureMemoryFallsBackUnlocked(t *testing.T) {
+	defer func(lock func([]byte) error) { lockMemory = lock }(lockMemory)
+
+	// Hitting RLIMIT_MEMLOCK still gives a usable, unlocked buffer
+	lockMemory = func([]byte) error { return syscall.ENOMEM }
+	buf, err := allocateSecureMemory(64)
+	if err != nil || len(buf) != 64 {
+		t.Fatalf("expected an unlocked buffer, got %d bytes, %v", len(buf), err)
+	}
+	lockedBuffersMu.Lock()
+	_, locked := lockedBuffers[&buf[0]]
+	lockedBuffersMu.Unlock()
+	if locked {
+		t.Error("expected the buffer not to be recorded as locked")
+	}
+	if err := zeroizeMemory(buf); err != nil {
+		t.Errorf("zeroizeMemory: %v", err)
+	}
+}
+
+func TestUnloadModelWipesModelAndKey(t *testing.T) {
+	dir := t.TempDir()
+	plain := filepath.Join(dir, "tiny.gguf")
+	path := plain + ".enc"
+	os.WriteFile(plain, testLlamaGGUF(3), 0600)
+	key := make([]byte, ModelKeySize)
+	if err := EncryptFile(plain, path, key); err != nil {
+		t.Fatalf("EncryptFile: %v", err)
+	}
+	t.Setenv("TEST_MODEL_KEY", hex.EncodeToString(key))
+
+	// Only the key goes into secure memory
+	var allocated [][]byte
+	defer func(lock func([]byte) error) { lockMemory = lock }(lockMemory)
+	lockMemory = func(buf []byte) error {
+		allocated = append(allocated, buf)
+		return syscall.EPERM
+	}
+
+	cfg := GetDefaultConfig()
+	cfg.ModelPath = path
+	cfg.Integrity = IntegrityConfig{Policy: IntegrityOff, KeyEnv: "TEST_MODEL_KEY"}
+	loader := &ModelLoader{config: cfg, logger: zap.NewNop(), trust: NewTrustStore()}
+
+	if err := loader.LoadModel(); err != nil {
+		t.Fatalf("LoadModel: %v", err)
+	}
+	if len(allocated) != 1 || len(allocated[0]) != ModelKeySize {
+		t.Fatalf("expected only the %d-byte key to be locked, got %d buffers", ModelKeySize, len(allocated))
+	}
+	if !bytes.Equal(allocated[0], make([]byte, ModelKeySize)) {
+		t.Error("expected the key to be wiped after decryption")
+	}
+	memory := loader.modelData
+	if string(memory[:4]) != "GGUF" {
+		t.Fatal("expected the decrypted model to be kept")
+	}
+
+	if err := loader.UnloadModel(); err != nil {
+		t.Fatalf("UnloadModel: %v", err)
+	}
+	if !bytes.Equal(memory, make([]byte, len(memory))) {
+		t.Error("expected the model memory to be wiped on unload")
+	}
+	if loader.modelData != nil {
+		t.Error("expected the model memory to be released on unload")
+	}
+}
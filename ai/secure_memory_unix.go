@@ -0,0 +1,23 @@
+//go:build unix
+
+package ai
+
+import (
+	"errors"
+
+	"golang.org/x/sys/unix"
+)
+
+func mlock(buf []byte) error {
+	return unix.Mlock(buf)
+}
+
+func munlock(buf []byte) error {
+	return unix.Munlock(buf)
+}
+
+// lockUnavailable reports whether err means memory can't be locked here,
+// rather than that something went wrong.
+func lockUnavailable(err error) bool {
+	return errors.Is(err, unix.EPERM) || errors.Is(err, unix.ENOMEM)
+}
@@ -1,6 +1,9 @@
 package ai
 
 import (
+	"context"
+	"crypto/subtle"
+	"errors"
 	"fmt"
 	"os"
 	"os/signal"
@@ -40,7 +43,7 @@ func StartServer(configPath string) {
 	defer logger.Sync()
 
 	// 1. Load the configuration file
-	config, err := LoadConfig(configPath)
+	config, err := LoadConfig(configPath, logger.Desugar())
 	if err != nil {
 		logger.Fatal("Failed to load configuration", zap.Error(err))
 	}
@@ -56,25 +59,39 @@ func StartServer(configPath string) {
 		logger.Fatal("Failed to initialize model loader", zap.Error(err))
 	}
 
-	// 4. Create a new Fiber app with additional configurations
+	// 4. Open the retrieval index and bring it up to date with the reports in the background
+	index, err := OpenRetrievalIndex(config.Retrieval, loader)
+	if err != nil {
+		logger.Fatal("Failed to open retrieval index", zap.Error(err))
+	}
+	go IngestRetrievalSources(context.Background(), config.Retrieval, index, logger)
+
+	// 5. Create a new Fiber app with additional configurations
+	//    Streamed generations can take minutes, so writes get a longer timeout
 	app := fiber.New(fiber.Config{
 		ReadTimeout:  10 * time.Second,
-		WriteTimeout: 10 * time.Second,
+		WriteTimeout: 10 * time.Minute,
 		IdleTimeout:  30 * time.Second,
 	})
 
-	// 5. Setup routes for the app
+	// 6. Setup routes for the app
 	//    We'll pass in the global logger (zap.SugaredLogger) and the loader
+	if config.AuthToken != "" {
+		app.Use(requireToken(config.AuthToken))
+	}
 	SetupRoutes(app, loader, logger)
+	SetupStreamRoutes(app, loader, logger)
+	SetupRetrievalRoutes(app, loader, index, config.Retrieval, logger)
+	SetupConversationRoutes(app, loader, NewConversationStore(config.Conversations.Dir), config.Templates, config.Conversations, logger)
 
 	// Graceful shutdown handling
 	go func() {
-		if err := app.Listen(":8080"); err != nil {
+		if err := app.Listen(config.Listen()); err != nil {
 			logger.Fatal("Failed to start server", zap.Error(err))
 		}
 	}()
 
-	logger.Info("Server started successfully on :8080")
+	logger.Info("Server started successfully on " + config.Listen())
 
 	// Handle OS signals for graceful shutdown
 	quit := make(chan os.Signal, 1)
@@ -88,3 +105,14 @@ func StartServer(configPath string) {
 
 	logger.Info("Server stopped gracefully")
 }
+
+// requireToken rejects requests that don't carry the bearer token.
+func requireToken(token string) fiber.Handler {
+	want := []byte("Bearer " + token)
+	return func(c *fiber.Ctx) error {
+		if subtle.ConstantTimeCompare([]byte(c.Get(fiber.HeaderAuthorization)), want) != 1 {
+			return errorJSON(c, fiber.StatusUnauthorized, errors.New("missing or invalid bearer token"))
+		}
+		return c.Next()
+	}
+}
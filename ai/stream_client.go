@@ -0,0 +1,145 @@
+package ai
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// StreamClient calls the server's streaming generation endpoints, for UI
+// panels that render tokens as they arrive.
+type StreamClient struct {
+	baseURL string
+	token   string
+	client  *http.Client
+}
+
+// NewStreamClient returns a client for the ai server at baseURL, e.g. http://127.0.0.1:8080.
+func NewStreamClient(baseURL string) *StreamClient {
+	return &StreamClient{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		client:  &http.Client{},
+	}
+}
+
+// SetToken sets the bearer token sent to a server that has auth_token set.
+func (sc *StreamClient) SetToken(token string) {
+	sc.token = token
+}
+
+func (sc *StreamClient) authorize(req *http.Request) {
+	if sc.token != "" {
+		req.Header.Set("Authorization", "Bearer "+sc.token)
+	}
+}
+
+// Generate streams a reply to req.Prompt, calling onEvent for each event. Cancel ctx to stop it.
+func (sc *StreamClient) Generate(ctx context.Context, req GenerateRequest, onEvent func(StreamEvent) error) (*GenerateResult, error) {
+	return sc.stream(ctx, "/v1/generate", req, onEvent)
+}
+
+// Chat streams a reply to req.Messages, calling onEvent for each event. Cancel ctx to stop it.
+func (sc *StreamClient) Chat(ctx context.Context, req GenerateRequest, onEvent func(StreamEvent) error) (*GenerateResult, error) {
+	return sc.stream(ctx, "/v1/chat", req, onEvent)
+}
+
+// Templates returns the server's prompt templates.
+func (sc *StreamClient) Templates(ctx context.Context) ([]PromptTemplate, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, sc.baseURL+"/templates", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	sc.authorize(httpReq)
+	resp, err := sc.client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("request to /templates failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("server returned %d %s", resp.StatusCode, http.StatusText(resp.StatusCode))
+	}
+	var body struct {
+		Templates []PromptTemplate `json:"templates"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("failed to decode templates: %w", err)
+	}
+	return body.Templates, nil
+}
+
+func (sc *StreamClient) stream(ctx context.Context, path string, req GenerateRequest, onEvent func(StreamEvent) error) (*GenerateResult, error) {
+	req.Stream = nil
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode request: %w", err)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, sc.baseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Accept", "text/event-stream")
+	sc.authorize(httpReq)
+
+	resp, err := sc.client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("request to %s failed: %w", path, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+		var errBody struct {
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(data, &errBody) == nil && errBody.Message != "" {
+			return nil, fmt.Errorf("server returned %d: %s", resp.StatusCode, errBody.Message)
+		}
+		return nil, fmt.Errorf("server returned %d %s", resp.StatusCode, http.StatusText(resp.StatusCode))
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	var data strings.Builder
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line != "" {
+			// The event name is repeated in the data, and comments are keep-alives
+			if strings.HasPrefix(line, "data:") {
+				data.WriteString(strings.TrimSpace(strings.TrimPrefix(line, "data:")))
+			}
+			continue
+		}
+		if data.Len() == 0 {
+			continue
+		}
+
+		var ev StreamEvent
+		if err := json.Unmarshal([]byte(data.String()), &ev); err != nil {
+			return nil, fmt.Errorf("failed to decode event: %w", err)
+		}
+		data.Reset()
+		if onEvent != nil {
+			if err := onEvent(ev); err != nil {
+				return nil, err
+			}
+		}
+		switch ev.Type {
+		case "done":
+			return ev.Result, nil
+		case "error":
+			return nil, errors.New(ev.Message)
+		case "cancelled":
+			return nil, context.Canceled
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read stream: %w", err)
+	}
+	return nil, errors.New("stream ended before the generation finished")
+}
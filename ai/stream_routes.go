@@ -0,0 +1,393 @@
+package ai
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/contrib/websocket"
+	"github.com/gofiber/fiber/v2"
+	"go.uber.org/zap"
+)
+
+// GenerateRequest is the body of POST /v1/generate and /v1/chat, and each
+// message sent over their WebSockets. Parameters left out use the loader's
+// configured control parameters.
+type GenerateRequest struct {
+	Prompt   string        `json:"prompt,omitempty"`   // /v1/generate
+	System   string        `json:"system,omitempty"`   // optional system message for /v1/generate
+	Messages []ChatMessage `json:"messages,omitempty"` // /v1/chat
+	Stream   *bool         `json:"stream,omitempty"`   // POST only; false replies with one JSON object
+
+	Temperature *float64 `json:"temperature,omitempty"`
+	MaxTokens   *int     `json:"max_tokens,omitempty"`
+	TopP        *float64 `json:"top_p,omitempty"`
+	TopK        *int     `json:"top_k,omitempty"`
+}
+
+// ControlParameters applies the request's overrides to base and validates the result.
+func (r *GenerateRequest) ControlParameters(base ControlParameters) (ControlParameters, error) {
+	if r.Temperature != nil {
+		base.Temperature = *r.Temperature
+	}
+	if r.MaxTokens != nil {
+		base.MaxTokens = *r.MaxTokens
+	}
+	if r.TopP != nil {
+		base.TopP = *r.TopP
+	}
+	if r.TopK != nil {
+		base.TopK = *r.TopK
+	}
+	return base, base.Validate()
+}
+
+// ChatMessages returns the conversation to generate from: the prompt for
+// /v1/generate, or the messages for /v1/chat.
+func (r *GenerateRequest) ChatMessages(chat bool) ([]ChatMessage, error) {
+	if chat {
+		if len(r.Messages) == 0 {
+			return nil, errors.New("messages cannot be empty")
+		}
+		return r.Messages, nil
+	}
+	if strings.TrimSpace(r.Prompt) == "" {
+		return nil, errors.New("prompt cannot be empty")
+	}
+	messages := make([]ChatMessage, 0, 2)
+	if r.System != "" {
+		messages = append(messages, ChatMessage{Role: "system", Content: r.System})
+	}
+	return append(messages, ChatMessage{Role: "user", Content: r.Prompt}), nil
+}
+
+// prepare returns the conversation and control parameters to generate with.
+func (r *GenerateRequest) prepare(chat bool, loader *ModelLoader) ([]ChatMessage, ControlParameters, error) {
+	messages, err := r.ChatMessages(chat)
+	if err != nil {
+		return nil, ControlParameters{}, err
+	}
+	params, err := r.ControlParameters(loader.ControlParameters())
+	if err != nil {
+		return nil, ControlParameters{}, err
+	}
+	return messages, params, nil
+}
+
+// StreamEvent is one Server-Sent Event or WebSocket frame of a streamed
+// generation. Over SSE, Type is the event name and the rest is the data.
+type StreamEvent struct {
+	Type    string             `json:"type"`              // "queued", "token", "done", "error" or "cancelled"
+	Content string             `json:"content,omitempty"` // token
+	Result  *GenerateResult    `json:"result,omitempty"`  // done
+	Params  *ControlParameters `json:"params,omitempty"`  // done: the parameters the reply was generated with
+	Message string             `json:"message,omitempty"` // error
+}
+
+const (
+	// sseKeepAlive is how often a comment is written to a queued SSE client,
+	// so a client that has gone away is noticed and dequeued.
+	sseKeepAlive = 2 * time.Second
+)
+
+// SetupStreamRoutes adds the generation endpoints. POST streams tokens as
+// Server-Sent Events; GET upgrades to a WebSocket.
+//
+//	POST /v1/generate => { "prompt": "...", "temperature": 0.2 }
+//	POST /v1/chat     => { "messages": [{"role": "user", "content": "..."}] }
+//	GET  /v1/generate, /v1/chat (WebSocket) => one request per message; send {"type": "cancel"} to stop
+func SetupStreamRoutes(app *fiber.App, loader *ModelLoader, logger *zap.SugaredLogger) {
+	limiter := NewRequestLimiter(loader.config.MaxConcurrentRequests, loader.config.MaxQueuedRequests)
+
+	for _, route := range []struct {
+		path string
+		chat bool
+	}{
+		{"/v1/generate", false},
+		{"/v1/chat", true},
+	} {
+		app.Post(route.path, postGenerateHandler(loader, limiter, route.chat, logger))
+		app.Get(route.path, func(c *fiber.Ctx) error {
+			if !websocket.IsWebSocketUpgrade(c) {
+				return fiber.ErrUpgradeRequired
+			}
+			return c.Next()
+		}, websocket.New(wsGenerateHandler(loader, limiter, route.chat, logger)))
+	}
+
+	app.Get("/v1/queue", func(c *fiber.Ctx) error {
+		running, queued := limiter.Stats()
+		return c.JSON(fiber.Map{
+			"status":  "success",
+			"running": running,
+			"queued":  queued,
+		})
+	})
+}
+
+func errorJSON(c *fiber.Ctx, status int, err error) error {
+	return c.Status(status).JSON(fiber.Map{
+		"status":  "error",
+		"message": err.Error(),
+	})
+}
+
+// postGenerateHandler streams a generation as Server-Sent Events, or replies
+// with the complete result if the request sets "stream": false.
+func postGenerateHandler(loader *ModelLoader, limiter *RequestLimiter, chat bool, logger *zap.SugaredLogger) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var req GenerateRequest
+		if err := c.BodyParser(&req); err != nil {
+			logger.Errorw("Failed to parse generate request", "error", err)
+			return errorJSON(c, fiber.StatusBadRequest, errors.New("Invalid request payload"))
+		}
+		messages, params, err := req.prepare(chat, loader)
+		if err != nil {
+			return errorJSON(c, fiber.StatusBadRequest, err)
+		}
+
+		ticket, err := limiter.Enqueue()
+		if err != nil {
+			logger.Warnw("Rejected generate request", "error", err)
+			return errorJSON(c, fiber.StatusTooManyRequests, err)
+		}
+
+		if req.Stream != nil && !*req.Stream {
+			// fasthttp doesn't report a client that hangs up, so the
+			// configured timeout bounds the wait and the generation instead
+			ctx, cancel := requestContext(loader.config)
+			defer cancel()
+			release, err := ticket.Wait(ctx)
+			if err != nil {
+				return errorJSON(c, timeoutStatus(err, fiber.StatusServiceUnavailable), err)
+			}
+			defer release()
+			res, err := loader.GenerateWith(ctx, messages, params)
+			if err != nil {
+				logger.Errorw("Generation failed", "error", err)
+				return errorJSON(c, timeoutStatus(err, fiber.StatusInternalServerError), err)
+			}
+			return c.JSON(res)
+		}
+
+		c.Set(fiber.HeaderContentType, "text/event-stream")
+		c.Set(fiber.HeaderCacheControl, "no-cache")
+		c.Set(fiber.HeaderConnection, "keep-alive")
+		c.Set("X-Accel-Buffering", "no")
+		c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+			streamSSE(w, loader, ticket, messages, params, logger)
+		})
+		return nil
+	}
+}
+
+// requestContext bounds a request that doesn't stream by the configured
+// request timeout.
+func requestContext(config *Config) (context.Context, context.CancelFunc) {
+	if config.RequestTimeoutSeconds <= 0 {
+		return context.WithCancel(context.Background())
+	}
+	return context.WithTimeout(context.Background(), time.Duration(config.RequestTimeoutSeconds)*time.Second)
+}
+
+// timeoutStatus is 504 for an error caused by the request timeout, and status otherwise.
+func timeoutStatus(err error, status int) int {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return fiber.StatusGatewayTimeout
+	}
+	return status
+}
+
+// streamSSE runs a queued generation, writing its events to w. A failed write
+// means the client has gone, which cancels the generation or its place in
+// the queue.
+func streamSSE(w *bufio.Writer, loader *ModelLoader, ticket *Ticket, messages []ChatMessage, params ControlParameters, logger *zap.SugaredLogger) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	defer ticket.Cancel()
+
+	if writeSSE(w, StreamEvent{Type: "queued"}) != nil {
+		return
+	}
+
+	type waitResult struct {
+		release func()
+		err     error
+	}
+	waited := make(chan waitResult, 1)
+	go func() {
+		release, err := ticket.Wait(ctx)
+		waited <- waitResult{release, err}
+	}()
+
+	keepAlive := time.NewTicker(sseKeepAlive)
+	defer keepAlive.Stop()
+	var slot waitResult
+wait:
+	for {
+		select {
+		case slot = <-waited:
+			break wait
+		case <-keepAlive.C:
+			if _, err := w.WriteString(": waiting\n\n"); err != nil || w.Flush() != nil {
+				cancel()
+				if slot = <-waited; slot.release != nil {
+					slot.release()
+				}
+				return
+			}
+		}
+	}
+	if slot.err != nil {
+		writeSSE(w, StreamEvent{Type: "error", Message: slot.err.Error()})
+		return
+	}
+	defer slot.release()
+
+	res, err := loader.StreamWith(ctx, messages, params, func(token string) error {
+		if err := writeSSE(w, StreamEvent{Type: "token", Content: token}); err != nil {
+			cancel()
+			return err
+		}
+		return nil
+	})
+	switch {
+	case ctx.Err() != nil:
+		logger.Info("Streamed generation cancelled by client")
+	case err != nil:
+		logger.Errorw("Streamed generation failed", "error", err)
+		writeSSE(w, StreamEvent{Type: "error", Message: err.Error()})
+	default:
+		writeSSE(w, StreamEvent{Type: "done", Result: res, Params: &params})
+	}
+}
+
+// writeSSE writes and flushes one event. An error means the client has disconnected.
+func writeSSE(w *bufio.Writer, ev StreamEvent) error {
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", ev.Type, data); err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+// wsMessage is a frame from a WebSocket client: a GenerateRequest, or
+// {"type": "cancel"} to stop the running generation.
+type wsMessage struct {
+	Type string `json:"type,omitempty"`
+	GenerateRequest
+}
+
+// wsGenerateHandler serves one generation at a time per connection. Closing
+// the connection cancels the running generation.
+func wsGenerateHandler(loader *ModelLoader, limiter *RequestLimiter, chat bool, logger *zap.SugaredLogger) func(*websocket.Conn) {
+	return func(conn *websocket.Conn) {
+		var writeMu sync.Mutex
+		send := func(ev StreamEvent) error {
+			writeMu.Lock()
+			defer writeMu.Unlock()
+			return conn.WriteJSON(ev)
+		}
+
+		incoming := make(chan wsMessage)
+		go func() {
+			defer close(incoming)
+			for {
+				var msg wsMessage
+				if err := conn.ReadJSON(&msg); err != nil {
+					return
+				}
+				incoming <- msg
+			}
+		}()
+
+		// The generation in progress, if any
+		type generation struct {
+			cancel context.CancelFunc
+			done   chan struct{}
+		}
+		var current *generation
+		defer func() {
+			if current != nil {
+				current.cancel()
+				<-current.done
+			}
+		}()
+
+		for {
+			var done chan struct{}
+			if current != nil {
+				done = current.done
+			}
+			select {
+			case <-done:
+				current = nil
+			case msg, ok := <-incoming:
+				if !ok {
+					return
+				}
+				if msg.Type == "cancel" {
+					if current != nil {
+						current.cancel()
+					}
+					continue
+				}
+				if current != nil {
+					send(StreamEvent{Type: "error", Message: "a generation is already running on this connection"})
+					continue
+				}
+
+				messages, params, err := msg.prepare(chat, loader)
+				if err != nil {
+					send(StreamEvent{Type: "error", Message: err.Error()})
+					continue
+				}
+				ctx, cancel := context.WithCancel(context.Background())
+				current = &generation{cancel: cancel, done: make(chan struct{})}
+				go func(g *generation) {
+					defer close(g.done)
+					defer cancel()
+					streamWS(ctx, send, loader, limiter, messages, params, logger)
+				}(current)
+			}
+		}
+	}
+}
+
+// streamWS runs one generation for a WebSocket client, sending its events.
+func streamWS(ctx context.Context, send func(StreamEvent) error, loader *ModelLoader, limiter *RequestLimiter, messages []ChatMessage, params ControlParameters, logger *zap.SugaredLogger) {
+	ticket, err := limiter.Enqueue()
+	if err != nil {
+		send(StreamEvent{Type: "error", Message: err.Error()})
+		return
+	}
+	send(StreamEvent{Type: "queued"})
+	release, err := ticket.Wait(ctx)
+	if err != nil {
+		send(StreamEvent{Type: "cancelled"})
+		return
+	}
+	defer release()
+
+	res, err := loader.StreamWith(ctx, messages, params, func(token string) error {
+		return send(StreamEvent{Type: "token", Content: token})
+	})
+	switch {
+	case ctx.Err() != nil:
+		logger.Info("WebSocket generation cancelled by client")
+		send(StreamEvent{Type: "cancelled"})
+	case err != nil:
+		logger.Errorw("WebSocket generation failed", "error", err)
+		send(StreamEvent{Type: "error", Message: err.Error()})
+	default:
+		send(StreamEvent{Type: "done", Result: res, Params: &params})
+	}
+}
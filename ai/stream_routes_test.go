@@ -0,0 +1,282 @@
+package ai
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fasthttp/websocket"
+	"github.com/gofiber/fiber/v2"
+	"go.uber.org/zap"
+)
+
+// newStreamServer serves the stream routes on a local port, generating with
+// the simulated backend.
+func newStreamServer(t *testing.T, middleware ...fiber.Handler) string {
+	return newStreamServerWith(t, GetDefaultConfig(), middleware...)
+}
+
+// newStreamServerWith is newStreamServer with a given config.
+func newStreamServerWith(t *testing.T, cfg *Config, middleware ...fiber.Handler) string {
+	lm, err := NewLanguageModel(cfg.ModelPath)
+	if err != nil {
+		t.Fatalf("NewLanguageModel: %v", err)
+	}
+	if err := lm.LoadModel(); err != nil {
+		t.Fatalf("LoadModel: %v", err)
+	}
+	loader := &ModelLoader{config: cfg, model: lm, logger: zap.NewNop()}
+
+	app := fiber.New(fiber.Config{DisableStartupMessage: true})
+	for _, m := range middleware {
+		app.Use(m)
+	}
+	SetupStreamRoutes(app, loader, zap.NewNop().Sugar())
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	go app.Listener(ln)
+	t.Cleanup(func() { app.Shutdown() })
+	return "http://" + ln.Addr().String()
+}
+
+func queueStats(t *testing.T, base string) (running, queued int) {
+	resp, err := http.Get(base + "/v1/queue")
+	if err != nil {
+		t.Fatalf("GET /v1/queue: %v", err)
+	}
+	defer resp.Body.Close()
+	var body struct {
+		Running int `json:"running"`
+		Queued  int `json:"queued"`
+	}
+	json.NewDecoder(resp.Body).Decode(&body)
+	return body.Running, body.Queued
+}
+
+func TestStreamSSE(t *testing.T) {
+	base := newStreamServer(t)
+	client := NewStreamClient(base)
+
+	temperature := 0.2
+	var events []string
+	var tokens strings.Builder
+	res, err := client.Generate(context.Background(), GenerateRequest{Prompt: "hello", Temperature: &temperature}, func(ev StreamEvent) error {
+		events = append(events, ev.Type)
+		tokens.WriteString(ev.Content)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	if events[0] != "queued" || events[1] != "token" || events[len(events)-1] != "done" {
+		t.Errorf("unexpected events %v", events)
+	}
+	if tokens.String() != res.Text || !strings.Contains(res.Text, "temperature=0.20") {
+		t.Errorf("tokens %q don't make up the result %q", tokens.String(), res.Text)
+	}
+
+	badTopP := 2.0
+	_, err = client.Chat(context.Background(), GenerateRequest{Messages: []ChatMessage{{Role: "user", Content: "hi"}}, TopP: &badTopP}, nil)
+	if err == nil || !strings.Contains(err.Error(), "400") {
+		t.Errorf("expected a 400 for an invalid override, got %v", err)
+	}
+}
+
+func TestStreamRequiresToken(t *testing.T) {
+	base := newStreamServer(t, requireToken("s3cret"))
+	client := NewStreamClient(base)
+
+	if _, err := client.Generate(context.Background(), GenerateRequest{Prompt: "hello"}, nil); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("expected a 401 without the token, got %v", err)
+	}
+	client.SetToken("s3cret")
+	if _, err := client.Generate(context.Background(), GenerateRequest{Prompt: "hello"}, nil); err != nil {
+		t.Errorf("Generate with the token: %v", err)
+	}
+
+	cfg := GetDefaultConfig()
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("the default config should listen on loopback without a token: %v", err)
+	}
+	cfg.ListenAddr = ":8080"
+	if err := cfg.Validate(); err == nil {
+		t.Error("expected listening on all interfaces without a token to be refused")
+	}
+	cfg.AuthToken = "s3cret"
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("expected a token to allow any address: %v", err)
+	}
+}
+
+func TestStreamSSECancel(t *testing.T) {
+	base := newStreamServer(t)
+	client := NewStreamClient(base)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	_, err := client.Generate(ctx, GenerateRequest{Prompt: "hello"}, func(ev StreamEvent) error {
+		if ev.Type == "token" {
+			cancel()
+		}
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected cancellation, got %v", err)
+	}
+
+	// The server notices the client has gone and frees the slot
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		if running, _ := queueStats(t, base); running == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("generation still running after the client cancelled")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func TestGenerateWithoutStreaming(t *testing.T) {
+	base := newStreamServer(t)
+
+	body := `{"prompt": "hello", "stream": false, "max_tokens": 7}`
+	resp, err := http.Post(base+"/v1/generate", "application/json", bytes.NewBufferString(body))
+	if err != nil {
+		t.Fatalf("POST: %v", err)
+	}
+	defer resp.Body.Close()
+	var res GenerateResult
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK || !strings.Contains(res.Text, "max_tokens=7") {
+		t.Errorf("unexpected reply %d %+v", resp.StatusCode, res)
+	}
+}
+
+func TestGenerateWithoutStreamingTimeout(t *testing.T) {
+	cfg := GetDefaultConfig()
+	cfg.MaxConcurrentRequests = 1
+	cfg.RequestTimeoutSeconds = 1
+	base := newStreamServerWith(t, cfg)
+
+	// A long streamed generation holds the only slot
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	started := make(chan struct{})
+	go NewStreamClient(base).Generate(ctx, GenerateRequest{Prompt: strings.Repeat("word ", 200)}, func(ev StreamEvent) error {
+		if ev.Type == "token" {
+			select {
+			case <-started:
+			default:
+				close(started)
+			}
+		}
+		return nil
+	})
+	select {
+	case <-started:
+	case <-time.After(3 * time.Second):
+		t.Fatal("streamed generation did not start")
+	}
+
+	start := time.Now()
+	body := `{"prompt": "hello", "stream": false}`
+	resp, err := http.Post(base+"/v1/generate", "application/json", bytes.NewBufferString(body))
+	if err != nil {
+		t.Fatalf("POST: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusGatewayTimeout {
+		t.Errorf("expected 504 once the request timeout passed, got %d", resp.StatusCode)
+	}
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("request took %v with a 1s timeout", elapsed)
+	}
+	if _, queued := queueStats(t, base); queued != 0 {
+		t.Errorf("timed out request still queued: %d", queued)
+	}
+}
+
+func TestStreamWebSocket(t *testing.T) {
+	base := newStreamServer(t)
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(base, "http")+"/v1/chat", nil)
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	defer conn.Close()
+
+	readUntil := func(want string) []StreamEvent {
+		var seen []StreamEvent
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		for {
+			var ev StreamEvent
+			if err := conn.ReadJSON(&ev); err != nil {
+				t.Fatalf("waiting for %s: %v (after %v)", want, err, seen)
+			}
+			seen = append(seen, ev)
+			if ev.Type == want {
+				return seen
+			}
+		}
+	}
+
+	request := map[string]interface{}{"messages": []ChatMessage{{Role: "user", Content: "hi"}}}
+	conn.WriteJSON(request)
+	readUntil("token")
+	conn.WriteJSON(map[string]string{"type": "cancel"})
+	readUntil("cancelled")
+
+	// The connection stays usable for the next request
+	conn.WriteJSON(request)
+	events := readUntil("done")
+	if res := events[len(events)-1].Result; res == nil || res.CompletionTokens == 0 {
+		t.Errorf("expected a result with the done event, got %+v", events[len(events)-1])
+	}
+}
+
+func TestRequestLimiter(t *testing.T) {
+	l := NewRequestLimiter(1, 1)
+	release, err := l.Acquire(context.Background())
+	if err != nil {
+		t.Fatalf("Acquire: %v", err)
+	}
+	waiting, err := l.Enqueue()
+	if err != nil {
+		t.Fatalf("Enqueue: %v", err)
+	}
+	if _, err := l.Enqueue(); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("expected ErrQueueFull, got %v", err)
+	}
+	if running, queued := l.Stats(); running != 1 || queued != 1 {
+		t.Errorf("expected 1 running and 1 queued, got %d and %d", running, queued)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := waiting.Wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the wait to time out, got %v", err)
+	}
+	if _, queued := l.Stats(); queued != 0 {
+		t.Errorf("timed out ticket still queued")
+	}
+
+	waiting, _ = l.Enqueue()
+	release()
+	next, err := waiting.Wait(context.Background())
+	if err != nil {
+		t.Fatalf("Wait after release: %v", err)
+	}
+	next()
+	if running, queued := l.Stats(); running != 0 || queued != 0 {
+		t.Errorf("expected an idle limiter, got %d running and %d queued", running, queued)
+	}
+}
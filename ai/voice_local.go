@@ -0,0 +1,187 @@
+package ai
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// transcribeSampleRate is the rate audio is converted to before transcription,
+// the rate whisper.cpp requires.
+const transcribeSampleRate = 16000
+
+// LocalSpeech runs offline speech engines as commands, such as piper for
+// synthesis and whisper.cpp for transcription. Nothing leaves the machine.
+//
+// Command arguments may use these placeholders:
+//
+//	{text}   the text to speak (it is also written to the command's stdin)
+//	{input}  a WAV file holding the audio to transcribe
+//	{output} a WAV file the command writes its speech to; without it, the
+//	         speech is read as WAV from stdout
+type LocalSpeech struct {
+	synthesize []string
+	transcribe []string
+	timeout    time.Duration
+	logger     *zap.Logger
+}
+
+// NewLocalSpeech returns an engine running the commands in config.
+func NewLocalSpeech(config VoiceConfig, logger *zap.Logger) (*LocalSpeech, error) {
+	if len(config.SynthesizeCommand) == 0 && len(config.TranscribeCommand) == 0 {
+		return nil, errors.New("local speech needs a synthesize or transcribe command")
+	}
+	timeout := time.Duration(config.TimeoutSeconds) * time.Second
+	if timeout <= 0 {
+		timeout = time.Minute
+	}
+	return &LocalSpeech{
+		synthesize: config.SynthesizeCommand,
+		transcribe: config.TranscribeCommand,
+		timeout:    timeout,
+		logger:     logger,
+	}, nil
+}
+
+// Synthesize runs the synthesize command with text on stdin.
+func (ls *LocalSpeech) Synthesize(ctx context.Context, text string) (*Audio, error) {
+	if len(ls.synthesize) == 0 {
+		return nil, fmt.Errorf("no synthesize command is configured: %w", ErrSpeechUnsupported)
+	}
+	if strings.TrimSpace(text) == "" {
+		return nil, errors.New("text cannot be empty")
+	}
+
+	dir, err := os.MkdirTemp("", "ghostshell-speech-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+	output := filepath.Join(dir, "speech.wav")
+
+	args, usesOutput := expandSpeechArgs(ls.synthesize, "{text}", text, "{output}", output)
+	stdout, err := ls.run(ctx, args, text)
+	if err != nil {
+		return nil, err
+	}
+
+	var wav []byte
+	if usesOutput {
+		if wav, err = os.ReadFile(output); err != nil {
+			return nil, fmt.Errorf("%s did not write its output: %w", args[0], err)
+		}
+	} else {
+		wav = stdout
+	}
+	audio, err := DecodeWAV(bytes.NewReader(wav))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read speech from %s: %w", args[0], err)
+	}
+	return audio, nil
+}
+
+// Transcribe writes audio to a 16 kHz mono WAV file and runs the transcribe
+// command on it, returning what it prints.
+func (ls *LocalSpeech) Transcribe(ctx context.Context, audio *Audio) (string, error) {
+	if len(ls.transcribe) == 0 {
+		return "", fmt.Errorf("no transcribe command is configured: %w", ErrSpeechUnsupported)
+	}
+
+	dir, err := os.MkdirTemp("", "ghostshell-speech-")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+	input := filepath.Join(dir, "input.wav")
+
+	f, err := os.Create(input)
+	if err != nil {
+		return "", fmt.Errorf("failed to create audio file: %w", err)
+	}
+	err = EncodeWAV(f, audio.Resample(transcribeSampleRate))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to write audio file: %w", err)
+	}
+
+	args, _ := expandSpeechArgs(ls.transcribe, "{input}", input)
+	stdout, err := ls.run(ctx, args, "")
+	if err != nil {
+		return "", err
+	}
+	return cleanTranscript(string(stdout)), nil
+}
+
+// run runs a command, returning its stdout. Its stderr is included in errors.
+func (ls *LocalSpeech) run(ctx context.Context, args []string, stdin string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, ls.timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Stdin = strings.NewReader(stdin)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	start := time.Now()
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("%s timed out: %w", args[0], ctx.Err())
+		}
+		return nil, fmt.Errorf("%s failed: %w: %s", args[0], err, strings.TrimSpace(lastLines(stderr.String(), 5)))
+	}
+	ls.logger.Debug("Ran speech command", zap.String("command", args[0]), zap.Duration("duration", time.Since(start)))
+	return stdout.Bytes(), nil
+}
+
+// expandSpeechArgs replaces the placeholder, value pairs in args, reporting
+// whether {output} was used. Each argument is expanded in a single pass, so
+// a value containing a placeholder is not expanded again.
+func expandSpeechArgs(args []string, oldnew ...string) ([]string, bool) {
+	replacer := strings.NewReplacer(oldnew...)
+	expanded := make([]string, len(args))
+	usesOutput := false
+	for i, arg := range args {
+		if strings.Contains(arg, "{output}") {
+			usesOutput = true
+		}
+		expanded[i] = replacer.Replace(arg)
+	}
+	return expanded, usesOutput
+}
+
+// cleanTranscript joins a recognizer's output lines, dropping blank lines,
+// whisper.cpp's [00:00:00.000 --> ...] timestamps and markers like [BLANK_AUDIO].
+func cleanTranscript(out string) string {
+	var words []string
+	for _, line := range strings.Split(out, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "[") {
+			if end := strings.Index(line, "]"); end >= 0 {
+				line = strings.TrimSpace(line[end+1:])
+			}
+		}
+		if line != "" {
+			words = append(words, line)
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+func lastLines(s string, n int) string {
+	lines := strings.Split(strings.TrimRight(s, "\n"), "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return strings.Join(lines, "\n")
+}
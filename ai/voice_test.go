@@ -0,0 +1,238 @@
+package ai
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestWAVRoundTrip(t *testing.T) {
+	audio := &Audio{SampleRate: 22050, Channels: 2, Samples: []int16{0, 1, -1, 32767, -32768, 1000}}
+	var buf bytes.Buffer
+	if err := EncodeWAV(&buf, audio); err != nil {
+		t.Fatalf("EncodeWAV: %v", err)
+	}
+	if buf.Len() != 44+len(audio.Samples)*2 {
+		t.Errorf("unexpected WAV size %d", buf.Len())
+	}
+	decoded, err := DecodeWAV(&buf)
+	if err != nil {
+		t.Fatalf("DecodeWAV: %v", err)
+	}
+	if decoded.SampleRate != 22050 || decoded.Channels != 2 || !equalSamples(decoded.Samples, audio.Samples) {
+		t.Errorf("round trip changed the audio: %+v", decoded)
+	}
+
+	mono := audio.Mono()
+	if mono.Channels != 1 || !equalSamples(mono.Samples, []int16{0, 16383, -15884}) {
+		t.Errorf("unexpected mono mix %v", mono.Samples)
+	}
+
+	if _, err := DecodeWAV(strings.NewReader("RIFF\x00\x00\x00\x00AVI ")); err == nil {
+		t.Error("expected a non-WAV file to be rejected")
+	}
+}
+
+func TestDecodeWAVFormats(t *testing.T) {
+	// 8-bit PCM, with an unknown chunk before the data
+	wav := testWAV(t, wavFormatPCM, 8, []byte{128, 255, 0}, "LIST", false)
+	audio, err := DecodeWAV(bytes.NewReader(wav))
+	if err != nil {
+		t.Fatalf("8-bit: %v", err)
+	}
+	if !equalSamples(audio.Samples, []int16{0, 127 << 8, -128 << 8}) {
+		t.Errorf("8-bit samples %v", audio.Samples)
+	}
+
+	// 32-bit float in an extensible header, streamed with an unknown data size
+	var data bytes.Buffer
+	for _, f := range []float32{0, 1, -1, 2} {
+		binary.Write(&data, binary.LittleEndian, math.Float32bits(f))
+	}
+	wav = testWAV(t, wavFormatExtensible, 32, data.Bytes(), "", true)
+	if audio, err = DecodeWAV(bytes.NewReader(wav)); err != nil {
+		t.Fatalf("float: %v", err)
+	}
+	if !equalSamples(audio.Samples, []int16{0, math.MaxInt16, -math.MaxInt16, math.MaxInt16}) {
+		t.Errorf("float samples %v", audio.Samples)
+	}
+
+	if _, err := DecodeWAV(bytes.NewReader(testWAV(t, 2, 4, []byte{1}, "", false))); err == nil {
+		t.Error("expected ADPCM to be rejected")
+	}
+}
+
+func TestAudioResample(t *testing.T) {
+	audio := &Audio{SampleRate: 8000, Channels: 1, Samples: []int16{0, 100, 200, 300}}
+	up := audio.Resample(16000)
+	if up.SampleRate != 16000 || !equalSamples(up.Samples, []int16{0, 50, 100, 150, 200, 250, 300, 300}) {
+		t.Errorf("unexpected upsampling %v", up.Samples)
+	}
+	if down := up.Resample(8000); !equalSamples(down.Samples, audio.Samples) {
+		t.Errorf("unexpected downsampling %v", down.Samples)
+	}
+	if d := (&Audio{SampleRate: 16000, Channels: 2, Samples: make([]int16, 16000)}).Duration(); d.Milliseconds() != 500 {
+		t.Errorf("unexpected duration %v", d)
+	}
+}
+
+func TestLocalSpeech(t *testing.T) {
+	dir := t.TempDir()
+	var speech bytes.Buffer
+	EncodeWAV(&speech, &Audio{SampleRate: 22050, Channels: 1, Samples: []int16{1, 2, 3}})
+	speechFile := filepath.Join(dir, "speech.wav")
+	os.WriteFile(speechFile, speech.Bytes(), 0644)
+
+	// A fake piper copies a WAV to its output file and the text it was given to a log
+	tts := writeScript(t, dir, "tts", `cat > "$2"; cp "`+speechFile+`" "$1"`)
+	// A fake whisper.cpp checks it was handed 16 kHz mono audio
+	stt := writeScript(t, dir, "stt", `
+head -c 28 "$2" | od -An -tu4 -j24 | grep -q 16000 || { echo "wrong rate" >&2; exit 1; }
+echo "[00:00:00.000 --> 00:00:02.000]  Scan ports"
+echo
+echo "  10.0.0.5."`)
+
+	textLog := filepath.Join(dir, "text.log")
+	ls, err := NewLocalSpeech(VoiceConfig{
+		SynthesizeCommand: []string{tts, "{output}", textLog},
+		TranscribeCommand: []string{stt, "--file", "{input}"},
+	}, zap.NewNop())
+	if err != nil {
+		t.Fatalf("NewLocalSpeech: %v", err)
+	}
+
+	audio, err := ls.Synthesize(context.Background(), "Scan complete.")
+	if err != nil {
+		t.Fatalf("Synthesize: %v", err)
+	}
+	if audio.SampleRate != 22050 || len(audio.Samples) != 3 {
+		t.Errorf("unexpected speech %+v", audio)
+	}
+	if text, _ := os.ReadFile(textLog); string(text) != "Scan complete." {
+		t.Errorf("expected the text on stdin, got %q", text)
+	}
+
+	transcript, err := ls.Transcribe(context.Background(), &Audio{SampleRate: 44100, Channels: 2, Samples: make([]int16, 4410)})
+	if err != nil {
+		t.Fatalf("Transcribe: %v", err)
+	}
+	if transcript != "Scan ports 10.0.0.5." {
+		t.Errorf("unexpected transcript %q", transcript)
+	}
+
+	// Speech read from stdout, and a failing command's stderr in the error
+	stdout := writeScript(t, dir, "stdout", `cat "`+speechFile+`"`)
+	failing := writeScript(t, dir, "failing", `echo "model not found" >&2; exit 2`)
+	ls, _ = NewLocalSpeech(VoiceConfig{SynthesizeCommand: []string{stdout}, TranscribeCommand: []string{failing}}, zap.NewNop())
+	if audio, err := ls.Synthesize(context.Background(), "hello"); err != nil || len(audio.Samples) != 3 {
+		t.Errorf("expected speech from stdout: %v", err)
+	}
+	if _, err := ls.Transcribe(context.Background(), audio); err == nil || !strings.Contains(err.Error(), "model not found") {
+		t.Errorf("expected the command's stderr, got %v", err)
+	}
+
+	slow := writeScript(t, dir, "slow", `sleep 5`)
+	ls, _ = NewLocalSpeech(VoiceConfig{TranscribeCommand: []string{slow}, TimeoutSeconds: 1}, zap.NewNop())
+	if _, err := ls.Transcribe(context.Background(), audio); err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("expected a timeout, got %v", err)
+	}
+	if _, err := ls.Synthesize(context.Background(), "hello"); !errors.Is(err, ErrSpeechUnsupported) {
+		t.Errorf("expected synthesis to be unsupported, got %v", err)
+	}
+}
+
+func TestExpandSpeechArgs(t *testing.T) {
+	// Spoken text naming a placeholder is passed through as it is
+	args, usesOutput := expandSpeechArgs([]string{"tts", "--text={text}", "{output}"}, "{text}", "write {output} now", "{output}", "/tmp/speech.wav")
+	if !usesOutput || args[1] != "--text=write {output} now" || args[2] != "/tmp/speech.wav" {
+		t.Errorf("unexpected expansion %q, usesOutput %v", args, usesOutput)
+	}
+}
+
+func TestDetermineTTS(t *testing.T) {
+	speech, err := DetermineTTS(VoiceConfig{Engine: SpeechNull}, zap.NewNop())
+	if err != nil {
+		t.Fatalf("DetermineTTS: %v", err)
+	}
+	null := speech.(*NullSpeech)
+	null.Transcript = "list hosts"
+	audio, _ := null.Synthesize(context.Background(), "two words")
+	if audio.Duration().Milliseconds() != 500 {
+		t.Errorf("unexpected silence %v", audio.Duration())
+	}
+	if text, _ := null.Transcribe(context.Background(), audio); text != "list hosts" {
+		t.Errorf("unexpected transcript %q", text)
+	}
+
+	if _, err := DetermineTTS(VoiceConfig{Engine: SpeechElevenLabs}, zap.NewNop()); err == nil {
+		t.Error("expected ElevenLabs without a key to fail")
+	}
+	if _, err := DetermineTTS(VoiceConfig{Engine: "freetts"}, zap.NewNop()); err == nil {
+		t.Error("expected an unknown engine to fail")
+	}
+}
+
+// testWAV builds a mono 16 kHz WAV file by hand.
+func testWAV(t *testing.T, format, bits uint16, data []byte, extraChunk string, streamed bool) []byte {
+	t.Helper()
+	var fmtChunk bytes.Buffer
+	binary.Write(&fmtChunk, binary.LittleEndian, []uint16{format, 1})
+	binary.Write(&fmtChunk, binary.LittleEndian, []uint32{16000, uint32(16000 * bits / 8)})
+	binary.Write(&fmtChunk, binary.LittleEndian, []uint16{bits / 8, bits})
+	if format == wavFormatExtensible {
+		// cbSize, valid bits, channel mask, then the float subformat GUID
+		binary.Write(&fmtChunk, binary.LittleEndian, []uint16{22, bits})
+		binary.Write(&fmtChunk, binary.LittleEndian, uint32(4))
+		fmtChunk.Write([]byte{wavFormatFloat, 0, 0, 0, 0, 0, 0x10, 0, 0x80, 0, 0, 0xAA, 0, 0x38, 0x9B, 0x71})
+	}
+
+	var wav bytes.Buffer
+	chunk := func(id string, size uint32, body []byte) {
+		wav.WriteString(id)
+		binary.Write(&wav, binary.LittleEndian, size)
+		wav.Write(body)
+		if len(body)%2 == 1 && id != "data" {
+			wav.WriteByte(0)
+		}
+	}
+	wav.WriteString("RIFF\xff\xff\xff\xffWAVE")
+	chunk("fmt ", uint32(fmtChunk.Len()), fmtChunk.Bytes())
+	if extraChunk != "" {
+		chunk(extraChunk, 3, []byte("abc"))
+	}
+	size := uint32(len(data))
+	if streamed {
+		size = 0xFFFFFFFF
+	}
+	chunk("data", size, data)
+	return wav.Bytes()
+}
+
+func writeScript(t *testing.T, dir, name, body string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+body+"\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func equalSamples(a, b []int16) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,239 @@
+package ai
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"time"
+)
+
+// Audio is 16-bit PCM, with channels interleaved.
+type Audio struct {
+	SampleRate int
+	Channels   int
+	Samples    []int16
+}
+
+// Duration returns the length of the audio.
+func (a *Audio) Duration() time.Duration {
+	if a.SampleRate <= 0 || a.Channels <= 0 {
+		return 0
+	}
+	frames := len(a.Samples) / a.Channels
+	return time.Duration(frames) * time.Second / time.Duration(a.SampleRate)
+}
+
+// Mono mixes the channels down to one.
+func (a *Audio) Mono() *Audio {
+	if a.Channels <= 1 {
+		return a
+	}
+	frames := len(a.Samples) / a.Channels
+	mono := make([]int16, frames)
+	for i := range mono {
+		sum := 0
+		for c := 0; c < a.Channels; c++ {
+			sum += int(a.Samples[i*a.Channels+c])
+		}
+		mono[i] = int16(sum / a.Channels)
+	}
+	return &Audio{SampleRate: a.SampleRate, Channels: 1, Samples: mono}
+}
+
+// Resample converts mono audio to rate by linear interpolation, which is
+// enough for speech recognizers that want 16 kHz.
+func (a *Audio) Resample(rate int) *Audio {
+	src := a.Mono()
+	if src.SampleRate == rate || len(src.Samples) == 0 {
+		return &Audio{SampleRate: rate, Channels: 1, Samples: src.Samples}
+	}
+	n := int(int64(len(src.Samples)) * int64(rate) / int64(src.SampleRate))
+	out := make([]int16, n)
+	step := float64(src.SampleRate) / float64(rate)
+	for i := range out {
+		pos := float64(i) * step
+		j := int(pos)
+		if j+1 >= len(src.Samples) {
+			out[i] = src.Samples[len(src.Samples)-1]
+			continue
+		}
+		frac := pos - float64(j)
+		out[i] = int16(float64(src.Samples[j])*(1-frac) + float64(src.Samples[j+1])*frac)
+	}
+	return &Audio{SampleRate: rate, Channels: 1, Samples: out}
+}
+
+// WAV format tags.
+const (
+	wavFormatPCM        = 1
+	wavFormatFloat      = 3
+	wavFormatExtensible = 0xFFFE
+)
+
+// EncodeWAV writes the audio as a 16-bit PCM WAV file.
+func EncodeWAV(w io.Writer, a *Audio) error {
+	if a.SampleRate <= 0 || a.Channels <= 0 {
+		return errors.New("audio has no sample rate or channels")
+	}
+	dataSize := uint32(len(a.Samples) * 2)
+	header := struct {
+		Riff          [4]byte
+		Size          uint32
+		Wave          [4]byte
+		Fmt           [4]byte
+		FmtSize       uint32
+		Format        uint16
+		Channels      uint16
+		SampleRate    uint32
+		ByteRate      uint32
+		BlockAlign    uint16
+		BitsPerSample uint16
+		Data          [4]byte
+		DataSize      uint32
+	}{
+		Riff:          [4]byte{'R', 'I', 'F', 'F'},
+		Size:          36 + dataSize,
+		Wave:          [4]byte{'W', 'A', 'V', 'E'},
+		Fmt:           [4]byte{'f', 'm', 't', ' '},
+		FmtSize:       16,
+		Format:        wavFormatPCM,
+		Channels:      uint16(a.Channels),
+		SampleRate:    uint32(a.SampleRate),
+		ByteRate:      uint32(a.SampleRate * a.Channels * 2),
+		BlockAlign:    uint16(a.Channels * 2),
+		BitsPerSample: 16,
+		Data:          [4]byte{'d', 'a', 't', 'a'},
+		DataSize:      dataSize,
+	}
+	bw := bufio.NewWriter(w)
+	if err := binary.Write(bw, binary.LittleEndian, header); err != nil {
+		return fmt.Errorf("failed to write WAV header: %w", err)
+	}
+	if err := binary.Write(bw, binary.LittleEndian, a.Samples); err != nil {
+		return fmt.Errorf("failed to write WAV data: %w", err)
+	}
+	return bw.Flush()
+}
+
+// DecodeWAV reads a PCM (8, 16, 24 or 32-bit) or 32-bit float WAV file,
+// converting the samples to 16 bits. A data chunk of unknown size, as written
+// by tools streaming to stdout, is read to the end.
+func DecodeWAV(r io.Reader) (*Audio, error) {
+	br := bufio.NewReader(r)
+	var riff struct {
+		Riff [4]byte
+		Size uint32
+		Wave [4]byte
+	}
+	if err := binary.Read(br, binary.LittleEndian, &riff); err != nil {
+		return nil, fmt.Errorf("failed to read WAV header: %w", err)
+	}
+	if string(riff.Riff[:]) != "RIFF" || string(riff.Wave[:]) != "WAVE" {
+		return nil, errors.New("not a WAV file")
+	}
+
+	var format, bits uint16
+	var audio Audio
+	for {
+		var chunk struct {
+			ID   [4]byte
+			Size uint32
+		}
+		if err := binary.Read(br, binary.LittleEndian, &chunk); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil, errors.New("WAV file has no data chunk")
+			}
+			return nil, fmt.Errorf("failed to read WAV chunk: %w", err)
+		}
+
+		switch string(chunk.ID[:]) {
+		case "fmt ":
+			body := make([]byte, chunk.Size)
+			if _, err := io.ReadFull(br, body); err != nil {
+				return nil, fmt.Errorf("failed to read WAV format: %w", err)
+			}
+			if len(body) < 16 {
+				return nil, errors.New("WAV format chunk is too short")
+			}
+			format = binary.LittleEndian.Uint16(body[0:2])
+			audio.Channels = int(binary.LittleEndian.Uint16(body[2:4]))
+			audio.SampleRate = int(binary.LittleEndian.Uint32(body[4:8]))
+			bits = binary.LittleEndian.Uint16(body[14:16])
+			if format == wavFormatExtensible && len(body) >= 26 {
+				// The real format is the first two bytes of the subformat GUID
+				format = binary.LittleEndian.Uint16(body[24:26])
+			}
+			if chunk.Size%2 == 1 {
+				br.ReadByte()
+			}
+
+		case "data":
+			if audio.Channels == 0 {
+				return nil, errors.New("WAV data before format")
+			}
+			var data io.Reader = br
+			if chunk.Size != 0xFFFFFFFF && chunk.Size != 0 {
+				data = io.LimitReader(br, int64(chunk.Size))
+			}
+			samples, err := decodeWAVSamples(data, format, bits)
+			if err != nil {
+				return nil, err
+			}
+			audio.Samples = samples
+			return &audio, nil
+
+		default:
+			size := int64(chunk.Size) + int64(chunk.Size%2)
+			if _, err := io.CopyN(io.Discard, br, size); err != nil {
+				return nil, fmt.Errorf("failed to skip WAV chunk %q: %w", chunk.ID[:], err)
+			}
+		}
+	}
+}
+
+func decodeWAVSamples(r io.Reader, format, bits uint16) ([]int16, error) {
+	raw, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read WAV data: %w", err)
+	}
+
+	switch {
+	case format == wavFormatPCM && bits == 8:
+		samples := make([]int16, len(raw))
+		for i, b := range raw {
+			samples[i] = int16(int(b)-128) << 8
+		}
+		return samples, nil
+	case format == wavFormatPCM && bits == 16:
+		samples := make([]int16, len(raw)/2)
+		for i := range samples {
+			samples[i] = int16(binary.LittleEndian.Uint16(raw[i*2:]))
+		}
+		return samples, nil
+	case format == wavFormatPCM && bits == 24:
+		samples := make([]int16, len(raw)/3)
+		for i := range samples {
+			// Keep the top 16 of the 24 bits
+			samples[i] = int16(uint16(raw[i*3+1]) | uint16(raw[i*3+2])<<8)
+		}
+		return samples, nil
+	case format == wavFormatPCM && bits == 32:
+		samples := make([]int16, len(raw)/4)
+		for i := range samples {
+			samples[i] = int16(binary.LittleEndian.Uint32(raw[i*4:]) >> 16)
+		}
+		return samples, nil
+	case format == wavFormatFloat && bits == 32:
+		samples := make([]int16, len(raw)/4)
+		for i := range samples {
+			f := math.Float32frombits(binary.LittleEndian.Uint32(raw[i*4:]))
+			samples[i] = int16(math.Max(-1, math.Min(1, float64(f))) * math.MaxInt16)
+		}
+		return samples, nil
+	default:
+		return nil, fmt.Errorf("unsupported WAV encoding: format %d, %d bits", format, bits)
+	}
+}
@@ -0,0 +1,80 @@
+package apikeys
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Key is one credential of a provider. Providers that need two values
+// (censys id and secret, fofa email and key, google key and cx) store them
+// as "first:second" in Secret.
+type Key struct {
+	Provider string `json:"-"`
+	Label    string `json:"label"`
+	Secret   string `json:"secret"`
+
+	Quota       int      `json:"quota,omitempty"`        // Requests allowed per QuotaPeriod (0 = not tracked)
+	QuotaPeriod Duration `json:"quota_period,omitempty"` // Quota window, e.g. 720h for a monthly plan
+}
+
+// Parts splits a two-value secret. Single-value secrets return Secret twice.
+func (k Key) Parts() (string, string) {
+	if first, second, ok := strings.Cut(k.Secret, ":"); ok {
+		return first, second
+	}
+	return k.Secret, k.Secret
+}
+
+// Masked returns the secret with all but its last four characters hidden
+func (k Key) Masked() string {
+	if len(k.Secret) <= 4 {
+		return strings.Repeat("*", len(k.Secret))
+	}
+	return strings.Repeat("*", 8) + k.Secret[len(k.Secret)-4:]
+}
+
+// usage is the tracked health of a key, persisted next to it
+type usage struct {
+	Requests    int       `json:"requests"`
+	Throttled   int       `json:"throttled"`
+	PeriodStart time.Time `json:"period_start,omitempty"`
+	PeriodUsed  int       `json:"period_used"`
+	Remaining   int       `json:"remaining"` // Last remaining count reported by the provider (-1 = unknown)
+
+	BenchedUntil time.Time `json:"benched_until,omitempty"`
+	BenchReason  string    `json:"bench_reason,omitempty"`
+	LastUsed     time.Time `json:"last_used,omitempty"`
+	LastError    string    `json:"last_error,omitempty"`
+
+	// consecutive 429 answers, doubling the cool-down each time
+	strikes int
+}
+
+// Duration is a time.Duration stored as a string such as "720h"
+type Duration time.Duration
+
+// MarshalJSON encodes d as a duration string
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// UnmarshalJSON accepts a duration string or a number of seconds
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		v, err := time.ParseDuration(s)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q: %w", s, err)
+		}
+		*d = Duration(v)
+		return nil
+	}
+	var seconds int64
+	if err := json.Unmarshal(data, &seconds); err != nil {
+		return fmt.Errorf("invalid duration %s", data)
+	}
+	*d = Duration(time.Duration(seconds) * time.Second)
+	return nil
+}
@@ -0,0 +1,43 @@
+// Package keyfile opens the vault-encrypted API key file shared by the
+// ghostshell keys command and the discovery, tldcrawler and urlcrawler tools
+package keyfile
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"ghostshell/app/apikeys"
+	oqs_vault "ghostshell/oqs/vault"
+	"go.uber.org/zap"
+)
+
+// DefaultFile is the vault file holding the API keys of the discovery,
+// tldcrawler and urlcrawler sources
+const DefaultFile = "ghostshell/config/apikeys.vault"
+
+// MasterKeyEnv holds the hex encoded 32-byte vault master key
+const MasterKeyEnv = "GHOSTSHELL_VAULT_KEY"
+
+// ErrNoMasterKey is returned by Open when MasterKeyEnv is not set
+var ErrNoMasterKey = errors.New(MasterKeyEnv + " is not set")
+
+// Open opens the key file at path with the master key from MasterKeyEnv. A
+// missing file yields a Manager without keys.
+func Open(path string, logger *zap.Logger) (*apikeys.Manager, error) {
+	value := strings.TrimSpace(os.Getenv(MasterKeyEnv))
+	if value == "" {
+		return nil, ErrNoMasterKey
+	}
+	masterKey, err := hex.DecodeString(value)
+	if err != nil || len(masterKey) != 32 {
+		return nil, fmt.Errorf("%s must hold a 64 character hex master key", MasterKeyEnv)
+	}
+	vault, err := oqs_vault.NewVault(masterKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open vault: %w", err)
+	}
+	return apikeys.NewManager(vault, path, logger)
+}
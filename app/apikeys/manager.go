@@ -0,0 +1,430 @@
+package apikeys
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"ghostshell/app/roundrobin"
+	"go.uber.org/zap"
+)
+
+// Vault encrypts the key file at rest. *oqs_vault.Vault satisfies it.
+type Vault interface {
+	EncryptConfigFile(filePath string, configData []byte) error
+	DecryptConfigFile(filePath string) ([]byte, error)
+}
+
+// Cool-down applied to a key after a 429 answer without Retry-After. Each
+// further 429 in a row doubles it up to MaxCooldown.
+var (
+	DefaultCooldown = time.Minute
+	MaxCooldown     = time.Hour
+	// RejectedBench is how long a key answered with 401 or 403 stays benched
+	RejectedBench = 24 * time.Hour
+	// DefaultQuotaPeriod is used for keys with a quota but no period
+	DefaultQuotaPeriod = 30 * 24 * time.Hour
+)
+
+// ErrNoKeys is returned by Next for providers without any key
+var ErrNoKeys = errors.New("no API keys configured")
+
+// ExhaustedError is returned by Next when every key of a provider is benched
+type ExhaustedError struct {
+	Provider string
+	Until    time.Time // Earliest time a key becomes usable again
+}
+
+func (e *ExhaustedError) Error() string {
+	return fmt.Sprintf("all %s API keys are benched until %s", e.Provider, e.Until.Format(time.RFC3339))
+}
+
+type entry struct {
+	Key
+	Usage usage `json:"usage"`
+}
+
+type provider struct {
+	keys     map[string]*entry
+	rotation *roundrobin.RoundRobin[string] // Labels in rotation order
+}
+
+// Manager holds the API keys of every provider, hands them out round-robin
+// and benches keys that run out of quota or get throttled
+type Manager struct {
+	vault     Vault
+	path      string
+	logger    *zap.Logger
+	providers map[string]*provider
+	mu        sync.Mutex
+
+	now func() time.Time
+}
+
+// NewManager creates a Manager whose keys are kept encrypted by vault at
+// path. An existing file is loaded. A nil vault keeps keys in memory only.
+func NewManager(vault Vault, path string, logger *zap.Logger) (*Manager, error) {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	m := &Manager{
+		vault:     vault,
+		path:      path,
+		logger:    logger,
+		providers: make(map[string]*provider),
+		now:       time.Now,
+	}
+	if vault == nil || path == "" {
+		return m, nil
+	}
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return m, nil
+	}
+	if err := m.Load(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Load replaces the keys with those stored in the vault file
+func (m *Manager) Load() error {
+	data, err := m.vault.DecryptConfigFile(m.path)
+	if err != nil {
+		return fmt.Errorf("failed to load API keys: %w", err)
+	}
+	var stored map[string][]*entry
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return fmt.Errorf("failed to parse API keys: %w", err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.providers = make(map[string]*provider)
+	for name, entries := range stored {
+		for _, e := range entries {
+			e.Provider = name
+			if err := m.add(e); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Save writes the keys and their usage to the vault file
+func (m *Manager) Save() error {
+	if m.vault == nil || m.path == "" {
+		return nil
+	}
+
+	m.mu.Lock()
+	stored := make(map[string][]*entry, len(m.providers))
+	for name, p := range m.providers {
+		for _, label := range sortedLabels(p) {
+			stored[name] = append(stored[name], p.keys[label])
+		}
+	}
+	data, err := json.MarshalIndent(stored, "", "  ")
+	m.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("failed to encode API keys: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(m.path), 0700); err != nil {
+		return fmt.Errorf("failed to create API key directory: %w", err)
+	}
+	if err := m.vault.EncryptConfigFile(m.path, data); err != nil {
+		return fmt.Errorf("failed to save API keys: %w", err)
+	}
+	return nil
+}
+
+// Add stores a key for provider. An empty label is replaced by "key-N".
+func (m *Manager) Add(providerName string, key Key) error {
+	key.Provider = normalizeProvider(providerName)
+	key.Secret = strings.TrimSpace(key.Secret)
+	if key.Provider == "" || key.Secret == "" {
+		return fmt.Errorf("provider and secret are required")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if key.Label == "" {
+		n := 1
+		if p := m.providers[key.Provider]; p != nil {
+			n = len(p.keys) + 1
+			for p.keys["key-"+strconv.Itoa(n)] != nil {
+				n++
+			}
+		}
+		key.Label = "key-" + strconv.Itoa(n)
+	}
+	return m.add(&entry{Key: key, Usage: usage{Remaining: -1}})
+}
+
+// add registers e; the caller holds m.mu
+func (m *Manager) add(e *entry) error {
+	p := m.providers[e.Provider]
+	if p == nil {
+		p = &provider{keys: make(map[string]*entry)}
+		m.providers[e.Provider] = p
+	}
+	if _, ok := p.keys[e.Label]; ok {
+		return fmt.Errorf("%s already has a key labeled %q", e.Provider, e.Label)
+	}
+
+	p.keys[e.Label] = e
+	if p.rotation == nil {
+		rotation, err := roundrobin.New([]string{e.Label}, m.logger)
+		if err != nil {
+			return fmt.Errorf("failed to create key rotation: %w", err)
+		}
+		p.rotation = rotation
+	} else {
+		p.rotation.Add(e.Label)
+	}
+	return nil
+}
+
+// Remove deletes a key
+func (m *Manager) Remove(providerName, label string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	name := normalizeProvider(providerName)
+	p := m.providers[name]
+	if p == nil || p.keys[label] == nil {
+		return fmt.Errorf("%s has no key labeled %q", name, label)
+	}
+	delete(p.keys, label)
+	if len(p.keys) == 0 {
+		delete(m.providers, name)
+		return nil
+	}
+	return p.rotation.Remove(label)
+}
+
+// Unbench makes a benched key usable again right away
+func (m *Manager) Unbench(providerName, label string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	name := normalizeProvider(providerName)
+	p := m.providers[name]
+	if p == nil || p.keys[label] == nil {
+		return fmt.Errorf("%s has no key labeled %q", name, label)
+	}
+	e := p.keys[label]
+	e.Usage.BenchedUntil = time.Time{}
+	e.Usage.BenchReason = ""
+	e.Usage.strikes = 0
+	return nil
+}
+
+// Providers returns the names of the providers with keys
+func (m *Manager) Providers() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return sortedProviders(m.providers)
+}
+
+// Secrets returns every secret of provider, for sources that do their own
+// key selection
+func (m *Manager) Secrets(providerName string) []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	p := m.providers[normalizeProvider(providerName)]
+	if p == nil {
+		return nil
+	}
+	var secrets []string
+	for _, label := range sortedLabels(p) {
+		secrets = append(secrets, p.keys[label].Secret)
+	}
+	return secrets
+}
+
+// Next returns the next usable key of provider in round-robin order, skipping
+// benched keys
+func (m *Manager) Next(providerName string) (Key, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	name := normalizeProvider(providerName)
+	p := m.providers[name]
+	if p == nil {
+		return Key{}, fmt.Errorf("%s: %w", name, ErrNoKeys)
+	}
+
+	now := m.now()
+	var until time.Time
+	for i := 0; i < len(p.keys); i++ {
+		e := p.keys[p.rotation.Next()]
+		m.refreshQuota(e, now)
+		if now.Before(e.Usage.BenchedUntil) {
+			if until.IsZero() || e.Usage.BenchedUntil.Before(until) {
+				until = e.Usage.BenchedUntil
+			}
+			continue
+		}
+		if e.Usage.BenchReason != "" {
+			m.logger.Info("API key back in rotation", zap.String("provider", name), zap.String("key", e.Label))
+			e.Usage.BenchReason = ""
+		}
+		e.Usage.LastUsed = now
+		return e.Key, nil
+	}
+	return Key{}, &ExhaustedError{Provider: name, Until: until}
+}
+
+// Report records the outcome of a request made with key. 429 answers bench
+// the key until Retry-After (or a growing cool-down), 401/403 answers bench
+// it for RejectedBench, and rate limit headers reporting no remaining calls
+// bench it until their reset time.
+func (m *Manager) Report(key Key, status int, header http.Header) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	p := m.providers[normalizeProvider(key.Provider)]
+	if p == nil || p.keys[key.Label] == nil {
+		return
+	}
+	e := p.keys[key.Label]
+	now := m.now()
+
+	e.Usage.Requests++
+	m.refreshQuota(e, now)
+	e.Usage.PeriodUsed++
+
+	switch {
+	case status == http.StatusTooManyRequests:
+		e.Usage.Throttled++
+		e.Usage.strikes++
+		e.Usage.LastError = http.StatusText(status)
+		until, ok := retryAfter(header, now)
+		if !ok {
+			cooldown := DefaultCooldown << (e.Usage.strikes - 1)
+			if cooldown > MaxCooldown || cooldown <= 0 {
+				cooldown = MaxCooldown
+			}
+			until = now.Add(cooldown)
+		}
+		m.bench(e, until, "throttled (429)")
+		return
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		e.Usage.LastError = http.StatusText(status)
+		m.bench(e, now.Add(RejectedBench), fmt.Sprintf("rejected (%d)", status))
+		return
+	case status >= 200 && status < 300:
+		e.Usage.strikes = 0
+		e.Usage.LastError = ""
+	}
+
+	if remaining, ok := headerInt(header, "X-RateLimit-Remaining", "RateLimit-Remaining"); ok {
+		e.Usage.Remaining = remaining
+		if remaining <= 0 {
+			until, ok := rateLimitReset(header, now)
+			if !ok {
+				until = now.Add(DefaultCooldown)
+			}
+			m.bench(e, until, "rate limit reached")
+			return
+		}
+	}
+	if e.Key.Quota > 0 && e.Usage.PeriodUsed >= e.Key.Quota {
+		m.bench(e, e.Usage.PeriodStart.Add(quotaPeriod(e.Key)), "quota exhausted")
+	}
+}
+
+// bench takes e out of rotation until the given time
+func (m *Manager) bench(e *entry, until time.Time, reason string) {
+	if until.After(e.Usage.BenchedUntil) {
+		e.Usage.BenchedUntil = until
+	}
+	e.Usage.BenchReason = reason
+	m.logger.Warn("API key benched",
+		zap.String("provider", e.Provider),
+		zap.String("key", e.Label),
+		zap.String("reason", reason),
+		zap.Time("until", e.Usage.BenchedUntil))
+}
+
+// refreshQuota starts a new quota period once the current one is over
+func (m *Manager) refreshQuota(e *entry, now time.Time) {
+	if e.Key.Quota <= 0 {
+		return
+	}
+	period := quotaPeriod(e.Key)
+	if e.Usage.PeriodStart.IsZero() || !now.Before(e.Usage.PeriodStart.Add(period)) {
+		e.Usage.PeriodStart = now
+		e.Usage.PeriodUsed = 0
+	}
+}
+
+func quotaPeriod(k Key) time.Duration {
+	if k.QuotaPeriod > 0 {
+		return time.Duration(k.QuotaPeriod)
+	}
+	return DefaultQuotaPeriod
+}
+
+// retryAfter parses a Retry-After header given in seconds or as an HTTP date
+func retryAfter(header http.Header, now time.Time) (time.Time, bool) {
+	value := strings.TrimSpace(header.Get("Retry-After"))
+	if value == "" {
+		return time.Time{}, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return now.Add(time.Duration(seconds) * time.Second), true
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		return t, true
+	}
+	return time.Time{}, false
+}
+
+// rateLimitReset parses X-RateLimit-Reset given as a Unix time or as seconds
+// from now
+func rateLimitReset(header http.Header, now time.Time) (time.Time, bool) {
+	reset, ok := headerInt(header, "X-RateLimit-Reset", "RateLimit-Reset")
+	if !ok {
+		return time.Time{}, false
+	}
+	if reset > 1000000000 {
+		return time.Unix(int64(reset), 0), true
+	}
+	return now.Add(time.Duration(reset) * time.Second), true
+}
+
+// headerInt returns the first of names present in header as an integer
+func headerInt(header http.Header, names ...string) (int, bool) {
+	for _, name := range names {
+		if value := strings.TrimSpace(header.Get(name)); value != "" {
+			n, err := strconv.Atoi(value)
+			return n, err == nil
+		}
+	}
+	return 0, false
+}
+
+func sortedLabels(p *provider) []string {
+	labels := make([]string, 0, len(p.keys))
+	for label := range p.keys {
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+	return labels
+}
+
+func normalizeProvider(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
@@ -0,0 +1,293 @@
+package apikeys
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// testClock is a settable replacement for Manager.now
+type testClock struct{ t time.Time }
+
+func (c *testClock) now() time.Time          { return c.t }
+func (c *testClock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func newTestManager(t *testing.T, keys ...Key) (*Manager, *testClock) {
+	t.Helper()
+	m, err := NewManager(nil, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock := &testClock{t: time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)}
+	m.now = clock.now
+	for _, key := range keys {
+		if err := m.Add("shodan", key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return m, clock
+}
+
+func next(t *testing.T, m *Manager) Key {
+	t.Helper()
+	key, err := m.Next("shodan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestNextRoundRobin(t *testing.T) {
+	m, _ := newTestManager(t, Key{Secret: "aaaa1111"}, Key{Secret: "bbbb2222"}, Key{Label: "spare", Secret: "cccc3333"})
+
+	var got []string
+	for i := 0; i < 4; i++ {
+		got = append(got, next(t, m).Label)
+	}
+	if want := []string{"key-1", "key-2", "spare", "key-1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("rotation %v, want %v", got, want)
+	}
+
+	if key := next(t, m); key.Provider != "shodan" || key.Secret != "bbbb2222" {
+		t.Errorf("unexpected key %+v", key)
+	}
+	if _, err := m.Next("Censys"); !errors.Is(err, ErrNoKeys) {
+		t.Errorf("expected ErrNoKeys, got %v", err)
+	}
+	if err := m.Add("shodan", Key{Label: "spare", Secret: "dddd4444"}); err == nil {
+		t.Error("expected a duplicate label to fail")
+	}
+}
+
+func TestReportThrottled(t *testing.T) {
+	m, clock := newTestManager(t, Key{Secret: "aaaa1111"}, Key{Secret: "bbbb2222"})
+
+	// Retry-After decides how long the key sits out
+	first := next(t, m)
+	m.Report(first, http.StatusTooManyRequests, http.Header{"Retry-After": {"120"}})
+	for i := 0; i < 3; i++ {
+		if key := next(t, m); key.Label == first.Label {
+			t.Fatalf("%s is benched but was handed out", key.Label)
+		}
+	}
+
+	second := next(t, m)
+	m.Report(second, http.StatusTooManyRequests, nil)
+	var exhausted *ExhaustedError
+	if _, err := m.Next("shodan"); !errors.As(err, &exhausted) {
+		t.Fatalf("expected an ExhaustedError, got %v", err)
+	}
+	// The key without Retry-After comes back first, after DefaultCooldown
+	if want := clock.t.Add(DefaultCooldown); !exhausted.Until.Equal(want) {
+		t.Errorf("exhausted until %s, want %s", exhausted.Until, want)
+	}
+
+	clock.advance(DefaultCooldown)
+	if key := next(t, m); key.Label != second.Label {
+		t.Errorf("expected %s back in rotation, got %s", second.Label, key.Label)
+	}
+	clock.advance(time.Minute)
+	if key := next(t, m); key.Label != first.Label {
+		t.Errorf("expected %s back after Retry-After, got %s", first.Label, key.Label)
+	}
+}
+
+func TestReportCooldownDoubles(t *testing.T) {
+	m, clock := newTestManager(t, Key{Secret: "aaaa1111"})
+	key := next(t, m)
+
+	for _, want := range []time.Duration{DefaultCooldown, 2 * DefaultCooldown, 4 * DefaultCooldown} {
+		m.Report(key, http.StatusTooManyRequests, nil)
+		if until := m.Status()[0].BenchedUntil; !until.Equal(clock.t.Add(want)) {
+			t.Errorf("benched until %s, want a %s cool-down", until, want)
+		}
+		clock.advance(want)
+	}
+
+	// A successful answer resets the strikes
+	m.Report(key, http.StatusOK, nil)
+	m.Report(key, http.StatusTooManyRequests, nil)
+	if until := m.Status()[0].BenchedUntil; !until.Equal(clock.t.Add(DefaultCooldown)) {
+		t.Errorf("benched until %s after a success, want a fresh cool-down", until)
+	}
+
+	// The cool-down never grows past MaxCooldown
+	for i := 0; i < 10; i++ {
+		m.Report(key, http.StatusTooManyRequests, nil)
+	}
+	if until := m.Status()[0].BenchedUntil; until.After(clock.t.Add(MaxCooldown)) {
+		t.Errorf("benched until %s, past MaxCooldown", until)
+	}
+}
+
+func TestReportRejected(t *testing.T) {
+	m, clock := newTestManager(t, Key{Secret: "aaaa1111"})
+	key := next(t, m)
+	m.Report(key, http.StatusUnauthorized, nil)
+
+	status := m.Status()[0]
+	if status.State != StateBenched || status.Reason != "rejected (401)" || status.LastError != "Unauthorized" {
+		t.Errorf("unexpected status %+v", status)
+	}
+	if !status.BenchedUntil.Equal(clock.t.Add(RejectedBench)) {
+		t.Errorf("benched until %s, want RejectedBench", status.BenchedUntil)
+	}
+
+	if err := m.Unbench("SHODAN", key.Label); err != nil {
+		t.Fatal(err)
+	}
+	if status := m.Status()[0]; status.State != StateActive {
+		t.Errorf("expected an unbenched key to be active, got %+v", status)
+	}
+	next(t, m)
+}
+
+func TestReportRateLimitHeaders(t *testing.T) {
+	m, clock := newTestManager(t, Key{Secret: "aaaa1111"})
+	key := next(t, m)
+
+	m.Report(key, http.StatusOK, http.Header{"X-Ratelimit-Remaining": {"7"}})
+	if status := m.Status()[0]; status.State != StateActive || status.Remaining != 7 {
+		t.Errorf("unexpected status %+v", status)
+	}
+
+	tests := []struct {
+		reset string
+		want  time.Time
+	}{
+		{"30", clock.t.Add(30 * time.Second)},
+		{strconv.FormatInt(clock.t.Add(time.Hour).Unix(), 10), clock.t.Add(time.Hour)},
+	}
+	for _, tt := range tests {
+		if err := m.Unbench("shodan", key.Label); err != nil {
+			t.Fatal(err)
+		}
+		m.Report(key, http.StatusOK, http.Header{"X-Ratelimit-Remaining": {"0"}, "X-Ratelimit-Reset": {tt.reset}})
+		status := m.Status()[0]
+		if status.State != StateBenched || status.Reason != "rate limit reached" || !status.BenchedUntil.Equal(tt.want) {
+			t.Errorf("reset %s: got %+v, want benched until %s", tt.reset, status, tt.want)
+		}
+	}
+}
+
+func TestQuotaRefresh(t *testing.T) {
+	period := 24 * time.Hour
+	m, clock := newTestManager(t, Key{Secret: "aaaa1111", Quota: 2, QuotaPeriod: Duration(period)})
+	start := clock.t
+
+	key := next(t, m)
+	m.Report(key, http.StatusOK, nil)
+	clock.advance(time.Hour)
+	m.Report(key, http.StatusOK, nil)
+
+	status := m.Status()[0]
+	if status.State != StateBenched || status.Reason != "quota exhausted" || status.QuotaUsed != 2 {
+		t.Errorf("unexpected status %+v", status)
+	}
+	if !status.BenchedUntil.Equal(start.Add(period)) {
+		t.Errorf("benched until %s, want the end of the quota period", status.BenchedUntil)
+	}
+
+	clock.advance(period - time.Hour)
+	next(t, m)
+	if status := m.Status()[0]; status.State != StateActive || status.QuotaUsed != 0 {
+		t.Errorf("expected a fresh quota period, got %+v", status)
+	}
+}
+
+func TestRemove(t *testing.T) {
+	m, _ := newTestManager(t, Key{Secret: "aaaa1111"}, Key{Secret: "bbbb2222"})
+	if err := m.Remove("shodan", "key-1"); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if key := next(t, m); key.Label != "key-2" {
+			t.Errorf("removed key %s handed out", key.Label)
+		}
+	}
+	if err := m.Remove("shodan", "key-1"); err == nil {
+		t.Error("expected removing a missing key to fail")
+	}
+	if err := m.Remove("shodan", "key-2"); err != nil {
+		t.Fatal(err)
+	}
+	if providers := m.Providers(); len(providers) != 0 {
+		t.Errorf("expected no providers, got %v", providers)
+	}
+}
+
+type testSource struct {
+	name     string
+	needsKey bool
+	keys     []string
+}
+
+func (s *testSource) Name() string          { return s.name }
+func (s *testSource) NeedsKey() bool        { return s.needsKey }
+func (s *testSource) AddApiKeys(k []string) { s.keys = k }
+
+func TestConfigure(t *testing.T) {
+	m, _ := newTestManager(t, Key{Label: "b", Secret: "bbbb2222"}, Key{Label: "a", Secret: "aaaa1111"})
+
+	shodan := &testSource{name: "shodan", needsKey: true}
+	censys := &testSource{name: "censys", needsKey: true}
+	crtsh := &testSource{name: "crtsh"}
+	missing := m.Configure(shodan, censys, crtsh)
+
+	if !reflect.DeepEqual(missing, []string{"censys"}) {
+		t.Errorf("missing %v, want [censys]", missing)
+	}
+	if !reflect.DeepEqual(shodan.keys, []string{"aaaa1111", "bbbb2222"}) {
+		t.Errorf("shodan got keys %v", shodan.keys)
+	}
+	if crtsh.keys != nil {
+		t.Error("sources without keys should be left alone")
+	}
+}
+
+// plainVault stores the key file unencrypted
+type plainVault struct{}
+
+func (plainVault) EncryptConfigFile(path string, data []byte) error {
+	return os.WriteFile(path, data, 0600)
+}
+
+func (plainVault) DecryptConfigFile(path string) ([]byte, error) {
+	return os.ReadFile(path)
+}
+
+func TestSaveLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys", "apikeys.vault")
+	m, err := NewManager(plainVault{}, path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Add("fofa", Key{Secret: "me@example.test:secret", Quota: 100, QuotaPeriod: Duration(time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+	key, err := m.Next("fofa")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Report(key, http.StatusUnauthorized, nil)
+	if err := m.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := NewManager(plainVault{}, path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	status := loaded.Status()
+	if len(status) != 1 || status[0].State != StateBenched || status[0].Requests != 1 || status[0].Quota != 100 {
+		t.Fatalf("unexpected status after load %+v", status)
+	}
+	if email, secret := loaded.providers["fofa"].keys["key-1"].Parts(); email != "me@example.test" || secret != "secret" {
+		t.Errorf("Parts() = %s, %s", email, secret)
+	}
+}
@@ -0,0 +1,136 @@
+package apikeys
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+	"time"
+)
+
+// Key states reported by Status
+const (
+	StateActive  = "active"
+	StateBenched = "benched"
+)
+
+// KeyStatus is the health of one key
+type KeyStatus struct {
+	Provider     string
+	Label        string
+	Secret       string // Masked
+	State        string
+	Reason       string
+	BenchedUntil time.Time
+	Requests     int
+	Throttled    int
+	Quota        int
+	QuotaUsed    int
+	Remaining    int // Remaining calls last reported by the provider (-1 = unknown)
+	LastUsed     time.Time
+	LastError    string
+}
+
+// Status returns the health of every key, ordered by provider and label
+func (m *Manager) Status() []KeyStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	var statuses []KeyStatus
+	for _, name := range sortedProviders(m.providers) {
+		p := m.providers[name]
+		for _, label := range sortedLabels(p) {
+			e := p.keys[label]
+			m.refreshQuota(e, now)
+			status := KeyStatus{
+				Provider:  name,
+				Label:     label,
+				Secret:    e.Masked(),
+				State:     StateActive,
+				Requests:  e.Usage.Requests,
+				Throttled: e.Usage.Throttled,
+				Quota:     e.Key.Quota,
+				QuotaUsed: e.Usage.PeriodUsed,
+				Remaining: e.Usage.Remaining,
+				LastUsed:  e.Usage.LastUsed,
+				LastError: e.Usage.LastError,
+			}
+			if now.Before(e.Usage.BenchedUntil) {
+				status.State = StateBenched
+				status.Reason = e.Usage.BenchReason
+				status.BenchedUntil = e.Usage.BenchedUntil
+			}
+			statuses = append(statuses, status)
+		}
+	}
+	return statuses
+}
+
+// WriteStatus prints the key health as a table
+func (m *Manager) WriteStatus(w io.Writer) error {
+	statuses := m.Status()
+	if len(statuses) == 0 {
+		_, err := fmt.Fprintln(w, "No API keys configured")
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "PROVIDER\tKEY\tSECRET\tSTATE\tREQUESTS\t429s\tQUOTA\tREMAINING\tLAST USED")
+	for _, s := range statuses {
+		state := s.State
+		if s.State == StateBenched {
+			state = fmt.Sprintf("%s: %s until %s", s.State, s.Reason, s.BenchedUntil.Local().Format("2006-01-02 15:04"))
+		}
+		quota := "-"
+		if s.Quota > 0 {
+			quota = fmt.Sprintf("%d/%d", s.QuotaUsed, s.Quota)
+		}
+		remaining := "-"
+		if s.Remaining >= 0 {
+			remaining = fmt.Sprint(s.Remaining)
+		}
+		lastUsed := "never"
+		if !s.LastUsed.IsZero() {
+			lastUsed = s.LastUsed.Local().Format("2006-01-02 15:04")
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%d\t%d\t%s\t%s\t%s\n",
+			s.Provider, s.Label, s.Secret, state, s.Requests, s.Throttled, quota, remaining, lastUsed)
+	}
+	return tw.Flush()
+}
+
+// KeyedSource is a source taking its keys through AddApiKeys, as the
+// tldcrawler and urlcrawler sources do
+type KeyedSource interface {
+	Name() string
+	NeedsKey() bool
+	AddApiKeys([]string)
+}
+
+// Configure hands the stored keys to every source that needs them and
+// returns the names of those left without a key
+func (m *Manager) Configure(sources ...KeyedSource) []string {
+	var missing []string
+	for _, source := range sources {
+		if !source.NeedsKey() {
+			continue
+		}
+		secrets := m.Secrets(source.Name())
+		if len(secrets) == 0 {
+			missing = append(missing, source.Name())
+			continue
+		}
+		source.AddApiKeys(secrets)
+	}
+	return missing
+}
+
+func sortedProviders(providers map[string]*provider) []string {
+	names := make([]string, 0, len(providers))
+	for name := range providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
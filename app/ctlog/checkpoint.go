@@ -0,0 +1,90 @@
+package ctlog
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Checkpoint records how far a log has been read
+type Checkpoint struct {
+	Next     int64     `json:"next"`      // Index of the next entry to read
+	TreeSize int64     `json:"tree_size"` // Tree size seen on the last run
+	Updated  time.Time `json:"updated"`
+}
+
+// Checkpoints keeps one Checkpoint per key, optionally backed by a JSON file
+// so runs are incremental. The Scanner keys them by log URL and watched
+// domains.
+type Checkpoints struct {
+	path string
+	mu   sync.Mutex
+	logs map[string]Checkpoint
+}
+
+// LoadCheckpoints reads the checkpoint file at path. A missing file yields an
+// empty set; an empty path keeps the checkpoints in memory only.
+func LoadCheckpoints(path string) (*Checkpoints, error) {
+	c := &Checkpoints{path: path, logs: make(map[string]Checkpoint)}
+	if path == "" {
+		return c, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read checkpoints: %w", err)
+	}
+	if err := json.Unmarshal(data, &c.logs); err != nil {
+		return nil, fmt.Errorf("failed to parse checkpoints: %w", err)
+	}
+	return c, nil
+}
+
+// Get returns the checkpoint stored under key
+func (c *Checkpoints) Get(key string) (Checkpoint, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cp, ok := c.logs[key]
+	return cp, ok
+}
+
+// Set updates the checkpoint stored under key
+func (c *Checkpoints) Set(key string, cp Checkpoint) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.logs[key] = cp
+}
+
+// Save writes the checkpoints back to their file
+func (c *Checkpoints) Save() error {
+	if c.path == "" {
+		return nil
+	}
+	c.mu.Lock()
+	data, err := json.MarshalIndent(c.logs, "", "  ")
+	c.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("failed to encode checkpoints: %w", err)
+	}
+
+	if dir := filepath.Dir(c.path); dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("failed to create checkpoint directory: %w", err)
+		}
+	}
+	// Write through a temporary file so an interrupted run keeps the old state
+	tmp := c.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write checkpoints: %w", err)
+	}
+	if err := os.Rename(tmp, c.path); err != nil {
+		return fmt.Errorf("failed to write checkpoints: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package ctlog
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// SignedTreeHead is the response of get-sth (RFC 6962 section 4.3)
+type SignedTreeHead struct {
+	TreeSize          int64  `json:"tree_size"`
+	Timestamp         int64  `json:"timestamp"`
+	SHA256RootHash    []byte `json:"sha256_root_hash"`
+	TreeHeadSignature []byte `json:"tree_head_signature"`
+}
+
+// RawEntry is one element of a get-entries response (RFC 6962 section 4.6)
+type RawEntry struct {
+	LeafInput []byte `json:"leaf_input"`
+	ExtraData []byte `json:"extra_data"`
+}
+
+// Client talks to a single Certificate Transparency log
+type Client struct {
+	URL        string // Log prefix, e.g. https://ct.googleapis.com/logs/us1/argon2026h2
+	HTTPClient *http.Client
+	UserAgent  string
+}
+
+// NewClient creates a client for the log at logURL. Bare host names are
+// given an https scheme.
+func NewClient(logURL string, timeout time.Duration) *Client {
+	logURL = strings.TrimSuffix(strings.TrimSpace(logURL), "/")
+	if !strings.Contains(logURL, "://") {
+		logURL = "https://" + logURL
+	}
+	return &Client{
+		URL:        logURL,
+		HTTPClient: &http.Client{Timeout: timeout},
+		UserAgent:  "ghostshell-ctlog/1.0",
+	}
+}
+
+// GetSTH fetches the latest signed tree head of the log
+func (c *Client) GetSTH(ctx context.Context) (*SignedTreeHead, error) {
+	var sth SignedTreeHead
+	if err := c.get(ctx, "/ct/v1/get-sth", nil, &sth); err != nil {
+		return nil, err
+	}
+	return &sth, nil
+}
+
+// GetEntries fetches the raw entries start..end (inclusive). Logs may return
+// fewer entries than requested, but never none for a valid range.
+func (c *Client) GetEntries(ctx context.Context, start, end int64) ([]RawEntry, error) {
+	if start < 0 || end < start {
+		return nil, fmt.Errorf("invalid entry range %d-%d", start, end)
+	}
+	params := url.Values{}
+	params.Set("start", fmt.Sprint(start))
+	params.Set("end", fmt.Sprint(end))
+
+	var resp struct {
+		Entries []RawEntry `json:"entries"`
+	}
+	if err := c.get(ctx, "/ct/v1/get-entries", params, &resp); err != nil {
+		return nil, err
+	}
+	if len(resp.Entries) == 0 {
+		return nil, fmt.Errorf("log returned no entries for %d-%d", start, end)
+	}
+	return resp.Entries, nil
+}
+
+// get performs a GET request against the log and decodes the JSON response
+func (c *Client) get(ctx context.Context, path string, params url.Values, out interface{}) error {
+	endpoint := c.URL + path
+	if len(params) > 0 {
+		endpoint += "?" + params.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	if c.UserAgent != "" {
+		req.Header.Set("User-Agent", c.UserAgent)
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to query %s: %w", endpoint, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s returned %s: %s", endpoint, resp.Status, strings.TrimSpace(string(body)))
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response from %s: %w", endpoint, err)
+	}
+	return nil
+}
@@ -0,0 +1,219 @@
+package ctlog
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testLog is a stand-in RFC 6962 log serving get-sth and get-entries
+type testLog struct {
+	mu       sync.Mutex
+	entries  []RawEntry
+	maxBatch int // Entries returned per get-entries call at most
+}
+
+func (l *testLog) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	switch r.URL.Path {
+	case "/ct/v1/get-sth":
+		json.NewEncoder(w).Encode(SignedTreeHead{TreeSize: int64(len(l.entries)), Timestamp: time.Now().UnixMilli()})
+	case "/ct/v1/get-entries":
+		start, err1 := strconv.Atoi(r.URL.Query().Get("start"))
+		end, err2 := strconv.Atoi(r.URL.Query().Get("end"))
+		if err1 != nil || err2 != nil || start > end || end >= len(l.entries) {
+			http.Error(w, "bad range", http.StatusBadRequest)
+			return
+		}
+		if end-start+1 > l.maxBatch {
+			end = start + l.maxBatch - 1
+		}
+		json.NewEncoder(w).Encode(map[string][]RawEntry{"entries": l.entries[start : end+1]})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (l *testLog) add(t *testing.T, precert bool, cn string, sans ...string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		DNSNames:     sans,
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	leaf := []byte{0, 0}
+	leaf = binary.BigEndian.AppendUint64(leaf, uint64(time.Now().UnixMilli()))
+	if precert {
+		cert, _ := x509.ParseCertificate(der)
+		leaf = binary.BigEndian.AppendUint16(leaf, PrecertEntry)
+		leaf = append(leaf, make([]byte, 32)...)
+		der = cert.RawTBSCertificate
+	} else {
+		leaf = binary.BigEndian.AppendUint16(leaf, X509Entry)
+	}
+	leaf = append(leaf, byte(len(der)>>16), byte(len(der)>>8), byte(len(der)))
+	leaf = append(leaf, der...)
+	leaf = append(leaf, 0, 0) // No extensions
+
+	l.mu.Lock()
+	l.entries = append(l.entries, RawEntry{LeafInput: leaf})
+	l.mu.Unlock()
+}
+
+func scan(t *testing.T, config Config, checkpointFile string) ([]string, Stats) {
+	t.Helper()
+	return scanDomains(t, config, checkpointFile, "Example.test.")
+}
+
+func scanDomains(t *testing.T, config Config, checkpointFile string, domains ...string) ([]string, Stats) {
+	t.Helper()
+	checkpoints, err := LoadCheckpoints(checkpointFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scanner, err := NewScanner(config, checkpoints)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	stats, err := scanner.Scan(context.Background(), domains, func(m Match) {
+		names = append(names, m.Name)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(names)
+	return names, stats
+}
+
+func TestScanIncremental(t *testing.T) {
+	log := &testLog{maxBatch: 2}
+	log.add(t, false, "www.example.test", "www.example.test", "api.example.test")
+	log.add(t, false, "shop.other.test", "shop.other.test")
+	log.add(t, true, "", "*.dev.example.test")
+	server := httptest.NewServer(log)
+	defer server.Close()
+
+	config := Config{Logs: []string{server.URL}, BatchSize: 10, Timeout: 5 * time.Second}
+	checkpointFile := filepath.Join(t.TempDir(), "ct", "checkpoints.json")
+
+	names, stats := scan(t, config, checkpointFile)
+	want := "api.example.test,dev.example.test,www.example.test"
+	if got := strings.Join(names, ","); got != want {
+		t.Errorf("first run found %s, want %s", got, want)
+	}
+	if stats.Entries != 3 || stats.ParseErrors != 0 {
+		t.Errorf("first run stats = %+v", stats)
+	}
+
+	// Only the entries added since the checkpoint are read
+	log.add(t, false, "vpn.example.test")
+	names, stats = scan(t, config, checkpointFile)
+	if got := strings.Join(names, ","); got != "vpn.example.test" || stats.Entries != 1 {
+		t.Errorf("second run found %s in %d entries, want vpn.example.test in 1", got, stats.Entries)
+	}
+
+	names, stats = scan(t, config, checkpointFile)
+	if len(names) != 0 || stats.Entries != 0 {
+		t.Errorf("third run found %v in %d entries, want nothing", names, stats.Entries)
+	}
+}
+
+func TestScanCheckpointsPerDomains(t *testing.T) {
+	log := &testLog{maxBatch: 100}
+	log.add(t, false, "www.example.test")
+	log.add(t, false, "shop.other.test")
+	server := httptest.NewServer(log)
+	defer server.Close()
+
+	config := Config{Logs: []string{server.URL}, Timeout: 5 * time.Second}
+	checkpointFile := filepath.Join(t.TempDir(), "checkpoints.json")
+
+	if names, _ := scan(t, config, checkpointFile); strings.Join(names, ",") != "www.example.test" {
+		t.Fatalf("first run found %v", names)
+	}
+
+	// Entries read for example.test were never matched against other.test
+	names, stats := scanDomains(t, config, checkpointFile, "other.test")
+	if strings.Join(names, ",") != "shop.other.test" || stats.Entries != 2 {
+		t.Errorf("other.test found %v in %d entries, want shop.other.test in 2", names, stats.Entries)
+	}
+
+	// The order and case of the domains do not change the checkpoint
+	names, _ = scanDomains(t, config, checkpointFile, "other.test", "example.test")
+	if strings.Join(names, ",") != "shop.other.test,www.example.test" {
+		t.Errorf("both domains found %v", names)
+	}
+	names, stats = scanDomains(t, config, checkpointFile, "EXAMPLE.test", "other.test", "other.test")
+	if len(names) != 0 || stats.Entries != 0 {
+		t.Errorf("repeated run found %v in %d entries, want nothing", names, stats.Entries)
+	}
+
+	checkpoints, err := LoadCheckpoints(checkpointFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"example.test", "other.test", "example.test,other.test"} {
+		if cp, ok := checkpoints.Get(server.URL + "#" + key); !ok || cp.Next != 2 {
+			t.Errorf("checkpoint for %s = %+v, %v", key, cp, ok)
+		}
+	}
+}
+
+func TestScanInitialAndMaxEntries(t *testing.T) {
+	log := &testLog{maxBatch: 100}
+	for _, host := range []string{"a", "b", "c", "d", "e"} {
+		log.add(t, false, host+".example.test")
+	}
+	server := httptest.NewServer(log)
+	defer server.Close()
+
+	// Without a checkpoint only the last two entries are read
+	names, _ := scan(t, Config{Logs: []string{server.URL}, InitialEntries: 2}, "")
+	if got := strings.Join(names, ","); got != "d.example.test,e.example.test" {
+		t.Errorf("initial entries found %s", got)
+	}
+
+	names, _ = scan(t, Config{Logs: []string{server.URL}, MaxEntries: 3}, "")
+	if got := strings.Join(names, ","); got != "a.example.test,b.example.test,c.example.test" {
+		t.Errorf("max entries found %s", got)
+	}
+}
+
+func TestParseEntryRejectsGarbage(t *testing.T) {
+	if _, err := ParseEntry(0, RawEntry{LeafInput: []byte{0, 0, 1}}); err == nil {
+		t.Error("truncated leaf parsed without error")
+	}
+	if _, err := ParseEntry(0, RawEntry{LeafInput: append(make([]byte, 10), 0, 7)}); err == nil {
+		t.Error("unknown entry type parsed without error")
+	}
+}
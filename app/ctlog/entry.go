@@ -0,0 +1,120 @@
+package ctlog
+
+import (
+	"crypto/x509"
+	"fmt"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/cryptobyte"
+	cbasn1 "golang.org/x/crypto/cryptobyte/asn1"
+)
+
+// Entry types of a TimestampedEntry
+const (
+	X509Entry    uint16 = 0
+	PrecertEntry uint16 = 1
+)
+
+// Entry is a parsed log entry
+type Entry struct {
+	Index       int64
+	Timestamp   time.Time
+	Type        uint16
+	Certificate *x509.Certificate // For precerts, built from the TBSCertificate
+}
+
+// Names returns the lower-cased subject common name and DNS SANs of the entry
+// without duplicates
+func (e *Entry) Names() []string {
+	if e.Certificate == nil {
+		return nil
+	}
+	seen := make(map[string]bool)
+	var names []string
+	for _, name := range append([]string{e.Certificate.Subject.CommonName}, e.Certificate.DNSNames...) {
+		name = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(name)), ".")
+		if name == "" || seen[name] || !strings.Contains(name, ".") {
+			continue
+		}
+		seen[name] = true
+		names = append(names, name)
+	}
+	return names
+}
+
+// ParseEntry decodes the MerkleTreeLeaf of a raw entry (RFC 6962 section 3.4)
+func ParseEntry(index int64, raw RawEntry) (*Entry, error) {
+	leaf := cryptobyte.String(raw.LeafInput)
+
+	var version, leafType uint8
+	var timestamp uint64
+	var entryType uint16
+	if !leaf.ReadUint8(&version) || !leaf.ReadUint8(&leafType) || !leaf.ReadUint64(&timestamp) || !leaf.ReadUint16(&entryType) {
+		return nil, fmt.Errorf("entry %d: truncated leaf", index)
+	}
+	if version != 0 || leafType != 0 {
+		return nil, fmt.Errorf("entry %d: unsupported leaf version %d type %d", index, version, leafType)
+	}
+
+	entry := &Entry{
+		Index:     index,
+		Timestamp: time.UnixMilli(int64(timestamp)),
+		Type:      entryType,
+	}
+
+	var der cryptobyte.String
+	switch entryType {
+	case X509Entry:
+		if !leaf.ReadUint24LengthPrefixed(&der) {
+			return nil, fmt.Errorf("entry %d: truncated certificate", index)
+		}
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, fmt.Errorf("entry %d: failed to parse certificate: %w", index, err)
+		}
+		entry.Certificate = cert
+	case PrecertEntry:
+		var issuerKeyHash []byte
+		if !leaf.ReadBytes(&issuerKeyHash, 32) || !leaf.ReadUint24LengthPrefixed(&der) {
+			return nil, fmt.Errorf("entry %d: truncated precertificate", index)
+		}
+		cert, err := parseTBSCertificate(der)
+		if err != nil {
+			return nil, fmt.Errorf("entry %d: failed to parse precertificate: %w", index, err)
+		}
+		entry.Certificate = cert
+	default:
+		return nil, fmt.Errorf("entry %d: unknown entry type %d", index, entryType)
+	}
+	return entry, nil
+}
+
+// parseTBSCertificate parses a bare TBSCertificate by wrapping it in a
+// Certificate with an empty signature. crypto/x509 does not verify
+// signatures while parsing, but requires the outer signature algorithm to
+// match the one inside the TBSCertificate.
+func parseTBSCertificate(tbs []byte) (*x509.Certificate, error) {
+	input := cryptobyte.String(tbs)
+	var body, sigAlg cryptobyte.String
+	if !input.ReadASN1(&body, cbasn1.SEQUENCE) {
+		return nil, fmt.Errorf("malformed TBSCertificate")
+	}
+	if !body.SkipOptionalASN1(cbasn1.Tag(0).Constructed().ContextSpecific()) ||
+		!body.SkipASN1(cbasn1.INTEGER) ||
+		!body.ReadASN1Element(&sigAlg, cbasn1.SEQUENCE) {
+		return nil, fmt.Errorf("malformed TBSCertificate header")
+	}
+
+	var b cryptobyte.Builder
+	b.AddASN1(cbasn1.SEQUENCE, func(cert *cryptobyte.Builder) {
+		cert.AddBytes(tbs)
+		cert.AddBytes(sigAlg)
+		cert.AddASN1BitString(nil)
+	})
+	der, err := b.Bytes()
+	if err != nil {
+		return nil, err
+	}
+	return x509.ParseCertificate(der)
+}
@@ -0,0 +1,227 @@
+package ctlog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultLogs are widely used logs accepting certificates from the major
+// public CAs. Log shards rotate yearly, so keep this list current or pass
+// logs explicitly.
+var DefaultLogs = []string{
+	"https://ct.googleapis.com/logs/us1/argon2026h2",
+	"https://ct.googleapis.com/logs/eu1/xenon2026h2",
+	"https://ct.cloudflare.com/logs/nimbus2026",
+}
+
+// Config holds the settings of a Scanner
+type Config struct {
+	Logs           []string
+	BatchSize      int64         // Entries requested per get-entries call
+	InitialEntries int64         // Entries read back from the tree head when a log has no checkpoint (0 reads the whole log)
+	MaxEntries     int64         // Upper bound of entries read per log and run (0 = unlimited)
+	Timeout        time.Duration // Per HTTP request
+}
+
+// DefaultConfig provides default scanner settings
+var DefaultConfig = Config{
+	Logs:           DefaultLogs,
+	BatchSize:      256,
+	InitialEntries: 100000,
+	MaxEntries:     1000000,
+	Timeout:        30 * time.Second,
+}
+
+// Match is a certificate name below one of the watched domains
+type Match struct {
+	Log       string
+	Index     int64
+	Timestamp time.Time
+	Domain    string // Watched domain the name belongs to
+	Name      string // Name from the certificate with any wildcard label removed
+	Precert   bool
+}
+
+// Stats summarizes a scan
+type Stats struct {
+	Entries     int64 // Entries read
+	Matches     int   // Names below a watched domain
+	ParseErrors int   // Entries that could not be decoded
+}
+
+// Scanner reads new entries from CT logs and reports the names below watched
+// domains. Progress is kept per log and set of watched domains so that each
+// run continues where the previous one for the same domains stopped.
+type Scanner struct {
+	config      Config
+	checkpoints *Checkpoints
+}
+
+// NewScanner creates a Scanner. A nil checkpoint set makes every run start
+// from InitialEntries behind the tree head.
+func NewScanner(config Config, checkpoints *Checkpoints) (*Scanner, error) {
+	if len(config.Logs) == 0 {
+		return nil, fmt.Errorf("at least one CT log is required")
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = DefaultConfig.BatchSize
+	}
+	if checkpoints == nil {
+		checkpoints, _ = LoadCheckpoints("")
+	}
+	return &Scanner{config: config, checkpoints: checkpoints}, nil
+}
+
+// Scan reads every configured log concurrently and calls fn for each name
+// below domains. fn is never called concurrently. Checkpoints are saved once
+// all logs are done, including the progress of logs that failed midway.
+func (s *Scanner) Scan(ctx context.Context, domains []string, fn func(Match)) (Stats, error) {
+	var watched []string
+	for _, d := range domains {
+		if d = normalizeName(d); d != "" {
+			watched = append(watched, d)
+		}
+	}
+	if len(watched) == 0 {
+		return Stats{}, fmt.Errorf("no domains to watch")
+	}
+	// The set of watched domains keys the checkpoints, so order and duplicates
+	// must not matter
+	sort.Strings(watched)
+	watched = slices.Compact(watched)
+
+	var (
+		wg    sync.WaitGroup
+		mu    sync.Mutex
+		stats Stats
+		errs  []error
+	)
+	emit := func(m Match) {
+		mu.Lock()
+		defer mu.Unlock()
+		stats.Matches++
+		if fn != nil {
+			fn(m)
+		}
+	}
+
+	for _, logURL := range s.config.Logs {
+		wg.Add(1)
+		go func(logURL string) {
+			defer wg.Done()
+			logStats, err := s.scanLog(ctx, NewClient(logURL, s.config.Timeout), watched, emit)
+
+			mu.Lock()
+			defer mu.Unlock()
+			stats.Entries += logStats.Entries
+			stats.ParseErrors += logStats.ParseErrors
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", logURL, err))
+			}
+		}(logURL)
+	}
+	wg.Wait()
+
+	if err := s.checkpoints.Save(); err != nil {
+		errs = append(errs, err)
+	}
+	return stats, errors.Join(errs...)
+}
+
+// scanLog reads the new entries of one log
+func (s *Scanner) scanLog(ctx context.Context, client *Client, watched []string, emit func(Match)) (Stats, error) {
+	var stats Stats
+
+	sth, err := client.GetSTH(ctx)
+	if err != nil {
+		return stats, err
+	}
+
+	// Entries already read for other domains were never matched against these
+	key := checkpointKey(client.URL, watched)
+	cp, ok := s.checkpoints.Get(key)
+	if !ok {
+		cp.Next = 0
+		if s.config.InitialEntries > 0 && sth.TreeSize > s.config.InitialEntries {
+			cp.Next = sth.TreeSize - s.config.InitialEntries
+		}
+	}
+	cp.TreeSize = sth.TreeSize
+
+	last := sth.TreeSize - 1
+	if s.config.MaxEntries > 0 && last-cp.Next+1 > s.config.MaxEntries {
+		last = cp.Next + s.config.MaxEntries - 1
+	}
+
+	for cp.Next <= last {
+		if err := ctx.Err(); err != nil {
+			return stats, err
+		}
+
+		end := cp.Next + s.config.BatchSize - 1
+		if end > last {
+			end = last
+		}
+		entries, err := client.GetEntries(ctx, cp.Next, end)
+		if err != nil {
+			return stats, err
+		}
+
+		for i, raw := range entries {
+			entry, err := ParseEntry(cp.Next+int64(i), raw)
+			if err != nil {
+				stats.ParseErrors++
+				continue
+			}
+			for _, name := range entry.Names() {
+				name = strings.TrimPrefix(name, "*.")
+				if domain := matchDomain(name, watched); domain != "" {
+					emit(Match{
+						Log:       client.URL,
+						Index:     entry.Index,
+						Timestamp: entry.Timestamp,
+						Domain:    domain,
+						Name:      name,
+						Precert:   entry.Type == PrecertEntry,
+					})
+				}
+			}
+		}
+
+		// Logs may return fewer entries than asked for; continue after the last one
+		cp.Next += int64(len(entries))
+		cp.Updated = time.Now().UTC()
+		stats.Entries += int64(len(entries))
+		s.checkpoints.Set(key, cp)
+	}
+
+	s.checkpoints.Set(key, cp)
+	return stats, nil
+}
+
+// checkpointKey identifies the progress of a log for a sorted set of watched
+// domains
+func checkpointKey(logURL string, watched []string) string {
+	return logURL + "#" + strings.Join(watched, ",")
+}
+
+// matchDomain returns the watched domain name belongs to, if any
+func matchDomain(name string, watched []string) string {
+	for _, domain := range watched {
+		if name == domain || strings.HasSuffix(name, "."+domain) {
+			return domain
+		}
+	}
+	return ""
+}
+
+// normalizeName lower-cases name and strips the trailing dot
+func normalizeName(name string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(name)), ".")
+}
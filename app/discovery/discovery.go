@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"encoding/csv"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
@@ -17,6 +18,10 @@ import (
 	"syscall"
 	"time"
 
+	"ghostshell/app/apikeys"
+	"ghostshell/app/apikeys/keyfile"
+	"ghostshell/app/discovery/sources/query"
+	"ghostshell/app/httpcache"
 	rl "github.com/gen2brain/raylib-go/raylib"
 	"github.com/jung-kurt/gofpdf"
 	"go.uber.org/zap"
@@ -63,25 +68,101 @@ func setupLogger() error {
 // -------------- CLI Flags --------------
 
 type Options struct {
-	Debug   bool
-	Queries string
+	Debug     bool
+	Queries   string
+	Search    string
+	Engines   string
+	Limit     int
+	KeysFile  string
+	CacheMode httpcache.Mode
+	CacheDir  string
 }
 
 // parseFlags collects user arguments from CLI
 func parseFlags() (*Options, error) {
 	var debug bool
 	var queries string
+	var search string
+	var engines string
+	var limit int
+	var keysFile string
+	var cacheMode string
+	var cacheDir string
 
 	flag.BoolVar(&debug, "debug", false, "Enable debug logging")
-	flag.StringVar(&queries, "q", "", "Comma-separated queries for CVE search")
+	flag.StringVar(&queries, "cve", "", "Comma-separated queries for CVE search")
+	flag.StringVar(&search, "q", "", `Search engine query, e.g. 'product:"nginx" && port:8443' (fields: `+strings.Join(query.Fields, ", ")+`)`)
+	flag.StringVar(&engines, "engines", "", "Comma-separated engines for -q (default: all with a key)")
+	flag.IntVar(&limit, "limit", 100, "Maximum results per engine for -q")
+	flag.StringVar(&keysFile, "keys", keyfile.DefaultFile, "Encrypted API key file rotated across the engines (needs "+keyfile.MasterKeyEnv+")")
+	flag.StringVar(&cacheMode, "cache", "off", "HTTP response cache for -q: off, cache, record or replay")
+	flag.StringVar(&cacheDir, "cache-dir", httpcache.DefaultConfig.Dir, "Directory of the HTTP response cache")
 	flag.Parse()
 
+	if isLegacyCVEQuery(search) {
+		fmt.Fprintln(os.Stderr, "-q with CVE queries is deprecated, use -cve")
+		if queries == "" {
+			queries = search
+		}
+		search = ""
+	}
+
+	mode, err := httpcache.ParseMode(cacheMode)
+	if err != nil {
+		return nil, err
+	}
+
 	return &Options{
-		Debug:   debug,
-		Queries: queries,
+		Debug:     debug,
+		Queries:   queries,
+		Search:    search,
+		Engines:   engines,
+		Limit:     limit,
+		KeysFile:  keysFile,
+		CacheMode: mode,
+		CacheDir:  cacheDir,
 	}, nil
 }
 
+// isLegacyCVEQuery reports whether a -q value is an old comma-separated CVE
+// query list rather than a neutral search engine query. Neutral queries always
+// contain field:value predicates, so a value without one that fails to parse
+// keeps the old meaning.
+func isLegacyCVEQuery(s string) bool {
+	if s == "" || strings.ContainsAny(s, ":=") {
+		return false
+	}
+	_, err := query.Parse(s)
+	return err != nil
+}
+
+// openCache creates the HTTP response cache selected by -cache
+func openCache(opts *Options) (*httpcache.Cache, error) {
+	config := httpcache.DefaultConfig
+	config.Mode = opts.CacheMode
+	config.Dir = opts.CacheDir
+	cache, err := httpcache.New(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open HTTP cache: %w", err)
+	}
+	return cache, nil
+}
+
+// openKeyManager loads the stored API keys. Without a master key the engines
+// use the static keys from the environment alone.
+func openKeyManager(path string) *apikeys.Manager {
+	manager, err := keyfile.Open(path, logger)
+	if errors.Is(err, keyfile.ErrNoMasterKey) {
+		logger.Info("API key file not loaded", zap.String("reason", err.Error()))
+		return nil
+	}
+	if err != nil {
+		logger.Warn("Failed to load API keys", zap.String("file", path), zap.Error(err))
+		return nil
+	}
+	return manager
+}
+
 // -------------- Particles --------------
 
 type Particle struct {
@@ -233,7 +314,7 @@ func writePDF(path string, data []string, logger *zap.Logger) error {
 	pdf := gofpdf.New("P", "mm", "A4", "")
 	pdf.AddPage()
 	pdf.SetFont("Arial", "B", 16)
-	pdf.Cell(40, 10, "Discovery CVE Report")
+	pdf.Cell(40, 10, "Discovery Report")
 	pdf.Ln(12)
 
 	pdf.SetFont("Arial", "", 12)
@@ -266,22 +347,34 @@ func main() {
 	defer logger.Sync()
 	logger.Info("Logger initialized")
 
-	// 3) Build the Raylib window + set up the UI
+	// 3) A search engine query runs across the engines and exits
+	if opts.Search != "" {
+		lines, err := runSearch(opts)
+		if err != nil {
+			logger.Fatal("Search failed", zap.Error(err))
+		}
+		if err := writeReports(lines, logger); err != nil {
+			logger.Error("Failed to generate reports", zap.Error(err))
+		}
+		return
+	}
+
+	// 4) Build the Raylib window + set up the UI
 	rl.InitWindow(int32(windowWidth), int32(windowHeight), "Discovery")
 	rl.SetTargetFPS(60)
 	runtime.LockOSThread() // Raylib requires main thread for drawing
 
-	// 4) Create terminal
+	// 5) Create terminal
 	term, err := NewTerminal(opts)
 	if err != nil {
 		logger.Fatal("Failed to init terminal", zap.Error(err))
 	}
 	defer term.Shutdown()
 
-	// 5) Particle background
+	// 6) Particle background
 	particles := generateParticles(maxParticles)
 
-	// 6) Graceful shutdown via signals
+	// 7) Graceful shutdown via signals
 	ctx, cancel := context.WithCancel(context.Background())
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
@@ -292,7 +385,7 @@ func main() {
 		rl.CloseWindow()
 	}()
 
-	// 7) If user specified queries, do concurrency fetch
+	// 8) If user specified queries, do concurrency fetch
 	var results []string
 	var mu sync.Mutex
 	queries := strings.Split(opts.Queries, ",")
@@ -325,7 +418,7 @@ func main() {
 		logger.Warn("No queries provided, skipping concurrency fetch.")
 	}
 
-	// 8) Main loop
+	// 9) Main loop
 	for !rl.WindowShouldClose() && ctx.Err() == nil {
 		// update
 		for _, p := range particles {
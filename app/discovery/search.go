@@ -0,0 +1,177 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	sources "ghostshell/app/discovery/sources"
+	"ghostshell/app/discovery/sources/censys"
+	"ghostshell/app/discovery/sources/fofa"
+	"ghostshell/app/discovery/sources/hunter"
+	"ghostshell/app/discovery/sources/netlas"
+	"ghostshell/app/discovery/sources/quake"
+	"ghostshell/app/discovery/sources/query"
+	"ghostshell/app/discovery/sources/shodan"
+	"ghostshell/app/discovery/sources/zoomeye"
+	"go.uber.org/zap"
+)
+
+// searchAgents are the engines a neutral query fans out to
+var searchAgents = []sources.Agent{
+	&shodan.Agent{},
+	&censys.Agent{},
+	&fofa.Agent{},
+	&zoomeye.Agent{},
+	&hunter.Agent{},
+	&quake.Agent{},
+	&netlas.Agent{},
+}
+
+// EngineReport is the outcome of a neutral query on one engine
+type EngineReport struct {
+	Engine  string
+	Query   string // Query in the engine dialect
+	Skipped string // Why the engine was not queried
+	Results int
+	Errors  int
+}
+
+// searchEngines translates expr for every selected engine with a key and
+// queries them concurrently. Results are passed to fn one at a time. An
+// empty engines list selects every engine.
+func searchEngines(session *sources.Session, expr query.Expr, engines []string, limit int, fn func(sources.Result)) []EngineReport {
+	var agents []sources.Agent
+	for _, agent := range searchAgents {
+		if selected(agent.Name(), engines) {
+			agents = append(agents, agent)
+		}
+	}
+
+	// The reports are allocated up front so the goroutines can hold on to
+	// their element while the others are filled in
+	reports := make([]EngineReport, len(agents))
+	var (
+		wg sync.WaitGroup
+		mu sync.Mutex
+	)
+	for i, agent := range agents {
+		report := &reports[i]
+		report.Engine = agent.Name()
+
+		translator, ok := agent.(sources.Translator)
+		if !ok {
+			report.Skipped = "no query translation"
+			continue
+		}
+		q, err := translator.Translate(expr)
+		if err != nil {
+			report.Skipped = err.Error()
+			continue
+		}
+		report.Query = q
+		if !session.HasKey(agent.Name()) {
+			report.Skipped = "no API key configured"
+			continue
+		}
+
+		results, err := agent.Query(session, &sources.Query{Query: q, Limit: limit})
+		if err != nil {
+			report.Skipped = err.Error()
+			continue
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for result := range results {
+				mu.Lock()
+				if result.Error != nil {
+					reports[i].Errors++
+					logger.Sugar().Warnf("%s: %v", reports[i].Engine, result.Error)
+				} else {
+					reports[i].Results++
+					fn(result)
+				}
+				mu.Unlock()
+			}
+		}(i)
+	}
+	wg.Wait()
+	return reports
+}
+
+// runSearch runs a neutral query across the configured engines and returns
+// one report line per result
+func runSearch(opts *Options) ([]string, error) {
+	expr, err := query.Parse(opts.Search)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse query: %w", err)
+	}
+
+	var engines []string
+	for _, engine := range strings.Split(opts.Engines, ",") {
+		if engine = strings.TrimSpace(engine); engine != "" {
+			engines = append(engines, engine)
+		}
+	}
+	names := engines
+	if len(names) == 0 {
+		for _, agent := range searchAgents {
+			names = append(names, agent.Name())
+		}
+	}
+	session, err := sources.NewSession(sources.KeysFromEnv(), 3, 30, 0, names, time.Minute)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create session: %w", err)
+	}
+	cache, err := openCache(opts)
+	if err != nil {
+		return nil, err
+	}
+	session.UseCache(cache)
+	if manager := openKeyManager(opts.KeysFile); manager != nil {
+		session.KeyManager = manager
+		// Benched keys and used quota carry over to the next run
+		defer func() {
+			if err := manager.Save(); err != nil {
+				logger.Warn("Failed to save API key usage", zap.Error(err))
+			}
+		}()
+	}
+
+	var lines []string
+	reports := searchEngines(session, expr, engines, opts.Limit, func(result sources.Result) {
+		host := result.Host
+		if host == "" {
+			host = result.IP
+		}
+		lines = append(lines, fmt.Sprintf("%s => %s:%d (%s)", result.Source, host, result.Port, result.IP))
+	})
+
+	fmt.Printf("Query: %s\n", expr)
+	for _, report := range reports {
+		if report.Skipped != "" {
+			fmt.Printf("  %-8s skipped: %s\n", report.Engine, report.Skipped)
+			continue
+		}
+		fmt.Printf("  %-8s %d results, %d errors  [%s]\n", report.Engine, report.Results, report.Errors, report.Query)
+	}
+	for _, provider := range cache.Providers() {
+		stats := cache.Stats()[provider]
+		fmt.Printf("  cache %-8s %d hits, %d misses, %d stored\n", provider, stats.Hits, stats.Misses, stats.Stored)
+	}
+	return lines, nil
+}
+
+func selected(name string, engines []string) bool {
+	if len(engines) == 0 {
+		return true
+	}
+	for _, engine := range engines {
+		if strings.EqualFold(engine, name) {
+			return true
+		}
+	}
+	return false
+}
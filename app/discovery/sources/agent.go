@@ -1,5 +1,7 @@
 package discovery
 
+import "ghostshell/app/discovery/sources/query"
+
 // Query represents a search query for an agent
 type Query struct {
 	Query string // The search query string
@@ -13,3 +15,11 @@ type Agent interface {
 	// Name returns the name of the agent/source
 	Name() string
 }
+
+// Translator is implemented by agents whose engine has a query language the
+// neutral query of the query package can be rendered into
+type Translator interface {
+	// Translate renders expr in the engine syntax. Parts the engine cannot
+	// express are reported through a *query.UnsupportedError.
+	Translate(expr query.Expr) (string, error)
+}
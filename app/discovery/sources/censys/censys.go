@@ -8,7 +8,8 @@ import (
 
 	"errors"
 
-	"github.com/projectdiscovery/uncover/sources"
+	sources "ghostshell/app/discovery/sources"
+	"ghostshell/app/discovery/sources/query"
 )
 
 const (
@@ -22,8 +23,13 @@ func (agent *Agent) Name() string {
 	return "censys"
 }
 
+// Translate renders a neutral query in censys syntax
+func (agent *Agent) Translate(expr query.Expr) (string, error) {
+	return query.Censys.Render(expr)
+}
+
 func (agent *Agent) Query(session *sources.Session, query *sources.Query) (chan sources.Result, error) {
-	if session.Keys.CensysToken == "" || session.Keys.CensysSecret == "" {
+	if !session.HasKey(agent.Name()) {
 		return nil, errors.New("empty censys keys")
 	}
 	results := make(chan sources.Result)
@@ -55,6 +61,10 @@ func (agent *Agent) Query(session *sources.Session, query *sources.Query) (chan
 }
 
 func (agent *Agent) queryURL(session *sources.Session, URL string, censysRequest *CensysRequest) (*http.Response, error) {
+	key, err := session.Key(agent.Name())
+	if err != nil {
+		return nil, err
+	}
 	censysURL := fmt.Sprintf(URL, url.QueryEscape(censysRequest.Query), censysRequest.PerPage)
 	if censysRequest.Cursor != "" {
 		censysURL += fmt.Sprintf("&cursor=%s", censysRequest.Cursor)
@@ -64,8 +74,8 @@ func (agent *Agent) queryURL(session *sources.Session, URL string, censysRequest
 		return nil, err
 	}
 	request.Header.Set("Accept", "application/json")
-	request.SetBasicAuth(session.Keys.CensysToken, session.Keys.CensysSecret)
-	return session.Do(request, agent.Name())
+	request.SetBasicAuth(key.Parts())
+	return session.DoWithKey(request, agent.Name(), key)
 }
 
 func (agent *Agent) query(URL string, session *sources.Session, censysRequest *CensysRequest, results chan sources.Result) *CensysResponse {
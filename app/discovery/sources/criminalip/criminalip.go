@@ -8,7 +8,7 @@ import (
 
 	"errors"
 
-	"github.com/projectdiscovery/uncover/sources"
+	sources "ghostshell/app/discovery/sources"
 )
 
 const (
@@ -22,7 +22,7 @@ func (agent *Agent) Name() string {
 }
 
 func (agent *Agent) Query(session *sources.Session, query *sources.Query) (chan sources.Result, error) {
-	if session.Keys.CriminalIPToken == "" {
+	if !session.HasKey(agent.Name()) {
 		return nil, errors.New("empty criminalip keys")
 	}
 	results := make(chan sources.Result)
@@ -56,14 +56,18 @@ func (agent *Agent) Query(session *sources.Session, query *sources.Query) (chan
 }
 
 func (agent *Agent) queryURL(session *sources.Session, URL string, criminalipRequest *CriminalIPRequest) (*http.Response, error) {
+	key, err := session.Key(agent.Name())
+	if err != nil {
+		return nil, err
+	}
 	criminalipURL := fmt.Sprintf(URL, url.QueryEscape(criminalipRequest.Query), criminalipRequest.Offset)
 
 	request, err := sources.NewHTTPRequest(http.MethodGet, criminalipURL, nil)
 	if err != nil {
 		return nil, err
 	}
-	request.Header.Set("x-api-key", session.Keys.CriminalIPToken)
-	return session.Do(request, agent.Name())
+	request.Header.Set("x-api-key", key.Secret)
+	return session.DoWithKey(request, agent.Name(), key)
 }
 
 func (agent *Agent) query(URL string, session *sources.Session, criminalipRequest *CriminalIPRequest, results chan sources.Result) *CriminalIPResponse {
@@ -9,7 +9,8 @@ import (
 
 	"errors"
 
-	"github.com/projectdiscovery/uncover/sources"
+	sources "ghostshell/app/discovery/sources"
+	"ghostshell/app/discovery/sources/query"
 )
 
 const (
@@ -24,8 +25,13 @@ func (agent *Agent) Name() string {
 	return "fofa"
 }
 
+// Translate renders a neutral query in fofa syntax
+func (agent *Agent) Translate(expr query.Expr) (string, error) {
+	return query.Fofa.Render(expr)
+}
+
 func (agent *Agent) Query(session *sources.Session, query *sources.Query) (chan sources.Result, error) {
-	if session.Keys.FofaEmail == "" || session.Keys.FofaKey == "" {
+	if !session.HasKey(agent.Name()) {
 		return nil, errors.New("empty fofa keys")
 	}
 
@@ -60,14 +66,19 @@ func (agent *Agent) Query(session *sources.Session, query *sources.Query) (chan
 }
 
 func (agent *Agent) queryURL(session *sources.Session, URL string, fofaRequest *FofaRequest) (*http.Response, error) {
+	key, err := session.Key(agent.Name())
+	if err != nil {
+		return nil, err
+	}
+	email, apiKey := key.Parts()
 	base64Query := base64.StdEncoding.EncodeToString([]byte(fofaRequest.Query))
-	fofaURL := fmt.Sprintf(URL, session.Keys.FofaEmail, session.Keys.FofaKey, base64Query, Fields, fofaRequest.Page, fofaRequest.Size)
+	fofaURL := fmt.Sprintf(URL, email, apiKey, base64Query, Fields, fofaRequest.Page, fofaRequest.Size)
 	request, err := sources.NewHTTPRequest(http.MethodGet, fofaURL, nil)
 	if err != nil {
 		return nil, err
 	}
 	request.Header.Set("Accept", "application/json")
-	return session.Do(request, agent.Name())
+	return session.DoWithKey(request, agent.Name(), key)
 }
 
 func (agent *Agent) query(URL string, session *sources.Session, fofaRequest *FofaRequest, results chan sources.Result) *FofaResponse {
@@ -7,7 +7,7 @@ import (
 	"net/http"
 	"net/url"
 
-	"github.com/projectdiscovery/uncover/sources"
+	sources "ghostshell/app/discovery/sources"
 )
 
 const (
@@ -22,7 +22,7 @@ func (agent *Agent) Name() string {
 
 func (agent *Agent) Query(session *sources.Session, query *sources.Query) (chan sources.Result, error) {
 
-	if session.Keys.GoogleKey == "" || session.Keys.GoogleCX == "" {
+	if !session.HasKey(agent.Name()) {
 		return nil, errors.New("empty google keys")
 	}
 
@@ -116,14 +116,18 @@ func (agent *Agent) query(session *sources.Session, googleRequest *Request, resu
 
 func (agent *Agent) queryURL(session *sources.Session, googleRequest *Request) (*http.Response, error) {
 
-	googleURL := googleRequest.buildURL(session.Keys.GoogleKey, session.Keys.GoogleCX)
+	key, err := session.Key(agent.Name())
+	if err != nil {
+		return nil, err
+	}
+	googleURL := googleRequest.buildURL(key.Parts())
 	request, err := sources.NewHTTPRequest(http.MethodGet, googleURL, nil)
 	if err != nil {
 		return nil, err
 	}
 
 	request.Header.Set("Accept-Encoding", "gzip")
-	return session.Do(request, agent.Name())
+	return session.DoWithKey(request, agent.Name(), key)
 }
 
 func (agent *Agent) parseLink(link string) string {
@@ -7,7 +7,8 @@ import (
 	"fmt"
 	"net/http"
 
-	"github.com/projectdiscovery/uncover/sources"
+	sources "ghostshell/app/discovery/sources"
+	"ghostshell/app/discovery/sources/query"
 )
 
 const (
@@ -21,8 +22,13 @@ func (agent *Agent) Name() string {
 	return "hunter"
 }
 
+// Translate renders a neutral query in hunter syntax
+func (agent *Agent) Translate(expr query.Expr) (string, error) {
+	return query.Hunter.Render(expr)
+}
+
 func (agent *Agent) Query(session *sources.Session, query *sources.Query) (chan sources.Result, error) {
-	if session.Keys.HunterToken == "" {
+	if !session.HasKey(agent.Name()) {
 		return nil, errors.New("empty hunter keys")
 	}
 
@@ -35,7 +41,6 @@ func (agent *Agent) Query(session *sources.Session, query *sources.Query) (chan
 		page := 1
 		for {
 			hunterRequest := &Request{
-				ApiKey:   session.Keys.HunterToken,
 				Search:   query.Query,
 				Page:     page,
 				PageSize: Size,
@@ -86,12 +91,16 @@ func (agent *Agent) query(URL string, session *sources.Session, hunterRequest *R
 }
 
 func (agent *Agent) queryURL(session *sources.Session, URL string, hunterRequest *Request) (*http.Response, error) {
+	key, err := session.Key(agent.Name())
+	if err != nil {
+		return nil, err
+	}
 	base64Query := base64.URLEncoding.EncodeToString([]byte(hunterRequest.Search))
-	hunterURL := fmt.Sprintf(URL, hunterRequest.ApiKey, base64Query, hunterRequest.Page, hunterRequest.PageSize)
+	hunterURL := fmt.Sprintf(URL, key.Secret, base64Query, hunterRequest.Page, hunterRequest.PageSize)
 	request, err := sources.NewHTTPRequest(http.MethodGet, hunterURL, nil)
 	if err != nil {
 		return nil, err
 	}
 	request.Header.Set("Accept", "application/json")
-	return session.Do(request, agent.Name())
+	return session.DoWithKey(request, agent.Name(), key)
 }
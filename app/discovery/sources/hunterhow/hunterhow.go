@@ -5,7 +5,7 @@ import (
 	"errors"
 	"net/http"
 
-	"github.com/projectdiscovery/uncover/sources"
+	sources "ghostshell/app/discovery/sources"
 )
 
 const (
@@ -21,7 +21,7 @@ func (agent *Agent) Name() string {
 }
 
 func (agent *Agent) Query(session *sources.Session, query *sources.Query) (chan sources.Result, error) {
-	if session.Keys.HunterHowToken == "" {
+	if !session.HasKey(agent.Name()) {
 		return nil, errors.New("empty hunterhow keys")
 	}
 
@@ -45,7 +45,7 @@ func (agent *Agent) Query(session *sources.Session, query *sources.Query) (chan
 				break
 			}
 
-			hunterhowResponse := agent.query(hunterhowRequest.buildURL(session.Keys.HunterHowToken), session, results)
+			hunterhowResponse := agent.query(hunterhowRequest, session, results)
 			if hunterhowResponse == nil {
 				break
 			}
@@ -62,8 +62,8 @@ func (agent *Agent) Query(session *sources.Session, query *sources.Query) (chan
 	return results, nil
 }
 
-func (agent *Agent) query(URL string, session *sources.Session, results chan sources.Result) []string {
-	resp, err := agent.queryURL(session, URL)
+func (agent *Agent) query(hunterhowRequest *Request, session *sources.Session, results chan sources.Result) []string {
+	resp, err := agent.queryURL(session, hunterhowRequest)
 	if err != nil {
 		results <- sources.Result{Source: agent.Name(), Error: err}
 		return nil
@@ -95,14 +95,18 @@ func (agent *Agent) query(URL string, session *sources.Session, results chan sou
 	return lines
 }
 
-func (agent *Agent) queryURL(session *sources.Session, URL string) (*http.Response, error) {
+func (agent *Agent) queryURL(session *sources.Session, hunterhowRequest *Request) (*http.Response, error) {
+	key, err := session.Key(agent.Name())
+	if err != nil {
+		return nil, err
+	}
 	request, err := sources.NewHTTPRequest(
 		http.MethodGet,
-		URL,
+		hunterhowRequest.buildURL(key.Secret),
 		nil,
 	)
 	if err != nil {
 		return nil, err
 	}
-	return session.Do(request, agent.Name())
+	return session.DoWithKey(request, agent.Name(), key)
 }
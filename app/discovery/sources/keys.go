@@ -1,5 +1,7 @@
 package discovery
 
+import "os"
+
 // Keys holds API keys for various services
 type Keys struct {
 	CensysToken     string
@@ -37,3 +39,65 @@ func (keys Keys) Empty() bool {
 		keys.GoogleKey == "" &&
 		keys.GoogleCX == ""
 }
+
+// For returns the static key of provider. Providers needing two values
+// return them as "first:second", the form apikeys.Key.Parts splits.
+func (keys Keys) For(provider string) (string, bool) {
+	pair := func(first, second string) (string, bool) {
+		if first == "" || second == "" {
+			return "", false
+		}
+		return first + ":" + second, true
+	}
+	single := func(value string) (string, bool) {
+		return value, value != ""
+	}
+
+	switch provider {
+	case "censys":
+		return pair(keys.CensysToken, keys.CensysSecret)
+	case "fofa":
+		return pair(keys.FofaEmail, keys.FofaKey)
+	case "google":
+		return pair(keys.GoogleKey, keys.GoogleCX)
+	case "shodan":
+		return single(keys.Shodan)
+	case "quake":
+		return single(keys.QuakeToken)
+	case "hunter":
+		return single(keys.HunterToken)
+	case "zoomeye":
+		return single(keys.ZoomEyeToken)
+	case "netlas":
+		return single(keys.NetlasToken)
+	case "criminalip":
+		return single(keys.CriminalIPToken)
+	case "publicwww":
+		return single(keys.PublicwwwToken)
+	case "hunterhow":
+		return single(keys.HunterHowToken)
+	}
+	return "", false
+}
+
+// KeysFromEnv reads the static keys from the environment variables used by
+// uncover, e.g. SHODAN_API_KEY and CENSYS_API_ID/CENSYS_API_SECRET
+func KeysFromEnv() *Keys {
+	return &Keys{
+		CensysToken:     os.Getenv("CENSYS_API_ID"),
+		CensysSecret:    os.Getenv("CENSYS_API_SECRET"),
+		Shodan:          os.Getenv("SHODAN_API_KEY"),
+		FofaEmail:       os.Getenv("FOFA_EMAIL"),
+		FofaKey:         os.Getenv("FOFA_KEY"),
+		QuakeToken:      os.Getenv("QUAKE_TOKEN"),
+		HunterToken:     os.Getenv("HUNTER_API_KEY"),
+		ZoomEyeHost:     os.Getenv("ZOOMEYE_HOST"),
+		ZoomEyeToken:    os.Getenv("ZOOMEYE_API_KEY"),
+		NetlasToken:     os.Getenv("NETLAS_API_KEY"),
+		CriminalIPToken: os.Getenv("CRIMINALIP_API_KEY"),
+		PublicwwwToken:  os.Getenv("PUBLICWWW_API_KEY"),
+		HunterHowToken:  os.Getenv("HUNTERHOW_API_KEY"),
+		GoogleKey:       os.Getenv("GOOGLE_API_KEY"),
+		GoogleCX:        os.Getenv("GOOGLE_API_CX"),
+	}
+}
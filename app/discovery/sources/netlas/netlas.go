@@ -5,7 +5,8 @@ import (
 	"errors"
 	"net/http"
 
-	"github.com/projectdiscovery/uncover/sources"
+	sources "ghostshell/app/discovery/sources"
+	"ghostshell/app/discovery/sources/query"
 )
 
 const (
@@ -20,8 +21,13 @@ func (agent *Agent) Name() string {
 	return "netlas"
 }
 
+// Translate renders a neutral query in netlas syntax
+func (agent *Agent) Translate(expr query.Expr) (string, error) {
+	return query.Netlas.Render(expr)
+}
+
 func (agent *Agent) Query(session *sources.Session, query *sources.Query) (chan sources.Result, error) {
-	if session.Keys.NetlasToken == "" {
+	if !session.HasKey(agent.Name()) {
 		return nil, errors.New("empty netlas keys")
 	}
 
@@ -81,6 +87,10 @@ func (agent *Agent) query(URL string, session *sources.Session, results chan sou
 }
 
 func (agent *Agent) queryURL(session *sources.Session, URL string) (*http.Response, error) {
+	key, err := session.Key(agent.Name())
+	if err != nil {
+		return nil, err
+	}
 	request, err := sources.NewHTTPRequest(
 		http.MethodGet,
 		URL,
@@ -91,6 +101,6 @@ func (agent *Agent) queryURL(session *sources.Session, URL string) (*http.Respon
 	}
 
 	request.Header.Set("Content-Type", contentType)
-	request.Header.Set("X-API-Key", session.Keys.NetlasToken)
-	return session.Do(request, agent.Name())
+	request.Header.Set("X-API-Key", key.Secret)
+	return session.DoWithKey(request, agent.Name(), key)
 }
@@ -8,7 +8,7 @@ import (
 	"net/http"
 	"strings"
 
-	"github.com/projectdiscovery/uncover/sources"
+	sources "ghostshell/app/discovery/sources"
 )
 
 const (
@@ -23,7 +23,7 @@ func (agent *Agent) Name() string {
 }
 
 func (agent *Agent) Query(session *sources.Session, query *sources.Query) (chan sources.Result, error) {
-	if session.Keys.PublicwwwToken == "" {
+	if !session.HasKey(agent.Name()) {
 		return nil, errors.New("empty publicwww keys")
 	}
 
@@ -43,7 +43,7 @@ func (agent *Agent) Query(session *sources.Session, query *sources.Query) (chan
 				break
 			}
 
-			publicwwwResponse := agent.query(publicwwwRequest.buildURL(session.Keys.PublicwwwToken), session, results)
+			publicwwwResponse := agent.query(publicwwwRequest, session, results)
 			if publicwwwResponse == nil {
 				break
 			}
@@ -59,8 +59,8 @@ func (agent *Agent) Query(session *sources.Session, query *sources.Query) (chan
 	return results, nil
 }
 
-func (agent *Agent) query(URL string, session *sources.Session, results chan sources.Result) []string {
-	resp, err := agent.queryURL(session, URL)
+func (agent *Agent) query(publicwwwRequest *Request, session *sources.Session, results chan sources.Result) []string {
+	resp, err := agent.queryURL(session, publicwwwRequest)
 	if err != nil {
 		results <- sources.Result{Source: agent.Name(), Error: err}
 		return nil
@@ -107,14 +107,18 @@ func (agent *Agent) query(URL string, session *sources.Session, results chan sou
 	return lines
 }
 
-func (agent *Agent) queryURL(session *sources.Session, URL string) (*http.Response, error) {
+func (agent *Agent) queryURL(session *sources.Session, publicwwwRequest *Request) (*http.Response, error) {
+	key, err := session.Key(agent.Name())
+	if err != nil {
+		return nil, err
+	}
 	request, err := sources.NewHTTPRequest(
 		http.MethodGet,
-		URL,
+		publicwwwRequest.buildURL(key.Secret),
 		nil,
 	)
 	if err != nil {
 		return nil, err
 	}
-	return session.Do(request, agent.Name())
+	return session.DoWithKey(request, agent.Name(), key)
 }
@@ -8,7 +8,8 @@ import (
 	"io"
 	"net/http"
 
-	"github.com/projectdiscovery/uncover/sources"
+	sources "ghostshell/app/discovery/sources"
+	"ghostshell/app/discovery/sources/query"
 	errorutil "github.com/projectdiscovery/utils/errors"
 )
 
@@ -23,8 +24,13 @@ func (agent *Agent) Name() string {
 	return "quake"
 }
 
+// Translate renders a neutral query in quake syntax
+func (agent *Agent) Translate(expr query.Expr) (string, error) {
+	return query.Quake.Render(expr)
+}
+
 func (agent *Agent) Query(session *sources.Session, query *sources.Query) (chan sources.Result, error) {
-	if session.Keys.QuakeToken == "" {
+	if !session.HasKey(agent.Name()) {
 		return nil, errors.New("empty quake keys")
 	}
 
@@ -104,6 +110,10 @@ func (agent *Agent) query(URL string, session *sources.Session, quakeRequest *Re
 }
 
 func (agent *Agent) queryURL(session *sources.Session, URL string, quakeRequest *Request) (*http.Response, error) {
+	key, err := session.Key(agent.Name())
+	if err != nil {
+		return nil, err
+	}
 	body, err := json.Marshal(quakeRequest)
 	if err != nil {
 		return nil, err
@@ -119,6 +129,6 @@ func (agent *Agent) queryURL(session *sources.Session, URL string, quakeRequest
 	}
 
 	request.Header.Set("Content-Type", "application/json")
-	request.Header.Set("X-QuakeToken", session.Keys.QuakeToken)
-	return session.Do(request, agent.Name())
+	request.Header.Set("X-QuakeToken", key.Secret)
+	return session.DoWithKey(request, agent.Name(), key)
 }
@@ -0,0 +1,269 @@
+package query
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Dialect describes the query syntax of one search engine
+type Dialect struct {
+	Name   string
+	Fields map[string]string // Neutral field to engine field; missing fields are unsupported
+
+	Equal    string // Predicate format taking the engine field and the value, e.g. "%s:%s"
+	NotEqual string // Negated predicate format; empty negates with Not
+	And      string // Separator of ANDed terms
+	Or       string // Separator of ORed terms; empty when the engine has no OR
+
+	Not       string // Prefix negating a term; empty when only NotEqual is available
+	NotGroups bool   // Whether Not may negate a parenthesized group
+
+	QuoteNumbers bool                           // Quote port and asn values like text
+	Values       map[string]func(string) string // Per-field value rewrites, applied before quoting
+}
+
+// UnsupportedError lists the parts of a query a dialect cannot express
+type UnsupportedError struct {
+	Engine string
+	Items  []string
+}
+
+func (e *UnsupportedError) Error() string {
+	return fmt.Sprintf("%s does not support %s", e.Engine, strings.Join(e.Items, ", "))
+}
+
+// Render writes expr in the dialect. Every unsupported field or operator is
+// collected into an *UnsupportedError instead of stopping at the first one.
+func (d *Dialect) Render(expr Expr) (string, error) {
+	r := &renderer{dialect: d, unsupported: make(map[string]bool)}
+	out := r.render(expr, false)
+	if len(r.unsupported) > 0 {
+		items := make([]string, 0, len(r.unsupported))
+		for item := range r.unsupported {
+			items = append(items, item)
+		}
+		sort.Strings(items)
+		return "", &UnsupportedError{Engine: d.Name, Items: items}
+	}
+	return out, nil
+}
+
+type renderer struct {
+	dialect     *Dialect
+	unsupported map[string]bool
+}
+
+func (r *renderer) render(expr Expr, nested bool) string {
+	d := r.dialect
+	switch e := expr.(type) {
+	case *Predicate:
+		return r.predicate(e, false)
+	case *And:
+		return r.group(e.Terms, d.And, nested)
+	case *Or:
+		if d.Or == "" {
+			r.unsupported["OR"] = true
+		}
+		return r.group(e.Terms, d.Or, nested)
+	case *Not:
+		if p, ok := e.Expr.(*Predicate); ok {
+			if d.NotEqual != "" {
+				return r.predicate(p, true)
+			}
+			if d.Not == "" {
+				r.unsupported["negation"] = true
+			}
+			return d.Not + r.predicate(p, false)
+		}
+		if d.Not == "" || !d.NotGroups {
+			r.unsupported["negated groups"] = true
+		}
+		return d.Not + "(" + r.render(e.Expr, false) + ")"
+	}
+	r.unsupported[fmt.Sprintf("%T", expr)] = true
+	return ""
+}
+
+func (r *renderer) group(terms []Expr, sep string, nested bool) string {
+	parts := make([]string, len(terms))
+	for i, term := range terms {
+		parts[i] = r.render(term, true)
+	}
+	out := strings.Join(parts, sep)
+	if nested {
+		return "(" + out + ")"
+	}
+	return out
+}
+
+func (r *renderer) predicate(p *Predicate, negated bool) string {
+	d := r.dialect
+	field, ok := d.Fields[p.Field]
+	if !ok {
+		r.unsupported["field "+p.Field] = true
+		return ""
+	}
+	value := p.Value
+	if rewrite := d.Values[p.Field]; rewrite != nil {
+		value = rewrite(value)
+	}
+	if !numericFields[p.Field] || d.QuoteNumbers {
+		value = quote(value)
+	}
+	if negated {
+		return fmt.Sprintf(d.NotEqual, field, value)
+	}
+	return fmt.Sprintf(d.Equal, field, value)
+}
+
+func quote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// Dialects of the discovery engines
+var (
+	Shodan = &Dialect{
+		Name: "shodan",
+		Fields: map[string]string{
+			FieldPort:        "port",
+			FieldProduct:     "product",
+			FieldTitle:       "http.title",
+			FieldCertSubject: "ssl.cert.subject.cn",
+			FieldASN:         "asn",
+			FieldCountry:     "country",
+			FieldIP:          "net",
+			FieldHostname:    "hostname",
+			FieldOrg:         "org",
+			FieldBody:        "http.html",
+		},
+		Equal:  "%s:%s",
+		And:    " ",
+		Not:    "-",
+		Values: map[string]func(string) string{FieldASN: func(v string) string { return "AS" + v }},
+	}
+
+	Censys = &Dialect{
+		Name: "censys",
+		Fields: map[string]string{
+			FieldPort:        "services.port",
+			FieldProduct:     "services.software.product",
+			FieldTitle:       "services.http.response.html_title",
+			FieldCertSubject: "services.tls.certificates.leaf_data.subject_dn",
+			FieldASN:         "autonomous_system.asn",
+			FieldCountry:     "location.country_code",
+			FieldIP:          "ip",
+			FieldHostname:    "dns.names",
+			FieldOrg:         "autonomous_system.name",
+			FieldBody:        "services.http.response.body",
+		},
+		Equal:     "%s: %s",
+		And:       " and ",
+		Or:        " or ",
+		Not:       "not ",
+		NotGroups: true,
+	}
+
+	Fofa = &Dialect{
+		Name: "fofa",
+		Fields: map[string]string{
+			FieldPort:        "port",
+			FieldProduct:     "product",
+			FieldTitle:       "title",
+			FieldCertSubject: "cert.subject",
+			FieldASN:         "asn",
+			FieldCountry:     "country",
+			FieldIP:          "ip",
+			FieldHostname:    "host",
+			FieldOrg:         "org",
+			FieldBody:        "body",
+		},
+		Equal:        "%s=%s",
+		NotEqual:     "%s!=%s",
+		And:          " && ",
+		Or:           " || ",
+		QuoteNumbers: true,
+	}
+
+	ZoomEye = &Dialect{
+		Name: "zoomeye",
+		Fields: map[string]string{
+			FieldPort:        "port",
+			FieldProduct:     "app",
+			FieldTitle:       "title",
+			FieldCertSubject: "ssl",
+			FieldASN:         "asn",
+			FieldCountry:     "country",
+			FieldIP:          "ip",
+			FieldHostname:    "hostname",
+			FieldOrg:         "org",
+		},
+		Equal: "%s:%s",
+		And:   " +",
+		Or:    " ",
+		Not:   "-",
+	}
+
+	Hunter = &Dialect{
+		Name: "hunter",
+		Fields: map[string]string{
+			FieldPort:        "ip.port",
+			FieldProduct:     "app.name",
+			FieldTitle:       "web.title",
+			FieldCertSubject: "cert.subject",
+			FieldASN:         "as.number",
+			FieldCountry:     "ip.country",
+			FieldIP:          "ip",
+			FieldHostname:    "domain",
+			FieldOrg:         "as.org",
+			FieldBody:        "web.body",
+		},
+		Equal:        "%s=%s",
+		NotEqual:     "%s!=%s",
+		And:          " && ",
+		Or:           " || ",
+		QuoteNumbers: true,
+	}
+
+	Quake = &Dialect{
+		Name: "quake",
+		Fields: map[string]string{
+			FieldPort:        "port",
+			FieldProduct:     "app",
+			FieldTitle:       "title",
+			FieldCertSubject: "cert",
+			FieldASN:         "asn",
+			FieldCountry:     "country",
+			FieldIP:          "ip",
+			FieldHostname:    "hostname",
+			FieldOrg:         "org",
+			FieldBody:        "body",
+		},
+		Equal:     "%s:%s",
+		And:       " AND ",
+		Or:        " OR ",
+		Not:       "NOT ",
+		NotGroups: true,
+	}
+
+	Netlas = &Dialect{
+		Name: "netlas",
+		Fields: map[string]string{
+			FieldPort:        "port",
+			FieldProduct:     "tag.name",
+			FieldTitle:       "http.title",
+			FieldCertSubject: "certificate.subject_dn",
+			FieldASN:         "whois.asn.number",
+			FieldCountry:     "geo.country",
+			FieldIP:          "ip",
+			FieldHostname:    "host",
+			FieldOrg:         "whois.net.organization",
+			FieldBody:        "http.body",
+		},
+		Equal:     "%s:%s",
+		And:       " AND ",
+		Or:        " OR ",
+		Not:       "NOT ",
+		NotGroups: true,
+	}
+)
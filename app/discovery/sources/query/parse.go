@@ -0,0 +1,276 @@
+package query
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenPredicate
+	tokenAnd
+	tokenOr
+	tokenNot
+	tokenLParen
+	tokenRParen
+)
+
+type token struct {
+	kind  tokenKind
+	field string
+	value string
+	pos   int
+}
+
+// Parse parses a neutral query such as
+//
+//	product:"nginx" && port:8443 && !country:CN
+//
+// Predicates are field:value with the value quoted when it holds spaces.
+// Terms combine with && (or AND, or plain juxtaposition) and || (or OR),
+// and are negated with !, NOT or a leading -. Parentheses group terms.
+func Parse(s string) (Expr, error) {
+	tokens, err := lex(s)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	expr, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokenEOF {
+		return nil, fmt.Errorf("unexpected %s at offset %d", describe(t), t.pos)
+	}
+	return expr, nil
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) or() (Expr, error) {
+	first, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	terms := []Expr{first}
+	for p.peek().kind == tokenOr {
+		p.next()
+		term, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		terms = append(terms, term)
+	}
+	return flatten(terms, false), nil
+}
+
+func (p *parser) and() (Expr, error) {
+	first, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	terms := []Expr{first}
+	for {
+		switch p.peek().kind {
+		case tokenAnd:
+			p.next()
+		case tokenPredicate, tokenNot, tokenLParen:
+			// juxtaposed terms are ANDed
+		default:
+			return flatten(terms, true), nil
+		}
+		term, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		terms = append(terms, term)
+	}
+}
+
+func (p *parser) unary() (Expr, error) {
+	t := p.next()
+	switch t.kind {
+	case tokenNot:
+		expr, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		if inner, ok := expr.(*Not); ok {
+			return inner.Expr, nil
+		}
+		return &Not{Expr: expr}, nil
+	case tokenLParen:
+		expr, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.next(); closing.kind != tokenRParen {
+			return nil, fmt.Errorf("expected ) at offset %d, got %s", closing.pos, describe(closing))
+		}
+		return expr, nil
+	case tokenPredicate:
+		value, err := normalize(t.field, t.value)
+		if err != nil {
+			return nil, fmt.Errorf("offset %d: %w", t.pos, err)
+		}
+		return &Predicate{Field: t.field, Value: value}, nil
+	}
+	return nil, fmt.Errorf("unexpected %s at offset %d", describe(t), t.pos)
+}
+
+// flatten merges nested terms of the same operator
+func flatten(terms []Expr, and bool) Expr {
+	if len(terms) == 1 {
+		return terms[0]
+	}
+	var flat []Expr
+	for _, term := range terms {
+		switch t := term.(type) {
+		case *And:
+			if and {
+				flat = append(flat, t.Terms...)
+				continue
+			}
+		case *Or:
+			if !and {
+				flat = append(flat, t.Terms...)
+				continue
+			}
+		}
+		flat = append(flat, term)
+	}
+	if and {
+		return &And{Terms: flat}
+	}
+	return &Or{Terms: flat}
+}
+
+func lex(s string) ([]token, error) {
+	var tokens []token
+	i := 0
+	for i < len(s) {
+		c := s[i]
+		switch {
+		case unicode.IsSpace(rune(c)):
+			i++
+		case c == '(':
+			tokens = append(tokens, token{kind: tokenLParen, pos: i})
+			i++
+		case c == ')':
+			tokens = append(tokens, token{kind: tokenRParen, pos: i})
+			i++
+		case strings.HasPrefix(s[i:], "&&"):
+			tokens = append(tokens, token{kind: tokenAnd, pos: i})
+			i += 2
+		case strings.HasPrefix(s[i:], "||"):
+			tokens = append(tokens, token{kind: tokenOr, pos: i})
+			i += 2
+		case c == '!' || c == '-':
+			tokens = append(tokens, token{kind: tokenNot, pos: i})
+			i++
+		default:
+			t, n, err := lexWord(s, i)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, t)
+			i = n
+		}
+	}
+	return append(tokens, token{kind: tokenEOF, pos: len(s)}), nil
+}
+
+// lexWord reads an operator keyword or a field:value predicate at s[start:]
+func lexWord(s string, start int) (token, int, error) {
+	i := start
+	for i < len(s) && isFieldChar(s[i]) {
+		i++
+	}
+	word := s[start:i]
+	if i == len(s) || (s[i] != ':' && s[i] != '=') {
+		switch strings.ToUpper(word) {
+		case "AND":
+			return token{kind: tokenAnd, pos: start}, i, nil
+		case "OR":
+			return token{kind: tokenOr, pos: start}, i, nil
+		case "NOT":
+			return token{kind: tokenNot, pos: start}, i, nil
+		}
+		if word == "" {
+			return token{}, 0, fmt.Errorf("unexpected %q at offset %d", s[start], start)
+		}
+		return token{}, 0, fmt.Errorf("expected field:value at offset %d, got %q", start, word)
+	}
+
+	field := strings.ToLower(word)
+	if !knownField(field) {
+		return token{}, 0, fmt.Errorf("unknown field %q at offset %d (known: %s)", word, start, strings.Join(Fields, ", "))
+	}
+	i++ // ':' or '='
+
+	if i < len(s) && s[i] == '"' {
+		end := i + 1
+		for end < len(s) && s[end] != '"' {
+			if s[end] == '\\' {
+				end++
+			}
+			end++
+		}
+		if end >= len(s) {
+			return token{}, 0, fmt.Errorf("unterminated string at offset %d", i)
+		}
+		value, err := strconv.Unquote(s[i : end+1])
+		if err != nil {
+			return token{}, 0, fmt.Errorf("invalid string at offset %d: %w", i, err)
+		}
+		return token{kind: tokenPredicate, field: field, value: value, pos: start}, end + 1, nil
+	}
+
+	end := i
+	for end < len(s) && !unicode.IsSpace(rune(s[end])) && s[end] != '(' && s[end] != ')' &&
+		!strings.HasPrefix(s[end:], "&&") && !strings.HasPrefix(s[end:], "||") {
+		end++
+	}
+	return token{kind: tokenPredicate, field: field, value: s[i:end], pos: start}, end, nil
+}
+
+func isFieldChar(c byte) bool {
+	return c == '.' || c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+func describe(t token) string {
+	switch t.kind {
+	case tokenEOF:
+		return "end of query"
+	case tokenPredicate:
+		return "predicate " + t.field
+	case tokenAnd:
+		return "&&"
+	case tokenOr:
+		return "||"
+	case tokenNot:
+		return "!"
+	case tokenLParen:
+		return "("
+	}
+	return ")"
+}
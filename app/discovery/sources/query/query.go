@@ -0,0 +1,145 @@
+package query
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Neutral fields understood by every dialect that supports them
+const (
+	FieldPort        = "port"
+	FieldProduct     = "product"
+	FieldTitle       = "title"
+	FieldCertSubject = "cert.subject"
+	FieldASN         = "asn"
+	FieldCountry     = "country"
+	FieldIP          = "ip"
+	FieldHostname    = "hostname"
+	FieldOrg         = "org"
+	FieldBody        = "body"
+)
+
+// Fields lists the neutral fields
+var Fields = []string{
+	FieldPort, FieldProduct, FieldTitle, FieldCertSubject, FieldASN,
+	FieldCountry, FieldIP, FieldHostname, FieldOrg, FieldBody,
+}
+
+// numericFields hold numbers, which dialects may render unquoted
+var numericFields = map[string]bool{FieldPort: true, FieldASN: true}
+
+// Expr is a node of a neutral query
+type Expr interface {
+	String() string
+}
+
+// Predicate matches Field against Value
+type Predicate struct {
+	Field string
+	Value string
+}
+
+// And matches when every term matches
+type And struct {
+	Terms []Expr
+}
+
+// Or matches when any term matches
+type Or struct {
+	Terms []Expr
+}
+
+// Not matches when Expr does not
+type Not struct {
+	Expr Expr
+}
+
+func (p *Predicate) String() string {
+	if numericFields[p.Field] {
+		return p.Field + ":" + p.Value
+	}
+	return p.Field + ":" + strconv.Quote(p.Value)
+}
+
+func (a *And) String() string { return join(a.Terms, " && ") }
+func (o *Or) String() string  { return join(o.Terms, " || ") }
+func (n *Not) String() string {
+	if _, ok := n.Expr.(*Predicate); ok {
+		return "!" + n.Expr.String()
+	}
+	return "!(" + n.Expr.String() + ")"
+}
+
+func join(terms []Expr, sep string) string {
+	parts := make([]string, len(terms))
+	for i, term := range terms {
+		switch term.(type) {
+		case *And, *Or:
+			parts[i] = "(" + term.String() + ")"
+		default:
+			parts[i] = term.String()
+		}
+	}
+	return strings.Join(parts, sep)
+}
+
+// Predicates returns every predicate of expr in order
+func Predicates(expr Expr) []*Predicate {
+	var predicates []*Predicate
+	var walk func(Expr)
+	walk = func(e Expr) {
+		switch e := e.(type) {
+		case *Predicate:
+			predicates = append(predicates, e)
+		case *And:
+			for _, term := range e.Terms {
+				walk(term)
+			}
+		case *Or:
+			for _, term := range e.Terms {
+				walk(term)
+			}
+		case *Not:
+			walk(e.Expr)
+		}
+	}
+	walk(expr)
+	return predicates
+}
+
+// normalize validates a predicate value and puts it in canonical form
+func normalize(field, value string) (string, error) {
+	switch field {
+	case FieldPort:
+		port, err := strconv.Atoi(value)
+		if err != nil || port < 1 || port > 65535 {
+			return "", fmt.Errorf("invalid port %q", value)
+		}
+		return strconv.Itoa(port), nil
+	case FieldASN:
+		trimmed := strings.TrimPrefix(strings.ToUpper(value), "AS")
+		if _, err := strconv.ParseUint(trimmed, 10, 32); err != nil {
+			return "", fmt.Errorf("invalid asn %q", value)
+		}
+		return trimmed, nil
+	case FieldCountry:
+		if len(value) != 2 {
+			return "", fmt.Errorf("country must be a two letter code, got %q", value)
+		}
+		return strings.ToUpper(value), nil
+	}
+	if value == "" {
+		return "", fmt.Errorf("empty value for %s", field)
+	}
+	return value, nil
+}
+
+func knownField(field string) bool {
+	for _, f := range Fields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
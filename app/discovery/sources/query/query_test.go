@@ -0,0 +1,111 @@
+package query
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{`product:"nginx" && port:8443`, `product:"nginx" && port:8443`},
+		{`product:nginx port:8443`, `product:"nginx" && port:8443`},
+		{`asn:AS13335 AND country:us`, `asn:13335 && country:"US"`},
+		{`port:80 || port:443 && !title:"Index of"`, `port:80 || (port:443 && !title:"Index of")`},
+		{`(port:80 || port:443) && -country:CN`, `(port:80 || port:443) && !country:"CN"`},
+		{`NOT (org:"a b" OR hostname:x.example.com)`, `!(org:"a b" || hostname:"x.example.com")`},
+		{`!!cert.subject:"CN=\"x\""`, `cert.subject:"CN=\"x\""`},
+	}
+	for _, tt := range tests {
+		expr, err := Parse(tt.in)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.in, err)
+			continue
+		}
+		if got := expr.String(); got != tt.want {
+			t.Errorf("Parse(%q) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, in := range []string{
+		``,
+		`port:99999`,
+		`asn:cloudflare`,
+		`country:USA`,
+		`vendor:nginx`,
+		`product:"nginx`,
+		`(port:80`,
+		`port:80 ||`,
+		`nginx`,
+	} {
+		if _, err := Parse(in); err == nil {
+			t.Errorf("Parse(%q) succeeded", in)
+		}
+	}
+}
+
+func TestRender(t *testing.T) {
+	expr, err := Parse(`product:"nginx" && port:8443 && !country:CN`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[*Dialect]string{
+		Shodan:  `product:"nginx" port:8443 -country:"CN"`,
+		Censys:  `services.software.product: "nginx" and services.port: 8443 and not location.country_code: "CN"`,
+		Fofa:    `product="nginx" && port="8443" && country!="CN"`,
+		ZoomEye: `app:"nginx" +port:8443 +-country:"CN"`,
+		Hunter:  `app.name="nginx" && ip.port="8443" && ip.country!="CN"`,
+		Quake:   `app:"nginx" AND port:8443 AND NOT country:"CN"`,
+		Netlas:  `tag.name:"nginx" AND port:8443 AND NOT geo.country:"CN"`,
+	}
+	for dialect, w := range want {
+		got, err := dialect.Render(expr)
+		if err != nil {
+			t.Errorf("%s: %v", dialect.Name, err)
+			continue
+		}
+		if got != w {
+			t.Errorf("%s: got %s, want %s", dialect.Name, got, w)
+		}
+	}
+
+	expr, err = Parse(`(port:80 || port:443) && asn:13335`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := Quake.Render(expr); got != `(port:80 OR port:443) AND asn:13335` {
+		t.Errorf("quake: got %s", got)
+	}
+	if got, _ := Shodan.Render(&Predicate{Field: FieldASN, Value: "13335"}); got != `asn:AS13335` {
+		t.Errorf("shodan asn: got %s", got)
+	}
+}
+
+func TestRenderUnsupported(t *testing.T) {
+	expr, err := Parse(`body:"login" && (port:80 || port:8080) && !(title:a || title:b)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = Shodan.Render(expr)
+	var unsupported *UnsupportedError
+	if !errors.As(err, &unsupported) {
+		t.Fatalf("shodan: expected UnsupportedError, got %v", err)
+	}
+	if len(unsupported.Items) != 2 || unsupported.Items[0] != "OR" || unsupported.Items[1] != "negated groups" {
+		t.Errorf("shodan: unexpected items %v", unsupported.Items)
+	}
+
+	_, err = ZoomEye.Render(expr)
+	if !errors.As(err, &unsupported) || len(unsupported.Items) != 2 {
+		t.Fatalf("zoomeye: expected body and negated groups, got %v", err)
+	}
+
+	if _, err := Censys.Render(expr); err != nil {
+		t.Errorf("censys: %v", err)
+	}
+}
@@ -3,10 +3,13 @@ package discovery
 import (
 	"context"
 	"crypto/tls"
+	"errors"
 	"fmt"
 	"net/http"
 	"time"
 
+	"ghostshell/app/apikeys"
+	"ghostshell/app/httpcache"
 	"github.com/projectdiscovery/ratelimit"
 	"github.com/projectdiscovery/retryablehttp-go"
 	errorutil "github.com/projectdiscovery/utils/errors"
@@ -18,8 +21,18 @@ type Session struct {
 	Keys       *Keys
 	RateLimits *ratelimit.MultiLimiter
 	RetryMax   int
+
+	// KeyManager rotates keys across agents when set. Providers it holds no
+	// keys for fall back to Keys.
+	KeyManager *apikeys.Manager
+
+	// Cache serves repeated queries from disk when set through UseCache
+	Cache *httpcache.Cache
 }
 
+// StaticLabel labels keys taken from Keys rather than the KeyManager
+const StaticLabel = "static"
+
 // NewSession creates a new session with the specified parameters
 func NewSession(keys *Keys, retryMax, timeout, rateLimit int, engines []string, duration time.Duration) (*Session, error) {
 	// Configure HTTP transport
@@ -71,17 +84,77 @@ func NewSession(keys *Keys, retryMax, timeout, rateLimit int, engines []string,
 	return session, nil
 }
 
+// UseCache routes the session requests through cache
+func (s *Session) UseCache(cache *httpcache.Cache) {
+	s.Cache = cache
+	cache.Wrap(s.Client.HTTPClient)
+}
+
 // Do executes an HTTP request with rate-limiting
 func (s *Session) Do(request *retryablehttp.Request, source string) (*http.Response, error) {
-	if err := s.RateLimits.Take(source); err != nil {
+	response, _, err := s.send(request, source)
+	if err != nil {
 		return nil, err
 	}
-	response, err := s.Client.Do(request)
+	if response.StatusCode != http.StatusOK {
+		return response, fmt.Errorf("unexpected status code: %d", response.StatusCode)
+	}
+	return response, nil
+}
+
+// HasKey reports whether a key for provider is available
+func (s *Session) HasKey(provider string) bool {
+	if s.KeyManager != nil && len(s.KeyManager.Secrets(provider)) > 0 {
+		return true
+	}
+	if s.Keys == nil {
+		return false
+	}
+	_, ok := s.Keys.For(provider)
+	return ok
+}
+
+// Key returns the key to use for the next request to provider, rotating
+// through the KeyManager keys or falling back to the static Keys
+func (s *Session) Key(provider string) (apikeys.Key, error) {
+	if s.KeyManager != nil {
+		key, err := s.KeyManager.Next(provider)
+		if !errors.Is(err, apikeys.ErrNoKeys) {
+			return key, err
+		}
+	}
+	if s.Keys != nil {
+		if secret, ok := s.Keys.For(provider); ok {
+			return apikeys.Key{Provider: provider, Label: StaticLabel, Secret: secret}, nil
+		}
+	}
+	return apikeys.Key{}, fmt.Errorf("empty %s keys", provider)
+}
+
+// DoWithKey executes a request made with key and reports the answer to the
+// KeyManager, so throttled or exhausted keys leave the rotation
+func (s *Session) DoWithKey(request *retryablehttp.Request, source string, key apikeys.Key) (*http.Response, error) {
+	response, cached, err := s.send(request, source)
 	if err != nil {
 		return nil, err
 	}
+	// Cached answers cost the key nothing
+	if s.KeyManager != nil && key.Label != StaticLabel && !cached {
+		s.KeyManager.Report(key, response.StatusCode, response.Header)
+	}
 	if response.StatusCode != http.StatusOK {
 		return response, fmt.Errorf("unexpected status code: %d", response.StatusCode)
 	}
 	return response, nil
 }
+
+// send tags request with its source for the cache and sends it, reporting
+// whether the answer came from the cache
+func (s *Session) send(request *retryablehttp.Request, source string) (*http.Response, bool, error) {
+	if err := s.RateLimits.Take(source); err != nil {
+		return nil, false, err
+	}
+	ctx, hits := httpcache.WithProvider(request.Context(), source)
+	response, err := s.Client.Do(request.WithContext(ctx))
+	return response, hits.Count() > 0, err
+}
@@ -8,7 +8,8 @@ import (
 
 	"errors"
 
-	"github.com/projectdiscovery/uncover/sources"
+	sources "ghostshell/app/discovery/sources"
+	"ghostshell/app/discovery/sources/query"
 )
 
 const (
@@ -21,8 +22,13 @@ func (agent *Agent) Name() string {
 	return "shodan"
 }
 
+// Translate renders a neutral query in shodan syntax
+func (agent *Agent) Translate(expr query.Expr) (string, error) {
+	return query.Shodan.Render(expr)
+}
+
 func (agent *Agent) Query(session *sources.Session, query *sources.Query) (chan sources.Result, error) {
-	if session.Keys.Shodan == "" {
+	if !session.HasKey(agent.Name()) {
 		return nil, errors.New("empty shodan keys")
 	}
 	results := make(chan sources.Result)
@@ -59,12 +65,16 @@ func (agent *Agent) Query(session *sources.Session, query *sources.Query) (chan
 }
 
 func (agent *Agent) queryURL(session *sources.Session, URL string, shodanRequest *ShodanRequest) (*http.Response, error) {
-	shodanURL := fmt.Sprintf(URL, session.Keys.Shodan, url.QueryEscape(shodanRequest.Query), shodanRequest.Page)
+	key, err := session.Key(agent.Name())
+	if err != nil {
+		return nil, err
+	}
+	shodanURL := fmt.Sprintf(URL, key.Secret, url.QueryEscape(shodanRequest.Query), shodanRequest.Page)
 	request, err := sources.NewHTTPRequest(http.MethodGet, shodanURL, nil)
 	if err != nil {
 		return nil, err
 	}
-	return session.Do(request, agent.Name())
+	return session.DoWithKey(request, agent.Name(), key)
 }
 
 func (agent *Agent) query(URL string, session *sources.Session, shodanRequest *ShodanRequest, results chan sources.Result) *ShodanResponse {
@@ -0,0 +1,84 @@
+package shodan
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	sources "ghostshell/app/discovery/sources"
+	"ghostshell/app/httpcache"
+)
+
+// replaySession answers from the responses recorded in testdata/cache and
+// never touches the network
+func replaySession(t *testing.T) (*sources.Session, *httpcache.Cache) {
+	t.Helper()
+	config := httpcache.DefaultConfig
+	config.Mode = httpcache.ModeReplay
+	config.Dir = "testdata/cache"
+	cache, err := httpcache.New(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	session, err := sources.NewSession(&sources.Keys{Shodan: "test-key"}, 0, 5, 0, []string{"shodan"}, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	session.UseCache(cache)
+	return session, cache
+}
+
+func TestQueryReplay(t *testing.T) {
+	session, cache := replaySession(t)
+	results, err := (&Agent{}).Query(session, &sources.Query{Query: `product:"nginx"`, Limit: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []sources.Result
+	for result := range results {
+		if result.Error != nil {
+			t.Fatalf("unexpected error: %v", result.Error)
+		}
+		got = append(got, result)
+	}
+	want := []sources.Result{
+		{Source: "shodan", IP: "192.0.2.10", Port: 443, Host: "www.example.test"},
+		{Source: "shodan", IP: "192.0.2.11", Port: 8443},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d results, want %d", len(got), len(want))
+	}
+	for i, result := range got {
+		if result.Source != want[i].Source || result.IP != want[i].IP || result.Port != want[i].Port || result.Host != want[i].Host {
+			t.Errorf("result %d = %+v, want %+v", i, result, want[i])
+		}
+		if len(result.Raw) == 0 {
+			t.Errorf("result %d has no raw match", i)
+		}
+	}
+
+	if stats := cache.Stats()["shodan"]; stats.Hits != 1 || stats.Misses != 0 {
+		t.Errorf("unexpected cache stats %+v", stats)
+	}
+}
+
+func TestQueryReplayNotRecorded(t *testing.T) {
+	session, _ := replaySession(t)
+	results, err := (&Agent{}).Query(session, &sources.Query{Query: "port:22", Limit: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var errs int
+	for result := range results {
+		// The retrying client may flatten the error chain, so match the text
+		if result.Error == nil || !strings.Contains(result.Error.Error(), httpcache.ErrNotRecorded.Error()) {
+			t.Errorf("expected ErrNotRecorded, got %+v", result)
+		}
+		errs++
+	}
+	if errs != 1 {
+		t.Errorf("got %d errors, want 1", errs)
+	}
+}
@@ -8,8 +8,8 @@ import (
 
 	"errors"
 
+	sources "ghostshell/app/discovery/sources"
 	"github.com/projectdiscovery/mapcidr"
-	"github.com/projectdiscovery/uncover/sources"
 	iputil "github.com/projectdiscovery/utils/ip"
 )
 
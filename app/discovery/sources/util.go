@@ -0,0 +1,48 @@
+package discovery
+
+import (
+	"io"
+	"net/url"
+	"time"
+
+	"github.com/projectdiscovery/ratelimit"
+	"github.com/projectdiscovery/retryablehttp-go"
+)
+
+// UserAgent is sent with every agent request
+var UserAgent = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36"
+
+// DefaultRateLimits holds the per-engine request rates used by NewSession
+var DefaultRateLimits = map[string]*ratelimit.Options{
+	"shodan":     {Key: "shodan", MaxCount: 1, Duration: time.Second},
+	"shodan-idb": {Key: "shodan-idb", MaxCount: 1, Duration: time.Second},
+	"fofa":       {Key: "fofa", MaxCount: 1, Duration: time.Second},
+	"censys":     {Key: "censys", MaxCount: 1, Duration: 3 * time.Second},
+	"quake":      {Key: "quake", MaxCount: 1, Duration: time.Second},
+	"hunter":     {Key: "hunter", MaxCount: 15, Duration: time.Second},
+	"zoomeye":    {Key: "zoomeye", MaxCount: 1, Duration: time.Second},
+	"netlas":     {Key: "netlas", MaxCount: 1, Duration: time.Second},
+	"criminalip": {Key: "criminalip", MaxCount: 1, Duration: time.Second},
+	"publicwww":  {Key: "publicwww", MaxCount: 1, Duration: time.Minute},
+	"hunterhow":  {Key: "hunterhow", MaxCount: 1, Duration: 3 * time.Second},
+	"google":     {Key: "google", MaxCount: 1, Duration: time.Second},
+}
+
+// NewHTTPRequest creates a retryable request carrying UserAgent
+func NewHTTPRequest(method, url string, body io.Reader) (*retryablehttp.Request, error) {
+	request, err := retryablehttp.NewRequest(method, url, body)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("User-Agent", UserAgent)
+	return request, nil
+}
+
+// GetHostname returns the host name of a URL
+func GetHostname(u string) (string, error) {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return "", err
+	}
+	return parsed.Hostname(), nil
+}
@@ -10,7 +10,8 @@ import (
 
 	"errors"
 
-	"github.com/projectdiscovery/uncover/sources"
+	sources "ghostshell/app/discovery/sources"
+	"ghostshell/app/discovery/sources/query"
 )
 
 var (
@@ -23,12 +24,17 @@ func (agent *Agent) Name() string {
 	return "zoomeye"
 }
 
+// Translate renders a neutral query in zoomeye syntax
+func (agent *Agent) Translate(expr query.Expr) (string, error) {
+	return query.ZoomEye.Render(expr)
+}
+
 func (agent *Agent) Query(session *sources.Session, query *sources.Query) (chan sources.Result, error) {
-	if session.Keys.ZoomEyeHost != "" {
+	if session.Keys != nil && session.Keys.ZoomEyeHost != "" {
 		URL = strings.Replace(URL, "zoomeye.org", session.Keys.ZoomEyeHost, 1)
 	}
 
-	if session.Keys.ZoomEyeToken == "" {
+	if !session.HasKey(agent.Name()) {
 		return nil, errors.New("empty zoomeye keys")
 	}
 	results := make(chan sources.Result)
@@ -65,14 +71,18 @@ func (agent *Agent) Query(session *sources.Session, query *sources.Query) (chan
 }
 
 func (agent *Agent) queryURL(session *sources.Session, URL string, zoomeyeRequest *ZoomEyeRequest) (*http.Response, error) {
+	key, err := session.Key(agent.Name())
+	if err != nil {
+		return nil, err
+	}
 	zoomeyeURL := fmt.Sprintf(URL, url.QueryEscape(zoomeyeRequest.Query), zoomeyeRequest.Page)
 
 	request, err := sources.NewHTTPRequest(http.MethodGet, zoomeyeURL, nil)
 	if err != nil {
 		return nil, err
 	}
-	request.Header.Set("API-KEY", session.Keys.ZoomEyeToken)
-	return session.Do(request, agent.Name())
+	request.Header.Set("API-KEY", key.Secret)
+	return session.DoWithKey(request, agent.Name(), key)
 }
 
 func (agent *Agent) query(URL string, session *sources.Session, zoomeyeRequest *ZoomEyeRequest, results chan sources.Result) *ZoomEyeResponse {
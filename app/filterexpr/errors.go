@@ -0,0 +1,32 @@
+package filterexpr
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Error describes a problem in a filter expression and where it occurred
+type Error struct {
+	Expr   string // The full expression
+	Offset int    // Byte offset of the problem within Expr
+	Msg    string
+}
+
+func newError(expr string, offset int, format string, args ...interface{}) *Error {
+	return &Error{
+		Expr:   expr,
+		Offset: offset,
+		Msg:    fmt.Sprintf(format, args...),
+	}
+}
+
+// Error implements the error interface, e.g. `filter column 21: unknown field "sevice"`
+func (e *Error) Error() string {
+	return fmt.Sprintf("filter column %d: %s", e.Offset+1, e.Msg)
+}
+
+// Pretty returns the message followed by the expression with a caret under
+// the offending position, for display on a terminal
+func (e *Error) Pretty() string {
+	return fmt.Sprintf("%s\n  %s\n  %s^", e.Error(), e.Expr, strings.Repeat(" ", e.Offset))
+}
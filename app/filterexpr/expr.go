@@ -0,0 +1,550 @@
+// Package filterexpr implements the small boolean expression language used to
+// filter results in the nmap, webcrawler, httpcrawler and ghostcrawler tools,
+// for example:
+//
+//	port in [80, 443, 8000..8100] && service ~ "http" && !(state == "filtered")
+//
+// Expressions are type checked against a Schema describing the fields of the
+// result type they filter, so mistakes are reported before any result is seen.
+package filterexpr
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Type is the type of a field or literal
+type Type int
+
+const (
+	Int Type = iota + 1
+	String
+	Bool
+)
+
+// String returns the name of the type
+func (t Type) String() string {
+	switch t {
+	case Int:
+		return "int"
+	case String:
+		return "string"
+	case Bool:
+		return "bool"
+	default:
+		return "unknown"
+	}
+}
+
+// Schema maps the field names of a result type to their types
+type Schema map[string]Type
+
+// Fields returns the schema's field names in sorted order
+func (s Schema) Fields() []string {
+	names := make([]string, 0, len(s))
+	for name := range s {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Values holds the field values of a single result. Int fields accept any Go
+// integer type, missing fields evaluate to their zero value.
+type Values map[string]interface{}
+
+// Expr is a compiled, type checked filter expression
+type Expr struct {
+	src  string
+	root node
+}
+
+// Compile parses src and type checks it against the schema
+func Compile(src string, schema Schema) (*Expr, error) {
+	tokens, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{src: src, tokens: tokens, schema: schema}
+	if p.peek().kind == tokEOF {
+		return nil, newError(src, 0, "empty filter expression")
+	}
+
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tokEOF {
+		return nil, newError(src, tok.pos, "unexpected %s after complete expression", describe(tok))
+	}
+	if root.typ() != Bool {
+		return nil, newError(src, 0, "filter must be a condition, not a %s value", root.typ())
+	}
+
+	return &Expr{src: src, root: root}, nil
+}
+
+// MustCompile is like Compile but panics on error. It is meant for filters
+// that are constants in the source code.
+func MustCompile(src string, schema Schema) *Expr {
+	e, err := Compile(src, schema)
+	if err != nil {
+		panic(err)
+	}
+	return e
+}
+
+// Match evaluates the expression against the values of one result
+func (e *Expr) Match(values Values) bool {
+	if e == nil {
+		return true
+	}
+	return e.root.eval(values).(bool)
+}
+
+// String returns the source of the expression
+func (e *Expr) String() string {
+	if e == nil {
+		return ""
+	}
+	return e.src
+}
+
+// ---------------------------------------------------------------------------
+// AST
+
+type node interface {
+	typ() Type
+	eval(Values) interface{}
+}
+
+type fieldNode struct {
+	name string
+	t    Type
+}
+
+func (n *fieldNode) typ() Type { return n.t }
+
+func (n *fieldNode) eval(values Values) interface{} {
+	raw := values[n.name]
+	switch n.t {
+	case Int:
+		// Values that aren't whole numbers evaluate like a missing field
+		if v, ok := toInt(raw); ok {
+			return v
+		}
+		return int64(0)
+	case String:
+		switch s := raw.(type) {
+		case string:
+			return s
+		case fmt.Stringer:
+			return s.String()
+		case nil:
+			return ""
+		default:
+			return fmt.Sprint(s)
+		}
+	default:
+		b, _ := raw.(bool)
+		return b
+	}
+}
+
+type literalNode struct {
+	value interface{}
+	t     Type
+}
+
+func (n *literalNode) typ() Type { return n.t }
+
+func (n *literalNode) eval(Values) interface{} { return n.value }
+
+type notNode struct {
+	x node
+}
+
+func (n *notNode) typ() Type { return Bool }
+
+func (n *notNode) eval(values Values) interface{} { return !n.x.eval(values).(bool) }
+
+type logicNode struct {
+	and         bool
+	left, right node
+}
+
+func (n *logicNode) typ() Type { return Bool }
+
+func (n *logicNode) eval(values Values) interface{} {
+	left := n.left.eval(values).(bool)
+	if n.and {
+		return left && n.right.eval(values).(bool)
+	}
+	return left || n.right.eval(values).(bool)
+}
+
+type compareNode struct {
+	op          tokenKind
+	left, right node
+}
+
+func (n *compareNode) typ() Type { return Bool }
+
+func (n *compareNode) eval(values Values) interface{} {
+	l, r := n.left.eval(values), n.right.eval(values)
+	switch n.op {
+	case tokEq:
+		return l == r
+	case tokNe:
+		return l != r
+	}
+
+	var cmp int
+	switch lv := l.(type) {
+	case int64:
+		rv := r.(int64)
+		cmp = compareInts(lv, rv)
+	case string:
+		cmp = strings.Compare(lv, r.(string))
+	}
+	switch n.op {
+	case tokLt:
+		return cmp < 0
+	case tokLe:
+		return cmp <= 0
+	case tokGt:
+		return cmp > 0
+	default:
+		return cmp >= 0
+	}
+}
+
+type matchNode struct {
+	left   node
+	re     *regexp.Regexp
+	negate bool
+}
+
+func (n *matchNode) typ() Type { return Bool }
+
+func (n *matchNode) eval(values Values) interface{} {
+	return n.re.MatchString(n.left.eval(values).(string)) != n.negate
+}
+
+type inNode struct {
+	left   node
+	items  []interface{}
+	ranges [][2]int64
+}
+
+func (n *inNode) typ() Type { return Bool }
+
+func (n *inNode) eval(values Values) interface{} {
+	v := n.left.eval(values)
+	for _, item := range n.items {
+		if v == item {
+			return true
+		}
+	}
+	if i, ok := v.(int64); ok {
+		for _, r := range n.ranges {
+			if i >= r[0] && i <= r[1] {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func compareInts(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// toInt converts any Go integer (or whole float) to int64
+func toInt(v interface{}) (int64, bool) {
+	switch n := v.(type) {
+	case int:
+		return int64(n), true
+	case int8:
+		return int64(n), true
+	case int16:
+		return int64(n), true
+	case int32:
+		return int64(n), true
+	case int64:
+		return n, true
+	case uint:
+		return int64(n), true
+	case uint8:
+		return int64(n), true
+	case uint16:
+		return int64(n), true
+	case uint32:
+		return int64(n), true
+	case uint64:
+		return int64(n), true
+	case float32:
+		return int64(n), float32(int64(n)) == n
+	case float64:
+		return int64(n), float64(int64(n)) == n
+	}
+	return 0, false
+}
+
+// ---------------------------------------------------------------------------
+// Parser
+
+type parser struct {
+	src    string
+	tokens []token
+	pos    int
+	schema Schema
+}
+
+func (p *parser) peek() token { return p.tokens[p.pos] }
+
+func (p *parser) next() token {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokEOF {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *parser) expect(kind tokenKind) (token, error) {
+	tok := p.next()
+	if tok.kind != kind {
+		return tok, newError(p.src, tok.pos, "expected %s but found %s", kind, describe(tok))
+	}
+	return tok, nil
+}
+
+// parseOr parses `and ( "||" and )*`
+func (p *parser) parseOr() (node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().kind == tokOr {
+		op := p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.requireBool(op, left, right); err != nil {
+			return nil, err
+		}
+		left = &logicNode{and: false, left: left, right: right}
+	}
+	return left, nil
+}
+
+// parseAnd parses `unary ( "&&" unary )*`
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().kind == tokAnd {
+		op := p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.requireBool(op, left, right); err != nil {
+			return nil, err
+		}
+		left = &logicNode{and: true, left: left, right: right}
+	}
+	return left, nil
+}
+
+// parseUnary parses `"!" unary | condition`
+func (p *parser) parseUnary() (node, error) {
+	if p.peek().kind == tokNot {
+		op := p.next()
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		if x.typ() != Bool {
+			return nil, newError(p.src, op.pos, "! needs a condition, got a %s value", x.typ())
+		}
+		return &notNode{x: x}, nil
+	}
+	return p.parseCondition()
+}
+
+// parseCondition parses a parenthesised expression, a comparison or a bare operand
+func (p *parser) parseCondition() (node, error) {
+	if p.peek().kind == tokLParen {
+		p.next()
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := p.expect(tokRParen); err != nil {
+			return nil, err
+		}
+		return inner, nil
+	}
+
+	leftTok := p.peek()
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+
+	op := p.peek()
+	switch op.kind {
+	case tokEq, tokNe, tokLt, tokLe, tokGt, tokGe:
+		p.next()
+		rightTok := p.peek()
+		right, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		if left.typ() != right.typ() {
+			return nil, newError(p.src, rightTok.pos, "cannot compare %s with %s using %s", describeNode(leftTok, left), describeNode(rightTok, right), op.kind)
+		}
+		if op.kind != tokEq && op.kind != tokNe && left.typ() == Bool {
+			return nil, newError(p.src, op.pos, "%s cannot order bool values", op.kind)
+		}
+		return &compareNode{op: op.kind, left: left, right: right}, nil
+
+	case tokMatch, tokNotMatch:
+		p.next()
+		if left.typ() != String {
+			return nil, newError(p.src, op.pos, "%s needs a string on the left, got %s", op.kind, describeNode(leftTok, left))
+		}
+		patternTok, err := p.expect(tokString)
+		if err != nil {
+			return nil, newError(p.src, patternTok.pos, "%s needs a quoted regular expression, found %s", op.kind, describe(patternTok))
+		}
+		re, err := regexp.Compile(patternTok.text)
+		if err != nil {
+			return nil, newError(p.src, patternTok.pos, "invalid regular expression: %v", err)
+		}
+		return &matchNode{left: left, re: re, negate: op.kind == tokNotMatch}, nil
+
+	case tokIn:
+		p.next()
+		return p.parseList(leftTok, left)
+	}
+
+	if left.typ() != Bool {
+		return nil, newError(p.src, leftTok.pos, "%s is not a condition; compare it with ==, ~ or in", describeNode(leftTok, left))
+	}
+	return left, nil
+}
+
+// parseOperand parses a field reference or a literal
+func (p *parser) parseOperand() (node, error) {
+	tok := p.next()
+	switch tok.kind {
+	case tokIdent:
+		t, ok := p.schema[tok.text]
+		if !ok {
+			return nil, newError(p.src, tok.pos, "unknown field %q (known fields: %s)", tok.text, strings.Join(p.schema.Fields(), ", "))
+		}
+		return &fieldNode{name: tok.text, t: t}, nil
+	case tokInt:
+		return &literalNode{value: tok.num, t: Int}, nil
+	case tokString:
+		return &literalNode{value: tok.text, t: String}, nil
+	case tokTrue, tokFalse:
+		return &literalNode{value: tok.kind == tokTrue, t: Bool}, nil
+	}
+	return nil, newError(p.src, tok.pos, "expected a field or value but found %s", describe(tok))
+}
+
+// parseList parses `[ item ( "," item )* ]` where int items may be ranges `a..b`
+func (p *parser) parseList(leftTok token, left node) (node, error) {
+	if _, err := p.expect(tokLBracket); err != nil {
+		return nil, err
+	}
+
+	n := &inNode{left: left}
+	for p.peek().kind != tokRBracket {
+		itemTok := p.peek()
+		item, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		lit, ok := item.(*literalNode)
+		if !ok {
+			return nil, newError(p.src, itemTok.pos, "list items must be literal values")
+		}
+		if lit.t != left.typ() {
+			return nil, newError(p.src, itemTok.pos, "list item %s does not match %s", describe(itemTok), describeNode(leftTok, left))
+		}
+
+		if p.peek().kind == tokRange {
+			rangeTok := p.next()
+			if lit.t != Int {
+				return nil, newError(p.src, rangeTok.pos, "ranges are only allowed for int values")
+			}
+			high, err := p.expect(tokInt)
+			if err != nil {
+				return nil, err
+			}
+			if high.num < lit.value.(int64) {
+				return nil, newError(p.src, high.pos, "range end %d is lower than its start %d", high.num, lit.value)
+			}
+			n.ranges = append(n.ranges, [2]int64{lit.value.(int64), high.num})
+		} else {
+			n.items = append(n.items, lit.value)
+		}
+
+		if p.peek().kind != tokComma {
+			break
+		}
+		p.next()
+	}
+
+	if _, err := p.expect(tokRBracket); err != nil {
+		return nil, err
+	}
+	if len(n.items) == 0 && len(n.ranges) == 0 {
+		return nil, newError(p.src, leftTok.pos, "in needs at least one list item")
+	}
+	return n, nil
+}
+
+func (p *parser) requireBool(op token, left, right node) error {
+	if left.typ() != Bool || right.typ() != Bool {
+		return newError(p.src, op.pos, "%s joins conditions, not %s and %s values", op.kind, left.typ(), right.typ())
+	}
+	return nil
+}
+
+// describe renders a token for error messages
+func describe(tok token) string {
+	switch tok.kind {
+	case tokEOF:
+		return "end of expression"
+	case tokString:
+		return fmt.Sprintf("%q", tok.text)
+	case tokIdent:
+		return fmt.Sprintf("field %q", tok.text)
+	default:
+		return fmt.Sprintf("%q", tok.text)
+	}
+}
+
+// describeNode renders an operand together with its type for error messages
+func describeNode(tok token, n node) string {
+	if f, ok := n.(*fieldNode); ok {
+		return fmt.Sprintf("%s field %q", f.t, f.name)
+	}
+	return fmt.Sprintf("%s %s", n.typ(), describe(tok))
+}
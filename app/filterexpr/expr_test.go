@@ -0,0 +1,200 @@
+package filterexpr
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testSchema = Schema{
+	"port":        Int,
+	"service":     String,
+	"state":       String,
+	"open":        Bool,
+	"tls.version": String,
+}
+
+func TestMatch(t *testing.T) {
+	values := Values{
+		"port":        443,
+		"service":     "https",
+		"state":       "open",
+		"open":        true,
+		"tls.version": "TLSv1.3",
+	}
+
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{`port == 443`, true},
+		{`port != 443`, false},
+		{`port >= 443 && port < 444`, true},
+		{`port > 443 || port <= 442`, false},
+		{`port == -1`, false},
+		{`service == "https"`, true},
+		{`service == 'https'`, true},
+		{`service > "http"`, true},
+		{`service != "a\"b"`, true},
+		{`open`, true},
+		{`open == true`, true},
+		{`!open`, false},
+		{`open != false`, true},
+		{`tls.version == "TLSv1.3"`, true},
+
+		// Lists and ranges
+		{`port in [80, 443]`, true},
+		{`port in [80, 8443]`, false},
+		{`port in [8000..8100, 440..450]`, true},
+		{`port in [1..100]`, false},
+		{`port in [443..443]`, true},
+		{`service in ["ssh", 'https']`, true},
+		{`!(port in [1..1024])`, false},
+
+		// Regular expressions
+		{`service ~ "^http"`, true},
+		{`service !~ "^http"`, false},
+		{`service =~ "s$"`, true},
+		{`state ~ "(?i)OPEN"`, true},
+		{`state !~ "^(closed|filtered)$"`, true},
+		{`tls.version ~ "v1\.[23]$"`, true},
+
+		// Precedence: ! binds tightest, then &&, then ||
+		{`open || port == 1 && state == "x"`, true},
+		{`(open || port == 1) && state == "x"`, false},
+		{`!open || port == 443`, true},
+		{`not open or state == "closed"`, false},
+		{`open and (state == "filtered" or port != 80)`, true},
+	}
+	for _, tt := range tests {
+		e, err := Compile(tt.expr, testSchema)
+		if err != nil {
+			t.Errorf("Compile(%s): %v", tt.expr, err)
+			continue
+		}
+		if got := e.Match(values); got != tt.want {
+			t.Errorf("%s = %v, want %v", tt.expr, got, tt.want)
+		}
+		if e.String() != tt.expr {
+			t.Errorf("String() = %q, want %q", e.String(), tt.expr)
+		}
+	}
+}
+
+func TestMatchValueTypes(t *testing.T) {
+	tests := []struct {
+		expr   string
+		values Values
+		want   bool
+	}{
+		// Missing fields are their zero value
+		{`port == 0 && service == "" && !open`, Values{}, true},
+		// Any integer type, or a whole float as decoded from JSON, is an int
+		{`port == 443`, Values{"port": uint16(443)}, true},
+		{`port == 443`, Values{"port": int64(443)}, true},
+		{`port == 443`, Values{"port": float64(443)}, true},
+		{`port == 443`, Values{"port": 443.5}, false},
+		// Strings accept Stringers and anything else printable
+		{`service == "1m0s"`, Values{"service": time.Minute}, true},
+		{`service == "42"`, Values{"service": 42}, true},
+		// A non-bool value for a bool field is false
+		{`open`, Values{"open": "yes"}, false},
+	}
+	for _, tt := range tests {
+		if got := MustCompile(tt.expr, testSchema).Match(tt.values); got != tt.want {
+			t.Errorf("%s with %v = %v, want %v", tt.expr, tt.values, got, tt.want)
+		}
+	}
+
+	var nilExpr *Expr
+	if !nilExpr.Match(Values{}) || nilExpr.String() != "" {
+		t.Error("a nil expression should match everything")
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	tests := []struct {
+		expr string
+		want string
+	}{
+		// Syntax
+		{``, `filter column 1: empty filter expression`},
+		{`   `, `filter column 1: empty filter expression`},
+		{`service == "http`, `filter column 12: unterminated string`},
+		{`port == 80 # x`, `filter column 12: unexpected character "#"`},
+		{`99999999999999999999 == port`, `filter column 1: invalid number "99999999999999999999"`},
+		{`port ==`, `filter column 8: expected a field or value but found end of expression`},
+		{`(open`, `filter column 6: expected ) but found end of expression`},
+		{`open open`, `filter column 6: unexpected field "open" after complete expression`},
+		{`port in 80`, `filter column 9: expected [ but found "80"`},
+		{`port in [80`, `filter column 12: expected ] but found end of expression`},
+
+		// Fields
+		{`sevice == "http"`, `filter column 1: unknown field "sevice" (known fields: open, port, service, state, tls.version)`},
+
+		// Types
+		{`port`, `filter column 1: int field "port" is not a condition; compare it with ==, ~ or in`},
+		{`80`, `filter column 1: int "80" is not a condition; compare it with ==, ~ or in`},
+		{`open && service`, `filter column 9: string field "service" is not a condition; compare it with ==, ~ or in`},
+		{`!port`, `filter column 2: int field "port" is not a condition; compare it with ==, ~ or in`},
+		{`port == "80"`, `filter column 9: cannot compare int field "port" with string "80" using ==`},
+		{`"http" != 80`, `filter column 11: cannot compare string "http" with int "80" using !=`},
+		{`open < true`, `filter column 6: < cannot order bool values`},
+
+		// Regular expressions
+		{`port ~ "8"`, `filter column 6: ~ needs a string on the left, got int field "port"`},
+		{`service !~ 80`, `filter column 12: !~ needs a quoted regular expression, found "80"`},
+		{`service ~ state`, `filter column 11: ~ needs a quoted regular expression, found field "state"`},
+
+		// Lists and ranges
+		{`port in []`, `filter column 1: in needs at least one list item`},
+		{`port in [80, "http"]`, `filter column 14: list item "http" does not match int field "port"`},
+		{`port in [80, port]`, `filter column 14: list items must be literal values`},
+		{`port in [443..80]`, `filter column 15: range end 80 is lower than its start 443`},
+		{`port in [1.."9"]`, `filter column 13: expected number but found "9"`},
+		{`service in ["a".."b"]`, `filter column 16: ranges are only allowed for int values`},
+	}
+	for _, tt := range tests {
+		_, err := Compile(tt.expr, testSchema)
+		if err == nil {
+			t.Errorf("Compile(%s): expected an error", tt.expr)
+			continue
+		}
+		if err.Error() != tt.want {
+			t.Errorf("Compile(%s):\n got %s\nwant %s", tt.expr, err, tt.want)
+		}
+		var ferr *Error
+		if !errors.As(err, &ferr) || ferr.Expr != tt.expr {
+			t.Errorf("Compile(%s): got %T, want *Error for the expression", tt.expr, err)
+		}
+	}
+
+	_, err := Compile(`service ~ "("`, testSchema)
+	if err == nil || !strings.HasPrefix(err.Error(), "filter column 11: invalid regular expression: ") {
+		t.Errorf("unexpected error for an invalid regular expression: %v", err)
+	}
+}
+
+func TestErrorPretty(t *testing.T) {
+	_, err := Compile(`port == "80"`, testSchema)
+	var ferr *Error
+	if !errors.As(err, &ferr) {
+		t.Fatalf("got %v", err)
+	}
+	want := "filter column 9: cannot compare int field \"port\" with string \"80\" using ==\n" +
+		"  port == \"80\"\n" +
+		"          ^"
+	if got := ferr.Pretty(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestMustCompilePanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("expected MustCompile to panic on an invalid expression")
+		}
+	}()
+	MustCompile(`port ==`, testSchema)
+}
@@ -0,0 +1,213 @@
+package filterexpr
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// tokenKind identifies the lexical class of a token
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokInt
+	tokString
+	tokTrue
+	tokFalse
+	tokIn
+	tokAnd      // &&
+	tokOr       // ||
+	tokNot      // !
+	tokEq       // ==
+	tokNe       // !=
+	tokLt       // <
+	tokLe       // <=
+	tokGt       // >
+	tokGe       // >=
+	tokMatch    // ~
+	tokNotMatch // !~
+	tokLParen
+	tokRParen
+	tokLBracket
+	tokRBracket
+	tokComma
+	tokRange // ..
+)
+
+var tokenNames = map[tokenKind]string{
+	tokEOF:      "end of expression",
+	tokIdent:    "field name",
+	tokInt:      "number",
+	tokString:   "string",
+	tokTrue:     "true",
+	tokFalse:    "false",
+	tokIn:       "in",
+	tokAnd:      "&&",
+	tokOr:       "||",
+	tokNot:      "!",
+	tokEq:       "==",
+	tokNe:       "!=",
+	tokLt:       "<",
+	tokLe:       "<=",
+	tokGt:       ">",
+	tokGe:       ">=",
+	tokMatch:    "~",
+	tokNotMatch: "!~",
+	tokLParen:   "(",
+	tokRParen:   ")",
+	tokLBracket: "[",
+	tokRBracket: "]",
+	tokComma:    ",",
+	tokRange:    "..",
+}
+
+func (k tokenKind) String() string {
+	if name, ok := tokenNames[k]; ok {
+		return name
+	}
+	return fmt.Sprintf("token(%d)", int(k))
+}
+
+// token is a lexical token with its byte offset in the source expression
+type token struct {
+	kind tokenKind
+	text string
+	num  int64
+	pos  int
+}
+
+// lex splits an expression into tokens
+func lex(src string) ([]token, error) {
+	var tokens []token
+	i := 0
+	for i < len(src) {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+			continue
+
+		case isIdentStart(c):
+			start := i
+			// Dotted names such as tls.version are a single field
+			for i < len(src) && (isIdentPart(src[i]) || src[i] == '.' && i+1 < len(src) && isIdentStart(src[i+1])) {
+				i++
+			}
+			word := src[start:i]
+			kind := tokIdent
+			switch word {
+			case "true":
+				kind = tokTrue
+			case "false":
+				kind = tokFalse
+			case "in":
+				kind = tokIn
+			case "and":
+				kind = tokAnd
+			case "or":
+				kind = tokOr
+			case "not":
+				kind = tokNot
+			}
+			tokens = append(tokens, token{kind: kind, text: word, pos: start})
+			continue
+
+		case c >= '0' && c <= '9' || (c == '-' && i+1 < len(src) && src[i+1] >= '0' && src[i+1] <= '9'):
+			start := i
+			i++
+			for i < len(src) && src[i] >= '0' && src[i] <= '9' {
+				i++
+			}
+			n, err := strconv.ParseInt(src[start:i], 10, 64)
+			if err != nil {
+				return nil, newError(src, start, "invalid number %q", src[start:i])
+			}
+			tokens = append(tokens, token{kind: tokInt, text: src[start:i], num: n, pos: start})
+			continue
+
+		case c == '"' || c == '\'':
+			start := i
+			text, n, err := readString(src[i:])
+			if err != nil {
+				return nil, newError(src, start, "%v", err)
+			}
+			i += n
+			tokens = append(tokens, token{kind: tokString, text: text, pos: start})
+			continue
+		}
+
+		kind, width := operator(src[i:])
+		if width == 0 {
+			return nil, newError(src, i, "unexpected character %q", string(c))
+		}
+		tokens = append(tokens, token{kind: kind, text: src[i : i+width], pos: i})
+		i += width
+	}
+
+	tokens = append(tokens, token{kind: tokEOF, pos: len(src)})
+	return tokens, nil
+}
+
+// operator recognises the punctuation tokens at the start of s
+func operator(s string) (tokenKind, int) {
+	two := map[string]tokenKind{
+		"&&": tokAnd, "||": tokOr, "==": tokEq, "!=": tokNe,
+		"<=": tokLe, ">=": tokGe, "!~": tokNotMatch, "=~": tokMatch, "..": tokRange,
+	}
+	if len(s) >= 2 {
+		if kind, ok := two[s[:2]]; ok {
+			return kind, 2
+		}
+	}
+
+	one := map[byte]tokenKind{
+		'!': tokNot, '<': tokLt, '>': tokGt, '~': tokMatch, '=': tokEq,
+		'(': tokLParen, ')': tokRParen, '[': tokLBracket, ']': tokRBracket, ',': tokComma,
+	}
+	if kind, ok := one[s[0]]; ok {
+		return kind, 1
+	}
+	return tokEOF, 0
+}
+
+// readString reads a quoted string literal and returns its value and width
+func readString(s string) (string, int, error) {
+	quote := s[0]
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == quote:
+			return b.String(), i + 1, nil
+		case c == '\\' && i+1 < len(s):
+			i++
+			switch s[i] {
+			case 'n':
+				b.WriteByte('\n')
+			case 't':
+				b.WriteByte('\t')
+			case 'r':
+				b.WriteByte('\r')
+			default:
+				// \" \' \\ and regex escapes such as \d are kept literally
+				if s[i] != quote && s[i] != '\\' {
+					b.WriteByte('\\')
+				}
+				b.WriteByte(s[i])
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", 0, fmt.Errorf("unterminated string")
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isIdentPart(c byte) bool {
+	return isIdentStart(c) || (c >= '0' && c <= '9')
+}
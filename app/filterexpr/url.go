@@ -0,0 +1,73 @@
+package filterexpr
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// URLSchema lists the fields available to filter expressions on crawled URLs,
+// shared by the webcrawler and ghostcrawler tools
+var URLSchema = Schema{
+	"url":    String,
+	"scheme": String,
+	"host":   String,
+	"port":   Int,
+	"path":   String,
+	"query":  String,
+	"ext":    String,
+	"depth":  Int,
+}
+
+// defaultPorts are the ports of URLs that don't name one
+var defaultPorts = map[string]int{
+	"http":  80,
+	"https": 443,
+}
+
+// URLFilter selects crawled URLs with an expression over URLSchema. The zero
+// value matches every URL.
+type URLFilter struct {
+	Expression *Expr
+}
+
+// SetExpression compiles expr against URLSchema. An empty expression clears it
+func (f *URLFilter) SetExpression(expr string) error {
+	if expr == "" {
+		f.Expression = nil
+		return nil
+	}
+	compiled, err := Compile(expr, URLSchema)
+	if err != nil {
+		return err
+	}
+	f.Expression = compiled
+	return nil
+}
+
+// MatchURL reports whether a URL found at the given crawl depth matches the expression
+func (f *URLFilter) MatchURL(rawURL string, depth int) bool {
+	return f == nil || f.Expression == nil || f.Expression.Match(URLValues(rawURL, depth))
+}
+
+// URLValues exposes a crawled URL to filter expressions
+func URLValues(rawURL string, depth int) Values {
+	values := Values{"url": rawURL, "depth": depth}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return values
+	}
+	values["scheme"] = u.Scheme
+	values["host"] = u.Hostname()
+	if port, err := strconv.Atoi(u.Port()); err == nil {
+		values["port"] = port
+	} else if port, ok := defaultPorts[strings.ToLower(u.Scheme)]; ok {
+		values["port"] = port
+	}
+	values["path"] = u.Path
+	values["query"] = u.RawQuery
+	if i := strings.LastIndex(u.Path, "."); i >= 0 && !strings.Contains(u.Path[i:], "/") {
+		values["ext"] = strings.ToLower(u.Path[i+1:])
+	}
+	return values
+}
@@ -0,0 +1,92 @@
+package filterexpr
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestURLValues(t *testing.T) {
+	tests := []struct {
+		url  string
+		want Values
+	}{
+		{"https://Example.com:8443/a/b/File.PHP?x=1&y=2", Values{
+			"url": "https://Example.com:8443/a/b/File.PHP?x=1&y=2", "depth": 2,
+			"scheme": "https", "host": "Example.com", "port": 8443,
+			"path": "/a/b/File.PHP", "query": "x=1&y=2", "ext": "php",
+		}},
+		{"http://example.com/v1.2/", Values{
+			"url": "http://example.com/v1.2/", "depth": 2,
+			"scheme": "http", "host": "example.com", "port": 80,
+			"path": "/v1.2/", "query": "",
+		}},
+		// Only schemes with a well-known port get one by default
+		{"ftp://example.com/", Values{
+			"url": "ftp://example.com/", "depth": 2,
+			"scheme": "ftp", "host": "example.com", "path": "/", "query": "",
+		}},
+		// An unparseable URL only exposes the raw URL and depth
+		{"http://[::1", Values{"url": "http://[::1", "depth": 2}},
+	}
+	for _, tt := range tests {
+		if got := URLValues(tt.url, 2); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("URLValues(%s) = %v, want %v", tt.url, got, tt.want)
+		}
+	}
+}
+
+func TestURLFilter(t *testing.T) {
+	var f URLFilter
+	if !f.MatchURL("https://example.com/", 0) {
+		t.Error("the zero URLFilter should match everything")
+	}
+
+	if err := f.SetExpression(`host == "example.com" && ext in ["js", "php"] && depth <= 1`); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		url   string
+		depth int
+		want  bool
+	}{
+		{"https://example.com/app.js", 1, true},
+		{"https://example.com/index.PHP?id=1", 0, true},
+		{"https://example.com/app.js", 2, false},
+		{"https://cdn.example.com/app.js", 1, false},
+		{"https://example.com/", 0, false},
+	}
+	for _, tt := range tests {
+		if got := f.MatchURL(tt.url, tt.depth); got != tt.want {
+			t.Errorf("MatchURL(%s, %d) = %v, want %v", tt.url, tt.depth, got, tt.want)
+		}
+	}
+
+	if err := f.SetExpression(`port in [80,443]`); err != nil {
+		t.Fatal(err)
+	}
+	for url, want := range map[string]bool{
+		"https://example.com/":      true,
+		"http://example.com:80/":    true,
+		"http://example.com:8080/":  false,
+		"https://example.com:8443/": false,
+	} {
+		if got := f.MatchURL(url, 0); got != want {
+			t.Errorf("port filter MatchURL(%s) = %v, want %v", url, got, want)
+		}
+	}
+
+	if err := f.SetExpression(`status == 200`); err == nil {
+		t.Error("expected a field outside URLSchema to fail")
+	}
+	if f.Expression == nil {
+		t.Error("a failed SetExpression should keep the previous expression")
+	}
+	if err := f.SetExpression(""); err != nil || f.Expression != nil {
+		t.Errorf("an empty expression should clear the filter: %v", err)
+	}
+
+	var nilFilter *URLFilter
+	if !nilFilter.MatchURL("https://example.com/", 0) {
+		t.Error("a nil URLFilter should match everything")
+	}
+}
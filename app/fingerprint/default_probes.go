@@ -0,0 +1,86 @@
+package fingerprint
+
+// defaultProbes is a compact probe set in nmap-service-probes format covering
+// the services GhostShell runs into most often. Point LoadDatabase at a full
+// nmap-service-probes file for broader coverage.
+const defaultProbes = `
+# GhostShell built-in service probes
+Exclude T:9100-9107
+
+##############################NEXT PROBE##############################
+Probe TCP NULL q||
+totalwaitms 6000
+tcpwrappedms 3000
+
+match ssh m|^SSH-([\d.]+)-OpenSSH[_-]([\w.]+)[ -]?([^\r\n]*)\r?\n| p/OpenSSH/ v/$2/ i/protocol $1; $3/ cpe:/a:openbsd:openssh:$2/
+match ssh m|^SSH-([\d.]+)-dropbear_([\w.]+)\r?\n| p/Dropbear sshd/ v/$2/ i/protocol $1/ cpe:/a:matt_johnston:dropbear_ssh_server:$2/
+softmatch ssh m|^SSH-([\d.]+)-| i/protocol $1/
+
+match ftp m|^220[- ].*FileZilla Server(?: version)? ([\w.-]+)|s p/FileZilla ftpd/ v/$1/ o/Windows/ cpe:/a:filezilla-project:filezilla_server:$1/ cpe:/o:microsoft:windows/a
+match ftp m|^220 \(vsFTPd ([\w.]+)\)\r\n| p/vsftpd/ v/$1/ o/Unix/ cpe:/a:vsftpd:vsftpd:$1/
+match ftp m|^220 ProFTPD ([\w.]+) Server| p/ProFTPD/ v/$1/ cpe:/a:proftpd:proftpd:$1/
+softmatch ftp m|^220[- ][^\r\n]*ftp|i
+
+match smtp m|^220 ([\w.-]+) ESMTP Postfix| p/Postfix smtpd/ h/$1/ cpe:/a:postfix:postfix/a
+match smtp m|^220 ([\w.-]+) ESMTP Exim ([\d.]+)| p/Exim smtpd/ v/$2/ h/$1/ cpe:/a:exim:exim:$2/
+softmatch smtp m|^220[- ][^\r\n]*E?SMTP|i
+
+match pop3 m|^\+OK Dovecot (?:\([^)]+\) )?ready\.\r\n| p/Dovecot pop3d/ cpe:/a:dovecot:dovecot/
+softmatch pop3 m|^\+OK |
+match imap m|^\* OK (?:\[[^\]]*\] )?Dovecot (?:\([^)]+\) )?ready\.\r\n| p/Dovecot imapd/ cpe:/a:dovecot:dovecot/
+softmatch imap m|^\* OK |
+
+match mysql m|^.\0\0\0\x0a([\d.]+)-MariaDB|s p/MariaDB/ v/$1/ cpe:/a:mariadb:mariadb:$1/
+match mysql m|^.\0\0\0\x0a(\d\.[\d.]+)[^\0]*\0|s p/MySQL/ v/$1/ cpe:/a:mysql:mysql:$1/
+match vnc m|^RFB (\d\d\d)\.(\d\d\d)\n| p/VNC/ i/protocol $1.$2/
+match telnet m|^\xff[\xfb-\xfe]|s p/telnetd/
+
+##############################NEXT PROBE##############################
+Probe TCP GetRequest q|GET / HTTP/1.0\r\n\r\n|
+rarity 1
+ports 80-85,88,443,631,3000,5000,5601,7080,8000-8010,8080-8090,8443,8888,9000,9090,9200,9443
+sslports 443,8443,9443
+
+match http m|^HTTP/1\.[01] \d\d\d .*?\r\nServer: nginx/([\d.]+)|s p/nginx/ v/$1/ cpe:/a:igor_sysoev:nginx:$1/
+match http m|^HTTP/1\.[01] \d\d\d .*?\r\nServer: nginx\r\n|s p/nginx/ cpe:/a:igor_sysoev:nginx/
+match http m|^HTTP/1\.[01] \d\d\d .*?\r\nServer: Apache/([\d.]+) \(([^)]+)\)|s p/Apache httpd/ v/$1/ i/$2/ cpe:/a:apache:http_server:$1/
+match http m|^HTTP/1\.[01] \d\d\d .*?\r\nServer: Apache/([\d.]+)|s p/Apache httpd/ v/$1/ cpe:/a:apache:http_server:$1/
+match http m|^HTTP/1\.[01] \d\d\d .*?\r\nServer: Microsoft-IIS/([\d.]+)|s p/Microsoft IIS httpd/ v/$1/ o/Windows/ cpe:/a:microsoft:internet_information_services:$1/ cpe:/o:microsoft:windows/a
+match http m|^HTTP/1\.[01] \d\d\d .*?\r\nServer: lighttpd/([\d.]+)|s p/lighttpd/ v/$1/ cpe:/a:lighttpd:lighttpd:$1/
+match http m|^HTTP/1\.[01] \d\d\d .*?\r\nServer: Caddy\r\n|s p/Caddy httpd/ cpe:/a:caddyserver:caddy/
+match http m|^HTTP/1\.[01] \d\d\d .*?\r\nX-Elastic-Product: Elasticsearch\r\n|s p/Elasticsearch REST API/ cpe:/a:elastic:elasticsearch/
+match http m|^HTTP/1\.[01] \d\d\d .*?\r\nServer: ([^\r\n]+)\r\n|s p/$P(1)/
+softmatch http m|^HTTP/1\.[01] \d\d\d |
+
+##############################NEXT PROBE##############################
+Probe TCP SSLSessionReq q|\x16\x03\x01\x00\x4f\x01\x00\x00\x4b\x03\x03\x00\x01\x02\x03\x04\x05\x06\x07\x08\x09\x0a\x0b\x0c\x0d\x0e\x0f\x10\x11\x12\x13\x14\x15\x16\x17\x18\x19\x1a\x1b\x1c\x1d\x1e\x1f\x00\x00\x08\xc0\x2f\xc0\x2b\x00\x9c\x00\x2f\x01\x00\x00\x1a\x00\x0a\x00\x04\x00\x02\x00\x17\x00\x0b\x00\x02\x01\x00\x00\x0d\x00\x08\x00\x06\x04\x01\x04\x03\x08\x04|
+rarity 1
+ports 443,465,636,993,995,8443,9443
+fallback GetRequest
+
+match ssl m|^\x16\x03[\x00-\x04]..\x02|s
+match ssl m|^\x15\x03[\x00-\x04]\x00\x02[\x01\x02]|s
+
+##############################NEXT PROBE##############################
+Probe TCP TerminalServerCookie q|\x03\0\0\x2b\x26\xe0\0\0\0\0\0Cookie: mstshash=ghost\r\n\x01\0\x08\0\x03\0\0\0|
+rarity 7
+ports 3388,3389
+
+match ms-wbt-server m|^\x03\0\0[\x0b\x13]\x0e\xd0|s p/Microsoft Terminal Services/ o/Windows/ cpe:/o:microsoft:windows/a
+
+##############################NEXT PROBE##############################
+Probe TCP redis-server q|*1\r\n$4\r\ninfo\r\n|
+rarity 8
+ports 6379
+
+match redis m|^\$\d+\r\n# Server\r\nredis_version:([\d.]+)\r\n| p/Redis key-value store/ v/$1/ cpe:/a:redislabs:redis:$1/
+match redis m|^-NOAUTH Authentication required| p/Redis key-value store/ i/authentication required/ cpe:/a:redislabs:redis/
+
+##############################NEXT PROBE##############################
+Probe UDP DNSVersionBindReq q|\0\x06\x01\0\0\x01\0\0\0\0\0\0\x07version\x04bind\0\0\x10\0\x03|
+rarity 1
+ports 53
+
+match domain m|^\0\x06[\x81\x84\x85][\x80-\x8f].*?version\x04bind.*?(9\.[\w.+-]+)|s p/ISC BIND/ v/$1/ cpe:/a:isc:bind:$1/
+softmatch domain m|^\0\x06[\x81\x84\x85]|s
+`
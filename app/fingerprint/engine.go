@@ -0,0 +1,379 @@
+package fingerprint
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Config holds the tunables for service detection
+type Config struct {
+	Intensity   int           // Highest probe rarity tried on ports a probe is not registered for (0-9)
+	DialTimeout time.Duration // Timeout for establishing each probe connection
+	ReadTimeout time.Duration // Upper bound on how long to wait for a probe response
+	ReadGrace   time.Duration // How long to keep reading once a response has started
+	MaxResponse int           // Maximum number of response bytes kept per probe
+	TryTLS      bool          // Re-run detection inside TLS when the ssl service is found
+}
+
+// DefaultConfig provides default settings for service detection
+var DefaultConfig = Config{
+	Intensity:   7,
+	DialTimeout: 5 * time.Second,
+	ReadTimeout: 5 * time.Second,
+	ReadGrace:   300 * time.Millisecond,
+	MaxResponse: 64 * 1024,
+	TryTLS:      true,
+}
+
+// Engine identifies services by sending probes from a probe database
+type Engine struct {
+	db     *Database
+	config Config
+	dialer *net.Dialer
+}
+
+// NewEngine creates a new Engine. A nil database uses the built-in probes
+// and a nil config uses DefaultConfig.
+func NewEngine(db *Database, config *Config) *Engine {
+	if db == nil {
+		db = DefaultDatabase()
+	}
+	cfg := DefaultConfig
+	if config != nil {
+		cfg = *config
+	}
+	if cfg.ReadTimeout <= 0 {
+		cfg.ReadTimeout = DefaultConfig.ReadTimeout
+	}
+	if cfg.MaxResponse <= 0 {
+		cfg.MaxResponse = DefaultConfig.MaxResponse
+	}
+
+	return &Engine{
+		db:     db,
+		config: cfg,
+		dialer: &net.Dialer{Timeout: cfg.DialTimeout},
+	}
+}
+
+// response is what a single probe connection produced
+type response struct {
+	data    []byte
+	closed  bool
+	elapsed time.Duration
+}
+
+// Identify probes host:port and returns the identified service. An error is
+// only returned when the port cannot be reached at all.
+func (e *Engine) Identify(ctx context.Context, host string, port int, protocol string) (*ServiceInfo, error) {
+	protocol = strings.ToLower(protocol)
+	if protocol == "" {
+		protocol = "tcp"
+	}
+	if protocol != "tcp" && protocol != "udp" {
+		return nil, fmt.Errorf("unsupported protocol: %s", protocol)
+	}
+	if e.db.Exclude.ContainsProto(protocol, port) {
+		return nil, fmt.Errorf("port %d/%s is excluded by the probe database", port, protocol)
+	}
+
+	info, err := e.identify(ctx, host, port, protocol, false)
+	if err != nil {
+		return nil, err
+	}
+
+	if info.Service == "ssl" && e.config.TryTLS && protocol == "tcp" {
+		if inner, err := e.identify(ctx, host, port, protocol, true); err == nil && inner.Service != "unknown" {
+			inner.Tunnel = "ssl"
+			info = inner
+		}
+	}
+
+	info.Host = host
+	info.Port = port
+	info.Protocol = protocol
+	return info, nil
+}
+
+// IdentifyAll identifies the services on several ports of one host concurrently.
+// Ports that could not be reached are left out of the returned map.
+func (e *Engine) IdentifyAll(ctx context.Context, host string, ports []int, protocol string, concurrency int) map[int]*ServiceInfo {
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		jobs    = make(chan int)
+		results = make(map[int]*ServiceInfo, len(ports))
+	)
+
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for port := range jobs {
+				info, err := e.Identify(ctx, host, port, protocol)
+				if err != nil {
+					continue
+				}
+				mu.Lock()
+				results[port] = info
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for _, port := range ports {
+		if ctx.Err() != nil {
+			break
+		}
+		jobs <- port
+	}
+	close(jobs)
+	wg.Wait()
+
+	return results
+}
+
+// MatchResponse matches an already captured response against the named probe
+// and its fallbacks, returning nil when nothing matches
+func (e *Engine) MatchResponse(protocol, probeName string, data []byte) *ServiceInfo {
+	probe := e.db.ProbeByName(strings.ToLower(protocol), probeName)
+	if probe == nil || len(data) == 0 {
+		return nil
+	}
+
+	hard, soft := probe.match(toLatin1(data))
+	info := hard
+	if info == nil {
+		info = soft
+	}
+	if info != nil {
+		info.Probe = probe.Name
+		info.Protocol = probe.Protocol
+		info.Banner = bannerText(data)
+	}
+	return info
+}
+
+func (e *Engine) identify(ctx context.Context, host string, port int, protocol string, useTLS bool) (*ServiceInfo, error) {
+	var probes []*Probe
+	if protocol == "tcp" {
+		if null := e.db.ProbeByName("tcp", "NULL"); null != nil {
+			probes = append(probes, null)
+		}
+	}
+	probes = append(probes, e.db.ordered(protocol, port, e.config.Intensity)...)
+
+	var (
+		soft      *ServiceInfo
+		banner    []byte
+		wrapped   bool
+		reachable bool
+		lastErr   error
+	)
+
+	for _, probe := range probes {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if soft != nil && !probe.canMatch(soft.Service) {
+			continue
+		}
+		if protocol == "udp" && (len(probe.Payload) == 0 || probe.NoPayload) {
+			// no-payload probes must not be sent blind to UDP ports
+			continue
+		}
+
+		resp, err := e.send(ctx, host, port, protocol, probe, useTLS)
+		if err != nil {
+			lastErr = err
+			if !reachable && protocol == "tcp" && isDialError(err) {
+				// A refused or unroutable connection will not improve with more probes
+				return nil, err
+			}
+			continue
+		}
+		reachable = true
+
+		if len(resp.data) == 0 {
+			if probe.Name == "NULL" && resp.closed && probe.TCPWrapped > 0 && resp.elapsed < probe.TCPWrapped {
+				wrapped = true
+			}
+			continue
+		}
+		wrapped = false
+		if banner == nil {
+			banner = resp.data
+		}
+
+		hard, softHit := probe.match(toLatin1(resp.data))
+		if hard != nil {
+			hard.Probe = probe.Name
+			hard.Banner = bannerText(resp.data)
+			return hard, nil
+		}
+		if soft == nil && softHit != nil {
+			softHit.Probe = probe.Name
+			softHit.Banner = bannerText(resp.data)
+			soft = softHit
+		}
+	}
+
+	switch {
+	case soft != nil:
+		return soft, nil
+	case wrapped:
+		return &ServiceInfo{Service: "tcpwrapped"}, nil
+	case !reachable && protocol == "tcp" && lastErr != nil:
+		return nil, lastErr
+	}
+	return &ServiceInfo{Service: "unknown", Banner: bannerText(banner)}, nil
+}
+
+// send opens a fresh connection, writes the probe payload and collects the response
+func (e *Engine) send(ctx context.Context, host string, port int, protocol string, probe *Probe, useTLS bool) (*response, error) {
+	address := net.JoinHostPort(host, strconv.Itoa(port))
+	conn, err := e.dialer.DialContext(ctx, protocol, address)
+	if err != nil {
+		return nil, &dialError{err: err}
+	}
+	defer conn.Close()
+
+	wait := e.config.ReadTimeout
+	if probe.TotalWait > 0 && probe.TotalWait < wait {
+		wait = probe.TotalWait
+	}
+	deadline := time.Now().Add(wait)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+	if err := conn.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+
+	if useTLS {
+		tlsConn := tls.Client(conn, &tls.Config{InsecureSkipVerify: true, ServerName: host})
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			return nil, fmt.Errorf("tls handshake failed: %w", err)
+		}
+		conn = tlsConn
+	}
+
+	start := time.Now()
+	if len(probe.Payload) > 0 {
+		if _, err := conn.Write(probe.Payload); err != nil {
+			return nil, fmt.Errorf("failed to send probe %s: %w", probe.Name, err)
+		}
+	}
+
+	resp := &response{}
+	buf := make([]byte, 4096)
+	for len(resp.data) < e.config.MaxResponse {
+		n, err := conn.Read(buf)
+		if n > 0 {
+			resp.data = append(resp.data, buf[:n]...)
+			if protocol == "udp" {
+				break
+			}
+			if e.config.ReadGrace > 0 {
+				grace := time.Now().Add(e.config.ReadGrace)
+				if grace.Before(deadline) {
+					_ = conn.SetReadDeadline(grace)
+				}
+			}
+		}
+		if err != nil {
+			resp.closed = errors.Is(err, io.EOF)
+			break
+		}
+	}
+	resp.elapsed = time.Since(start)
+
+	if len(resp.data) > e.config.MaxResponse {
+		resp.data = resp.data[:e.config.MaxResponse]
+	}
+	return resp, nil
+}
+
+// match tries the probe's own matches and then those of its fallbacks,
+// returning the first hard match and the first softmatch seen
+func (p *Probe) match(subject string) (*ServiceInfo, *ServiceInfo) {
+	var soft *ServiceInfo
+	for _, candidate := range append([]*Probe{p}, p.fallbackRefs...) {
+		for _, m := range candidate.Matches {
+			if info, ok := m.apply(subject); ok {
+				return info, soft
+			}
+		}
+		if soft != nil {
+			continue
+		}
+		for _, m := range candidate.SoftMatches {
+			if info, ok := m.apply(subject); ok {
+				soft = info
+				break
+			}
+		}
+	}
+	return nil, soft
+}
+
+// canMatch reports whether the probe could produce a hard match for the service
+func (p *Probe) canMatch(service string) bool {
+	for _, candidate := range append([]*Probe{p}, p.fallbackRefs...) {
+		for _, m := range candidate.Matches {
+			if m.Service == service {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// dialError wraps connection failures so they can be told apart from probe errors
+type dialError struct {
+	err error
+}
+
+func (e *dialError) Error() string { return e.err.Error() }
+
+func (e *dialError) Unwrap() error { return e.err }
+
+func isDialError(err error) bool {
+	var de *dialError
+	return errors.As(err, &de)
+}
+
+// bannerText renders the start of a response with non-printable bytes escaped
+func bannerText(data []byte) string {
+	const maxBanner = 256
+	if len(data) > maxBanner {
+		data = data[:maxBanner]
+	}
+
+	var b strings.Builder
+	for _, c := range data {
+		switch {
+		case c == '\r':
+			b.WriteString(`\r`)
+		case c == '\n':
+			b.WriteString(`\n`)
+		case c >= 0x20 && c < 0x7f:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, `\x%02x`, c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,333 @@
+package fingerprint
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConvertPattern(t *testing.T) {
+	tests := []struct {
+		pattern, flags string
+		want           string
+		matches        []string
+		rejects        []string
+	}{
+		{pattern: `^SSH-([\d.]+)-`, want: `^SSH-([\d.]+)-`, matches: []string{"SSH-2.0-x"}},
+		{pattern: `^220 ready$`, want: `^220 ready(?:\n?\z)`, matches: []string{"220 ready", "220 ready\n"}, rejects: []string{"220 ready\n\n"}},
+		{pattern: `^HTTP.*Server`, flags: "si", want: `(?is)^HTTP.*Server`, matches: []string{"http/1.0 200\r\nserver"}},
+		{pattern: `^\0\x06\x81`, want: `^\x{00}\x{06}\x{81}`, matches: []string{toLatin1([]byte{0, 6, 0x81})}},
+		{pattern: `^\x{1b}\e`, want: `^\x{1b}\x{1b}`, matches: []string{"\x1b\x1b"}},
+		{pattern: `^\x`, want: `^\x{00}`, matches: []string{"\x00"}},
+		{pattern: `^a\Z`, want: `^a(?:\n?\z)`, matches: []string{"a\n"}},
+		{pattern: `^[]a]+\h`, want: `^[\]a]+[\t \x{a0}]`, matches: []string{"]a\t"}},
+		{pattern: `^[[:digit:]\h]+`, want: `^[[:digit:]\t \x{a0}]+`, matches: []string{"1 2"}},
+		{pattern: `^(?<ver>\d+)`, want: `^(?P<ver>\d+)`, matches: []string{"42"}},
+		{pattern: `^a\.b\/c`, want: `^a\.b/c`, matches: []string{"a.b/c"}, rejects: []string{"axb/c"}},
+		{pattern: "^caf\xe9", want: `^caf\x{e9}`, matches: []string{toLatin1([]byte("caf\xe9"))}},
+	}
+	for _, tt := range tests {
+		got, err := convertPattern(tt.pattern, tt.flags)
+		if err != nil {
+			t.Errorf("convertPattern(%q): %v", tt.pattern, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("convertPattern(%q) = %q, want %q", tt.pattern, got, tt.want)
+			continue
+		}
+		re := regexp.MustCompile(got)
+		for _, s := range tt.matches {
+			if !re.MatchString(s) {
+				t.Errorf("%q does not match %q", got, s)
+			}
+		}
+		for _, s := range tt.rejects {
+			if re.MatchString(s) {
+				t.Errorf("%q unexpectedly matches %q", got, s)
+			}
+		}
+	}
+}
+
+func TestConvertPatternUnsupported(t *testing.T) {
+	for _, pattern := range []string{
+		`^(a)\1`,      // backreference
+		`^(?=abc)`,    // lookahead
+		`^(?<!x)y`,    // lookbehind
+		`^(?>atomic)`, // atomic group
+		`^a++`,        // possessive quantifier
+		`^\d*+x`,      // possessive quantifier
+		`trailing\`,   // dangling escape
+	} {
+		if _, err := convertPattern(pattern, ""); !errors.Is(err, errUnsupportedPattern) {
+			t.Errorf("convertPattern(%q): expected errUnsupportedPattern, got %v", pattern, err)
+		}
+	}
+	// An unsupported pattern only drops that match line, not the probe file
+	db, err := ParseProbes(strings.NewReader("Probe TCP NULL q||\nmatch x m|^(a)\\1|\nmatch y m|^y|\n"))
+	if err != nil {
+		t.Fatalf("ParseProbes: %v", err)
+	}
+	if null := db.ProbeByName("tcp", "NULL"); null == nil || len(null.Matches) != 1 || null.Matches[0].Service != "y" {
+		t.Errorf("expected only the supported match to load, got %+v", null)
+	}
+}
+
+const orderingProbes = `
+Probe TCP NULL q||
+match banner m|^BANNER|
+
+Probe TCP Rare q|rare\r\n|
+rarity 9
+
+Probe TCP Common q|common\r\n|
+rarity 2
+
+Probe TCP Web q|GET / HTTP/1.0\r\n\r\n|
+rarity 6
+ports 80,8080-8090
+
+Probe TCP Secure q|hello|
+rarity 3
+sslports 443
+fallback Web
+
+Probe UDP Dns q|\0\x06|
+rarity 1
+ports 53
+`
+
+func probeNames(probes []*Probe) string {
+	var names []string
+	for _, p := range probes {
+		names = append(names, p.Name)
+	}
+	return strings.Join(names, ",")
+}
+
+func TestProbeOrdering(t *testing.T) {
+	db, err := ParseProbes(strings.NewReader(orderingProbes))
+	if err != nil {
+		t.Fatalf("ParseProbes: %v", err)
+	}
+
+	tests := []struct {
+		port, intensity int
+		want            string
+	}{
+		// Probes registered for the port come first, then the rest by rarity
+		{8085, 7, "Web,Common,Secure"},
+		{443, 7, "Secure,Common,Web"},
+		// Intensity limits the unregistered probes only
+		{8085, 2, "Web,Common"},
+		{22, 9, "Common,Secure,Web,Rare"},
+		{22, 0, ""},
+	}
+	for _, tt := range tests {
+		if got := probeNames(db.ordered("tcp", tt.port, tt.intensity)); got != tt.want {
+			t.Errorf("ordered(tcp, %d, %d) = %q, want %q", tt.port, tt.intensity, got, tt.want)
+		}
+	}
+	if got := probeNames(db.ordered("udp", 53, 0)); got != "Dns" {
+		t.Errorf("ordered(udp, 53) = %q", got)
+	}
+
+	// Every TCP probe falls back to NULL, after any explicit fallback
+	if got := probeNames(db.ProbeByName("tcp", "Secure").fallbackRefs); got != "Web,NULL" {
+		t.Errorf("Secure falls back to %q", got)
+	}
+	if got := probeNames(db.ProbeByName("tcp", "NULL").fallbackRefs); got != "" {
+		t.Errorf("NULL falls back to %q", got)
+	}
+	if got := probeNames(db.ProbeByName("udp", "Dns").fallbackRefs); got != "" {
+		t.Errorf("a UDP probe falls back to %q", got)
+	}
+}
+
+func TestMatchResponse(t *testing.T) {
+	e := NewEngine(nil, nil)
+	tests := []struct {
+		name, probe string
+		banner      string
+		want        string
+		cpe         string
+		soft        bool
+	}{
+		{"openssh", "NULL", "SSH-2.0-OpenSSH_9.6p1 Ubuntu-3ubuntu13\r\n", "ssh OpenSSH 9.6p1 (protocol 2.0; Ubuntu-3ubuntu13)", "cpe:/a:openbsd:openssh:9.6p1", false},
+		{"dropbear", "NULL", "SSH-2.0-dropbear_2022.83\r\n", "ssh Dropbear sshd 2022.83 (protocol 2.0)", "cpe:/a:matt_johnston:dropbear_ssh_server:2022.83", false},
+		{"ssh softmatch", "NULL", "SSH-1.99-Cisco-1.25\r\n", "ssh (protocol 1.99)", "", true},
+		{"vsftpd", "NULL", "220 (vsFTPd 3.0.5)\r\n", "ftp vsftpd 3.0.5", "cpe:/a:vsftpd:vsftpd:3.0.5", false},
+		{"mysql", "NULL", "\x4a\x00\x00\x00\x0a8.0.36-0ubuntu0.22.04.1\x00\x01\x02", "mysql MySQL 8.0.36", "cpe:/a:mysql:mysql:8.0.36", false},
+		{"nginx", "GetRequest", "HTTP/1.1 200 OK\r\nServer: nginx/1.25.3\r\nContent-Type: text/html\r\n\r\n", "http nginx 1.25.3", "cpe:/a:igor_sysoev:nginx:1.25.3", false},
+		{"apache", "GetRequest", "HTTP/1.1 403 Forbidden\r\nDate: x\r\nServer: Apache/2.4.58 (Ubuntu)\r\n\r\n", "http Apache httpd 2.4.58 (Ubuntu)", "cpe:/a:apache:http_server:2.4.58", false},
+		{"other http server", "GetRequest", "HTTP/1.0 200 OK\r\nServer: Acme\x01Web\r\n\r\n", "http AcmeWeb", "", false},
+		// GetRequest falls back to NULL, so a banner sent first still matches
+		{"null fallback", "GetRequest", "SSH-2.0-OpenSSH_8.9\r\n", "ssh OpenSSH 8.9 (protocol 2.0)", "cpe:/a:openbsd:openssh:8.9", false},
+		// SSLSessionReq falls back to GetRequest explicitly
+		{"explicit fallback", "SSLSessionReq", "HTTP/1.1 400 Bad Request\r\nServer: nginx\r\n\r\n", "http nginx", "cpe:/a:igor_sysoev:nginx", false},
+		{"tls", "SSLSessionReq", "\x16\x03\x03\x00\x5a\x02\x00\x00\x56", "ssl", "", false},
+		{"redis", "redis-server", "-NOAUTH Authentication required.\r\n", "redis Redis key-value store (authentication required)", "cpe:/a:redislabs:redis", false},
+	}
+	for _, tt := range tests {
+		info := e.MatchResponse("TCP", tt.probe, []byte(tt.banner))
+		if info == nil {
+			t.Errorf("%s: no match", tt.name)
+			continue
+		}
+		if got := info.String(); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+		if tt.cpe != "" && (len(info.CPE) == 0 || info.CPE[0] != tt.cpe) {
+			t.Errorf("%s: got CPE %v, want %s", tt.name, info.CPE, tt.cpe)
+		}
+		if info.SoftMatch != tt.soft || info.Probe != tt.probe {
+			t.Errorf("%s: got soft=%v probe=%s", tt.name, info.SoftMatch, info.Probe)
+		}
+	}
+
+	for _, miss := range []struct{ probe, banner string }{
+		{"NULL", "garbage\r\n"},
+		{"NULL", ""},
+		{"NoSuchProbe", "SSH-2.0-OpenSSH_9.6\r\n"},
+	} {
+		if info := e.MatchResponse("tcp", miss.probe, []byte(miss.banner)); info != nil {
+			t.Errorf("%s %q: expected no match, got %s", miss.probe, miss.banner, info)
+		}
+	}
+}
+
+func TestExpandTemplate(t *testing.T) {
+	groups := []string{"all", "2.0", "", "v1;", "a,b"}
+	tests := []struct{ tmpl, want string }{
+		{"protocol $1; $2", "protocol 2.0"},
+		{"protocol $1, $P(2)", "protocol 2.0"},
+		{"$3", "v1;"},
+		{"$3$2", "v1;"},
+		{"$4,", "a,b,"},
+		{`$SUBST(1,".","_")`, "2_0"},
+		{"$1;", "2.0;"},
+	}
+	for _, tt := range tests {
+		if got := expandTemplate(tt.tmpl, groups); got != tt.want {
+			t.Errorf("expandTemplate(%q) = %q, want %q", tt.tmpl, got, tt.want)
+		}
+	}
+}
+
+// serveOnce answers each connection with handler until the listener closes
+func serveOnce(t *testing.T, handler func(net.Conn)) int {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+				c.SetDeadline(time.Now().Add(5 * time.Second))
+				handler(c)
+			}()
+		}
+	}()
+	return ln.Addr().(*net.TCPAddr).Port
+}
+
+func TestIdentify(t *testing.T) {
+	config := DefaultConfig
+	config.ReadTimeout = 300 * time.Millisecond
+	config.ReadGrace = 50 * time.Millisecond
+	e := NewEngine(nil, &config)
+	ctx := context.Background()
+
+	// A banner is matched by the NULL probe, without sending anything
+	sshPort := serveOnce(t, func(c net.Conn) {
+		io.WriteString(c, "SSH-2.0-OpenSSH_9.6\r\n")
+	})
+	info, err := e.Identify(ctx, "127.0.0.1", sshPort, "tcp")
+	if err != nil || info.String() != "ssh OpenSSH 9.6 (protocol 2.0)" || info.Probe != "NULL" || info.Port != sshPort {
+		t.Errorf("unexpected ssh result %+v: %v", info, err)
+	}
+
+	// A server that waits for a request is found by the next probes
+	httpPort := serveOnce(t, func(c net.Conn) {
+		buf := make([]byte, 512)
+		n, _ := c.Read(buf)
+		if strings.HasPrefix(string(buf[:n]), "GET / HTTP/1.0") {
+			io.WriteString(c, "HTTP/1.0 200 OK\r\nServer: nginx/1.24.0\r\n\r\n")
+		}
+	})
+	info, err = e.Identify(ctx, "127.0.0.1", httpPort, "tcp")
+	if err != nil || info.String() != "http nginx 1.24.0" || info.Probe != "GetRequest" {
+		t.Errorf("unexpected http result %+v: %v", info, err)
+	}
+
+	// Silence on every probe is unknown, not an error
+	silentPort := serveOnce(t, func(c net.Conn) {
+		io.Copy(io.Discard, c)
+	})
+	info, err = e.Identify(ctx, "127.0.0.1", silentPort, "tcp")
+	if err != nil || info.Service != "unknown" {
+		t.Errorf("unexpected silent result %+v: %v", info, err)
+	}
+
+	// A closed port is an error
+	ln, _ := net.Listen("tcp", "127.0.0.1:0")
+	closedPort := ln.Addr().(*net.TCPAddr).Port
+	ln.Close()
+	if _, err := e.Identify(ctx, "127.0.0.1", closedPort, "tcp"); err == nil {
+		t.Error("expected a closed port to fail")
+	}
+
+	all := e.IdentifyAll(ctx, "127.0.0.1", []int{sshPort, closedPort, httpPort}, "tcp", 2)
+	if len(all) != 2 || all[sshPort].Service != "ssh" || all[httpPort].Service != "http" {
+		t.Errorf("unexpected IdentifyAll results %v", all)
+	}
+}
+
+func TestIdentifyUDPSkipsNoPayload(t *testing.T) {
+	db, err := ParseProbes(strings.NewReader("Probe UDP Blind q|blind| no-payload\nports 1-65535\nmatch blind m|^.|\n" +
+		"Probe UDP Dns q|dns|\nports 1-65535\nmatch domain m|^dns|\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+	received := make(chan string, 4)
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := pc.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			received <- string(buf[:n])
+			pc.WriteTo(buf[:n], addr)
+		}
+	}()
+
+	config := DefaultConfig
+	config.ReadTimeout = 300 * time.Millisecond
+	info, err := NewEngine(db, &config).Identify(context.Background(), "127.0.0.1", pc.LocalAddr().(*net.UDPAddr).Port, "udp")
+	if err != nil || info.Service != "domain" {
+		t.Fatalf("unexpected udp result %+v: %v", info, err)
+	}
+	if got := <-received; got != "dns" {
+		t.Errorf("first payload sent was %q, want the no-payload probe skipped", got)
+	}
+}
@@ -0,0 +1,432 @@
+package fingerprint
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// errUnsupportedPattern marks PCRE constructs that have no RE2 equivalent
+// (backreferences, lookaround, atomic groups, possessive quantifiers)
+var errUnsupportedPattern = errors.New("pattern not supported by Go regexp")
+
+// Match represents a match or softmatch line belonging to a probe
+type Match struct {
+	Service string
+	Pattern string
+	Soft    bool
+	regex   *regexp.Regexp
+
+	product    string
+	version    string
+	info       string
+	hostname   string
+	os         string
+	deviceType string
+	cpes       []string
+}
+
+// parseMatchLine parses `<service> m<d><pattern><d>[opts] [p/../ v/../ ... cpe:/../]`
+func parseMatchLine(rest string, soft bool) (*Match, error) {
+	service, spec := splitDirective(rest)
+	if service == "" || len(spec) < 3 || spec[0] != 'm' {
+		return nil, fmt.Errorf("malformed match directive: %q", rest)
+	}
+
+	pattern, flags, remainder, err := readDelimited(spec[1:])
+	if err != nil {
+		return nil, fmt.Errorf("match %s: %w", service, err)
+	}
+
+	expr, err := convertPattern(pattern, flags)
+	if err != nil {
+		return nil, err
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, errUnsupportedPattern
+	}
+
+	m := &Match{Service: service, Pattern: pattern, Soft: soft, regex: re}
+	for remainder = strings.TrimSpace(remainder); remainder != ""; remainder = strings.TrimSpace(remainder) {
+		var field, value string
+		if strings.HasPrefix(remainder, "cpe:") {
+			field = "cpe"
+			value, _, remainder, err = readDelimited(remainder[4:])
+		} else {
+			field = remainder[:1]
+			value, _, remainder, err = readDelimited(remainder[1:])
+		}
+		if err != nil {
+			return nil, fmt.Errorf("match %s: %w", service, err)
+		}
+
+		switch field {
+		case "p":
+			m.product = value
+		case "v":
+			m.version = value
+		case "i":
+			m.info = value
+		case "h":
+			m.hostname = value
+		case "o":
+			m.os = value
+		case "d":
+			m.deviceType = value
+		case "cpe":
+			m.cpes = append(m.cpes, "cpe:/"+value)
+		}
+	}
+	return m, nil
+}
+
+// readDelimited reads `<d>value<d>flags` and returns the value, the trailing
+// flag letters and whatever follows them
+func readDelimited(s string) (string, string, string, error) {
+	if len(s) < 2 {
+		return "", "", "", fmt.Errorf("missing delimiter in %q", s)
+	}
+	delim := s[0]
+	end := strings.IndexByte(s[1:], delim)
+	if end < 0 {
+		return "", "", "", fmt.Errorf("unterminated field starting with %q", s[:1])
+	}
+	value := s[1 : 1+end]
+	rest := s[2+end:]
+
+	flagEnd := 0
+	for flagEnd < len(rest) && rest[flagEnd] != ' ' && rest[flagEnd] != '\t' {
+		flagEnd++
+	}
+	return value, rest[:flagEnd], rest[flagEnd:], nil
+}
+
+// convertPattern rewrites a PCRE pattern from a probe file into RE2 syntax.
+// Patterns run against Latin-1 decoded responses, so every byte >= 0x80 is
+// rewritten to its code point and matches exactly one response byte.
+func convertPattern(pattern, flags string) (string, error) {
+	var b strings.Builder
+	if strings.Contains(flags, "i") || strings.Contains(flags, "s") {
+		b.WriteString("(?")
+		if strings.Contains(flags, "i") {
+			b.WriteByte('i')
+		}
+		if strings.Contains(flags, "s") {
+			b.WriteByte('s')
+		}
+		b.WriteByte(')')
+	}
+
+	inClass := false
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch {
+		case c >= 0x80:
+			fmt.Fprintf(&b, `\x{%02x}`, c)
+
+		case c == '\\':
+			if i+1 >= len(pattern) {
+				return "", errUnsupportedPattern
+			}
+			i++
+			n, err := convertEscape(&b, pattern, i, inClass)
+			if err != nil {
+				return "", err
+			}
+			i += n
+
+		case c == '[' && !inClass:
+			inClass = true
+			b.WriteByte('[')
+			if i+1 < len(pattern) && pattern[i+1] == '^' {
+				b.WriteByte('^')
+				i++
+			}
+			// A leading ']' is a literal in PCRE
+			if i+1 < len(pattern) && pattern[i+1] == ']' {
+				b.WriteString(`\]`)
+				i++
+			}
+
+		case c == '[' && inClass:
+			if strings.HasPrefix(pattern[i:], "[:") {
+				if end := strings.Index(pattern[i:], ":]"); end > 0 {
+					b.WriteString(pattern[i : i+end+2])
+					i += end + 1
+					continue
+				}
+			}
+			b.WriteString(`\[`)
+
+		case c == ']' && inClass:
+			inClass = false
+			b.WriteByte(']')
+
+		case c == '(' && !inClass:
+			rest := pattern[i:]
+			for _, unsupported := range []string{"(?=", "(?!", "(?<=", "(?<!", "(?>", "(?|", "(?R", "(?&"} {
+				if strings.HasPrefix(rest, unsupported) {
+					return "", errUnsupportedPattern
+				}
+			}
+			if strings.HasPrefix(rest, "(?<") || strings.HasPrefix(rest, "(?'") {
+				name := rest[3:]
+				end := strings.IndexAny(name, ">'")
+				if end < 0 {
+					return "", errUnsupportedPattern
+				}
+				b.WriteString("(?P<" + name[:end] + ">")
+				i += 3 + end
+				continue
+			}
+			b.WriteByte('(')
+
+		case (c == '+') && !inClass && i > 0 && isQuantifierEnd(pattern, i-1):
+			// Possessive quantifiers such as a++ or \d*+
+			return "", errUnsupportedPattern
+
+		case c == '$' && !inClass:
+			// PCRE's $ also matches before a trailing newline
+			b.WriteString(`(?:\n?\z)`)
+
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String(), nil
+}
+
+// convertEscape writes the RE2 form of the escape at pattern[i] (the byte after
+// the backslash) and returns how many extra bytes were consumed
+func convertEscape(b *strings.Builder, pattern string, i int, inClass bool) (int, error) {
+	c := pattern[i]
+	switch {
+	case c >= '1' && c <= '9':
+		return 0, errUnsupportedPattern
+	case c == '0':
+		n, val := 0, 0
+		for n < 2 && i+1+n < len(pattern) && pattern[i+1+n] >= '0' && pattern[i+1+n] <= '7' {
+			val = val*8 + int(pattern[i+1+n]-'0')
+			n++
+		}
+		fmt.Fprintf(b, `\x{%02x}`, val)
+		return n, nil
+	case c == 'x':
+		if i+1 < len(pattern) && pattern[i+1] == '{' {
+			end := strings.IndexByte(pattern[i:], '}')
+			if end < 0 {
+				return 0, errUnsupportedPattern
+			}
+			b.WriteString(`\` + pattern[i:i+end+1])
+			return end, nil
+		}
+		n := 0
+		for n < 2 && i+1+n < len(pattern) && isHex(pattern[i+1+n]) {
+			n++
+		}
+		if n == 0 {
+			b.WriteString(`\x{00}`)
+			return 0, nil
+		}
+		fmt.Fprintf(b, `\x{%s}`, pattern[i+1:i+1+n])
+		return n, nil
+	case c == 'e':
+		b.WriteString(`\x{1b}`)
+	case c == 'Z' && !inClass:
+		b.WriteString(`(?:\n?\z)`)
+	case c == 'h':
+		if inClass {
+			b.WriteString(`\t \x{a0}`)
+		} else {
+			b.WriteString(`[\t \x{a0}]`)
+		}
+	case c >= 0x80:
+		fmt.Fprintf(b, `\x{%02x}`, c)
+	case isAlnum(c):
+		// Known escapes (\d, \w, \s, \b, \r, \n, ...) are shared with RE2;
+		// anything else is rejected when the pattern is compiled
+		b.WriteByte('\\')
+		b.WriteByte(c)
+	default:
+		// Escaped punctuation is always a literal
+		b.WriteString(regexp.QuoteMeta(string(c)))
+	}
+	return 0, nil
+}
+
+func isQuantifierEnd(pattern string, i int) bool {
+	c := pattern[i]
+	if c != '*' && c != '+' && c != '?' && c != '}' {
+		return false
+	}
+	// An escaped quantifier character is a literal
+	return i == 0 || pattern[i-1] != '\\'
+}
+
+func isHex(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+func isAlnum(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+// apply runs the match against a Latin-1 decoded response and fills in the
+// version information on success
+func (m *Match) apply(subject string) (*ServiceInfo, bool) {
+	groups := m.regex.FindStringSubmatch(subject)
+	if groups == nil {
+		return nil, false
+	}
+
+	info := &ServiceInfo{
+		Service:    m.Service,
+		Product:    expandTemplate(m.product, groups),
+		Version:    expandTemplate(m.version, groups),
+		Info:       expandTemplate(m.info, groups),
+		Hostname:   expandTemplate(m.hostname, groups),
+		OS:         expandTemplate(m.os, groups),
+		DeviceType: expandTemplate(m.deviceType, groups),
+		SoftMatch:  m.Soft,
+	}
+	for _, cpe := range m.cpes {
+		info.CPE = append(info.CPE, expandTemplate(cpe, groups))
+	}
+	return info, true
+}
+
+// expandTemplate substitutes $1, $P(1), $SUBST(1,"a","b") and $I(1,">")
+// helpers with the captured groups
+func expandTemplate(tmpl string, groups []string) string {
+	if !strings.Contains(tmpl, "$") {
+		return tmpl
+	}
+
+	group := func(s string) string {
+		n, err := strconv.Atoi(strings.TrimSpace(s))
+		if err != nil || n <= 0 || n >= len(groups) {
+			return ""
+		}
+		return fromLatin1(groups[n])
+	}
+
+	var (
+		b strings.Builder
+		// valueEnd is where the last non-empty substitution ended and
+		// emptyTail reports whether the template ended on an empty one
+		valueEnd  int
+		emptyTail bool
+	)
+	for i := 0; i < len(tmpl); i++ {
+		if tmpl[i] != '$' || i+1 >= len(tmpl) {
+			b.WriteByte(tmpl[i])
+			emptyTail = false
+			continue
+		}
+
+		before := b.Len()
+		rest := tmpl[i+1:]
+		switch {
+		case rest[0] >= '1' && rest[0] <= '9':
+			b.WriteString(group(rest[:1]))
+			i++
+		case strings.HasPrefix(rest, "P("), strings.HasPrefix(rest, "I("), strings.HasPrefix(rest, "SUBST("):
+			open := strings.IndexByte(rest, '(')
+			end := strings.IndexByte(rest, ')')
+			if end < 0 {
+				b.WriteByte('$')
+				emptyTail = false
+				continue
+			}
+			args := splitTemplateArgs(rest[open+1 : end])
+			value := group(args[0])
+			switch rest[:open] {
+			case "P":
+				b.WriteString(printable(value))
+			case "I":
+				b.WriteString(unpackUint(value, len(args) > 1 && args[1] == "<"))
+			case "SUBST":
+				if len(args) == 3 {
+					value = strings.ReplaceAll(value, args[1], args[2])
+				}
+				b.WriteString(value)
+			}
+			i += end + 1
+		default:
+			b.WriteByte('$')
+			emptyTail = false
+			continue
+		}
+		emptyTail = b.Len() == before
+		if !emptyTail {
+			valueEnd = b.Len()
+		}
+	}
+
+	out := b.String()
+	if emptyTail {
+		// An empty last group leaves the template's separator behind, as in
+		// "protocol 2.0; ". Only literal text after the last value is trimmed
+		literal := strings.TrimRight(out[valueEnd:], " ")
+		literal = strings.TrimSuffix(strings.TrimSuffix(literal, ";"), ",")
+		out = out[:valueEnd] + literal
+	}
+	return strings.TrimSpace(out)
+}
+
+// splitTemplateArgs splits `1,"a","b"` into its unquoted arguments
+func splitTemplateArgs(s string) []string {
+	var args []string
+	for _, part := range strings.Split(s, ",") {
+		args = append(args, strings.Trim(strings.TrimSpace(part), `"`))
+	}
+	return args
+}
+
+func printable(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x20 && s[i] < 0x7f {
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String()
+}
+
+func unpackUint(s string, littleEndian bool) string {
+	if len(s) == 0 || len(s) > 8 {
+		return ""
+	}
+	var v uint64
+	for i := 0; i < len(s); i++ {
+		idx := i
+		if littleEndian {
+			idx = len(s) - 1 - i
+		}
+		v = v<<8 | uint64(s[idx])
+	}
+	return strconv.FormatUint(v, 10)
+}
+
+// toLatin1 maps every byte to the code point of the same value so RE2 can
+// match arbitrary binary responses byte for byte
+func toLatin1(data []byte) string {
+	buf := make([]byte, 0, len(data)+len(data)/4)
+	for _, c := range data {
+		buf = utf8.AppendRune(buf, rune(c))
+	}
+	return string(buf)
+}
+
+// fromLatin1 reverses toLatin1
+func fromLatin1(s string) string {
+	buf := make([]byte, 0, len(s))
+	for _, r := range s {
+		buf = append(buf, byte(r))
+	}
+	return string(buf)
+}
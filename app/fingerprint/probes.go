@@ -0,0 +1,342 @@
+package fingerprint
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Probe represents a single Probe directive from an nmap-service-probes file
+type Probe struct {
+	Protocol     string // "tcp" or "udp"
+	Name         string
+	Payload      []byte
+	NoPayload    bool // Payload is not sent as a blind UDP probe
+	Rarity       int
+	Ports        PortSet
+	SSLPorts     PortSet
+	TotalWait    time.Duration
+	TCPWrapped   time.Duration
+	Fallback     []string
+	Matches      []*Match
+	SoftMatches  []*Match
+	fallbackRefs []*Probe
+}
+
+// Database holds every probe parsed from a service probe file
+type Database struct {
+	Probes  []*Probe
+	Exclude PortSet
+	// Skipped counts match lines whose patterns could not be converted to Go regex
+	Skipped int
+}
+
+// LoadDatabase reads and parses an nmap-service-probes file from disk
+func LoadDatabase(filePath string) (*Database, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open probe file: %w", err)
+	}
+	defer file.Close()
+
+	return ParseProbes(file)
+}
+
+// DefaultDatabase returns the built-in probe set used when no probe file is configured
+func DefaultDatabase() *Database {
+	db, err := ParseProbes(strings.NewReader(defaultProbes))
+	if err != nil {
+		panic(fmt.Sprintf("fingerprint: invalid built-in probes: %v", err))
+	}
+	return db
+}
+
+// ParseProbes parses the nmap-service-probes format from the given reader
+func ParseProbes(r io.Reader) (*Database, error) {
+	db := &Database{}
+	var current *Probe
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		directive, rest := splitDirective(line)
+		if directive != "Probe" && directive != "Exclude" && current == nil {
+			return nil, fmt.Errorf("line %d: %s directive before any Probe", lineNo, directive)
+		}
+
+		var err error
+		switch directive {
+		case "Exclude":
+			db.Exclude, err = ParsePortSet(rest)
+		case "Probe":
+			current, err = parseProbeLine(rest)
+			if err == nil {
+				db.Probes = append(db.Probes, current)
+			}
+		case "match", "softmatch":
+			var m *Match
+			m, err = parseMatchLine(rest, directive == "softmatch")
+			if err == errUnsupportedPattern {
+				db.Skipped++
+				err = nil
+				continue
+			}
+			if err == nil {
+				if m.Soft {
+					current.SoftMatches = append(current.SoftMatches, m)
+				} else {
+					current.Matches = append(current.Matches, m)
+				}
+			}
+		case "ports":
+			current.Ports, err = ParsePortSet(rest)
+		case "sslports":
+			current.SSLPorts, err = ParsePortSet(rest)
+		case "rarity":
+			current.Rarity, err = strconv.Atoi(rest)
+		case "totalwaitms":
+			current.TotalWait, err = parseMillis(rest)
+		case "tcpwrappedms":
+			current.TCPWrapped, err = parseMillis(rest)
+		case "fallback":
+			for _, name := range strings.Split(rest, ",") {
+				if name = strings.TrimSpace(name); name != "" {
+					current.Fallback = append(current.Fallback, name)
+				}
+			}
+		default:
+			// Unknown directives are ignored to stay compatible with newer probe files
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNo, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read probe file: %w", err)
+	}
+
+	db.link()
+	return db, nil
+}
+
+// ProbeByName returns the probe with the given protocol and name, or nil
+func (db *Database) ProbeByName(protocol, name string) *Probe {
+	for _, p := range db.Probes {
+		if p.Protocol == protocol && p.Name == name {
+			return p
+		}
+	}
+	return nil
+}
+
+// ordered returns the probes for a protocol, probes registered for the port
+// first and then all others, each group sorted by rarity
+func (db *Database) ordered(protocol string, port, intensity int) []*Probe {
+	var primary, secondary []*Probe
+	for _, p := range db.Probes {
+		if p.Protocol != protocol || p.Name == "NULL" {
+			continue
+		}
+		if p.Ports.Contains(port) || p.SSLPorts.Contains(port) {
+			primary = append(primary, p)
+		} else if p.Rarity <= intensity {
+			secondary = append(secondary, p)
+		}
+	}
+
+	byRarity := func(list []*Probe) {
+		sort.SliceStable(list, func(i, j int) bool {
+			return list[i].Rarity < list[j].Rarity
+		})
+	}
+	byRarity(primary)
+	byRarity(secondary)
+	return append(primary, secondary...)
+}
+
+// link resolves fallback names to probes. As in nmap, a probe without an
+// explicit fallback falls back to the NULL probe for TCP.
+func (db *Database) link() {
+	for _, p := range db.Probes {
+		if p.Rarity == 0 {
+			p.Rarity = 5
+		}
+		for _, name := range p.Fallback {
+			if fb := db.ProbeByName(p.Protocol, name); fb != nil && fb != p {
+				p.fallbackRefs = append(p.fallbackRefs, fb)
+			}
+		}
+		if p.Protocol == "tcp" && p.Name != "NULL" {
+			if null := db.ProbeByName("tcp", "NULL"); null != nil {
+				p.fallbackRefs = append(p.fallbackRefs, null)
+			}
+		}
+	}
+}
+
+// parseProbeLine parses `TCP GetRequest q|GET / HTTP/1.0\r\n\r\n| [no-payload]`
+func parseProbeLine(rest string) (*Probe, error) {
+	fields := strings.SplitN(rest, " ", 3)
+	if len(fields) < 3 {
+		return nil, fmt.Errorf("malformed Probe directive: %q", rest)
+	}
+
+	protocol := strings.ToLower(fields[0])
+	if protocol != "tcp" && protocol != "udp" {
+		return nil, fmt.Errorf("unknown probe protocol %q", fields[0])
+	}
+
+	raw := strings.TrimSpace(fields[2])
+	if len(raw) < 3 || raw[0] != 'q' {
+		return nil, fmt.Errorf("probe %s: missing q|...| payload", fields[1])
+	}
+	delim := raw[1]
+	end := strings.IndexByte(raw[2:], delim)
+	if end < 0 {
+		return nil, fmt.Errorf("probe %s: unterminated payload", fields[1])
+	}
+
+	payload, err := unescapeProbeString(raw[2 : 2+end])
+	if err != nil {
+		return nil, fmt.Errorf("probe %s: %w", fields[1], err)
+	}
+
+	return &Probe{
+		Protocol:  protocol,
+		Name:      fields[1],
+		Payload:   payload,
+		NoPayload: strings.Contains(raw[3+end:], "no-payload"),
+	}, nil
+}
+
+// unescapeProbeString decodes the C-style escapes used in probe payloads
+func unescapeProbeString(s string) ([]byte, error) {
+	out := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c != '\\' || i == len(s)-1 {
+			out = append(out, c)
+			continue
+		}
+		i++
+		switch s[i] {
+		case 'r':
+			out = append(out, '\r')
+		case 'n':
+			out = append(out, '\n')
+		case 't':
+			out = append(out, '\t')
+		case 'a':
+			out = append(out, '\a')
+		case 'f':
+			out = append(out, '\f')
+		case 'v':
+			out = append(out, '\v')
+		case '0':
+			out = append(out, 0)
+		case 'x':
+			if i+2 >= len(s) {
+				return nil, fmt.Errorf("truncated \\x escape")
+			}
+			v, err := strconv.ParseUint(s[i+1:i+3], 16, 8)
+			if err != nil {
+				return nil, fmt.Errorf("invalid \\x escape %q", s[i-1:i+3])
+			}
+			out = append(out, byte(v))
+			i += 2
+		default:
+			out = append(out, s[i])
+		}
+	}
+	return out, nil
+}
+
+func splitDirective(line string) (string, string) {
+	idx := strings.IndexAny(line, " \t")
+	if idx < 0 {
+		return line, ""
+	}
+	return line[:idx], strings.TrimSpace(line[idx+1:])
+}
+
+func parseMillis(s string) (time.Duration, error) {
+	ms, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid millisecond value %q", s)
+	}
+	return time.Duration(ms) * time.Millisecond, nil
+}
+
+// PortSet is a list of port ranges as used by the ports/sslports/Exclude directives
+type PortSet []portRange
+
+type portRange struct {
+	Protocol string // empty means any
+	Low      int
+	High     int
+}
+
+// ParsePortSet parses lists like "21,80-88,T:9100-9107,U:161"
+func ParsePortSet(s string) (PortSet, error) {
+	var set PortSet
+	protocol := ""
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		switch {
+		case strings.HasPrefix(part, "T:"):
+			protocol, part = "tcp", part[2:]
+		case strings.HasPrefix(part, "U:"):
+			protocol, part = "udp", part[2:]
+		}
+
+		low, high := part, part
+		if idx := strings.IndexByte(part, '-'); idx >= 0 {
+			low, high = part[:idx], part[idx+1:]
+		}
+		lo, err := strconv.Atoi(low)
+		if err != nil {
+			return nil, fmt.Errorf("invalid port %q", part)
+		}
+		hi, err := strconv.Atoi(high)
+		if err != nil || hi < lo {
+			return nil, fmt.Errorf("invalid port range %q", part)
+		}
+		set = append(set, portRange{Protocol: protocol, Low: lo, High: hi})
+	}
+	return set, nil
+}
+
+// Contains reports whether the port is in the set, regardless of protocol
+func (ps PortSet) Contains(port int) bool {
+	for _, r := range ps {
+		if port >= r.Low && port <= r.High {
+			return true
+		}
+	}
+	return false
+}
+
+// ContainsProto reports whether the port is in the set for the given protocol
+func (ps PortSet) ContainsProto(protocol string, port int) bool {
+	for _, r := range ps {
+		if (r.Protocol == "" || r.Protocol == protocol) && port >= r.Low && port <= r.High {
+			return true
+		}
+	}
+	return false
+}
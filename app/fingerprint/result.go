@@ -0,0 +1,55 @@
+package fingerprint
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// ServiceInfo describes the service identified on a port
+type ServiceInfo struct {
+	Host       string   `json:"host,omitempty"`
+	Port       int      `json:"port"`
+	Protocol   string   `json:"protocol"`
+	Service    string   `json:"service"`
+	Product    string   `json:"product,omitempty"`
+	Version    string   `json:"version,omitempty"`
+	Info       string   `json:"info,omitempty"`
+	Hostname   string   `json:"hostname,omitempty"`
+	OS         string   `json:"os,omitempty"`
+	DeviceType string   `json:"device_type,omitempty"`
+	CPE        []string `json:"cpe,omitempty"`
+	Tunnel     string   `json:"tunnel,omitempty"`
+	Probe      string   `json:"probe,omitempty"`
+	SoftMatch  bool     `json:"soft_match,omitempty"`
+	Banner     string   `json:"banner,omitempty"`
+}
+
+// String returns a one-line summary such as "ssl/http nginx 1.25.3 (Ubuntu)"
+func (s *ServiceInfo) String() string {
+	if s == nil {
+		return ""
+	}
+
+	name := s.Service
+	if s.Tunnel != "" {
+		name = s.Tunnel + "/" + name
+	}
+
+	parts := []string{name}
+	if s.Product != "" {
+		parts = append(parts, s.Product)
+	}
+	if s.Version != "" {
+		parts = append(parts, s.Version)
+	}
+	if s.Info != "" {
+		parts = append(parts, "("+s.Info+")")
+	}
+	return strings.Join(parts, " ")
+}
+
+// JSON returns the JSON representation of the service info
+func (s *ServiceInfo) JSON() string {
+	data, _ := json.Marshal(s)
+	return string(data)
+}
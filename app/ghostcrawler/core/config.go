@@ -6,6 +6,7 @@ import (
 	"os"
 	"sync"
 
+	"ghostshell/app/filterexpr"
 	"gopkg.in/yaml.v3"
 )
 
@@ -15,6 +16,9 @@ type Config struct {
 	Timeout     int    `yaml:"timeout" json:"timeout"`
 	UserAgent   string `yaml:"user_agent" json:"user_agent"`
 	OutputDir   string `yaml:"output_dir" json:"output_dir"`
+	Filter      string `yaml:"filter" json:"filter"` // Expression selecting the URLs to report
+
+	urlFilter filterexpr.URLFilter // Filter, compiled by LoadConfig
 }
 
 var (
@@ -46,9 +50,20 @@ func LoadConfig(filePath string) (*Config, error) {
 	}
 
 	applyDefaults(&cfg)
+
+	if err := cfg.urlFilter.SetExpression(cfg.Filter); err != nil {
+		return nil, fmt.Errorf("invalid filter in config file: %w", err)
+	}
 	return &cfg, nil
 }
 
+// ResultFilter returns the filter selecting the results to report, for
+// Manager.SetFilter and OutputManager.Filter. It matches everything when the
+// config has no filter.
+func (c *Config) ResultFilter() *Filter {
+	return &Filter{URLFilter: c.urlFilter}
+}
+
 // GetConfig returns a singleton instance of the loaded configuration.
 func GetConfig(filePath string) (*Config, error) {
 	var err error
@@ -2,32 +2,40 @@ package ghostcrawler
 
 import (
 	"regexp"
+
+	"ghostshell/app/filterexpr"
 )
 
 // Filter defines criteria for filtering crawl results.
 type Filter struct {
-	IncludePatterns []string
-	ExcludePatterns []string
-	MaxDepth        int
+	IncludePatterns      []string
+	ExcludePatterns      []string
+	MaxDepth             int
+	filterexpr.URLFilter // optional expression over filterexpr.URLSchema
 }
 
 // Matches checks if a URL matches the include/exclude patterns and depth criteria.
-func (f *Filter) Matches(url string, depth int) bool {
+func (f *Filter) Matches(rawURL string, depth int) bool {
 	if depth > f.MaxDepth {
 		return false
 	}
 
 	// Check exclude patterns
 	for _, pattern := range f.ExcludePatterns {
-		if matched, _ := regexp.MatchString(pattern, url); matched {
+		if matched, _ := regexp.MatchString(pattern, rawURL); matched {
 			return false
 		}
 	}
 
+	// Check filter expression
+	if !f.MatchURL(rawURL, depth) {
+		return false
+	}
+
 	// Check include patterns
 	if len(f.IncludePatterns) > 0 {
 		for _, pattern := range f.IncludePatterns {
-			if matched, _ := regexp.MatchString(pattern, url); matched {
+			if matched, _ := regexp.MatchString(pattern, rawURL); matched {
 				return true
 			}
 		}
@@ -46,3 +54,17 @@ func NewFilter(includePatterns, excludePatterns []string, maxDepth int) *Filter
 		MaxDepth:        maxDepth,
 	}
 }
+
+// MatchesResult checks the URL of a crawler result against the filter
+// expression. Results without a URL, such as errors, always match.
+func (f *Filter) MatchesResult(result Result) bool {
+	if f == nil {
+		return true
+	}
+	data, _ := result.Data.(map[string]interface{})
+	rawURL, _ := data["url"].(string)
+	if rawURL == "" {
+		return true
+	}
+	return f.MatchURL(rawURL, 0)
+}
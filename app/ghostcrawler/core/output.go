@@ -7,10 +7,18 @@ import (
 	"sync"
 )
 
+// Result represents the output of a crawler.
+type Result struct {
+	CrawlerName string
+	Data        interface{}
+	Error       error
+}
+
 // OutputManager handles writing results to various output formats.
 type OutputManager struct {
 	OutputFile string
 	UseJSON    bool
+	Filter     *Filter // Results it doesn't match are not written; nil writes all
 	mutex      sync.Mutex
 }
 
@@ -27,6 +35,10 @@ func (o *OutputManager) WriteResult(result Result) error {
 	o.mutex.Lock()
 	defer o.mutex.Unlock()
 
+	if !o.Filter.MatchesResult(result) {
+		return nil
+	}
+
 	var output string
 	if o.UseJSON {
 		data, err := json.MarshalIndent(result, "", "  ")
@@ -60,6 +72,14 @@ func (o *OutputManager) WriteResults(results []Result) error {
 	o.mutex.Lock()
 	defer o.mutex.Unlock()
 
+	var matched []Result
+	for _, result := range results {
+		if o.Filter.MatchesResult(result) {
+			matched = append(matched, result)
+		}
+	}
+	results = matched
+
 	if o.OutputFile != "" {
 		file, err := os.OpenFile(o.OutputFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
 		if err != nil {
@@ -4,6 +4,8 @@ import (
 	"context"
 	"errors"
 	"sync"
+
+	core "ghostshell/app/ghostcrawler/core"
 )
 
 // Crawler defines the interface for all crawlers.
@@ -16,15 +18,15 @@ type Crawler interface {
 type Manager struct {
 	crawlers map[string]Crawler
 	results  chan Result
+	filter   *Filter
 	mu       sync.Mutex
 }
 
 // Result represents the output of a crawler.
-type Result struct {
-	CrawlerName string
-	Data        interface{}
-	Error       error
-}
+type Result = core.Result
+
+// Filter selects the crawler results to report.
+type Filter = core.Filter
 
 // NewManager initializes and returns a new Manager instance.
 func NewManager() *Manager {
@@ -58,6 +60,14 @@ func (m *Manager) StartCrawler(ctx context.Context, name string, input []string)
 	return nil
 }
 
+// SetFilter drops the results the filter doesn't match from GetResults,
+// usually with the config file's Config.ResultFilter. A nil filter keeps all.
+func (m *Manager) SetFilter(filter *Filter) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.filter = filter
+}
+
 // GetResults retrieves results from all running crawlers.
 func (m *Manager) GetResults() []Result {
 	m.mu.Lock()
@@ -67,7 +77,9 @@ func (m *Manager) GetResults() []Result {
 	for {
 		select {
 		case res := <-m.results:
-			results = append(results, res)
+			if m.filter.MatchesResult(res) {
+				results = append(results, res)
+			}
 		default:
 			return results
 		}
@@ -0,0 +1,64 @@
+package ghostcrawler
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	core "ghostshell/app/ghostcrawler/core"
+)
+
+type staticCrawler []Result
+
+func (c staticCrawler) Name() string { return "static" }
+
+func (c staticCrawler) Start(ctx context.Context, input []string, output chan<- Result) error {
+	for _, r := range c {
+		output <- r
+	}
+	return nil
+}
+
+func TestManagerFilter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("filter: 'host == \"a.example\"'\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := core.LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := NewManager()
+	m.SetFilter(cfg.ResultFilter())
+	m.RegisterCrawler(staticCrawler{
+		{CrawlerName: "static", Data: map[string]interface{}{"url": "https://a.example/x"}},
+		{CrawlerName: "static", Data: map[string]interface{}{"url": "https://b.example/y"}},
+		{CrawlerName: "static", Error: errors.New("probe failed")},
+	})
+	if err := m.StartCrawler(context.Background(), "static", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	var results []Result
+	deadline := time.Now().Add(2 * time.Second)
+	for len(results) < 2 && time.Now().Before(deadline) {
+		results = append(results, m.GetResults()...)
+		time.Sleep(10 * time.Millisecond)
+	}
+	time.Sleep(20 * time.Millisecond)
+	results = append(results, m.GetResults()...)
+
+	if len(results) != 2 {
+		t.Fatalf("got %d results, want the a.example URL and the error: %+v", len(results), results)
+	}
+	for _, r := range results {
+		data, _ := r.Data.(map[string]interface{})
+		if r.Error == nil && data["url"] != "https://a.example/x" {
+			t.Errorf("unexpected result %+v", r)
+		}
+	}
+}
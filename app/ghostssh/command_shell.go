@@ -0,0 +1,77 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"go.uber.org/zap"
+
+	"ghostshell/ghostauth"
+	"ghostshell/ghostcommand"
+)
+
+// errNoPayloadEncryption is returned for the CryptoManager operations the
+// command router never calls
+var errNoPayloadEncryption = errors.New("payload encryption is not supported by the SSH command shell")
+
+// commandAuth adapts ghostauth to what ghostcommand's router expects: it
+// authenticates users and generates the Kyber key pairs commands are
+// encapsulated with
+type commandAuth struct {
+	*ghostauth.GhostAuth
+}
+
+func (a commandAuth) GetUserPublicKey(username string) (string, error) {
+	publicKey, ok := a.GhostAuth.GetUserPublicKey(username)
+	if !ok {
+		return "", fmt.Errorf("no public key for user %s", username)
+	}
+	return publicKey, nil
+}
+
+func (a commandAuth) GenerateKeyPair() (string, string, error) {
+	return a.GeneratePostQuantumKeyPair()
+}
+
+func (a commandAuth) GenerateVaultKeyPair() (string, string, error) {
+	return a.GeneratePostQuantumKeyPair()
+}
+
+func (a commandAuth) Encrypt(data, publicKey string) (string, error) {
+	return "", errNoPayloadEncryption
+}
+
+func (a commandAuth) Decrypt(encryptedData, privateKey string) (string, error) {
+	return "", errNoPayloadEncryption
+}
+
+// newCommandShell builds the command router SSH sessions run commands
+// through, with each user's ghostcommand permissions. Every command is
+// recorded in the audit trail at auditPath. The returned func shuts it down.
+func newCommandShell(auth *ghostauth.GhostAuth) (*ghostcommand.RemoteShell, func(), error) {
+	authorization, err := ghostcommand.NewCommandAuthorization(auth, logErrorHandler{})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to init command authorization: %w", err)
+	}
+	router, err := ghostcommand.NewCommandRouter(commandAuth{auth}, commandAuth{auth}, commandAuth{auth}, logErrorHandler{}, logger)
+	if err != nil {
+		authorization.Shutdown()
+		return nil, nil, fmt.Errorf("failed to init command router: %w", err)
+	}
+	audit, err := ghostcommand.NewCommandAudit(auditPath, logger)
+	if err != nil {
+		router.Shutdown()
+		authorization.Shutdown()
+		return nil, nil, fmt.Errorf("failed to open command audit: %w", err)
+	}
+	router.SetAudit(audit)
+
+	closeShell := func() {
+		router.Shutdown()
+		authorization.Shutdown()
+		if err := audit.Close(); err != nil {
+			logger.Error("Failed to close command audit", zap.Error(err))
+		}
+	}
+	return ghostcommand.NewRemoteShell(router, authorization, logger), closeShell, nil
+}
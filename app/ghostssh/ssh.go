@@ -3,12 +3,10 @@ package main
 import (
 	"context"
 	"fmt"
-	"net"
 	"os"
 	"os/signal"
 	"path/filepath"
 	"runtime"
-	"sync"
 	"syscall"
 	"time"
 
@@ -16,18 +14,19 @@ import (
 	"github.com/jung-kurt/gofpdf"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
-	"golang.org/x/crypto/ssh"
 	"golang.org/x/exp/rand"
 
-	// Hypothetical modules for quantum-safe crypto & key management
-
-	"yourproject/metrics" // for auth failure increments or similar
-	"yourproject/oqs_vault"
+	"ghostshell/app/ghostssh/sshserver"
+	"ghostshell/ghostauth"
 )
 
 const (
 	logDir       = "ghostshell/logging"
 	reportDir    = "ghostshell/reporting"
+	recordDir    = "ghostshell/recordings/ssh"
+	usersPath    = "ghostshell/config/ghostauth_users.json"
+	hostKeyPath  = "ghostshell/config/ssh_host_ed25519_key"
+	auditPath    = "ghostshell/logging/ssh_commands_audit.jsonl"
 	fontSize     = 24
 	windowWidth  = 1280
 	windowHeight = 720
@@ -116,185 +115,11 @@ func newTerminal() (*Terminal, error) {
 	return &Terminal{font: font}, nil
 }
 
-// -------------- SSH Manager (Quantum-Safe) --------------
-
-type SSHManager struct {
-	serverConfig *ssh.ServerConfig
-	address      string
-	connections  []string // track remote addresses
-	commands     []string // track executed commands
-	mu           sync.Mutex
-	// concurrency
-	ctx    context.Context
-	cancel context.CancelFunc
-	wg     sync.WaitGroup
-	// optional metrics
-	authFailuresCounter metrics.Counter
-}
-
-// NewSSHManager sets up a post-quantum SSH server config
-func NewSSHManager(address string) (*SSHManager, error) {
-	// generate logger
-	if err := setupLogger(); err != nil {
-		return nil, fmt.Errorf("logger setup failed: %w", err)
-	}
-
-	ctx, cancel := context.WithCancel(context.Background())
-	sm := &SSHManager{
-		address:     address,
-		connections: []string{},
-		commands:    []string{},
-		ctx:         ctx,
-		cancel:      cancel,
-	}
-
-	if err := sm.setupServerConfig(); err != nil {
-		return nil, err
-	}
-	sm.authFailuresCounter = metrics.NewCounter("ssh_auth_failures", "Count of SSH authentication failures")
-
-	return sm, nil
-}
-
-// setupServerConfig loads a post-quantum private key from oqs_vault & configures SSH
-func (sm *SSHManager) setupServerConfig() error {
-	// load a post-quantum private key from the vault
-	pqPrivateKey, err := oqs_vault.GetKeyManager().GeneratePQSPrivateKey()
-	if err != nil {
-		logger.Error("Failed to generate PQ private key", zap.Error(err))
-		return fmt.Errorf("failed to generate post-quantum key: %w", err)
-	}
-
-	signer, err := ssh.NewSignerFromKey(pqPrivateKey)
-	if err != nil {
-		logger.Error("Failed to create SSH signer from PQ key", zap.Error(err))
-		return fmt.Errorf("failed to create signer: %w", err)
-	}
-
-	// build server config
-	sm.serverConfig = &ssh.ServerConfig{
-		NoClientAuth: false, // or true if no auth
-	}
-	sm.serverConfig.AddHostKey(signer)
-
-	// Example post-quantum KEX + ciphers (some are hypothetical or require custom patch sets)
-	sm.serverConfig.Config.KeyExchanges = []string{
-		"oqs-kyber-512-sha3-256", // example, not a standard upstream
-		"curve25519-sha256",      // fallback
-	}
-	sm.serverConfig.Config.Ciphers = []string{
-		"aes256-gcm@openssh.com",
-		"chacha20-poly1305@openssh.com",
-	}
-
-	return nil
-}
-
-// Start runs a goroutine that listens for inbound SSH connections
-func (sm *SSHManager) Start() error {
-	ln, err := net.Listen("tcp", sm.address)
-	if err != nil {
-		logger.Error("Failed to listen on address", zap.String("address", sm.address), zap.Error(err))
-		return err
-	}
-	logger.Info("SSH server listening", zap.String("address", sm.address))
-
-	sm.wg.Add(1)
-	go sm.acceptLoop(ln)
-	return nil
-}
-
-// acceptLoop handles incoming connections until context is canceled
-func (sm *SSHManager) acceptLoop(ln net.Listener) {
-	defer sm.wg.Done()
-	defer ln.Close()
-
-	for {
-		select {
-		case <-sm.ctx.Done():
-			logger.Info("Stop accepting new SSH connections (context canceled)")
-			return
-		default:
-		}
+// logErrorHandler logs the errors ghostauth reports
+type logErrorHandler struct{}
 
-		ln.SetDeadline(time.Now().Add(2 * time.Second))
-		conn, err := ln.Accept()
-		if err != nil {
-			// check for net timeout
-			if ne, ok := err.(net.Error); ok && ne.Timeout() {
-				continue
-			}
-			logger.Warn("Accept error", zap.Error(err))
-			continue
-		}
-		sm.wg.Add(1)
-		go sm.handleConnection(conn)
-	}
-}
-
-// handleConnection performs the SSH handshake & channel management
-func (sm *SSHManager) handleConnection(conn net.Conn) {
-	defer sm.wg.Done()
-	defer conn.Close()
-
-	sshConn, channels, requests, err := ssh.NewServerConn(conn, sm.serverConfig)
-	if err != nil {
-		logger.Warn("SSH handshake failed", zap.Error(err))
-		sm.authFailuresCounter.Increment(1.0)
-		return
-	}
-
-	remote := sshConn.RemoteAddr().String()
-	logger.Info("SSH connection established", zap.String("remote", remote))
-
-	// track connection
-	sm.mu.Lock()
-	sm.connections = append(sm.connections, remote)
-	sm.mu.Unlock()
-
-	go ssh.DiscardRequests(requests)
-
-	for newCh := range channels {
-		switch newCh.ChannelType() {
-		case "session":
-			ch, reqs, err := newCh.Accept()
-			if err != nil {
-				logger.Warn("Channel accept error", zap.Error(err))
-				continue
-			}
-			go sm.handleSession(ch, reqs, remote)
-		default:
-			newCh.Reject(ssh.UnknownChannelType, "unsupported channel type")
-		}
-	}
-}
-
-// handleSession processes "exec" requests
-func (sm *SSHManager) handleSession(ch ssh.Channel, reqs <-chan *ssh.Request, remote string) {
-	defer ch.Close()
-
-	for req := range reqs {
-		switch req.Type {
-		case "exec":
-			cmd := string(req.Payload[4:]) // typical offset to skip exec length
-			logger.Info("Executing command", zap.String("command", cmd), zap.String("remote", remote))
-			sm.mu.Lock()
-			sm.commands = append(sm.commands, fmt.Sprintf("Remote: %s, CMD: %s", remote, cmd))
-			sm.mu.Unlock()
-
-			// write some response
-			ch.Write([]byte(fmt.Sprintf("Executed: %s\n", cmd)))
-			req.Reply(true, nil)
-		default:
-			req.Reply(false, nil)
-		}
-	}
-}
-
-// Stop signals the SSH manager to shut down
-func (sm *SSHManager) Stop() {
-	sm.cancel()
-	sm.wg.Wait()
+func (logErrorHandler) HandleError(context, message string) {
+	logger.Warn(message, zap.String("context", context))
 }
 
 // -------------- Raylib Particles UI --------------
@@ -320,9 +145,32 @@ func main() {
 
 	ps := generateParticles(maxParticles)
 
-	// 3) Initialize metrics & manager
-	metricsOverlay := metrics.NewMetricsOverlay() // hypothetical
-	manager, err := NewSSHManager(":2222")
+	// 3) Initialize the manager; the host key is kept so clients can pin it
+	hostKey, err := sshserver.LoadOrCreateHostKey(hostKeyPath)
+	if err != nil {
+		logger.Fatal("Failed to load SSH host key", zap.Error(err))
+	}
+	// users log in with the SSH keys ghostauth holds for them
+	auth, err := ghostauth.NewGhostAuth(&ghostauth.FileUserStorage{Path: usersPath}, logErrorHandler{})
+	if err != nil {
+		logger.Fatal("Failed to init ghostauth", zap.Error(err))
+	}
+	defer auth.Shutdown()
+
+	// sessions run the GhostShell commands each user is authorized for
+	shell, closeShell, err := newCommandShell(auth)
+	if err != nil {
+		logger.Fatal("Failed to init command shell", zap.Error(err))
+	}
+	defer closeShell()
+
+	// port forwarding stays off: logging in only grants the command shell
+	manager, err := sshserver.NewSSHManager(":2222", sshserver.ServerOptions{
+		HostKey:        hostKey,
+		AuthorizedKeys: auth,
+		Shell:          shell,
+		RecordDir:      recordDir,
+	}, logger)
 	if err != nil {
 		logger.Fatal("Failed to init SSH manager", zap.Error(err))
 	}
@@ -367,10 +215,7 @@ func main() {
 	manager.Stop()
 
 	// 7) Generate a report with connection & command logs
-	manager.mu.Lock()
-	connections := append([]string{}, manager.connections...)
-	commands := append([]string{}, manager.commands...)
-	manager.mu.Unlock()
+	connections, commands := manager.History()
 
 	lines := []string{"=== SSH Connections ==="}
 	lines = append(lines, connections...)
@@ -0,0 +1,70 @@
+package sshmgmt
+
+import (
+	"fmt"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// agentComment prefixes the comment on each key the in-process agent holds
+const agentComment = "ghostshell:"
+
+// Agent returns the in-process agent holding every connection's key. Hosts
+// reached with ForwardAgent use it, so keys never leave the vault as files.
+func (m *SSHManager) Agent() agent.Agent {
+	return m.agent
+}
+
+// parseSigner parses a PEM or OpenSSH private key; an empty key means the
+// connection logs in with the agent's keys
+func parseSigner(privateKey string) (ssh.Signer, error) {
+	if privateKey == "" {
+		return nil, nil
+	}
+	signer, err := ssh.ParsePrivateKey([]byte(privateKey))
+	if err != nil {
+		return nil, fmt.Errorf("invalid private key: %w", err)
+	}
+	return signer, nil
+}
+
+// addAgentKey adds a connection's key to the agent, replacing the key it had.
+// The caller holds m.mu.
+func (m *SSHManager) addAgentKey(name, privateKey string) error {
+	if privateKey == "" {
+		m.removeAgentKey(name)
+		return nil
+	}
+	raw, err := ssh.ParseRawPrivateKey([]byte(privateKey))
+	if err != nil {
+		return fmt.Errorf("invalid private key: %w", err)
+	}
+	signer, err := ssh.NewSignerFromKey(raw)
+	if err != nil {
+		return fmt.Errorf("invalid private key: %w", err)
+	}
+
+	m.removeAgentKey(name)
+	if err := m.agent.Add(agent.AddedKey{PrivateKey: raw, Comment: agentComment + name}); err != nil {
+		return fmt.Errorf("failed to add key to agent: %w", err)
+	}
+	m.agentKeys[name] = signer.PublicKey()
+	return nil
+}
+
+// removeAgentKey removes a connection's key from the agent, unless another
+// connection uses the same key. The caller holds m.mu.
+func (m *SSHManager) removeAgentKey(name string) {
+	key, ok := m.agentKeys[name]
+	if !ok {
+		return
+	}
+	delete(m.agentKeys, name)
+	for _, other := range m.agentKeys {
+		if string(other.Marshal()) == string(key.Marshal()) {
+			return
+		}
+	}
+	m.agent.Remove(key)
+}
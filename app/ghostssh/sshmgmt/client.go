@@ -0,0 +1,389 @@
+package sshmgmt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/pkg/sftp"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+const (
+	defaultKnownHostsPath = "ghostshell/config/known_hosts"
+	defaultDialTimeout    = 15 * time.Second
+	defaultKeepAlive      = 30 * time.Second
+)
+
+// ClientConfig configures how saved connections are dialed.
+type ClientConfig struct {
+	KnownHostsPath string        // managed known_hosts file
+	HostKeyPolicy  string        // HostKeyStrict or HostKeyAcceptNew (the default)
+	DialTimeout    time.Duration // per hop, handshake included
+	KeepAlive      time.Duration // interval between keepalives; negative disables them
+}
+
+func (c *ClientConfig) setDefaults() {
+	if c.KnownHostsPath == "" {
+		c.KnownHostsPath = defaultKnownHostsPath
+	}
+	if c.HostKeyPolicy == "" {
+		c.HostKeyPolicy = HostKeyAcceptNew
+	}
+	if c.DialTimeout <= 0 {
+		c.DialTimeout = defaultDialTimeout
+	}
+	if c.KeepAlive == 0 {
+		c.KeepAlive = defaultKeepAlive
+	}
+}
+
+// hostClient is an open connection, shared by every session and transfer to its host
+type hostClient struct {
+	client *ssh.Client
+	jumps  []*ssh.Client // the ProxyJump hops, first hop first
+	sftp   *sftp.Client
+	done   chan struct{}
+}
+
+// close closes the connection, then the hops it went through
+func (hc *hostClient) close() {
+	if hc.sftp != nil {
+		hc.sftp.Close()
+	}
+	hc.client.Close()
+	for i := len(hc.jumps) - 1; i >= 0; i-- {
+		hc.jumps[i].Close()
+	}
+}
+
+// hop is one connection on the way to a host
+type hop struct {
+	name    string // the saved connection, or the jump host as written
+	address string
+	user    string
+	signer  ssh.Signer
+}
+
+// Connect opens the named connection through its jump hosts, or returns the
+// one already open. Sessions on the returned client share one connection.
+func (m *SSHManager) Connect(ctx context.Context, name string) (*ssh.Client, error) {
+	hc, err := m.connect(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return hc.client, nil
+}
+
+func (m *SSHManager) connect(ctx context.Context, name string) (*hostClient, error) {
+	m.mu.Lock()
+	if hc, ok := m.clients[name]; ok {
+		m.mu.Unlock()
+		return hc, nil
+	}
+	conn, ok := m.connections[name]
+	if !ok {
+		m.mu.Unlock()
+		return nil, fmt.Errorf("connection '%s' not found", name)
+	}
+	forwardAgent := conn.ForwardAgent
+	hops, err := m.route(name, map[string]bool{})
+	m.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	hc, err := m.dial(ctx, hops)
+	if err != nil {
+		return nil, err
+	}
+	if forwardAgent {
+		if err := agent.ForwardToAgent(hc.client, m.agent); err != nil {
+			hc.close()
+			return nil, fmt.Errorf("failed to set up agent forwarding: %w", err)
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if existing, ok := m.clients[name]; ok {
+		// Connected concurrently; keep the first connection
+		hc.close()
+		return existing, nil
+	}
+	if _, ok := m.connections[name]; !ok {
+		hc.close()
+		return nil, fmt.Errorf("connection '%s' was deleted while connecting", name)
+	}
+	m.clients[name] = hc
+	go m.watch(name, hc)
+
+	m.logger.Info("SSH connection opened", zap.String("name", name), zap.Int("jumps", len(hc.jumps)))
+	return hc, nil
+}
+
+// route lists the hops to a saved connection, its jump hosts' own jump hosts
+// first. The caller holds m.mu.
+func (m *SSHManager) route(name string, visiting map[string]bool) ([]hop, error) {
+	if visiting[name] {
+		return nil, fmt.Errorf("jump host loop through connection '%s'", name)
+	}
+	conn, ok := m.connections[name]
+	if !ok {
+		return nil, fmt.Errorf("connection '%s' not found", name)
+	}
+	visiting[name] = true
+	defer delete(visiting, name)
+
+	signer, err := parseSigner(conn.PrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("connection '%s': %w", name, err)
+	}
+
+	var hops []hop
+	for _, jump := range conn.JumpHosts {
+		if _, saved := m.connections[jump]; saved {
+			route, err := m.route(jump, visiting)
+			if err != nil {
+				return nil, err
+			}
+			hops = append(hops, route...)
+			continue
+		}
+		user, address := conn.Username, jump
+		if i := strings.LastIndex(jump, "@"); i >= 0 {
+			user, address = jump[:i], jump[i+1:]
+		}
+		if address == "" {
+			return nil, fmt.Errorf("connection '%s': invalid jump host %q", name, jump)
+		}
+		hops = append(hops, hop{name: jump, address: normalizeAddress(address), user: user, signer: signer})
+	}
+	return append(hops, hop{name: name, address: conn.Address, user: conn.Username, signer: signer}), nil
+}
+
+// dial connects to each hop through the one before it
+func (m *SSHManager) dial(ctx context.Context, hops []hop) (*hostClient, error) {
+	var clients []*ssh.Client
+	closeAll := func() {
+		for i := len(clients) - 1; i >= 0; i-- {
+			clients[i].Close()
+		}
+	}
+
+	for _, h := range hops {
+		client, err := m.dialHop(ctx, h, clients)
+		if err != nil {
+			closeAll()
+			return nil, err
+		}
+		clients = append(clients, client)
+	}
+	n := len(clients) - 1
+	return &hostClient{client: clients[n], jumps: clients[:n], done: make(chan struct{})}, nil
+}
+
+// dialHop opens a TCP connection to a hop, through the last of the open hops if
+// there are any, and logs in
+func (m *SSHManager) dialHop(ctx context.Context, h hop, through []*ssh.Client) (*ssh.Client, error) {
+	ctx, cancel := context.WithTimeout(ctx, m.config.DialTimeout)
+	defer cancel()
+
+	var nc net.Conn
+	var err error
+	if len(through) == 0 {
+		var d net.Dialer
+		nc, err = d.DialContext(ctx, "tcp", h.address)
+	} else {
+		nc, err = through[len(through)-1].DialContext(ctx, "tcp", h.address)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach %s (%s): %w", h.name, h.address, err)
+	}
+
+	var auth []ssh.AuthMethod
+	if h.signer != nil {
+		auth = append(auth, ssh.PublicKeys(h.signer))
+	}
+	auth = append(auth, ssh.PublicKeysCallback(m.agent.Signers))
+	config := &ssh.ClientConfig{
+		User:            h.user,
+		Auth:            auth,
+		HostKeyCallback: m.knownHosts.HostKeyCallback(),
+		Timeout:         m.config.DialTimeout,
+	}
+
+	// NewClientConn doesn't take a context, so closing the connection stops it
+	stop, stopped := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(stopped)
+		select {
+		case <-ctx.Done():
+			nc.Close()
+		case <-stop:
+		}
+	}()
+	c, chans, reqs, err := ssh.NewClientConn(nc, h.address, config)
+	close(stop)
+	<-stopped
+	if err == nil && ctx.Err() != nil {
+		c.Close()
+		err = ctx.Err()
+	}
+	if err != nil {
+		nc.Close()
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		return nil, fmt.Errorf("failed to log in to %s (%s): %w", h.name, h.address, err)
+	}
+	return ssh.NewClient(c, chans, reqs), nil
+}
+
+// watch sends keepalives until the connection drops, then forgets it
+func (m *SSHManager) watch(name string, hc *hostClient) {
+	closed := make(chan struct{})
+	go func() {
+		hc.client.Wait()
+		close(closed)
+	}()
+
+	var tick <-chan time.Time
+	if m.config.KeepAlive > 0 {
+		ticker := time.NewTicker(m.config.KeepAlive)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case <-closed:
+			m.mu.Lock()
+			if m.clients[name] == hc {
+				delete(m.clients, name)
+			}
+			hc.close()
+			m.mu.Unlock()
+			close(hc.done)
+			m.logger.Info("SSH connection closed", zap.String("name", name))
+			return
+		case <-tick:
+			if _, _, err := hc.client.SendRequest("keepalive@openssh.com", true, nil); err != nil {
+				m.logger.Warn("SSH keepalive failed", zap.String("name", name), zap.Error(err))
+				hc.client.Close()
+			}
+		}
+	}
+}
+
+// Connected reports whether the named connection is open.
+func (m *SSHManager) Connected(name string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, ok := m.clients[name]
+	return ok
+}
+
+// Disconnect closes the named connection and every session on it.
+func (m *SSHManager) Disconnect(name string) error {
+	m.mu.Lock()
+	hc, ok := m.clients[name]
+	m.disconnectLocked(name)
+	m.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("connection '%s' is not open", name)
+	}
+	<-hc.done
+	return nil
+}
+
+// disconnectLocked closes a connection if it is open. The caller holds m.mu.
+func (m *SSHManager) disconnectLocked(name string) {
+	if hc, ok := m.clients[name]; ok {
+		delete(m.clients, name)
+		hc.close()
+	}
+}
+
+// Close closes every open connection.
+func (m *SSHManager) Close() {
+	m.mu.Lock()
+	var open []*hostClient
+	for name, hc := range m.clients {
+		open = append(open, hc)
+		m.disconnectLocked(name)
+	}
+	m.mu.Unlock()
+	for _, hc := range open {
+		<-hc.done
+	}
+}
+
+// NewSession opens a session on the named connection, connecting if needed,
+// with agent forwarding requested if the connection forwards the agent.
+func (m *SSHManager) NewSession(ctx context.Context, name string) (*ssh.Session, error) {
+	hc, err := m.connect(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	session, err := hc.client.NewSession()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open session on '%s': %w", name, err)
+	}
+
+	m.mu.Lock()
+	forwardAgent := false
+	if conn, ok := m.connections[name]; ok {
+		forwardAgent = conn.ForwardAgent
+	}
+	m.mu.Unlock()
+	if forwardAgent {
+		if err := agent.RequestAgentForwarding(session); err != nil {
+			session.Close()
+			return nil, fmt.Errorf("failed to request agent forwarding on '%s': %w", name, err)
+		}
+	}
+	return session, nil
+}
+
+// Run runs a command on the named connection and returns its combined output.
+// A command that exits non-zero returns its output with an *ssh.ExitError.
+func (m *SSHManager) Run(ctx context.Context, name, command string) (string, error) {
+	session, err := m.NewSession(ctx, name)
+	if err != nil {
+		return "", err
+	}
+	defer session.Close()
+
+	type result struct {
+		output []byte
+		err    error
+	}
+	done := make(chan result, 1)
+	go func() {
+		output, err := session.CombinedOutput(command)
+		done <- result{output, err}
+	}()
+	var res result
+	select {
+	case res = <-done:
+	case <-ctx.Done():
+		session.Signal(ssh.SIGKILL)
+		session.Close()
+		res = <-done
+		return string(res.output), ctx.Err()
+	}
+	output, err := string(res.output), res.err
+
+	m.logger.Info("SSH command run", zap.String("name", name), zap.String("command", command), zap.Error(err))
+	var exitErr *ssh.ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		return output, fmt.Errorf("failed to run command on '%s': %w", name, err)
+	}
+	return output, err
+}
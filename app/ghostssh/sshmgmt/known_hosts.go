@@ -0,0 +1,158 @@
+package sshmgmt
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// Host key policies for hosts missing from known_hosts. A host whose key
+// changed is always refused.
+const (
+	HostKeyStrict    = "strict"     // refuse unknown hosts
+	HostKeyAcceptNew = "accept-new" // trust and record a host's first key
+)
+
+// KnownHosts verifies host keys against a known_hosts file it manages.
+type KnownHosts struct {
+	mu       sync.Mutex
+	path     string
+	policy   string
+	callback ssh.HostKeyCallback
+}
+
+// NewKnownHosts loads the known_hosts file at path, creating it if missing.
+func NewKnownHosts(path, policy string) (*KnownHosts, error) {
+	if policy != HostKeyStrict && policy != HostKeyAcceptNew {
+		return nil, fmt.Errorf("unknown host key policy %q", policy)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create known_hosts directory: %w", err)
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open known_hosts: %w", err)
+	}
+	f.Close()
+
+	kh := &KnownHosts{path: path, policy: policy}
+	if err := kh.load(); err != nil {
+		return nil, err
+	}
+	return kh, nil
+}
+
+func (kh *KnownHosts) load() error {
+	callback, err := knownhosts.New(kh.path)
+	if err != nil {
+		return fmt.Errorf("failed to load known_hosts: %w", err)
+	}
+	kh.callback = callback
+	return nil
+}
+
+// HostKeyCallback checks a host's key, recording it if the host is new and
+// the policy accepts new hosts.
+func (kh *KnownHosts) HostKeyCallback() ssh.HostKeyCallback {
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		kh.mu.Lock()
+		defer kh.mu.Unlock()
+
+		err := kh.callback(hostname, remote, key)
+		var keyErr *knownhosts.KeyError
+		if !errors.As(err, &keyErr) {
+			return err
+		}
+		if len(keyErr.Want) > 0 {
+			return fmt.Errorf("host key for %s has changed to %s, possible man-in-the-middle attack: %w",
+				hostname, ssh.FingerprintSHA256(key), err)
+		}
+		if kh.policy != HostKeyAcceptNew {
+			return fmt.Errorf("host %s is not in known_hosts (key %s): %w", hostname, ssh.FingerprintSHA256(key), err)
+		}
+		return kh.add(hostname, key)
+	}
+}
+
+// add records a host's key. The caller holds kh.mu.
+func (kh *KnownHosts) add(hostname string, key ssh.PublicKey) error {
+	f, err := os.OpenFile(kh.path, os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open known_hosts: %w", err)
+	}
+	line := knownhosts.Line([]string{knownhosts.Normalize(hostname)}, key)
+	if _, err := fmt.Fprintln(f, line); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write known_hosts: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to write known_hosts: %w", err)
+	}
+	return kh.load()
+}
+
+// Forget removes a host's keys, as after a host is legitimately rekeyed.
+// Hashed entries are left alone.
+func (kh *KnownHosts) Forget(host string) error {
+	kh.mu.Lock()
+	defer kh.mu.Unlock()
+
+	data, err := os.ReadFile(kh.path)
+	if err != nil {
+		return fmt.Errorf("failed to read known_hosts: %w", err)
+	}
+	host = knownhosts.Normalize(host)
+
+	var kept []string
+	found := false
+	scanner := bufio.NewScanner(strings.NewReader(string(data)))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if knownHostsLineMatches(line, host) {
+			found = true
+			continue
+		}
+		kept = append(kept, line)
+	}
+	if !found {
+		return fmt.Errorf("host %s is not in known_hosts", host)
+	}
+
+	content := strings.Join(kept, "\n")
+	if content != "" {
+		content += "\n"
+	}
+	if err := os.WriteFile(kh.path, []byte(content), 0600); err != nil {
+		return fmt.Errorf("failed to write known_hosts: %w", err)
+	}
+	return kh.load()
+}
+
+// knownHostsLineMatches reports whether a known_hosts line lists host
+func knownHostsLineMatches(line, host string) bool {
+	fields := strings.Fields(line)
+	if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+		return false
+	}
+	hosts := fields[0]
+	if strings.HasPrefix(hosts, "@") {
+		if len(fields) < 2 {
+			return false
+		}
+		hosts = fields[1]
+	}
+	for _, h := range strings.Split(hosts, ",") {
+		if h == host {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,149 @@
+package sshmgmt
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/pkg/sftp"
+	"go.uber.org/zap"
+)
+
+// SFTP returns an SFTP client on the named connection, connecting if needed.
+// It shares the connection with sessions and closes with it.
+func (m *SSHManager) SFTP(ctx context.Context, name string) (*sftp.Client, error) {
+	hc, err := m.connect(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	if hc.sftp != nil {
+		client := hc.sftp
+		m.mu.Unlock()
+		return client, nil
+	}
+	m.mu.Unlock()
+
+	client, err := sftp.NewClient(hc.client)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start SFTP on '%s': %w", name, err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if hc.sftp != nil {
+		client.Close()
+		return hc.sftp, nil
+	}
+	hc.sftp = client
+	return client, nil
+}
+
+// Upload copies a local file to the named connection's host, returning the
+// bytes copied. A remote path ending in a slash is a directory to copy into.
+func (m *SSHManager) Upload(ctx context.Context, name, localPath, remotePath string) (int64, error) {
+	client, err := m.SFTP(ctx, name)
+	if err != nil {
+		return 0, err
+	}
+	if remotePath == "" || remotePath[len(remotePath)-1] == '/' {
+		remotePath = path.Join(remotePath, filepath.Base(localPath))
+	}
+
+	src, err := os.Open(localPath)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open %s: %w", localPath, err)
+	}
+	defer src.Close()
+	dst, err := client.Create(remotePath)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create %s on '%s': %w", remotePath, name, err)
+	}
+
+	n, err := copyContext(ctx, dst, src)
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return n, fmt.Errorf("failed to upload %s to '%s': %w", localPath, name, err)
+	}
+	m.logger.Info("SFTP upload", zap.String("name", name), zap.String("local", localPath), zap.String("remote", remotePath), zap.Int64("bytes", n))
+	return n, nil
+}
+
+// Download copies a file from the named connection's host, returning the bytes
+// copied. A local path that is a directory is copied into.
+func (m *SSHManager) Download(ctx context.Context, name, remotePath, localPath string) (int64, error) {
+	client, err := m.SFTP(ctx, name)
+	if err != nil {
+		return 0, err
+	}
+	if info, err := os.Stat(localPath); localPath == "" || (err == nil && info.IsDir()) {
+		localPath = filepath.Join(localPath, path.Base(remotePath))
+	}
+
+	src, err := client.Open(remotePath)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open %s on '%s': %w", remotePath, name, err)
+	}
+	defer src.Close()
+	dst, err := os.OpenFile(localPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create %s: %w", localPath, err)
+	}
+
+	n, err := copyContext(ctx, dst, src)
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return n, fmt.Errorf("failed to download %s from '%s': %w", remotePath, name, err)
+	}
+	m.logger.Info("SFTP download", zap.String("name", name), zap.String("remote", remotePath), zap.String("local", localPath), zap.Int64("bytes", n))
+	return n, nil
+}
+
+// ListDir lists a directory on the named connection's host.
+func (m *SSHManager) ListDir(ctx context.Context, name, remotePath string) ([]os.FileInfo, error) {
+	client, err := m.SFTP(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if remotePath == "" {
+		remotePath = "."
+	}
+	entries, err := client.ReadDir(remotePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s on '%s': %w", remotePath, name, err)
+	}
+	return entries, nil
+}
+
+// copyContext copies until done or ctx is cancelled
+func copyContext(ctx context.Context, dst io.Writer, src io.Reader) (int64, error) {
+	buf := make([]byte, 32*1024)
+	var n int64
+	for {
+		if err := ctx.Err(); err != nil {
+			return n, err
+		}
+		nr, err := src.Read(buf)
+		if nr > 0 {
+			nw, werr := dst.Write(buf[:nr])
+			n += int64(nw)
+			if werr != nil {
+				return n, werr
+			}
+		}
+		if err == io.EOF {
+			return n, nil
+		}
+		if err != nil {
+			return n, err
+		}
+	}
+}
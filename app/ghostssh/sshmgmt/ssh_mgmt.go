@@ -0,0 +1,222 @@
+package sshmgmt
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// Vault stores connections, private keys included, encrypted.
+// *oqs_vault.VaultManager implements it.
+type Vault interface {
+	Store(key string, value interface{}) error
+	Delete(key string) error
+}
+
+// SSHConnection represents a saved or temporary SSH connection.
+type SSHConnection struct {
+	Name       string
+	Address    string
+	Username   string
+	PrivateKey string
+	// ProxyJump chain, first hop first: names of saved connections, or
+	// [user@]host[:port] to log in with this connection's user and keys
+	JumpHosts []string
+	// ForwardAgent lets the host use the in-process agent's keys
+	ForwardAgent bool
+	CreatedAt    time.Time
+	Temporary    bool
+}
+
+// SSHManager encapsulates SSH connection management.
+type SSHManager struct {
+	mu          sync.Mutex
+	connections map[string]*SSHConnection
+	vault       Vault // Post-Quantum secure vault
+	config      ClientConfig
+	knownHosts  *KnownHosts
+	logger      *zap.Logger
+
+	// The in-process agent holds every connection's key
+	agent     agent.Agent
+	agentKeys map[string]ssh.PublicKey // by connection name
+
+	// Open connections, by connection name, shared by sessions
+	clients map[string]*hostClient
+}
+
+// NewSSHManager initializes the SSHManager with a secure vault.
+func NewSSHManager(vault Vault, config ClientConfig, logger *zap.Logger) (*SSHManager, error) {
+	config.setDefaults()
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	knownHosts, err := NewKnownHosts(config.KnownHostsPath, config.HostKeyPolicy)
+	if err != nil {
+		return nil, err
+	}
+	return &SSHManager{
+		connections: make(map[string]*SSHConnection),
+		vault:       vault,
+		config:      config,
+		knownHosts:  knownHosts,
+		logger:      logger,
+		agent:       agent.NewKeyring(),
+		agentKeys:   make(map[string]ssh.PublicKey),
+		clients:     make(map[string]*hostClient),
+	}, nil
+}
+
+// SaveConnection saves a new or updated SSH connection securely.
+func (m *SSHManager) SaveConnection(name, address, username, privateKey string, temporary bool) error {
+	return m.SaveConnectionConfig(SSHConnection{
+		Name:       name,
+		Address:    address,
+		Username:   username,
+		PrivateKey: privateKey,
+		Temporary:  temporary,
+	})
+}
+
+// SaveConnectionConfig is SaveConnection with jump hosts and agent forwarding.
+// An open connection it replaces is closed.
+func (m *SSHManager) SaveConnectionConfig(conn SSHConnection) error {
+	if conn.Name == "" {
+		return fmt.Errorf("connection name cannot be empty")
+	}
+	conn.Address = normalizeAddress(conn.Address)
+	conn.JumpHosts = append([]string(nil), conn.JumpHosts...)
+	conn.CreatedAt = time.Now()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.addAgentKey(conn.Name, conn.PrivateKey); err != nil {
+		return err
+	}
+
+	// Encrypt and store the connection securely in the vault
+	encryptedKey := fmt.Sprintf("ssh_conn_%s", conn.Name)
+	if err := m.vault.Store(encryptedKey, &conn); err != nil {
+		m.removeAgentKey(conn.Name)
+		return fmt.Errorf("failed to store connection in vault: %w", err)
+	}
+
+	m.connections[conn.Name] = &conn
+	m.disconnectLocked(conn.Name)
+	return nil
+}
+
+// GetConnection retrieves an SSH connection by name.
+func (m *SSHManager) GetConnection(name string) (*SSHConnection, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	conn, exists := m.connections[name]
+	if !exists {
+		return nil, fmt.Errorf("connection '%s' not found", name)
+	}
+	return conn, nil
+}
+
+// ListConnections lists all saved SSH connections, sorted by name.
+func (m *SSHManager) ListConnections() []SSHConnection {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var connections []SSHConnection
+	for _, conn := range m.connections {
+		c := *conn
+		c.JumpHosts = append([]string(nil), conn.JumpHosts...)
+		connections = append(connections, c)
+	}
+	sort.Slice(connections, func(i, j int) bool { return connections[i].Name < connections[j].Name })
+	return connections
+}
+
+// DeleteConnection deletes an SSH connection by name, closing it if open.
+func (m *SSHManager) DeleteConnection(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, exists := m.connections[name]; !exists {
+		return fmt.Errorf("connection '%s' not found", name)
+	}
+
+	encryptedKey := fmt.Sprintf("ssh_conn_%s", name)
+	if err := m.vault.Delete(encryptedKey); err != nil {
+		return fmt.Errorf("failed to delete connection from vault: %w", err)
+	}
+
+	m.disconnectLocked(name)
+	m.removeAgentKey(name)
+	delete(m.connections, name)
+	return nil
+}
+
+// CreateTempConnection creates a temporary SSH connection (not saved to disk).
+func (m *SSHManager) CreateTempConnection(address, username, privateKey string) (*SSHConnection, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	tempName := fmt.Sprintf("temp_%d", time.Now().UnixNano())
+	conn := &SSHConnection{
+		Name:       tempName,
+		Address:    normalizeAddress(address),
+		Username:   username,
+		PrivateKey: privateKey,
+		CreatedAt:  time.Now(),
+		Temporary:  true,
+	}
+	if err := m.addAgentKey(tempName, privateKey); err != nil {
+		return nil, err
+	}
+
+	m.connections[tempName] = conn
+	return conn, nil
+}
+
+// CleanupTempConnections removes all temporary connections.
+func (m *SSHManager) CleanupTempConnections() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for name, conn := range m.connections {
+		if conn.Temporary {
+			m.disconnectLocked(name)
+			m.removeAgentKey(name)
+			delete(m.connections, name)
+		}
+	}
+}
+
+// GenerateReport generates a report of all active SSH connections.
+func (m *SSHManager) GenerateReport() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	report := []string{"=== SSH Connections Report ==="}
+	for _, conn := range m.connections {
+		_, connected := m.clients[conn.Name]
+		report = append(report, fmt.Sprintf(
+			"Name: %s\nAddress: %s\nUsername: %s\nJump Hosts: %s\nCreated At: %s\nTemporary: %v\nConnected: %v\n---",
+			conn.Name, conn.Address, conn.Username, strings.Join(conn.JumpHosts, " -> "), conn.CreatedAt.Format(time.RFC3339), conn.Temporary, connected,
+		))
+	}
+	return report
+}
+
+// normalizeAddress adds the default SSH port to an address without one.
+func normalizeAddress(address string) string {
+	if _, _, err := net.SplitHostPort(address); err == nil {
+		return address
+	}
+	return net.JoinHostPort(strings.Trim(address, "[]"), "22")
+}
@@ -0,0 +1,508 @@
+package sshmgmt
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// memVault keeps what it stores in memory
+type memVault struct {
+	mu    sync.Mutex
+	items map[string]interface{}
+}
+
+func (v *memVault) Store(key string, value interface{}) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.items == nil {
+		v.items = make(map[string]interface{})
+	}
+	v.items[key] = value
+	return nil
+}
+
+func (v *memVault) Delete(key string) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	delete(v.items, key)
+	return nil
+}
+
+// newTestKey returns an ed25519 key as OpenSSH PEM, and its signer
+func newTestKey(t *testing.T) (string, ssh.Signer) {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, err := ssh.MarshalPrivateKey(key, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(pem.EncodeToMemory(block)), signer
+}
+
+// testServer is an SSH server that runs "echo" and "agent", forwards
+// direct-tcpip channels and serves SFTP from dir
+type testServer struct {
+	ln      net.Listener
+	hostKey ssh.Signer
+	dir     string
+	conns   atomic.Int32
+	allowed map[string]bool // authorized public keys, marshaled
+
+	mu       sync.Mutex
+	sessions int
+}
+
+func startTestServer(t *testing.T, authorized ...ssh.PublicKey) *testServer {
+	t.Helper()
+	_, hostKey := newTestKey(t)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := &testServer{ln: ln, hostKey: hostKey, dir: t.TempDir(), allowed: map[string]bool{}}
+	for _, key := range authorized {
+		ts.allowed[string(key.Marshal())] = true
+	}
+	t.Cleanup(func() { ln.Close() })
+	go ts.serve()
+	return ts
+}
+
+func (ts *testServer) Addr() string {
+	return ts.ln.Addr().String()
+}
+
+// HostKey returns the server's host key
+func (ts *testServer) HostKey() ssh.Signer {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	return ts.hostKey
+}
+
+// Rekey changes the server's host key for new connections
+func (ts *testServer) Rekey(t *testing.T) {
+	_, hostKey := newTestKey(t)
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	ts.hostKey = hostKey
+}
+
+func (ts *testServer) serve() {
+	for {
+		nc, err := ts.ln.Accept()
+		if err != nil {
+			return
+		}
+		ts.conns.Add(1)
+		config := &ssh.ServerConfig{
+			PublicKeyCallback: func(meta ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+				if ts.allowed[string(key.Marshal())] {
+					return nil, nil
+				}
+				return nil, errors.New("unauthorized key")
+			},
+		}
+		config.AddHostKey(ts.HostKey())
+		go func() {
+			conn, chans, reqs, err := ssh.NewServerConn(nc, config)
+			if err != nil {
+				nc.Close()
+				return
+			}
+			defer conn.Close()
+			go ssh.DiscardRequests(reqs)
+			for newCh := range chans {
+				switch newCh.ChannelType() {
+				case "session":
+					ch, reqs, err := newCh.Accept()
+					if err != nil {
+						continue
+					}
+					ts.mu.Lock()
+					ts.sessions++
+					ts.mu.Unlock()
+					go ts.session(conn, ch, reqs)
+				case "direct-tcpip":
+					var msg struct {
+						Host       string
+						Port       uint32
+						OriginIP   string
+						OriginPort uint32
+					}
+					if err := ssh.Unmarshal(newCh.ExtraData(), &msg); err != nil {
+						newCh.Reject(ssh.ConnectionFailed, err.Error())
+						continue
+					}
+					target, err := net.Dial("tcp", net.JoinHostPort(msg.Host, strconv.Itoa(int(msg.Port))))
+					if err != nil {
+						newCh.Reject(ssh.ConnectionFailed, err.Error())
+						continue
+					}
+					ch, reqs, err := newCh.Accept()
+					if err != nil {
+						target.Close()
+						continue
+					}
+					go ssh.DiscardRequests(reqs)
+					go func() {
+						go func() {
+							io.Copy(target, ch)
+							target.Close()
+						}()
+						io.Copy(ch, target)
+						ch.Close()
+					}()
+				default:
+					newCh.Reject(ssh.UnknownChannelType, "unsupported")
+				}
+			}
+		}()
+	}
+}
+
+func (ts *testServer) session(conn *ssh.ServerConn, ch ssh.Channel, reqs <-chan *ssh.Request) {
+	defer ch.Close()
+	defer func() { go ssh.DiscardRequests(reqs) }()
+	forwardAgent := false
+	for req := range reqs {
+		switch req.Type {
+		case "auth-agent-req@openssh.com":
+			forwardAgent = true
+			req.Reply(true, nil)
+		case "exec":
+			var msg struct{ Command string }
+			ssh.Unmarshal(req.Payload, &msg)
+			req.Reply(true, nil)
+			status := ts.exec(conn, ch, msg.Command, forwardAgent)
+			ch.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{status}))
+			return
+		case "subsystem":
+			var msg struct{ Name string }
+			ssh.Unmarshal(req.Payload, &msg)
+			if msg.Name != "sftp" {
+				req.Reply(false, nil)
+				continue
+			}
+			req.Reply(true, nil)
+			server, err := sftp.NewServer(ch, sftp.WithServerWorkingDirectory(ts.dir))
+			if err != nil {
+				return
+			}
+			server.Serve()
+			server.Close()
+			return
+		default:
+			req.Reply(false, nil)
+		}
+	}
+}
+
+func (ts *testServer) exec(conn *ssh.ServerConn, ch ssh.Channel, command string, forwardAgent bool) uint32 {
+	args := strings.Fields(command)
+	switch {
+	case len(args) > 0 && args[0] == "echo":
+		fmt.Fprintf(ch, "%s@%s: %s\n", conn.User(), ts.Addr(), strings.Join(args[1:], " "))
+		return 0
+	case command == "agent":
+		// List the keys in the client's agent, through agent forwarding
+		if !forwardAgent {
+			fmt.Fprintln(ch.Stderr(), "agent forwarding was not requested")
+			return 1
+		}
+		agentCh, reqs, err := conn.OpenChannel("auth-agent@openssh.com", nil)
+		if err != nil {
+			fmt.Fprintln(ch.Stderr(), err)
+			return 1
+		}
+		go ssh.DiscardRequests(reqs)
+		defer agentCh.Close()
+		keys, err := agent.NewClient(agentCh).List()
+		if err != nil {
+			fmt.Fprintln(ch.Stderr(), err)
+			return 1
+		}
+		for _, key := range keys {
+			fmt.Fprintln(ch, key.Comment)
+		}
+		return 0
+	default:
+		fmt.Fprintf(ch.Stderr(), "%s: command not found\n", command)
+		return 127
+	}
+}
+
+func (ts *testServer) Sessions() int {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	return ts.sessions
+}
+
+func newTestManager(t *testing.T, config ClientConfig) *SSHManager {
+	t.Helper()
+	if config.KnownHostsPath == "" {
+		config.KnownHostsPath = filepath.Join(t.TempDir(), "known_hosts")
+	}
+	m, err := NewSSHManager(&memVault{}, config, nil)
+	if err != nil {
+		t.Fatalf("NewSSHManager: %v", err)
+	}
+	t.Cleanup(m.Close)
+	return m
+}
+
+func TestKnownHosts(t *testing.T) {
+	pemKey, signer := newTestKey(t)
+	server := startTestServer(t, signer.PublicKey())
+	path := filepath.Join(t.TempDir(), "known_hosts")
+	ctx := context.Background()
+
+	// Strict refuses a host it doesn't know
+	strict := newTestManager(t, ClientConfig{KnownHostsPath: path, HostKeyPolicy: HostKeyStrict})
+	if err := strict.SaveConnection("target", server.Addr(), "alice", pemKey, false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := strict.Run(ctx, "target", "echo hi"); err == nil || !strings.Contains(err.Error(), "not in known_hosts") {
+		t.Fatalf("expected an unknown host to be refused, got %v", err)
+	}
+
+	// accept-new records it, after which strict accepts it
+	m := newTestManager(t, ClientConfig{KnownHostsPath: path})
+	m.SaveConnection("target", server.Addr(), "alice", pemKey, false)
+	if out, err := m.Run(ctx, "target", "echo hi"); err != nil || out != "alice@"+server.Addr()+": hi\n" {
+		t.Fatalf("unexpected output %q: %v", out, err)
+	}
+	data, _ := os.ReadFile(path)
+	if !strings.Contains(string(data), strings.TrimSpace(string(ssh.MarshalAuthorizedKey(server.HostKey().PublicKey())))) {
+		t.Fatalf("expected the host key to be recorded, got %q", data)
+	}
+	strict = newTestManager(t, ClientConfig{KnownHostsPath: path, HostKeyPolicy: HostKeyStrict})
+	strict.SaveConnection("target", server.Addr(), "alice", pemKey, false)
+	if _, err := strict.Run(ctx, "target", "echo hi"); err != nil {
+		t.Fatalf("expected the recorded host to be accepted: %v", err)
+	}
+
+	// A changed key is refused even by accept-new, until the host is forgotten
+	server.Rekey(t)
+	m = newTestManager(t, ClientConfig{KnownHostsPath: path})
+	m.SaveConnection("target", server.Addr(), "alice", pemKey, false)
+	if _, err := m.Run(ctx, "target", "echo hi"); err == nil || !strings.Contains(err.Error(), "has changed") {
+		t.Fatalf("expected a changed host key to be refused, got %v", err)
+	}
+	if err := m.knownHosts.Forget(server.Addr()); err != nil {
+		t.Fatalf("Forget: %v", err)
+	}
+	if _, err := m.Run(ctx, "target", "echo hi"); err != nil {
+		t.Fatalf("expected the new key to be accepted once forgotten: %v", err)
+	}
+}
+
+func TestJumpHosts(t *testing.T) {
+	pemKey, signer := newTestKey(t)
+	bastion := startTestServer(t, signer.PublicKey())
+	inner := startTestServer(t, signer.PublicKey())
+	target := startTestServer(t, signer.PublicKey())
+	m := newTestManager(t, ClientConfig{})
+	ctx := context.Background()
+
+	// bastion is saved; inner is reached by address, as bob
+	m.SaveConnection("bastion", bastion.Addr(), "alice", pemKey, false)
+	err := m.SaveConnectionConfig(SSHConnection{
+		Name:       "target",
+		Address:    target.Addr(),
+		Username:   "alice",
+		PrivateKey: pemKey,
+		JumpHosts:  []string{"bastion", "bob@" + inner.Addr()},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := m.Run(ctx, "target", "echo through the jump hosts")
+	if err != nil || out != "alice@"+target.Addr()+": through the jump hosts\n" {
+		t.Fatalf("unexpected output %q: %v", out, err)
+	}
+	// Only the bastion is dialed directly; each hop is logged into once
+	if bastion.conns.Load() != 1 || inner.conns.Load() != 1 || target.conns.Load() != 1 {
+		t.Errorf("unexpected connection counts %d %d %d", bastion.conns.Load(), inner.conns.Load(), target.conns.Load())
+	}
+	if !m.Connected("target") {
+		t.Error("expected target to stay connected")
+	}
+
+	if err := m.Disconnect("target"); err != nil {
+		t.Fatalf("Disconnect: %v", err)
+	}
+	if m.Connected("target") {
+		t.Error("expected target to be disconnected")
+	}
+
+	// A jump host that leads back to the connection is refused
+	m.SaveConnectionConfig(SSHConnection{Name: "a", Address: target.Addr(), Username: "alice", JumpHosts: []string{"b"}})
+	m.SaveConnectionConfig(SSHConnection{Name: "b", Address: target.Addr(), Username: "alice", JumpHosts: []string{"a"}})
+	if _, err := m.Connect(ctx, "a"); err == nil || !strings.Contains(err.Error(), "loop") {
+		t.Errorf("expected a jump host loop to be refused, got %v", err)
+	}
+}
+
+func TestMultiplexing(t *testing.T) {
+	pemKey, signer := newTestKey(t)
+	server := startTestServer(t, signer.PublicKey())
+	m := newTestManager(t, ClientConfig{})
+	m.SaveConnection("target", server.Addr(), "alice", pemKey, false)
+	ctx := context.Background()
+
+	client, err := m.Connect(ctx, "target")
+	if err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	if again, _ := m.Connect(ctx, "target"); again != client {
+		t.Error("expected Connect to return the open connection")
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			out, err := m.Run(ctx, "target", fmt.Sprintf("echo %d", i))
+			if err == nil && out != fmt.Sprintf("alice@%s: %d\n", server.Addr(), i) {
+				err = fmt.Errorf("unexpected output %q", out)
+			}
+			errs <- err
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Error(err)
+		}
+	}
+
+	// Every session went over the one connection
+	if server.conns.Load() != 1 || server.Sessions() != 8 {
+		t.Errorf("expected 8 sessions on 1 connection, got %d on %d", server.Sessions(), server.conns.Load())
+	}
+
+	var exitErr *ssh.ExitError
+	out, err := m.Run(ctx, "target", "nonsense")
+	if !errors.As(err, &exitErr) || exitErr.ExitStatus() != 127 || out != "nonsense: command not found\n" {
+		t.Errorf("expected exit status 127, got %q: %v", out, err)
+	}
+
+	// Deleting the connection closes it
+	m.DeleteConnection("target")
+	deadline := time.Now().Add(5 * time.Second)
+	for m.Connected("target") && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if m.Connected("target") {
+		t.Error("expected the deleted connection to be closed")
+	}
+}
+
+func TestAgentForwarding(t *testing.T) {
+	pemKey, signer := newTestKey(t)
+	otherKey, _ := newTestKey(t)
+	server := startTestServer(t, signer.PublicKey())
+	m := newTestManager(t, ClientConfig{})
+	ctx := context.Background()
+
+	m.SaveConnection("plain", server.Addr(), "alice", pemKey, false)
+	m.SaveConnectionConfig(SSHConnection{Name: "forwarding", Address: server.Addr(), Username: "alice", PrivateKey: pemKey, ForwardAgent: true})
+	m.SaveConnection("other", server.Addr(), "alice", otherKey, false)
+
+	if _, err := m.Run(ctx, "plain", "agent"); err == nil {
+		t.Error("expected no agent without ForwardAgent")
+	}
+	out, err := m.Run(ctx, "forwarding", "agent")
+	if err != nil {
+		t.Fatalf("agent: %q %v", out, err)
+	}
+	// plain and forwarding share a key, which the agent holds once
+	if out != "ghostshell:forwarding\nghostshell:other\n" {
+		t.Errorf("unexpected agent keys %q", out)
+	}
+
+	// A connection without a key logs in with the agent's
+	m.SaveConnection("keyless", server.Addr(), "alice", "", false)
+	if _, err := m.Run(ctx, "keyless", "echo hi"); err != nil {
+		t.Errorf("expected the agent's key to log in: %v", err)
+	}
+
+	m.DeleteConnection("other")
+	keys, _ := m.Agent().List()
+	if len(keys) != 1 {
+		t.Errorf("expected the deleted connection's key to leave the agent, got %v", keys)
+	}
+	if err := m.SaveConnection("bad", server.Addr(), "alice", "not a key", false); err == nil {
+		t.Error("expected an invalid key to be refused")
+	}
+}
+
+func TestSFTP(t *testing.T) {
+	pemKey, signer := newTestKey(t)
+	server := startTestServer(t, signer.PublicKey())
+	m := newTestManager(t, ClientConfig{})
+	m.SaveConnection("target", server.Addr(), "alice", pemKey, false)
+	ctx := context.Background()
+	local := t.TempDir()
+
+	report := filepath.Join(local, "report.txt")
+	os.WriteFile(report, []byte("findings"), 0600)
+	if n, err := m.Upload(ctx, "target", report, "uploads/"); err == nil || n != 0 {
+		t.Fatalf("expected a missing remote directory to fail, got %d %v", n, err)
+	}
+	os.Mkdir(filepath.Join(server.dir, "uploads"), 0700)
+	if n, err := m.Upload(ctx, "target", report, "uploads/"); err != nil || n != 8 {
+		t.Fatalf("Upload: %d %v", n, err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(server.dir, "uploads", "report.txt")); string(data) != "findings" {
+		t.Errorf("unexpected upload %q", data)
+	}
+
+	entries, err := m.ListDir(ctx, "target", "uploads")
+	if err != nil || len(entries) != 1 || entries[0].Name() != "report.txt" || entries[0].Size() != 8 {
+		t.Fatalf("unexpected listing %v: %v", entries, err)
+	}
+
+	downloads := filepath.Join(local, "downloads")
+	os.Mkdir(downloads, 0700)
+	if n, err := m.Download(ctx, "target", "uploads/report.txt", downloads); err != nil || n != 8 {
+		t.Fatalf("Download: %d %v", n, err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(downloads, "report.txt")); string(data) != "findings" {
+		t.Errorf("unexpected download %q", data)
+	}
+
+	// SFTP shares the connection
+	if server.conns.Load() != 1 {
+		t.Errorf("expected one connection, got %d", server.conns.Load())
+	}
+}
@@ -0,0 +1,224 @@
+package sshserver
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/crypto/ssh"
+)
+
+const forwardDialTimeout = 10 * time.Second
+
+// -------------- Port forwarding payloads (RFC 4254, section 7) --------------
+
+type directTCPIPMsg struct {
+	HostToConnect  string
+	PortToConnect  uint32
+	OriginatorIP   string
+	OriginatorPort uint32
+}
+
+type tcpipForwardMsg struct {
+	BindAddr string
+	BindPort uint32
+}
+
+type tcpipForwardReplyMsg struct {
+	BindPort uint32
+}
+
+type forwardedTCPIPMsg struct {
+	ConnectedAddr  string
+	ConnectedPort  uint32
+	OriginatorIP   string
+	OriginatorPort uint32
+}
+
+// -------------- Local forwarding (ssh -L) --------------
+
+// handleDirectTCPIP connects a "direct-tcpip" channel to the address the client asked for
+func (sm *SSHManager) handleDirectTCPIP(conn *ssh.ServerConn, newCh ssh.NewChannel) {
+	if !sm.options.AllowForwarding {
+		newCh.Reject(ssh.Prohibited, "port forwarding is disabled")
+		return
+	}
+	var msg directTCPIPMsg
+	if err := ssh.Unmarshal(newCh.ExtraData(), &msg); err != nil {
+		newCh.Reject(ssh.ConnectionFailed, "invalid direct-tcpip request")
+		return
+	}
+
+	dest := net.JoinHostPort(msg.HostToConnect, strconv.Itoa(int(msg.PortToConnect)))
+	target, err := net.DialTimeout("tcp", dest, forwardDialTimeout)
+	if err != nil {
+		sm.logger.Warn("Port forward failed", zap.String("user", conn.User()), zap.String("dest", dest), zap.Error(err))
+		newCh.Reject(ssh.ConnectionFailed, err.Error())
+		return
+	}
+	ch, reqs, err := newCh.Accept()
+	if err != nil {
+		target.Close()
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+
+	sm.logger.Info("Forwarding connection", zap.String("user", conn.User()), zap.String("dest", dest))
+	sm.track(conn, "FORWARD: -> %s", dest)
+	pipe(ch, target)
+}
+
+// -------------- Remote forwarding (ssh -R) --------------
+
+// remoteForwards are the listeners a connection asked for with "tcpip-forward"
+type remoteForwards struct {
+	sm        *SSHManager
+	conn      *ssh.ServerConn
+	mu        sync.Mutex
+	listeners map[string]net.Listener // by the requested address and bound port
+}
+
+func newRemoteForwards(sm *SSHManager, conn *ssh.ServerConn) *remoteForwards {
+	return &remoteForwards{sm: sm, conn: conn, listeners: make(map[string]net.Listener)}
+}
+
+// handleGlobalRequests answers a connection's requests that aren't for a channel
+func (sm *SSHManager) handleGlobalRequests(reqs <-chan *ssh.Request, forwards *remoteForwards) {
+	for req := range reqs {
+		switch req.Type {
+		case "tcpip-forward":
+			port, err := forwards.add(req.Payload)
+			if err != nil {
+				sm.logger.Warn("Remote forward refused", zap.String("user", forwards.conn.User()), zap.Error(err))
+				req.Reply(false, nil)
+				continue
+			}
+			req.Reply(true, ssh.Marshal(tcpipForwardReplyMsg{port}))
+		case "cancel-tcpip-forward":
+			req.Reply(forwards.cancel(req.Payload), nil)
+		default:
+			req.Reply(false, nil)
+		}
+	}
+}
+
+// add listens where the client asked, returning the port bound
+func (rf *remoteForwards) add(payload []byte) (uint32, error) {
+	if !rf.sm.options.AllowForwarding {
+		return 0, errors.New("port forwarding is disabled")
+	}
+	var msg tcpipForwardMsg
+	if err := ssh.Unmarshal(payload, &msg); err != nil {
+		return 0, fmt.Errorf("invalid tcpip-forward request: %w", err)
+	}
+
+	bind := msg.BindAddr
+	switch bind {
+	case "", "localhost":
+		bind = "127.0.0.1"
+	case "*", "0.0.0.0", "::":
+		bind = ""
+	}
+	if !rf.sm.options.GatewayPorts {
+		if ip := net.ParseIP(bind); ip == nil || !ip.IsLoopback() {
+			return 0, fmt.Errorf("listening on %q requires gateway ports", msg.BindAddr)
+		}
+	}
+
+	ln, err := net.Listen("tcp", net.JoinHostPort(bind, strconv.Itoa(int(msg.BindPort))))
+	if err != nil {
+		return 0, err
+	}
+	port := uint32(ln.Addr().(*net.TCPAddr).Port)
+	key := net.JoinHostPort(msg.BindAddr, strconv.Itoa(int(port)))
+
+	rf.mu.Lock()
+	rf.listeners[key] = ln
+	rf.mu.Unlock()
+
+	rf.sm.logger.Info("Remote forward listening", zap.String("user", rf.conn.User()), zap.String("address", ln.Addr().String()))
+	rf.sm.track(rf.conn, "REMOTE FORWARD: %s", ln.Addr())
+	go rf.accept(ln, msg.BindAddr, port)
+	return port, nil
+}
+
+// accept opens a "forwarded-tcpip" channel to the client for each connection
+func (rf *remoteForwards) accept(ln net.Listener, addr string, port uint32) {
+	for {
+		c, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			origin, _ := c.RemoteAddr().(*net.TCPAddr)
+			msg := forwardedTCPIPMsg{ConnectedAddr: addr, ConnectedPort: port}
+			if origin != nil {
+				msg.OriginatorIP, msg.OriginatorPort = origin.IP.String(), uint32(origin.Port)
+			}
+			ch, reqs, err := rf.conn.OpenChannel("forwarded-tcpip", ssh.Marshal(msg))
+			if err != nil {
+				rf.sm.logger.Warn("Client refused forwarded connection", zap.String("user", rf.conn.User()), zap.Error(err))
+				c.Close()
+				return
+			}
+			go ssh.DiscardRequests(reqs)
+			pipe(ch, c)
+		}()
+	}
+}
+
+// cancel stops a listener the client asked for
+func (rf *remoteForwards) cancel(payload []byte) bool {
+	var msg tcpipForwardMsg
+	if err := ssh.Unmarshal(payload, &msg); err != nil {
+		return false
+	}
+	key := net.JoinHostPort(msg.BindAddr, strconv.Itoa(int(msg.BindPort)))
+
+	rf.mu.Lock()
+	ln, ok := rf.listeners[key]
+	delete(rf.listeners, key)
+	rf.mu.Unlock()
+	if ok {
+		ln.Close()
+	}
+	return ok
+}
+
+// closeAll stops every listener, when the connection ends
+func (rf *remoteForwards) closeAll() {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	for key, ln := range rf.listeners {
+		ln.Close()
+		delete(rf.listeners, key)
+	}
+}
+
+// pipe copies between a channel and a connection until both sides are done
+func pipe(ch ssh.Channel, c net.Conn) {
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		io.Copy(c, ch)
+		if tc, ok := c.(*net.TCPConn); ok {
+			tc.CloseWrite()
+		} else {
+			c.Close()
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		io.Copy(ch, c)
+		ch.CloseWrite()
+	}()
+	wg.Wait()
+	ch.Close()
+	c.Close()
+}
@@ -0,0 +1,143 @@
+package sshserver
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// castHeader is the first line of an asciicast v2 recording
+type castHeader struct {
+	Version   int               `json:"version"`
+	Width     int               `json:"width"`
+	Height    int               `json:"height"`
+	Timestamp int64             `json:"timestamp"`
+	Title     string            `json:"title,omitempty"`
+	Env       map[string]string `json:"env,omitempty"`
+}
+
+// castRecorder writes a session as an asciicast v2 recording: a header line,
+// then one [seconds, type, data] line per output ("o"), input ("i") or
+// resize ("r") event. asciinema can play it back.
+type castRecorder struct {
+	mu    sync.Mutex
+	file  *os.File
+	buf   *bufio.Writer
+	path  string
+	start time.Time
+	err   error
+}
+
+// newCastRecorder starts a recording in dir, named after the time, user and session number
+func newCastRecorder(dir, user string, session int, header castHeader) (*castRecorder, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create recording directory: %w", err)
+	}
+	start := time.Now()
+	name := fmt.Sprintf("%s_%s_%d.cast", start.Format("20060102_150405"), safeFileName(user), session)
+	path := filepath.Join(dir, name)
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create recording: %w", err)
+	}
+	r := &castRecorder{file: file, buf: bufio.NewWriter(file), path: path, start: start}
+
+	header.Version = 2
+	header.Timestamp = start.Unix()
+	line, err := json.Marshal(header)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to encode recording header: %w", err)
+	}
+	r.writeLine(line)
+	return r, nil
+}
+
+// Path returns where the recording is written
+func (r *castRecorder) Path() string {
+	return r.path
+}
+
+// Output records what the session sent to the client
+func (r *castRecorder) Output(p []byte) {
+	r.event("o", string(p))
+}
+
+// Input records what the client typed
+func (r *castRecorder) Input(p []byte) {
+	r.event("i", string(p))
+}
+
+// Resize records a change of terminal size
+func (r *castRecorder) Resize(cols, rows int) {
+	r.event("r", fmt.Sprintf("%dx%d", cols, rows))
+}
+
+// Close finishes the recording, returning the first error writing it
+func (r *castRecorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file == nil {
+		return r.err
+	}
+	if err := r.buf.Flush(); err != nil && r.err == nil {
+		r.err = err
+	}
+	if err := r.file.Close(); err != nil && r.err == nil {
+		r.err = err
+	}
+	r.file = nil
+	return r.err
+}
+
+func (r *castRecorder) event(kind, data string) {
+	elapsed := math.Round(time.Since(r.start).Seconds()*1e6) / 1e6
+	line, err := json.Marshal([]interface{}{elapsed, kind, data})
+	if err != nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.writeLine(line)
+}
+
+func (r *castRecorder) writeLine(line []byte) {
+	if r.file == nil || r.err != nil {
+		return
+	}
+	if _, err := r.buf.Write(append(line, '\n')); err != nil {
+		r.err = err
+	}
+}
+
+// castInput records what it is written as input
+type castInput struct {
+	r *castRecorder
+}
+
+func (ci castInput) Write(p []byte) (int, error) {
+	ci.r.Input(p)
+	return len(p), nil
+}
+
+// safeFileName keeps letters, digits, dots, dashes and underscores
+func safeFileName(s string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '-', r == '_':
+			return r
+		}
+		return '_'
+	}, s)
+	if strings.Trim(name, ".") == "" {
+		return "_"
+	}
+	return name
+}
@@ -0,0 +1,327 @@
+package sshserver
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"go.uber.org/zap"
+	"golang.org/x/crypto/ssh"
+)
+
+// AuthorizedKeys looks up the OpenSSH public keys, as authorized_keys lines,
+// a user may log in with. *ghostauth.GhostAuth implements it.
+type AuthorizedKeys interface {
+	SSHAuthorizedKeys(username string) []string
+}
+
+// CommandShell runs the GhostShell commands typed into sessions, with the
+// logged-in user's permissions. *ghostcommand.RemoteShell implements it.
+type CommandShell interface {
+	Commands(username string) []string
+	Execute(username, command string, parameters []string) (string, error)
+}
+
+// Counter counts events such as failed logins. A metrics counter
+// implements it.
+type Counter interface {
+	Increment(delta float64)
+}
+
+// ServerOptions configures what the SSH server lets users do.
+type ServerOptions struct {
+	HostKey         ssh.Signer     // if nil, an ed25519 key is generated that lasts until exit
+	AuthFailures    Counter        // counts failed handshakes; optional
+	AuthorizedKeys  AuthorizedKeys // whose keys may log in; nobody if nil
+	Shell           CommandShell   // runs shell and exec commands
+	RecordDir       string         // sessions are recorded here as asciicast; "" disables recording
+	RecordInput     bool           // also record what users type, passwords included
+	AllowForwarding bool           // allow direct-tcpip and tcpip-forward; off unless set
+	GatewayPorts    bool           // let remote forwards listen on non-loopback addresses
+}
+
+type SSHManager struct {
+	serverConfig *ssh.ServerConfig
+	address      string
+	options      ServerOptions
+	listener     net.Listener
+	connections  []string // track remote addresses
+	commands     []string // track executed commands
+	active       map[*ssh.ServerConn]struct{}
+	sessions     int // sessions opened, numbering recordings
+	mu           sync.Mutex
+	logger       *zap.Logger
+	// concurrency
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewSSHManager sets up a post-quantum SSH server config
+func NewSSHManager(address string, options ServerOptions, logger *zap.Logger) (*SSHManager, error) {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	sm := &SSHManager{
+		address:     address,
+		options:     options,
+		connections: []string{},
+		commands:    []string{},
+		active:      make(map[*ssh.ServerConn]struct{}),
+		logger:      logger,
+		ctx:         ctx,
+		cancel:      cancel,
+	}
+
+	if err := sm.setupServerConfig(); err != nil {
+		cancel()
+		return nil, err
+	}
+	return sm, nil
+}
+
+// setupServerConfig configures SSH with the host key from the options
+func (sm *SSHManager) setupServerConfig() error {
+	signer := sm.options.HostKey
+	if signer == nil {
+		// clients will see a different host key after every restart
+		var err error
+		signer, err = generateHostKey()
+		if err != nil {
+			sm.logger.Error("Failed to generate host key", zap.Error(err))
+			return err
+		}
+		sm.logger.Warn("No host key configured, using a temporary one",
+			zap.String("fingerprint", ssh.FingerprintSHA256(signer.PublicKey())))
+	}
+
+	// build server config; users log in with the SSH keys ghostauth holds for them
+	sm.serverConfig = &ssh.ServerConfig{
+		PublicKeyCallback: sm.checkPublicKey,
+	}
+	sm.serverConfig.AddHostKey(signer)
+
+	// Example post-quantum KEX + ciphers (some are hypothetical or require custom patch sets)
+	sm.serverConfig.Config.KeyExchanges = []string{
+		"oqs-kyber-512-sha3-256", // example, not a standard upstream
+		"curve25519-sha256",      // fallback
+	}
+	sm.serverConfig.Config.Ciphers = []string{
+		"aes256-gcm@openssh.com",
+		"chacha20-poly1305@openssh.com",
+	}
+
+	return nil
+}
+
+// generateHostKey creates an ed25519 host key
+func generateHostKey() (ssh.Signer, error) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate host key: %w", err)
+	}
+	return ssh.NewSignerFromKey(key)
+}
+
+// LoadOrCreateHostKey reads the OpenSSH private key at path, generating an
+// ed25519 key there first if the file doesn't exist.
+func LoadOrCreateHostKey(path string) (ssh.Signer, error) {
+	data, err := os.ReadFile(path)
+	if err == nil {
+		signer, err := ssh.ParsePrivateKey(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse host key %s: %w", path, err)
+		}
+		return signer, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read host key: %w", err)
+	}
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate host key: %w", err)
+	}
+	block, err := ssh.MarshalPrivateKey(key, "ghostshell host key")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode host key: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create host key directory: %w", err)
+	}
+	if err := os.WriteFile(path, pem.EncodeToMemory(block), 0600); err != nil {
+		return nil, fmt.Errorf("failed to write host key: %w", err)
+	}
+	return ssh.NewSignerFromKey(key)
+}
+
+// checkPublicKey accepts a key if it is one of the user's authorized keys
+func (sm *SSHManager) checkPublicKey(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+	if sm.options.AuthorizedKeys != nil {
+		for _, line := range sm.options.AuthorizedKeys.SSHAuthorizedKeys(conn.User()) {
+			authorized, _, _, _, err := ssh.ParseAuthorizedKey([]byte(line))
+			if err != nil {
+				sm.logger.Warn("Ignoring invalid authorized key", zap.String("user", conn.User()), zap.Error(err))
+				continue
+			}
+			if bytes.Equal(authorized.Marshal(), key.Marshal()) {
+				return &ssh.Permissions{
+					Extensions: map[string]string{"pubkey-fp": ssh.FingerprintSHA256(key)},
+				}, nil
+			}
+		}
+	}
+	sm.logger.Warn("Rejected SSH public key",
+		zap.String("user", conn.User()),
+		zap.String("remote", conn.RemoteAddr().String()),
+		zap.String("fingerprint", ssh.FingerprintSHA256(key)))
+	return nil, fmt.Errorf("unknown public key for %s", conn.User())
+}
+
+// Start runs a goroutine that listens for inbound SSH connections
+func (sm *SSHManager) Start() error {
+	ln, err := net.Listen("tcp", sm.address)
+	if err != nil {
+		sm.logger.Error("Failed to listen on address", zap.String("address", sm.address), zap.Error(err))
+		return err
+	}
+	sm.logger.Info("SSH server listening", zap.String("address", ln.Addr().String()))
+
+	sm.mu.Lock()
+	sm.listener = ln
+	sm.mu.Unlock()
+
+	sm.wg.Add(1)
+	go sm.acceptLoop(ln)
+	return nil
+}
+
+// Addr returns the address the server is listening on, once started
+func (sm *SSHManager) Addr() net.Addr {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	if sm.listener == nil {
+		return nil
+	}
+	return sm.listener.Addr()
+}
+
+// acceptLoop handles incoming connections until context is canceled
+func (sm *SSHManager) acceptLoop(ln net.Listener) {
+	defer sm.wg.Done()
+
+	// closing the listener unblocks Accept
+	go func() {
+		<-sm.ctx.Done()
+		ln.Close()
+	}()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if sm.ctx.Err() != nil || errors.Is(err, net.ErrClosed) {
+				sm.logger.Info("Stop accepting new SSH connections (context canceled)")
+				return
+			}
+			sm.logger.Warn("Accept error", zap.Error(err))
+			continue
+		}
+		sm.wg.Add(1)
+		go sm.handleConnection(conn)
+	}
+}
+
+// handleConnection performs the SSH handshake & channel management
+func (sm *SSHManager) handleConnection(conn net.Conn) {
+	defer sm.wg.Done()
+	defer conn.Close()
+
+	sshConn, channels, requests, err := ssh.NewServerConn(conn, sm.serverConfig)
+	if err != nil {
+		sm.logger.Warn("SSH handshake failed", zap.Error(err))
+		if sm.options.AuthFailures != nil {
+			sm.options.AuthFailures.Increment(1.0)
+		}
+		return
+	}
+
+	remote := sshConn.RemoteAddr().String()
+	sm.logger.Info("SSH connection established",
+		zap.String("remote", remote),
+		zap.String("user", sshConn.User()),
+		zap.String("key", sshConn.Permissions.Extensions["pubkey-fp"]))
+
+	// track connection
+	sm.mu.Lock()
+	sm.connections = append(sm.connections, fmt.Sprintf("%s@%s", sshConn.User(), remote))
+	sm.active[sshConn] = struct{}{}
+	sm.mu.Unlock()
+	defer func() {
+		sm.mu.Lock()
+		delete(sm.active, sshConn)
+		sm.mu.Unlock()
+	}()
+
+	forwards := newRemoteForwards(sm, sshConn)
+	defer forwards.closeAll()
+	go sm.handleGlobalRequests(requests, forwards)
+
+	for newCh := range channels {
+		switch newCh.ChannelType() {
+		case "session":
+			ch, reqs, err := newCh.Accept()
+			if err != nil {
+				sm.logger.Warn("Channel accept error", zap.Error(err))
+				continue
+			}
+			sm.wg.Add(1)
+			go func() {
+				defer sm.wg.Done()
+				sm.handleSession(sshConn, ch, reqs)
+			}()
+		case "direct-tcpip":
+			sm.wg.Add(1)
+			go func(newCh ssh.NewChannel) {
+				defer sm.wg.Done()
+				sm.handleDirectTCPIP(sshConn, newCh)
+			}(newCh)
+		default:
+			newCh.Reject(ssh.UnknownChannelType, "unsupported channel type")
+		}
+	}
+}
+
+// track records a line for the connection & command report
+func (sm *SSHManager) track(conn *ssh.ServerConn, format string, args ...interface{}) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	sm.commands = append(sm.commands, fmt.Sprintf("Remote: %s, User: %s, ", conn.RemoteAddr(), conn.User())+fmt.Sprintf(format, args...))
+}
+
+// Stop signals the SSH manager to shut down, closing open connections
+func (sm *SSHManager) Stop() {
+	sm.cancel()
+	sm.mu.Lock()
+	for conn := range sm.active {
+		conn.Close()
+	}
+	sm.mu.Unlock()
+	sm.wg.Wait()
+}
+
+// History returns the connections made and the commands and forwards run
+// since the server started, for the connection & command report
+func (sm *SSHManager) History() (connections, commands []string) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	return append([]string{}, sm.connections...), append([]string{}, sm.commands...)
+}
@@ -0,0 +1,467 @@
+package sshserver
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"go.uber.org/zap"
+	"golang.org/x/crypto/ssh"
+)
+
+const shellPrompt = "ghostshell> "
+
+// -------------- SSH request payloads (RFC 4254) --------------
+
+type ptyRequestMsg struct {
+	Term    string
+	Columns uint32
+	Rows    uint32
+	Width   uint32
+	Height  uint32
+	Modes   string
+}
+
+type windowChangeMsg struct {
+	Columns uint32
+	Rows    uint32
+	Width   uint32
+	Height  uint32
+}
+
+type envRequestMsg struct {
+	Name  string
+	Value string
+}
+
+type execRequestMsg struct {
+	Command string
+}
+
+type exitStatusMsg struct {
+	Status uint32
+}
+
+// -------------- Sessions --------------
+
+// session is one "session" channel: a shell or a single command, with an
+// optional pseudo-terminal
+type session struct {
+	sm   *SSHManager
+	conn *ssh.ServerConn
+	ch   ssh.Channel
+	user string
+
+	mu       sync.Mutex
+	pty      bool
+	term     string
+	cols     int
+	rows     int
+	env      map[string]string
+	recorder *castRecorder
+}
+
+// handleSession answers a session's requests until its channel closes
+func (sm *SSHManager) handleSession(conn *ssh.ServerConn, ch ssh.Channel, reqs <-chan *ssh.Request) {
+	defer ch.Close()
+
+	s := &session{
+		sm:   sm,
+		conn: conn,
+		ch:   ch,
+		user: conn.User(),
+		cols: 80,
+		rows: 24,
+		env:  make(map[string]string),
+	}
+
+	var done chan struct{}
+	run := func(req *ssh.Request, fn func() uint32) {
+		if done != nil {
+			req.Reply(false, nil) // one shell or command per session
+			return
+		}
+		done = make(chan struct{})
+		req.Reply(true, nil)
+		go func() {
+			defer close(done)
+			s.exit(fn())
+		}()
+	}
+
+	for req := range reqs {
+		switch req.Type {
+		case "pty-req":
+			var msg ptyRequestMsg
+			if err := ssh.Unmarshal(req.Payload, &msg); err != nil {
+				req.Reply(false, nil)
+				continue
+			}
+			s.mu.Lock()
+			s.pty, s.term = true, msg.Term
+			s.mu.Unlock()
+			s.resize(int(msg.Columns), int(msg.Rows))
+			req.Reply(true, nil)
+		case "window-change":
+			var msg windowChangeMsg
+			if err := ssh.Unmarshal(req.Payload, &msg); err != nil {
+				req.Reply(false, nil)
+				continue
+			}
+			s.resize(int(msg.Columns), int(msg.Rows))
+			req.Reply(true, nil)
+		case "env":
+			var msg envRequestMsg
+			if err := ssh.Unmarshal(req.Payload, &msg); err != nil {
+				req.Reply(false, nil)
+				continue
+			}
+			s.mu.Lock()
+			s.env[msg.Name] = msg.Value
+			s.mu.Unlock()
+			req.Reply(true, nil)
+		case "shell":
+			run(req, s.runShell)
+		case "exec":
+			var msg execRequestMsg
+			if err := ssh.Unmarshal(req.Payload, &msg); err != nil {
+				req.Reply(false, nil)
+				continue
+			}
+			run(req, func() uint32 { return s.runExec(msg.Command) })
+		default:
+			req.Reply(false, nil)
+		}
+	}
+
+	if done != nil {
+		<-done
+	}
+}
+
+// resize sets the terminal size, ignoring nonsense sizes
+func (s *session) resize(cols, rows int) {
+	if cols <= 0 || rows <= 0 {
+		return
+	}
+	s.mu.Lock()
+	s.cols, s.rows = cols, rows
+	recorder := s.recorder
+	s.mu.Unlock()
+	if recorder != nil {
+		recorder.Resize(cols, rows)
+	}
+}
+
+// startRecording opens the session's asciicast recording, if recording is on
+func (s *session) startRecording(title string) {
+	if s.sm.options.RecordDir == "" {
+		return
+	}
+	s.sm.mu.Lock()
+	s.sm.sessions++
+	n := s.sm.sessions
+	s.sm.mu.Unlock()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	env := map[string]string{"SHELL": "ghostshell"}
+	if s.term != "" {
+		env["TERM"] = s.term
+	}
+	recorder, err := newCastRecorder(s.sm.options.RecordDir, s.user, n, castHeader{
+		Width:  s.cols,
+		Height: s.rows,
+		Title:  fmt.Sprintf("%s@%s: %s", s.user, s.conn.RemoteAddr(), title),
+		Env:    env,
+	})
+	if err != nil {
+		s.sm.logger.Error("Failed to start session recording", zap.String("user", s.user), zap.Error(err))
+		return
+	}
+	s.recorder = recorder
+	s.sm.logger.Info("Recording SSH session", zap.String("user", s.user), zap.String("path", recorder.Path()))
+}
+
+// Write sends output to the client and the recording. On a terminal, line
+// feeds become CR LF.
+func (s *session) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	pty, recorder := s.pty, s.recorder
+	s.mu.Unlock()
+
+	out := p
+	if pty {
+		out = bytes.ReplaceAll(bytes.ReplaceAll(p, []byte("\r\n"), []byte("\n")), []byte("\n"), []byte("\r\n"))
+	}
+	if recorder != nil {
+		recorder.Output(out)
+	}
+	if _, err := s.ch.Write(out); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// input returns what the client sends, copied to the recording if input is recorded
+func (s *session) input() io.Reader {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.recorder != nil && s.sm.options.RecordInput {
+		return io.TeeReader(s.ch, castInput{s.recorder})
+	}
+	return s.ch
+}
+
+// exit reports the exit status and closes the session
+func (s *session) exit(status uint32) {
+	s.ch.SendRequest("exit-status", false, ssh.Marshal(exitStatusMsg{status}))
+	s.mu.Lock()
+	recorder := s.recorder
+	s.recorder = nil
+	s.mu.Unlock()
+	if recorder != nil {
+		if err := recorder.Close(); err != nil {
+			s.sm.logger.Error("Failed to close session recording", zap.String("path", recorder.Path()), zap.Error(err))
+		}
+	}
+	s.ch.Close()
+}
+
+// runShell runs the interactive GhostShell command shell until the user logs out
+func (s *session) runShell() uint32 {
+	s.startRecording("shell")
+	s.sm.track(s.conn, "SHELL")
+
+	s.mu.Lock()
+	pty := s.pty
+	s.mu.Unlock()
+
+	editor := newLineEditor(s.input(), s, pty)
+	if pty {
+		fmt.Fprintf(s, "Welcome to GhostShell, %s. Type 'help' for commands.\n", s.user)
+	}
+	status := uint32(0)
+	for {
+		line, err := editor.ReadLine()
+		if err != nil {
+			if pty && errors.Is(err, io.EOF) {
+				fmt.Fprint(s, "logout\n")
+			}
+			return status
+		}
+		args, err := splitCommandLine(line)
+		if err != nil {
+			fmt.Fprintf(s, "error: %v\n", err)
+			continue
+		}
+		if len(args) == 0 {
+			continue
+		}
+
+		switch args[0] {
+		case "exit", "logout":
+			return status
+		case "help":
+			s.help()
+		case "clear":
+			fmt.Fprint(s, "\x1b[H\x1b[2J")
+		default:
+			status = s.runCommand(args)
+		}
+	}
+}
+
+// runExec runs a single command line, as in `ssh host scan 10.0.0.5`
+func (s *session) runExec(command string) uint32 {
+	s.startRecording(command)
+	args, err := splitCommandLine(command)
+	if err != nil {
+		fmt.Fprintf(s.ch.Stderr(), "error: %v\n", err)
+		return 2
+	}
+	if len(args) == 0 {
+		fmt.Fprint(s.ch.Stderr(), "error: no command given\n")
+		return 2
+	}
+	return s.runCommand(args)
+}
+
+// runCommand runs a command through the command shell, returning its exit status
+func (s *session) runCommand(args []string) uint32 {
+	s.sm.logger.Info("Executing command", zap.String("command", args[0]), zap.Strings("parameters", args[1:]),
+		zap.String("user", s.user), zap.String("remote", s.conn.RemoteAddr().String()))
+	s.sm.track(s.conn, "CMD: %s", strings.Join(args, " "))
+
+	shell := s.sm.options.Shell
+	if shell == nil {
+		fmt.Fprint(s, "error: no command shell is configured\n")
+		return 1
+	}
+	output, err := shell.Execute(s.user, args[0], args[1:])
+	if output != "" {
+		if !strings.HasSuffix(output, "\n") {
+			output += "\n"
+		}
+		fmt.Fprint(s, output)
+	}
+	if err != nil {
+		fmt.Fprintf(s, "error: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+func (s *session) help() {
+	fmt.Fprint(s, "Built-in commands:\n  help  clear  exit\n")
+	if s.sm.options.Shell == nil {
+		return
+	}
+	if commands := s.sm.options.Shell.Commands(s.user); len(commands) > 0 {
+		fmt.Fprintf(s, "GhostShell commands:\n  %s\n", strings.Join(commands, "\n  "))
+	}
+}
+
+// splitCommandLine splits a line into words, honouring single and double
+// quotes and backslash escapes
+func splitCommandLine(line string) ([]string, error) {
+	var args []string
+	var word strings.Builder
+	inWord := false
+	var quote rune
+	escaped := false
+
+	for _, r := range line {
+		switch {
+		case escaped:
+			word.WriteRune(r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped, inWord = true, true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '"' || r == '\'':
+			quote, inWord = r, true
+		case r == ' ' || r == '\t':
+			if inWord {
+				args = append(args, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	if quote != 0 {
+		return nil, errors.New("unterminated quote")
+	}
+	if escaped {
+		return nil, errors.New("trailing backslash")
+	}
+	if inWord {
+		args = append(args, word.String())
+	}
+	return args, nil
+}
+
+// -------------- Line editing --------------
+
+// lineEditor reads lines typed at a terminal, echoing them and handling
+// backspace, Ctrl-C, Ctrl-U, Ctrl-D and history on the arrow keys. Without a
+// terminal it reads plain lines.
+type lineEditor struct {
+	r       *bufio.Reader
+	w       io.Writer
+	echo    bool
+	history []string
+}
+
+func newLineEditor(r io.Reader, w io.Writer, echo bool) *lineEditor {
+	return &lineEditor{r: bufio.NewReader(r), w: w, echo: echo}
+}
+
+func (le *lineEditor) write(s string) {
+	if le.echo {
+		io.WriteString(le.w, s)
+	}
+}
+
+// ReadLine returns the next line, or io.EOF when the user logs out
+func (le *lineEditor) ReadLine() (string, error) {
+	le.write(shellPrompt)
+	var line []rune
+	pos := len(le.history)
+	redraw := func() {
+		le.write("\r\x1b[K" + shellPrompt + string(line))
+	}
+
+	for {
+		r, _, err := le.r.ReadRune()
+		if err != nil {
+			if errors.Is(err, io.EOF) && len(line) > 0 && !le.echo {
+				return string(line), nil
+			}
+			return "", err
+		}
+
+		switch r {
+		case '\r', '\n':
+			le.write("\n")
+			if le.echo && len(line) > 0 {
+				le.history = append(le.history, string(line))
+			}
+			return string(line), nil
+		case 0x03: // Ctrl-C
+			le.write("^C\n" + shellPrompt)
+			line = nil
+			pos = len(le.history)
+		case 0x04: // Ctrl-D
+			if len(line) == 0 {
+				return "", io.EOF
+			}
+		case 0x15: // Ctrl-U
+			line = nil
+			redraw()
+		case 0x7f, 0x08: // backspace
+			if len(line) > 0 {
+				line = line[:len(line)-1]
+				le.write("\b \b")
+			}
+		case 0x1b: // escape sequence; only the arrow keys are understood
+			if b, err := le.r.ReadByte(); err != nil || (b != '[' && b != 'O') {
+				continue
+			}
+			switch b, _ := le.r.ReadByte(); b {
+			case 'A':
+				if pos > 0 {
+					pos--
+					line = []rune(le.history[pos])
+					redraw()
+				}
+			case 'B':
+				if pos < len(le.history) {
+					pos++
+					line = nil
+					if pos < len(le.history) {
+						line = []rune(le.history[pos])
+					}
+					redraw()
+				}
+			}
+		default:
+			if r >= 0x20 {
+				line = append(line, r)
+				le.write(string(r))
+			}
+		}
+	}
+}
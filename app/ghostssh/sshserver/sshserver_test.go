@@ -0,0 +1,403 @@
+package sshserver
+
+import (
+	"bufio"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/crypto/ssh"
+)
+
+type testKeys map[string][]string
+
+func (k testKeys) SSHAuthorizedKeys(username string) []string {
+	return k[username]
+}
+
+// testShell echoes its arguments and fails the "fail" command
+type testShell struct {
+	mu   sync.Mutex
+	runs []string
+}
+
+func (ts *testShell) Commands(username string) []string {
+	return []string{"echo", "fail"}
+}
+
+func (ts *testShell) Execute(username, command string, parameters []string) (string, error) {
+	ts.mu.Lock()
+	ts.runs = append(ts.runs, username+": "+command+" "+strings.Join(parameters, "|"))
+	ts.mu.Unlock()
+	switch command {
+	case "echo":
+		return strings.Join(parameters, " "), nil
+	case "fail":
+		return "", errors.New("command fail failed")
+	default:
+		return "", fmt.Errorf("command not found: %s", command)
+	}
+}
+
+func newTestSigner(t *testing.T) ssh.Signer {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer
+}
+
+// startTestServer starts a server on a loopback port that lets alice log in
+// with the returned key
+func startTestServer(t *testing.T, options ServerOptions) (*SSHManager, ssh.Signer) {
+	t.Helper()
+	userKey := newTestSigner(t)
+	options.HostKey = newTestSigner(t)
+	if options.AuthorizedKeys == nil {
+		options.AuthorizedKeys = testKeys{"alice": {string(ssh.MarshalAuthorizedKey(userKey.PublicKey()))}}
+	}
+	sm, err := NewSSHManager("127.0.0.1:0", options, zap.NewNop())
+	if err != nil {
+		t.Fatalf("NewSSHManager: %v", err)
+	}
+	if err := sm.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	t.Cleanup(sm.Stop)
+	return sm, userKey
+}
+
+func dialTestServer(sm *SSHManager, user string, key ssh.Signer) (*ssh.Client, error) {
+	return ssh.Dial("tcp", sm.Addr().String(), &ssh.ClientConfig{
+		User:            user,
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(key)},
+		HostKeyCallback: ssh.FixedHostKey(sm.options.HostKey.PublicKey()),
+		Timeout:         5 * time.Second,
+	})
+}
+
+// testCounter counts increments
+type testCounter struct {
+	mu    sync.Mutex
+	total float64
+}
+
+func (c *testCounter) Increment(delta float64) {
+	c.mu.Lock()
+	c.total += delta
+	c.mu.Unlock()
+}
+
+func (c *testCounter) value() float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.total
+}
+
+func TestPublicKeyAuth(t *testing.T) {
+	failures := &testCounter{}
+	sm, key := startTestServer(t, ServerOptions{AuthFailures: failures})
+
+	client, err := dialTestServer(sm, "alice", key)
+	if err != nil {
+		t.Fatalf("expected alice's key to be accepted: %v", err)
+	}
+	client.Close()
+
+	if _, err := dialTestServer(sm, "alice", newTestSigner(t)); err == nil {
+		t.Error("expected another key to be rejected")
+	}
+	if _, err := dialTestServer(sm, "bob", key); err == nil {
+		t.Error("expected alice's key to be rejected for bob")
+	}
+
+	// The server counts a failure once it has closed the connection
+	deadline := time.Now().Add(5 * time.Second)
+	for failures.value() < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := failures.value(); got != 2 {
+		t.Errorf("expected 2 authentication failures, got %v", got)
+	}
+}
+
+func TestHostKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys", "ssh_host_ed25519_key")
+	created, err := LoadOrCreateHostKey(path)
+	if err != nil {
+		t.Fatalf("LoadOrCreateHostKey: %v", err)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+		t.Fatalf("expected the key to be written 0600: %v", err)
+	}
+	loaded, err := LoadOrCreateHostKey(path)
+	if err != nil {
+		t.Fatalf("LoadOrCreateHostKey: %v", err)
+	}
+	if ssh.FingerprintSHA256(loaded.PublicKey()) != ssh.FingerprintSHA256(created.PublicKey()) {
+		t.Error("expected the saved key to be loaded again")
+	}
+	if created.PublicKey().Type() != ssh.KeyAlgoED25519 {
+		t.Errorf("expected an ed25519 key, got %s", created.PublicKey().Type())
+	}
+
+	// Without a host key the server still starts, with a temporary one
+	sm, err := NewSSHManager("127.0.0.1:0", ServerOptions{}, zap.NewNop())
+	if err != nil {
+		t.Fatalf("NewSSHManager without a host key: %v", err)
+	}
+	sm.Stop()
+}
+
+func TestInteractiveShell(t *testing.T) {
+	shell := &testShell{}
+	dir := t.TempDir()
+	sm, key := startTestServer(t, ServerOptions{Shell: shell, RecordDir: dir})
+
+	client, err := dialTestServer(sm, "alice", key)
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	defer client.Close()
+	session, err := client.NewSession()
+	if err != nil {
+		t.Fatalf("NewSession: %v", err)
+	}
+	if err := session.RequestPty("xterm-256color", 24, 80, ssh.TerminalModes{ssh.ECHO: 1}); err != nil {
+		t.Fatalf("RequestPty: %v", err)
+	}
+	stdin, _ := session.StdinPipe()
+	stdout, _ := session.StdoutPipe()
+	out := &syncBuffer{}
+	go io.Copy(out, stdout)
+	if err := session.Shell(); err != nil {
+		t.Fatalf("Shell: %v", err)
+	}
+
+	out.waitFor(t, shellPrompt)
+	// A typo corrected with backspace, then a quoted argument
+	io.WriteString(stdin, "echi\x7fo \"hello world\" again\r")
+	out.waitFor(t, "hello world again\r\n")
+
+	session.WindowChange(40, 100)
+	io.WriteString(stdin, "fail\r")
+	out.waitFor(t, "error: command fail failed")
+	// Up arrow twice recalls the echo
+	io.WriteString(stdin, "\x1b[A\x1b[A\r")
+	out.waitFor(t, shellPrompt+"echo \"hello world\" again\r\nhello world again\r\n")
+	io.WriteString(stdin, "exit\r")
+
+	if err := session.Wait(); err != nil {
+		t.Errorf("expected the shell to exit cleanly, got %v", err)
+	}
+	if !strings.Contains(out.String(), "Welcome to GhostShell, alice.") {
+		t.Errorf("expected a banner, got %q", out.String())
+	}
+	if len(shell.runs) != 3 || shell.runs[0] != "alice: echo hello world|again" {
+		t.Errorf("unexpected commands %q", shell.runs)
+	}
+
+	// The session was recorded as asciicast
+	files, _ := filepath.Glob(filepath.Join(dir, "*_alice_*.cast"))
+	if len(files) != 1 {
+		t.Fatalf("expected one recording, got %v", files)
+	}
+	f, _ := os.Open(files[0])
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	scanner.Scan()
+	var header castHeader
+	if err := json.Unmarshal(scanner.Bytes(), &header); err != nil {
+		t.Fatalf("header: %v", err)
+	}
+	if header.Version != 2 || header.Width != 80 || header.Height != 24 || header.Env["TERM"] != "xterm-256color" {
+		t.Errorf("unexpected header %+v", header)
+	}
+	var output strings.Builder
+	resized := false
+	for scanner.Scan() {
+		var event []interface{}
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil || len(event) != 3 {
+			t.Fatalf("bad event %s", scanner.Text())
+		}
+		switch event[1] {
+		case "o":
+			output.WriteString(event[2].(string))
+		case "r":
+			resized = event[2] == "100x40"
+		case "i":
+			t.Error("input was recorded without RecordInput")
+		}
+	}
+	if !strings.Contains(output.String(), "hello world again") || !resized {
+		t.Errorf("recording is missing output or the resize: %q", output.String())
+	}
+}
+
+func TestExec(t *testing.T) {
+	sm, key := startTestServer(t, ServerOptions{Shell: &testShell{}})
+	client, err := dialTestServer(sm, "alice", key)
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	defer client.Close()
+
+	session, _ := client.NewSession()
+	output, err := session.Output("echo 'scan complete'")
+	if err != nil || string(output) != "scan complete\n" {
+		t.Errorf("unexpected output %q: %v", output, err)
+	}
+
+	session, _ = client.NewSession()
+	var exitErr *ssh.ExitError
+	if _, err := session.Output("fail"); !errors.As(err, &exitErr) || exitErr.ExitStatus() != 1 {
+		t.Errorf("expected exit status 1, got %v", err)
+	}
+
+	session, _ = client.NewSession()
+	if err := session.Run("echo 'unterminated"); !errors.As(err, &exitErr) || exitErr.ExitStatus() != 2 {
+		t.Errorf("expected exit status 2, got %v", err)
+	}
+}
+
+func TestPortForwarding(t *testing.T) {
+	// An echo server to forward to
+	echo, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer echo.Close()
+	go serveEcho(echo)
+
+	sm, key := startTestServer(t, ServerOptions{AllowForwarding: true})
+	client, err := dialTestServer(sm, "alice", key)
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	defer client.Close()
+
+	// ssh -L: the server connects to the echo server
+	conn, err := client.Dial("tcp", echo.Addr().String())
+	if err != nil {
+		t.Fatalf("direct-tcpip: %v", err)
+	}
+	expectEcho(t, conn, "ping")
+
+	// ssh -R: the server listens and hands connections to the client
+	remote, err := client.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("tcpip-forward: %v", err)
+	}
+	go serveEcho(remote)
+	conn, err = net.Dial("tcp", remote.Addr().String())
+	if err != nil {
+		t.Fatalf("dial the remote forward: %v", err)
+	}
+	expectEcho(t, conn, "pong")
+
+	if _, err := client.Listen("tcp", "0.0.0.0:0"); err == nil {
+		t.Error("expected a non-loopback forward to need gateway ports")
+	}
+	remote.Close()
+	if _, err := net.Dial("tcp", remote.Addr().String()); err == nil {
+		t.Error("expected the cancelled forward to stop listening")
+	}
+
+	// Forwarding is off by default
+	sm, key = startTestServer(t, ServerOptions{})
+	client, err = dialTestServer(sm, "alice", key)
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	defer client.Close()
+	if _, err := client.Dial("tcp", echo.Addr().String()); err == nil {
+		t.Error("expected direct-tcpip to be refused")
+	}
+	if _, err := client.Listen("tcp", "127.0.0.1:0"); err == nil {
+		t.Error("expected tcpip-forward to be refused")
+	}
+}
+
+func TestSplitCommandLine(t *testing.T) {
+	args, err := splitCommandLine(`scan  "10.0.0.0/24" --note 'a "quoted" note' it\'s`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(args, "|"); got != `scan|10.0.0.0/24|--note|a "quoted" note|it's` {
+		t.Errorf("unexpected split %s", got)
+	}
+	if _, err := splitCommandLine(`echo "open`); err == nil {
+		t.Error("expected an unterminated quote to fail")
+	}
+}
+
+func serveEcho(ln net.Listener) {
+	for {
+		c, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			io.Copy(c, c)
+			c.Close()
+		}()
+	}
+}
+
+func expectEcho(t *testing.T, conn net.Conn, msg string) {
+	t.Helper()
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	if _, err := io.WriteString(conn, msg); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	buf := make([]byte, len(msg))
+	if _, err := io.ReadFull(conn, buf); err != nil || string(buf) != msg {
+		t.Fatalf("expected %q echoed, got %q: %v", msg, buf, err)
+	}
+}
+
+// syncBuffer collects a session's output for waitFor
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf strings.Builder
+}
+
+func (sb *syncBuffer) Write(p []byte) (int, error) {
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+	return sb.buf.Write(p)
+}
+
+func (sb *syncBuffer) String() string {
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+	return sb.buf.String()
+}
+
+func (sb *syncBuffer) waitFor(t *testing.T, s string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !strings.Contains(sb.String(), s) {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %q in %q", s, sb.String())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
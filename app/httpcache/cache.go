@@ -0,0 +1,259 @@
+package httpcache
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Mode selects how the cache treats requests
+type Mode int
+
+const (
+	// ModeOff passes every request through
+	ModeOff Mode = iota
+	// ModeCache serves fresh stored responses and stores the others
+	ModeCache
+	// ModeRecord always queries the provider and stores the response
+	ModeRecord
+	// ModeReplay serves stored responses only and never touches the network
+	ModeReplay
+)
+
+var modeNames = [...]string{"off", "cache", "record", "replay"}
+
+func (m Mode) String() string {
+	if int(m) < len(modeNames) {
+		return modeNames[m]
+	}
+	return fmt.Sprintf("Mode(%d)", int(m))
+}
+
+// ParseMode parses "off", "cache", "record" or "replay". An empty string is
+// ModeOff.
+func ParseMode(s string) (Mode, error) {
+	if s == "" {
+		return ModeOff, nil
+	}
+	for i, name := range modeNames {
+		if strings.EqualFold(s, name) {
+			return Mode(i), nil
+		}
+	}
+	return ModeOff, fmt.Errorf("unknown cache mode %q (want off, cache, record or replay)", s)
+}
+
+// ErrNotRecorded is returned in ModeReplay for requests without a stored
+// response
+var ErrNotRecorded = errors.New("no recorded response")
+
+// Config for a Cache
+type Config struct {
+	Dir        string                   // Directory holding one subdirectory per provider
+	Mode       Mode                     // How requests are served
+	DefaultTTL time.Duration            // Lifetime of responses of providers missing from TTLs
+	TTLs       map[string]time.Duration // Per-provider lifetime; negative disables caching
+	MaxBody    int64                    // Larger responses are passed through without being stored
+}
+
+// DefaultConfig keeps paid search engine answers for days and the free
+// archives for a day
+var DefaultConfig = Config{
+	Dir:        "ghostshell/cache/http",
+	Mode:       ModeOff,
+	DefaultTTL: 24 * time.Hour,
+	TTLs: map[string]time.Duration{
+		"shodan":      72 * time.Hour,
+		"censys":      72 * time.Hour,
+		"fofa":        72 * time.Hour,
+		"zoomeye":     72 * time.Hour,
+		"hunter":      72 * time.Hour,
+		"quake":       72 * time.Hour,
+		"netlas":      72 * time.Hour,
+		"criminalip":  72 * time.Hour,
+		"whoxy":       7 * 24 * time.Hour,
+		"whoisxmlapi": 7 * 24 * time.Hour,
+		"crtsh":       6 * time.Hour,
+	},
+	MaxBody: 64 << 20,
+}
+
+// ProviderStats counts how the requests of one provider were served
+type ProviderStats struct {
+	Hits   int
+	Misses int
+	Stored int
+}
+
+// Cache is an on-disk HTTP response cache shared by the source sessions.
+// Responses are keyed by provider and normalized request, with credentials
+// left out of the key so rotated API keys share entries.
+type Cache struct {
+	config Config
+	now    func() time.Time
+
+	mu    sync.Mutex
+	stats map[string]*ProviderStats
+}
+
+// New creates a Cache
+func New(config Config) (*Cache, error) {
+	if config.Mode != ModeOff {
+		if config.Dir == "" {
+			return nil, fmt.Errorf("cache directory is required in %s mode", config.Mode)
+		}
+		if err := os.MkdirAll(config.Dir, 0700); err != nil {
+			return nil, fmt.Errorf("failed to create cache directory: %w", err)
+		}
+	}
+	if config.MaxBody <= 0 {
+		config.MaxBody = DefaultConfig.MaxBody
+	}
+	return &Cache{
+		config: config,
+		now:    time.Now,
+		stats:  make(map[string]*ProviderStats),
+	}, nil
+}
+
+// Mode returns the mode of the cache
+func (c *Cache) Mode() Mode {
+	return c.config.Mode
+}
+
+// TTL returns how long responses of provider are served
+func (c *Cache) TTL(provider string) time.Duration {
+	if ttl, ok := c.config.TTLs[provider]; ok {
+		return ttl
+	}
+	return c.config.DefaultTTL
+}
+
+// Wrap routes the requests of client through the cache. A nil Cache leaves
+// the client untouched.
+func (c *Cache) Wrap(client *http.Client) {
+	if c == nil || client == nil || c.config.Mode == ModeOff {
+		return
+	}
+	client.Transport = c.Transport(client.Transport)
+}
+
+// Transport returns a RoundTripper serving requests from the cache and
+// sending the others to next (http.DefaultTransport when nil)
+func (c *Cache) Transport(next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &transport{cache: c, next: next}
+}
+
+// Stats returns the per-provider counters
+func (c *Cache) Stats() map[string]ProviderStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := make(map[string]ProviderStats, len(c.stats))
+	for provider, s := range c.stats {
+		stats[provider] = *s
+	}
+	return stats
+}
+
+// Providers returns the providers seen so far, sorted
+func (c *Cache) Providers() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	providers := make([]string, 0, len(c.stats))
+	for provider := range c.stats {
+		providers = append(providers, provider)
+	}
+	sort.Strings(providers)
+	return providers
+}
+
+func (c *Cache) count(provider string, fn func(*ProviderStats)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := c.stats[provider]
+	if s == nil {
+		s = &ProviderStats{}
+		c.stats[provider] = s
+	}
+	fn(s)
+}
+
+type transport struct {
+	cache *Cache
+	next  http.RoundTripper
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	c := t.cache
+	provider, hits := fromContext(req.Context())
+	if provider == "" {
+		provider = strings.ToLower(req.URL.Hostname())
+	}
+	mode := c.config.Mode
+	ttl := c.TTL(provider)
+	if mode == ModeOff || (ttl < 0 && mode != ModeReplay) {
+		return t.next.RoundTrip(req)
+	}
+
+	key, err := requestKey(provider, req)
+	if err != nil {
+		return nil, err
+	}
+	path := entryPath(c.config.Dir, provider, key.hash)
+
+	if mode == ModeCache || mode == ModeReplay {
+		e, err := readEntry(path)
+		if err == nil && (mode == ModeReplay || c.now().Sub(e.Stored) < ttl) {
+			c.count(provider, func(s *ProviderStats) { s.Hits++ })
+			hits.add()
+			return e.response(req), nil
+		}
+		if mode == ModeReplay {
+			c.count(provider, func(s *ProviderStats) { s.Misses++ })
+			return nil, fmt.Errorf("%s %s: %w", key.method, key.url, ErrNotRecorded)
+		}
+	}
+
+	c.count(provider, func(s *ProviderStats) { s.Misses++ })
+	resp, err := t.next.RoundTrip(req)
+	if err != nil || resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp, err
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, c.config.MaxBody+1))
+	if err != nil {
+		resp.Body.Close()
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	if int64(len(body)) > c.config.MaxBody {
+		// Too large to keep; stream the rest untouched
+		resp.Body = readCloser{io.MultiReader(bytes.NewReader(body), resp.Body), resp.Body}
+		return resp, nil
+	}
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	e := &entry{
+		Method: key.method,
+		URL:    key.url,
+		Status: resp.StatusCode,
+		Header: storedHeader(resp.Header),
+		Body:   body,
+		Stored: c.now(),
+	}
+	// A failed write only costs a future cache miss
+	if err := writeEntry(path, e); err == nil {
+		c.count(provider, func(s *ProviderStats) { s.Stored++ })
+	}
+	return resp, nil
+}
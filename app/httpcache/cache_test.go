@@ -0,0 +1,160 @@
+package httpcache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// upstream answers with the request count so tests can tell cached answers
+// from fresh ones
+func upstream(t *testing.T) (*httptest.Server, *atomic.Int64) {
+	var calls atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := calls.Add(1)
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		fmt.Fprintf(w, "call %d %s", n, body)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &calls
+}
+
+func get(t *testing.T, client *http.Client, ctx context.Context, url string) (string, error) {
+	t.Helper()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(body), nil
+}
+
+func newCache(t *testing.T, dir string, mode Mode) *Cache {
+	t.Helper()
+	config := DefaultConfig
+	config.Dir = dir
+	config.Mode = mode
+	config.TTLs = map[string]time.Duration{"engine": time.Hour, "nocache": -1}
+	cache, err := New(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cache
+}
+
+func TestCacheServesFreshEntries(t *testing.T) {
+	srv, calls := upstream(t)
+	cache := newCache(t, t.TempDir(), ModeCache)
+	now := time.Now()
+	cache.now = func() time.Time { return now }
+	client := &http.Client{}
+	cache.Wrap(client)
+
+	ctx, hits := WithProvider(context.Background(), "engine")
+	first, err := get(t, client, ctx, srv.URL+"/search?q=a&key=one")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Same query with a rotated key and reordered parameters
+	second, err := get(t, client, ctx, srv.URL+"/search?key=two&q=a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first != second || calls.Load() != 1 {
+		t.Fatalf("expected cached answer, got %q then %q after %d calls", first, second, calls.Load())
+	}
+	if hits.Count() != 1 {
+		t.Fatalf("hits = %d, want 1", hits.Count())
+	}
+
+	now = now.Add(2 * time.Hour)
+	if third, _ := get(t, client, ctx, srv.URL+"/search?q=a"); third == first {
+		t.Fatalf("expired entry served: %q", third)
+	}
+
+	stats := cache.Stats()["engine"]
+	if stats.Hits != 1 || stats.Misses != 2 || stats.Stored != 2 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
+
+func TestCacheSkipsErrorsAndDisabledProviders(t *testing.T) {
+	srv, calls := upstream(t)
+	cache := newCache(t, t.TempDir(), ModeCache)
+	client := &http.Client{}
+	cache.Wrap(client)
+
+	ctx, _ := WithProvider(context.Background(), "engine")
+	get(t, client, ctx, srv.URL+"/missing")
+	get(t, client, ctx, srv.URL+"/missing")
+
+	ctx, hits := WithProvider(context.Background(), "nocache")
+	get(t, client, ctx, srv.URL+"/search")
+	get(t, client, ctx, srv.URL+"/search")
+
+	if calls.Load() != 4 || hits.Count() != 0 {
+		t.Fatalf("calls = %d, hits = %d; want 4 and 0", calls.Load(), hits.Count())
+	}
+}
+
+func TestRecordReplay(t *testing.T) {
+	srv, calls := upstream(t)
+	dir := t.TempDir()
+
+	recorder := newCache(t, dir, ModeRecord)
+	client := &http.Client{}
+	recorder.Wrap(client)
+	ctx, _ := WithProvider(context.Background(), "engine")
+	recorded, err := get(t, client, ctx, srv.URL+"/search?q=a&key=secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	post, err := http.NewRequestWithContext(ctx, http.MethodPost, srv.URL+"/search", strings.NewReader("query"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := client.Do(post)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	srv.Close()
+
+	replayer := newCache(t, dir, ModeReplay)
+	client = &http.Client{}
+	replayer.Wrap(client)
+	replayed, err := get(t, client, ctx, srv.URL+"/search?q=a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if replayed != recorded {
+		t.Fatalf("replayed %q, recorded %q", replayed, recorded)
+	}
+
+	post, _ = http.NewRequestWithContext(ctx, http.MethodPost, srv.URL+"/search", strings.NewReader("other"))
+	if _, err := client.Do(post); !errors.Is(err, ErrNotRecorded) {
+		t.Fatalf("expected ErrNotRecorded for an unrecorded body, got %v", err)
+	}
+	if calls.Load() != 2 {
+		t.Fatalf("replay reached the network: %d calls", calls.Load())
+	}
+}
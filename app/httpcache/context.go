@@ -0,0 +1,45 @@
+package httpcache
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+type contextKey struct{}
+
+type tag struct {
+	provider string
+	hits     *Hits
+}
+
+// Hits counts the cache hits of the requests made with one context
+type Hits struct {
+	n atomic.Int64
+}
+
+// Count returns the number of hits. A nil Hits counts zero.
+func (h *Hits) Count() int {
+	if h == nil {
+		return 0
+	}
+	return int(h.n.Load())
+}
+
+func (h *Hits) add() {
+	if h != nil {
+		h.n.Add(1)
+	}
+}
+
+// WithProvider tags the requests made with ctx as queries to provider,
+// which selects their TTL and cache directory, and returns the counter of
+// their cache hits. Untagged requests use the host name as provider.
+func WithProvider(ctx context.Context, provider string) (context.Context, *Hits) {
+	hits := &Hits{}
+	return context.WithValue(ctx, contextKey{}, tag{provider: provider, hits: hits}), hits
+}
+
+func fromContext(ctx context.Context) (string, *Hits) {
+	t, _ := ctx.Value(contextKey{}).(tag)
+	return t.provider, t.hits
+}
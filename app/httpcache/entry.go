@@ -0,0 +1,149 @@
+package httpcache
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// CredentialParams are query parameters left out of cache keys and stored
+// URLs, so entries survive key rotation and fixtures hold no secrets
+var CredentialParams = []string{"key", "apikey", "api_key", "api-key", "token", "access_token", "email"}
+
+// entry is a stored response
+type entry struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"` // Normalized, without credentials
+	Status int         `json:"status"`
+	Header http.Header `json:"header"`
+	Body   []byte      `json:"body"`
+	Stored time.Time   `json:"stored"`
+}
+
+// response rebuilds the stored response for req
+func (e *entry) response(req *http.Request) *http.Response {
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", e.Status, http.StatusText(e.Status)),
+		StatusCode:    e.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        e.Header.Clone(),
+		Body:          io.NopCloser(bytes.NewReader(e.Body)),
+		ContentLength: int64(len(e.Body)),
+		Request:       req,
+	}
+}
+
+type key struct {
+	method string
+	url    string
+	hash   string
+}
+
+// requestKey normalizes req: lower-case scheme and host, sorted query
+// without credentials, no fragment, and a digest of the body. The body of
+// req is restored after reading.
+func requestKey(provider string, req *http.Request) (key, error) {
+	u := *req.URL
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = strings.ToLower(u.Host)
+	u.Fragment = ""
+	u.User = nil
+	query := u.Query()
+	for name := range query {
+		for _, credential := range CredentialParams {
+			if strings.EqualFold(name, credential) {
+				query.Del(name)
+			}
+		}
+	}
+	u.RawQuery = query.Encode()
+
+	k := key{method: strings.ToUpper(req.Method), url: u.String()}
+	if k.method == "" {
+		k.method = http.MethodGet
+	}
+
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n%s\n%s\n", provider, k.method, k.url)
+	if req.Body != nil && req.Body != http.NoBody {
+		body, err := io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return key{}, fmt.Errorf("failed to read request body: %w", err)
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+		h.Write(body)
+	}
+	k.hash = hex.EncodeToString(h.Sum(nil))
+	return k, nil
+}
+
+func entryPath(dir, provider, hash string) string {
+	return filepath.Join(dir, safeName(provider), hash+".json")
+}
+
+// safeName keeps provider names usable as directory names
+func safeName(name string) string {
+	if name == "" {
+		return "_"
+	}
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_', r == '.':
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+func readEntry(path string) (*entry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	e := &entry{}
+	if err := json.Unmarshal(data, e); err != nil {
+		return nil, fmt.Errorf("failed to parse cache entry %s: %w", path, err)
+	}
+	return e, nil
+}
+
+// writeEntry stores e through a temporary file so readers never see a
+// partial entry
+func writeEntry(path string, e *entry) error {
+	data, err := json.MarshalIndent(e, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// storedHeader drops the headers that must not be replayed
+func storedHeader(header http.Header) http.Header {
+	stored := header.Clone()
+	stored.Del("Set-Cookie")
+	stored.Del("Date")
+	return stored
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
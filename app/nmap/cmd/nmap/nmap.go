@@ -19,6 +19,8 @@ import (
 	"go.uber.org/zap/zapcore"
 	"golang.org/x/exp/rand"
 
+	scanner "ghostshell/app/nmap"
+
 	// Hypothetical quantum-safe module
 	"ghostshell/oqs_network"
 )
@@ -273,6 +275,28 @@ func generateReports(results []NmapResult) error {
 // -------------- Main & Raylib UI --------------
 
 func main() {
+	options, err := scanner.ParseInput()
+	if err != nil {
+		fmt.Printf("Input error: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Diffing and merging work on saved results and need no scan or UI
+	switch {
+	case options.DiffMode():
+		if err := scanner.RunDiff(options); err != nil {
+			fmt.Printf("Diff error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	case options.MergeMode():
+		if err := scanner.RunMerge(options); err != nil {
+			fmt.Printf("Merge error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	// Setup logger
 	if err := setupLogger(); err != nil {
 		fmt.Printf("Logger setup error: %v\n", err)
@@ -289,9 +313,8 @@ func main() {
 
 	// Create a concurrency manager
 	manager := newNmapManager(oqsNet)
-	hosts := []string{"10.0.0.1", "192.168.1.10", "some-site.org"}
 	concurrency := 3
-	manager.Start(hosts, concurrency)
+	manager.Start(options.Targets, concurrency)
 
 	// Setup Raylib
 	rl.InitWindow(ScreenWidth, ScreenHeight, "Nmap (Quantum-Safe)")
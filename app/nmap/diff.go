@@ -0,0 +1,298 @@
+package nmap
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Ullaakut/nmap/v3"
+)
+
+// Change kinds reported in a PortChange
+const (
+	ChangeOpened  = "opened"
+	ChangeClosed  = "closed"
+	ChangeState   = "state"
+	ChangeService = "service"
+)
+
+// ScanDiff describes how the attack surface changed between two scans
+type ScanDiff struct {
+	Generated   time.Time  `json:"generated"`
+	Baseline    []string   `json:"baseline"`
+	Current     []string   `json:"current"`
+	HostsAdded  []string   `json:"hosts_added"`
+	HostsGone   []string   `json:"hosts_gone"`
+	HostChanges []HostDiff `json:"host_changes"`
+}
+
+// HostDiff lists the port changes of a single host
+type HostDiff struct {
+	Address string       `json:"address"`
+	Changes []PortChange `json:"changes"`
+}
+
+// PortChange is a single port difference between the baseline and current scan
+type PortChange struct {
+	Port       int    `json:"port"`
+	Protocol   string `json:"protocol"`
+	Kind       string `json:"kind"`
+	OldState   string `json:"old_state,omitempty"`
+	NewState   string `json:"new_state,omitempty"`
+	OldService string `json:"old_service,omitempty"`
+	NewService string `json:"new_service,omitempty"`
+}
+
+// DiffRuns compares two individual runs
+func DiffRuns(baseline, current *nmap.Run) *ScanDiff {
+	return DiffInventories(MergeRuns([]*nmap.Run{baseline}, []string{"baseline"}), MergeRuns([]*nmap.Run{current}, []string{"current"}))
+}
+
+// DiffInventories compares two inventories. Hosts that are down count as absent.
+func DiffInventories(baseline, current *Inventory) *ScanDiff {
+	diff := &ScanDiff{
+		Generated: time.Now().UTC(),
+		Baseline:  baseline.Sources,
+		Current:   current.Sources,
+	}
+
+	for _, address := range current.HostAddresses() {
+		if isUp(current.Hosts[address]) && !isUp(baseline.Hosts[address]) {
+			diff.HostsAdded = append(diff.HostsAdded, address)
+		}
+	}
+	for _, address := range baseline.HostAddresses() {
+		if isUp(baseline.Hosts[address]) && !isUp(current.Hosts[address]) {
+			diff.HostsGone = append(diff.HostsGone, address)
+		}
+	}
+
+	addresses := current.HostAddresses()
+	for _, address := range baseline.HostAddresses() {
+		if _, ok := current.Hosts[address]; !ok {
+			addresses = append(addresses, address)
+		}
+	}
+	sort.Strings(addresses)
+
+	for _, address := range addresses {
+		changes := diffHost(baseline.Hosts[address], current.Hosts[address])
+		if len(changes) > 0 {
+			diff.HostChanges = append(diff.HostChanges, HostDiff{Address: address, Changes: changes})
+		}
+	}
+
+	return diff
+}
+
+// diffHost compares the ports of the same host in both scans. A missing or
+// down host contributes no ports.
+func diffHost(baseline, current *InventoryHost) []PortChange {
+	oldPorts := map[string]*InventoryPort{}
+	newPorts := map[string]*InventoryPort{}
+	var ordered []*InventoryPort
+	if isUp(baseline) {
+		oldPorts = baseline.Ports
+		ordered = append(ordered, baseline.sortedPorts()...)
+	}
+	if isUp(current) {
+		newPorts = current.Ports
+		for _, p := range current.sortedPorts() {
+			if _, ok := oldPorts[p.Key()]; !ok {
+				ordered = append(ordered, p)
+			}
+		}
+	}
+
+	var changes []PortChange
+	for _, p := range ordered {
+		oldPort, newPort := oldPorts[p.Key()], newPorts[p.Key()]
+		change := PortChange{
+			Port:       p.Port,
+			Protocol:   p.Protocol,
+			OldState:   portState(oldPort),
+			NewState:   portState(newPort),
+			OldService: oldPort.ServiceString(),
+			NewService: newPort.ServiceString(),
+		}
+
+		switch {
+		case !oldPort.IsOpen() && newPort.IsOpen():
+			change.Kind = ChangeOpened
+		case oldPort.IsOpen() && !newPort.IsOpen():
+			change.Kind = ChangeClosed
+		case oldPort != nil && newPort != nil && oldPort.State != newPort.State:
+			change.Kind = ChangeState
+		case oldPort.IsOpen() && newPort.IsOpen() && change.OldService != change.NewService:
+			change.Kind = ChangeService
+		default:
+			continue
+		}
+		changes = append(changes, change)
+	}
+	return changes
+}
+
+// Empty reports whether the two scans had no differences
+func (d *ScanDiff) Empty() bool {
+	return len(d.HostsAdded) == 0 && len(d.HostsGone) == 0 && len(d.HostChanges) == 0
+}
+
+// Count returns the number of port changes of the given kind
+func (d *ScanDiff) Count(kind string) int {
+	count := 0
+	for _, host := range d.HostChanges {
+		for _, change := range host.Changes {
+			if change.Kind == kind {
+				count++
+			}
+		}
+	}
+	return count
+}
+
+// JSON returns the indented JSON representation of the diff
+func (d *ScanDiff) JSON() ([]byte, error) {
+	return json.MarshalIndent(d, "", "  ")
+}
+
+// Markdown renders the diff as a Markdown report
+func (d *ScanDiff) Markdown() string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "# Nmap Scan Diff\n\n")
+	fmt.Fprintf(&b, "- Generated: %s\n", d.Generated.Format(time.RFC3339))
+	fmt.Fprintf(&b, "- Baseline: %s\n", strings.Join(d.Baseline, ", "))
+	fmt.Fprintf(&b, "- Current: %s\n\n", strings.Join(d.Current, ", "))
+
+	fmt.Fprintf(&b, "## Summary\n\n")
+	fmt.Fprintf(&b, "| Hosts added | Hosts gone | Ports opened | Ports closed | State changes | Service changes |\n")
+	fmt.Fprintf(&b, "|---|---|---|---|---|---|\n")
+	fmt.Fprintf(&b, "| %d | %d | %d | %d | %d | %d |\n\n",
+		len(d.HostsAdded), len(d.HostsGone),
+		d.Count(ChangeOpened), d.Count(ChangeClosed), d.Count(ChangeState), d.Count(ChangeService))
+
+	if d.Empty() {
+		b.WriteString("No changes detected.\n")
+		return b.String()
+	}
+
+	if len(d.HostsAdded) > 0 {
+		b.WriteString("## Hosts Added\n\n")
+		for _, host := range d.HostsAdded {
+			fmt.Fprintf(&b, "- %s\n", host)
+		}
+		b.WriteString("\n")
+	}
+	if len(d.HostsGone) > 0 {
+		b.WriteString("## Hosts Gone\n\n")
+		for _, host := range d.HostsGone {
+			fmt.Fprintf(&b, "- %s\n", host)
+		}
+		b.WriteString("\n")
+	}
+
+	if len(d.HostChanges) > 0 {
+		b.WriteString("## Port Changes\n")
+		for _, host := range d.HostChanges {
+			fmt.Fprintf(&b, "\n### %s\n\n", host.Address)
+			b.WriteString("| Port | Change | Before | After |\n")
+			b.WriteString("|---|---|---|---|\n")
+			for _, c := range host.Changes {
+				fmt.Fprintf(&b, "| %d/%s | %s | %s | %s |\n",
+					c.Port, c.Protocol, c.Kind,
+					markdownCell(c.OldState, c.OldService),
+					markdownCell(c.NewState, c.NewService))
+			}
+		}
+	}
+
+	return b.String()
+}
+
+// Render returns the diff in the requested format ("json" or "markdown")
+func (d *ScanDiff) Render(format string) ([]byte, error) {
+	switch strings.ToLower(format) {
+	case "", "json":
+		return d.JSON()
+	case "md", "markdown":
+		return []byte(d.Markdown()), nil
+	default:
+		return nil, fmt.Errorf("unsupported diff format: %s", format)
+	}
+}
+
+// DiffFiles loads two sets of result files, merges each set into an
+// inventory and diffs them. When filter is set only matching ports are compared.
+func DiffFiles(baselineFiles, currentFiles []string, filter *Filter) (*ScanDiff, error) {
+	baseline, err := LoadInventory(baselineFiles...)
+	if err != nil {
+		return nil, err
+	}
+	current, err := LoadInventory(currentFiles...)
+	if err != nil {
+		return nil, err
+	}
+	return DiffInventories(baseline.Filtered(filter), current.Filtered(filter)), nil
+}
+
+// RunDiff diffs the baseline and current result files from the options and
+// writes the report in the requested format
+func RunDiff(options *Options) error {
+	filter, err := options.ResultFilter()
+	if err != nil {
+		return err
+	}
+
+	diff, err := DiffFiles(options.Baseline, options.Current, filter)
+	if err != nil {
+		return err
+	}
+
+	data, err := diff.Render(options.Format)
+	if err != nil {
+		return err
+	}
+	return writeResults(data, options.OutputFile)
+}
+
+// RunMerge merges the result files from the options and writes the inventory as JSON
+func RunMerge(options *Options) error {
+	filter, err := options.ResultFilter()
+	if err != nil {
+		return err
+	}
+
+	inv, err := LoadInventory(options.Merge...)
+	if err != nil {
+		return err
+	}
+	inv = inv.Filtered(filter)
+
+	data, err := inv.JSON()
+	if err != nil {
+		return fmt.Errorf("failed to marshal inventory: %w", err)
+	}
+	return writeResults(data, options.OutputFile)
+}
+
+func isUp(host *InventoryHost) bool {
+	return host != nil && host.State != "down"
+}
+
+func portState(p *InventoryPort) string {
+	if p == nil {
+		return "absent"
+	}
+	return p.State
+}
+
+func markdownCell(state, service string) string {
+	cell := state
+	if service != "" {
+		cell += " (" + service + ")"
+	}
+	return strings.ReplaceAll(cell, "|", `\|`)
+}
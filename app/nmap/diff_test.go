@@ -0,0 +1,150 @@
+package nmap
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDiffFiles(t *testing.T) {
+	diff, err := DiffFiles([]string{"testdata/baseline.xml"}, []string{"testdata/current.xml"}, nil)
+	if err != nil {
+		t.Fatalf("DiffFiles: %v", err)
+	}
+
+	// 10.0.0.3 was down in the baseline, 10.0.0.2 is missing from the current scan
+	if !reflect.DeepEqual(diff.HostsAdded, []string{"10.0.0.3"}) || !reflect.DeepEqual(diff.HostsGone, []string{"10.0.0.2"}) {
+		t.Errorf("got added %v, gone %v", diff.HostsAdded, diff.HostsGone)
+	}
+
+	want := []HostDiff{
+		{Address: "10.0.0.1", Changes: []PortChange{
+			{Port: 22, Protocol: "tcp", Kind: ChangeService, OldState: "open", NewState: "open",
+				OldService: "ssh OpenSSH 8.9p1 (Ubuntu Linux; protocol 2.0)", NewService: "ssh OpenSSH 9.6p1 (Ubuntu Linux; protocol 2.0)"},
+			{Port: 80, Protocol: "tcp", Kind: ChangeClosed, OldState: "open", NewState: "closed",
+				OldService: "http nginx 1.18.0", NewService: "http"},
+			{Port: 443, Protocol: "tcp", Kind: ChangeOpened, OldState: "closed", NewState: "open",
+				OldService: "https", NewService: "ssl/http nginx 1.24.0"},
+			{Port: 8080, Protocol: "tcp", Kind: ChangeState, OldState: "filtered", NewState: "closed",
+				OldService: "http-proxy", NewService: "http-proxy"},
+		}},
+		{Address: "10.0.0.2", Changes: []PortChange{
+			{Port: 3306, Protocol: "tcp", Kind: ChangeClosed, OldState: "open", NewState: "absent",
+				OldService: "mysql MySQL 8.0.35"},
+		}},
+		{Address: "10.0.0.3", Changes: []PortChange{
+			{Port: 25, Protocol: "tcp", Kind: ChangeOpened, OldState: "absent", NewState: "open",
+				NewService: "smtp Postfix smtpd"},
+		}},
+	}
+	if !reflect.DeepEqual(diff.HostChanges, want) {
+		got, _ := json.MarshalIndent(diff.HostChanges, "", "  ")
+		t.Errorf("unexpected changes:\n%s", got)
+	}
+
+	counts := map[string]int{ChangeOpened: 2, ChangeClosed: 2, ChangeState: 1, ChangeService: 1}
+	for kind, want := range counts {
+		if got := diff.Count(kind); got != want {
+			t.Errorf("Count(%s) = %d, want %d", kind, got, want)
+		}
+	}
+}
+
+func TestDiffFilesMerged(t *testing.T) {
+	// Merged with partial.xml the baseline already has Apache on port 80, and
+	// partial.xml's FTP port disappears from the current scan
+	diff, err := DiffFiles([]string{"testdata/baseline.xml", "testdata/partial.xml"}, []string{"testdata/current.xml"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	changes := map[int]PortChange{}
+	for _, c := range diff.HostChanges[0].Changes {
+		changes[c.Port] = c
+	}
+	if c := changes[21]; c.Kind != ChangeClosed || c.OldService != "ftp vsftpd 3.0.5" || c.NewState != "absent" {
+		t.Errorf("expected port 21 closed, got %+v", c)
+	}
+	if c := changes[80]; c.Kind != ChangeClosed || c.OldService != "http Apache httpd 2.4.58" {
+		t.Errorf("expected port 80 closed from Apache, got %+v", c)
+	}
+}
+
+func TestDiffFilesFiltered(t *testing.T) {
+	filter, err := ParseFilter(`port in [22, 8080]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	diff, err := DiffFiles([]string{"testdata/baseline.xml"}, []string{"testdata/current.xml"}, filter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diff.HostChanges) != 1 || len(diff.HostChanges[0].Changes) != 2 {
+		t.Fatalf("unexpected changes %+v", diff.HostChanges)
+	}
+	if diff.Count(ChangeService) != 1 || diff.Count(ChangeState) != 1 {
+		t.Errorf("unexpected changes %+v", diff.HostChanges[0].Changes)
+	}
+	// Host presence is not affected by the port filter
+	if len(diff.HostsAdded) != 1 || len(diff.HostsGone) != 1 {
+		t.Errorf("got added %v, gone %v", diff.HostsAdded, diff.HostsGone)
+	}
+}
+
+func TestDiffRunsUnchanged(t *testing.T) {
+	run, err := ParseXMLResults("testdata/baseline.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	diff := DiffRuns(run, run)
+	if !diff.Empty() {
+		t.Errorf("expected no changes, got %+v", diff)
+	}
+	if md := diff.Markdown(); !strings.Contains(md, "No changes detected.") {
+		t.Errorf("unexpected Markdown:\n%s", md)
+	}
+}
+
+func TestScanDiffRender(t *testing.T) {
+	diff, err := DiffFiles([]string{"testdata/baseline.xml"}, []string{"testdata/current.xml"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	md, err := diff.Render("markdown")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"- Baseline: testdata/baseline.xml\n",
+		"| 1 | 1 | 2 | 2 | 1 | 1 |\n",
+		"## Hosts Added\n\n- 10.0.0.3\n",
+		"## Hosts Gone\n\n- 10.0.0.2\n",
+		"### 10.0.0.1\n",
+		"| 443/tcp | opened | closed (https) | open (ssl/http nginx 1.24.0) |\n",
+		"| 3306/tcp | closed | open (mysql MySQL 8.0.35) | absent |\n",
+	} {
+		if !strings.Contains(string(md), want) {
+			t.Errorf("Markdown is missing %q:\n%s", want, md)
+		}
+	}
+
+	data, err := diff.Render("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded ScanDiff
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded.HostChanges, diff.HostChanges) {
+		t.Errorf("JSON round trip changed the diff: %s", data)
+	}
+
+	if _, err := diff.Render("xml"); err == nil {
+		t.Error("expected an unsupported format to fail")
+	}
+	if got := markdownCell("open", "a|b"); got != `open (a\|b)` {
+		t.Errorf("markdownCell did not escape the pipe: %s", got)
+	}
+}
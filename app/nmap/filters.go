@@ -2,10 +2,28 @@ package nmap
 
 import (
 	"regexp"
+	"strings"
+
+	"ghostshell/app/filterexpr"
 
 	"github.com/Ullaakut/nmap/v3"
 )
 
+// FilterSchema lists the fields available to -filter expressions on Nmap results
+var FilterSchema = filterexpr.Schema{
+	"host":     filterexpr.String,
+	"os":       filterexpr.String,
+	"port":     filterexpr.Int,
+	"protocol": filterexpr.String,
+	"state":    filterexpr.String,
+	"reason":   filterexpr.String,
+	"service":  filterexpr.String,
+	"product":  filterexpr.String,
+	"version":  filterexpr.String,
+	"tunnel":   filterexpr.String,
+	"open":     filterexpr.Bool,
+}
+
 // Filter represents a filter for Nmap results
 type Filter struct {
 	Port       int
@@ -13,31 +31,91 @@ type Filter struct {
 	Service    string
 	OS         string
 	RegexMatch *regexp.Regexp
+	Expression *filterexpr.Expr
 }
 
-// Matches checks if a given Nmap result matches the filter criteria
-func (f *Filter) Matches(result *nmap.Port) bool {
+// ParseFilter compiles a filter expression such as
+// `port in [80,443] && service ~ "http"` into a Filter
+func ParseFilter(expr string) (*Filter, error) {
+	compiled, err := filterexpr.Compile(expr, FilterSchema)
+	if err != nil {
+		return nil, err
+	}
+	return &Filter{Expression: compiled}, nil
+}
+
+// Matches checks if a port of a scanned host matches the filter criteria
+func (f *Filter) Matches(host *nmap.Host, result *nmap.Port) bool {
 	// Check port number
-	if f.Port != 0 && f.Port != result.ID {
+	if f.Port != 0 && f.Port != int(result.ID) {
 		return false
 	}
 
 	// Check port state
-	if f.State != "" && f.State != result.State {
+	if f.State != "" && f.State != result.State.State {
 		return false
 	}
 
 	// Check service name
-	if f.Service != "" && result.Service != nil && f.Service != result.Service.Name {
+	if f.Service != "" && f.Service != result.Service.Name {
 		return false
 	}
 
 	// Check regex match on service name
-	if f.RegexMatch != nil && result.Service != nil {
+	if f.RegexMatch != nil {
 		if !f.RegexMatch.MatchString(result.Service.Name) {
 			return false
 		}
 	}
 
+	// Check filter expression
+	if f.Expression != nil && !f.Expression.Match(portValues(host, result)) {
+		return false
+	}
+
 	return true
 }
+
+// MatchesInventoryPort checks the filter expression against a port of an inventory host
+func (f *Filter) MatchesInventoryPort(host *InventoryHost, port *InventoryPort) bool {
+	if f.Expression == nil {
+		return true
+	}
+	return f.Expression.Match(filterexpr.Values{
+		"host":     host.Address,
+		"os":       host.OS,
+		"port":     port.Port,
+		"protocol": port.Protocol,
+		"state":    port.State,
+		"reason":   port.Reason,
+		"service":  port.Service,
+		"product":  port.Product,
+		"version":  port.Version,
+		"tunnel":   port.Tunnel,
+		"open":     port.IsOpen(),
+	})
+}
+
+// portValues exposes a port of a scanned host to filter expressions
+func portValues(h *nmap.Host, p *nmap.Port) filterexpr.Values {
+	var address, os string
+	if h != nil {
+		address = hostKey(*h)
+		if len(h.OS.Matches) > 0 {
+			os = h.OS.Matches[0].Name
+		}
+	}
+	return filterexpr.Values{
+		"host":     address,
+		"os":       os,
+		"port":     p.ID,
+		"protocol": p.Protocol,
+		"state":    p.State.State,
+		"reason":   p.State.Reason,
+		"service":  p.Service.Name,
+		"product":  p.Service.Product,
+		"version":  p.Service.Version,
+		"tunnel":   p.Service.Tunnel,
+		"open":     strings.HasPrefix(p.State.State, "open"),
+	}
+}
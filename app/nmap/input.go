@@ -13,34 +13,109 @@ type Options struct {
 	OutputFile     string
 	TimingTemplate int
 	Verbose        bool
+
+	// Offline modes working on saved XML/YAML results instead of scanning
+	Baseline []string // -diff-old: files merged into the baseline inventory
+	Current  []string // -diff-new: files merged into the current inventory
+	Merge    []string // -merge: files merged into a single inventory
+	Format   string   // json or markdown
+
+	Filter string // -filter: expression selecting the ports to report
+}
+
+// DiffMode reports whether the options ask for a diff between saved scans
+func (o *Options) DiffMode() bool {
+	return len(o.Baseline) > 0 || len(o.Current) > 0
 }
 
-// parseInput parses command-line arguments and returns Options
-func parseInput() (*Options, error) {
+// MergeMode reports whether the options ask to merge saved scans
+func (o *Options) MergeMode() bool {
+	return len(o.Merge) > 0
+}
+
+// ResultFilter compiles the -filter expression, returning nil when none was given
+func (o *Options) ResultFilter() (*Filter, error) {
+	if o.Filter == "" {
+		return nil, nil
+	}
+	filter, err := ParseFilter(o.Filter)
+	if err != nil {
+		return nil, fmt.Errorf("invalid -filter: %w", err)
+	}
+	return filter, nil
+}
+
+// ParseInput parses command-line arguments and returns Options
+func ParseInput() (*Options, error) {
 	var targets string
 	var ports string
 	var outputFile string
 	var timingTemplate int
 	var verbose bool
+	var diffOld, diffNew, merge, format string
+	var filter string
 
 	flag.StringVar(&targets, "targets", "", "Comma-separated list of targets to scan")
 	flag.StringVar(&ports, "ports", "1-1000", "Ports to scan (e.g., 80,443 or 1-1000)")
 	flag.StringVar(&outputFile, "output", "results.xml", "File to write scan results")
 	flag.IntVar(&timingTemplate, "timing", 3, "Timing template for the scan (1-5)")
 	flag.BoolVar(&verbose, "verbose", false, "Enable verbose output")
+	flag.StringVar(&diffOld, "diff-old", "", "Comma-separated XML/YAML results forming the baseline of a diff")
+	flag.StringVar(&diffNew, "diff-new", "", "Comma-separated XML/YAML results compared against the baseline")
+	flag.StringVar(&merge, "merge", "", "Comma-separated XML/YAML results to merge into one host inventory")
+	flag.StringVar(&format, "format", "json", "Output format for diff results (json or markdown)")
+	flag.StringVar(&filter, "filter", "", `Only report ports matching an expression, e.g. 'port in [80,443] && service ~ "http"' (with -diff-old/-diff-new or -merge)`)
 	flag.Parse()
 
-	if targets == "" {
-		return nil, fmt.Errorf("no targets provided")
-	}
-
 	options := &Options{
-		Targets:        strings.Split(targets, ","),
 		Ports:          ports,
 		OutputFile:     outputFile,
 		TimingTemplate: timingTemplate,
 		Verbose:        verbose,
+		Baseline:       splitList(diffOld),
+		Current:        splitList(diffNew),
+		Merge:          splitList(merge),
+		Format:         format,
+		Filter:         filter,
+	}
+
+	if _, err := options.ResultFilter(); err != nil {
+		return nil, err
 	}
 
+	if options.DiffMode() || options.MergeMode() {
+		if options.DiffMode() && (len(options.Baseline) == 0 || len(options.Current) == 0) {
+			return nil, fmt.Errorf("both -diff-old and -diff-new are required for a diff")
+		}
+		// Offline modes print to stdout unless an output file was asked for
+		outputSet := false
+		flag.Visit(func(f *flag.Flag) {
+			outputSet = outputSet || f.Name == "output"
+		})
+		if !outputSet {
+			options.OutputFile = ""
+		}
+		return options, nil
+	}
+
+	if options.Filter != "" {
+		return nil, fmt.Errorf("-filter applies to saved results; use it with -diff-old/-diff-new or -merge")
+	}
+	if targets == "" {
+		return nil, fmt.Errorf("no targets provided")
+	}
+	options.Targets = strings.Split(targets, ",")
+
 	return options, nil
 }
+
+// splitList splits a comma-separated flag value, dropping empty entries
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,250 @@
+package nmap
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Ullaakut/nmap/v3"
+)
+
+// Inventory is a merged, per-host view of one or more Nmap runs
+type Inventory struct {
+	Sources []string                  `json:"sources"`
+	Hosts   map[string]*InventoryHost `json:"hosts"`
+}
+
+// InventoryHost holds everything known about a single host
+type InventoryHost struct {
+	Address   string                    `json:"address"`
+	Hostnames []string                  `json:"hostnames,omitempty"`
+	State     string                    `json:"state"`
+	OS        string                    `json:"os,omitempty"`
+	LastSeen  time.Time                 `json:"last_seen"`
+	Ports     map[string]*InventoryPort `json:"ports"`
+}
+
+// InventoryPort holds the latest state and service of a port
+type InventoryPort struct {
+	Port      int       `json:"port"`
+	Protocol  string    `json:"protocol"`
+	State     string    `json:"state"`
+	Reason    string    `json:"reason,omitempty"`
+	Service   string    `json:"service,omitempty"`
+	Product   string    `json:"product,omitempty"`
+	Version   string    `json:"version,omitempty"`
+	ExtraInfo string    `json:"extra_info,omitempty"`
+	Tunnel    string    `json:"tunnel,omitempty"`
+	CPE       []string  `json:"cpe,omitempty"`
+	LastSeen  time.Time `json:"last_seen"`
+}
+
+// NewInventory creates an empty Inventory
+func NewInventory() *Inventory {
+	return &Inventory{
+		Hosts: make(map[string]*InventoryHost),
+	}
+}
+
+// LoadInventory parses every result file and merges them into one Inventory.
+// Runs are applied oldest first so the newest observation of a port wins.
+func LoadInventory(filePaths ...string) (*Inventory, error) {
+	runs := make([]*nmap.Run, 0, len(filePaths))
+	for _, path := range filePaths {
+		run, err := ParseResultsFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load %s: %w", path, err)
+		}
+		runs = append(runs, run)
+	}
+
+	return MergeRuns(runs, filePaths), nil
+}
+
+// MergeRuns merges several runs into one Inventory. sources labels each run
+// and may be nil.
+func MergeRuns(runs []*nmap.Run, sources []string) *Inventory {
+	order := make([]int, len(runs))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return time.Time(runs[order[a]].Start).Before(time.Time(runs[order[b]].Start))
+	})
+
+	inv := NewInventory()
+	for _, i := range order {
+		source := fmt.Sprintf("run-%d", i+1)
+		if i < len(sources) {
+			source = sources[i]
+		}
+		inv.AddRun(runs[i], source)
+	}
+	return inv
+}
+
+// AddRun merges a run into the inventory, overwriting older observations
+func (inv *Inventory) AddRun(run *nmap.Run, source string) {
+	if run == nil {
+		return
+	}
+	inv.Sources = append(inv.Sources, source)
+
+	seen := time.Time(run.Start)
+	for _, host := range run.Hosts {
+		key := hostKey(host)
+		if key == "" {
+			continue
+		}
+
+		entry, ok := inv.Hosts[key]
+		if !ok {
+			entry = &InventoryHost{
+				Address: key,
+				Ports:   make(map[string]*InventoryPort),
+			}
+			inv.Hosts[key] = entry
+		}
+
+		entry.State = host.Status.State
+		entry.LastSeen = seen
+		for _, hostname := range host.Hostnames {
+			entry.Hostnames = appendUnique(entry.Hostnames, hostname.Name)
+		}
+		if len(host.OS.Matches) > 0 {
+			entry.OS = host.OS.Matches[0].Name
+		}
+
+		for _, port := range host.Ports {
+			p := &InventoryPort{
+				Port:      int(port.ID),
+				Protocol:  port.Protocol,
+				State:     port.State.State,
+				Reason:    port.State.Reason,
+				Service:   port.Service.Name,
+				Product:   port.Service.Product,
+				Version:   port.Service.Version,
+				ExtraInfo: port.Service.ExtraInfo,
+				Tunnel:    port.Service.Tunnel,
+				LastSeen:  seen,
+			}
+			for _, cpe := range port.Service.CPEs {
+				p.CPE = append(p.CPE, string(cpe))
+			}
+			entry.Ports[p.Key()] = p
+		}
+	}
+}
+
+// Filtered returns a copy of the inventory keeping only the ports that match the filter
+func (inv *Inventory) Filtered(f *Filter) *Inventory {
+	if f == nil || f.Expression == nil {
+		return inv
+	}
+
+	out := NewInventory()
+	out.Sources = inv.Sources
+	for address, host := range inv.Hosts {
+		copied := *host
+		copied.Ports = make(map[string]*InventoryPort)
+		for key, port := range host.Ports {
+			if f.MatchesInventoryPort(host, port) {
+				copied.Ports[key] = port
+			}
+		}
+		out.Hosts[address] = &copied
+	}
+	return out
+}
+
+// HostAddresses returns the inventory's host keys in sorted order
+func (inv *Inventory) HostAddresses() []string {
+	addresses := make([]string, 0, len(inv.Hosts))
+	for address := range inv.Hosts {
+		addresses = append(addresses, address)
+	}
+	sort.Strings(addresses)
+	return addresses
+}
+
+// JSON returns the indented JSON representation of the inventory
+func (inv *Inventory) JSON() ([]byte, error) {
+	return json.MarshalIndent(inv, "", "  ")
+}
+
+// Key returns the "port/protocol" identifier of the port, e.g. "443/tcp"
+func (p *InventoryPort) Key() string {
+	return fmt.Sprintf("%d/%s", p.Port, p.Protocol)
+}
+
+// IsOpen reports whether the port was seen open
+func (p *InventoryPort) IsOpen() bool {
+	return p != nil && strings.HasPrefix(p.State, "open")
+}
+
+// ServiceString renders the service as "ssl/http nginx 1.25.3 (Ubuntu)"
+func (p *InventoryPort) ServiceString() string {
+	if p == nil || p.Service == "" {
+		return ""
+	}
+
+	name := p.Service
+	if p.Tunnel != "" {
+		name = p.Tunnel + "/" + name
+	}
+	parts := []string{name}
+	for _, s := range []string{p.Product, p.Version} {
+		if s != "" {
+			parts = append(parts, s)
+		}
+	}
+	if p.ExtraInfo != "" {
+		parts = append(parts, "("+p.ExtraInfo+")")
+	}
+	return strings.Join(parts, " ")
+}
+
+// sortedPorts returns the ports ordered by protocol and port number
+func (h *InventoryHost) sortedPorts() []*InventoryPort {
+	ports := make([]*InventoryPort, 0, len(h.Ports))
+	for _, p := range h.Ports {
+		ports = append(ports, p)
+	}
+	sort.Slice(ports, func(i, j int) bool {
+		if ports[i].Protocol != ports[j].Protocol {
+			return ports[i].Protocol < ports[j].Protocol
+		}
+		return ports[i].Port < ports[j].Port
+	})
+	return ports
+}
+
+// hostKey identifies a host by its first IP address, falling back to a hostname
+func hostKey(host nmap.Host) string {
+	for _, addr := range host.Addresses {
+		if addr.AddrType == "ipv4" || addr.AddrType == "ipv6" {
+			return addr.Addr
+		}
+	}
+	if len(host.Addresses) > 0 {
+		return host.Addresses[0].Addr
+	}
+	if len(host.Hostnames) > 0 {
+		return host.Hostnames[0].Name
+	}
+	return ""
+}
+
+func appendUnique(list []string, value string) []string {
+	if value == "" {
+		return list
+	}
+	for _, existing := range list {
+		if existing == value {
+			return list
+		}
+	}
+	return append(list, value)
+}
@@ -0,0 +1,170 @@
+package nmap
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/Ullaakut/nmap/v3"
+)
+
+func TestLoadInventoryMergePrecedence(t *testing.T) {
+	// partial.xml ran between baseline.xml and current.xml; file order must not matter
+	inv, err := LoadInventory("testdata/current.xml", "testdata/partial.xml", "testdata/baseline.xml")
+	if err != nil {
+		t.Fatalf("LoadInventory: %v", err)
+	}
+
+	wantSources := []string{"testdata/baseline.xml", "testdata/partial.xml", "testdata/current.xml"}
+	if !reflect.DeepEqual(inv.Sources, wantSources) {
+		t.Errorf("got sources %v, want %v", inv.Sources, wantSources)
+	}
+	if got := inv.HostAddresses(); !reflect.DeepEqual(got, []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"}) {
+		t.Errorf("got hosts %v", got)
+	}
+
+	web := inv.Hosts["10.0.0.1"]
+	if web.OS != "Linux 6.X" || !reflect.DeepEqual(web.Hostnames, []string{"web.example.test", "www.example.test"}) {
+		t.Errorf("unexpected host %+v", web)
+	}
+	if got := web.LastSeen.Unix(); got != 1700600000 {
+		t.Errorf("got last seen %d", got)
+	}
+
+	tests := []struct {
+		key      string
+		state    string
+		service  string
+		lastSeen int64
+	}{
+		// The newest run wins for ports it observed
+		{"22/tcp", "open", "ssh OpenSSH 9.6p1 (Ubuntu Linux; protocol 2.0)", 1700600000},
+		{"80/tcp", "closed", "http", 1700600000},
+		{"443/tcp", "open", "ssl/http nginx 1.24.0", 1700600000},
+		// Ports only an older run observed are kept
+		{"21/tcp", "open", "ftp vsftpd 3.0.5", 1700300000},
+	}
+	for _, tt := range tests {
+		p := web.Ports[tt.key]
+		if p == nil {
+			t.Errorf("%s missing", tt.key)
+			continue
+		}
+		if p.State != tt.state || p.ServiceString() != tt.service || p.LastSeen.Unix() != tt.lastSeen {
+			t.Errorf("%s: got %s %q seen %d", tt.key, p.State, p.ServiceString(), p.LastSeen.Unix())
+		}
+	}
+	if cpe := web.Ports["22/tcp"].CPE; !reflect.DeepEqual(cpe, []string{"cpe:/a:openbsd:openssh:9.6p1"}) {
+		t.Errorf("got CPE %v", cpe)
+	}
+
+	// A host absent from the newest run keeps its older state
+	if db := inv.Hosts["10.0.0.2"]; db.State != "up" || !db.Ports["3306/tcp"].IsOpen() {
+		t.Errorf("unexpected host %+v", db)
+	}
+	if mail := inv.Hosts["10.0.0.3"]; mail.State != "up" || len(mail.Ports) != 1 {
+		t.Errorf("unexpected host %+v", mail)
+	}
+
+	if _, err := LoadInventory("testdata/current.xml", "testdata/missing.xml"); err == nil {
+		t.Error("expected a missing file to fail")
+	}
+}
+
+func TestMergeRunsSources(t *testing.T) {
+	baseline, err := ParseXMLResults("testdata/baseline.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	current, err := ParseXMLResults("testdata/current.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	inv := MergeRuns([]*nmap.Run{current, baseline}, nil)
+	if !reflect.DeepEqual(inv.Sources, []string{"run-2", "run-1"}) {
+		t.Errorf("got sources %v", inv.Sources)
+	}
+	if inv.Hosts["10.0.0.3"].State != "up" {
+		t.Error("the newer run should decide the host state")
+	}
+
+	inv.AddRun(nil, "ignored")
+	if len(inv.Sources) != 2 {
+		t.Errorf("a nil run was recorded: %v", inv.Sources)
+	}
+}
+
+func TestInventoryFiltered(t *testing.T) {
+	inv, err := LoadInventory("testdata/baseline.xml", "testdata/partial.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	filter, err := ParseFilter(`open && port < 1000 && host == "10.0.0.1"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	filtered := inv.Filtered(filter)
+
+	var ports []string
+	for _, p := range filtered.Hosts["10.0.0.1"].sortedPorts() {
+		ports = append(ports, p.Key())
+	}
+	if !reflect.DeepEqual(ports, []string{"21/tcp", "22/tcp", "80/tcp"}) {
+		t.Errorf("got ports %v", ports)
+	}
+	if len(filtered.Hosts["10.0.0.2"].Ports) != 0 {
+		t.Errorf("expected no ports on 10.0.0.2, got %v", filtered.Hosts["10.0.0.2"].Ports)
+	}
+	// The original inventory is untouched
+	if len(inv.Hosts["10.0.0.1"].Ports) != 5 {
+		t.Errorf("Filtered modified the inventory: %d ports", len(inv.Hosts["10.0.0.1"].Ports))
+	}
+	byReason, err := ParseFilter(`reason == "no-response"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ports := inv.Filtered(byReason).Hosts["10.0.0.1"].Ports; len(ports) != 1 || ports["8080/tcp"] == nil {
+		t.Errorf("expected only 8080/tcp to match the reason filter, got %v", ports)
+	}
+	if inv.Filtered(nil) != inv {
+		t.Error("a nil filter should return the inventory itself")
+	}
+
+	data, err := filtered.JSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded Inventory
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Hosts["10.0.0.1"].Ports["80/tcp"].Product != "Apache httpd" {
+		t.Errorf("unexpected JSON %s", data)
+	}
+}
+
+func TestFilterRunMatchesHost(t *testing.T) {
+	run, err := ParseResultsFile("testdata/baseline.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	filter, err := ParseFilter(`open && host == "10.0.0.1"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	filtered := filterRun(run, filter)
+	for _, host := range filtered.Hosts {
+		if hostKey(host) != "10.0.0.1" && len(host.Ports) != 0 {
+			t.Errorf("expected no ports on %s, got %d", hostKey(host), len(host.Ports))
+		}
+		if hostKey(host) == "10.0.0.1" && len(host.Ports) == 0 {
+			t.Error("expected the open ports of 10.0.0.1 to match")
+		}
+	}
+	if filterRun(run, nil) != run {
+		t.Error("a nil filter should return the run itself")
+	}
+}
@@ -1,6 +1,8 @@
 package nmap
 
 import (
+	"context"
+	"encoding/xml"
 	"fmt"
 
 	"github.com/Ullaakut/nmap/v3"
@@ -22,16 +24,19 @@ func NewNmapScanner(options *Options) *NmapScanner {
 // Run executes the Nmap scan
 func (s *NmapScanner) Run() error {
 	scanner, err := nmap.NewScanner(
+		context.Background(),
 		nmap.WithTargets(s.options.Targets...),
 		nmap.WithPorts(s.options.Ports),
 		nmap.WithTimingTemplate(nmap.Timing(s.options.TimingTemplate)),
 		nmap.WithServiceInfo(),
 		nmap.WithOSDetection(),
-		nmap.WithXMLResults(s.options.OutputFile),
 	)
 	if err != nil {
 		return fmt.Errorf("failed to create Nmap scanner: %w", err)
 	}
+	if s.options.OutputFile != "" {
+		scanner.ToFile(s.options.OutputFile)
+	}
 
 	results, warnings, err := scanner.Run()
 	if err != nil {
@@ -51,16 +56,41 @@ func (s *NmapScanner) SetOptions(options *Options) {
 	s.options = options
 }
 
-// GetResults retrieves the results of the scan
+// GetResults retrieves the results of the scan, keeping only the ports that
+// match the -filter expression
 func (s *NmapScanner) GetResults() ([]byte, error) {
 	if s.results == nil {
 		return nil, fmt.Errorf("no results available, please run the scan first")
 	}
+	filter, err := s.options.ResultFilter()
+	if err != nil {
+		return nil, err
+	}
 
-	xmlResults, err := s.results.MarshalXML()
+	xmlResults, err := xml.Marshal(filterRun(s.results, filter))
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal results to XML: %w", err)
 	}
 
 	return xmlResults, nil
 }
+
+// filterRun returns a copy of run keeping only the ports that match filter
+func filterRun(run *nmap.Run, filter *Filter) *nmap.Run {
+	if filter == nil {
+		return run
+	}
+	filtered := *run
+	filtered.Hosts = make([]nmap.Host, len(run.Hosts))
+	for i, host := range run.Hosts {
+		ports := make([]nmap.Port, 0, len(host.Ports))
+		for j := range host.Ports {
+			if filter.Matches(&run.Hosts[i], &host.Ports[j]) {
+				ports = append(ports, host.Ports[j])
+			}
+		}
+		host.Ports = ports
+		filtered.Hosts[i] = host
+	}
+	return &filtered
+}
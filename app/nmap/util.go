@@ -30,5 +30,5 @@ func ReadLines(filePath string) ([]string, error) {
 // IsValidTarget checks if the given string is a valid Nmap target (IP or hostname)
 func IsValidTarget(target string) bool {
 	// Basic validation: Ensure target is not empty and doesn't contain invalid characters
-	return target != "" && !strings.ContainsAny(target, " \\"")
-}
\ No newline at end of file
+	return target != "" && !strings.ContainsAny(target, " \\\"")
+}
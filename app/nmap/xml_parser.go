@@ -0,0 +1,39 @@
+package nmap
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Ullaakut/nmap/v3"
+)
+
+// ParseXMLResults parses the XML output (-oX) of an Nmap run, including runs
+// made outside GhostShell
+func ParseXMLResults(filePath string) (*nmap.Run, error) {
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read XML file: %w", err)
+	}
+
+	var results nmap.Run
+	if err := nmap.Parse(content, &results); err != nil {
+		return nil, fmt.Errorf("failed to decode XML: %w", err)
+	}
+
+	return &results, nil
+}
+
+// ParseResultsFile parses an Nmap result file, choosing the XML or YAML
+// parser from the file extension
+func ParseResultsFile(filePath string) (*nmap.Run, error) {
+	switch strings.ToLower(filepath.Ext(filePath)) {
+	case ".xml":
+		return ParseXMLResults(filePath)
+	case ".yaml", ".yml":
+		return ParseYAMLResults(filePath)
+	default:
+		return nil, fmt.Errorf("unsupported result file format: %s", filePath)
+	}
+}
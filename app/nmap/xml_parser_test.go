@@ -0,0 +1,86 @@
+package nmap
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseXMLResults(t *testing.T) {
+	run, err := ParseXMLResults("testdata/baseline.xml")
+	if err != nil {
+		t.Fatalf("ParseXMLResults: %v", err)
+	}
+	if got := time.Time(run.Start).Unix(); got != 1700000000 {
+		t.Errorf("got start %d", got)
+	}
+	if len(run.Hosts) != 3 {
+		t.Fatalf("got %d hosts, want 3", len(run.Hosts))
+	}
+
+	web := run.Hosts[0]
+	if web.Addresses[0].Addr != "10.0.0.1" || web.Status.State != "up" || web.Hostnames[0].Name != "web.example.test" {
+		t.Errorf("unexpected host %+v", web)
+	}
+	if len(web.Ports) != 4 {
+		t.Fatalf("got %d ports, want 4", len(web.Ports))
+	}
+	ssh := web.Ports[0]
+	if ssh.ID != 22 || ssh.Protocol != "tcp" || ssh.State.State != "open" || ssh.State.Reason != "syn-ack" {
+		t.Errorf("unexpected port %+v", ssh)
+	}
+	if ssh.Service.Product != "OpenSSH" || ssh.Service.Version != "8.9p1" || len(ssh.Service.CPEs) != 1 {
+		t.Errorf("unexpected service %+v", ssh.Service)
+	}
+	if len(web.OS.Matches) == 0 || web.OS.Matches[0].Name != "Linux 5.0 - 5.14" {
+		t.Errorf("unexpected OS %+v", web.OS)
+	}
+	if run.Hosts[2].Status.State != "down" {
+		t.Errorf("expected the third host down, got %q", run.Hosts[2].Status.State)
+	}
+}
+
+func TestParseResultsFile(t *testing.T) {
+	dir := t.TempDir()
+
+	// The parser is chosen from the extension, case-insensitively
+	content, err := os.ReadFile("testdata/current.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	upper := filepath.Join(dir, "CURRENT.XML")
+	if err := os.WriteFile(upper, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	run, err := ParseResultsFile(upper)
+	if err != nil || len(run.Hosts) != 2 {
+		t.Fatalf("ParseResultsFile(%s): %v", upper, err)
+	}
+
+	yamlPath := filepath.Join(dir, "current.yaml")
+	if err := SaveResultsAsYAML(run, yamlPath); err != nil {
+		t.Fatalf("SaveResultsAsYAML: %v", err)
+	}
+	fromYAML, err := ParseResultsFile(yamlPath)
+	if err != nil {
+		t.Fatalf("ParseResultsFile(%s): %v", yamlPath, err)
+	}
+	if len(fromYAML.Hosts) != 2 || fromYAML.Hosts[0].Ports[2].Service.Tunnel != "ssl" {
+		t.Errorf("YAML round trip lost data: %+v", fromYAML.Hosts)
+	}
+
+	broken := filepath.Join(dir, "broken.xml")
+	if err := os.WriteFile(broken, []byte("<nmaprun><host>"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{
+		filepath.Join(dir, "results.txt"),
+		filepath.Join(dir, "missing.xml"),
+		broken,
+	} {
+		if _, err := ParseResultsFile(path); err == nil {
+			t.Errorf("ParseResultsFile(%s): expected an error", path)
+		}
+	}
+}
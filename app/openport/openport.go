@@ -1,17 +1,21 @@
 package openport
 
 import (
+	"context"
 	"fmt"
 	"net"
 	"os"
 	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
+
+	"ghostshell/app/fingerprint"
 )
 
 // Constants & Paths
@@ -26,6 +30,7 @@ type PortStatus struct {
 	Protocol   string
 	IsOpen     bool
 	IsInsecure bool
+	Service    *fingerprint.ServiceInfo
 }
 
 // InsecurePorts is a predefined list of ports considered insecure.
@@ -44,9 +49,9 @@ var InsecurePorts = map[int]bool{
 	5900: true, // VNC
 }
 
-// FindOpenPorts identifies open ports within the specified range and protocol.
+// FindOpenPorts identifies open ports on host within the specified range and protocol.
 // It returns a sorted list of PortStatus, prioritizing insecure ports first.
-func FindOpenPorts(startPort, endPort int, protocol string) ([]PortStatus, error) {
+func FindOpenPorts(host string, startPort, endPort int, protocol string) ([]PortStatus, error) {
 	// Initialize Zap logger
 	logger, err := setupLogger()
 	if err != nil {
@@ -55,6 +60,7 @@ func FindOpenPorts(startPort, endPort int, protocol string) ([]PortStatus, error
 	defer logger.Sync()
 
 	logger.Info("Starting port scan",
+		zap.String("host", host),
 		zap.Int("startPort", startPort),
 		zap.Int("endPort", endPort),
 		zap.String("protocol", protocol),
@@ -72,7 +78,7 @@ func FindOpenPorts(startPort, endPort int, protocol string) ([]PortStatus, error
 	worker := func() {
 		defer wg.Done()
 		for port := range portChan {
-			address := fmt.Sprintf("127.0.0.1:%d", port)
+			address := net.JoinHostPort(host, strconv.Itoa(port))
 			conn, err := net.DialTimeout(protocol, address, 500*time.Millisecond)
 			if err == nil {
 				conn.Close()
@@ -141,6 +147,28 @@ func FindOpenPorts(startPort, endPort int, protocol string) ([]PortStatus, error
 	return openPorts, nil
 }
 
+// IdentifyServices fingerprints the service listening on each open port.
+// Ports that cannot be fingerprinted keep a nil Service.
+func IdentifyServices(host string, openPorts []PortStatus, engine *fingerprint.Engine) {
+	if engine == nil {
+		engine = fingerprint.NewEngine(nil, nil)
+	}
+
+	ports := make([]int, 0, len(openPorts))
+	for _, p := range openPorts {
+		ports = append(ports, p.Port)
+	}
+
+	protocol := "tcp"
+	if len(openPorts) > 0 {
+		protocol = openPorts[0].Protocol
+	}
+	services := engine.IdentifyAll(context.Background(), host, ports, protocol, MaxConcurrency/10)
+	for i := range openPorts {
+		openPorts[i].Service = services[openPorts[i].Port]
+	}
+}
+
 // setupLogger initializes a Zap logger with a timestamped log file in ISO8601 format.
 func setupLogger() (*zap.Logger, error) {
 	if err := os.MkdirAll(LogDir, 0755); err != nil {
@@ -167,28 +195,34 @@ func setupLogger() (*zap.Logger, error) {
 func DisplayOpenPorts(openPorts []PortStatus) {
 	fmt.Println("Open Ports:")
 	fmt.Println("------------")
-	fmt.Printf("%-10s %-10s %-10s\n", "Port", "Protocol", "Insecure")
-	fmt.Printf("%-10s %-10s %-10s\n", "----", "--------", "---------")
+	fmt.Printf("%-10s %-10s %-10s %s\n", "Port", "Protocol", "Insecure", "Service")
+	fmt.Printf("%-10s %-10s %-10s %s\n", "----", "--------", "---------", "-------")
 	for _, port := range openPorts {
 		insecure := "No"
 		if port.IsInsecure {
 			insecure = "Yes"
 		}
-		fmt.Printf("%-10d %-10s %-10s\n", port.Port, port.Protocol, insecure)
+		service := "unknown"
+		if port.Service != nil {
+			service = port.Service.String()
+		}
+		fmt.Printf("%-10d %-10s %-10s %s\n", port.Port, port.Protocol, insecure, service)
 	}
 }
 
 // Example usage of FindOpenPorts and DisplayOpenPorts
 func main() {
+	host := "127.0.0.1"
 	startPort := 1
 	endPort := 1024
 	protocol := "tcp"
 
-	openPorts, err := FindOpenPorts(startPort, endPort, protocol)
+	openPorts, err := FindOpenPorts(host, startPort, endPort, protocol)
 	if err != nil {
 		fmt.Printf("Error scanning ports: %v\n", err)
 		return
 	}
 
+	IdentifyServices(host, openPorts, nil)
 	DisplayOpenPorts(openPorts)
 }
@@ -1,16 +1,16 @@
-package network
+// Package roundrobin cycles through a set of items, such as proxies or API keys.
+package roundrobin
 
 import (
+	"crypto/rand"
 	"errors"
 	"sync"
 
-	"ghostshell/ghostshell/oqs"
-
 	"go.uber.org/zap"
 )
 
 // RoundRobin manages a set of items and provides a way to cycle through them sequentially.
-type RoundRobin[T any] struct {
+type RoundRobin[T comparable] struct {
 	items         []T
 	index         int
 	mutex         sync.Mutex
@@ -18,15 +18,18 @@ type RoundRobin[T any] struct {
 	encryptionKey []byte
 }
 
-// NewRoundRobin creates a new RoundRobin instance with post-quantum security features.
-func NewRoundRobin[T any](items []T, logger *zap.Logger) (*RoundRobin[T], error) {
+// New creates a new RoundRobin instance. A nil logger disables logging.
+func New[T comparable](items []T, logger *zap.Logger) (*RoundRobin[T], error) {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
 	if len(items) == 0 {
 		logger.Error("Attempted to initialize RoundRobin with an empty item list")
 		return nil, errors.New("items list cannot be empty")
 	}
 
 	// Generate an encryption key for secure operations
-	encryptionKey, err := oqs.GenerateRandomBytes(32)
+	encryptionKey, err := generateKey()
 	if err != nil {
 		logger.Error("Failed to generate encryption key for RoundRobin", zap.Error(err))
 		return nil, err
@@ -70,6 +73,10 @@ func (r *RoundRobin[T]) Remove(item T) error {
 	for i, v := range r.items {
 		if v == item {
 			r.items = append(r.items[:i], r.items[i+1:]...)
+			// Items after the removed one shift down, so the cursor follows them
+			if i < r.index {
+				r.index--
+			}
 			if r.index >= len(r.items) {
 				r.index = 0
 			}
@@ -101,7 +108,7 @@ func (r *RoundRobin[T]) Reset() {
 	r.index = 0
 
 	// Rotate the encryption key for added security
-	newKey, err := oqs.GenerateRandomBytes(32)
+	newKey, err := generateKey()
 	if err != nil {
 		r.logger.Error("Failed to rotate encryption key during Reset", zap.Error(err))
 		return
@@ -110,3 +117,12 @@ func (r *RoundRobin[T]) Reset() {
 
 	r.logger.Info("Reset RoundRobin, all items cleared and encryption key rotated")
 }
+
+// generateKey returns a fresh 32-byte key from crypto/rand
+func generateKey() ([]byte, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
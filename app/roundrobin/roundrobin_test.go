@@ -0,0 +1,33 @@
+package roundrobin
+
+import "testing"
+
+func TestRemoveKeepsOrder(t *testing.T) {
+	r, err := New([]string{"a", "b", "c", "d"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Next() // a
+	r.Next() // b
+
+	// Removing an item before the cursor must not skip c
+	if err := r.Remove("a"); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"c", "d", "b", "c"} {
+		if got := r.Next(); got != want {
+			t.Fatalf("Next() = %s, want %s", got, want)
+		}
+	}
+
+	// Removing the last item wraps the cursor to the start
+	if err := r.Remove("d"); err != nil {
+		t.Fatal(err)
+	}
+	if got := r.Next(); got != "b" {
+		t.Errorf("Next() = %s, want b", got)
+	}
+	if err := r.Remove("x"); err == nil {
+		t.Error("expected an error removing an unknown item")
+	}
+}
@@ -6,6 +6,7 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"os"
 	"os/exec"
@@ -26,6 +27,9 @@ import (
 	"github.com/gcla/termshark/v2/pkg/confwatcher"
 	"github.com/gcla/termshark/v2/pkg/convs"
 	"github.com/gcla/termshark/v2/pkg/fields"
+	"github.com/gcla/termshark/v2/pkg/iostats"
+	"github.com/gcla/termshark/v2/pkg/native"
+	"github.com/gcla/termshark/v2/pkg/objects"
 	"github.com/gcla/termshark/v2/pkg/pcap"
 	"github.com/gcla/termshark/v2/pkg/shark"
 	"github.com/gcla/termshark/v2/pkg/streams"
@@ -62,6 +66,7 @@ func main() {
 	streams.Goroutinewg = &ensureGoroutinesStopWG
 	capinfo.Goroutinewg = &ensureGoroutinesStopWG
 	convs.Goroutinewg = &ensureGoroutinesStopWG
+	iostats.Goroutinewg = &ensureGoroutinesStopWG
 	ui.Goroutinewg = &ensureGoroutinesStopWG
 	wormhole.Goroutinewg = &ensureGoroutinesStopWG
 	summary.Goroutinewg = &ensureGoroutinesStopWG
@@ -180,6 +185,11 @@ func cmain() int {
 		}
 	}
 
+	// Exporting objects never runs tshark, even if stdout is not a tty
+	if tsopts.ExportObjects != "" {
+		passthru = false
+	}
+
 	// On Windows, termshark itself is used to tail the pcap generated by dumpcap, and the output
 	// is fed into tshark -T psml ...
 	if tsopts.TailFileValue() != "" {
@@ -303,6 +313,37 @@ func cmain() int {
 		return res
 	}
 
+	// Save the files found in a pcap without starting the UI. Objects are found by reading the
+	// pcap natively, so tshark is not needed.
+	if opts.ExportObjects != "" {
+		pcapf := string(opts.Pcap)
+		if pcapf == "" {
+			pcapf = opts.Args.FilterOrPcap
+		}
+		if pcapf == "" || pcapf == "-" {
+			fmt.Fprintf(os.Stderr, "Please supply a pcap file from which to export objects.\n")
+			return 1
+		}
+		objs, err := objects.Extract(context.Background(), pcapf)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Could not export objects from %s: %v\n", pcapf, err)
+			return 1
+		}
+		paths, err := objects.Save(opts.ExportObjects, objs)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Could not save objects to %s: %v\n", opts.ExportObjects, err)
+			return 1
+		}
+		if err = objects.WriteTable(os.Stdout, objs); err != nil {
+			return 1
+		}
+		fmt.Println()
+		for i, path := range paths {
+			fmt.Printf("%s  %s\n", objs[i].SHA256, path)
+		}
+		return 0
+	}
+
 	usetty := opts.TtyValue()
 	if usetty != "" {
 		if ttyf, err := os.Open(usetty); err != nil {
@@ -579,59 +620,70 @@ func cmain() int {
 		}
 	}
 
+	// main.loader is one of "auto", "tshark" or "native". With "auto", the native
+	// loader is used only if there is no tshark to run.
+	loaderType := profiles.ConfString("main.loader", "auto")
 	tsharkBin, kverr := termshark.TSharkPath()
-	if kverr != nil {
+	if kverr != nil && loaderType == "tshark" {
 		fmt.Fprintf(os.Stderr, kverr.KeyVals["msg"].(string))
 		return 1
 	}
+	haveTshark := kverr == nil
+	useNative := loaderType == "native" || !haveTshark
+	termshark.NativeLoader = useNative
+	termshark.TSharkMissing = !haveTshark
 
-	// Here, tsharkBin is a fully-qualified tshark binary that exists on the fs (absent race
-	// conditions...)
+	if haveTshark {
+		// Here, tsharkBin is a fully-qualified tshark binary that exists on the fs (absent race
+		// conditions...)
 
-	valids := profiles.ConfStrings("main.validated-tsharks")
+		valids := profiles.ConfStrings("main.validated-tsharks")
 
-	if !termshark.StringInSlice(tsharkBin, valids) {
-		tver, err := termshark.TSharkVersion(tsharkBin)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Could not determine tshark version: %v\n", err)
-			return 1
-		}
-		// This is the earliest version I could determine gives reliable results in termshark.
-		// tshark compiled against tag v1.10.1 doesn't populate the hex view.
-		mver, _ := semver.Make("1.10.2")
-		if tver.LT(mver) {
-			fmt.Fprintf(os.Stderr, "termshark will not operate correctly with a tshark older than %v (found %v)\n", mver, tver)
-			return 1
-		}
+		if !termshark.StringInSlice(tsharkBin, valids) {
+			tver, err := termshark.TSharkVersion(tsharkBin)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Could not determine tshark version: %v\n", err)
+				return 1
+			}
+			// This is the earliest version I could determine gives reliable results in termshark.
+			// tshark compiled against tag v1.10.1 doesn't populate the hex view.
+			mver, _ := semver.Make("1.10.2")
+			if tver.LT(mver) {
+				fmt.Fprintf(os.Stderr, "termshark will not operate correctly with a tshark older than %v (found %v)\n", mver, tver)
+				return 1
+			}
 
-		valids = append(valids, tsharkBin)
-		profiles.SetConf("main.validated-tsharks", valids)
-	}
+			valids = append(valids, tsharkBin)
+			profiles.SetConf("main.validated-tsharks", valids)
+		}
 
-	// If the last tshark we used isn't the same as the current one, then remove the cached fields
-	// data structure so it can be regenerated.
-	if tsharkBin != profiles.ConfString("main.last-used-tshark", "") {
-		fields.DeleteCachedFields()
-	}
+		// If the last tshark we used isn't the same as the current one, then remove the cached fields
+		// data structure so it can be regenerated.
+		if tsharkBin != profiles.ConfString("main.last-used-tshark", "") {
+			fields.DeleteCachedFields()
+		}
 
-	// Write out the last-used tshark path. We do this to make the above fields cache be consistent
-	// with the tshark binary we're using.
-	profiles.SetConf("main.last-used-tshark", tsharkBin)
+		// Write out the last-used tshark path. We do this to make the above fields cache be consistent
+		// with the tshark binary we're using.
+		profiles.SetConf("main.last-used-tshark", tsharkBin)
 
-	// Determine if the current binary supports color. Tshark will fail with an error if it's too old
-	// and you supply the --color flag. Assume true, and check if our current binary is not in the
-	// validate list.
-	ui.PacketColorsSupported = true
-	colorTsharks := profiles.ConfStrings("main.color-tsharks")
+		// Determine if the current binary supports color. Tshark will fail with an error if it's too old
+		// and you supply the --color flag. Assume true, and check if our current binary is not in the
+		// validate list.
+		ui.PacketColorsSupported = true
+		colorTsharks := profiles.ConfStrings("main.color-tsharks")
 
-	if !termshark.StringInSlice(tsharkBin, colorTsharks) {
-		ui.PacketColorsSupported, err = termshark.TSharkSupportsColor(tsharkBin)
-		if err != nil {
-			ui.PacketColorsSupported = false
-		} else {
-			colorTsharks = append(colorTsharks, tsharkBin)
-			profiles.SetConf("main.color-tsharks", colorTsharks)
+		if !termshark.StringInSlice(tsharkBin, colorTsharks) {
+			ui.PacketColorsSupported, err = termshark.TSharkSupportsColor(tsharkBin)
+			if err != nil {
+				ui.PacketColorsSupported = false
+			} else {
+				colorTsharks = append(colorTsharks, tsharkBin)
+				profiles.SetConf("main.color-tsharks", colorTsharks)
+			}
 		}
+	} else {
+		log.Infof("No tshark found, loading packets with the native loader")
 	}
 
 	// If any of opts.Ifaces is provided as a number, it's meant as the index of the interfaces as
@@ -772,7 +824,10 @@ func cmain() int {
 		psmlArgs = append(psmlArgs, "-t", opts.TimestampFormat)
 	}
 	tsharkArgs := profiles.ConfStringSlice("main.tshark-args", []string{})
-	if ui.PacketColors && !ui.PacketColorsSupported {
+	if ui.PacketColors && useNative {
+		log.Infof("Packet coloring is not available with the native loader")
+		ui.PacketColors = false
+	} else if ui.PacketColors && !ui.PacketColorsSupported {
 		log.Warnf("Packet coloring is enabled, but %s does not support --color", tsharkBin)
 		ui.PacketColors = false
 	}
@@ -878,6 +933,19 @@ func cmain() int {
 	appRunner := app.Runner()
 
 	pcap.PcapCmds = pcap.MakeCommands(opts.DecodeAs, tsharkArgs, pdmlArgs, psmlArgs, ui.PacketColors)
+	if useNative {
+		// tshark, if present, still runs live captures and any display filter
+		// the native dissectors can't evaluate
+		var tsharkCmds pcap.ILoaderCmds
+		if haveTshark {
+			tsharkCmds = pcap.PcapCmds
+		}
+		nativeCmds := native.MakeCommands(tsharkCmds)
+		pcap.PcapCmds = nativeCmds
+		ui.CapinfoCmds = nativeCmds
+		ui.StreamCmds = nativeCmds
+		ui.StatsCmds = nativeCmds
+	}
 	pcap.PcapOpts = pcap.Options{
 		CacheSize:      cacheSize,
 		PacketsPerLoad: bundleSize,
@@ -1004,6 +1072,9 @@ func cmain() int {
 		if ui.StreamLoader != nil {
 			ui.StreamLoader.SuppressErrors = true
 		}
+		if ui.StatsLoader != nil {
+			ui.StatsLoader.SuppressErrors = true
+		}
 		ui.Loader.CloseMain()
 	}
 
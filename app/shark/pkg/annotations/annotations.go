@@ -0,0 +1,315 @@
+// Copyright 2019-2022 Graham Clark. All rights reserved.  Use of this source
+// code is governed by the MIT license that can be found in the LICENSE
+// file.
+
+// Package annotations keeps per-packet comments and named bookmarks for a
+// pcap in a sidecar file next to it, and writes them into a copy of the pcap
+// as pcapng packet comments so they travel with the capture.
+package annotations
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/gcla/termshark/v2/pkg/native"
+)
+
+//======================================================================
+
+// BookmarkPrefix marks a pcapng packet comment that holds a bookmark's
+// name rather than a free-form comment.
+const BookmarkPrefix = "bookmark: "
+
+// Bookmark is a named packet.
+type Bookmark struct {
+	Name   string `json:"name"`
+	Packet int    `json:"packet"`
+}
+
+// Annotations are the comments and bookmarks for one pcap. A pcapng's own
+// packet comments are read in when there is no sidecar file yet; from then
+// on the sidecar is the record, so comments deleted in termshark stay
+// deleted.
+type Annotations struct {
+	Comments  map[int]string `json:"comments"`
+	Bookmarks []Bookmark     `json:"bookmarks"`
+
+	pcap string
+}
+
+// SidecarPath is where the annotations for pcap are kept.
+func SidecarPath(pcap string) string {
+	return pcap + ".annotations.json"
+}
+
+func New(pcap string) *Annotations {
+	return &Annotations{
+		Comments:  make(map[int]string),
+		Bookmarks: make([]Bookmark, 0),
+		pcap:      pcap,
+	}
+}
+
+// Load returns the annotations for pcap from its sidecar file if there is
+// one, or else from the packet comments in pcap itself.
+func Load(ctx context.Context, pcap string) (*Annotations, error) {
+	res := New(pcap)
+	data, err := ioutil.ReadFile(SidecarPath(pcap))
+	switch {
+	case err == nil:
+		if err = json.Unmarshal(data, res); err != nil {
+			return nil, fmt.Errorf("Could not parse annotations for %s: %v", pcap, err)
+		}
+		if res.Comments == nil {
+			res.Comments = make(map[int]string)
+		}
+		res.sortBookmarks()
+		return res, nil
+	case !os.IsNotExist(err):
+		return nil, err
+	}
+
+	if err = res.readCapture(ctx); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// readCapture imports the packet comments of a pcapng file
+func (a *Annotations) readCapture(ctx context.Context) error {
+	capture, f, err := native.OpenCapture(a.pcap)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if capture.Format != "pcapng" {
+		return nil
+	}
+	for {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		frame, err := capture.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		comments := make([]string, 0, len(frame.Comments))
+		for _, comment := range frame.Comments {
+			if strings.HasPrefix(comment, BookmarkPrefix) {
+				a.Bookmarks = append(a.Bookmarks, Bookmark{
+					Name:   strings.TrimPrefix(comment, BookmarkPrefix),
+					Packet: frame.Number,
+				})
+			} else {
+				comments = append(comments, comment)
+			}
+		}
+		if len(comments) > 0 {
+			a.Comments[frame.Number] = strings.Join(comments, "\n")
+		}
+	}
+	a.sortBookmarks()
+	return nil
+}
+
+func (a *Annotations) Pcap() string {
+	return a.pcap
+}
+
+// Save writes the sidecar file.
+func (a *Annotations) Save() error {
+	data, err := json.MarshalIndent(a, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := SidecarPath(a.pcap)
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path))
+	if err != nil {
+		return fmt.Errorf("Could not save annotations for %s: %v", a.pcap, err)
+	}
+	_, err = tmp.Write(data)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("Could not save annotations for %s: %v", a.pcap, err)
+	}
+	return nil
+}
+
+//======================================================================
+
+// Comment returns the comment on packet, if there is one.
+func (a *Annotations) Comment(packet int) (string, bool) {
+	res, ok := a.Comments[packet]
+	return res, ok && res != ""
+}
+
+// SetComment replaces the comment on packet. An empty comment deletes it.
+func (a *Annotations) SetComment(packet int, comment string) {
+	if comment == "" {
+		delete(a.Comments, packet)
+	} else {
+		a.Comments[packet] = comment
+	}
+}
+
+// SetBookmark names packet, moving the bookmark if the name is in use.
+func (a *Annotations) SetBookmark(name string, packet int) {
+	a.RemoveBookmark(name)
+	a.Bookmarks = append(a.Bookmarks, Bookmark{Name: name, Packet: packet})
+	a.sortBookmarks()
+}
+
+// RemoveBookmark deletes the named bookmark and reports whether it existed.
+func (a *Annotations) RemoveBookmark(name string) bool {
+	for i, b := range a.Bookmarks {
+		if b.Name == name {
+			a.Bookmarks = append(a.Bookmarks[:i], a.Bookmarks[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Bookmark returns the named bookmark.
+func (a *Annotations) Bookmark(name string) (Bookmark, bool) {
+	for _, b := range a.Bookmarks {
+		if b.Name == name {
+			return b, true
+		}
+	}
+	return Bookmark{}, false
+}
+
+// Search returns the packets whose comment contains substr, ignoring case,
+// in packet order.
+func (a *Annotations) Search(substr string) []int {
+	substr = strings.ToLower(substr)
+	res := make([]int, 0)
+	for packet, comment := range a.Comments {
+		if comment != "" && strings.Contains(strings.ToLower(comment), substr) {
+			res = append(res, packet)
+		}
+	}
+	sort.Ints(res)
+	return res
+}
+
+// Packets returns every packet with a comment or bookmark, in order.
+func (a *Annotations) Packets() []int {
+	seen := make(map[int]bool)
+	res := make([]int, 0)
+	for packet, comment := range a.Comments {
+		if comment != "" && !seen[packet] {
+			seen[packet] = true
+			res = append(res, packet)
+		}
+	}
+	for _, b := range a.Bookmarks {
+		if !seen[b.Packet] {
+			seen[b.Packet] = true
+			res = append(res, b.Packet)
+		}
+	}
+	sort.Ints(res)
+	return res
+}
+
+// BookmarksFor returns the names of the bookmarks on packet.
+func (a *Annotations) BookmarksFor(packet int) []string {
+	res := make([]string, 0)
+	for _, b := range a.Bookmarks {
+		if b.Packet == packet {
+			res = append(res, b.Name)
+		}
+	}
+	return res
+}
+
+func (a *Annotations) sortBookmarks() {
+	sort.SliceStable(a.Bookmarks, func(i, j int) bool {
+		return a.Bookmarks[i].Packet < a.Bookmarks[j].Packet
+	})
+}
+
+// packetComments are the pcapng comments written for packet
+func (a *Annotations) packetComments(packet int) []string {
+	res := make([]string, 0)
+	if comment, ok := a.Comment(packet); ok {
+		res = append(res, comment)
+	}
+	for _, name := range a.BookmarksFor(packet) {
+		res = append(res, BookmarkPrefix+name)
+	}
+	return res
+}
+
+//======================================================================
+
+// WritePcapng copies the annotated pcap to path as pcapng, with the
+// comments and bookmarks as packet comments in place of any the pcap had.
+func (a *Annotations) WritePcapng(ctx context.Context, path string) error {
+	capture, in, err := native.OpenCapture(a.pcap)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	err = a.writePcapng(ctx, capture, out)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(path)
+		return fmt.Errorf("Could not write %s: %v", path, err)
+	}
+	return nil
+}
+
+func (a *Annotations) writePcapng(ctx context.Context, capture *native.Capture, out io.Writer) error {
+	w, err := native.NewNgWriter(out, capture.Comments)
+	if err != nil {
+		return err
+	}
+	for {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		frame, err := capture.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if err = w.WriteFrame(capture, frame, a.packetComments(frame.Number)); err != nil {
+			return err
+		}
+	}
+	return w.Flush()
+}
+
+//======================================================================
+// Local Variables:
+// mode: Go
+// fill-column: 78
+// End:
@@ -0,0 +1,128 @@
+// Copyright 2019-2022 Graham Clark. All rights reserved.  Use of this source
+// code is governed by the MIT license that can be found in the LICENSE
+// file.
+
+package annotations
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gcla/termshark/v2/pkg/native"
+	"github.com/google/gopacket/pcapgo"
+	"github.com/stretchr/testify/assert"
+)
+
+//======================================================================
+
+func copyPcap(t *testing.T, dir string) string {
+	data, err := ioutil.ReadFile(filepath.Join("..", "pcap", "testdata", "1.pcap"))
+	assert.NoError(t, err)
+	path := filepath.Join(dir, "1.pcap")
+	assert.NoError(t, ioutil.WriteFile(path, data, 0644))
+	return path
+}
+
+func TestEdit(t *testing.T) {
+	a := New("x.pcap")
+	a.SetComment(3, "Slow handshake")
+	a.SetComment(7, "retransmission here")
+	a.SetComment(9, "HANDSHAKE done")
+	a.SetComment(7, "")
+	_, ok := a.Comment(7)
+	assert.False(t, ok)
+	assert.Equal(t, []int{3, 9}, a.Search("handshake"))
+
+	a.SetBookmark("login", 12)
+	a.SetBookmark("start", 1)
+	a.SetBookmark("login", 5) // moved
+	assert.Equal(t, []Bookmark{{"start", 1}, {"login", 5}}, a.Bookmarks)
+	assert.Equal(t, []int{1, 3, 5, 9}, a.Packets())
+	assert.True(t, a.RemoveBookmark("start"))
+	assert.False(t, a.RemoveBookmark("start"))
+	b, ok := a.Bookmark("login")
+	assert.True(t, ok)
+	assert.Equal(t, 5, b.Packet)
+}
+
+func TestSidecar(t *testing.T) {
+	dir, err := ioutil.TempDir("", "termshark-annotations")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	pcap := copyPcap(t, dir)
+
+	a, err := Load(context.Background(), pcap)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(a.Packets()))
+
+	a.SetComment(2, "first reply")
+	a.SetBookmark("dns", 4)
+	assert.NoError(t, a.Save())
+
+	b, err := Load(context.Background(), pcap)
+	assert.NoError(t, err)
+	comment, ok := b.Comment(2)
+	assert.True(t, ok)
+	assert.Equal(t, "first reply", comment)
+	assert.Equal(t, []Bookmark{{"dns", 4}}, b.Bookmarks)
+}
+
+func TestWritePcapng(t *testing.T) {
+	dir, err := ioutil.TempDir("", "termshark-annotations")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	pcap := copyPcap(t, dir)
+
+	a := New(pcap)
+	a.SetComment(2, "first reply\nsecond line")
+	a.SetBookmark("dns", 2)
+	a.SetBookmark("end", 10)
+	out := filepath.Join(dir, "annotated.pcapng")
+	assert.NoError(t, a.WritePcapng(context.Background(), out))
+
+	// The packets themselves are unchanged
+	orig, f1, err := native.OpenCapture(pcap)
+	assert.NoError(t, err)
+	defer f1.Close()
+	f2, err := os.Open(out)
+	assert.NoError(t, err)
+	defer f2.Close()
+	ng, err := pcapgo.NewNgReader(f2, pcapgo.DefaultNgReaderOptions)
+	assert.NoError(t, err)
+	n := 0
+	for {
+		frame, err := orig.Next()
+		if err == io.EOF {
+			break
+		}
+		assert.NoError(t, err)
+		data, ci, err := ng.ReadPacketData()
+		assert.NoError(t, err)
+		assert.Equal(t, frame.Data, data)
+		assert.Equal(t, frame.Timestamp.UnixNano(), ci.Timestamp.UnixNano())
+		assert.Equal(t, frame.Length, ci.Length)
+		n++
+	}
+	_, _, err = ng.ReadPacketData()
+	assert.Equal(t, io.EOF, err)
+	assert.True(t, n > 10)
+
+	// With no sidecar, the comments are read from the pcapng
+	b, err := Load(context.Background(), out)
+	assert.NoError(t, err)
+	comment, ok := b.Comment(2)
+	assert.True(t, ok)
+	assert.Equal(t, "first reply\nsecond line", comment)
+	assert.Equal(t, []Bookmark{{"dns", 2}, {"end", 10}}, b.Bookmarks)
+	assert.Equal(t, []int{2, 10}, b.Packets())
+}
+
+//======================================================================
+// Local Variables:
+// mode: Go
+// fill-column: 78
+// End:
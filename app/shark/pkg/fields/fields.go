@@ -14,6 +14,7 @@ import (
 	"sync"
 
 	"github.com/gcla/termshark/v2"
+	"github.com/gcla/termshark/v2/pkg/native"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -172,6 +173,13 @@ func DeleteCachedFields() error {
 // Can be run asynchronously.
 // This ought to use interfaces to make it testable.
 func (w *TSharkFields) Init() error {
+	if termshark.TSharkMissing {
+		// Not cached - the list would hide tshark's once it is installed
+		w.InitNative()
+		log.Infof("No tshark - completing the fields the native dissectors know.")
+		return nil
+	}
+
 	newer, err := termshark.FileNewerThan(termshark.CacheFile("tsharkfieldsv3.gob.gz"), termshark.DirOfPathCommandUnsafe(termshark.TSharkBin()))
 	if err == nil && newer {
 		f := &FieldsAndProtos{
@@ -255,6 +263,42 @@ func (w *TSharkFields) InitNoCache() error {
 	return nil
 }
 
+// InitNative fills in the protocols and fields the native dissectors produce,
+// for when there is no tshark to list them all.
+func (w *TSharkFields) InitNative() {
+	fieldsMap := make(map[string]interface{})
+	protMap := make(map[string]struct{})
+
+	for _, name := range native.FieldNames() {
+		protos := strings.Split(name, ".")
+		if len(protos) == 1 {
+			protMap[name] = struct{}{}
+			continue
+		}
+		cur := fieldsMap
+		for i := 0; i < len(protos)-1; i++ {
+			next, ok := cur[protos[i]].(map[string]interface{})
+			if !ok {
+				// A field with subfields e.g. ip.dsfield and ip.dsfield.dscp - keep the subfields
+				next = make(map[string]interface{})
+				cur[protos[i]] = next
+			}
+			cur = next
+		}
+		if _, ok := cur[protos[len(protos)-1]]; !ok {
+			cur[protos[len(protos)-1]] = Field{
+				Name: name,
+				Type: FT_NONE,
+			}
+		}
+	}
+
+	w.ser = &FieldsAndProtos{
+		Fields:    fieldsMap,
+		Protocols: protMap,
+	}
+}
+
 func dedup(s []string) []string {
 	if len(s) == 0 {
 		return s
@@ -27,6 +27,23 @@ func TestFields1(t *testing.T) {
 	assert.Equal(t, m2.(Field).Type, FT_UINT16)
 }
 
+func TestFieldsNative(t *testing.T) {
+
+	fields := New()
+	fields.InitNative()
+
+	_, ok := fields.ser.Protocols["tcp"]
+	assert.Equal(t, true, ok)
+
+	found, field := fields.LookupField("tcp.port")
+	assert.Equal(t, true, found)
+	assert.Equal(t, "tcp.port", field.Name)
+
+	// ip.dsfield has subfields, so it is kept as a map
+	found, _ = fields.LookupField("ip.dsfield.dscp")
+	assert.Equal(t, true, found)
+}
+
 //======================================================================
 // Local Variables:
 // mode: Go
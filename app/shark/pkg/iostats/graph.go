@@ -0,0 +1,293 @@
+// Copyright 2019-2022 Graham Clark. All rights reserved.  Use of this source
+// code is governed by the MIT license that can be found in the LICENSE
+// file.
+
+// Package iostats computes traffic statistics from PSML - an I/O graph of
+// packets and bytes over time, and a protocol hierarchy.
+package iostats
+
+import (
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//======================================================================
+
+// The names of the PSML columns the statistics are read from
+const (
+	NumberColumn    = "No."
+	TimeColumn      = "Time"
+	LengthColumn    = "Length"
+	ProtocolsColumn = "Protocols"
+)
+
+// Sample is what the statistics need to know about one packet.
+type Sample struct {
+	Number    int
+	Time      float64 // seconds since the first packet of the capture
+	Length    int
+	Protocols []string // outermost first e.g. eth, ethertype, ip, tcp
+}
+
+// ReadPsml calls fn for each packet in a PSML document with the columns
+// NumberColumn, TimeColumn, LengthColumn and ProtocolsColumn, found by
+// name. It stops at the first error fn returns.
+func ReadPsml(r io.Reader, fn func(Sample) error) error {
+	d := xml.NewDecoder(r)
+	cols := map[string]int{}
+	headers := make([]string, 0, 4)
+	values := make([]string, 0, 4)
+	inStructure := false
+	inPacket := false
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("Could not parse PSML: %v", err)
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "structure":
+				inStructure = true
+			case "packet":
+				inPacket = true
+				values = values[:0]
+			case "section":
+				var text string
+				if err := d.DecodeElement(&text, &t); err != nil {
+					return fmt.Errorf("Could not parse PSML: %v", err)
+				}
+				if inStructure {
+					headers = append(headers, text)
+				} else if inPacket {
+					values = append(values, text)
+				}
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "structure":
+				inStructure = false
+				for i, h := range headers {
+					cols[h] = i
+				}
+				for _, h := range []string{NumberColumn, TimeColumn, LengthColumn, ProtocolsColumn} {
+					if _, ok := cols[h]; !ok {
+						return fmt.Errorf("PSML has no %s column", h)
+					}
+				}
+			case "packet":
+				inPacket = false
+				s, err := parseSample(cols, values)
+				if err != nil {
+					return err
+				}
+				if err = fn(s); err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
+
+func parseSample(cols map[string]int, values []string) (Sample, error) {
+	if len(values) < len(cols) {
+		return Sample{}, fmt.Errorf("PSML packet has %d columns, expected %d", len(values), len(cols))
+	}
+	number, err := strconv.Atoi(values[cols[NumberColumn]])
+	if err != nil {
+		return Sample{}, fmt.Errorf("Could not parse packet number '%s'", values[cols[NumberColumn]])
+	}
+	tm, err := strconv.ParseFloat(values[cols[TimeColumn]], 64)
+	if err != nil {
+		return Sample{}, fmt.Errorf("Could not parse time '%s' of packet %d", values[cols[TimeColumn]], number)
+	}
+	length, err := strconv.Atoi(values[cols[LengthColumn]])
+	if err != nil {
+		return Sample{}, fmt.Errorf("Could not parse length '%s' of packet %d", values[cols[LengthColumn]], number)
+	}
+	var protos []string
+	if p := values[cols[ProtocolsColumn]]; p != "" {
+		protos = strings.Split(p, ":")
+	}
+	return Sample{
+		Number:    number,
+		Time:      tm,
+		Length:    length,
+		Protocols: protos,
+	}, nil
+}
+
+//======================================================================
+
+// Series counts the packets and bytes passing one display filter in each
+// interval.
+type Series struct {
+	Filter  string
+	Packets []int
+	Bytes   []int
+}
+
+// Name is the series' display filter, or a description if there is none.
+func (s *Series) Name() string {
+	if s.Filter == "" {
+		return "All packets"
+	}
+	return s.Filter
+}
+
+// Graph is an I/O graph - packets and bytes per interval, for one or more
+// display filters. Each series covers the same intervals, starting with
+// the first packet of the capture.
+type Graph struct {
+	Interval time.Duration
+	Series   []*Series
+}
+
+func NewGraph(interval time.Duration, filters ...string) *Graph {
+	res := &Graph{
+		Interval: interval,
+		Series:   make([]*Series, 0, len(filters)),
+	}
+	for _, filter := range filters {
+		res.Series = append(res.Series, &Series{Filter: filter})
+	}
+	return res
+}
+
+// Add counts s in the given series.
+func (g *Graph) Add(series int, s Sample) {
+	i := 0
+	if s.Time > 0 && g.Interval > 0 {
+		i = int(s.Time / g.Interval.Seconds())
+	}
+	ser := g.Series[series]
+	for len(ser.Packets) <= i {
+		ser.Packets = append(ser.Packets, 0)
+		ser.Bytes = append(ser.Bytes, 0)
+	}
+	ser.Packets[i]++
+	ser.Bytes[i] += s.Length
+}
+
+// Intervals is the number of intervals up to the last packet of any series.
+func (g *Graph) Intervals() int {
+	res := 0
+	for _, ser := range g.Series {
+		if len(ser.Packets) > res {
+			res = len(ser.Packets)
+		}
+	}
+	return res
+}
+
+// Values returns a series' packets or bytes for every interval of the graph.
+func (g *Graph) Values(series int, bytes bool) []int {
+	res := make([]int, g.Intervals())
+	src := g.Series[series].Packets
+	if bytes {
+		src = g.Series[series].Bytes
+	}
+	copy(res, src)
+	return res
+}
+
+// WriteCSV writes one row per interval, with its start time in seconds and
+// the packets and bytes of each series.
+func (g *Graph) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	header := []string{"Interval start"}
+	for _, ser := range g.Series {
+		header = append(header, ser.Name()+" packets", ser.Name()+" bytes")
+	}
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+	values := make([][2][]int, len(g.Series))
+	for i := range g.Series {
+		values[i] = [2][]int{g.Values(i, false), g.Values(i, true)}
+	}
+	for i := 0; i < g.Intervals(); i++ {
+		row := []string{strconv.FormatFloat(float64(i)*g.Interval.Seconds(), 'f', -1, 64)}
+		for _, v := range values {
+			row = append(row, strconv.Itoa(v[0][i]), strconv.Itoa(v[1][i]))
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+//======================================================================
+
+var bars = []rune(" ▁▂▃▄▅▆▇█")
+
+// Rebin sums each run of factor values, so a long series fits in fewer
+// columns.
+func Rebin(values []int, factor int) []int {
+	if factor <= 1 {
+		return values
+	}
+	res := make([]int, (len(values)+factor-1)/factor)
+	for i, v := range values {
+		res[i/factor] += v
+	}
+	return res
+}
+
+// BarChart draws values as a bar chart height rows tall, one column per
+// value, scaled so the largest fills the chart. The rows are returned top
+// first. Non-zero values always show.
+func BarChart(values []int, height int) []string {
+	max := 0
+	for _, v := range values {
+		if v > max {
+			max = v
+		}
+	}
+	rows := make([][]rune, height)
+	for r := range rows {
+		rows[r] = make([]rune, len(values))
+	}
+	steps := height * (len(bars) - 1)
+	for c, v := range values {
+		level := 0
+		if max > 0 && v > 0 {
+			level = (v*steps + max - 1) / max
+		}
+		for r := 0; r < height; r++ {
+			cell := level - r*(len(bars)-1)
+			if cell < 0 {
+				cell = 0
+			} else if cell > len(bars)-1 {
+				cell = len(bars) - 1
+			}
+			rows[height-1-r][c] = bars[cell]
+		}
+	}
+	res := make([]string, height)
+	for r := range rows {
+		res[r] = string(rows[r])
+	}
+	return res
+}
+
+// Sparkline draws values as a one-line bar chart.
+func Sparkline(values []int) string {
+	return BarChart(values, 1)[0]
+}
+
+//======================================================================
+// Local Variables:
+// mode: Go
+// fill-column: 78
+// End:
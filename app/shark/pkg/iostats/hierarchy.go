@@ -0,0 +1,109 @@
+// Copyright 2019-2022 Graham Clark. All rights reserved.  Use of this source
+// code is governed by the MIT license that can be found in the LICENSE
+// file.
+
+package iostats
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+//======================================================================
+
+// Node is one protocol of the hierarchy, counting the packets that contain
+// it under its parent. End packets are those in which it is the last
+// protocol.
+type Node struct {
+	Name       string
+	Packets    int
+	Bytes      int
+	EndPackets int
+	EndBytes   int
+	Children   []*Node
+}
+
+func (n *Node) child(name string) *Node {
+	for _, c := range n.Children {
+		if c.Name == name {
+			return c
+		}
+	}
+	res := &Node{Name: name}
+	n.Children = append(n.Children, res)
+	return res
+}
+
+// Hierarchy is a protocol hierarchy, as in Wireshark's Statistics menu. The
+// root is the frame protocol, so counts every packet.
+type Hierarchy struct {
+	Root *Node
+}
+
+func NewHierarchy() *Hierarchy {
+	return &Hierarchy{
+		Root: &Node{Name: "frame"},
+	}
+}
+
+// Add counts s under each protocol in its frame.protocols.
+func (h *Hierarchy) Add(s Sample) {
+	protos := s.Protocols
+	if len(protos) > 0 && protos[0] == h.Root.Name {
+		protos = protos[1:]
+	}
+	node := h.Root
+	node.Packets++
+	node.Bytes += s.Length
+	for _, proto := range protos {
+		node = node.child(proto)
+		node.Packets++
+		node.Bytes += s.Length
+	}
+	node.EndPackets++
+	node.EndBytes += s.Length
+}
+
+// Walk calls fn for each node, parents before children, with its depth
+// below the root.
+func (h *Hierarchy) Walk(fn func(n *Node, depth int)) {
+	var walk func(n *Node, depth int)
+	walk = func(n *Node, depth int) {
+		fn(n, depth)
+		for _, c := range n.Children {
+			walk(c, depth+1)
+		}
+	}
+	walk(h.Root, 0)
+}
+
+func percent(part, total int) string {
+	if total == 0 {
+		return "0.0"
+	}
+	return fmt.Sprintf("%.1f", float64(part)*100/float64(total))
+}
+
+// WriteTable writes the hierarchy as an indented table, with each protocol's
+// share of all the packets and bytes.
+func (h *Hierarchy) WriteTable(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "Protocol\t% Packets\tPackets\t% Bytes\tBytes\tEnd Packets\tEnd Bytes\t")
+	h.Walk(func(n *Node, depth int) {
+		fmt.Fprintf(tw, "%s%s\t%s\t%d\t%s\t%d\t%d\t%d\t\n",
+			strings.Repeat("  ", depth), n.Name,
+			percent(n.Packets, h.Root.Packets), n.Packets,
+			percent(n.Bytes, h.Root.Bytes), n.Bytes,
+			n.EndPackets, n.EndBytes,
+		)
+	})
+	return tw.Flush()
+}
+
+//======================================================================
+// Local Variables:
+// mode: Go
+// fill-column: 78
+// End:
@@ -0,0 +1,147 @@
+// Copyright 2019-2022 Graham Clark. All rights reserved.  Use of this source
+// code is governed by the MIT license that can be found in the LICENSE
+// file.
+
+package iostats
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+//======================================================================
+
+var psml = `<?xml version="1.0" encoding="utf-8"?>
+<psml version="0" creator="wireshark/3.4.8">
+<structure>
+<section>No.</section>
+<section>Time</section>
+<section>Length</section>
+<section>Protocols</section>
+</structure>
+
+<packet>
+<section>1</section>
+<section>0.000000000</section>
+<section>74</section>
+<section>eth:ethertype:ip:tcp</section>
+</packet>
+
+<packet>
+<section>2</section>
+<section>0.400000000</section>
+<section>200</section>
+<section>eth:ethertype:ip:tcp:http</section>
+</packet>
+
+<packet>
+<section>3</section>
+<section>2.100000000</section>
+<section>90</section>
+<section>eth:ethertype:ip:udp:dns</section>
+</packet>
+
+</psml>
+`
+
+func readSamples(t *testing.T) []Sample {
+	res := make([]Sample, 0)
+	err := ReadPsml(strings.NewReader(psml), func(s Sample) error {
+		res = append(res, s)
+		return nil
+	})
+	assert.NoError(t, err)
+	return res
+}
+
+func TestReadPsml(t *testing.T) {
+	samples := readSamples(t)
+	assert.Equal(t, 3, len(samples))
+	assert.Equal(t, Sample{
+		Number:    2,
+		Time:      0.4,
+		Length:    200,
+		Protocols: []string{"eth", "ethertype", "ip", "tcp", "http"},
+	}, samples[1])
+
+	err := ReadPsml(strings.NewReader("<psml><structure><section>No.</section></structure></psml>"), func(Sample) error {
+		return nil
+	})
+	assert.Error(t, err)
+}
+
+func TestGraph(t *testing.T) {
+	samples := readSamples(t)
+	g := NewGraph(time.Second, "", "udp")
+	for _, s := range samples {
+		g.Add(0, s)
+	}
+	g.Add(1, samples[2])
+
+	assert.Equal(t, 3, g.Intervals())
+	assert.Equal(t, []int{2, 0, 1}, g.Values(0, false))
+	assert.Equal(t, []int{274, 0, 90}, g.Values(0, true))
+	assert.Equal(t, []int{0, 0, 1}, g.Values(1, false))
+
+	var out bytes.Buffer
+	assert.NoError(t, g.WriteCSV(&out))
+	assert.Equal(t, `Interval start,All packets packets,All packets bytes,udp packets,udp bytes
+0,2,274,0,0
+1,0,0,0,0
+2,1,90,1,90
+`, out.String())
+
+	g = NewGraph(500*time.Millisecond, "")
+	for _, s := range samples {
+		g.Add(0, s)
+	}
+	assert.Equal(t, []int{2, 0, 0, 0, 1}, g.Values(0, false))
+}
+
+func TestCharts(t *testing.T) {
+	assert.Equal(t, []int{3, 7, 5}, Rebin([]int{1, 2, 3, 4, 5}, 2))
+	assert.Equal(t, []int{1, 2}, Rebin([]int{1, 2}, 1))
+
+	assert.Equal(t, " ▁▄█", Sparkline([]int{0, 1, 4, 8}))
+	assert.Equal(t, []string{
+		"   █",
+		" ▄██",
+	}, BarChart([]int{0, 1, 2, 4}, 2))
+}
+
+func TestHierarchy(t *testing.T) {
+	h := NewHierarchy()
+	for _, s := range readSamples(t) {
+		h.Add(s)
+	}
+	assert.Equal(t, 3, h.Root.Packets)
+	assert.Equal(t, 364, h.Root.Bytes)
+
+	names := make([]string, 0)
+	h.Walk(func(n *Node, depth int) {
+		names = append(names, strings.Repeat(" ", depth)+n.Name)
+	})
+	assert.Equal(t, []string{"frame", " eth", "  ethertype", "   ip", "    tcp", "     http", "    udp", "     dns"}, names)
+
+	tcp := h.Root.Children[0].Children[0].Children[0].Children[0]
+	assert.Equal(t, "tcp", tcp.Name)
+	assert.Equal(t, 2, tcp.Packets)
+	assert.Equal(t, 1, tcp.EndPackets)
+	assert.Equal(t, 74, tcp.EndBytes)
+
+	var out bytes.Buffer
+	assert.NoError(t, h.WriteTable(&out))
+	lines := strings.Split(out.String(), "\n")
+	assert.Equal(t, "Protocol", strings.Fields(lines[0])[0])
+	assert.Equal(t, []string{"tcp", "66.7", "2", "75.3", "274", "1", "74"}, strings.Fields(lines[5]))
+}
+
+//======================================================================
+// Local Variables:
+// mode: Go
+// fill-column: 78
+// End:
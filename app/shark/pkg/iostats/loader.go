@@ -0,0 +1,212 @@
+// Copyright 2019-2022 Graham Clark. All rights reserved.  Use of this source
+// code is governed by the MIT license that can be found in the LICENSE
+// file.
+
+package iostats
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gcla/gowid"
+	"github.com/gcla/termshark/v2"
+	"github.com/gcla/termshark/v2/pkg/pcap"
+	"github.com/gcla/termshark/v2/pkg/shark"
+	log "github.com/sirupsen/logrus"
+)
+
+//======================================================================
+
+var Goroutinewg *sync.WaitGroup
+
+// Columns are the PSML columns the statistics are computed from. The
+// frame number comes first, ahead of these, as in the packet list.
+var Columns = []shark.PsmlColumnSpec{
+	shark.PsmlColumnSpec{Field: shark.PsmlField{Token: "%Cus", Filter: "frame.time_relative"}, Name: TimeColumn},
+	shark.PsmlColumnSpec{Field: shark.PsmlField{Token: "%L"}, Name: LengthColumn},
+	shark.PsmlColumnSpec{Field: shark.PsmlField{Token: "%Cus", Filter: "frame.protocols"}, Name: ProtocolsColumn},
+}
+
+//======================================================================
+
+type ILoaderCmds interface {
+	Stats(pcap string, displayFilter string) pcap.IPcapCommand
+}
+
+type commands struct{}
+
+func MakeCommands() commands {
+	return commands{}
+}
+
+var _ ILoaderCmds = commands{}
+
+func (c commands) Stats(pcapfile string, displayFilter string) pcap.IPcapCommand {
+	specs := make([]string, 0, len(Columns))
+	for _, col := range Columns {
+		specs = append(specs, fmt.Sprintf("\"%s\",\"%s\"", col.Name, col.Field))
+	}
+	args := []string{
+		"-r", pcapfile,
+		"-T", "psml",
+		"-o", fmt.Sprintf("gui.column.format:\"%s\",\"%%m\",%s", NumberColumn, strings.Join(specs, ",")),
+	}
+	if displayFilter != "" {
+		args = append(args, "-Y", displayFilter)
+	}
+	return &pcap.Command{
+		Cmd: exec.Command(termshark.TSharkBin(), args...),
+	}
+}
+
+//======================================================================
+
+type Loader struct {
+	cmds ILoaderCmds
+
+	SuppressErrors bool // if true, don't report process errors e.g. at shutdown
+
+	mainCtx      context.Context // cancelling this cancels the dependent contexts
+	mainCancelFn context.CancelFunc
+
+	statsCtx      context.Context
+	statsCancelFn context.CancelFunc
+}
+
+func NewLoader(cmds ILoaderCmds, ctx context.Context) *Loader {
+	res := &Loader{
+		cmds: cmds,
+	}
+	res.mainCtx, res.mainCancelFn = context.WithCancel(ctx)
+	return res
+}
+
+func (c *Loader) StopLoad() {
+	if c.statsCancelFn != nil {
+		c.statsCancelFn()
+	}
+}
+
+//======================================================================
+
+type IStatsCallbacks interface {
+	OnStatsData(graph *Graph, hierarchy *Hierarchy)
+	AfterStatsEnd(success bool)
+}
+
+// StartLoad computes an I/O graph of pcap with one series per display filter,
+// and the protocol hierarchy of the packets passing the first filter.
+func (c *Loader) StartLoad(pcap string, filters []string, interval time.Duration, app gowid.IApp, cb IStatsCallbacks) {
+	termshark.TrackedGo(func() {
+		c.loadStatsAsync(pcap, filters, interval, app, cb)
+	}, Goroutinewg)
+}
+
+func (c *Loader) loadStatsAsync(pcapf string, filters []string, interval time.Duration, app gowid.IApp, cb IStatsCallbacks) {
+	c.statsCtx, c.statsCancelFn = context.WithCancel(c.mainCtx)
+	defer c.statsCancelFn()
+
+	success := false
+	defer func() {
+		cb.AfterStatsEnd(success)
+	}()
+
+	app.Run(gowid.RunFunction(func(app gowid.IApp) {
+		pcap.HandleBegin(pcap.StatsCode, app, cb)
+	}))
+	defer func() {
+		app.Run(gowid.RunFunction(func(app gowid.IApp) {
+			pcap.HandleEnd(pcap.StatsCode, app, cb)
+		}))
+	}()
+
+	graph := NewGraph(interval, filters...)
+	hierarchy := NewHierarchy()
+
+	for i, filter := range filters {
+		series := i
+		err := c.runStats(pcapf, filter, func(s Sample) {
+			graph.Add(series, s)
+			if series == 0 {
+				hierarchy.Add(s)
+			}
+		})
+		if c.statsCtx.Err() != nil {
+			return
+		}
+		if err != nil {
+			pcap.HandleError(pcap.StatsCode, app, err, cb)
+			return
+		}
+	}
+
+	success = true
+	cb.OnStatsData(graph, hierarchy)
+}
+
+// runStats runs the command for one display filter to completion, passing
+// each packet to fn. The process is killed if the load is stopped.
+func (c *Loader) runStats(pcapf string, filter string, fn func(Sample)) error {
+	cmd := c.cmds.Stats(pcapf, filter)
+
+	statsOut, err := cmd.StdoutReader()
+	if err != nil {
+		return err
+	}
+
+	err = cmd.Start()
+	if err != nil {
+		return fmt.Errorf("Error starting %v: %v", cmd, err)
+	}
+
+	log.Infof("Started command %v with pid %d", cmd, cmd.Pid())
+
+	termChan := make(chan error, 1)
+	termshark.TrackedGo(func() {
+		termChan <- cmd.Wait()
+	}, Goroutinewg)
+
+	readErr := ReadPsml(statsOut, func(s Sample) error {
+		fn(s)
+		return c.statsCtx.Err()
+	})
+	if readErr != nil {
+		if kerr := termshark.KillIfPossible(cmd); kerr != nil {
+			log.Infof("Did not kill stats process: %v", kerr)
+		}
+	}
+
+	var waitErr error
+	select {
+	case waitErr = <-termChan:
+	case <-c.statsCtx.Done():
+		if kerr := termshark.KillIfPossible(cmd); kerr != nil {
+			log.Infof("Did not kill stats process: %v", kerr)
+		}
+		return c.statsCtx.Err()
+	}
+
+	if readErr != nil {
+		return readErr
+	}
+	if waitErr != nil {
+		if _, ok := waitErr.(*exec.ExitError); ok {
+			if c.SuppressErrors {
+				return nil
+			}
+			return pcap.MakeUsefulError(cmd, waitErr)
+		}
+		return waitErr
+	}
+	return nil
+}
+
+//======================================================================
+// Local Variables:
+// mode: Go
+// fill-column: 78
+// End:
@@ -0,0 +1,574 @@
+// Copyright 2019-2022 Graham Clark. All rights reserved.  Use of this source
+// code is governed by the MIT license that can be found in the LICENSE
+// file.
+
+package native
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+//======================================================================
+// DNS
+
+var dnsOpcodes = map[layers.DNSOpCode]string{
+	layers.DNSOpCodeQuery:  "Standard query",
+	layers.DNSOpCodeIQuery: "Inverse query",
+	layers.DNSOpCodeStatus: "Server status request",
+	layers.DNSOpCodeNotify: "Zone change notification",
+	layers.DNSOpCodeUpdate: "Dynamic update",
+}
+
+// dissectDNS decodes a DNS message, returning false if payload is not one
+func dissectDNS(p *Packet, payload []byte, off int) bool {
+	var msg layers.DNS
+	if err := msg.DecodeFromBytes(payload, gopacket.NilDecodeFeedback); err != nil {
+		return false
+	}
+	op, ok := dnsOpcodes[msg.OpCode]
+	if !ok {
+		op = fmt.Sprintf("Unknown operation (%d)", msg.OpCode)
+	}
+	id := hex16(msg.ID)
+	direction := "query"
+	if msg.QR {
+		direction = "response"
+	}
+
+	dns := p.proto("dns", off, len(payload), fmt.Sprintf("Domain Name System (%s)", direction))
+	dns.add("dns.id", off, 2, id, "Transaction ID: "+id)
+	flagBits := uint16(payload[2])<<8 | uint16(payload[3])
+	flags := dns.add("dns.flags", off+2, 2, hex16(flagBits), fmt.Sprintf("Flags: %s %s", hex16(flagBits), op))
+	flags.add("dns.flags.response", off+2, 1, strconv.Itoa(btoi(msg.QR)), fmt.Sprintf("Response: Message is a %s", direction))
+	flags.add("dns.flags.opcode", off+2, 1, strconv.Itoa(int(msg.OpCode)), fmt.Sprintf("Opcode: %s (%d)", op, msg.OpCode))
+	if msg.QR {
+		flags.add("dns.flags.rcode", off+3, 1, strconv.Itoa(int(msg.ResponseCode)), fmt.Sprintf("Reply code: %s (%d)", msg.ResponseCode, msg.ResponseCode))
+	}
+	dns.add("dns.count.queries", off+4, 2, strconv.Itoa(int(msg.QDCount)), fmt.Sprintf("Questions: %d", msg.QDCount))
+	dns.add("dns.count.answers", off+6, 2, strconv.Itoa(int(msg.ANCount)), fmt.Sprintf("Answer RRs: %d", msg.ANCount))
+	dns.add("dns.count.auth_rr", off+8, 2, strconv.Itoa(int(msg.NSCount)), fmt.Sprintf("Authority RRs: %d", msg.NSCount))
+	dns.add("dns.count.add_rr", off+10, 2, strconv.Itoa(int(msg.ARCount)), fmt.Sprintf("Additional RRs: %d", msg.ARCount))
+
+	info := []string{op}
+	if msg.QR {
+		info = append(info, "response")
+	}
+	info = append(info, id)
+	if msg.QR && msg.ResponseCode != layers.DNSResponseCodeNoErr {
+		info = append(info, msg.ResponseCode.String())
+	}
+
+	if len(msg.Questions) > 0 {
+		queries := dns.add("", off+12, 0, "Queries", "Queries")
+		for _, q := range msg.Questions {
+			name := dnsName(q.Name)
+			query := queries.add("", off+12, 0, name, fmt.Sprintf("%s: type %s, class %s", name, q.Type, q.Class))
+			query.add("dns.qry.name", off+12, 0, name, "Name: "+name)
+			query.add("dns.qry.type", off+12, 0, strconv.Itoa(int(q.Type)), fmt.Sprintf("Type: %s (%d)", q.Type, q.Type))
+			query.add("dns.qry.class", off+12, 0, hex16(uint16(q.Class)), fmt.Sprintf("Class: %s (%s)", q.Class, hex16(uint16(q.Class))))
+			info = append(info, q.Type.String(), name)
+		}
+	}
+	for _, section := range []struct {
+		label   string
+		records []layers.DNSResourceRecord
+	}{
+		{"Answers", msg.Answers},
+		{"Authoritative nameservers", msg.Authorities},
+		{"Additional records", msg.Additionals},
+	} {
+		if len(section.records) == 0 {
+			continue
+		}
+		node := dns.add("", off+12, 0, section.label, section.label)
+		for _, rr := range section.records {
+			value := dnsRecordField(node, rr, off)
+			if section.label == "Answers" && value != "" {
+				info = append(info, rr.Type.String(), value)
+			}
+		}
+	}
+
+	p.Protocol = "DNS"
+	if p.SrcPort == "5353" || p.DstPort == "5353" {
+		p.Protocol = "MDNS"
+	}
+	p.Info = strings.Join(info, " ")
+	return true
+}
+
+// dnsRecordField adds a resource record below node and returns its data as shown
+func dnsRecordField(node *Field, rr layers.DNSResourceRecord, off int) string {
+	name := dnsName(rr.Name)
+	var dataName, value string
+	switch rr.Type {
+	case layers.DNSTypeA:
+		dataName, value = "dns.a", rr.IP.String()
+	case layers.DNSTypeAAAA:
+		dataName, value = "dns.aaaa", rr.IP.String()
+	case layers.DNSTypeCNAME:
+		dataName, value = "dns.cname", dnsName(rr.CNAME)
+	case layers.DNSTypeNS:
+		dataName, value = "dns.ns", dnsName(rr.NS)
+	case layers.DNSTypePTR:
+		dataName, value = "dns.ptr.domain_name", dnsName(rr.PTR)
+	case layers.DNSTypeMX:
+		dataName, value = "dns.mx.mail_exchange", dnsName(rr.MX.Name)
+	case layers.DNSTypeTXT:
+		txts := make([]string, 0, len(rr.TXTs))
+		for _, t := range rr.TXTs {
+			txts = append(txts, string(t))
+		}
+		dataName, value = "dns.txt", strings.Join(txts, " ")
+	}
+	summary := fmt.Sprintf("%s: type %s, class %s", name, rr.Type, rr.Class)
+	if value != "" {
+		summary += fmt.Sprintf(", %s %s", strings.ToLower(rr.Type.String()), value)
+	}
+	record := node.add("", off+12, 0, name, summary)
+	record.add("dns.resp.name", off+12, 0, name, "Name: "+name)
+	record.add("dns.resp.type", off+12, 0, strconv.Itoa(int(rr.Type)), fmt.Sprintf("Type: %s (%d)", rr.Type, rr.Type))
+	record.add("dns.resp.ttl", off+12, 0, strconv.Itoa(int(rr.TTL)), fmt.Sprintf("Time to live: %d", rr.TTL))
+	record.add("dns.resp.len", off+12, 0, strconv.Itoa(int(rr.DataLength)), fmt.Sprintf("Data length: %d", rr.DataLength))
+	if dataName != "" {
+		record.add(dataName, off+12, 0, value, fmt.Sprintf("%s: %s", rr.Type, value))
+	}
+	return value
+}
+
+func dnsName(name []byte) string {
+	if len(name) == 0 {
+		return "<Root>"
+	}
+	return string(name)
+}
+
+//======================================================================
+// HTTP/1
+
+var httpMethods = []string{
+	"GET ", "POST ", "PUT ", "DELETE ", "HEAD ", "OPTIONS ", "PATCH ", "CONNECT ", "TRACE ",
+	"M-SEARCH ", "NOTIFY ", // SSDP
+}
+
+var httpHeaderFields = map[string]string{
+	"host":           "http.host",
+	"user-agent":     "http.user_agent",
+	"accept":         "http.accept",
+	"content-type":   "http.content_type",
+	"content-length": "http.content_length_header",
+	"connection":     "http.connection",
+	"cookie":         "http.cookie",
+	"set-cookie":     "http.set_cookie",
+	"referer":        "http.referer",
+	"location":       "http.location",
+	"server":         "http.server",
+	"authorization":  "http.authorization",
+}
+
+func isHTTP(payload []byte) bool {
+	if bytes.HasPrefix(payload, []byte("HTTP/1.")) {
+		return true
+	}
+	for _, m := range httpMethods {
+		if bytes.HasPrefix(payload, []byte(m)) {
+			return true
+		}
+	}
+	return false
+}
+
+// dissectHTTP decodes an HTTP/1 request or response head. Messages spanning
+// several segments are not reassembled; the first segment is decoded and
+// the rest show as TCP payload.
+func dissectHTTP(p *Packet, payload []byte, off int) {
+	head := payload
+	body := 0
+	if i := bytes.Index(payload, []byte("\r\n\r\n")); i >= 0 {
+		head = payload[:i+2]
+		body = len(payload) - i - 4
+	}
+	http := p.proto("http", off, len(payload), "Hypertext Transfer Protocol")
+	lineName := "http.request.line"
+	if bytes.HasPrefix(payload, []byte("HTTP/")) {
+		lineName = "http.response.line"
+	}
+
+	pos := 0
+	for n, line := range strings.SplitAfter(string(head), "\r\n") {
+		if line == "" {
+			continue
+		}
+		text := strings.TrimRight(line, "\r\n")
+		at := off + pos
+		pos += len(line)
+		if n == 0 {
+			httpFirstLine(p, http, text, at, len(line))
+			continue
+		}
+		name, show := lineName, line
+		if i := strings.IndexByte(text, ':'); i > 0 {
+			if field, ok := httpHeaderFields[strings.ToLower(text[:i])]; ok {
+				name = field
+				show = strings.TrimSpace(text[i+1:])
+			}
+		}
+		http.add(name, at, len(line), show, text+`\r\n`)
+	}
+	if body > 0 {
+		http.add("http.file_data", off+len(payload)-body, body, "", fmt.Sprintf("File Data: %d bytes", body))
+	}
+	p.Protocol = "HTTP"
+}
+
+func httpFirstLine(p *Packet, http *Field, line string, at, size int) {
+	parts := strings.SplitN(line, " ", 3)
+	first := http.add("", at, size, line, line+`\r\n`)
+	if strings.HasPrefix(line, "HTTP/") {
+		http.hidden("http.response", at, 0, "1")
+		first.add("http.response.version", at, len(parts[0]), parts[0], "Response Version: "+parts[0])
+		if len(parts) > 1 {
+			first.add("http.response.code", at+len(parts[0])+1, len(parts[1]), parts[1], "Status Code: "+parts[1])
+		}
+		if len(parts) > 2 {
+			first.add("http.response.phrase", at+len(parts[0])+len(parts[1])+2, len(parts[2]), parts[2], "Response Phrase: "+parts[2])
+		}
+	} else {
+		http.hidden("http.request", at, 0, "1")
+		first.add("http.request.method", at, len(parts[0]), parts[0], "Request Method: "+parts[0])
+		if len(parts) > 1 {
+			first.add("http.request.uri", at+len(parts[0])+1, len(parts[1]), parts[1], "Request URI: "+parts[1])
+		}
+		if len(parts) > 2 {
+			first.add("http.request.version", at+len(parts[0])+len(parts[1])+2, len(parts[2]), parts[2], "Request Version: "+parts[2])
+		}
+	}
+	p.Info = line
+}
+
+//======================================================================
+// TLS
+
+var tlsVersions = map[uint16]string{
+	0x0300: "SSLv3",
+	0x0301: "TLSv1",
+	0x0302: "TLSv1.1",
+	0x0303: "TLSv1.2",
+	0x0304: "TLSv1.3",
+}
+
+var tlsContentTypes = map[uint8]string{
+	20: "Change Cipher Spec",
+	21: "Alert",
+	22: "Handshake",
+	23: "Application Data",
+}
+
+var tlsHandshakeTypes = map[uint8]string{
+	1:  "Client Hello",
+	2:  "Server Hello",
+	4:  "New Session Ticket",
+	8:  "Encrypted Extensions",
+	11: "Certificate",
+	12: "Server Key Exchange",
+	13: "Certificate Request",
+	14: "Server Hello Done",
+	15: "Certificate Verify",
+	16: "Client Key Exchange",
+	20: "Finished",
+}
+
+var tlsCipherSuites = map[uint16]string{
+	0x002f: "TLS_RSA_WITH_AES_128_CBC_SHA",
+	0x0035: "TLS_RSA_WITH_AES_256_CBC_SHA",
+	0x009c: "TLS_RSA_WITH_AES_128_GCM_SHA256",
+	0x009d: "TLS_RSA_WITH_AES_256_GCM_SHA384",
+	0x1301: "TLS_AES_128_GCM_SHA256",
+	0x1302: "TLS_AES_256_GCM_SHA384",
+	0x1303: "TLS_CHACHA20_POLY1305_SHA256",
+	0xc013: "TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA",
+	0xc014: "TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA",
+	0xc02b: "TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256",
+	0xc02c: "TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384",
+	0xc02f: "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256",
+	0xc030: "TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384",
+	0xcca8: "TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256",
+	0xcca9: "TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256",
+}
+
+func isTLS(payload []byte) bool {
+	if len(payload) < 5 {
+		return false
+	}
+	_, known := tlsContentTypes[payload[0]]
+	return known && payload[1] == 3 && payload[2] <= 4
+}
+
+// dissectTLS decodes the TLS records in a segment. version is the version
+// already negotiated on the stream, if any; the version to remember for the
+// stream is returned.
+func dissectTLS(p *Packet, payload []byte, off int, version string) string {
+	tls := p.proto("tls", off, len(payload), "Transport Layer Security")
+	var info []string
+	negotiated := ""
+	pos := 0
+	for len(payload)-pos >= 5 && isTLS(payload[pos:]) {
+		typ := payload[pos]
+		recVersion := uint16(payload[pos+1])<<8 | uint16(payload[pos+2])
+		length := int(payload[pos+3])<<8 | int(payload[pos+4])
+		end := pos + 5 + length
+		if end > len(payload) {
+			end = len(payload)
+		}
+		body := payload[pos+5 : end]
+		at := off + pos
+
+		name := versionName(recVersion)
+		if version != "" {
+			name = version
+		}
+		what := tlsContentTypes[typ]
+		record := tls.add("tls.record", at, end-pos, "", fmt.Sprintf("%s Record Layer: %s Protocol", name, what))
+		record.add("tls.record.content_type", at, 1, strconv.Itoa(int(typ)), fmt.Sprintf("Content Type: %s (%d)", what, typ))
+		record.add("tls.record.version", at+1, 2, hex16(recVersion), fmt.Sprintf("Version: %s (%s)", versionName(recVersion), hex16(recVersion)))
+		record.add("tls.record.length", at+3, 2, strconv.Itoa(length), fmt.Sprintf("Length: %d", length))
+
+		switch typ {
+		case 22:
+			hs, v := tlsHandshake(record, body, at+5, version != "" && version != "TLSv1.3" && len(info) > 0 && info[len(info)-1] == "Change Cipher Spec")
+			if v != "" {
+				negotiated = v
+			}
+			record.Showname += ": " + hs
+			info = append(info, hs)
+		case 21:
+			if len(body) == 2 {
+				info = append(info, fmt.Sprintf("Alert (Level: %d, Description: %d)", body[0], body[1]))
+			} else {
+				info = append(info, "Encrypted Alert")
+			}
+		default:
+			info = append(info, what)
+		}
+		pos = end
+	}
+
+	if version == "" {
+		version = versionName(uint16(payload[1])<<8 | uint16(payload[2]))
+	}
+	if negotiated != "" {
+		version = negotiated
+	}
+	p.Protocol = version
+	p.Info = strings.Join(dedupe(info), ", ")
+	return version
+}
+
+// tlsHandshake adds a handshake message below record and returns its
+// description and, for a Server Hello, the negotiated version
+func tlsHandshake(record *Field, body []byte, off int, encrypted bool) (string, string) {
+	if len(body) < 4 || encrypted {
+		return "Encrypted Handshake Message", ""
+	}
+	typ := body[0]
+	what, ok := tlsHandshakeTypes[typ]
+	length := int(body[1])<<16 | int(body[2])<<8 | int(body[3])
+	if !ok || length > len(body)-4+16*1024 {
+		return "Encrypted Handshake Message", ""
+	}
+	hs := record.add("tls.handshake", off, len(body), "", "Handshake Protocol: "+what)
+	hs.add("tls.handshake.type", off, 1, strconv.Itoa(int(typ)), fmt.Sprintf("Handshake Type: %s (%d)", what, typ))
+	hs.add("tls.handshake.length", off+1, 3, strconv.Itoa(length), fmt.Sprintf("Length: %d", length))
+
+	c := &cursor{b: body, pos: 4}
+	negotiated := ""
+	switch typ {
+	case 1, 2:
+		version := c.u16()
+		hs.add("tls.handshake.version", off+4, 2, hex16(version), fmt.Sprintf("Version: %s (%s)", versionName(version), hex16(version)))
+		random := c.bytes(32)
+		hs.add("tls.handshake.random", off+6, 32, hex.EncodeToString(random), "Random: "+hex.EncodeToString(random))
+		sidLen := int(c.u8())
+		hs.add("tls.handshake.session_id_length", off+38, 1, strconv.Itoa(sidLen), fmt.Sprintf("Session ID Length: %d", sidLen))
+		c.bytes(sidLen)
+		if typ == 1 {
+			csLen := int(c.u16())
+			hs.add("tls.handshake.cipher_suites_length", off+c.pos-2, 2, strconv.Itoa(csLen), fmt.Sprintf("Cipher Suites Length: %d", csLen))
+			suites := hs.add("", off+c.pos, csLen, "", fmt.Sprintf("Cipher Suites (%d suites)", csLen/2))
+			for i := 0; i < csLen/2 && !c.err; i++ {
+				cipherSuite(suites, off+c.pos, c.u16())
+			}
+			c.bytes(int(c.u8())) // compression methods
+		} else {
+			cipherSuite(hs, off+c.pos, c.u16())
+			c.u8() // compression method
+		}
+		if v := tlsExtensions(hs, c, off, typ == 2); v != "" {
+			negotiated = v
+		} else if typ == 2 && !c.err {
+			negotiated = versionName(version)
+		}
+	case 11:
+		if length >= 3 {
+			total := int(c.u24())
+			hs.add("tls.handshake.certificates_length", off+4, 3, strconv.Itoa(total), fmt.Sprintf("Certificates Length: %d", total))
+		}
+	}
+	return what, negotiated
+}
+
+// tlsExtensions decodes the hello extensions that matter for the packet
+// list: server name, ALPN and supported versions
+func tlsExtensions(hs *Field, c *cursor, off int, server bool) string {
+	if c.remaining() < 2 {
+		return ""
+	}
+	total := int(c.u16())
+	end := c.pos + total
+	negotiated := ""
+	for c.pos+4 <= end && !c.err {
+		at := off + c.pos
+		typ := c.u16()
+		length := int(c.u16())
+		data := &cursor{b: c.bytes(length)}
+		if c.err {
+			break
+		}
+		switch typ {
+		case 0: // server_name
+			data.u16()
+			for data.remaining() >= 3 {
+				kind := data.u8()
+				name := string(data.bytes(int(data.u16())))
+				if kind == 0 && !data.err {
+					hs.add("tls.handshake.extensions_server_name", at+4, length, name, "Server Name: "+name)
+				}
+			}
+		case 16: // application_layer_protocol_negotiation
+			data.u16()
+			for data.remaining() >= 1 {
+				proto := string(data.bytes(int(data.u8())))
+				if !data.err {
+					hs.add("tls.handshake.extensions_alpn_str", at+4, length, proto, "ALPN Next Protocol: "+proto)
+				}
+			}
+		case 43: // supported_versions
+			if server {
+				v := data.u16()
+				if !data.err {
+					negotiated = versionName(v)
+					hs.add("tls.handshake.extensions.supported_version", at+4, 2, hex16(v), fmt.Sprintf("Supported Version: %s (%s)", negotiated, hex16(v)))
+				}
+				continue
+			}
+			n := int(data.u8())
+			for i := 0; i < n/2 && !data.err; i++ {
+				v := data.u16()
+				hs.add("tls.handshake.extensions.supported_version", at+5+2*i, 2, hex16(v), fmt.Sprintf("Supported Version: %s (%s)", versionName(v), hex16(v)))
+			}
+		}
+	}
+	return negotiated
+}
+
+func cipherSuite(node *Field, at int, suite uint16) {
+	name, ok := tlsCipherSuites[suite]
+	if !ok {
+		name = "Unknown"
+	}
+	node.add("tls.handshake.ciphersuite", at, 2, hex16(suite), fmt.Sprintf("Cipher Suite: %s (%s)", name, hex16(suite)))
+}
+
+func versionName(v uint16) string {
+	if name, ok := tlsVersions[v]; ok {
+		return name
+	}
+	return "TLS"
+}
+
+// dedupe drops consecutive repeats, e.g. several Application Data records
+func dedupe(items []string) []string {
+	var res []string
+	for _, item := range items {
+		if len(res) == 0 || res[len(res)-1] != item {
+			res = append(res, item)
+		}
+	}
+	return res
+}
+
+//======================================================================
+
+// cursor reads big-endian values, recording rather than panicking on a
+// short buffer
+type cursor struct {
+	b   []byte
+	pos int
+	err bool
+}
+
+func (c *cursor) remaining() int {
+	return len(c.b) - c.pos
+}
+
+func (c *cursor) bytes(n int) []byte {
+	if n < 0 || c.remaining() < n {
+		c.err = true
+		c.pos = len(c.b)
+		return nil
+	}
+	res := c.b[c.pos : c.pos+n]
+	c.pos += n
+	return res
+}
+
+func (c *cursor) u8() uint8 {
+	b := c.bytes(1)
+	if b == nil {
+		return 0
+	}
+	return b[0]
+}
+
+func (c *cursor) u16() uint16 {
+	b := c.bytes(2)
+	if b == nil {
+		return 0
+	}
+	return uint16(b[0])<<8 | uint16(b[1])
+}
+
+func (c *cursor) u24() uint32 {
+	b := c.bytes(3)
+	if b == nil {
+		return 0
+	}
+	return uint32(b[0])<<16 | uint32(b[1])<<8 | uint32(b[2])
+}
+
+//======================================================================
+
+func ipString(b []byte) string {
+	if len(b) == 4 || len(b) == 16 {
+		return net.IP(b).String()
+	}
+	return hex.EncodeToString(b)
+}
+
+func macString(b []byte) string {
+	return net.HardwareAddr(b).String()
+}
+
+//======================================================================
+// Local Variables:
+// mode: Go
+// fill-column: 78
+// End:
@@ -0,0 +1,127 @@
+// Copyright 2019-2022 Graham Clark. All rights reserved.  Use of this source
+// code is governed by the MIT license that can be found in the LICENSE
+// file.
+
+package native
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+//======================================================================
+
+var captureFormats = map[string]string{
+	"pcap":   "Wireshark/tcpdump/... - pcap",
+	"pcapng": "Wireshark/... - pcapng",
+}
+
+// writeCapinfo summarizes the capture at path in the layout of capinfos
+func writeCapinfo(ctx context.Context, path string, w io.Writer) error {
+	capture, f, err := OpenCapture(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var count, bytes int
+	var firstTs, lastTs time.Time
+	perIface := make(map[int]int)
+	for {
+		select {
+		case <-ctx.Done():
+			return errKilled
+		default:
+		}
+		frame, err := capture.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if count == 0 || frame.Timestamp.Before(firstTs) {
+			firstTs = frame.Timestamp
+		}
+		if frame.Timestamp.After(lastTs) {
+			lastTs = frame.Timestamp
+		}
+		count++
+		bytes += frame.Length
+		perIface[frame.Interface]++
+	}
+
+	var b strings.Builder
+	line := func(label string, format string, args ...interface{}) {
+		fmt.Fprintf(&b, "%-20s %s\n", label+":", fmt.Sprintf(format, args...))
+	}
+	line("File name", "%s", path)
+	line("File type", "%s", captureFormats[capture.Format])
+	line("File encapsulation", "%s", encapsulation(capture))
+	line("Number of packets", "%d", count)
+	if fi, err := f.Stat(); err == nil {
+		line("File size", "%d bytes", fi.Size())
+	}
+	line("Data size", "%d bytes", bytes)
+	duration := lastTs.Sub(firstTs).Seconds()
+	if count > 0 {
+		line("Capture duration", "%.6f seconds", duration)
+		line("First packet time", "%s", firstTs.Local().Format("2006-01-02 15:04:05.000000"))
+		line("Last packet time", "%s", lastTs.Local().Format("2006-01-02 15:04:05.000000"))
+	}
+	if duration > 0 {
+		line("Data byte rate", "%.0f bytes/s", float64(bytes)/duration)
+		line("Data bit rate", "%.0f bits/s", float64(bytes*8)/duration)
+	}
+	if count > 0 {
+		line("Average packet size", "%.2f bytes", float64(bytes)/float64(count))
+	}
+	if duration > 0 {
+		line("Average packet rate", "%.0f packets/s", float64(count)/duration)
+	}
+	for _, comment := range capture.Comments {
+		line("Capture comment", "%s", comment)
+	}
+
+	fmt.Fprintf(&b, "Number of interfaces in file: %d\n", len(capture.Interfaces))
+	indent := strings.Repeat(" ", 21)
+	for i, iface := range capture.Interfaces {
+		fmt.Fprintf(&b, "Interface #%d info:\n", i)
+		if iface.Name != "" {
+			fmt.Fprintf(&b, "%sName = %s\n", indent, iface.Name)
+		}
+		if iface.Description != "" {
+			fmt.Fprintf(&b, "%sDescription = %s\n", indent, iface.Description)
+		}
+		for _, comment := range iface.Comments {
+			fmt.Fprintf(&b, "%sComment = %s\n", indent, comment)
+		}
+		fmt.Fprintf(&b, "%sEncapsulation = %s (%d)\n", indent, iface.LinkType, iface.LinkType)
+		fmt.Fprintf(&b, "%sCapture length = %d\n", indent, iface.SnapLen)
+		fmt.Fprintf(&b, "%sNumber of packets = %d\n", indent, perIface[i])
+	}
+
+	_, err = io.WriteString(w, b.String())
+	return err
+}
+
+func encapsulation(c *Capture) string {
+	if len(c.Interfaces) == 0 {
+		return "Unknown"
+	}
+	for _, iface := range c.Interfaces[1:] {
+		if iface.LinkType != c.Interfaces[0].LinkType {
+			return "Per packet"
+		}
+	}
+	return c.Interfaces[0].LinkType.String()
+}
+
+//======================================================================
+// Local Variables:
+// mode: Go
+// fill-column: 78
+// End:
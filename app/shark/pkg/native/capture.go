@@ -0,0 +1,384 @@
+// Copyright 2019-2022 Graham Clark. All rights reserved.  Use of this source
+// code is governed by the MIT license that can be found in the LICENSE
+// file.
+
+package native
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"math/bits"
+	"os"
+	"time"
+
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+)
+
+//======================================================================
+
+const (
+	ngBlockSectionHeader       = 0x0A0D0D0A
+	ngBlockInterfaceDescriptor = 0x00000001
+	ngBlockPacket              = 0x00000002
+	ngBlockSimplePacket        = 0x00000003
+	ngBlockEnhancedPacket      = 0x00000006
+	ngByteOrderMagic           = 0x1A2B3C4D
+
+	ngOptEnd         = 0
+	ngOptComment     = 1
+	ngOptIfName      = 2
+	ngOptIfDesc      = 3
+	ngOptIfTsresol   = 9
+	ngOptIfTsoffset  = 14
+	ngMaxBlockLength = 64 * 1024 * 1024
+)
+
+// Interface is a capture interface. Classic pcap files have exactly one.
+type Interface struct {
+	Name        string
+	Description string
+	LinkType    layers.LinkType
+	SnapLen     uint32
+	Comments    []string
+
+	tsUnits  uint64 // timestamp units per second
+	tsOffset int64  // seconds added to every timestamp
+}
+
+// Frame is one captured packet. Number is 1-based, as in tshark.
+type Frame struct {
+	Number    int
+	Timestamp time.Time
+	Length    int // length on the wire
+	Data      []byte
+	Interface int // index into Capture.Interfaces
+	LinkType  layers.LinkType
+	Comments  []string
+}
+
+// Capture reads frames from a pcap or pcapng stream. Interfaces and
+// section comments grow as pcapng blocks are read, so they are complete
+// only once Next has returned io.EOF.
+type Capture struct {
+	Format     string // "pcap" or "pcapng"
+	Interfaces []Interface
+	Comments   []string // pcapng section comments
+
+	r      *bufio.Reader
+	pcap   *pcapgo.Reader
+	order  binary.ByteOrder
+	base   int // index of the current section's first interface
+	number int
+}
+
+// NewCapture detects the format of r and reads its file header.
+func NewCapture(r io.Reader) (*Capture, error) {
+	c := &Capture{r: bufio.NewReaderSize(r, 64*1024)}
+	magic, err := c.r.Peek(4)
+	if err != nil {
+		return nil, fmt.Errorf("Could not read capture header: %v", err)
+	}
+	if binary.LittleEndian.Uint32(magic) == ngBlockSectionHeader {
+		c.Format = "pcapng"
+		if err := c.readSectionHeader(); err != nil {
+			return nil, err
+		}
+		return c, nil
+	}
+
+	c.Format = "pcap"
+	c.pcap, err = pcapgo.NewReader(c.r)
+	if err != nil {
+		return nil, fmt.Errorf("Could not read capture header: %v", err)
+	}
+	c.Interfaces = []Interface{{
+		LinkType: c.pcap.LinkType(),
+		SnapLen:  c.pcap.Snaplen(),
+	}}
+	return c, nil
+}
+
+// OpenCapture opens the capture file at path. The caller closes the file.
+func OpenCapture(path string) (*Capture, *os.File, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	c, err := NewCapture(f)
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	return c, f, nil
+}
+
+// Next returns the next frame, or io.EOF at the end of the capture.
+func (c *Capture) Next() (*Frame, error) {
+	var f *Frame
+	var err error
+	if c.pcap != nil {
+		f, err = c.nextPcap()
+	} else {
+		f, err = c.nextPcapng()
+	}
+	if err != nil {
+		return nil, err
+	}
+	c.number++
+	f.Number = c.number
+	return f, nil
+}
+
+func (c *Capture) nextPcap() (*Frame, error) {
+	data, ci, err := c.pcap.ReadPacketData()
+	if err != nil {
+		if err == io.ErrUnexpectedEOF {
+			// A capture still being written ends mid-packet
+			err = io.EOF
+		}
+		return nil, err
+	}
+	return &Frame{
+		Timestamp: ci.Timestamp,
+		Length:    ci.Length,
+		Data:      data,
+		LinkType:  c.Interfaces[0].LinkType,
+	}, nil
+}
+
+func (c *Capture) nextPcapng() (*Frame, error) {
+	for {
+		typ, body, err := c.readBlock()
+		if err != nil {
+			return nil, err
+		}
+		switch typ {
+		case ngBlockSectionHeader:
+			// readBlock has already switched to the new section
+		case ngBlockInterfaceDescriptor:
+			if err := c.readInterface(body); err != nil {
+				return nil, err
+			}
+		case ngBlockEnhancedPacket, ngBlockPacket:
+			return c.readPacket(typ, body)
+		case ngBlockSimplePacket:
+			return c.readSimplePacket(body)
+		}
+	}
+}
+
+// readBlock returns the type and body of the next block. Section headers
+// are parsed here because they set the byte order of everything after.
+func (c *Capture) readBlock() (uint32, []byte, error) {
+	magic, err := c.r.Peek(4)
+	if err != nil {
+		if err == io.ErrUnexpectedEOF {
+			err = io.EOF
+		}
+		return 0, nil, err
+	}
+	if binary.LittleEndian.Uint32(magic) == ngBlockSectionHeader {
+		return ngBlockSectionHeader, nil, c.readSectionHeader()
+	}
+
+	var hdr [8]byte
+	if _, err := io.ReadFull(c.r, hdr[:]); err != nil {
+		return 0, nil, truncated(err)
+	}
+	typ := c.order.Uint32(hdr[0:4])
+	length := c.order.Uint32(hdr[4:8])
+	if length < 12 || length%4 != 0 || length > ngMaxBlockLength {
+		return 0, nil, fmt.Errorf("Invalid pcapng block length %d", length)
+	}
+	body := make([]byte, length-8)
+	if _, err := io.ReadFull(c.r, body); err != nil {
+		return 0, nil, truncated(err)
+	}
+	return typ, body[:len(body)-4], nil
+}
+
+func (c *Capture) readSectionHeader() error {
+	var hdr [12]byte
+	if _, err := io.ReadFull(c.r, hdr[:]); err != nil {
+		return truncated(err)
+	}
+	switch {
+	case binary.LittleEndian.Uint32(hdr[8:12]) == ngByteOrderMagic:
+		c.order = binary.LittleEndian
+	case binary.BigEndian.Uint32(hdr[8:12]) == ngByteOrderMagic:
+		c.order = binary.BigEndian
+	default:
+		return fmt.Errorf("Invalid pcapng byte order magic %x", hdr[8:12])
+	}
+	length := c.order.Uint32(hdr[4:8])
+	if length < 28 || length%4 != 0 || length > ngMaxBlockLength {
+		return fmt.Errorf("Invalid pcapng section header length %d", length)
+	}
+	body := make([]byte, length-12)
+	if _, err := io.ReadFull(c.r, body); err != nil {
+		return truncated(err)
+	}
+	// version (4), section length (8), options, trailing length (4)
+	c.base = len(c.Interfaces)
+	c.readOptions(body[12:len(body)-4], func(code uint16, value []byte) {
+		if code == ngOptComment {
+			c.Comments = append(c.Comments, string(value))
+		}
+	})
+	return nil
+}
+
+func (c *Capture) readInterface(body []byte) error {
+	if len(body) < 8 {
+		return fmt.Errorf("Short pcapng interface description block")
+	}
+	iface := Interface{
+		LinkType: layers.LinkType(c.order.Uint16(body[0:2])),
+		SnapLen:  c.order.Uint32(body[4:8]),
+		tsUnits:  1000000,
+	}
+	c.readOptions(body[8:], func(code uint16, value []byte) {
+		switch code {
+		case ngOptComment:
+			iface.Comments = append(iface.Comments, string(value))
+		case ngOptIfName:
+			iface.Name = string(value)
+		case ngOptIfDesc:
+			iface.Description = string(value)
+		case ngOptIfTsresol:
+			if len(value) == 1 {
+				iface.tsUnits = tsUnits(value[0])
+			}
+		case ngOptIfTsoffset:
+			if len(value) == 8 {
+				iface.tsOffset = int64(c.order.Uint64(value))
+			}
+		}
+	})
+	c.Interfaces = append(c.Interfaces, iface)
+	return nil
+}
+
+func (c *Capture) readPacket(typ uint32, body []byte) (*Frame, error) {
+	if len(body) < 20 {
+		return nil, fmt.Errorf("Short pcapng packet block")
+	}
+	var idx int
+	if typ == ngBlockEnhancedPacket {
+		idx = int(c.order.Uint32(body[0:4]))
+	} else {
+		idx = int(c.order.Uint16(body[0:2]))
+	}
+	iface, err := c.iface(idx)
+	if err != nil {
+		return nil, err
+	}
+	ts := uint64(c.order.Uint32(body[4:8]))<<32 | uint64(c.order.Uint32(body[8:12]))
+	caplen := int(c.order.Uint32(body[12:16]))
+	if caplen > len(body)-20 {
+		return nil, fmt.Errorf("Invalid pcapng packet length %d", caplen)
+	}
+	f := &Frame{
+		Timestamp: iface.timestamp(ts),
+		Length:    int(c.order.Uint32(body[16:20])),
+		Data:      body[20 : 20+caplen],
+		Interface: c.base + idx,
+		LinkType:  iface.LinkType,
+	}
+	if opts := 20 + pad4(caplen); opts < len(body) {
+		c.readOptions(body[opts:], func(code uint16, value []byte) {
+			if code == ngOptComment {
+				f.Comments = append(f.Comments, string(value))
+			}
+		})
+	}
+	return f, nil
+}
+
+func (c *Capture) readSimplePacket(body []byte) (*Frame, error) {
+	if len(body) < 4 {
+		return nil, fmt.Errorf("Short pcapng simple packet block")
+	}
+	iface, err := c.iface(0)
+	if err != nil {
+		return nil, err
+	}
+	length := int(c.order.Uint32(body[0:4]))
+	caplen := length
+	if caplen > len(body)-4 {
+		caplen = len(body) - 4
+	}
+	if iface.SnapLen != 0 && caplen > int(iface.SnapLen) {
+		caplen = int(iface.SnapLen)
+	}
+	return &Frame{
+		Length:    length,
+		Data:      body[4 : 4+caplen],
+		Interface: c.base,
+		LinkType:  iface.LinkType,
+	}, nil
+}
+
+func (c *Capture) iface(idx int) (*Interface, error) {
+	if idx < 0 || c.base+idx >= len(c.Interfaces) {
+		return nil, fmt.Errorf("Packet refers to unknown interface %d", idx)
+	}
+	return &c.Interfaces[c.base+idx], nil
+}
+
+// readOptions calls fn for each option in a pcapng options list
+func (c *Capture) readOptions(data []byte, fn func(code uint16, value []byte)) {
+	for len(data) >= 4 {
+		code := c.order.Uint16(data[0:2])
+		length := int(c.order.Uint16(data[2:4]))
+		if code == ngOptEnd || 4+length > len(data) {
+			return
+		}
+		fn(code, data[4:4+length])
+		next := 4 + pad4(length)
+		if next > len(data) {
+			return
+		}
+		data = data[next:]
+	}
+}
+
+func (i *Interface) timestamp(units uint64) time.Time {
+	secs := units / i.tsUnits
+	// frac * 1e9 overflows for fine binary resolutions
+	hi, lo := bits.Mul64(units%i.tsUnits, 1000000000)
+	nanos, _ := bits.Div64(hi, lo, i.tsUnits)
+	return time.Unix(int64(secs)+i.tsOffset, int64(nanos)).UTC()
+}
+
+// tsUnits decodes if_tsresol: a power of ten, or of two if the top bit is set
+func tsUnits(resol byte) uint64 {
+	if resol&0x80 != 0 {
+		return uint64(1) << (resol & 0x3f)
+	}
+	if resol > 19 {
+		resol = 19
+	}
+	return uint64(math.Pow10(int(resol)))
+}
+
+func pad4(n int) int {
+	return (n + 3) &^ 3
+}
+
+func truncated(err error) error {
+	if err == io.ErrUnexpectedEOF {
+		return io.EOF
+	}
+	return err
+}
+
+//======================================================================
+// Local Variables:
+// mode: Go
+// fill-column: 78
+// End:
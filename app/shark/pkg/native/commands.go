@@ -0,0 +1,321 @@
+// Copyright 2019-2022 Graham Clark. All rights reserved.  Use of this source
+// code is governed by the MIT license that can be found in the LICENSE
+// file.
+
+// Package native decodes pcap and pcapng files in Go, without tshark. It
+// provides loader commands that produce the same PSML, PDML and hexdump
+// output that termshark otherwise reads from tshark, for Ethernet, 802.1Q,
+// ARP, IPv4/6, ICMP, TCP, UDP, DNS, HTTP/1 and the TLS handshake. Other
+// protocols are named in the packet list but not decoded. TCP and UDP
+// streams are reassembled for the follow-stream view.
+package native
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+
+	"github.com/gcla/termshark/v2/pkg/capinfo"
+	"github.com/gcla/termshark/v2/pkg/iostats"
+	"github.com/gcla/termshark/v2/pkg/pcap"
+	"github.com/gcla/termshark/v2/pkg/shark"
+	"github.com/gcla/termshark/v2/pkg/streams"
+)
+
+//======================================================================
+
+// errFinished has the text termshark.KillIfPossible treats as harmless
+var errFinished = errors.New("os: process already finished")
+
+var errKilled = errors.New("killed")
+
+// Commands implements the packet loader, capinfo and stream commands
+// natively.
+type Commands struct {
+	// Tshark runs live captures and display filters the native dissectors
+	// cannot evaluate. If nil, captures use dumpcap directly and such
+	// filters fail with an UnsupportedFilterError.
+	Tshark pcap.ILoaderCmds
+}
+
+func MakeCommands(tshark pcap.ILoaderCmds) Commands {
+	return Commands{Tshark: tshark}
+}
+
+var _ pcap.ILoaderCmds = Commands{}
+var _ capinfo.ILoaderCmds = Commands{}
+var _ streams.ILoaderCmds = Commands{}
+var _ iostats.ILoaderCmds = Commands{}
+
+func (c Commands) external() pcap.ILoaderCmds {
+	if c.Tshark != nil {
+		return c.Tshark
+	}
+	return pcap.Commands{}
+}
+
+func (c Commands) Iface(ifaces []string, captureFilter string, tmpfile string) pcap.IBasicCommand {
+	return c.external().Iface(ifaces, captureFilter, tmpfile)
+}
+
+func (c Commands) Tail(tmpfile string) pcap.ITailCommand {
+	return c.external().Tail(tmpfile)
+}
+
+func (c Commands) Psml(src interface{}, displayFilter string) pcap.IPcapCommand {
+	filter, err := ParseFilter(displayFilter)
+	if err != nil && c.Tshark != nil {
+		return c.Tshark.Psml(src, displayFilter)
+	}
+	name := "stdin"
+	if file, ok := src.(string); ok {
+		name = file
+	}
+	return newCommand(fmt.Sprintf("native psml %s %q", name, displayFilter), func(ctx context.Context, w io.Writer) error {
+		if err != nil {
+			return err
+		}
+		return decode(ctx, src, filter, newPsmlWriter(w, shark.GetPsmlColumnFormat()))
+	})
+}
+
+func (c Commands) Pcap(file string, displayFilter string) pcap.IPcapCommand {
+	filter, err := ParseFilter(displayFilter)
+	if err != nil && c.Tshark != nil {
+		return c.Tshark.Pcap(file, displayFilter)
+	}
+	return newCommand(fmt.Sprintf("native hexdump %s %q", file, displayFilter), func(ctx context.Context, w io.Writer) error {
+		if err != nil {
+			return err
+		}
+		return decode(ctx, file, filter, &hexdumpWriter{w: w})
+	})
+}
+
+func (c Commands) Pdml(file string, displayFilter string) pcap.IPcapCommand {
+	filter, err := ParseFilter(displayFilter)
+	if err != nil && c.Tshark != nil {
+		return c.Tshark.Pdml(file, displayFilter)
+	}
+	return newCommand(fmt.Sprintf("native pdml %s %q", file, displayFilter), func(ctx context.Context, w io.Writer) error {
+		if err != nil {
+			return err
+		}
+		return decode(ctx, file, filter, &pdmlWriter{w: w, name: file})
+	})
+}
+
+func (c Commands) Capinfo(file string) pcap.IPcapCommand {
+	return newCommand(fmt.Sprintf("native capinfo %s", file), func(ctx context.Context, w io.Writer) error {
+		return writeCapinfo(ctx, file, w)
+	})
+}
+
+func (c Commands) Stats(file string, displayFilter string) pcap.IPcapCommand {
+	filter, err := ParseFilter(displayFilter)
+	if err != nil && c.Tshark != nil {
+		return iostats.MakeCommands().Stats(file, displayFilter)
+	}
+	return newCommand(fmt.Sprintf("native stats %s %q", file, displayFilter), func(ctx context.Context, w io.Writer) error {
+		if err != nil {
+			return err
+		}
+		return decode(ctx, file, filter, newPsmlWriter(w, iostats.Columns))
+	})
+}
+
+func (c Commands) Stream(file string, proto string, idx int) pcap.IPcapCommand {
+	return newCommand(fmt.Sprintf("native follow %s %s %d", file, proto, idx), func(ctx context.Context, w io.Writer) error {
+		return writeFollow(ctx, file, proto, idx, w)
+	})
+}
+
+func (c Commands) Indexer(file string, proto string, idx int) pcap.IPcapCommand {
+	return newCommand(fmt.Sprintf("native stream index %s %s %d", file, proto, idx), func(ctx context.Context, w io.Writer) error {
+		return writeStreamPdml(ctx, file, proto, idx, w)
+	})
+}
+
+// decode runs every frame of src, a file name or a reader, through the
+// dissectors and writes those that pass filter to out
+func decode(ctx context.Context, src interface{}, filter *Filter, out writer) error {
+	var capture *Capture
+	var err error
+	switch src := src.(type) {
+	case string:
+		var f *os.File
+		capture, f, err = OpenCapture(src)
+		if err == nil {
+			defer f.Close()
+		}
+	case io.Reader:
+		capture, err = NewCapture(src)
+	default:
+		err = fmt.Errorf("Unexpected packet source %v", src)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := out.header(capture); err != nil {
+		return err
+	}
+	dissector := NewDissector(capture)
+	lo, hi := filter.FrameRange()
+	for {
+		select {
+		case <-ctx.Done():
+			return errKilled
+		default:
+		}
+		frame, err := capture.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if hi > 0 && frame.Number >= hi {
+			break
+		}
+		// Frames before lo are still dissected so stream indices and
+		// relative times stay the same as in an unfiltered load
+		packet := dissector.Dissect(frame)
+		if frame.Number < lo || !filter.Match(packet) {
+			continue
+		}
+		if err := out.packet(packet); err != nil {
+			return err
+		}
+	}
+	return out.footer()
+}
+
+//======================================================================
+
+// command runs a function in a goroutine behind the interface the loaders
+// use for tshark processes
+type command struct {
+	sync.Mutex
+	name string
+	run  func(ctx context.Context, w io.Writer) error
+
+	pr      *io.PipeReader
+	pw      *io.PipeWriter
+	ctx     context.Context
+	cancel  context.CancelFunc
+	started bool
+	done    chan struct{}
+	err     error
+}
+
+var _ pcap.IPcapCommand = (*command)(nil)
+
+func newCommand(name string, run func(ctx context.Context, w io.Writer) error) *command {
+	res := &command{
+		name: name,
+		run:  run,
+		done: make(chan struct{}),
+	}
+	res.ctx, res.cancel = context.WithCancel(context.Background())
+	return res
+}
+
+func (c *command) String() string {
+	return c.name
+}
+
+func (c *command) StdoutReader() (io.ReadCloser, error) {
+	c.Lock()
+	defer c.Unlock()
+	if c.pr == nil {
+		c.pr, c.pw = io.Pipe()
+	}
+	return c.pr, nil
+}
+
+func (c *command) Start() error {
+	c.Lock()
+	defer c.Unlock()
+	if c.started {
+		return fmt.Errorf("%s already started", c.name)
+	}
+	c.started = true
+	var w io.Writer = ioutil.Discard
+	if c.pw != nil {
+		w = c.pw
+	}
+	go func() {
+		err := c.run(c.ctx, w)
+		if c.pw != nil {
+			c.pw.CloseWithError(err)
+		}
+		c.Lock()
+		c.err = err
+		c.Unlock()
+		close(c.done)
+	}()
+	return nil
+}
+
+func (c *command) Wait() error {
+	c.Lock()
+	started := c.started
+	c.Unlock()
+	if !started {
+		return fmt.Errorf("%s not started yet", c.name)
+	}
+	<-c.done
+	c.Lock()
+	defer c.Unlock()
+	return c.err
+}
+
+// Pid returns termshark's own pid once started, so the loader's progress
+// tracking finds the capture file among termshark's open files
+func (c *command) Pid() int {
+	c.Lock()
+	defer c.Unlock()
+	if !c.started {
+		return -1
+	}
+	return os.Getpid()
+}
+
+func (c *command) Kill() error {
+	c.Lock()
+	defer c.Unlock()
+	if !c.started {
+		return fmt.Errorf("%s not started yet", c.name)
+	}
+	select {
+	case <-c.done:
+		return errFinished
+	default:
+	}
+	c.cancel()
+	if c.pw != nil {
+		// unblock a write the reader will never consume
+		c.pw.CloseWithError(errKilled)
+	}
+	return nil
+}
+
+func (c *command) StderrSummary() []string {
+	c.Lock()
+	defer c.Unlock()
+	if c.err == nil || c.err == errKilled {
+		return []string{}
+	}
+	return []string{c.err.Error()}
+}
+
+//======================================================================
+// Local Variables:
+// mode: Go
+// fill-column: 78
+// End:
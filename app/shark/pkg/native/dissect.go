@@ -0,0 +1,640 @@
+// Copyright 2019-2022 Graham Clark. All rights reserved.  Use of this source
+// code is governed by the MIT license that can be found in the LICENSE
+// file.
+
+package native
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+//======================================================================
+
+// Field is a node of the dissection tree. The top level nodes of a packet
+// are protocols, written as <proto> in PDML; everything below is a <field>.
+type Field struct {
+	Name     string
+	Show     string
+	Showname string
+	Value    string // hex of the covered bytes; computed from Pos and Size if empty
+	Pos      int
+	Size     int
+	Hide     bool
+	Fields   []*Field
+}
+
+func (f *Field) add(name string, pos, size int, show string, showname string) *Field {
+	res := &Field{Name: name, Pos: pos, Size: size, Show: show, Showname: showname}
+	f.Fields = append(f.Fields, res)
+	return res
+}
+
+func (f *Field) hidden(name string, pos, size int, show string) {
+	f.add(name, pos, size, show, "").Hide = true
+}
+
+// Packet is a dissected frame along with the summary used for PSML columns
+// and display filters.
+type Packet struct {
+	Frame  *Frame
+	Protos []*Field
+
+	Protocol string
+	Info     string
+	DLSrc    string
+	DLDst    string
+	NetSrc   string
+	NetDst   string
+	SrcPort  string
+	DstPort  string
+	VLAN     string
+	DSCP     string
+
+	Relative time.Duration // since the first frame
+	Delta    time.Duration // since the previous frame
+
+	values map[string][]string
+}
+
+func (p *Packet) proto(name string, pos, size int, showname string) *Field {
+	res := &Field{Name: name, Pos: pos, Size: size, Showname: showname}
+	p.Protos = append(p.Protos, res)
+	return res
+}
+
+// Values returns the shown values of every field called name.
+func (p *Packet) Values(name string) []string {
+	return p.values[name]
+}
+
+// Has is true if the packet has a protocol or field called name.
+func (p *Packet) Has(name string) bool {
+	_, ok := p.values[name]
+	return ok
+}
+
+func (p *Packet) index() {
+	p.values = make(map[string][]string)
+	var walk func(fields []*Field)
+	walk = func(fields []*Field) {
+		for _, f := range fields {
+			if f.Name != "" {
+				p.values[f.Name] = append(p.values[f.Name], f.Show)
+			}
+			walk(f.Fields)
+		}
+	}
+	for _, proto := range p.Protos {
+		if _, ok := p.values[proto.Name]; !ok {
+			p.values[proto.Name] = nil
+		}
+		walk(proto.Fields)
+	}
+}
+
+//======================================================================
+
+// Dissector decodes frames in capture order. It holds the state that spans
+// frames: reference times, conversation indices, TCP sequence bases and the
+// TLS version negotiated per TCP stream.
+type Dissector struct {
+	capture *Capture
+
+	first time.Time
+	prev  time.Time
+	seen  bool
+
+	tcpStreams map[string]int
+	udpStreams map[string]int
+	seqBase    map[string]uint32 // per direction of a TCP stream
+	tlsVersion map[int]string    // per TCP stream
+}
+
+func NewDissector(c *Capture) *Dissector {
+	return &Dissector{
+		capture:    c,
+		tcpStreams: make(map[string]int),
+		udpStreams: make(map[string]int),
+		seqBase:    make(map[string]uint32),
+		tlsVersion: make(map[int]string),
+	}
+}
+
+// Dissect decodes f. Frames must be passed in order, including those that
+// are filtered out, so that times and stream indices match tshark's.
+func (d *Dissector) Dissect(f *Frame) *Packet {
+	p := &Packet{Frame: f}
+	if !d.seen {
+		d.first, d.prev, d.seen = f.Timestamp, f.Timestamp, true
+	}
+	p.Relative = f.Timestamp.Sub(d.first)
+	p.Delta = f.Timestamp.Sub(d.prev)
+	d.prev = f.Timestamp
+
+	d.frame(p)
+
+	pkt := gopacket.NewPacket(f.Data, f.LinkType, gopacket.DecodeOptions{NoCopy: true})
+	off := 0
+	var ipSrc, ipDst string
+loop:
+	for _, layer := range pkt.Layers() {
+		contents := layer.LayerContents()
+		switch l := layer.(type) {
+		case *layers.Ethernet:
+			d.ethernet(p, l, off)
+		case *layers.Dot1Q:
+			d.dot1q(p, l, off)
+		case *layers.IPv4:
+			d.ipv4(p, l, off)
+			ipSrc, ipDst = l.SrcIP.String(), l.DstIP.String()
+		case *layers.IPv6:
+			d.ipv6(p, l, off)
+			ipSrc, ipDst = l.SrcIP.String(), l.DstIP.String()
+		case *layers.ARP:
+			d.arp(p, l, off)
+		case *layers.ICMPv4:
+			d.icmp(p, "icmp", "ICMP", "Internet Control Message Protocol", l.TypeCode.String(), uint8(l.TypeCode>>8), uint8(l.TypeCode), l.Checksum, off, len(contents)+len(l.Payload))
+			break loop
+		case *layers.ICMPv6:
+			d.icmp(p, "icmpv6", "ICMPv6", "Internet Control Message Protocol v6", l.TypeCode.String(), uint8(l.TypeCode>>8), uint8(l.TypeCode), l.Checksum, off, len(contents)+len(l.Payload))
+			break loop
+		case *layers.TCP:
+			d.tcp(p, l, ipSrc, ipDst, off)
+			break loop
+		case *layers.UDP:
+			d.udp(p, l, ipSrc, ipDst, off)
+			break loop
+		case *gopacket.DecodeFailure:
+			p.proto("_ws.malformed", off, len(f.Data)-off, fmt.Sprintf("[Malformed Packet: %v]", l.Error()))
+			p.Info = strings.TrimSpace(p.Info + " [Malformed Packet]")
+			break loop
+		case gopacket.Payload:
+			data(p, off, len(l))
+			break loop
+		default:
+			// Decoded by gopacket but not dissected here - show the protocol
+			// so the packet list still says what it is
+			name := layer.LayerType().String()
+			p.proto(strings.ToLower(name), off, len(contents), name)
+			p.Protocol = name
+		}
+		off += len(contents)
+	}
+
+	if p.Protocol == "" && len(p.Protos) > 0 {
+		p.Protocol = p.Protos[len(p.Protos)-1].Showname
+	}
+	d.protocols(p)
+	p.index()
+	return p
+}
+
+func (d *Dissector) frame(p *Packet) {
+	f := p.Frame
+	size := len(f.Data)
+	epoch := fmt.Sprintf("%d.%09d", f.Timestamp.Unix(), f.Timestamp.Nanosecond())
+	local := f.Timestamp.Local().Format("Jan _2, 2006 15:04:05.000000000 MST")
+
+	gen := p.proto("geninfo", 0, size, "General information")
+	gen.add("num", 0, size, strconv.Itoa(f.Number), "Number").Value = strconv.FormatInt(int64(f.Number), 16)
+	gen.add("len", 0, size, strconv.Itoa(f.Length), "Frame Length").Value = strconv.FormatInt(int64(f.Length), 16)
+	gen.add("caplen", 0, size, strconv.Itoa(size), "Captured Length").Value = strconv.FormatInt(int64(size), 16)
+	gen.add("timestamp", 0, size, local, "Captured Time").Value = epoch
+
+	if len(f.Comments) > 0 {
+		comments := p.proto("pkt_comment", 0, 0, "Packet comments")
+		for _, c := range f.Comments {
+			comments.add("frame.comment", 0, 0, c, c)
+		}
+	}
+
+	frame := p.proto("frame", 0, size, fmt.Sprintf("Frame %d: %d bytes on wire (%d bits), %d bytes captured (%d bits)",
+		f.Number, f.Length, f.Length*8, size, size*8))
+	if d.capture != nil && f.Interface < len(d.capture.Interfaces) {
+		iface := d.capture.Interfaces[f.Interface]
+		id := frame.add("frame.interface_id", 0, 0, strconv.Itoa(f.Interface), fmt.Sprintf("Interface id: %d (%s)", f.Interface, ifaceLabel(iface)))
+		if iface.Name != "" {
+			id.add("frame.interface_name", 0, 0, iface.Name, "Interface name: "+iface.Name)
+		}
+		if iface.Description != "" {
+			id.add("frame.interface_description", 0, 0, iface.Description, "Interface description: "+iface.Description)
+		}
+	}
+	frame.add("frame.encap_type", 0, 0, strconv.Itoa(int(f.LinkType)), fmt.Sprintf("Encapsulation type: %s (%d)", f.LinkType, f.LinkType))
+	frame.add("frame.time", 0, 0, local, "Arrival Time: "+local)
+	frame.add("frame.time_epoch", 0, 0, epoch, fmt.Sprintf("Epoch Time: %s seconds", epoch))
+	frame.add("frame.time_delta", 0, 0, seconds(p.Delta), fmt.Sprintf("Time delta from previous captured frame: %s seconds", seconds(p.Delta)))
+	frame.add("frame.time_relative", 0, 0, seconds(p.Relative), fmt.Sprintf("Time since reference or first frame: %s seconds", seconds(p.Relative)))
+	frame.add("frame.number", 0, 0, strconv.Itoa(f.Number), fmt.Sprintf("Frame Number: %d", f.Number))
+	frame.add("frame.len", 0, 0, strconv.Itoa(f.Length), fmt.Sprintf("Frame Length: %d bytes (%d bits)", f.Length, f.Length*8))
+	frame.add("frame.cap_len", 0, 0, strconv.Itoa(size), fmt.Sprintf("Capture Length: %d bytes (%d bits)", size, size*8))
+}
+
+// protocols fills in frame.protocols once the layers are known
+func (d *Dissector) protocols(p *Packet) {
+	var names []string
+	var frame *Field
+	for _, proto := range p.Protos {
+		switch proto.Name {
+		case "geninfo", "pkt_comment":
+		case "frame":
+			frame = proto
+		default:
+			names = append(names, proto.Name)
+		}
+	}
+	if frame != nil {
+		list := strings.Join(names, ":")
+		frame.add("frame.protocols", 0, 0, list, "Protocols in frame: "+list)
+	}
+}
+
+func (d *Dissector) ethernet(p *Packet, l *layers.Ethernet, off int) {
+	src, dst := l.SrcMAC.String(), l.DstMAC.String()
+	eth := p.proto("eth", off, len(l.Contents), fmt.Sprintf("Ethernet II, Src: %s, Dst: %s", src, dst))
+	eth.add("eth.dst", off, 6, dst, "Destination: "+dst)
+	eth.add("eth.src", off+6, 6, src, "Source: "+src)
+	eth.hidden("eth.addr", off, 6, dst)
+	eth.hidden("eth.addr", off+6, 6, src)
+	if len(l.Contents) >= 14 {
+		eth.add("eth.type", off+12, 2, hex16(uint16(l.EthernetType)), fmt.Sprintf("Type: %s (%s)", l.EthernetType, hex16(uint16(l.EthernetType))))
+	}
+	p.DLSrc, p.DLDst = src, dst
+	p.Protocol = "Ethernet"
+}
+
+func (d *Dissector) dot1q(p *Packet, l *layers.Dot1Q, off int) {
+	id := strconv.Itoa(int(l.VLANIdentifier))
+	vlan := p.proto("vlan", off, len(l.Contents), fmt.Sprintf("802.1Q Virtual LAN, PRI: %d, DEI: %d, ID: %s", l.Priority, btoi(l.DropEligible), id))
+	vlan.add("vlan.priority", off, 2, strconv.Itoa(int(l.Priority)), fmt.Sprintf("Priority: %d", l.Priority))
+	vlan.add("vlan.dei", off, 2, strconv.Itoa(btoi(l.DropEligible)), fmt.Sprintf("DEI: %d", btoi(l.DropEligible)))
+	vlan.add("vlan.id", off, 2, id, "ID: "+id)
+	vlan.add("vlan.etype", off+2, 2, hex16(uint16(l.Type)), fmt.Sprintf("Type: %s (%s)", l.Type, hex16(uint16(l.Type))))
+	if p.VLAN == "" {
+		p.VLAN = id
+	}
+	p.Protocol = "802.1Q"
+}
+
+func (d *Dissector) ipv4(p *Packet, l *layers.IPv4, off int) {
+	src, dst := l.SrcIP.String(), l.DstIP.String()
+	ip := p.proto("ip", off, len(l.Contents), fmt.Sprintf("Internet Protocol Version 4, Src: %s, Dst: %s", src, dst))
+	ip.add("ip.version", off, 1, "4", "Version: 4")
+	ip.add("ip.hdr_len", off, 1, strconv.Itoa(int(l.IHL)*4), fmt.Sprintf("Header Length: %d bytes (%d)", int(l.IHL)*4, l.IHL))
+	ds := ip.add("ip.dsfield", off+1, 1, hex8(l.TOS), fmt.Sprintf("Differentiated Services Field: %s", hex8(l.TOS)))
+	ds.add("ip.dsfield.dscp", off+1, 1, strconv.Itoa(int(l.TOS>>2)), fmt.Sprintf("Differentiated Services Codepoint: %d", l.TOS>>2))
+	ds.add("ip.dsfield.ecn", off+1, 1, strconv.Itoa(int(l.TOS&3)), fmt.Sprintf("Explicit Congestion Notification: %d", l.TOS&3))
+	ip.add("ip.len", off+2, 2, strconv.Itoa(int(l.Length)), fmt.Sprintf("Total Length: %d", l.Length))
+	ip.add("ip.id", off+4, 2, hex16(l.Id), fmt.Sprintf("Identification: %s (%d)", hex16(l.Id), l.Id))
+	flags := ip.add("ip.flags", off+6, 1, hex8(uint8(l.Flags)), fmt.Sprintf("Flags: %s", hex8(uint8(l.Flags))))
+	flags.add("ip.flags.df", off+6, 1, strconv.Itoa(btoi(l.Flags&layers.IPv4DontFragment != 0)), fmt.Sprintf("Don't fragment: %s", setStr(l.Flags&layers.IPv4DontFragment != 0)))
+	flags.add("ip.flags.mf", off+6, 1, strconv.Itoa(btoi(l.Flags&layers.IPv4MoreFragments != 0)), fmt.Sprintf("More fragments: %s", setStr(l.Flags&layers.IPv4MoreFragments != 0)))
+	ip.add("ip.frag_offset", off+6, 2, strconv.Itoa(int(l.FragOffset)), fmt.Sprintf("Fragment Offset: %d", l.FragOffset))
+	ip.add("ip.ttl", off+8, 1, strconv.Itoa(int(l.TTL)), fmt.Sprintf("Time to Live: %d", l.TTL))
+	ip.add("ip.proto", off+9, 1, strconv.Itoa(int(l.Protocol)), fmt.Sprintf("Protocol: %s (%d)", l.Protocol, l.Protocol))
+	ip.add("ip.checksum", off+10, 2, hex16(l.Checksum), fmt.Sprintf("Header Checksum: %s", hex16(l.Checksum)))
+	ip.add("ip.src", off+12, 4, src, "Source Address: "+src)
+	ip.add("ip.dst", off+16, 4, dst, "Destination Address: "+dst)
+	ip.hidden("ip.addr", off+12, 4, src)
+	ip.hidden("ip.addr", off+16, 4, dst)
+	p.NetSrc, p.NetDst = src, dst
+	p.DSCP = strconv.Itoa(int(l.TOS >> 2))
+	p.Protocol = "IPv4"
+}
+
+func (d *Dissector) ipv6(p *Packet, l *layers.IPv6, off int) {
+	src, dst := l.SrcIP.String(), l.DstIP.String()
+	ip := p.proto("ipv6", off, len(l.Contents), fmt.Sprintf("Internet Protocol Version 6, Src: %s, Dst: %s", src, dst))
+	ip.add("ipv6.version", off, 1, "6", "Version: 6")
+	ip.add("ipv6.tclass", off, 2, hex8(l.TrafficClass), fmt.Sprintf("Traffic Class: %s", hex8(l.TrafficClass)))
+	ip.add("ipv6.flow", off+1, 3, fmt.Sprintf("0x%05x", l.FlowLabel), fmt.Sprintf("Flow Label: 0x%05x", l.FlowLabel))
+	ip.add("ipv6.plen", off+4, 2, strconv.Itoa(int(l.Length)), fmt.Sprintf("Payload Length: %d", l.Length))
+	ip.add("ipv6.nxt", off+6, 1, strconv.Itoa(int(l.NextHeader)), fmt.Sprintf("Next Header: %s (%d)", l.NextHeader, l.NextHeader))
+	ip.add("ipv6.hlim", off+7, 1, strconv.Itoa(int(l.HopLimit)), fmt.Sprintf("Hop Limit: %d", l.HopLimit))
+	ip.add("ipv6.src", off+8, 16, src, "Source Address: "+src)
+	ip.add("ipv6.dst", off+24, 16, dst, "Destination Address: "+dst)
+	ip.hidden("ipv6.addr", off+8, 16, src)
+	ip.hidden("ipv6.addr", off+24, 16, dst)
+	p.NetSrc, p.NetDst = src, dst
+	p.DSCP = strconv.Itoa(int(l.TrafficClass >> 2))
+	p.Protocol = "IPv6"
+}
+
+func (d *Dissector) arp(p *Packet, l *layers.ARP, off int) {
+	op := "reply"
+	if l.Operation == layers.ARPRequest {
+		op = "request"
+	}
+	arp := p.proto("arp", off, len(l.Contents), fmt.Sprintf("Address Resolution Protocol (%s)", op))
+	arp.add("arp.opcode", off+6, 2, strconv.Itoa(int(l.Operation)), fmt.Sprintf("Opcode: %s (%d)", op, l.Operation))
+	spa, tpa := ipString(l.SourceProtAddress), ipString(l.DstProtAddress)
+	sha, tha := macString(l.SourceHwAddress), macString(l.DstHwAddress)
+	shaPos := off + 8
+	spaPos := shaPos + int(l.HwAddressSize)
+	thaPos := spaPos + int(l.ProtAddressSize)
+	tpaPos := thaPos + int(l.HwAddressSize)
+	arp.add("arp.src.hw_mac", shaPos, int(l.HwAddressSize), sha, "Sender MAC address: "+sha)
+	arp.add("arp.src.proto_ipv4", spaPos, int(l.ProtAddressSize), spa, "Sender IP address: "+spa)
+	arp.add("arp.dst.hw_mac", thaPos, int(l.HwAddressSize), tha, "Target MAC address: "+tha)
+	arp.add("arp.dst.proto_ipv4", tpaPos, int(l.ProtAddressSize), tpa, "Target IP address: "+tpa)
+	if l.Operation == layers.ARPRequest {
+		p.Info = fmt.Sprintf("Who has %s? Tell %s", tpa, spa)
+	} else {
+		p.Info = fmt.Sprintf("%s is at %s", spa, sha)
+	}
+	p.Protocol = "ARP"
+}
+
+func (d *Dissector) icmp(p *Packet, name, protocol, showname, typeCode string, typ, code uint8, checksum uint16, off, size int) {
+	icmp := p.proto(name, off, size, showname)
+	icmp.add(name+".type", off, 1, strconv.Itoa(int(typ)), fmt.Sprintf("Type: %d", typ))
+	icmp.add(name+".code", off+1, 1, strconv.Itoa(int(code)), fmt.Sprintf("Code: %d", code))
+	icmp.add(name+".checksum", off+2, 2, hex16(checksum), fmt.Sprintf("Checksum: %s", hex16(checksum)))
+	p.Protocol = protocol
+	p.Info = typeCode
+}
+
+func (d *Dissector) tcp(p *Packet, l *layers.TCP, src, dst string, off int) {
+	sport, dport := int(l.SrcPort), int(l.DstPort)
+	stream := streamIndex(d.tcpStreams, src, sport, dst, dport)
+	seq, ack := d.relativeSeq(l, src, dst)
+	hdr := len(l.Contents)
+	payload := l.Payload
+
+	tcp := p.proto("tcp", off, hdr, fmt.Sprintf("Transmission Control Protocol, Src Port: %d, Dst Port: %d, Seq: %d, Ack: %d, Len: %d",
+		sport, dport, seq, ack, len(payload)))
+	tcp.add("tcp.srcport", off, 2, strconv.Itoa(sport), fmt.Sprintf("Source Port: %d", sport))
+	tcp.add("tcp.dstport", off+2, 2, strconv.Itoa(dport), fmt.Sprintf("Destination Port: %d", dport))
+	tcp.hidden("tcp.port", off, 2, strconv.Itoa(sport))
+	tcp.hidden("tcp.port", off+2, 2, strconv.Itoa(dport))
+	tcp.add("tcp.stream", 0, 0, strconv.Itoa(stream), fmt.Sprintf("Stream index: %d", stream))
+	tcp.add("tcp.len", off, 0, strconv.Itoa(len(payload)), fmt.Sprintf("TCP Segment Len: %d", len(payload)))
+	tcp.add("tcp.seq", off+4, 4, strconv.FormatUint(uint64(seq), 10), fmt.Sprintf("Sequence number: %d    (relative sequence number)", seq))
+	tcp.add("tcp.seq_raw", off+4, 4, strconv.FormatUint(uint64(l.Seq), 10), fmt.Sprintf("Sequence number (raw): %d", l.Seq))
+	if l.ACK {
+		tcp.add("tcp.ack", off+8, 4, strconv.FormatUint(uint64(ack), 10), fmt.Sprintf("Acknowledgment number: %d    (relative ack number)", ack))
+		tcp.add("tcp.ack_raw", off+8, 4, strconv.FormatUint(uint64(l.Ack), 10), fmt.Sprintf("Acknowledgment number (raw): %d", l.Ack))
+	}
+	tcp.add("tcp.hdr_len", off+12, 1, strconv.Itoa(hdr), fmt.Sprintf("Header Length: %d bytes (%d)", hdr, l.DataOffset))
+
+	names := tcpFlagNames(l)
+	flagBits := tcpFlagBits(l)
+	flags := tcp.add("tcp.flags", off+12, 2, fmt.Sprintf("0x%03x", flagBits), fmt.Sprintf("Flags: 0x%03x (%s)", flagBits, strings.Join(names, ", ")))
+	for _, fl := range []struct {
+		name  string
+		label string
+		set   bool
+	}{
+		{"tcp.flags.cwr", "Congestion Window Reduced (CWR)", l.CWR},
+		{"tcp.flags.ecn", "ECN-Echo", l.ECE},
+		{"tcp.flags.urg", "Urgent", l.URG},
+		{"tcp.flags.ack", "Acknowledgment", l.ACK},
+		{"tcp.flags.push", "Push", l.PSH},
+		{"tcp.flags.reset", "Reset", l.RST},
+		{"tcp.flags.syn", "Syn", l.SYN},
+		{"tcp.flags.fin", "Fin", l.FIN},
+	} {
+		flags.add(fl.name, off+13, 1, strconv.Itoa(btoi(fl.set)), fmt.Sprintf("%s: %s", fl.label, setStr(fl.set)))
+	}
+	tcp.add("tcp.window_size_value", off+14, 2, strconv.Itoa(int(l.Window)), fmt.Sprintf("Window: %d", l.Window))
+	tcp.add("tcp.checksum", off+16, 2, hex16(l.Checksum), fmt.Sprintf("Checksum: %s", hex16(l.Checksum)))
+	tcp.add("tcp.urgent_pointer", off+18, 2, strconv.Itoa(int(l.Urgent)), fmt.Sprintf("Urgent Pointer: %d", l.Urgent))
+	tsval, tsecr, hasTs := tcpOptions(tcp, l, off)
+	if len(payload) > 0 {
+		tcp.add("tcp.payload", off+hdr, len(payload), "", fmt.Sprintf("TCP payload (%d bytes)", len(payload)))
+	}
+
+	p.SrcPort, p.DstPort = strconv.Itoa(sport), strconv.Itoa(dport)
+	p.Protocol = "TCP"
+	p.Info = fmt.Sprintf("%d → %d [%s] Seq=%d", sport, dport, strings.Join(names, ", "), seq)
+	if l.ACK {
+		p.Info += fmt.Sprintf(" Ack=%d", ack)
+	}
+	p.Info += fmt.Sprintf(" Win=%d Len=%d", l.Window, len(payload))
+	if hasTs {
+		p.Info += fmt.Sprintf(" TSval=%d TSecr=%d", tsval, tsecr)
+	}
+
+	if len(payload) > 0 {
+		d.tcpPayload(p, stream, sport, dport, payload, off+hdr)
+	}
+}
+
+// tcpOptions adds the options below tcp and returns the timestamps, if any
+func tcpOptions(tcp *Field, l *layers.TCP, off int) (uint32, uint32, bool) {
+	if len(l.Options) == 0 {
+		return 0, 0, false
+	}
+	var tsval, tsecr uint32
+	hasTs := false
+	pos := off + 20
+	opts := tcp.add("tcp.options", pos, len(l.Contents)-20, "", fmt.Sprintf("Options: (%d bytes)", len(l.Contents)-20))
+	for _, opt := range l.Options {
+		size := int(opt.OptionLength)
+		if opt.OptionType == layers.TCPOptionKindNop || opt.OptionType == layers.TCPOptionKindEndList {
+			size = 1
+		}
+		switch {
+		case opt.OptionType == layers.TCPOptionKindMSS && len(opt.OptionData) == 2:
+			mss := int(opt.OptionData[0])<<8 | int(opt.OptionData[1])
+			opts.add("tcp.options.mss_val", pos+2, 2, strconv.Itoa(mss), fmt.Sprintf("Maximum segment size: %d bytes", mss))
+		case opt.OptionType == layers.TCPOptionKindWindowScale && len(opt.OptionData) == 1:
+			opts.add("tcp.options.wscale.shift", pos+2, 1, strconv.Itoa(int(opt.OptionData[0])), fmt.Sprintf("Window scale: %d", opt.OptionData[0]))
+		case opt.OptionType == layers.TCPOptionKindSACKPermitted:
+			opts.add("tcp.options.sack_perm", pos, size, "", "TCP SACK Permitted Option: True")
+		case opt.OptionType == layers.TCPOptionKindTimestamps && len(opt.OptionData) == 8:
+			tsval = binary.BigEndian.Uint32(opt.OptionData[0:4])
+			tsecr = binary.BigEndian.Uint32(opt.OptionData[4:8])
+			hasTs = true
+			ts := opts.add("", pos, size, "", fmt.Sprintf("Timestamps: TSval %d, TSecr %d", tsval, tsecr))
+			ts.add("tcp.options.timestamp.tsval", pos+2, 4, strconv.FormatUint(uint64(tsval), 10), fmt.Sprintf("Timestamp value: %d", tsval))
+			ts.add("tcp.options.timestamp.tsecr", pos+6, 4, strconv.FormatUint(uint64(tsecr), 10), fmt.Sprintf("Timestamp echo reply: %d", tsecr))
+		}
+		pos += size
+	}
+	return tsval, tsecr, hasTs
+}
+
+// relativeSeq returns sequence and acknowledgement numbers relative to the
+// first segment seen in each direction, as tshark does by default
+func (d *Dissector) relativeSeq(l *layers.TCP, src, dst string) (uint32, uint32) {
+	fwd := fmt.Sprintf("%s:%d>%s:%d", src, l.SrcPort, dst, l.DstPort)
+	rev := fmt.Sprintf("%s:%d>%s:%d", dst, l.DstPort, src, l.SrcPort)
+	base, ok := d.seqBase[fwd]
+	if !ok || l.SYN {
+		base = l.Seq
+		if !l.SYN {
+			base--
+		}
+		d.seqBase[fwd] = base
+	}
+	revBase, ok := d.seqBase[rev]
+	if !ok && l.ACK {
+		// the other side has not been seen yet; what it will send starts here
+		revBase = l.Ack - 1
+		d.seqBase[rev] = revBase
+	}
+	return l.Seq - base, l.Ack - revBase
+}
+
+func (d *Dissector) udp(p *Packet, l *layers.UDP, src, dst string, off int) {
+	sport, dport := int(l.SrcPort), int(l.DstPort)
+	stream := streamIndex(d.udpStreams, src, sport, dst, dport)
+	udp := p.proto("udp", off, len(l.Contents), fmt.Sprintf("User Datagram Protocol, Src Port: %d, Dst Port: %d", sport, dport))
+	udp.add("udp.srcport", off, 2, strconv.Itoa(sport), fmt.Sprintf("Source Port: %d", sport))
+	udp.add("udp.dstport", off+2, 2, strconv.Itoa(dport), fmt.Sprintf("Destination Port: %d", dport))
+	udp.hidden("udp.port", off, 2, strconv.Itoa(sport))
+	udp.hidden("udp.port", off+2, 2, strconv.Itoa(dport))
+	udp.add("udp.length", off+4, 2, strconv.Itoa(int(l.Length)), fmt.Sprintf("Length: %d", l.Length))
+	udp.add("udp.checksum", off+6, 2, hex16(l.Checksum), fmt.Sprintf("Checksum: %s", hex16(l.Checksum)))
+	udp.add("udp.stream", 0, 0, strconv.Itoa(stream), fmt.Sprintf("Stream index: %d", stream))
+
+	p.SrcPort, p.DstPort = strconv.Itoa(sport), strconv.Itoa(dport)
+	p.Protocol = "UDP"
+	p.Info = fmt.Sprintf("%d → %d Len=%d", sport, dport, len(l.Payload))
+
+	payload := l.Payload
+	if len(payload) == 0 {
+		return
+	}
+	switch {
+	case sport == 53 || dport == 53 || sport == 5353 || dport == 5353:
+		if dissectDNS(p, payload, off+len(l.Contents)) {
+			return
+		}
+	case (sport == 1900 || dport == 1900) && isHTTP(payload):
+		dissectHTTP(p, payload, off+len(l.Contents))
+		p.Protocol = "SSDP"
+		return
+	}
+	data(p, off+len(l.Contents), len(payload))
+}
+
+func (d *Dissector) tcpPayload(p *Packet, stream, sport, dport int, payload []byte, off int) {
+	switch {
+	case (sport == 53 || dport == 53) && len(payload) > 2:
+		// DNS over TCP is prefixed by the message length
+		if dissectDNS(p, payload[2:], off+2) {
+			return
+		}
+	case isHTTP(payload):
+		dissectHTTP(p, payload, off)
+		return
+	case isTLS(payload):
+		if version := dissectTLS(p, payload, off, d.tlsVersion[stream]); version != "" {
+			d.tlsVersion[stream] = version
+		}
+		return
+	case d.tlsVersion[stream] != "":
+		// continuation of a record split across segments
+		p.proto("tls", off, len(payload), "Transport Layer Security")
+		p.Protocol = d.tlsVersion[stream]
+		p.Info = "Continuation Data"
+		return
+	}
+	data(p, off, len(payload))
+}
+
+// data shows bytes no dissector understood
+func data(p *Packet, off, size int) {
+	proto := p.proto("data", off, size, fmt.Sprintf("Data (%d bytes)", size))
+	proto.add("data.data", off, size, "", "Data")
+	proto.add("data.len", off, 0, strconv.Itoa(size), fmt.Sprintf("Length: %d", size))
+}
+
+//======================================================================
+
+// streamIndex numbers conversations in order of appearance, regardless of
+// direction
+func streamIndex(streams map[string]int, src string, sport int, dst string, dport int) int {
+	a := fmt.Sprintf("%s:%d", src, sport)
+	b := fmt.Sprintf("%s:%d", dst, dport)
+	if b < a {
+		a, b = b, a
+	}
+	key := a + " " + b
+	idx, ok := streams[key]
+	if !ok {
+		idx = len(streams)
+		streams[key] = idx
+	}
+	return idx
+}
+
+func tcpFlagNames(l *layers.TCP) []string {
+	var names []string
+	for _, fl := range []struct {
+		name string
+		set  bool
+	}{
+		{"FIN", l.FIN}, {"SYN", l.SYN}, {"RST", l.RST}, {"PSH", l.PSH},
+		{"ACK", l.ACK}, {"URG", l.URG}, {"ECE", l.ECE}, {"CWR", l.CWR}, {"NS", l.NS},
+	} {
+		if fl.set {
+			names = append(names, fl.name)
+		}
+	}
+	if len(names) == 0 {
+		names = []string{"<None>"}
+	}
+	return names
+}
+
+func tcpFlagBits(l *layers.TCP) int {
+	res := 0
+	for i, set := range []bool{l.FIN, l.SYN, l.RST, l.PSH, l.ACK, l.URG, l.ECE, l.CWR, l.NS} {
+		if set {
+			res |= 1 << uint(i)
+		}
+	}
+	return res
+}
+
+func ifaceLabel(iface Interface) string {
+	switch {
+	case iface.Name != "":
+		return iface.Name
+	case iface.Description != "":
+		return iface.Description
+	}
+	return "unknown"
+}
+
+func seconds(d time.Duration) string {
+	return fmt.Sprintf("%.9f", d.Seconds())
+}
+
+func hex8(v uint8) string {
+	return fmt.Sprintf("0x%02x", v)
+}
+
+func hex16(v uint16) string {
+	return fmt.Sprintf("0x%04x", v)
+}
+
+func btoi(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func setStr(b bool) string {
+	if b {
+		return "Set"
+	}
+	return "Not set"
+}
+
+//======================================================================
+// Local Variables:
+// mode: Go
+// fill-column: 78
+// End:
@@ -0,0 +1,439 @@
+// Copyright 2019-2022 Graham Clark. All rights reserved.  Use of this source
+// code is governed by the MIT license that can be found in the LICENSE
+// file.
+
+package native
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//======================================================================
+
+// knownFields are the protocols and fields the native dissectors produce.
+// A display filter naming anything else cannot be evaluated natively.
+var knownFields = map[string]bool{}
+
+func init() {
+	for _, name := range strings.Fields(`
+		frame frame.number frame.len frame.cap_len frame.time frame.time_epoch
+		frame.time_delta frame.time_relative frame.encap_type frame.protocols
+		frame.interface_id frame.interface_name frame.interface_description
+		pkt_comment frame.comment _ws.malformed data data.data data.len
+		eth eth.dst eth.src eth.addr eth.type
+		vlan vlan.priority vlan.dei vlan.id vlan.etype
+		ip ip.version ip.hdr_len ip.dsfield ip.dsfield.dscp ip.dsfield.ecn ip.len
+		ip.id ip.flags ip.flags.df ip.flags.mf ip.frag_offset ip.ttl ip.proto
+		ip.checksum ip.src ip.dst ip.addr
+		ipv6 ipv6.version ipv6.tclass ipv6.flow ipv6.plen ipv6.nxt ipv6.hlim
+		ipv6.src ipv6.dst ipv6.addr
+		arp arp.opcode arp.src.hw_mac arp.src.proto_ipv4 arp.dst.hw_mac arp.dst.proto_ipv4
+		icmp icmp.type icmp.code icmp.checksum
+		icmpv6 icmpv6.type icmpv6.code icmpv6.checksum
+		tcp tcp.srcport tcp.dstport tcp.port tcp.stream tcp.len tcp.seq tcp.seq_raw
+		tcp.ack tcp.ack_raw tcp.hdr_len tcp.flags tcp.flags.cwr tcp.flags.ecn
+		tcp.flags.urg tcp.flags.ack tcp.flags.push tcp.flags.reset tcp.flags.syn
+		tcp.flags.fin tcp.window_size_value tcp.checksum tcp.urgent_pointer tcp.payload
+		tcp.options tcp.options.mss_val tcp.options.wscale.shift tcp.options.sack_perm
+		tcp.options.timestamp.tsval tcp.options.timestamp.tsecr
+		udp udp.srcport udp.dstport udp.port udp.length udp.checksum udp.stream
+		dns dns.id dns.flags dns.flags.response dns.flags.opcode dns.flags.rcode
+		dns.count.queries dns.count.answers dns.count.auth_rr dns.count.add_rr
+		dns.qry.name dns.qry.type dns.qry.class dns.resp.name dns.resp.type
+		dns.resp.ttl dns.resp.len dns.a dns.aaaa dns.cname dns.ns
+		dns.ptr.domain_name dns.mx.mail_exchange dns.txt
+		http http.request http.response http.request.method http.request.uri
+		http.request.version http.response.version http.response.code
+		http.response.phrase http.request.line http.response.line http.host
+		http.user_agent http.accept http.content_type http.content_length_header
+		http.connection http.cookie http.set_cookie http.referer http.location
+		http.server http.authorization http.file_data
+		tls tls.record tls.record.content_type tls.record.version tls.record.length
+		tls.handshake tls.handshake.type tls.handshake.length tls.handshake.version
+		tls.handshake.random tls.handshake.session_id_length
+		tls.handshake.cipher_suites_length tls.handshake.ciphersuite
+		tls.handshake.extensions_server_name tls.handshake.extensions_alpn_str
+		tls.handshake.extensions.supported_version tls.handshake.certificates_length
+	`) {
+		knownFields[name] = true
+	}
+}
+
+// FieldNames returns the protocols and fields the native dissectors produce,
+// sorted.
+func FieldNames() []string {
+	res := make([]string, 0, len(knownFields))
+	for name := range knownFields {
+		res = append(res, name)
+	}
+	sort.Strings(res)
+	return res
+}
+
+//======================================================================
+
+// Filter is a display filter in the subset of Wireshark's syntax that the
+// native dissectors can evaluate: protocol and field tests combined with
+// and/or/not, comparisons with == != < <= > >= (or eq, ne, ...), contains
+// and matches. A nil Filter matches everything.
+type Filter struct {
+	root filterNode
+}
+
+// UnsupportedFilterError means a filter cannot be evaluated natively; it may
+// still be valid for tshark.
+type UnsupportedFilterError struct {
+	Filter string
+	Reason string
+}
+
+func (e UnsupportedFilterError) Error() string {
+	return fmt.Sprintf("Display filter %q is not supported without tshark: %s", e.Filter, e.Reason)
+}
+
+// ParseFilter parses a display filter. An empty filter gives a nil Filter.
+func ParseFilter(s string) (*Filter, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+	tokens, err := lexFilter(s)
+	if err != nil {
+		return nil, UnsupportedFilterError{Filter: s, Reason: err.Error()}
+	}
+	p := &filterParser{tokens: tokens}
+	root, err := p.or()
+	if err == nil && p.pos < len(p.tokens) {
+		err = fmt.Errorf("unexpected %q", p.tokens[p.pos].text)
+	}
+	if err != nil {
+		return nil, UnsupportedFilterError{Filter: s, Reason: err.Error()}
+	}
+	return &Filter{root: root}, nil
+}
+
+// Match is true if p passes the filter.
+func (f *Filter) Match(p *Packet) bool {
+	if f == nil {
+		return true
+	}
+	return f.root.match(p)
+}
+
+// FrameRange returns bounds on frame.number implied by the filter, so that
+// readers can skip decoding early frames and stop at the last one. hi is 0
+// when there is no upper bound.
+func (f *Filter) FrameRange() (lo int, hi int) {
+	lo = 1
+	if f == nil {
+		return
+	}
+	var walk func(n filterNode)
+	walk = func(n filterNode) {
+		switch n := n.(type) {
+		case *andNode:
+			walk(n.left)
+			walk(n.right)
+		case *testNode:
+			if n.field != "frame.number" {
+				return
+			}
+			v, err := strconv.Atoi(n.value)
+			if err != nil {
+				return
+			}
+			bound := func(l, h int) {
+				if l > lo {
+					lo = l
+				}
+				if h > 0 && (hi == 0 || h < hi) {
+					hi = h
+				}
+			}
+			switch n.op {
+			case "==":
+				bound(v, v+1)
+			case ">=":
+				bound(v, 0)
+			case ">":
+				bound(v+1, 0)
+			case "<":
+				bound(0, v)
+			case "<=":
+				bound(0, v+1)
+			}
+		}
+	}
+	walk(f.root)
+	return
+}
+
+//======================================================================
+
+type filterNode interface {
+	match(p *Packet) bool
+}
+
+type andNode struct{ left, right filterNode }
+type orNode struct{ left, right filterNode }
+type notNode struct{ node filterNode }
+
+type testNode struct {
+	field string
+	op    string // "" tests presence
+	value string
+	re    *regexp.Regexp
+}
+
+func (n *andNode) match(p *Packet) bool { return n.left.match(p) && n.right.match(p) }
+func (n *orNode) match(p *Packet) bool  { return n.left.match(p) || n.right.match(p) }
+func (n *notNode) match(p *Packet) bool { return !n.node.match(p) }
+
+func (n *testNode) match(p *Packet) bool {
+	if n.op == "" {
+		return p.Has(n.field)
+	}
+	if n.op == "!=" {
+		// a != b is !(a == b), as in current Wireshark
+		return p.Has(n.field) && !n.any(p, "==")
+	}
+	return n.any(p, n.op)
+}
+
+// any is true if some occurrence of the field satisfies op
+func (n *testNode) any(p *Packet, op string) bool {
+	for _, show := range p.Values(n.field) {
+		if compare(show, op, n.value, n.re) {
+			return true
+		}
+	}
+	return false
+}
+
+func compare(show, op, value string, re *regexp.Regexp) bool {
+	switch op {
+	case "contains":
+		return strings.Contains(show, value)
+	case "matches":
+		return re.MatchString(show)
+	}
+	if a, ok := number(show); ok {
+		if b, ok := number(value); ok {
+			switch op {
+			case "==":
+				return a == b
+			case "<":
+				return a < b
+			case "<=":
+				return a <= b
+			case ">":
+				return a > b
+			case ">=":
+				return a >= b
+			}
+			return false
+		}
+	}
+	if op != "==" {
+		return false
+	}
+	if ip := net.ParseIP(show); ip != nil {
+		if _, cidr, err := net.ParseCIDR(value); err == nil {
+			return cidr.Contains(ip)
+		}
+		return ip.Equal(net.ParseIP(value))
+	}
+	if mac, err := net.ParseMAC(show); err == nil {
+		if other, err := net.ParseMAC(value); err == nil {
+			return mac.String() == other.String()
+		}
+	}
+	return show == value
+}
+
+func number(s string) (float64, bool) {
+	if i, err := strconv.ParseInt(s, 0, 64); err == nil {
+		return float64(i), true
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		return f, true
+	}
+	switch s {
+	case "True", "true":
+		return 1, true
+	case "False", "false":
+		return 0, true
+	}
+	return 0, false
+}
+
+//======================================================================
+
+type filterToken struct {
+	text   string
+	quoted bool
+}
+
+var filterOps = map[string]string{
+	"==": "==", "eq": "==", "!=": "!=", "ne": "!=",
+	"<": "<", "lt": "<", "<=": "<=", "le": "<=",
+	">": ">", "gt": ">", ">=": ">=", "ge": ">=",
+	"contains": "contains", "matches": "matches", "~": "matches",
+}
+
+var twoCharOps = map[string]bool{"==": true, "!=": true, "<=": true, ">=": true, "&&": true, "||": true}
+
+func lexFilter(s string) ([]filterToken, error) {
+	var tokens []filterToken
+	i := 0
+	for i < len(s) {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '(' || c == ')':
+			tokens = append(tokens, filterToken{text: string(c)})
+			i++
+		case c == '"':
+			end := i + 1
+			for end < len(s) && s[end] != '"' {
+				if s[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(s) {
+				return nil, fmt.Errorf("unterminated string")
+			}
+			text, err := strconv.Unquote(s[i : end+1])
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, filterToken{text: text, quoted: true})
+			i = end + 1
+		case strings.ContainsRune("=!<>~&|", rune(c)):
+			op := string(c)
+			if i+1 < len(s) && twoCharOps[s[i:i+2]] {
+				op = s[i : i+2]
+			}
+			tokens = append(tokens, filterToken{text: op})
+			i += len(op)
+		default:
+			end := i
+			for end < len(s) && !strings.ContainsRune(" \t\r\n()\"=!<>~&|", rune(s[end])) {
+				end++
+			}
+			tokens = append(tokens, filterToken{text: s[i:end]})
+			i = end
+		}
+	}
+	return tokens, nil
+}
+
+type filterParser struct {
+	tokens []filterToken
+	pos    int
+}
+
+func (p *filterParser) peek() string {
+	if p.pos < len(p.tokens) && !p.tokens[p.pos].quoted {
+		return p.tokens[p.pos].text
+	}
+	return ""
+}
+
+func (p *filterParser) or() (filterNode, error) {
+	left, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for t := p.peek(); t == "or" || t == "||"; t = p.peek() {
+		p.pos++
+		right, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		left = &orNode{left, right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) and() (filterNode, error) {
+	left, err := p.not()
+	if err != nil {
+		return nil, err
+	}
+	for t := p.peek(); t == "and" || t == "&&"; t = p.peek() {
+		p.pos++
+		right, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		left = &andNode{left, right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) not() (filterNode, error) {
+	if t := p.peek(); t == "not" || t == "!" {
+		p.pos++
+		node, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		return &notNode{node}, nil
+	}
+	return p.primary()
+}
+
+func (p *filterParser) primary() (filterNode, error) {
+	if p.pos >= len(p.tokens) {
+		return nil, fmt.Errorf("unexpected end of filter")
+	}
+	if p.peek() == "(" {
+		p.pos++
+		node, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ")" {
+			return nil, fmt.Errorf("missing )")
+		}
+		p.pos++
+		return node, nil
+	}
+
+	field := p.tokens[p.pos]
+	if field.quoted || !knownFields[field.text] {
+		return nil, fmt.Errorf("field %q is not decoded natively", field.text)
+	}
+	p.pos++
+	op, ok := filterOps[p.peek()]
+	if !ok {
+		return &testNode{field: field.text}, nil
+	}
+	p.pos++
+	if p.pos >= len(p.tokens) {
+		return nil, fmt.Errorf("missing value after %s", op)
+	}
+	node := &testNode{field: field.text, op: op, value: p.tokens[p.pos].text}
+	p.pos++
+	if op == "matches" {
+		re, err := regexp.Compile(node.value)
+		if err != nil {
+			return nil, err
+		}
+		node.re = re
+	}
+	return node, nil
+}
+
+//======================================================================
+// Local Variables:
+// mode: Go
+// fill-column: 78
+// End:
@@ -0,0 +1,459 @@
+// Copyright 2019-2022 Graham Clark. All rights reserved.  Use of this source
+// code is governed by the MIT license that can be found in the LICENSE
+// file.
+
+package native
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/xml"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gcla/termshark/v2/pkg/iostats"
+	"github.com/gcla/termshark/v2/pkg/shark"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/stretchr/testify/assert"
+)
+
+//======================================================================
+
+var testColumns = []shark.PsmlColumnSpec{
+	{Field: shark.PsmlField{Token: "%t"}, Name: "Time"},
+	{Field: shark.PsmlField{Token: "%s"}, Name: "Source"},
+	{Field: shark.PsmlField{Token: "%d"}, Name: "Destination"},
+	{Field: shark.PsmlField{Token: "%p"}, Name: "Protocol"},
+	{Field: shark.PsmlField{Token: "%L"}, Name: "Length"},
+	{Field: shark.PsmlField{Token: "%i"}, Name: "Info"},
+}
+
+type psmlDoc struct {
+	Packets []struct {
+		Sections []string `xml:"section"`
+	} `xml:"packet"`
+}
+
+func decodeString(t *testing.T, src interface{}, filter string, out func(io.Writer) writer) string {
+	f, err := ParseFilter(filter)
+	assert.NoError(t, err)
+	var b bytes.Buffer
+	assert.NoError(t, decode(context.Background(), src, f, out(&b)))
+	return b.String()
+}
+
+func psmlRows(t *testing.T, src interface{}, filter string) [][]string {
+	out := decodeString(t, src, filter, func(w io.Writer) writer { return newPsmlWriter(w, testColumns) })
+	var doc psmlDoc
+	assert.NoError(t, xml.Unmarshal([]byte(out), &doc))
+	rows := make([][]string, 0, len(doc.Packets))
+	for _, p := range doc.Packets {
+		rows = append(rows, p.Sections)
+	}
+	return rows
+}
+
+// Compare with the PSML tshark produced for the same capture. tshark resolves
+// MAC vendors and uses heuristics for TLS on odd ports, which are skipped.
+func TestPsmlMatchesTshark(t *testing.T) {
+	rows := psmlRows(t, "../pcap/testdata/1.pcap", "")
+
+	data, err := ioutil.ReadFile("../pcap/testdata/1.psml")
+	assert.NoError(t, err)
+	var expected psmlDoc
+	assert.NoError(t, xml.Unmarshal(data, &expected))
+	assert.Equal(t, len(expected.Packets), len(rows))
+
+	for i, row := range rows {
+		exp := expected.Packets[i].Sections
+		assert.Equal(t, exp[0], row[0], "number of %d", i+1)
+		assert.Equal(t, exp[1], row[1], "time of %d", i+1)
+		assert.Equal(t, exp[5], row[5], "length of %d", i+1)
+		if exp[4] == "ARP" || i+1 == 12 {
+			continue
+		}
+		assert.Equal(t, exp[2], row[2], "source of %d", i+1)
+		assert.Equal(t, exp[3], row[3], "destination of %d", i+1)
+		assert.Equal(t, exp[4], row[4], "protocol of %d", i+1)
+		if exp[4] == "TCP" {
+			assert.Equal(t, strings.Replace(exp[6], `\xe2\x86\x92`, "→", 1), row[6], "info of %d", i+1)
+		}
+	}
+}
+
+func TestHexdumpMatchesTshark(t *testing.T) {
+	out := decodeString(t, "../pcap/testdata/1.pcap", "", func(w io.Writer) writer { return &hexdumpWriter{w: w} })
+	expected, err := ioutil.ReadFile("../pcap/testdata/1.hexdump")
+	assert.NoError(t, err)
+	assert.Equal(t, string(expected), out)
+}
+
+func TestFrameRangeFilter(t *testing.T) {
+	rows := psmlRows(t, "../pcap/testdata/1.pcap", "(tcp) and (frame.number >= 3) and (frame.number < 10)")
+	numbers := make([]string, 0, len(rows))
+	for _, row := range rows {
+		numbers = append(numbers, row[0])
+	}
+	assert.Equal(t, []string{"3", "4", "5", "6", "9"}, numbers)
+
+	f, err := ParseFilter("(tcp) and (frame.number >= 3) and (frame.number < 10)")
+	assert.NoError(t, err)
+	lo, hi := f.FrameRange()
+	assert.Equal(t, 3, lo)
+	assert.Equal(t, 10, hi)
+
+	f, err = ParseFilter("frame.number < 10 or udp")
+	assert.NoError(t, err)
+	lo, hi = f.FrameRange()
+	assert.Equal(t, 1, lo)
+	assert.Equal(t, 0, hi)
+}
+
+func TestFilters(t *testing.T) {
+	rows := func(filter string) int {
+		return len(psmlRows(t, "../pcap/testdata/1.pcap", filter))
+	}
+	assert.Equal(t, 18, rows(""))
+	assert.Equal(t, 2, rows("arp"))
+	assert.Equal(t, 16, rows("!arp"))
+	assert.Equal(t, 3, rows(`udp.port eq 1900`))
+	assert.Equal(t, 2, rows(`http.request.method == "M-SEARCH"`))
+	assert.Equal(t, 1, rows(`http.response.code == 200`))
+	assert.Equal(t, 3, rows(`ip.dst == 239.255.255.250 || ip.src == 239.255.255.250/32 || frame.number == 11`))
+	assert.Equal(t, 3, rows(`ip.addr == 31.13.66.56`))
+	assert.Equal(t, 13, rows(`ip.addr != 31.13.66.56`))
+	assert.Equal(t, 1, rows(`frame.len > 300`))
+	assert.Equal(t, 2, rows(`tcp.options.timestamp.tsval && tcp.len == 0 && not tcp.port == 443 || tcp.port == 8009`))
+	assert.Equal(t, 2, rows(`eth.src == E8:DE:27:19:DE:6C and arp or frame.number == 1 and ip.ttl ge 64`))
+	assert.Equal(t, 2, rows(`http.request.method contains "SEARCH"`))
+
+	for _, bad := range []string{"sip", "tcp.port ==", "(tcp", `tcp.port == "1`, "tcp.analysis.flags"} {
+		_, err := ParseFilter(bad)
+		assert.Error(t, err, bad)
+		assert.IsType(t, UnsupportedFilterError{}, err)
+	}
+}
+
+//======================================================================
+
+// pcapngBuilder writes little-endian pcapng blocks
+type pcapngBuilder struct {
+	bytes.Buffer
+}
+
+func option(code uint16, value []byte) []byte {
+	b := make([]byte, 4, 4+pad4(len(value)))
+	binary.LittleEndian.PutUint16(b[0:2], code)
+	binary.LittleEndian.PutUint16(b[2:4], uint16(len(value)))
+	b = append(b, value...)
+	return append(b, make([]byte, pad4(len(value))-len(value))...)
+}
+
+func (p *pcapngBuilder) block(typ uint32, body []byte, opts ...[]byte) {
+	for _, o := range opts {
+		body = append(body, o...)
+	}
+	if len(opts) > 0 {
+		body = append(body, 0, 0, 0, 0)
+	}
+	length := uint32(12 + len(body))
+	binary.Write(p, binary.LittleEndian, typ)
+	binary.Write(p, binary.LittleEndian, length)
+	p.Write(body)
+	binary.Write(p, binary.LittleEndian, length)
+}
+
+func (p *pcapngBuilder) section(opts ...[]byte) {
+	body := []byte{0x4d, 0x3c, 0x2b, 0x1a, 1, 0, 0, 0, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}
+	p.block(ngBlockSectionHeader, body, opts...)
+}
+
+func (p *pcapngBuilder) iface(link layers.LinkType, opts ...[]byte) {
+	body := make([]byte, 8)
+	binary.LittleEndian.PutUint16(body[0:2], uint16(link))
+	binary.LittleEndian.PutUint32(body[4:8], 65535)
+	p.block(ngBlockInterfaceDescriptor, body, opts...)
+}
+
+func (p *pcapngBuilder) packet(iface int, ts time.Time, data []byte, opts ...[]byte) {
+	body := make([]byte, 20, 20+pad4(len(data)))
+	units := uint64(ts.UnixNano() / 1000)
+	binary.LittleEndian.PutUint32(body[0:4], uint32(iface))
+	binary.LittleEndian.PutUint32(body[4:8], uint32(units>>32))
+	binary.LittleEndian.PutUint32(body[8:12], uint32(units))
+	binary.LittleEndian.PutUint32(body[12:16], uint32(len(data)))
+	binary.LittleEndian.PutUint32(body[16:20], uint32(len(data)))
+	body = append(body, data...)
+	body = append(body, make([]byte, pad4(len(data))-len(data))...)
+	p.block(ngBlockEnhancedPacket, body, opts...)
+}
+
+func serialize(t *testing.T, ls ...gopacket.SerializableLayer) []byte {
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+	for _, l := range ls {
+		if tcp, ok := l.(*layers.TCP); ok {
+			for _, n := range ls {
+				if ip, ok := n.(gopacket.NetworkLayer); ok {
+					assert.NoError(t, tcp.SetNetworkLayerForChecksum(ip))
+				}
+			}
+		}
+		if udp, ok := l.(*layers.UDP); ok {
+			for _, n := range ls {
+				if ip, ok := n.(gopacket.NetworkLayer); ok {
+					assert.NoError(t, udp.SetNetworkLayerForChecksum(ip))
+				}
+			}
+		}
+	}
+	assert.NoError(t, gopacket.SerializeLayers(buf, opts, ls...))
+	return buf.Bytes()
+}
+
+var (
+	macA = net.HardwareAddr{0x02, 0, 0, 0, 0, 0x0a}
+	macB = net.HardwareAddr{0x02, 0, 0, 0, 0, 0x0b}
+)
+
+func dnsFrame(t *testing.T) []byte {
+	dns := &layers.DNS{
+		ID: 0x1234, QR: true, RD: true, RA: true, QDCount: 1, ANCount: 1,
+		Questions: []layers.DNSQuestion{{Name: []byte("example.com"), Type: layers.DNSTypeA, Class: layers.DNSClassIN}},
+		Answers: []layers.DNSResourceRecord{{
+			Name: []byte("example.com"), Type: layers.DNSTypeA, Class: layers.DNSClassIN, TTL: 60, IP: net.IPv4(93, 184, 216, 34),
+		}},
+	}
+	return serialize(t,
+		&layers.Ethernet{SrcMAC: macA, DstMAC: macB, EthernetType: layers.EthernetTypeDot1Q},
+		&layers.Dot1Q{VLANIdentifier: 42, Type: layers.EthernetTypeIPv4},
+		&layers.IPv4{Version: 4, TTL: 64, Protocol: layers.IPProtocolUDP, SrcIP: net.IPv4(10, 0, 0, 53), DstIP: net.IPv4(10, 0, 0, 1)},
+		&layers.UDP{SrcPort: 53, DstPort: 40000},
+		dns,
+	)
+}
+
+func httpFrame(t *testing.T) []byte {
+	return serialize(t,
+		&layers.Ethernet{SrcMAC: macA, DstMAC: macB, EthernetType: layers.EthernetTypeIPv6},
+		&layers.IPv6{Version: 6, HopLimit: 64, NextHeader: layers.IPProtocolTCP, SrcIP: net.ParseIP("2001:db8::1"), DstIP: net.ParseIP("2001:db8::2")},
+		&layers.TCP{SrcPort: 50000, DstPort: 80, Seq: 1000, Ack: 5000, ACK: true, PSH: true, Window: 512},
+		gopacket.Payload("GET /index.html HTTP/1.1\r\nHost: example.com\r\nUser-Agent: test\r\n\r\n"),
+	)
+}
+
+func clientHello(sni string) []byte {
+	ext := []byte{0, 0} // server_name
+	list := append([]byte{0}, byte(len(sni)>>8), byte(len(sni)))
+	list = append(list, sni...)
+	sniData := append([]byte{byte(len(list) >> 8), byte(len(list))}, list...)
+	ext = append(ext, byte(len(sniData)>>8), byte(len(sniData)))
+	ext = append(ext, sniData...)
+	ext = append(ext, 0, 43, 0, 3, 2, 3, 4) // supported_versions: TLS 1.3
+
+	hello := []byte{3, 3}
+	hello = append(hello, make([]byte, 32)...)
+	hello = append(hello, 0)                         // session id
+	hello = append(hello, 0, 4, 0x13, 1, 0xc0, 0x2f) // cipher suites
+	hello = append(hello, 1, 0)                      // compression
+	hello = append(hello, byte(len(ext)>>8), byte(len(ext)))
+	hello = append(hello, ext...)
+
+	hs := append([]byte{1, 0, byte(len(hello) >> 8), byte(len(hello))}, hello...)
+	return append([]byte{22, 3, 1, byte(len(hs) >> 8), byte(len(hs))}, hs...)
+}
+
+func tlsFrame(t *testing.T) []byte {
+	return serialize(t,
+		&layers.Ethernet{SrcMAC: macA, DstMAC: macB, EthernetType: layers.EthernetTypeIPv4},
+		&layers.IPv4{Version: 4, TTL: 64, Protocol: layers.IPProtocolTCP, SrcIP: net.IPv4(10, 0, 0, 1), DstIP: net.IPv4(10, 0, 0, 2)},
+		&layers.TCP{SrcPort: 50001, DstPort: 443, Seq: 1, Ack: 1, ACK: true, PSH: true, Window: 512},
+		gopacket.Payload(clientHello("example.org")),
+	)
+}
+
+func writeTestPcapng(t *testing.T) string {
+	var p pcapngBuilder
+	p.section(option(ngOptComment, []byte("section comment")))
+	p.iface(layers.LinkTypeEthernet, option(ngOptIfName, []byte("eth0")), option(ngOptIfDesc, []byte("uplink")))
+	p.iface(layers.LinkTypeEthernet, option(ngOptIfName, []byte("eth1")), option(ngOptIfTsresol, []byte{6}))
+	ts := time.Unix(1600000000, 0)
+	p.packet(0, ts, dnsFrame(t), option(ngOptComment, []byte("first comment")), option(ngOptComment, []byte("second")))
+	p.packet(1, ts.Add(time.Second), httpFrame(t))
+	p.packet(0, ts.Add(2*time.Second), tlsFrame(t))
+
+	dir, err := ioutil.TempDir("", "termshark-native")
+	assert.NoError(t, err)
+	path := filepath.Join(dir, "test.pcapng")
+	assert.NoError(t, ioutil.WriteFile(path, p.Bytes(), 0644))
+	return path
+}
+
+func TestPcapngInterfacesAndComments(t *testing.T) {
+	path := writeTestPcapng(t)
+	defer os.RemoveAll(filepath.Dir(path))
+
+	c, f, err := OpenCapture(path)
+	assert.NoError(t, err)
+	defer f.Close()
+	var frames []*Frame
+	for {
+		frame, err := c.Next()
+		if err == io.EOF {
+			break
+		}
+		assert.NoError(t, err)
+		frames = append(frames, frame)
+	}
+	assert.Equal(t, "pcapng", c.Format)
+	assert.Equal(t, []string{"section comment"}, c.Comments)
+	assert.Equal(t, 2, len(c.Interfaces))
+	assert.Equal(t, "eth0", c.Interfaces[0].Name)
+	assert.Equal(t, "uplink", c.Interfaces[0].Description)
+	assert.Equal(t, "eth1", c.Interfaces[1].Name)
+	assert.Equal(t, 3, len(frames))
+	assert.Equal(t, []string{"first comment", "second"}, frames[0].Comments)
+	assert.Equal(t, 1, frames[1].Interface)
+	assert.Equal(t, int64(1600000001), frames[1].Timestamp.Unix())
+
+	pdml := decodeString(t, path, "frame.comment contains \"first\"", func(w io.Writer) writer { return &pdmlWriter{w: w, name: path} })
+	assert.Equal(t, 1, strings.Count(pdml, "<packet>"))
+	assert.Contains(t, pdml, `show="first comment"`)
+	assert.Contains(t, pdml, `show="eth0"`)
+
+	assert.Equal(t, 1, len(psmlRows(t, path, `frame.interface_name == "eth1"`)))
+}
+
+func TestApplicationProtocols(t *testing.T) {
+	path := writeTestPcapng(t)
+	defer os.RemoveAll(filepath.Dir(path))
+
+	rows := psmlRows(t, path, "")
+	assert.Equal(t, 3, len(rows))
+
+	assert.Equal(t, []string{"10.0.0.53", "10.0.0.1", "DNS"}, rows[0][2:5])
+	assert.Equal(t, "Standard query response 0x1234 A example.com A 93.184.216.34", rows[0][6])
+
+	assert.Equal(t, []string{"2001:db8::1", "2001:db8::2", "HTTP"}, rows[1][2:5])
+	assert.Equal(t, "GET /index.html HTTP/1.1", rows[1][6])
+
+	assert.Equal(t, []string{"10.0.0.1", "10.0.0.2", "TLSv1"}, rows[2][2:5])
+	assert.Equal(t, "Client Hello", rows[2][6])
+
+	assert.Equal(t, 1, len(psmlRows(t, path, "vlan.id == 42 && dns.a == 93.184.216.34")))
+	assert.Equal(t, 1, len(psmlRows(t, path, `http.host == "example.com" and ipv6.addr == 2001:db8::2`)))
+	assert.Equal(t, 1, len(psmlRows(t, path, `tls.handshake.extensions_server_name matches "^example[.]org$"`)))
+	assert.Equal(t, 1, len(psmlRows(t, path, `tls.handshake.ciphersuite == 0x1301`)))
+}
+
+// Every field the dissectors emit must be usable in a filter
+func TestFieldsAreKnown(t *testing.T) {
+	path := writeTestPcapng(t)
+	defer os.RemoveAll(filepath.Dir(path))
+
+	for _, src := range []string{path, "../pcap/testdata/1.pcap"} {
+		c, f, err := OpenCapture(src)
+		assert.NoError(t, err)
+		d := NewDissector(c)
+		for {
+			frame, err := c.Next()
+			if err != nil {
+				break
+			}
+			for name := range d.Dissect(frame).values {
+				switch name {
+				case "geninfo", "num", "len", "caplen", "timestamp":
+					continue
+				}
+				assert.True(t, knownFields[name], "field %s", name)
+			}
+		}
+		f.Close()
+	}
+}
+
+func TestCommand(t *testing.T) {
+	cmds := MakeCommands(nil)
+	cmd := cmds.Pdml("../pcap/testdata/1.pcap", "(frame.number >= 2) and (frame.number < 4)")
+	assert.Equal(t, -1, cmd.Pid())
+	out, err := cmd.StdoutReader()
+	assert.NoError(t, err)
+	assert.NoError(t, cmd.Start())
+	assert.NotEqual(t, 0, cmd.Pid())
+	data, err := ioutil.ReadAll(out)
+	assert.NoError(t, err)
+	assert.NoError(t, cmd.Wait())
+	assert.Equal(t, 2, strings.Count(string(data), "<packet>"))
+	assert.EqualError(t, cmd.Kill(), "os: process already finished")
+
+	// A filter only tshark understands fails when started
+	cmd = cmds.Psml("../pcap/testdata/1.pcap", "sip")
+	out, err = cmd.StdoutReader()
+	assert.NoError(t, err)
+	assert.NoError(t, cmd.Start())
+	_, err = ioutil.ReadAll(out)
+	assert.Error(t, err)
+	assert.Error(t, cmd.Wait())
+	assert.Equal(t, 1, len(cmd.StderrSummary()))
+
+	// Killing stops a reader blocked on a pipe nobody writes to
+	pr, pw := io.Pipe()
+	defer pw.Close()
+	cmd = cmds.Psml(pr, "")
+	_, err = cmd.StdoutReader()
+	assert.NoError(t, err)
+	assert.NoError(t, cmd.Start())
+	assert.NoError(t, cmd.Kill())
+	pw.Close()
+	assert.Error(t, cmd.Wait())
+}
+
+func TestStats(t *testing.T) {
+	cmd := MakeCommands(nil).Stats("../pcap/testdata/1.pcap", "udp")
+	out, err := cmd.StdoutReader()
+	assert.NoError(t, err)
+	assert.NoError(t, cmd.Start())
+	samples := make([]iostats.Sample, 0)
+	assert.NoError(t, iostats.ReadPsml(out, func(s iostats.Sample) error {
+		samples = append(samples, s)
+		return nil
+	}))
+	assert.NoError(t, cmd.Wait())
+
+	rows := psmlRows(t, "../pcap/testdata/1.pcap", "udp")
+	assert.Equal(t, len(rows), len(samples))
+	assert.True(t, len(samples) > 0)
+	for i, s := range samples {
+		assert.Equal(t, rows[i][0], strconv.Itoa(s.Number))
+		assert.Equal(t, rows[i][5], strconv.Itoa(s.Length))
+		assert.Contains(t, s.Protocols, "udp")
+	}
+}
+
+func TestCapinfo(t *testing.T) {
+	path := writeTestPcapng(t)
+	defer os.RemoveAll(filepath.Dir(path))
+
+	var b bytes.Buffer
+	assert.NoError(t, writeCapinfo(context.Background(), path, &b))
+	out := b.String()
+	assert.Contains(t, out, "Number of packets:   3\n")
+	assert.Contains(t, out, "Capture comment:     section comment\n")
+	assert.Contains(t, out, "Number of interfaces in file: 2\n")
+	assert.Contains(t, out, "Name = eth1\n")
+}
+
+//======================================================================
+// Local Variables:
+// mode: Go
+// fill-column: 78
+// End:
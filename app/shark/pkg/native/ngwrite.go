@@ -0,0 +1,141 @@
+// Copyright 2019-2022 Graham Clark. All rights reserved.  Use of this source
+// code is governed by the MIT license that can be found in the LICENSE
+// file.
+
+package native
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+)
+
+//======================================================================
+
+// NgWriter writes frames read by a Capture as pcapng, each with its own
+// comments. Interfaces are written as the frames using them are, with
+// nanosecond timestamps whatever their original resolution.
+type NgWriter struct {
+	w      *bufio.Writer
+	ifaces map[int]uint32 // Capture interface index to the index written
+	err    error
+}
+
+// NewNgWriter writes the section header, with the given section comments.
+func NewNgWriter(w io.Writer, comments []string) (*NgWriter, error) {
+	res := &NgWriter{
+		w:      bufio.NewWriter(w),
+		ifaces: make(map[int]uint32),
+	}
+	body := make([]byte, 16)
+	binary.LittleEndian.PutUint32(body[0:4], ngByteOrderMagic)
+	binary.LittleEndian.PutUint16(body[4:6], 1) // version 1.0
+	// section length is unknown
+	binary.LittleEndian.PutUint64(body[8:16], 0xffffffffffffffff)
+	body = endOptions(appendComments(body, comments), 16)
+	res.writeBlock(ngBlockSectionHeader, body)
+	return res, res.err
+}
+
+// WriteFrame writes f, read from c, with comments in place of any it had.
+func (w *NgWriter) WriteFrame(c *Capture, f *Frame, comments []string) error {
+	idx, ok := w.ifaces[f.Interface]
+	if !ok {
+		idx = uint32(len(w.ifaces))
+		w.ifaces[f.Interface] = idx
+		w.writeInterface(c, f)
+	}
+
+	ts := uint64(f.Timestamp.UnixNano())
+	body := make([]byte, 20, 20+pad4(len(f.Data))+64)
+	binary.LittleEndian.PutUint32(body[0:4], idx)
+	binary.LittleEndian.PutUint32(body[4:8], uint32(ts>>32))
+	binary.LittleEndian.PutUint32(body[8:12], uint32(ts))
+	binary.LittleEndian.PutUint32(body[12:16], uint32(len(f.Data)))
+	binary.LittleEndian.PutUint32(body[16:20], uint32(f.Length))
+	body = append(body, f.Data...)
+	body = append(body, make([]byte, pad4(len(f.Data))-len(f.Data))...)
+	body = endOptions(appendComments(body, comments), 20+pad4(len(f.Data)))
+	w.writeBlock(ngBlockEnhancedPacket, body)
+	return w.err
+}
+
+func (w *NgWriter) Flush() error {
+	if w.err != nil {
+		return w.err
+	}
+	return w.w.Flush()
+}
+
+func (w *NgWriter) writeInterface(c *Capture, f *Frame) {
+	iface := Interface{LinkType: f.LinkType}
+	if f.Interface < len(c.Interfaces) {
+		iface = c.Interfaces[f.Interface]
+	}
+	body := make([]byte, 8)
+	binary.LittleEndian.PutUint16(body[0:2], uint16(iface.LinkType))
+	binary.LittleEndian.PutUint32(body[4:8], iface.SnapLen)
+	if iface.Name != "" {
+		body = appendOption(body, ngOptIfName, []byte(iface.Name))
+	}
+	if iface.Description != "" {
+		body = appendOption(body, ngOptIfDesc, []byte(iface.Description))
+	}
+	body = appendOption(body, ngOptIfTsresol, []byte{9})
+	body = endOptions(appendComments(body, iface.Comments), 8)
+	w.writeBlock(ngBlockInterfaceDescriptor, body)
+}
+
+// writeBlock frames body with the block type and its length, before and
+// after
+func (w *NgWriter) writeBlock(typ uint32, body []byte) {
+	if w.err != nil {
+		return
+	}
+	var hdr [8]byte
+	length := uint32(12 + len(body))
+	binary.LittleEndian.PutUint32(hdr[0:4], typ)
+	binary.LittleEndian.PutUint32(hdr[4:8], length)
+	if _, w.err = w.w.Write(hdr[:]); w.err != nil {
+		return
+	}
+	if _, w.err = w.w.Write(body); w.err != nil {
+		return
+	}
+	_, w.err = w.w.Write(hdr[4:8])
+}
+
+func appendComments(body []byte, comments []string) []byte {
+	for _, comment := range comments {
+		body = appendOption(body, ngOptComment, []byte(comment))
+	}
+	return body
+}
+
+// appendOption appends one option, cut to the longest an option can be
+func appendOption(body []byte, code uint16, value []byte) []byte {
+	if len(value) > 0xffff {
+		value = value[:0xffff]
+	}
+	var hdr [4]byte
+	binary.LittleEndian.PutUint16(hdr[0:2], code)
+	binary.LittleEndian.PutUint16(hdr[2:4], uint16(len(value)))
+	body = append(body, hdr[:]...)
+	body = append(body, value...)
+	return append(body, make([]byte, pad4(len(value))-len(value))...)
+}
+
+// endOptions terminates the options list that began at body[start:], so
+// readers stop there, unless there are no options
+func endOptions(body []byte, start int) []byte {
+	if len(body) == start {
+		return body
+	}
+	return append(body, 0, 0, 0, 0)
+}
+
+//======================================================================
+// Local Variables:
+// mode: Go
+// fill-column: 78
+// End:
@@ -0,0 +1,288 @@
+// Copyright 2019-2022 Graham Clark. All rights reserved.  Use of this source
+// code is governed by the MIT license that can be found in the LICENSE
+// file.
+
+package native
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gcla/termshark/v2/pkg/shark"
+)
+
+//======================================================================
+
+// writer produces one of the three formats the packet loader reads from
+// tshark: PSML for the packet list, PDML for the structure view and the
+// -x hexdump for the bytes view.
+type writer interface {
+	header(c *Capture) error
+	packet(p *Packet) error
+	footer() error
+}
+
+//======================================================================
+
+type psmlWriter struct {
+	w    io.Writer
+	cols []shark.PsmlColumnSpec
+
+	cumulative int
+	prevShown  time.Time
+	shown      bool
+}
+
+func newPsmlWriter(w io.Writer, cols []shark.PsmlColumnSpec) *psmlWriter {
+	visible := make([]shark.PsmlColumnSpec, 0, len(cols))
+	for _, col := range cols {
+		if !col.Hidden {
+			visible = append(visible, col)
+		}
+	}
+	return &psmlWriter{w: w, cols: visible}
+}
+
+func (w *psmlWriter) header(c *Capture) error {
+	var b bytes.Buffer
+	b.WriteString("<?xml version=\"1.0\" encoding=\"utf-8\"?>\n<psml version=\"0\" creator=\"termshark/native\">\n<structure>\n")
+	// The loader expects the frame number first, whatever the configured columns
+	writeSection(&b, "No.")
+	for _, col := range w.cols {
+		writeSection(&b, col.Name)
+	}
+	b.WriteString("</structure>\n\n")
+	_, err := w.w.Write(b.Bytes())
+	return err
+}
+
+func (w *psmlWriter) packet(p *Packet) error {
+	w.cumulative += p.Frame.Length
+	deltaShown := time.Duration(0)
+	if w.shown {
+		deltaShown = p.Frame.Timestamp.Sub(w.prevShown)
+	}
+	w.prevShown, w.shown = p.Frame.Timestamp, true
+
+	var b bytes.Buffer
+	b.WriteString("<packet>\n")
+	writeSection(&b, strconv.Itoa(p.Frame.Number))
+	for _, col := range w.cols {
+		writeSection(&b, w.column(p, col.Field, deltaShown))
+	}
+	b.WriteString("</packet>\n\n")
+	_, err := w.w.Write(b.Bytes())
+	return err
+}
+
+func (w *psmlWriter) footer() error {
+	_, err := io.WriteString(w.w, "</psml>\n")
+	return err
+}
+
+// column renders one PSML column for p. Columns the native dissectors have
+// no data for are left empty.
+func (w *psmlWriter) column(p *Packet, field shark.PsmlField, deltaShown time.Duration) string {
+	ts := p.Frame.Timestamp
+	switch field.Token {
+	case "%m":
+		return strconv.Itoa(p.Frame.Number)
+	case "%t", "%Rt":
+		return fmt.Sprintf("%.6f", p.Relative.Seconds())
+	case "%Tt":
+		return fmt.Sprintf("%.6f", p.Delta.Seconds())
+	case "%Gt":
+		return fmt.Sprintf("%.6f", deltaShown.Seconds())
+	case "%At":
+		return ts.Local().Format("15:04:05.000000")
+	case "%Aut":
+		return ts.UTC().Format("15:04:05.000000")
+	case "%Yt":
+		return ts.Local().Format("2006-01-02 15:04:05.000000")
+	case "%Yut":
+		return ts.UTC().Format("2006-01-02 15:04:05.000000")
+	case "%YDOYt":
+		return ts.Local().Format("2006/002 15:04:05.000000")
+	case "%YDOYut":
+		return ts.UTC().Format("2006/002 15:04:05.000000")
+	case "%s", "%rs", "%us":
+		return first(p.NetSrc, p.DLSrc)
+	case "%d", "%rd", "%ud":
+		return first(p.NetDst, p.DLDst)
+	case "%hs", "%rhs", "%uhs":
+		return p.DLSrc
+	case "%hd", "%rhd", "%uhd":
+		return p.DLDst
+	case "%ns", "%rns", "%uns":
+		return p.NetSrc
+	case "%nd", "%rnd", "%und":
+		return p.NetDst
+	case "%S", "%rS", "%uS":
+		return p.SrcPort
+	case "%D", "%rD", "%uD":
+		return p.DstPort
+	case "%p":
+		return p.Protocol
+	case "%L":
+		return strconv.Itoa(p.Frame.Length)
+	case "%i":
+		return p.Info
+	case "%q":
+		return p.VLAN
+	case "%f":
+		return p.DSCP
+	case "%B":
+		return strconv.Itoa(w.cumulative)
+	case "%Cus":
+		values := p.Values(field.Filter)
+		if field.Occurrence > 0 {
+			if field.Occurrence <= len(values) {
+				return values[field.Occurrence-1]
+			}
+			return ""
+		}
+		return strings.Join(values, ",")
+	}
+	return ""
+}
+
+func writeSection(b *bytes.Buffer, text string) {
+	b.WriteString("<section>")
+	xml.EscapeText(b, []byte(text))
+	b.WriteString("</section>\n")
+}
+
+func first(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+//======================================================================
+
+type pdmlWriter struct {
+	w    io.Writer
+	name string
+}
+
+func (w *pdmlWriter) header(c *Capture) error {
+	var b bytes.Buffer
+	b.WriteString("<?xml version=\"1.0\" encoding=\"utf-8\"?>\n<pdml version=\"0\" creator=\"termshark/native\"")
+	writeAttr(&b, "capture_file", w.name)
+	b.WriteString(">\n")
+	_, err := w.w.Write(b.Bytes())
+	return err
+}
+
+func (w *pdmlWriter) packet(p *Packet) error {
+	var b bytes.Buffer
+	b.WriteString("<packet>\n")
+	for _, proto := range p.Protos {
+		writeNode(&b, "proto", proto, p.Frame.Data, 1)
+	}
+	b.WriteString("</packet>\n")
+	_, err := w.w.Write(b.Bytes())
+	return err
+}
+
+func (w *pdmlWriter) footer() error {
+	_, err := io.WriteString(w.w, "</pdml>\n")
+	return err
+}
+
+func writeNode(b *bytes.Buffer, elem string, f *Field, data []byte, depth int) {
+	b.WriteString(strings.Repeat("  ", depth))
+	b.WriteString("<" + elem)
+	writeAttr(b, "name", f.Name)
+	if f.Showname != "" {
+		writeAttr(b, "showname", f.Showname)
+	}
+	writeAttr(b, "size", strconv.Itoa(f.Size))
+	writeAttr(b, "pos", strconv.Itoa(f.Pos))
+	if elem == "field" {
+		writeAttr(b, "show", f.Show)
+		value := f.Value
+		if value == "" && f.Size > 0 && f.Pos >= 0 && f.Pos+f.Size <= len(data) {
+			value = hex.EncodeToString(data[f.Pos : f.Pos+f.Size])
+		}
+		if value != "" {
+			writeAttr(b, "value", value)
+		}
+		if f.Hide {
+			writeAttr(b, "hide", "yes")
+		}
+	}
+	if len(f.Fields) == 0 {
+		b.WriteString("/>\n")
+		return
+	}
+	b.WriteString(">\n")
+	for _, child := range f.Fields {
+		writeNode(b, "field", child, data, depth+1)
+	}
+	b.WriteString(strings.Repeat("  ", depth))
+	b.WriteString("</" + elem + ">\n")
+}
+
+func writeAttr(b *bytes.Buffer, name, value string) {
+	b.WriteString(" " + name + "=\"")
+	xml.EscapeText(b, []byte(value))
+	b.WriteString("\"")
+}
+
+//======================================================================
+
+type hexdumpWriter struct {
+	w io.Writer
+}
+
+func (w *hexdumpWriter) header(c *Capture) error { return nil }
+func (w *hexdumpWriter) footer() error           { return nil }
+
+// packet writes the frame bytes as tshark -x does: 16 bytes per line with an
+// offset and ASCII column, and a blank line after each frame
+func (w *hexdumpWriter) packet(p *Packet) error {
+	var b bytes.Buffer
+	data := p.Frame.Data
+	for off := 0; off < len(data); off += 16 {
+		end := off + 16
+		if end > len(data) {
+			end = len(data)
+		}
+		fmt.Fprintf(&b, "%04x  ", off)
+		for i := off; i < off+16; i++ {
+			if i < end {
+				fmt.Fprintf(&b, "%02x ", data[i])
+			} else {
+				b.WriteString("   ")
+			}
+		}
+		b.WriteString("  ")
+		for _, c := range data[off:end] {
+			if c >= 0x20 && c < 0x7f {
+				b.WriteByte(c)
+			} else {
+				b.WriteByte('.')
+			}
+		}
+		b.WriteString("\n")
+	}
+	b.WriteString("\n")
+	_, err := w.w.Write(b.Bytes())
+	return err
+}
+
+//======================================================================
+// Local Variables:
+// mode: Go
+// fill-column: 78
+// End:
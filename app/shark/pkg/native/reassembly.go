@@ -0,0 +1,532 @@
+// Copyright 2019-2022 Graham Clark. All rights reserved.  Use of this source
+// code is governed by the MIT license that can be found in the LICENSE
+// file.
+
+package native
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/gcla/termshark/v2/pkg/streams"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+//======================================================================
+
+// maxPending bounds the out-of-order data held for one direction of a TCP
+// stream. Beyond it, the missing bytes are assumed lost from the capture and
+// reassembly skips over the gap.
+var maxPending = 4 * 1024 * 1024
+
+// Segment is the part of a TCP header the reassembler needs, along with the
+// segment's payload.
+type Segment struct {
+	Seq     uint32
+	SYN     bool
+	FIN     bool
+	RST     bool
+	Payload []byte
+}
+
+type pendingSegment struct {
+	number int
+	seq    uint32
+	data   []byte
+	fin    bool
+}
+
+type tcpHalf struct {
+	started bool
+	closed  bool   // FIN consumed
+	next    uint32 // next sequence number to deliver
+	pending []pendingSegment
+	size    int // bytes in pending
+}
+
+// Reassembler turns the packets of one conversation into the chunks shown by
+// the follow-stream view. TCP data is delivered in sequence order, once,
+// whatever order it was captured in: retransmitted and overlapping bytes are
+// dropped, out-of-order segments wait for the gap before them to fill, and
+// nothing is delivered in a direction after its FIN or in either direction
+// after a RST. Each UDP datagram is a chunk of its own.
+type Reassembler struct {
+	out    func(number int, chunk streams.Bytes) error
+	halves [2]tcpHalf
+	reset  bool
+}
+
+// NewReassembler returns a reassembler that passes each chunk to out along
+// with the number of the frame that carried it.
+func NewReassembler(out func(number int, chunk streams.Bytes) error) *Reassembler {
+	return &Reassembler{out: out}
+}
+
+// AddTCP adds a TCP segment sent in direction dirn, carried by frame number.
+func (r *Reassembler) AddTCP(number int, dirn streams.Direction, seg Segment) error {
+	if r.reset {
+		return nil
+	}
+	h := &r.halves[dirn]
+	seq := seg.Seq
+	if seg.SYN {
+		if !h.started {
+			h.started, h.next = true, seq+1
+		}
+		seq++
+	}
+	if !h.started {
+		// The capture began mid-stream
+		h.started, h.next = true, seq
+	}
+	if !h.closed && (len(seg.Payload) > 0 || seg.FIN) {
+		h.insert(pendingSegment{
+			number: number,
+			seq:    seq,
+			data:   append([]byte(nil), seg.Payload...),
+			fin:    seg.FIN,
+		})
+		if err := r.drain(dirn, h.size > maxPending); err != nil {
+			return err
+		}
+	}
+	if seg.RST {
+		r.reset = true
+	}
+	return nil
+}
+
+// AddUDP adds a UDP datagram sent in direction dirn, carried by frame number.
+func (r *Reassembler) AddUDP(number int, dirn streams.Direction, payload []byte) error {
+	if len(payload) == 0 {
+		return nil
+	}
+	return r.out(number, streams.Bytes{Dirn: dirn, Data: payload})
+}
+
+// Flush delivers out-of-order data still waiting on bytes the capture never
+// supplied, skipping the gaps. Call it after the conversation's last packet.
+func (r *Reassembler) Flush() error {
+	if r.reset {
+		return nil
+	}
+	for dirn := range r.halves {
+		if err := r.drain(streams.Direction(dirn), true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// drain delivers pending segments in sequence order. If skipGaps is set, a
+// hole before the next pending segment is skipped rather than waited for.
+func (r *Reassembler) drain(dirn streams.Direction, skipGaps bool) error {
+	h := &r.halves[dirn]
+	for len(h.pending) > 0 && !h.closed {
+		seg := h.pending[0]
+		if seqAfter(seg.seq, h.next) {
+			if !skipGaps {
+				break
+			}
+			h.next = seg.seq
+		}
+		h.pending = h.pending[1:]
+		h.size -= len(seg.data)
+
+		data := seg.data
+		if skip := h.next - seg.seq; int64(skip) >= int64(len(data)) {
+			// entirely retransmitted
+			data = nil
+		} else {
+			data = data[skip:]
+		}
+		if len(data) > 0 {
+			h.next += uint32(len(data))
+			if err := r.out(seg.number, streams.Bytes{Dirn: dirn, Data: data}); err != nil {
+				return err
+			}
+		}
+		if seg.fin && h.next == seg.seq+uint32(len(seg.data)) {
+			h.next++
+			h.closed = true
+		}
+	}
+	if h.closed {
+		h.pending, h.size = nil, 0
+	}
+	return nil
+}
+
+// insert keeps pending sorted by sequence number; segments with the same
+// sequence number stay in arrival order, so the first copy wins
+func (h *tcpHalf) insert(seg pendingSegment) {
+	i := sort.Search(len(h.pending), func(i int) bool {
+		return seqAfter(h.pending[i].seq, seg.seq)
+	})
+	h.pending = append(h.pending, pendingSegment{})
+	copy(h.pending[i+1:], h.pending[i:])
+	h.pending[i] = seg
+	h.size += len(seg.data)
+}
+
+// seqAfter compares sequence numbers modulo 2^32
+func seqAfter(a, b uint32) bool {
+	return int32(a-b) > 0
+}
+
+//======================================================================
+
+// StreamPacket is one frame of a conversation. Chunk is true if the frame
+// contributed data to the reassembled stream; a retransmission does not.
+type StreamPacket struct {
+	Number int
+	Dirn   streams.Direction
+	Len    int // payload length
+	Chunk  bool
+}
+
+// Conversation is one TCP or UDP stream, numbered as tcp.stream and
+// udp.stream are. The client is the sender of the first packet.
+type Conversation struct {
+	Proto   streams.Protocol
+	Index   int
+	Client  string
+	Server  string
+	Packets []StreamPacket
+}
+
+// StreamIndex lists the packets of every TCP and UDP conversation in a
+// capture.
+type StreamIndex struct {
+	TCP []*Conversation
+	UDP []*Conversation
+}
+
+// Conversation returns stream idx of proto ("tcp" or "udp"), or nil.
+func (s *StreamIndex) Conversation(proto string, idx int) *Conversation {
+	var convs []*Conversation
+	switch proto {
+	case "tcp":
+		convs = s.TCP
+	case "udp":
+		convs = s.UDP
+	}
+	if idx < 0 || idx >= len(convs) {
+		return nil
+	}
+	return convs[idx]
+}
+
+type transportPacket struct {
+	src, dst string
+	tcp      *layers.TCP
+	udp      *layers.UDP
+}
+
+// transport finds the TCP or UDP layer of f and the addresses of the IP layer
+// that carries it, stopping where the dissector does, so that conversations
+// are numbered the same way.
+func transport(f *Frame) (transportPacket, bool) {
+	var res transportPacket
+	pkt := gopacket.NewPacket(f.Data, f.LinkType, gopacket.DecodeOptions{Lazy: true, NoCopy: true})
+	for _, layer := range pkt.Layers() {
+		switch l := layer.(type) {
+		case *layers.IPv4:
+			res.src, res.dst = l.SrcIP.String(), l.DstIP.String()
+		case *layers.IPv6:
+			res.src, res.dst = l.SrcIP.String(), l.DstIP.String()
+		case *layers.TCP:
+			res.tcp = l
+			return res, true
+		case *layers.UDP:
+			res.udp = l
+			return res, true
+		case *layers.ICMPv4, *layers.ICMPv6, *gopacket.DecodeFailure, gopacket.Payload:
+			return res, false
+		}
+	}
+	return res, false
+}
+
+func (t transportPacket) endpoints() (string, string) {
+	if t.tcp != nil {
+		return endpoint(t.src, int(t.tcp.SrcPort)), endpoint(t.dst, int(t.tcp.DstPort))
+	}
+	return endpoint(t.src, int(t.udp.SrcPort)), endpoint(t.dst, int(t.udp.DstPort))
+}
+
+// endpoint formats an address and port as tshark's follow output does
+func endpoint(addr string, port int) string {
+	if ip := net.ParseIP(addr); ip != nil && ip.To4() == nil {
+		return "[" + addr + "]:" + strconv.Itoa(port)
+	}
+	return addr + ":" + strconv.Itoa(port)
+}
+
+func (t transportPacket) add(r *Reassembler, number int, dirn streams.Direction) error {
+	if t.tcp != nil {
+		return r.AddTCP(number, dirn, Segment{
+			Seq:     t.tcp.Seq,
+			SYN:     t.tcp.SYN,
+			FIN:     t.tcp.FIN,
+			RST:     t.tcp.RST,
+			Payload: t.tcp.Payload,
+		})
+	}
+	return r.AddUDP(number, dirn, t.udp.Payload)
+}
+
+// IndexStreams reads the capture at path once, numbering every conversation
+// and reassembling each to learn which of its packets carry stream data.
+func IndexStreams(ctx context.Context, path string) (*StreamIndex, error) {
+	return ReassembleStreams(ctx, path, nil)
+}
+
+// ReassembleStreams is IndexStreams, but also passes every chunk of every
+// conversation to out, if not nil, as it is reassembled.
+func ReassembleStreams(ctx context.Context, path string, out func(conv *Conversation, number int, chunk streams.Bytes) error) (*StreamIndex, error) {
+	capture, f, err := OpenCapture(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	res := &StreamIndex{}
+	tcpStreams := make(map[string]int)
+	udpStreams := make(map[string]int)
+	active := make(map[*Conversation]*Reassembler)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, errKilled
+		default:
+		}
+		frame, err := capture.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		t, ok := transport(frame)
+		if !ok {
+			continue
+		}
+
+		src, dst := t.endpoints()
+		var conv *Conversation
+		if t.tcp != nil {
+			idx := streamIndex(tcpStreams, t.src, int(t.tcp.SrcPort), t.dst, int(t.tcp.DstPort))
+			if idx == len(res.TCP) {
+				res.TCP = append(res.TCP, &Conversation{Proto: streams.TCP, Index: idx, Client: src, Server: dst})
+			}
+			conv = res.TCP[idx]
+		} else {
+			idx := streamIndex(udpStreams, t.src, int(t.udp.SrcPort), t.dst, int(t.udp.DstPort))
+			if idx == len(res.UDP) {
+				res.UDP = append(res.UDP, &Conversation{Proto: streams.UDP, Index: idx, Client: src, Server: dst})
+			}
+			conv = res.UDP[idx]
+		}
+
+		dirn := streams.Client
+		if src != conv.Client {
+			dirn = streams.Server
+		}
+		sp := StreamPacket{Number: frame.Number, Dirn: dirn}
+		if t.tcp != nil {
+			sp.Len = len(t.tcp.Payload)
+		} else {
+			sp.Len = len(t.udp.Payload)
+		}
+		conv.Packets = append(conv.Packets, sp)
+
+		r, ok := active[conv]
+		if !ok {
+			r = conv.tracker(out)
+			active[conv] = r
+		}
+		if err := t.add(r, frame.Number, dirn); err != nil {
+			return nil, err
+		}
+	}
+	for _, conv := range res.TCP {
+		if err := active[conv].Flush(); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+// tracker returns a reassembler that marks the packets carrying chunks
+// before passing the chunks to out
+func (c *Conversation) tracker(out func(conv *Conversation, number int, chunk streams.Bytes) error) *Reassembler {
+	return NewReassembler(func(number int, chunk streams.Bytes) error {
+		// Chunks arrive from recent packets, so search from the end
+		for i := len(c.Packets) - 1; i >= 0; i-- {
+			if c.Packets[i].Number == number {
+				c.Packets[i].Chunk = true
+				break
+			}
+		}
+		if out == nil {
+			return nil
+		}
+		return out(c, number, chunk)
+	})
+}
+
+//======================================================================
+
+// streamIndexes holds the index of the last capture followed, so that the
+// reassembly and indexer commands, and later follows of other streams, read
+// the capture only as far as they need to.
+var streamIndexes struct {
+	sync.Mutex
+	key   string
+	index *StreamIndex
+}
+
+func streamIndexFor(ctx context.Context, path string) (*StreamIndex, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	// A live capture's file grows, so a change in size makes a new index
+	key := fmt.Sprintf("%s %d %d", path, fi.Size(), fi.ModTime().UnixNano())
+
+	streamIndexes.Lock()
+	defer streamIndexes.Unlock()
+	if streamIndexes.key == key {
+		return streamIndexes.index, nil
+	}
+	index, err := IndexStreams(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	streamIndexes.key, streamIndexes.index = key, index
+	return index, nil
+}
+
+func lookupConversation(ctx context.Context, path string, proto string, idx int) (*Conversation, error) {
+	index, err := streamIndexFor(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	conv := index.Conversation(proto, idx)
+	if conv == nil {
+		return nil, fmt.Errorf("Could not find %s stream %d in %s", proto, idx, path)
+	}
+	return conv, nil
+}
+
+// Follow reassembles stream idx of proto in the capture at path, passing
+// each chunk to out. Only the frames up to the stream's last are read.
+func Follow(ctx context.Context, path string, proto string, idx int, out func(number int, chunk streams.Bytes) error) (*Conversation, error) {
+	conv, err := lookupConversation(ctx, path, proto, idx)
+	if err != nil {
+		return nil, err
+	}
+	capture, f, err := OpenCapture(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := NewReassembler(out)
+	for _, sp := range conv.Packets {
+		var frame *Frame
+		for frame == nil || frame.Number < sp.Number {
+			select {
+			case <-ctx.Done():
+				return nil, errKilled
+			default:
+			}
+			if frame, err = capture.Next(); err == io.EOF {
+				return nil, fmt.Errorf("Capture %s ended before frame %d", path, sp.Number)
+			} else if err != nil {
+				return nil, err
+			}
+		}
+		if t, ok := transport(frame); ok {
+			if err := t.add(r, frame.Number, sp.Dirn); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return conv, r.Flush()
+}
+
+//======================================================================
+
+// writeFollow writes a reassembled stream in the format of tshark's
+// -z follow,<proto>,raw,<idx>
+func writeFollow(ctx context.Context, path string, proto string, idx int, w io.Writer) error {
+	conv, err := lookupConversation(ctx, path, proto, idx)
+	if err != nil {
+		return err
+	}
+	separator := "===================================================================\n"
+	if _, err := fmt.Fprintf(w, "\n%sFollow: %s,raw\nFilter: %s.stream eq %d\nNode 0: %s\nNode 1: %s\n",
+		separator, proto, proto, idx, conv.Client, conv.Server); err != nil {
+		return err
+	}
+	_, err = Follow(ctx, path, proto, idx, func(number int, chunk streams.Bytes) error {
+		indent := ""
+		if chunk.Dirn == streams.Server {
+			indent = "\t"
+		}
+		_, err := fmt.Fprintf(w, "%s%x\n", indent, chunk.Data)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, separator)
+	return err
+}
+
+// writeStreamPdml writes the packets of a conversation as the minimal PDML
+// the stream indexer reads. A TCP segment's length is zeroed unless it
+// contributed a chunk, so the view maps chunks to the right packets even
+// when segments were retransmitted.
+func writeStreamPdml(ctx context.Context, path string, proto string, idx int, w io.Writer) error {
+	conv, err := lookupConversation(ctx, path, proto, idx)
+	if err != nil {
+		return err
+	}
+	pw := &pdmlWriter{w: w, name: path}
+	if err := pw.header(nil); err != nil {
+		return err
+	}
+	for _, sp := range conv.Packets {
+		var field string
+		switch {
+		case proto == "udp":
+			// udp.length counts the header
+			field = fmt.Sprintf("udp.length\" show=\"%d", sp.Len+8)
+		case sp.Chunk:
+			field = fmt.Sprintf("tcp.len\" show=\"%d", sp.Len)
+		default:
+			field = "tcp.len\" show=\"0"
+		}
+		if _, err := fmt.Fprintf(w, "<packet>\n  <proto name=\"%s\">\n    <field name=\"%s\"/>\n  </proto>\n</packet>\n", proto, field); err != nil {
+			return err
+		}
+	}
+	return pw.footer()
+}
+
+//======================================================================
+// Local Variables:
+// mode: Go
+// fill-column: 78
+// End:
@@ -0,0 +1,295 @@
+// Copyright 2019-2022 Graham Clark. All rights reserved.  Use of this source
+// code is governed by the MIT license that can be found in the LICENSE
+// file.
+
+package native
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gcla/termshark/v2/pkg/streams"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+	"github.com/stretchr/testify/assert"
+)
+
+//======================================================================
+
+type chunk struct {
+	number int
+	dirn   streams.Direction
+	data   string
+}
+
+func collect(res *[]chunk) func(int, streams.Bytes) error {
+	return func(number int, b streams.Bytes) error {
+		*res = append(*res, chunk{number, b.Dirn, string(b.Data)})
+		return nil
+	}
+}
+
+func TestReassembleInOrder(t *testing.T) {
+	var res []chunk
+	r := NewReassembler(collect(&res))
+	assert.NoError(t, r.AddTCP(1, streams.Client, Segment{Seq: 100, SYN: true}))
+	assert.NoError(t, r.AddTCP(2, streams.Server, Segment{Seq: 500, SYN: true}))
+	assert.NoError(t, r.AddTCP(3, streams.Client, Segment{Seq: 101, Payload: []byte("hello ")}))
+	assert.NoError(t, r.AddTCP(4, streams.Client, Segment{Seq: 107, Payload: []byte("world")}))
+	assert.NoError(t, r.AddTCP(5, streams.Server, Segment{Seq: 501, Payload: []byte("hi"), FIN: true}))
+	assert.NoError(t, r.AddTCP(6, streams.Server, Segment{Seq: 503, Payload: []byte("after fin")}))
+	assert.NoError(t, r.Flush())
+	assert.Equal(t, []chunk{
+		{3, streams.Client, "hello "},
+		{4, streams.Client, "world"},
+		{5, streams.Server, "hi"},
+	}, res)
+}
+
+func TestReassembleOutOfOrder(t *testing.T) {
+	var res []chunk
+	r := NewReassembler(collect(&res))
+	assert.NoError(t, r.AddTCP(1, streams.Client, Segment{Seq: 1, Payload: []byte("abc")}))
+	assert.NoError(t, r.AddTCP(2, streams.Client, Segment{Seq: 7, Payload: []byte("ghi")}))
+	assert.NoError(t, r.AddTCP(3, streams.Client, Segment{Seq: 4, Payload: []byte("def")}))
+	assert.Equal(t, []chunk{
+		{1, streams.Client, "abc"},
+		{3, streams.Client, "def"},
+		{2, streams.Client, "ghi"},
+	}, res)
+}
+
+func TestReassembleRetransmissionAndOverlap(t *testing.T) {
+	var res []chunk
+	r := NewReassembler(collect(&res))
+	assert.NoError(t, r.AddTCP(1, streams.Client, Segment{Seq: 1, Payload: []byte("abcd")}))
+	// exact retransmission
+	assert.NoError(t, r.AddTCP(2, streams.Client, Segment{Seq: 1, Payload: []byte("abcd")}))
+	// overlaps the first two bytes
+	assert.NoError(t, r.AddTCP(3, streams.Client, Segment{Seq: 3, Payload: []byte("cdef")}))
+	// out-of-order segments that overlap each other
+	assert.NoError(t, r.AddTCP(4, streams.Client, Segment{Seq: 9, Payload: []byte("ijkl")}))
+	assert.NoError(t, r.AddTCP(5, streams.Client, Segment{Seq: 7, Payload: []byte("ghij")}))
+	assert.Equal(t, []chunk{
+		{1, streams.Client, "abcd"},
+		{3, streams.Client, "ef"},
+		{5, streams.Client, "ghij"},
+		{4, streams.Client, "kl"},
+	}, res)
+}
+
+func TestReassembleSequenceWrap(t *testing.T) {
+	var res []chunk
+	r := NewReassembler(collect(&res))
+	assert.NoError(t, r.AddTCP(1, streams.Client, Segment{Seq: 0xfffffffe, Payload: []byte("ab")}))
+	assert.NoError(t, r.AddTCP(2, streams.Client, Segment{Seq: 2, Payload: []byte("ef")}))
+	assert.NoError(t, r.AddTCP(3, streams.Client, Segment{Seq: 0, Payload: []byte("cd")}))
+	assert.Equal(t, "abcdef", res[0].data+res[1].data+res[2].data)
+}
+
+func TestReassembleReset(t *testing.T) {
+	var res []chunk
+	r := NewReassembler(collect(&res))
+	assert.NoError(t, r.AddTCP(1, streams.Client, Segment{Seq: 1, Payload: []byte("abc")}))
+	assert.NoError(t, r.AddTCP(2, streams.Client, Segment{Seq: 10, Payload: []byte("later")}))
+	assert.NoError(t, r.AddTCP(3, streams.Server, Segment{Seq: 1, RST: true}))
+	assert.NoError(t, r.AddTCP(4, streams.Client, Segment{Seq: 4, Payload: []byte("def")}))
+	assert.NoError(t, r.Flush())
+	assert.Equal(t, []chunk{{1, streams.Client, "abc"}}, res)
+}
+
+func TestReassembleGap(t *testing.T) {
+	var res []chunk
+	r := NewReassembler(collect(&res))
+	assert.NoError(t, r.AddTCP(1, streams.Client, Segment{Seq: 1, Payload: []byte("abc")}))
+	assert.NoError(t, r.AddTCP(2, streams.Client, Segment{Seq: 10, Payload: []byte("xyz")}))
+	assert.Equal(t, 1, len(res))
+	// the bytes between were never captured
+	assert.NoError(t, r.Flush())
+	assert.Equal(t, []chunk{{1, streams.Client, "abc"}, {2, streams.Client, "xyz"}}, res)
+
+	saved := maxPending
+	defer func() { maxPending = saved }()
+	maxPending = 4
+	res = nil
+	r = NewReassembler(collect(&res))
+	assert.NoError(t, r.AddTCP(1, streams.Client, Segment{Seq: 1, Payload: []byte("abc")}))
+	assert.NoError(t, r.AddTCP(2, streams.Client, Segment{Seq: 10, Payload: []byte("xyz")}))
+	assert.NoError(t, r.AddTCP(3, streams.Client, Segment{Seq: 13, Payload: []byte("uvw")}))
+	assert.Equal(t, 3, len(res))
+}
+
+//======================================================================
+
+var (
+	clientIP = net.IPv4(10, 0, 0, 1)
+	serverIP = net.IPv4(10, 0, 0, 2)
+)
+
+type segmentSpec struct {
+	fromClient bool
+	seq        uint32
+	flags      string
+	data       string
+}
+
+func tcpPacket(t *testing.T, s segmentSpec) []byte {
+	src, dst, sport, dport := clientIP, serverIP, layers.TCPPort(40000), layers.TCPPort(80)
+	if !s.fromClient {
+		src, dst, sport, dport = dst, src, dport, sport
+	}
+	tcp := &layers.TCP{
+		SrcPort: sport, DstPort: dport, Seq: s.seq, Window: 512, ACK: true,
+		SYN: strings.Contains(s.flags, "S"),
+		FIN: strings.Contains(s.flags, "F"),
+		RST: strings.Contains(s.flags, "R"),
+	}
+	return serialize(t,
+		&layers.Ethernet{SrcMAC: macA, DstMAC: macB, EthernetType: layers.EthernetTypeIPv4},
+		&layers.IPv4{Version: 4, TTL: 64, Protocol: layers.IPProtocolTCP, SrcIP: src, DstIP: dst},
+		tcp,
+		gopacket.Payload(s.data),
+	)
+}
+
+func udpPacket(t *testing.T, fromClient bool, data string) []byte {
+	src, dst, sport, dport := clientIP, serverIP, layers.UDPPort(5000), layers.UDPPort(6000)
+	if !fromClient {
+		src, dst, sport, dport = dst, src, dport, sport
+	}
+	return serialize(t,
+		&layers.Ethernet{SrcMAC: macA, DstMAC: macB, EthernetType: layers.EthernetTypeIPv4},
+		&layers.IPv4{Version: 4, TTL: 64, Protocol: layers.IPProtocolUDP, SrcIP: src, DstIP: dst},
+		&layers.UDP{SrcPort: sport, DstPort: dport},
+		gopacket.Payload(data),
+	)
+}
+
+func writeStreamPcap(t *testing.T) string {
+	frames := [][]byte{
+		tcpPacket(t, segmentSpec{true, 1000, "S", ""}),
+		udpPacket(t, true, "ping"),
+		tcpPacket(t, segmentSpec{false, 5000, "S", ""}),
+		tcpPacket(t, segmentSpec{true, 1001, "", "GET / HTTP/1.1\r\n"}),
+		tcpPacket(t, segmentSpec{true, 1001 + 16 + 6, "", "\r\n"}), // before the segment it follows
+		tcpPacket(t, segmentSpec{true, 1001 + 16, "", "Host:"}),
+		tcpPacket(t, segmentSpec{true, 1001 + 16, "", "Host: "}), // retransmitted and extended
+		udpPacket(t, false, "pong"),
+		tcpPacket(t, segmentSpec{false, 5001, "", "HTTP/1.1 200 OK\r\n"}),
+		tcpPacket(t, segmentSpec{false, 5001, "", "HTTP/1.1 200 OK\r\n"}), // retransmitted
+		tcpPacket(t, segmentSpec{false, 5001 + 17, "F", ""}),
+		tcpPacket(t, segmentSpec{true, 1001 + 16 + 8, "F", ""}),
+	}
+
+	dir, err := ioutil.TempDir("", "termshark-native")
+	assert.NoError(t, err)
+	path := filepath.Join(dir, "streams.pcap")
+	f, err := os.Create(path)
+	assert.NoError(t, err)
+	defer f.Close()
+	w := pcapgo.NewWriter(f)
+	assert.NoError(t, w.WriteFileHeader(65535, layers.LinkTypeEthernet))
+	ts := time.Unix(1600000000, 0)
+	for i, data := range frames {
+		ci := gopacket.CaptureInfo{Timestamp: ts.Add(time.Duration(i) * time.Millisecond), CaptureLength: len(data), Length: len(data)}
+		assert.NoError(t, w.WritePacket(ci, data))
+	}
+	return path
+}
+
+func TestStreamIndex(t *testing.T) {
+	path := writeStreamPcap(t)
+	defer os.RemoveAll(filepath.Dir(path))
+
+	index, err := IndexStreams(context.Background(), path)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(index.TCP))
+	assert.Equal(t, 1, len(index.UDP))
+	assert.Nil(t, index.Conversation("tcp", 1))
+	assert.Nil(t, index.Conversation("sctp", 0))
+
+	tcp := index.Conversation("tcp", 0)
+	assert.Equal(t, "10.0.0.1:40000", tcp.Client)
+	assert.Equal(t, "10.0.0.2:80", tcp.Server)
+	numbers := []int{}
+	chunks := []int{}
+	for _, sp := range tcp.Packets {
+		numbers = append(numbers, sp.Number)
+		if sp.Chunk {
+			chunks = append(chunks, sp.Number)
+		}
+	}
+	assert.Equal(t, []int{1, 3, 4, 5, 6, 7, 9, 10, 11, 12}, numbers)
+	assert.Equal(t, []int{4, 5, 6, 7, 9}, chunks)
+	assert.Equal(t, streams.Server, tcp.Packets[1].Dirn)
+
+	udp := index.Conversation("udp", 0)
+	assert.Equal(t, 2, len(udp.Packets))
+	assert.Equal(t, streams.Server, udp.Packets[1].Dirn)
+}
+
+// The output of the stream command must parse exactly as tshark's does
+func TestFollowOutput(t *testing.T) {
+	path := writeStreamPcap(t)
+	defer os.RemoveAll(filepath.Dir(path))
+
+	var b bytes.Buffer
+	assert.NoError(t, writeFollow(context.Background(), path, "tcp", 0, &b))
+	got, err := streams.ParseReader("", &b)
+	assert.NoError(t, err)
+	follow := got.(*streams.FollowStream)
+	assert.Equal(t, "tcp,raw", follow.Follow)
+	assert.Equal(t, "tcp.stream eq 0", follow.Filter)
+	assert.Equal(t, "10.0.0.1:40000", follow.Node0)
+	assert.Equal(t, "10.0.0.2:80", follow.Node1)
+
+	var client, server string
+	for _, chunk := range follow.Bytes {
+		if chunk.Dirn == streams.Client {
+			client += string(chunk.Data)
+		} else {
+			server += string(chunk.Data)
+		}
+	}
+	assert.Equal(t, "GET / HTTP/1.1\r\nHost: \r\n", client)
+	assert.Equal(t, "HTTP/1.1 200 OK\r\n", server)
+	assert.Equal(t, 5, len(follow.Bytes))
+
+	b.Reset()
+	assert.NoError(t, writeFollow(context.Background(), path, "udp", 0, &b))
+	got, err = streams.ParseReader("", &b)
+	assert.NoError(t, err)
+	follow = got.(*streams.FollowStream)
+	assert.Equal(t, []streams.Bytes{
+		{Dirn: streams.Client, Data: []byte("ping")},
+		{Dirn: streams.Server, Data: []byte("pong")},
+	}, follow.Bytes)
+
+	assert.Error(t, writeFollow(context.Background(), path, "tcp", 3, &b))
+}
+
+func TestStreamPdml(t *testing.T) {
+	path := writeStreamPcap(t)
+	defer os.RemoveAll(filepath.Dir(path))
+
+	var b bytes.Buffer
+	assert.NoError(t, writeStreamPdml(context.Background(), path, "tcp", 0, &b))
+	out := b.String()
+	assert.Equal(t, 10, strings.Count(out, "<packet>"))
+	assert.Equal(t, 5, strings.Count(out, `<field name="tcp.len" show="0"/>`))
+	assert.Contains(t, out, `<field name="tcp.len" show="16"/>`)
+}
+
+//======================================================================
+// Local Variables:
+// mode: Go
+// fill-column: 78
+// End:
@@ -0,0 +1,179 @@
+// Copyright 2019-2022 Graham Clark. All rights reserved.  Use of this source
+// code is governed by the MIT license that can be found in the LICENSE
+// file.
+
+package objects
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gcla/termshark/v2/pkg/streams"
+)
+
+//======================================================================
+
+var (
+	// 227 Entering Passive Mode (192,168,0,1,195,80)
+	ftpPasvRE = regexp.MustCompile(`^227 .*?(\d+),(\d+),(\d+),(\d+),(\d+),(\d+)`)
+	// 229 Entering Extended Passive Mode (|||50000|)
+	ftpEpsvRE = regexp.MustCompile(`^229 .*\((.)(.)(.)(\d+)(.)\)`)
+	// PORT 192,168,0,2,195,81
+	ftpPortRE = regexp.MustCompile(`^(?i:PORT) (\d+),(\d+),(\d+),(\d+),(\d+),(\d+)`)
+	// EPRT |2|::1|50000|
+	ftpEprtRE = regexp.MustCompile(`^(?i:EPRT) (.)\d+(.)([^|]+)(.)(\d+)(.)`)
+)
+
+// ftpExtractor follows FTP control connections to learn the endpoints of
+// the data connections that will be opened, and which file each carries.
+type ftpExtractor struct {
+	// endpoint of a data connection to the file transferred over it
+	pending map[string]string
+	data    *ftpDataExtractor
+}
+
+// ftpDataExtractor saves the contents of FTP data connections. Directory
+// listings are data connections too, and are saved like any transfer.
+type ftpDataExtractor struct {
+	ftp   *ftpExtractor
+	convs []*conversation
+	names []string
+}
+
+type ftpControl struct {
+	// next unread byte of each direction
+	pos [2]int
+	// data endpoints announced but not yet given a filename
+	endpoints []string
+}
+
+func newFtpExtractor() *ftpExtractor {
+	res := &ftpExtractor{pending: make(map[string]string)}
+	res.data = &ftpDataExtractor{ftp: res}
+	return res
+}
+
+func (x *ftpExtractor) claim(c *conversation, first streams.Bytes) bool {
+	if c.conv.Proto != streams.TCP || !c.hasPort(21) {
+		return false
+	}
+	ctl := &ftpControl{}
+	c.onChunk = func(c *conversation, chunk streams.Bytes) {
+		x.control(ctl, c, chunk.Dirn)
+	}
+	return true
+}
+
+// control processes each complete line of the control connection as it
+// arrives, so the data connections are known before they start
+func (x *ftpExtractor) control(ctl *ftpControl, c *conversation, dirn streams.Direction) {
+	h := &c.halves[dirn]
+	for {
+		i := bytes.IndexByte(h.data[ctl.pos[dirn]:], '\n')
+		if i == -1 {
+			return
+		}
+		line := strings.TrimRight(string(h.data[ctl.pos[dirn]:ctl.pos[dirn]+i]), "\r")
+		ctl.pos[dirn] += i + 1
+
+		var endpoint string
+		if dirn == streams.Client {
+			if m := ftpPortRE.FindStringSubmatch(line); m != nil {
+				endpoint = ftpEndpoint(m[1:])
+			} else if m := ftpEprtRE.FindStringSubmatch(line); m != nil {
+				endpoint = net.JoinHostPort(m[3], m[5])
+			} else {
+				x.command(ctl, line)
+			}
+		} else {
+			if m := ftpPasvRE.FindStringSubmatch(line); m != nil {
+				endpoint = ftpEndpoint(m[1:])
+			} else if m := ftpEpsvRE.FindStringSubmatch(line); m != nil {
+				endpoint = net.JoinHostPort(host(c.conv.Server), m[4])
+			}
+		}
+		if endpoint != "" {
+			ctl.endpoints = append(ctl.endpoints, endpoint)
+			x.pending[endpoint] = ""
+		}
+	}
+}
+
+// command names the file carried by the data connections announced since
+// the last transfer. The client may connect before sending the command,
+// but the data only follows it.
+func (x *ftpExtractor) command(ctl *ftpControl, line string) {
+	fields := strings.SplitN(line, " ", 2)
+	name := ""
+	switch strings.ToUpper(fields[0]) {
+	case "RETR", "STOR", "STOU", "APPE":
+		if len(fields) == 2 {
+			name = fields[1]
+		}
+	case "LIST", "NLST", "MLSD":
+		name = "listing.txt"
+	default:
+		return
+	}
+	for _, ep := range ctl.endpoints {
+		if _, ok := x.pending[ep]; ok {
+			x.pending[ep] = name
+		}
+	}
+	ctl.endpoints = nil
+}
+
+// ftpEndpoint turns the six numbers of PORT and 227 into host:port
+func ftpEndpoint(parts []string) string {
+	n := make([]int, 6)
+	for i := range n {
+		n[i], _ = strconv.Atoi(parts[i])
+	}
+	return net.JoinHostPort(fmt.Sprintf("%d.%d.%d.%d", n[0], n[1], n[2], n[3]), strconv.Itoa(n[4]<<8|n[5]))
+}
+
+func (x *ftpExtractor) objects() []*Object {
+	return nil
+}
+
+func (x *ftpDataExtractor) claim(c *conversation, first streams.Bytes) bool {
+	if c.conv.Proto != streams.TCP {
+		return false
+	}
+	for _, ep := range []string{c.conv.Server, c.conv.Client} {
+		if name, ok := x.ftp.pending[ep]; ok {
+			delete(x.ftp.pending, ep)
+			x.convs = append(x.convs, c)
+			x.names = append(x.names, name)
+			return true
+		}
+	}
+	return false
+}
+
+func (x *ftpDataExtractor) objects() []*Object {
+	res := make([]*Object, 0)
+	for i, c := range x.convs {
+		// Data flows one way only; which depends on who connected
+		dirn := streams.Client
+		if len(c.halves[streams.Server].data) > len(c.halves[streams.Client].data) {
+			dirn = streams.Server
+		}
+		data := c.halves[dirn].data
+		obj := c.object("FTP-DATA", dirn, 0, len(data))
+		obj.Filename = x.names[i]
+		obj.Data = data
+		res = append(res, obj)
+	}
+	return res
+}
+
+//======================================================================
+// Local Variables:
+// mode: Go
+// fill-column: 78
+// End:
@@ -0,0 +1,186 @@
+// Copyright 2019-2022 Graham Clark. All rights reserved.  Use of this source
+// code is governed by the MIT license that can be found in the LICENSE
+// file.
+
+package objects
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/gcla/termshark/v2/pkg/streams"
+)
+
+//======================================================================
+
+var httpStartRE = regexp.MustCompile(`^(HTTP/1\.[01] [0-9]{3}|[A-Z-]+ \S+ HTTP/1\.[01]\r?\n)`)
+
+// httpExtractor saves the bodies of HTTP/1.x requests and responses.
+// Requests and responses on a connection are paired in order, as HTTP/1.1
+// pipelining requires.
+type httpExtractor struct {
+	convs []*conversation
+}
+
+func (x *httpExtractor) claim(c *conversation, first streams.Bytes) bool {
+	if c.conv.Proto != streams.TCP || !httpStartRE.Match(first.Data) {
+		return false
+	}
+	x.convs = append(x.convs, c)
+	return true
+}
+
+func (x *httpExtractor) objects() []*Object {
+	res := make([]*Object, 0)
+	for _, c := range x.convs {
+		reqs := make([]*http.Request, 0)
+		reader := newMessageReader(c.halves[streams.Client].data)
+		for !reader.done() {
+			start := reader.offset()
+			req, err := http.ReadRequest(reader.br)
+			if err != nil {
+				break
+			}
+			body, err := ioutil.ReadAll(req.Body)
+			if err != nil && len(body) == 0 {
+				break
+			}
+			reqs = append(reqs, req)
+			if len(body) > 0 {
+				obj := c.object("HTTP", streams.Client, start, reader.offset())
+				fillHTTPObject(obj, req, req.Header, decodeBody(req.Header, body))
+				res = append(res, obj)
+			}
+		}
+
+		reader = newMessageReader(c.halves[streams.Server].data)
+		for i := 0; !reader.done(); {
+			var req *http.Request
+			if i < len(reqs) {
+				req = reqs[i]
+			}
+			start := reader.offset()
+			resp, err := http.ReadResponse(reader.br, req)
+			if err != nil {
+				break
+			}
+			body, err := ioutil.ReadAll(resp.Body)
+			if err != nil && len(body) == 0 {
+				break
+			}
+			// 100 Continue and friends precede the real response
+			if resp.StatusCode >= 100 && resp.StatusCode < 200 {
+				continue
+			}
+			i++
+			if len(body) > 0 {
+				obj := c.object("HTTP", streams.Server, start, reader.offset())
+				fillHTTPObject(obj, req, resp.Header, decodeBody(resp.Header, body))
+				res = append(res, obj)
+			}
+		}
+	}
+	return res
+}
+
+func fillHTTPObject(obj *Object, req *http.Request, header http.Header, body []byte) {
+	obj.Data = body
+	if ct := header.Get("Content-Type"); ct != "" {
+		obj.ContentType = ct
+		if mt, _, err := mime.ParseMediaType(ct); err == nil {
+			obj.ContentType = mt
+		}
+	}
+	if _, params, err := mime.ParseMediaType(header.Get("Content-Disposition")); err == nil {
+		obj.Filename = params["filename"]
+	}
+	if req != nil {
+		if req.Host != "" {
+			obj.Hostname = req.Host
+		}
+		if obj.Filename == "" && req.URL != nil {
+			obj.Filename = path.Base(req.URL.Path)
+		}
+	}
+	if obj.Filename == "" || obj.Filename == "/" || obj.Filename == "." {
+		if obj.ContentType == "text/html" {
+			obj.Filename = "index.html"
+		} else {
+			obj.Filename = "object"
+		}
+	}
+}
+
+// maxDecodedBody caps what a compressed body may decode to, so a
+// compression bomb in a capture can't exhaust memory
+var maxDecodedBody int64 = 64 << 20
+
+// decodeBody undoes a gzip or deflate Content-Encoding. net/http has
+// already removed any chunked Transfer-Encoding. If decoding fails, or the
+// decoded body would be larger than maxDecodedBody, the body is kept as it
+// was sent.
+func decodeBody(header http.Header, body []byte) []byte {
+	var r io.Reader
+	switch strings.ToLower(strings.TrimSpace(header.Get("Content-Encoding"))) {
+	case "gzip", "x-gzip":
+		gz, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return body
+		}
+		r = gz
+	case "deflate":
+		// Meant to be zlib-wrapped, but some servers send raw deflate
+		if zr, err := zlib.NewReader(bytes.NewReader(body)); err == nil {
+			r = zr
+		} else {
+			r = flate.NewReader(bytes.NewReader(body))
+		}
+	default:
+		return body
+	}
+	res, err := ioutil.ReadAll(io.LimitReader(r, maxDecodedBody+1))
+	if (err != nil && len(res) == 0) || int64(len(res)) > maxDecodedBody {
+		return body
+	}
+	return res
+}
+
+//======================================================================
+
+// messageReader reads messages from one direction of a conversation and
+// tracks the offset of the next unread byte, so each message can be mapped
+// back to the frames carrying it.
+type messageReader struct {
+	r  *bytes.Reader
+	br *bufio.Reader
+	n  int
+}
+
+func newMessageReader(data []byte) *messageReader {
+	r := bytes.NewReader(data)
+	return &messageReader{r: r, br: bufio.NewReader(r), n: len(data)}
+}
+
+func (m *messageReader) offset() int {
+	return m.n - m.r.Len() - m.br.Buffered()
+}
+
+func (m *messageReader) done() bool {
+	return m.offset() >= m.n
+}
+
+//======================================================================
+// Local Variables:
+// mode: Go
+// fill-column: 78
+// End:
@@ -0,0 +1,336 @@
+// Copyright 2019-2022 Graham Clark. All rights reserved.  Use of this source
+// code is governed by the MIT license that can be found in the LICENSE
+// file.
+
+// Package objects carves the files transferred in a capture out of its
+// reassembled TCP and UDP streams: HTTP/1.x bodies (chunked and compressed
+// ones included), files read and written over SMB2, FTP-DATA transfers, TFTP
+// transfers and emails sent over SMTP along with their attachments.
+package objects
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/gcla/termshark/v2/pkg/native"
+	"github.com/gcla/termshark/v2/pkg/streams"
+)
+
+//======================================================================
+
+// Object is one file found in a capture.
+type Object struct {
+	Protocol    string // HTTP, SMB, FTP-DATA, TFTP or IMF
+	Hostname    string
+	Filename    string
+	ContentType string
+	Data        []byte
+
+	Transport string // tcp or udp
+	Stream    int    // tcp.stream or udp.stream of the transfer
+	Packets   []int  // frames carrying the object, in order
+
+	MD5    string
+	SHA1   string
+	SHA256 string
+}
+
+func (o *Object) Size() int {
+	return len(o.Data)
+}
+
+func (o *Object) String() string {
+	return fmt.Sprintf("%s %s %s (%d bytes)", o.Protocol, o.Hostname, o.Filename, len(o.Data))
+}
+
+// finish fills in what can be derived from the data
+func (o *Object) finish() {
+	if o.Filename == "" {
+		o.Filename = "object"
+	}
+	if o.ContentType == "" {
+		o.ContentType = mime.TypeByExtension(path.Ext(o.Filename))
+	}
+	if o.ContentType == "" {
+		o.ContentType = "application/octet-stream"
+	}
+	m := md5.Sum(o.Data)
+	o.MD5 = hex.EncodeToString(m[:])
+	s1 := sha1.Sum(o.Data)
+	o.SHA1 = hex.EncodeToString(s1[:])
+	s256 := sha256.Sum256(o.Data)
+	o.SHA256 = hex.EncodeToString(s256[:])
+}
+
+//======================================================================
+
+// extractor is implemented per protocol. claim is offered the first chunk
+// of each conversation not yet claimed; objects is called once the whole
+// capture is read.
+type extractor interface {
+	claim(c *conversation, first streams.Bytes) bool
+	objects() []*Object
+}
+
+// Extract reads the capture at path once and returns the objects in it,
+// ordered by the first frame carrying each.
+func Extract(ctx context.Context, path string) ([]*Object, error) {
+	ftp := newFtpExtractor()
+	tftp := newTftpExtractor()
+	// Data connections announced over FTP are claimed before any guess is
+	// made from ports or content
+	extractors := []extractor{
+		ftp.data,
+		tftp,
+		ftp,
+		&smbExtractor{},
+		&smtpExtractor{},
+		&httpExtractor{},
+	}
+
+	convs := make(map[*native.Conversation]*conversation)
+	_, err := native.ReassembleStreams(ctx, path, func(conv *native.Conversation, number int, chunk streams.Bytes) error {
+		c, ok := convs[conv]
+		if !ok {
+			c = newConversation(conv)
+			for _, x := range extractors {
+				if x.claim(c, chunk) {
+					c.claimed = true
+					break
+				}
+			}
+			convs[conv] = c
+		}
+		if c.claimed {
+			c.add(number, chunk)
+			if c.onChunk != nil {
+				c.onChunk(c, chunk)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]*Object, 0)
+	for _, x := range extractors {
+		res = append(res, x.objects()...)
+	}
+	for _, o := range res {
+		o.finish()
+	}
+	sort.SliceStable(res, func(i, j int) bool {
+		return firstPacket(res[i]) < firstPacket(res[j])
+	})
+	return res, nil
+}
+
+func firstPacket(o *Object) int {
+	if len(o.Packets) == 0 {
+		return 0
+	}
+	return o.Packets[0]
+}
+
+// Save writes objects into dir and returns the paths written. Names come
+// from the objects' filenames, made safe and unique within dir.
+func Save(dir string, objs []*Object) ([]string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	used := make(map[string]bool)
+	res := make([]string, 0, len(objs))
+	for _, o := range objs {
+		name := safeFilename(o.Filename)
+		base, ext := strings.TrimSuffix(name, filepath.Ext(name)), filepath.Ext(name)
+		for i := 1; ; i++ {
+			_, err := os.Stat(filepath.Join(dir, name))
+			if !used[name] && os.IsNotExist(err) {
+				break
+			}
+			name = fmt.Sprintf("%s(%d)%s", base, i, ext)
+		}
+		used[name] = true
+		file := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(file, o.Data, 0644); err != nil {
+			return res, err
+		}
+		res = append(res, file)
+	}
+	return res, nil
+}
+
+// WriteTable lists objects one per line as Wireshark's Export Objects
+// dialog does, with the frame numbers and stream each came from.
+func WriteTable(w io.Writer, objs []*Object) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "Packet\tProtocol\tHostname\tContent Type\tSize\tFilename\tStream")
+	for _, o := range objs {
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%d\t%s\t%s.stream eq %d\n",
+			firstPacket(o), o.Protocol, o.Hostname, o.ContentType, o.Size(), o.Filename, o.Transport, o.Stream)
+	}
+	return tw.Flush()
+}
+
+// safeFilename keeps the last element of a path from a URI, SMB share or
+// email and replaces characters that are awkward in filenames
+func safeFilename(name string) string {
+	name = strings.Replace(name, "\\", "/", -1)
+	name = path.Base(name)
+	name = strings.Map(func(r rune) rune {
+		switch {
+		case r < 0x20, r == 0x7f, strings.ContainsRune(`/\:*?"<>|`, r):
+			return '_'
+		}
+		return r
+	}, name)
+	if name == "." || name == ".." || name == "/" || name == "" {
+		name = "object"
+	}
+	if len(name) > 200 {
+		name = name[:200]
+	}
+	return name
+}
+
+//======================================================================
+
+type mark struct {
+	offset int
+	number int
+}
+
+// half is one direction of a conversation's reassembled data, with the
+// frame that carried each chunk
+type half struct {
+	data  []byte
+	marks []mark // one per chunk - for UDP, one per datagram
+}
+
+// packets returns the frames that carried data[start:end]
+func (h *half) packets(start, end int) []int {
+	res := make([]int, 0)
+	i := sort.Search(len(h.marks), func(i int) bool {
+		return h.marks[i].offset > start
+	}) - 1
+	if i < 0 {
+		i = 0
+	}
+	for ; i < len(h.marks) && h.marks[i].offset < end; i++ {
+		res = append(res, h.marks[i].number)
+	}
+	return uniqueSorted(res)
+}
+
+// uniqueSorted sorts frame numbers in place and drops repeats - segments
+// that arrived out of order are reassembled in sequence order
+func uniqueSorted(numbers []int) []int {
+	sort.Ints(numbers)
+	res := numbers[:0]
+	for _, n := range numbers {
+		if len(res) == 0 || res[len(res)-1] != n {
+			res = append(res, n)
+		}
+	}
+	return res
+}
+
+// datagram returns chunk i of a UDP conversation
+func (h *half) datagram(i int) []byte {
+	end := len(h.data)
+	if i+1 < len(h.marks) {
+		end = h.marks[i+1].offset
+	}
+	return h.data[h.marks[i].offset:end]
+}
+
+type conversation struct {
+	conv    *native.Conversation
+	halves  [2]half
+	claimed bool
+	// called after each chunk is added, for extractors that must react
+	// during the read, such as FTP learning the ports of data connections
+	onChunk func(c *conversation, chunk streams.Bytes)
+}
+
+func newConversation(conv *native.Conversation) *conversation {
+	return &conversation{conv: conv}
+}
+
+func (c *conversation) add(number int, chunk streams.Bytes) {
+	h := &c.halves[chunk.Dirn]
+	h.marks = append(h.marks, mark{offset: len(h.data), number: number})
+	h.data = append(h.data, chunk.Data...)
+}
+
+func (c *conversation) transport() string {
+	if c.conv.Proto == streams.UDP {
+		return "udp"
+	}
+	return "tcp"
+}
+
+// object starts an object carried by data[start:end] of direction dirn
+func (c *conversation) object(protocol string, dirn streams.Direction, start, end int) *Object {
+	return &Object{
+		Protocol:  protocol,
+		Hostname:  host(c.conv.Server),
+		Transport: c.transport(),
+		Stream:    c.conv.Index,
+		Packets:   c.halves[dirn].packets(start, end),
+	}
+}
+
+// client and server ports of the conversation
+func (c *conversation) ports() (int, int) {
+	return port(c.conv.Client), port(c.conv.Server)
+}
+
+func (c *conversation) hasPort(ports ...int) bool {
+	cp, sp := c.ports()
+	for _, p := range ports {
+		if cp == p || sp == p {
+			return true
+		}
+	}
+	return false
+}
+
+func host(endpoint string) string {
+	h, _, err := net.SplitHostPort(endpoint)
+	if err != nil {
+		return endpoint
+	}
+	return h
+}
+
+func port(endpoint string) int {
+	_, p, err := net.SplitHostPort(endpoint)
+	if err != nil {
+		return 0
+	}
+	res, _ := strconv.Atoi(p)
+	return res
+}
+
+//======================================================================
+// Local Variables:
+// mode: Go
+// fill-column: 78
+// End:
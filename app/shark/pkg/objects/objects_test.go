@@ -0,0 +1,399 @@
+// Copyright 2019-2022 Graham Clark. All rights reserved.  Use of this source
+// code is governed by the MIT license that can be found in the LICENSE
+// file.
+
+package objects
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf16"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+	"github.com/stretchr/testify/assert"
+)
+
+//======================================================================
+
+type capture struct {
+	t      *testing.T
+	frames [][]byte
+}
+
+type endpoint struct {
+	ip   net.IP
+	port int
+}
+
+func ep(ip string, port int) endpoint {
+	return endpoint{ip: net.ParseIP(ip).To4(), port: port}
+}
+
+func (c *capture) add(src, dst endpoint, transport gopacket.SerializableLayer, data []byte) int {
+	proto := layers.IPProtocolTCP
+	if _, ok := transport.(*layers.UDP); ok {
+		proto = layers.IPProtocolUDP
+	}
+	buf := gopacket.NewSerializeBuffer()
+	ip := &layers.IPv4{Version: 4, TTL: 64, Protocol: proto, SrcIP: src.ip, DstIP: dst.ip}
+	if nl, ok := transport.(interface {
+		SetNetworkLayerForChecksum(gopacket.NetworkLayer) error
+	}); ok {
+		assert.NoError(c.t, nl.SetNetworkLayerForChecksum(ip))
+	}
+	assert.NoError(c.t, gopacket.SerializeLayers(buf, gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true},
+		&layers.Ethernet{
+			SrcMAC:       net.HardwareAddr{0, 1, 2, 3, 4, 5},
+			DstMAC:       net.HardwareAddr{0, 1, 2, 3, 4, 6},
+			EthernetType: layers.EthernetTypeIPv4,
+		},
+		ip, transport, gopacket.Payload(data),
+	))
+	c.frames = append(c.frames, buf.Bytes())
+	return len(c.frames)
+}
+
+func (c *capture) udp(src, dst endpoint, data []byte) int {
+	return c.add(src, dst, &layers.UDP{SrcPort: layers.UDPPort(src.port), DstPort: layers.UDPPort(dst.port)}, data)
+}
+
+func (c *capture) write() string {
+	dir, err := ioutil.TempDir("", "termshark-objects")
+	assert.NoError(c.t, err)
+	path := filepath.Join(dir, "objects.pcap")
+	f, err := os.Create(path)
+	assert.NoError(c.t, err)
+	defer f.Close()
+	w := pcapgo.NewWriter(f)
+	assert.NoError(c.t, w.WriteFileHeader(65535, layers.LinkTypeEthernet))
+	ts := time.Unix(1600000000, 0)
+	for i, data := range c.frames {
+		ci := gopacket.CaptureInfo{Timestamp: ts.Add(time.Duration(i) * time.Millisecond), CaptureLength: len(data), Length: len(data)}
+		assert.NoError(c.t, w.WritePacket(ci, data))
+	}
+	return path
+}
+
+type tcpFlow struct {
+	c              *capture
+	client, server endpoint
+	seq            [2]uint32
+}
+
+func (c *capture) tcp(client, server endpoint) *tcpFlow {
+	f := &tcpFlow{c: c, client: client, server: server, seq: [2]uint32{1000, 5000}}
+	f.segment(true, "S", nil)
+	f.segment(false, "S", nil)
+	return f
+}
+
+func (f *tcpFlow) segment(fromClient bool, flags string, data []byte) int {
+	src, dst, i := f.client, f.server, 0
+	if !fromClient {
+		src, dst, i = f.server, f.client, 1
+	}
+	tcp := &layers.TCP{
+		SrcPort: layers.TCPPort(src.port), DstPort: layers.TCPPort(dst.port),
+		Seq: f.seq[i], Window: 512, ACK: flags != "S",
+		SYN: flags == "S",
+		FIN: flags == "F",
+	}
+	f.seq[i] += uint32(len(data))
+	if tcp.SYN || tcp.FIN {
+		f.seq[i]++
+	}
+	return f.c.add(src, dst, tcp, data)
+}
+
+// send splits data into segments of at most size bytes
+func (f *tcpFlow) send(fromClient bool, data string, size int) []int {
+	res := make([]int, 0)
+	for len(data) > 0 {
+		n := size
+		if n > len(data) {
+			n = len(data)
+		}
+		res = append(res, f.segment(fromClient, "", []byte(data[:n])))
+		data = data[n:]
+	}
+	return res
+}
+
+func extract(t *testing.T, c *capture) []*Object {
+	path := c.write()
+	defer os.RemoveAll(filepath.Dir(path))
+	res, err := Extract(context.Background(), path)
+	assert.NoError(t, err)
+	return res
+}
+
+//======================================================================
+
+func TestHTTP(t *testing.T) {
+	c := &capture{t: t}
+	f := c.tcp(ep("10.0.0.1", 40000), ep("10.0.0.2", 80))
+
+	f.send(true, "GET /img/logo.png HTTP/1.1\r\nHost: example.com\r\n\r\n", 1000)
+	logo := strings.Repeat("\x89PNG", 100)
+	resp1 := f.send(false, fmt.Sprintf("HTTP/1.1 200 OK\r\nContent-Type: image/png\r\nContent-Length: %d\r\n\r\n%s", len(logo), logo), 150)
+
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	_, err := zw.Write([]byte("<html>hello</html>"))
+	assert.NoError(t, err)
+	assert.NoError(t, zw.Close())
+	body := gz.String()
+	chunked := fmt.Sprintf("%x\r\n%s\r\n%x\r\n%s\r\n0\r\n\r\n", 10, body[:10], len(body)-10, body[10:])
+
+	f.send(true, "HEAD /x HTTP/1.1\r\nHost: example.com\r\n\r\nGET / HTTP/1.1\r\nHost: example.com\r\n\r\n", 1000)
+	f.send(false, "HTTP/1.1 200 OK\r\nContent-Length: 99\r\n\r\n", 1000)
+	resp3 := f.send(false, "HTTP/1.1 200 OK\r\nContent-Type: text/html; charset=utf-8\r\nContent-Encoding: gzip\r\n"+
+		"Transfer-Encoding: chunked\r\n\r\n"+chunked, 40)
+
+	post := f.send(true, "POST /upload HTTP/1.1\r\nHost: example.com\r\nContent-Disposition: attachment; filename=\"notes.txt\"\r\n"+
+		"Content-Length: 5\r\n\r\nnotes", 1000)
+	f.send(false, "HTTP/1.1 100 Continue\r\n\r\nHTTP/1.1 204 No Content\r\n\r\n", 1000)
+
+	objs := extract(t, c)
+	assert.Equal(t, 3, len(objs))
+
+	assert.Equal(t, "HTTP", objs[0].Protocol)
+	assert.Equal(t, "example.com", objs[0].Hostname)
+	assert.Equal(t, "logo.png", objs[0].Filename)
+	assert.Equal(t, "image/png", objs[0].ContentType)
+	assert.Equal(t, logo, string(objs[0].Data))
+	assert.Equal(t, 400, objs[0].Size())
+	assert.Equal(t, "tcp", objs[0].Transport)
+	assert.Equal(t, 0, objs[0].Stream)
+	assert.Equal(t, resp1, objs[0].Packets)
+
+	assert.Equal(t, "index.html", objs[1].Filename)
+	assert.Equal(t, "text/html", objs[1].ContentType)
+	assert.Equal(t, "<html>hello</html>", string(objs[1].Data))
+	assert.Equal(t, resp3, objs[1].Packets)
+
+	assert.Equal(t, "notes.txt", objs[2].Filename)
+	assert.Equal(t, "text/plain; charset=utf-8", objs[2].ContentType)
+	assert.Equal(t, "notes", string(objs[2].Data))
+	assert.Equal(t, post, objs[2].Packets)
+	assert.Equal(t, "3add7b9612102f2a7dbe4ed4fe886e07e847c24d", objs[2].SHA1)
+}
+
+func TestDecodeBodyLimit(t *testing.T) {
+	defer func(n int64) { maxDecodedBody = n }(maxDecodedBody)
+	maxDecodedBody = 1024
+
+	gzipped := func(data []byte) []byte {
+		var gz bytes.Buffer
+		zw := gzip.NewWriter(&gz)
+		_, err := zw.Write(data)
+		assert.NoError(t, err)
+		assert.NoError(t, zw.Close())
+		return gz.Bytes()
+	}
+	header := http.Header{"Content-Encoding": []string{"gzip"}}
+
+	small := bytes.Repeat([]byte("a"), 1024)
+	assert.Equal(t, small, decodeBody(header, gzipped(small)))
+
+	// A body inflating past the cap is kept compressed
+	bomb := gzipped(make([]byte, 1<<20))
+	assert.Equal(t, bomb, decodeBody(header, bomb))
+}
+
+func TestFTP(t *testing.T) {
+	c := &capture{t: t}
+	client, server := ep("10.0.0.1", 40000), ep("10.0.0.2", 21)
+	ctl := c.tcp(client, server)
+	ctl.send(false, "220 ready\r\n", 1000)
+	ctl.send(true, "PASV\r\n", 1000)
+	ctl.send(false, "227 Entering Passive Mode (10,0,0,2,195,80).\r\n", 1000)
+	data := c.tcp(ep("10.0.0.1", 40001), ep("10.0.0.2", 50000))
+	ctl.send(true, "RETR pub/report.pdf\r\n", 1000)
+	ctl.send(false, "150 Opening\r\n", 1000)
+	carried := data.send(false, strings.Repeat("%PDF", 50), 64)
+	data.segment(false, "F", nil)
+	ctl.send(false, "226 Done\r\n", 1000)
+
+	// Active mode, with the data connection opened by the server
+	ctl.send(true, "PORT 10,0,0,1,156,65\r\n", 1000)
+	ctl.send(false, "200 OK\r\n", 1000)
+	ctl.send(true, "STOR up.txt\r\n", 1000)
+	active := c.tcp(ep("10.0.0.2", 20), ep("10.0.0.1", 40001))
+	active.send(false, "uploaded", 1000)
+
+	objs := extract(t, c)
+	assert.Equal(t, 2, len(objs))
+	assert.Equal(t, "FTP-DATA", objs[0].Protocol)
+	assert.Equal(t, "pub/report.pdf", objs[0].Filename)
+	assert.Equal(t, "application/pdf", objs[0].ContentType)
+	assert.Equal(t, 200, objs[0].Size())
+	assert.Equal(t, 1, objs[0].Stream)
+	assert.Equal(t, carried, objs[0].Packets)
+
+	assert.Equal(t, "up.txt", objs[1].Filename)
+	assert.Equal(t, "uploaded", string(objs[1].Data))
+	assert.Equal(t, 2, objs[1].Stream)
+}
+
+func tftpPacket(op uint16, block uint16, data string) []byte {
+	res := make([]byte, 4, 4+len(data))
+	binary.BigEndian.PutUint16(res, op)
+	binary.BigEndian.PutUint16(res[2:], block)
+	return append(res, data...)
+}
+
+func TestTFTP(t *testing.T) {
+	c := &capture{t: t}
+	client, server, tid := ep("10.0.0.1", 3000), ep("10.0.0.2", 69), ep("10.0.0.2", 4000)
+	c.udp(client, server, []byte("\x00\x01pxelinux\x00octet\x00"))
+	b1 := c.udp(tid, client, tftpPacket(tftpDATA, 1, strings.Repeat("a", 512)))
+	c.udp(client, tid, tftpPacket(4, 1, ""))
+	c.udp(tid, client, tftpPacket(tftpDATA, 1, strings.Repeat("a", 512))) // ACK lost
+	b2 := c.udp(tid, client, tftpPacket(tftpDATA, 2, "tail"))
+	c.udp(client, tid, tftpPacket(4, 2, ""))
+
+	objs := extract(t, c)
+	assert.Equal(t, 1, len(objs))
+	assert.Equal(t, "TFTP", objs[0].Protocol)
+	assert.Equal(t, "udp", objs[0].Transport)
+	assert.Equal(t, 1, objs[0].Stream)
+	assert.Equal(t, "pxelinux", objs[0].Filename)
+	assert.Equal(t, "10.0.0.2", objs[0].Hostname)
+	assert.Equal(t, strings.Repeat("a", 512)+"tail", string(objs[0].Data))
+	assert.Equal(t, []int{b1, b2}, objs[0].Packets)
+
+	var table bytes.Buffer
+	assert.NoError(t, WriteTable(&table, objs))
+	lines := strings.Split(strings.TrimSpace(table.String()), "\n")
+	assert.Equal(t, 2, len(lines))
+	assert.Equal(t, []string{"2", "TFTP", "10.0.0.2", "application/octet-stream", "516", "pxelinux", "udp.stream", "eq", "1"},
+		strings.Fields(lines[1]))
+}
+
+func TestSMTP(t *testing.T) {
+	c := &capture{t: t}
+	f := c.tcp(ep("10.0.0.1", 40000), ep("10.0.0.2", 25))
+	f.send(false, "220 mx\r\n", 1000)
+	f.send(true, "EHLO me\r\nMAIL FROM:<a@b>\r\nRCPT TO:<c@d>\r\nDATA\r\n", 1000)
+	f.send(false, "354 go ahead\r\n", 1000)
+	msg := "Subject: =?utf-8?q?Quarterly_figures?=\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: multipart/mixed; boundary=XX\r\n\r\n" +
+		"--XX\r\nContent-Type: text/plain\r\n\r\n..hidden dot\r\n" +
+		"--XX\r\nContent-Type: text/csv; name=\"q3.csv\"\r\nContent-Transfer-Encoding: base64\r\n\r\n" +
+		"YSxiLGMK\r\nMSwyLDMK\r\n" +
+		"--XX--\r\n"
+	carried := f.send(true, msg+".\r\n", 100)
+	f.send(true, "QUIT\r\n", 1000)
+
+	objs := extract(t, c)
+	assert.Equal(t, 2, len(objs))
+	assert.Equal(t, "IMF", objs[0].Protocol)
+	assert.Equal(t, "Quarterly figures.eml", objs[0].Filename)
+	assert.Equal(t, "message/rfc822", objs[0].ContentType)
+	assert.Equal(t, strings.Replace(msg, "..hidden", ".hidden", 1), string(objs[0].Data))
+	assert.Equal(t, carried, objs[0].Packets)
+
+	assert.Equal(t, "q3.csv", objs[1].Filename)
+	assert.Equal(t, "text/csv", objs[1].ContentType)
+	assert.Equal(t, "a,b,c\n1,2,3\n", string(objs[1].Data))
+}
+
+//======================================================================
+
+func smb2(command uint16, response bool, id uint64, body []byte) []byte {
+	hdr := make([]byte, smb2HeaderLen)
+	copy(hdr, smb2Magic)
+	binary.LittleEndian.PutUint16(hdr[4:], smb2HeaderLen)
+	binary.LittleEndian.PutUint16(hdr[12:], command)
+	if response {
+		binary.LittleEndian.PutUint32(hdr[16:], smb2FlagResponse)
+	}
+	binary.LittleEndian.PutUint64(hdr[24:], id)
+	msg := append(hdr, body...)
+	nb := make([]byte, 4)
+	binary.BigEndian.PutUint32(nb, uint32(len(msg)))
+	return append(nb, msg...)
+}
+
+func TestSMB(t *testing.T) {
+	c := &capture{t: t}
+	f := c.tcp(ep("10.0.0.1", 40000), ep("10.0.0.2", 445))
+	fid := []byte("0123456789abcdef")
+
+	name := utf16.Encode([]rune(`docs\plan.txt`))
+	create := make([]byte, 56+2*len(name))
+	binary.LittleEndian.PutUint16(create[44:], smb2HeaderLen+56)
+	binary.LittleEndian.PutUint16(create[46:], uint16(2*len(name)))
+	for i, u := range name {
+		binary.LittleEndian.PutUint16(create[56+2*i:], u)
+	}
+	f.send(true, string(smb2(smb2Create, false, 1, create)), 1000)
+	created := make([]byte, 88)
+	copy(created[64:], fid)
+	f.send(false, string(smb2(smb2Create, true, 1, created)), 1000)
+
+	read := func(id uint64, offset uint64, data string) []int {
+		req := make([]byte, 48)
+		binary.LittleEndian.PutUint64(req[8:], offset)
+		copy(req[16:], fid)
+		f.send(true, string(smb2(smb2Read, false, id, req)), 1000)
+		resp := make([]byte, 16, 16+len(data))
+		resp[2] = smb2HeaderLen + 16
+		binary.LittleEndian.PutUint32(resp[4:], uint32(len(data)))
+		return f.send(false, string(smb2(smb2Read, true, id, append(resp, data...))), 60)
+	}
+	second := read(3, 5, " world")
+	first := read(2, 0, "hello")
+
+	objs := extract(t, c)
+	assert.Equal(t, 1, len(objs))
+	assert.Equal(t, "SMB", objs[0].Protocol)
+	assert.Equal(t, `docs\plan.txt`, objs[0].Filename)
+	assert.Equal(t, "hello world", string(objs[0].Data))
+	assert.Equal(t, append(second, first...), objs[0].Packets)
+}
+
+//======================================================================
+
+func TestSave(t *testing.T) {
+	dir, err := ioutil.TempDir("", "termshark-objects")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	objs := []*Object{
+		{Filename: "../../etc/passwd", Data: []byte("a")},
+		{Filename: "passwd", Data: []byte("b")},
+		{Filename: `C:\share\x?.txt`, Data: []byte("c")},
+	}
+	paths, err := Save(dir, objs)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		filepath.Join(dir, "passwd"),
+		filepath.Join(dir, "passwd(1)"),
+		filepath.Join(dir, "x_.txt"),
+	}, paths)
+	data, err := ioutil.ReadFile(paths[1])
+	assert.NoError(t, err)
+	assert.Equal(t, "b", string(data))
+}
+
+//======================================================================
+// Local Variables:
+// mode: Go
+// fill-column: 78
+// End:
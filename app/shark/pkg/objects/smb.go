@@ -0,0 +1,219 @@
+// Copyright 2019-2022 Graham Clark. All rights reserved.  Use of this source
+// code is governed by the MIT license that can be found in the LICENSE
+// file.
+
+package objects
+
+import (
+	"bytes"
+	"encoding/binary"
+	"unicode/utf16"
+
+	"github.com/gcla/termshark/v2/pkg/streams"
+)
+
+//======================================================================
+
+const (
+	smb2HeaderLen = 64
+
+	smb2Create = 0x05
+	smb2Read   = 0x08
+	smb2Write  = 0x09
+
+	smb2FlagResponse = 0x1
+	smb2FlagRelated  = 0x4
+)
+
+var smb2Magic = []byte("\xfeSMB")
+
+// smbExtractor rebuilds the files read and written over SMB2 and SMB3,
+// unsigned and unencrypted. The file a READ or WRITE refers to is named by
+// the CREATE that opened it. SMB1 is not supported.
+type smbExtractor struct {
+	convs []*conversation
+}
+
+// smb2Message is one SMB2 header and body; data starts at the header, as
+// the offsets in bodies count from there
+type smb2Message struct {
+	command  uint16
+	status   uint32
+	flags    uint32
+	id       uint64
+	data     []byte
+	from, to int // position in the stream, for the frames carrying it
+}
+
+func (m *smb2Message) body() []byte {
+	return m.data[smb2HeaderLen:]
+}
+
+type smbFile struct {
+	name    string
+	data    []byte
+	packets []int
+}
+
+func (f *smbFile) write(offset uint64, data []byte, packets []int) {
+	end := offset + uint64(len(data))
+	if end > 1<<32 {
+		return
+	}
+	if uint64(len(f.data)) < end {
+		f.data = append(f.data, make([]byte, int(end)-len(f.data))...)
+	}
+	copy(f.data[offset:], data)
+	f.packets = append(f.packets, packets...)
+}
+
+func (x *smbExtractor) claim(c *conversation, first streams.Bytes) bool {
+	if c.conv.Proto != streams.TCP || !c.hasPort(445, 139) {
+		return false
+	}
+	x.convs = append(x.convs, c)
+	return true
+}
+
+func (x *smbExtractor) objects() []*Object {
+	res := make([]*Object, 0)
+	for _, c := range x.convs {
+		requests := make(map[uint64]*smb2Message)
+		for _, m := range smb2Messages(c.halves[streams.Client].data) {
+			if m.flags&smb2FlagResponse == 0 {
+				requests[m.id] = m
+			}
+		}
+
+		files := make(map[string]*smbFile)
+		order := make([]*smbFile, 0)
+		var last []byte // FileId of the last CREATE, for related compounds
+		fileID := func(id []byte) []byte {
+			if bytes.Equal(id, bytes.Repeat([]byte{0xff}, 16)) {
+				return last
+			}
+			return id
+		}
+
+		responses := smb2Messages(c.halves[streams.Server].data)
+		for _, resp := range responses {
+			req := requests[resp.id]
+			if req == nil || resp.status != 0 || req.command != resp.command {
+				continue
+			}
+			switch resp.command {
+			case smb2Create:
+				rb, qb := resp.body(), req.body()
+				if len(rb) < 80 || len(qb) < 48 {
+					continue
+				}
+				nameOff := int(binary.LittleEndian.Uint16(qb[44:]))
+				nameLen := int(binary.LittleEndian.Uint16(qb[46:]))
+				if nameOff+nameLen > len(req.data) {
+					continue
+				}
+				last = rb[64:80]
+				f := &smbFile{name: utf16le(req.data[nameOff : nameOff+nameLen])}
+				files[string(last)] = f
+				order = append(order, f)
+			case smb2Read:
+				rb, qb := resp.body(), req.body()
+				if len(rb) < 8 || len(qb) < 32 {
+					continue
+				}
+				dataOff := int(rb[2])
+				dataLen := int(binary.LittleEndian.Uint32(rb[4:]))
+				if dataOff+dataLen > len(resp.data) {
+					continue
+				}
+				f := files[string(fileID(qb[16:32]))]
+				if f == nil {
+					continue
+				}
+				f.write(binary.LittleEndian.Uint64(qb[8:]), resp.data[dataOff:dataOff+dataLen],
+					c.halves[streams.Server].packets(resp.from, resp.to))
+			case smb2Write:
+				qb := req.body()
+				if len(qb) < 32 {
+					continue
+				}
+				dataOff := int(binary.LittleEndian.Uint16(qb[2:]))
+				dataLen := int(binary.LittleEndian.Uint32(qb[4:]))
+				if dataOff+dataLen > len(req.data) {
+					continue
+				}
+				f := files[string(fileID(qb[16:32]))]
+				if f == nil {
+					continue
+				}
+				f.write(binary.LittleEndian.Uint64(qb[8:]), req.data[dataOff:dataOff+dataLen],
+					c.halves[streams.Client].packets(req.from, req.to))
+			}
+		}
+
+		for _, f := range order {
+			if len(f.packets) == 0 {
+				continue
+			}
+			obj := c.object("SMB", streams.Server, 0, 0)
+			obj.Filename = f.name
+			obj.Data = f.data
+			obj.Packets = uniqueSorted(f.packets)
+			res = append(res, obj)
+		}
+	}
+	return res
+}
+
+// smb2Messages splits one direction of a connection into SMB2 messages.
+// Each NetBIOS session message holds one SMB2 message, or several chained
+// by NextCommand.
+func smb2Messages(data []byte) []*smb2Message {
+	res := make([]*smb2Message, 0)
+	for pos := 0; pos+4 <= len(data); {
+		length := int(binary.BigEndian.Uint32(data[pos:]) & 0xffffff)
+		start, end := pos+4, pos+4+length
+		if end > len(data) {
+			break
+		}
+		pos = end
+		for hdr := start; hdr+smb2HeaderLen <= end; {
+			if !bytes.Equal(data[hdr:hdr+4], smb2Magic) {
+				break
+			}
+			next := int(binary.LittleEndian.Uint32(data[hdr+20:]))
+			msgEnd := end
+			if next != 0 && hdr+next < end {
+				msgEnd = hdr + next
+			}
+			res = append(res, &smb2Message{
+				status:  binary.LittleEndian.Uint32(data[hdr+8:]),
+				command: binary.LittleEndian.Uint16(data[hdr+12:]),
+				flags:   binary.LittleEndian.Uint32(data[hdr+16:]),
+				id:      binary.LittleEndian.Uint64(data[hdr+24:]),
+				data:    data[hdr:msgEnd],
+				from:    hdr,
+				to:      msgEnd,
+			})
+			if next == 0 {
+				break
+			}
+			hdr += next
+		}
+	}
+	return res
+}
+
+func utf16le(b []byte) string {
+	u := make([]uint16, len(b)/2)
+	for i := range u {
+		u[i] = binary.LittleEndian.Uint16(b[2*i:])
+	}
+	return string(utf16.Decode(u))
+}
+
+//======================================================================
+// Local Variables:
+// mode: Go
+// fill-column: 78
+// End:
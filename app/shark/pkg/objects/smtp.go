@@ -0,0 +1,160 @@
+// Copyright 2019-2022 Graham Clark. All rights reserved.  Use of this source
+// code is governed by the MIT license that can be found in the LICENSE
+// file.
+
+package objects
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"strings"
+
+	"github.com/gcla/termshark/v2/pkg/streams"
+)
+
+//======================================================================
+
+// smtpExtractor saves each message sent with the SMTP DATA command as an
+// Internet Message Format object, plus an object for each attachment.
+// Sessions upgraded with STARTTLS are unreadable after the upgrade.
+type smtpExtractor struct {
+	convs []*conversation
+}
+
+func (x *smtpExtractor) claim(c *conversation, first streams.Bytes) bool {
+	if c.conv.Proto != streams.TCP || !c.hasPort(25, 587, 2525) {
+		return false
+	}
+	x.convs = append(x.convs, c)
+	return true
+}
+
+func (x *smtpExtractor) objects() []*Object {
+	res := make([]*Object, 0)
+	for _, c := range x.convs {
+		data := c.halves[streams.Client].data
+		inData := false
+		var msg bytes.Buffer
+		start := 0
+		for pos := 0; pos < len(data); {
+			end := bytes.IndexByte(data[pos:], '\n')
+			if end == -1 {
+				break
+			}
+			end += pos + 1
+			line := data[pos:end]
+			trimmed := strings.TrimRight(string(line), "\r\n")
+			switch {
+			case !inData:
+				if strings.EqualFold(trimmed, "DATA") {
+					inData = true
+					start = end
+					msg.Reset()
+				}
+			case trimmed == ".":
+				inData = false
+				res = append(res, imfObjects(c, msg.Bytes(), start, end)...)
+			default:
+				// RFC 5321 4.5.2 - a leading dot was doubled by the sender
+				if bytes.HasPrefix(line, []byte("..")) {
+					line = line[1:]
+				}
+				msg.Write(line)
+			}
+			pos = end
+		}
+	}
+	return res
+}
+
+// imfObjects returns the message carried by data[start:end] of the client
+// stream, followed by its attachments
+func imfObjects(c *conversation, msg []byte, start, end int) []*Object {
+	data := make([]byte, len(msg))
+	copy(data, msg)
+
+	eml := c.object("IMF", streams.Client, start, end)
+	eml.ContentType = "message/rfc822"
+	eml.Data = data
+	eml.Filename = "message.eml"
+	res := []*Object{eml}
+
+	m, err := mail.ReadMessage(bytes.NewReader(data))
+	if err != nil {
+		return res
+	}
+	dec := new(mime.WordDecoder)
+	if subject, err := dec.DecodeHeader(m.Header.Get("Subject")); err == nil && subject != "" {
+		eml.Filename = subject + ".eml"
+	}
+
+	for _, part := range mimeParts(m.Header.Get("Content-Type"), m.Body) {
+		obj := c.object("IMF", streams.Client, start, end)
+		obj.Filename = part.filename
+		obj.ContentType = part.contentType
+		obj.Data = part.data
+		res = append(res, obj)
+	}
+	return res
+}
+
+type mimePart struct {
+	filename    string
+	contentType string
+	data        []byte
+}
+
+// mimeParts returns the parts of a MIME body that carry a filename,
+// descending into nested multiparts. The quoted-printable encoding is
+// removed by mime/multipart, base64 here.
+func mimeParts(contentType string, body io.Reader) []mimePart {
+	res := make([]mimePart, 0)
+	mt, params, err := mime.ParseMediaType(contentType)
+	if err != nil || !strings.HasPrefix(mt, "multipart/") || params["boundary"] == "" {
+		return res
+	}
+	mr := multipart.NewReader(body, params["boundary"])
+	for {
+		p, err := mr.NextPart()
+		if err != nil {
+			break
+		}
+		ct := p.Header.Get("Content-Type")
+		pmt, pparams, _ := mime.ParseMediaType(ct)
+		if strings.HasPrefix(pmt, "multipart/") {
+			res = append(res, mimeParts(ct, p)...)
+			continue
+		}
+		name := p.FileName()
+		if name == "" {
+			name = pparams["name"]
+		}
+		if name == "" {
+			continue
+		}
+		var r io.Reader = p
+		if strings.EqualFold(strings.TrimSpace(p.Header.Get("Content-Transfer-Encoding")), "base64") {
+			r = base64.NewDecoder(base64.StdEncoding, p)
+		}
+		data, err := ioutil.ReadAll(r)
+		if err != nil && len(data) == 0 {
+			continue
+		}
+		if dname, err := new(mime.WordDecoder).DecodeHeader(name); err == nil {
+			name = dname
+		}
+		res = append(res, mimePart{filename: name, contentType: pmt, data: data})
+	}
+	return res
+}
+
+//======================================================================
+// Local Variables:
+// mode: Go
+// fill-column: 78
+// End:
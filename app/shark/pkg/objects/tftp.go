@@ -0,0 +1,139 @@
+// Copyright 2019-2022 Graham Clark. All rights reserved.  Use of this source
+// code is governed by the MIT license that can be found in the LICENSE
+// file.
+
+package objects
+
+import (
+	"bytes"
+	"encoding/binary"
+
+	"github.com/gcla/termshark/v2/pkg/streams"
+)
+
+//======================================================================
+
+const (
+	tftpRRQ  = 1
+	tftpWRQ  = 2
+	tftpDATA = 3
+)
+
+// tftpExtractor watches for read and write requests sent to port 69. The
+// server answers from a new port, so the transfer is a conversation of its
+// own, between that port and the requester's.
+type tftpExtractor struct {
+	// requester's endpoint to its request
+	pending   map[string]tftpRequest
+	transfers []*conversation
+	requests  []tftpRequest
+}
+
+type tftpRequest struct {
+	filename string
+	server   string
+}
+
+func newTftpExtractor() *tftpExtractor {
+	return &tftpExtractor{pending: make(map[string]tftpRequest)}
+}
+
+func (x *tftpExtractor) claim(c *conversation, first streams.Bytes) bool {
+	if c.conv.Proto != streams.UDP {
+		return false
+	}
+	if _, sp := c.ports(); sp == 69 {
+		c.onChunk = func(c *conversation, chunk streams.Bytes) {
+			if chunk.Dirn == streams.Client {
+				x.request(c, chunk.Data)
+			}
+		}
+		return true
+	}
+	for _, ep := range []string{c.conv.Server, c.conv.Client} {
+		if req, ok := x.pending[ep]; ok {
+			delete(x.pending, ep)
+			x.transfers = append(x.transfers, c)
+			x.requests = append(x.requests, req)
+			return true
+		}
+	}
+	return false
+}
+
+// request records an RRQ or WRQ: opcode, filename, NUL, mode, NUL
+func (x *tftpExtractor) request(c *conversation, data []byte) {
+	if len(data) < 4 {
+		return
+	}
+	op := binary.BigEndian.Uint16(data)
+	if op != tftpRRQ && op != tftpWRQ {
+		return
+	}
+	i := bytes.IndexByte(data[2:], 0)
+	if i <= 0 {
+		return
+	}
+	x.pending[c.conv.Client] = tftpRequest{
+		filename: string(data[2 : 2+i]),
+		server:   host(c.conv.Server),
+	}
+}
+
+func (x *tftpExtractor) objects() []*Object {
+	res := make([]*Object, 0)
+	for i, c := range x.transfers {
+		for _, dirn := range []streams.Direction{streams.Client, streams.Server} {
+			if obj := tftpTransfer(c, dirn); obj != nil {
+				obj.Filename = x.requests[i].filename
+				obj.Hostname = x.requests[i].server
+				res = append(res, obj)
+			}
+		}
+	}
+	return res
+}
+
+// tftpTransfer assembles the DATA blocks sent in one direction. Blocks
+// repeated after a lost ACK are skipped, and the transfer ends at the first
+// block shorter than the rest, or at a gap.
+func tftpTransfer(c *conversation, dirn streams.Direction) *Object {
+	h := &c.halves[dirn]
+	data := make([]byte, 0)
+	packets := make([]int, 0)
+	expected := uint16(1)
+	blksize := -1
+	for i := range h.marks {
+		dg := h.datagram(i)
+		if len(dg) < 4 || binary.BigEndian.Uint16(dg) != tftpDATA {
+			continue
+		}
+		block := binary.BigEndian.Uint16(dg[2:])
+		if block != expected {
+			continue
+		}
+		payload := dg[4:]
+		data = append(data, payload...)
+		packets = append(packets, h.marks[i].number)
+		expected++
+		if blksize == -1 {
+			blksize = len(payload)
+		}
+		if len(payload) < blksize {
+			break
+		}
+	}
+	if len(packets) == 0 {
+		return nil
+	}
+	res := c.object("TFTP", dirn, 0, 0)
+	res.Packets = packets
+	res.Data = data
+	return res
+}
+
+//======================================================================
+// Local Variables:
+// mode: Go
+// fill-column: 78
+// End:
@@ -19,6 +19,7 @@ const (
 	ConvCode
 	StreamCode
 	CapinfoCode
+	StatsCode
 )
 
 type IClear interface {
@@ -190,6 +190,13 @@ func (p PsmlColumnInfo) WithLongName(name string) PsmlColumnInfo {
 // to stdout and the user will see it.
 func InitValidColumns() error {
 	validColumns = &ColumnsFromTshark{}
+	if termshark.TSharkMissing {
+		// Without tshark to ask, the built-in formats are all that's allowed
+		for token, info := range BuiltInColumnFormats {
+			AllowedColumnFormats[token] = info
+		}
+		return nil
+	}
 	err := validColumns.InitFromCache()
 	if err != nil {
 		fmt.Printf("Termshark is initializing - please wait...\n")
@@ -0,0 +1,397 @@
+// Copyright 2019-2022 Graham Clark. All rights reserved.  Use of this source
+// code is governed by the MIT license that can be found in the LICENSE
+// file.
+
+package ui
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gcla/gowid"
+	"github.com/gcla/gowid/widgets/dialog"
+	"github.com/gcla/gowid/widgets/divider"
+	"github.com/gcla/gowid/widgets/edit"
+	"github.com/gcla/gowid/widgets/framed"
+	"github.com/gcla/gowid/widgets/pile"
+	"github.com/gcla/gowid/widgets/table"
+	"github.com/gcla/gowid/widgets/text"
+	"github.com/gcla/termshark/v2"
+	"github.com/gcla/termshark/v2/pkg/annotations"
+	"github.com/gcla/termshark/v2/pkg/pcap"
+	"github.com/gcla/termshark/v2/ui/menuutil"
+	"github.com/gcla/termshark/v2/widgets/minibuffer"
+	log "github.com/sirupsen/logrus"
+)
+
+// CurrentAnnotations holds the comments and bookmarks of the loaded pcap. It's
+// nil until they have been read, which happens once the packet list is loaded.
+var CurrentAnnotations *annotations.Annotations
+
+var annotationsNotLoadedErr = fmt.Errorf("Annotations are not loaded yet.")
+
+//======================================================================
+
+type ManageAnnotations struct{}
+
+var _ pcap.INewSource = ManageAnnotations{}
+var _ pcap.IClear = ManageAnnotations{}
+var _ pcap.IAfterEnd = ManageAnnotations{}
+
+func (t ManageAnnotations) OnNewSource(pcap.HandlerCode, gowid.IApp) {
+	CurrentAnnotations = nil
+}
+
+func (t ManageAnnotations) OnClear(pcap.HandlerCode, gowid.IApp) {
+	CurrentAnnotations = nil
+}
+
+// AfterEnd reads the annotations for the pcap once the PSML is loaded. A
+// pcapng's own comments may have to be read from the whole file, so this
+// is done in the background.
+func (t ManageAnnotations) AfterEnd(code pcap.HandlerCode, app gowid.IApp) {
+	if code&pcap.PsmlCode == 0 {
+		return
+	}
+	pcapf := Loader.PcapPdml
+	if pcapf == "" || (CurrentAnnotations != nil && CurrentAnnotations.Pcap() == pcapf) {
+		return
+	}
+	ctx := Loader.Context()
+	termshark.TrackedGo(func() {
+		ann, err := annotations.Load(ctx, pcapf)
+		if err != nil {
+			log.Warnf("Could not load annotations for %s: %v", pcapf, err)
+			ann = annotations.New(pcapf)
+		}
+		app.Run(gowid.RunFunction(func(app gowid.IApp) {
+			if Loader.PcapPdml == pcapf {
+				CurrentAnnotations = ann
+			}
+		}))
+	}, Goroutinewg)
+}
+
+//======================================================================
+
+// currentPacket returns the number of the packet selected in the packet list
+func currentPacket() (int, error) {
+	if packetListView == nil {
+		return -1, fmt.Errorf("No packet in focus.")
+	}
+	jpos, err := packetNumberFromCurrentTableRow()
+	if err != nil {
+		return -1, err
+	}
+	return jpos.Pos, nil
+}
+
+// jumpToPacket selects packet in the packet list, remembering the current
+// packet so the jump can be undone
+func jumpToPacket(packet int, app gowid.IApp) error {
+	if packetListView == nil {
+		return fmt.Errorf("No packets are loaded.")
+	}
+	tableRow, err := tableRowFromPacketNumber(packet)
+	if err != nil {
+		return err
+	}
+	tableCol := 0
+	curTablePos, err := packetListView.FocusXY()
+	if err == nil {
+		tableCol = curTablePos.Column
+	}
+	pn, _ := packetNumberFromCurrentTableRow() // save for ''
+	lastJumpPos = pn.Pos
+	packetListView.SetFocusXY(app, table.Coords{Column: tableCol, Row: tableRow})
+	return nil
+}
+
+// annotate applies fn to the current annotations and selected packet, then
+// saves them
+func annotate(app gowid.IApp, fn func(ann *annotations.Annotations, packet int) string) error {
+	if CurrentAnnotations == nil {
+		return annotationsNotLoadedErr
+	}
+	packet, err := currentPacket()
+	if err != nil {
+		return err
+	}
+	msg := fn(CurrentAnnotations, packet)
+	if err := CurrentAnnotations.Save(); err != nil {
+		return err
+	}
+	OpenMessage(msg, appView, app)
+	return nil
+}
+
+//======================================================================
+
+type commentCommand struct {
+	remove bool
+}
+
+var _ minibuffer.IAction = commentCommand{}
+
+// Run sets the comment on the selected packet to the rest of the command
+// line; with nothing after the command, it shows the comment. uncomment
+// removes it.
+func (d commentCommand) Run(app gowid.IApp, args ...string) error {
+	var err error
+	switch {
+	case d.remove:
+		err = annotate(app, func(ann *annotations.Annotations, packet int) string {
+			ann.SetComment(packet, "")
+			return fmt.Sprintf("Comment removed from packet %d.", packet)
+		})
+	case len(args) == 1:
+		if CurrentAnnotations == nil {
+			err = annotationsNotLoadedErr
+		} else {
+			var packet int
+			if packet, err = currentPacket(); err == nil {
+				if comment, ok := CurrentAnnotations.Comment(packet); ok {
+					OpenMessage(fmt.Sprintf("Packet %d: %s", packet, comment), appView, app)
+				} else {
+					OpenMessage(fmt.Sprintf("Packet %d has no comment.", packet), appView, app)
+				}
+			}
+		}
+	default:
+		err = annotate(app, func(ann *annotations.Annotations, packet int) string {
+			ann.SetComment(packet, strings.Join(args[1:], " "))
+			return fmt.Sprintf("Comment set on packet %d.", packet)
+		})
+	}
+
+	if err != nil {
+		OpenError(err.Error(), app)
+	}
+	return err
+}
+
+func (d commentCommand) OfferCompletion() bool {
+	return true
+}
+
+func (d commentCommand) Arguments([]string, gowid.IApp) []minibuffer.IArg {
+	return nil
+}
+
+//======================================================================
+
+type bookmarkCommand struct {
+	remove bool
+}
+
+var _ minibuffer.IAction = bookmarkCommand{}
+
+func (d bookmarkCommand) Run(app gowid.IApp, args ...string) error {
+	var err error
+	switch {
+	case len(args) != 2:
+		err = fmt.Errorf("Please supply one bookmark name.")
+	case d.remove:
+		if CurrentAnnotations == nil {
+			err = annotationsNotLoadedErr
+		} else if !CurrentAnnotations.RemoveBookmark(args[1]) {
+			err = fmt.Errorf("Bookmark %s not found.", args[1])
+		} else if err = CurrentAnnotations.Save(); err == nil {
+			OpenMessage(fmt.Sprintf("Bookmark %s removed.", args[1]), appView, app)
+		}
+	default:
+		err = annotate(app, func(ann *annotations.Annotations, packet int) string {
+			ann.SetBookmark(args[1], packet)
+			return fmt.Sprintf("Bookmark %s set to packet %d.", args[1], packet)
+		})
+	}
+
+	if err != nil {
+		OpenError(err.Error(), app)
+	}
+	return err
+}
+
+func (d bookmarkCommand) OfferCompletion() bool {
+	return true
+}
+
+func (d bookmarkCommand) Arguments(toks []string, app gowid.IApp) []minibuffer.IArg {
+	res := make([]minibuffer.IArg, 0)
+	pref := ""
+	if len(toks) > 0 {
+		pref = toks[0]
+	}
+	names := make([]string, 0)
+	if CurrentAnnotations != nil {
+		for _, b := range CurrentAnnotations.Bookmarks {
+			names = append(names, b.Name)
+		}
+	}
+	res = append(res, newCachedArg(pref, names))
+	return res
+}
+
+//======================================================================
+
+// openAnnotations lists the bookmarks and comments of the loaded pcap, or just
+// those packets given. Choosing one selects its packet.
+func openAnnotations(packets []int, app gowid.IApp) {
+	if CurrentAnnotations == nil {
+		OpenError(annotationsNotLoadedErr.Error(), app)
+		return
+	}
+	if packets == nil {
+		packets = CurrentAnnotations.Packets()
+	}
+	if len(packets) == 0 {
+		OpenMessage("No bookmarks or comments found.", appView, app)
+		return
+	}
+
+	var annDialog *dialog.Widget
+
+	items := make([]menuutil.SimpleMenuItem, 0, len(packets))
+	for _, packet := range packets {
+		packetCopy := packet
+		desc := make([]string, 0)
+		for _, name := range CurrentAnnotations.BookmarksFor(packet) {
+			desc = append(desc, fmt.Sprintf("[%s]", name))
+		}
+		if comment, ok := CurrentAnnotations.Comment(packet); ok {
+			desc = append(desc, strings.Replace(comment, "\n", " / ", -1))
+		}
+		items = append(items, menuutil.SimpleMenuItem{
+			Txt: fmt.Sprintf("%6d  %s", packet, strings.Join(desc, " ")),
+			CB: func(app gowid.IApp, w gowid.IWidget) {
+				annDialog.Close(app)
+				if err := jumpToPacket(packetCopy, app); err != nil {
+					OpenError(err.Error(), app)
+				}
+			},
+		})
+	}
+	annList, _ := menuutil.MakeMenu(items, nil)
+
+	saveBtn := dialog.Button{
+		Msg: "Save as pcapng",
+		Action: gowid.MakeWidgetCallback("exec", gowid.WidgetChangedFunction(func(app gowid.IApp, _ gowid.IWidget) {
+			annDialog.Close(app)
+			openSavePcapng(app)
+		})),
+	}
+
+	annDialog = dialog.New(
+		framed.NewSpace(annList),
+		dialog.Options{
+			Buttons:         []dialog.Button{saveBtn, dialog.Cancel},
+			NoShadow:        true,
+			BackgroundStyle: gowid.MakePaletteRef("dialog"),
+			BorderStyle:     gowid.MakePaletteRef("dialog"),
+			ButtonStyle:     gowid.MakePaletteRef("dialog-button"),
+			Modal:           true,
+			FocusOnWidget:   true,
+		},
+	)
+
+	annDialog.Open(appView, ratio(0.7), app)
+}
+
+//======================================================================
+
+func openSavePcapng(app gowid.IApp) {
+	if CurrentAnnotations == nil {
+		OpenError(annotationsNotLoadedErr.Error(), app)
+		return
+	}
+
+	var saveDialog *dialog.Widget
+
+	pcapf := CurrentAnnotations.Pcap()
+	fileWidget := edit.New(edit.Options{
+		Text: strings.TrimSuffix(pcapf, filepath.Ext(pcapf)) + "-annotated.pcapng",
+	})
+
+	okBtn := dialog.Button{
+		Msg: "Ok",
+		Action: gowid.MakeWidgetCallback("exec", gowid.WidgetChangedFunction(func(app gowid.IApp, _ gowid.IWidget) {
+			saveDialog.Close(app)
+			savePcapng(fileWidget.Text(), app)
+		})),
+	}
+
+	saveDialog = dialog.New(
+		framed.NewSpace(
+			pile.NewFlow(
+				text.New("Save the pcap with its comments and bookmarks to:"),
+				divider.NewBlank(),
+				framed.NewUnicode(fileWidget),
+			),
+		),
+		dialog.Options{
+			Buttons:         []dialog.Button{okBtn, dialog.Cancel},
+			NoShadow:        true,
+			BackgroundStyle: gowid.MakePaletteRef("dialog"),
+			BorderStyle:     gowid.MakePaletteRef("dialog"),
+			ButtonStyle:     gowid.MakePaletteRef("dialog-button"),
+			Modal:           true,
+			FocusOnWidget:   true,
+		},
+	)
+
+	saveDialog.Open(appView, ratio(0.7), app)
+}
+
+// savePcapng writes the annotated pcap in the background
+func savePcapng(path string, app gowid.IApp) {
+	if CurrentAnnotations == nil {
+		OpenError(annotationsNotLoadedErr.Error(), app)
+		return
+	}
+	if path == CurrentAnnotations.Pcap() {
+		OpenError("Please choose a different file from the one loaded.", app)
+		return
+	}
+
+	ann := CurrentAnnotations
+	OpenPleaseWait(appView, app)
+	tick := time.NewTicker(time.Duration(200) * time.Millisecond)
+	stop := make(chan struct{})
+
+	termshark.TrackedGo(func() {
+	Loop:
+		for {
+			select {
+			case <-tick.C:
+				app.Run(gowid.RunFunction(func(app gowid.IApp) {
+					pleaseWaitSpinner.Update()
+				}))
+			case <-stop:
+				break Loop
+			}
+		}
+	}, Goroutinewg)
+
+	termshark.TrackedGo(func() {
+		err := ann.WritePcapng(context.Background(), path)
+		close(stop)
+		tick.Stop()
+		app.Run(gowid.RunFunction(func(app gowid.IApp) {
+			ClosePleaseWait(app)
+			if err != nil {
+				OpenError(err.Error(), app)
+			} else {
+				OpenMessage(fmt.Sprintf("Saved annotated pcap to %s.", path), appView, app)
+			}
+		}))
+	}, Goroutinewg)
+}
+
+//======================================================================
+// Local Variables:
+// mode: Go
+// fill-column: 110
+// End:
@@ -19,6 +19,10 @@ import (
 
 var CapinfoLoader *capinfo.Loader
 
+// CapinfoCmds produces the pcap properties. It runs capinfos unless termshark
+// is using the native loader.
+var CapinfoCmds capinfo.ILoaderCmds = capinfo.MakeCommands()
+
 var CapinfoData string
 var CapinfoTime time.Time
 
@@ -32,7 +36,7 @@ func startCapinfo(app gowid.IApp) {
 
 	fi, err := os.Stat(Loader.PcapPdml)
 	if err != nil || CapinfoTime.Before(fi.ModTime()) {
-		CapinfoLoader = capinfo.NewLoader(capinfo.MakeCommands(), Loader.Context())
+		CapinfoLoader = capinfo.NewLoader(CapinfoCmds, Loader.Context())
 
 		handler := capinfoParseHandler{}
 
@@ -0,0 +1,397 @@
+// Copyright 2019-2022 Graham Clark. All rights reserved.  Use of this source
+// code is governed by the MIT license that can be found in the LICENSE
+// file.
+
+package ui
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gcla/gowid"
+	"github.com/gcla/gowid/widgets/dialog"
+	"github.com/gcla/gowid/widgets/divider"
+	"github.com/gcla/gowid/widgets/edit"
+	"github.com/gcla/gowid/widgets/framed"
+	"github.com/gcla/gowid/widgets/pile"
+	"github.com/gcla/gowid/widgets/text"
+	"github.com/gcla/termshark/v2"
+	"github.com/gcla/termshark/v2/pkg/iostats"
+	"github.com/gcla/termshark/v2/pkg/pcap"
+	log "github.com/sirupsen/logrus"
+)
+
+var StatsLoader *iostats.Loader
+
+// StatsCmds produces the PSML the I/O graph and protocol hierarchy are
+// computed from. It runs tshark unless termshark is using the native loader.
+var StatsCmds iostats.ILoaderCmds = iostats.MakeCommands()
+
+// The I/O graph's size in characters. Longer captures are drawn with several
+// intervals to a column.
+var ioGraphWidth = 72
+var ioGraphHeight = 6
+
+// The number of display filters offered when setting up an I/O graph
+var ioGraphFilters = 3
+
+//======================================================================
+
+// startStats computes an I/O graph of the current pcap with a series per
+// filter, and the protocol hierarchy of the first, then calls open.
+func startStats(filters []string, interval time.Duration, open func(*iostats.Graph, *iostats.Hierarchy, gowid.IApp), app gowid.IApp) {
+	if Loader.PcapPdml == "" {
+		OpenError("No pcap loaded.", app)
+		return
+	}
+
+	StatsLoader = iostats.NewLoader(StatsCmds, Loader.Context())
+
+	handler := statsParseHandler{
+		open: open,
+	}
+
+	StatsLoader.StartLoad(
+		Loader.PcapPdml,
+		filters,
+		interval,
+		app,
+		&handler,
+	)
+}
+
+func startIOGraph(filters []string, interval time.Duration, app gowid.IApp) {
+	startStats(filters, interval, func(graph *iostats.Graph, _ *iostats.Hierarchy, app gowid.IApp) {
+		openIOGraph(graph, false, app)
+	}, app)
+}
+
+func startProtocolHierarchy(app gowid.IApp) {
+	filter := Loader.DisplayFilter()
+	startStats([]string{filter}, time.Second, func(_ *iostats.Graph, hierarchy *iostats.Hierarchy, app gowid.IApp) {
+		var out bytes.Buffer
+		if filter != "" {
+			fmt.Fprintf(&out, "Display filter: %s\n\n", filter)
+		}
+		if err := hierarchy.WriteTable(&out); err != nil {
+			log.Warnf("Could not format protocol hierarchy: %v", err)
+		}
+		OpenMessageForCopy(strings.TrimRight(out.String(), "\n"), appView, app)
+	}, app)
+}
+
+//======================================================================
+
+type statsParseHandler struct {
+	tick             *time.Ticker // for updating the spinner
+	stop             chan struct{}
+	pleaseWaitClosed bool
+	graph            *iostats.Graph
+	hierarchy        *iostats.Hierarchy
+	open             func(*iostats.Graph, *iostats.Hierarchy, gowid.IApp)
+}
+
+var _ iostats.IStatsCallbacks = (*statsParseHandler)(nil)
+var _ pcap.IBeforeBegin = (*statsParseHandler)(nil)
+var _ pcap.IAfterEnd = (*statsParseHandler)(nil)
+var _ pcap.IOnError = (*statsParseHandler)(nil)
+
+func (t *statsParseHandler) OnStatsData(graph *iostats.Graph, hierarchy *iostats.Hierarchy) {
+	t.graph = graph
+	t.hierarchy = hierarchy
+}
+
+func (t *statsParseHandler) AfterStatsEnd(success bool) {
+}
+
+func (t *statsParseHandler) BeforeBegin(code pcap.HandlerCode, app gowid.IApp) {
+	if code&pcap.StatsCode == 0 {
+		return
+	}
+	OpenPleaseWait(appView, app)
+
+	t.tick = time.NewTicker(time.Duration(200) * time.Millisecond)
+	t.stop = make(chan struct{})
+
+	termshark.TrackedGo(func() {
+	Loop:
+		for {
+			select {
+			case <-t.tick.C:
+				app.Run(gowid.RunFunction(func(app gowid.IApp) {
+					pleaseWaitSpinner.Update()
+				}))
+			case <-t.stop:
+				break Loop
+			}
+		}
+	}, Goroutinewg)
+}
+
+func (t *statsParseHandler) AfterEnd(code pcap.HandlerCode, app gowid.IApp) {
+	if code&pcap.StatsCode == 0 {
+		return
+	}
+	if !t.pleaseWaitClosed {
+		t.pleaseWaitClosed = true
+		ClosePleaseWait(app)
+	}
+	t.tick.Stop()
+	close(t.stop)
+
+	if t.graph != nil {
+		t.open(t.graph, t.hierarchy, app)
+	}
+}
+
+// OnError reports errors whatever main.suppress-tshark-errors says, since the
+// likeliest is a mistyped display filter.
+func (t *statsParseHandler) OnError(code pcap.HandlerCode, app gowid.IApp, err error) {
+	if code&pcap.StatsCode == 0 {
+		return
+	}
+	log.Error(err)
+	var errstr string
+	if kverr, ok := err.(gowid.KeyValueError); ok {
+		errstr = termshark.KeyValueErrorString(kverr)
+	} else {
+		errstr = fmt.Sprintf("%v", err)
+	}
+
+	app.Run(gowid.RunFunction(func(app gowid.IApp) {
+		OpenLongError(errstr, app)
+	}))
+}
+
+//======================================================================
+
+// formatIOGraph draws each series of graph as a bar chart of packets, or
+// bytes if showBytes, per interval.
+func formatIOGraph(graph *iostats.Graph, showBytes bool) string {
+	unit, title := "packets", "Packets"
+	if showBytes {
+		unit, title = "bytes", "Bytes"
+	}
+	intervals := graph.Intervals()
+	perColumn := (intervals + ioGraphWidth - 1) / ioGraphWidth
+	if perColumn < 1 {
+		perColumn = 1
+	}
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "%s per %v", title, graph.Interval)
+	if perColumn > 1 {
+		fmt.Fprintf(&out, ", %d intervals to a column", perColumn)
+	}
+	out.WriteString("\n")
+
+	for i, ser := range graph.Series {
+		values := iostats.Rebin(graph.Values(i, showBytes), perColumn)
+		max, total := 0, 0
+		for _, v := range values {
+			total += v
+			if v > max {
+				max = v
+			}
+		}
+		fmt.Fprintf(&out, "\n%s - %d %s, at most %d per column\n", ser.Name(), total, unit, max)
+		for _, row := range iostats.BarChart(values, ioGraphHeight) {
+			fmt.Fprintf(&out, "│%s\n", row)
+		}
+		end := fmt.Sprintf("%v", time.Duration(intervals)*graph.Interval)
+		gap := len(values) + 1 - len("0s") - len(end)
+		if gap < 1 {
+			gap = 1
+		}
+		fmt.Fprintf(&out, "0s%s%s\n", strings.Repeat(" ", gap), end)
+	}
+	return strings.TrimRight(out.String(), "\n")
+}
+
+func openIOGraph(graph *iostats.Graph, showBytes bool, app gowid.IApp) {
+	if graph.Intervals() == 0 {
+		OpenMessage("No packets to graph.", appView, app)
+		return
+	}
+
+	var graphDialog *dialog.Widget
+
+	toggle := "Show bytes"
+	if showBytes {
+		toggle = "Show packets"
+	}
+	toggleBtn := dialog.Button{
+		Msg: toggle,
+		Action: gowid.MakeWidgetCallback("exec", gowid.WidgetChangedFunction(func(app gowid.IApp, _ gowid.IWidget) {
+			graphDialog.Close(app)
+			openIOGraph(graph, !showBytes, app)
+		})),
+	}
+	csvBtn := dialog.Button{
+		Msg: "Export CSV",
+		Action: gowid.MakeWidgetCallback("exec", gowid.WidgetChangedFunction(func(app gowid.IApp, _ gowid.IWidget) {
+			graphDialog.Close(app)
+			openExportIOGraph(graph, app)
+		})),
+	}
+
+	graphDialog = dialog.New(
+		framed.NewSpace(
+			text.New(formatIOGraph(graph, showBytes)),
+		),
+		dialog.Options{
+			Buttons:         []dialog.Button{toggleBtn, csvBtn, dialog.CloseD},
+			NoShadow:        true,
+			BackgroundStyle: gowid.MakePaletteRef("dialog"),
+			BorderStyle:     gowid.MakePaletteRef("dialog"),
+			ButtonStyle:     gowid.MakePaletteRef("dialog-button"),
+			Modal:           true,
+			FocusOnWidget:   false,
+		},
+	)
+
+	graphDialog.Open(appView, units(ioGraphWidth+8), app)
+}
+
+func openExportIOGraph(graph *iostats.Graph, app gowid.IApp) {
+	var exportDialog *dialog.Widget
+
+	pcapf := Loader.Pcap()
+	file := strings.TrimSuffix(filepath.Base(pcapf), filepath.Ext(pcapf)) + "-iograph.csv"
+	if cwd, err := os.Getwd(); err == nil {
+		file = filepath.Join(cwd, file)
+	}
+	fileWidget := edit.New(edit.Options{
+		Text: file,
+	})
+
+	okBtn := dialog.Button{
+		Msg: "Ok",
+		Action: gowid.MakeWidgetCallback("exec", gowid.WidgetChangedFunction(func(app gowid.IApp, _ gowid.IWidget) {
+			exportDialog.Close(app)
+			file := fileWidget.Text()
+			if err := writeIOGraphCSV(graph, file); err != nil {
+				OpenError(fmt.Sprintf("Could not write %s: %v", file, err), app)
+				return
+			}
+			OpenMessage(fmt.Sprintf("Saved I/O graph to %s.", file), appView, app)
+		})),
+	}
+
+	exportDialog = dialog.New(
+		framed.NewSpace(
+			pile.NewFlow(
+				text.New("Save the I/O graph as CSV to:"),
+				divider.NewBlank(),
+				framed.NewUnicode(fileWidget),
+			),
+		),
+		dialog.Options{
+			Buttons:         []dialog.Button{okBtn, dialog.Cancel},
+			NoShadow:        true,
+			BackgroundStyle: gowid.MakePaletteRef("dialog"),
+			BorderStyle:     gowid.MakePaletteRef("dialog"),
+			ButtonStyle:     gowid.MakePaletteRef("dialog-button"),
+			Modal:           true,
+			FocusOnWidget:   true,
+		},
+	)
+
+	exportDialog.Open(appView, ratio(0.7), app)
+}
+
+func writeIOGraphCSV(graph *iostats.Graph, file string) error {
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	err = graph.WriteCSV(f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+//======================================================================
+
+// openIOGraphSetup asks for the interval and display filters of an I/O graph,
+// starting with the current display filter.
+func openIOGraphSetup(app gowid.IApp) {
+	var setupDialog *dialog.Widget
+
+	intervalWidget := edit.New(edit.Options{
+		Text: "1s",
+	})
+	filterWidgets := make([]*edit.Widget, 0, ioGraphFilters)
+	widgets := []interface{}{
+		text.New("Interval e.g. 100ms, 1s, 1m:"),
+		framed.NewUnicode(intervalWidget),
+		divider.NewBlank(),
+		text.New("Display filters, one series each - leave all empty for every packet:"),
+	}
+	for i := 0; i < ioGraphFilters; i++ {
+		w := edit.New()
+		if i == 0 {
+			w.SetText(Loader.DisplayFilter(), app)
+		}
+		filterWidgets = append(filterWidgets, w)
+		widgets = append(widgets, framed.NewUnicode(w))
+	}
+
+	okBtn := dialog.Button{
+		Msg: "Ok",
+		Action: gowid.MakeWidgetCallback("exec", gowid.WidgetChangedFunction(func(app gowid.IApp, _ gowid.IWidget) {
+			interval, err := parseInterval(intervalWidget.Text())
+			if err != nil {
+				OpenError(err.Error(), app)
+				return
+			}
+			filters := make([]string, 0, len(filterWidgets))
+			for _, w := range filterWidgets {
+				if f := strings.TrimSpace(w.Text()); f != "" {
+					filters = append(filters, f)
+				}
+			}
+			if len(filters) == 0 {
+				filters = append(filters, "")
+			}
+			setupDialog.Close(app)
+			startIOGraph(filters, interval, app)
+		})),
+	}
+
+	setupDialog = dialog.New(
+		framed.NewSpace(
+			pile.NewFlow(widgets...),
+		),
+		dialog.Options{
+			Buttons:         []dialog.Button{okBtn, dialog.Cancel},
+			NoShadow:        true,
+			BackgroundStyle: gowid.MakePaletteRef("dialog"),
+			BorderStyle:     gowid.MakePaletteRef("dialog"),
+			ButtonStyle:     gowid.MakePaletteRef("dialog-button"),
+			Modal:           true,
+			FocusOnWidget:   true,
+		},
+	)
+
+	setupDialog.Open(appView, ratio(0.7), app)
+}
+
+func parseInterval(s string) (time.Duration, error) {
+	res, err := time.ParseDuration(strings.TrimSpace(s))
+	if err != nil || res <= 0 {
+		return 0, fmt.Errorf("Invalid interval '%s' - try e.g. 1s or 100ms.", s)
+	}
+	return res, nil
+}
+
+//======================================================================
+// Local Variables:
+// mode: Go
+// fill-column: 110
+// End:
@@ -0,0 +1,145 @@
+// Copyright 2019-2022 Graham Clark. All rights reserved.  Use of this source
+// code is governed by the MIT license that can be found in the LICENSE
+// file.
+
+package ui
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gcla/gowid"
+	"github.com/gcla/gowid/widgets/dialog"
+	"github.com/gcla/gowid/widgets/divider"
+	"github.com/gcla/gowid/widgets/edit"
+	"github.com/gcla/gowid/widgets/framed"
+	"github.com/gcla/gowid/widgets/pile"
+	"github.com/gcla/gowid/widgets/text"
+	"github.com/gcla/termshark/v2"
+	"github.com/gcla/termshark/v2/pkg/objects"
+	log "github.com/sirupsen/logrus"
+)
+
+// The most objects listed in the export dialog; all are saved
+var maxObjectsShown = 20
+
+//======================================================================
+
+// startExportObjects reads the current pcap for transferred files, then
+// offers to save them all.
+func startExportObjects(app gowid.IApp) {
+	if Loader.PcapPdml == "" {
+		OpenError("No pcap loaded.", app)
+		return
+	}
+
+	pcapf := Loader.PcapPdml
+	ctx := Loader.Context()
+
+	OpenPleaseWait(appView, app)
+	tick := time.NewTicker(time.Duration(200) * time.Millisecond)
+	stop := make(chan struct{})
+
+	termshark.TrackedGo(func() {
+	Loop:
+		for {
+			select {
+			case <-tick.C:
+				app.Run(gowid.RunFunction(func(app gowid.IApp) {
+					pleaseWaitSpinner.Update()
+				}))
+			case <-stop:
+				break Loop
+			}
+		}
+	}, Goroutinewg)
+
+	termshark.TrackedGo(func() {
+		objs, err := objects.Extract(ctx, pcapf)
+		close(stop)
+		tick.Stop()
+		app.Run(gowid.RunFunction(func(app gowid.IApp) {
+			ClosePleaseWait(app)
+			switch {
+			case err != nil:
+				OpenError(fmt.Sprintf("Could not export objects from %s: %v", pcapf, err), app)
+			case len(objs) == 0:
+				OpenMessage("No objects found.", appView, app)
+			default:
+				openExportObjects(pcapf, objs, app)
+			}
+		}))
+	}, Goroutinewg)
+}
+
+func openExportObjects(pcapf string, objs []*objects.Object, app gowid.IApp) {
+	var exportDialog *dialog.Widget
+
+	shown := objs
+	if len(shown) > maxObjectsShown {
+		shown = shown[:maxObjectsShown]
+	}
+	var table bytes.Buffer
+	if err := objects.WriteTable(&table, shown); err != nil {
+		log.Warnf("Could not format objects: %v", err)
+	}
+	summary := strings.TrimRight(table.String(), "\n")
+	if len(objs) > len(shown) {
+		summary += fmt.Sprintf("\n... and %d more", len(objs)-len(shown))
+	}
+
+	dir := strings.TrimSuffix(filepath.Base(pcapf), filepath.Ext(pcapf)) + "-objects"
+	if cwd, err := os.Getwd(); err == nil {
+		dir = filepath.Join(cwd, dir)
+	}
+	dirWidget := edit.New(edit.Options{
+		Text: dir,
+	})
+
+	saveBtn := dialog.Button{
+		Msg: "Save all",
+		Action: gowid.MakeWidgetCallback("exec", gowid.WidgetChangedFunction(func(app gowid.IApp, _ gowid.IWidget) {
+			exportDialog.Close(app)
+			dir := dirWidget.Text()
+			paths, err := objects.Save(dir, objs)
+			if err != nil {
+				OpenError(fmt.Sprintf("Could not save objects to %s: %v", dir, err), app)
+				return
+			}
+			OpenMessage(fmt.Sprintf("Saved %d objects to %s.", len(paths), dir), appView, app)
+		})),
+	}
+
+	exportDialog = dialog.New(
+		framed.NewSpace(
+			pile.NewFlow(
+				text.New(summary),
+				divider.NewBlank(),
+				text.New("Save all objects to:"),
+				divider.NewBlank(),
+				framed.NewUnicode(dirWidget),
+			),
+		),
+		dialog.Options{
+			Buttons:         []dialog.Button{saveBtn, dialog.Cancel},
+			NoShadow:        true,
+			BackgroundStyle: gowid.MakePaletteRef("dialog"),
+			BorderStyle:     gowid.MakePaletteRef("dialog"),
+			ButtonStyle:     gowid.MakePaletteRef("dialog-button"),
+			Modal:           true,
+			FocusOnWidget:   true,
+		},
+	)
+
+	exportDialog.Open(appView, ratio(0.9), app)
+}
+
+//======================================================================
+// Local Variables:
+// mode: Go
+// fill-column: 110
+// End:
@@ -374,6 +374,10 @@ func (s *FilterSearchCallbacks) SearchPacketsResult(res search.Result, app gowid
 // makePsmlCommand generates the tshark command to run to generate the sequence of results from search,
 // according to the filter value.
 func makePsmlCommand(filename string, displayFilter string) pcap.IPcapCommand {
+	if termshark.NativeLoader {
+		// The native PSML also starts with the frame number
+		return pcap.PcapCmds.Psml(filename, displayFilter)
+	}
 	args := []string{
 		"-T", "psml",
 		"-o", fmt.Sprintf("gui.column.format:\"No.\",\"%%m\""),
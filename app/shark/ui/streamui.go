@@ -41,6 +41,10 @@ var streamWidgets *lru.Cache // map[streamKey]*streamwidget.Widget
 
 var StreamLoader *streams.Loader // DOC - one because it holds stream index state for pcap
 
+// StreamCmds reassembles streams. It runs tshark unless termshark is using the
+// native loader.
+var StreamCmds streams.ILoaderCmds = streams.MakeCommands()
+
 //======================================================================
 
 // The index for the stream widget cache e.g. UDP stream 6
@@ -141,7 +145,7 @@ func startStreamReassembly(app gowid.IApp) {
 
 		// Use the source context. At app shutdown, canceling main will cancel src which will cancel the stream
 		// loader. And changing source should also cancel the stream loader on all occasions.
-		StreamLoader = streams.NewLoader(streams.MakeCommands(), Loader.Context())
+		StreamLoader = streams.NewLoader(StreamCmds, Loader.Context())
 
 		sh := &streamParseHandler{
 			app:   app,
@@ -1451,6 +1451,29 @@ func lastLineMode(app gowid.IApp) {
 		return nil
 	}))
 
+	MiniBuffer.Register("iograph", minibufferFn(func(app gowid.IApp, args ...string) error {
+		if len(args) == 1 {
+			openIOGraphSetup(app)
+			return nil
+		}
+		interval, err := parseInterval(args[1])
+		if err != nil {
+			OpenError(err.Error(), app)
+			return err
+		}
+		filters := args[2:]
+		if len(filters) == 0 {
+			filters = []string{Loader.DisplayFilter()}
+		}
+		startIOGraph(filters, interval, app)
+		return nil
+	}))
+
+	MiniBuffer.Register("phs", minibufferFn(func(gowid.IApp, ...string) error {
+		startProtocolHierarchy(app)
+		return nil
+	}))
+
 	MiniBuffer.Register("columns", minibufferFn(func(gowid.IApp, ...string) error {
 		openEditColumns(app)
 		return nil
@@ -1482,6 +1505,36 @@ func lastLineMode(app gowid.IApp) {
 		return nil
 	}))
 
+	MiniBuffer.Register("bookmarks", minibufferFn(func(gowid.IApp, ...string) error {
+		openAnnotations(nil, app)
+		return nil
+	}))
+
+	MiniBuffer.Register("find-comment", minibufferFn(func(app gowid.IApp, args ...string) error {
+		var err error
+		if len(args) < 2 {
+			err = fmt.Errorf("Please supply text to search for.")
+		} else if CurrentAnnotations == nil {
+			err = annotationsNotLoadedErr
+		}
+		if err != nil {
+			OpenError(err.Error(), app)
+			return err
+		}
+		openAnnotations(CurrentAnnotations.Search(strings.Join(args[1:], " ")), app)
+		return nil
+	}))
+
+	MiniBuffer.Register("save-pcapng", minibufferFn(func(app gowid.IApp, args ...string) error {
+		if len(args) != 2 {
+			err := fmt.Errorf("Please supply one file name.")
+			OpenError(err.Error(), app)
+			return err
+		}
+		savePcapng(args[1], app)
+		return nil
+	}))
+
 	if runtime.GOOS != "windows" {
 		MiniBuffer.Register("logs", minibufferFn(func(gowid.IApp, ...string) error {
 			openLogsUi(app)
@@ -1506,6 +1559,10 @@ func lastLineMode(app gowid.IApp) {
 	MiniBuffer.Register("map", mapCommand{w: keyMapper})
 	MiniBuffer.Register("unmap", unmapCommand{w: keyMapper})
 	MiniBuffer.Register("help", helpCommand{})
+	MiniBuffer.Register("comment", commentCommand{})
+	MiniBuffer.Register("uncomment", commentCommand{remove: true})
+	MiniBuffer.Register("bookmark", bookmarkCommand{})
+	MiniBuffer.Register("unbookmark", bookmarkCommand{remove: true})
 
 	minibuffer.Open(MiniBuffer, mbView, ratio(1.0), app)
 }
@@ -1557,6 +1614,7 @@ func reallyClear(app gowid.IApp) {
 					SetStructWidgets{Loader}, // for OnClear
 					ClearMarksHandler{},
 					ManageSearchData{},
+					ManageAnnotations{},
 					CancelledMessage{},
 				},
 			)
@@ -2972,6 +3030,7 @@ func RequestLoadInterfaces(psrcs []pcap.IPacketSource, captureFilter string, dis
 			ClearWormholeState{},
 			ClearMarksHandler{},
 			ManageSearchData{},
+			ManageAnnotations{},
 			CancelledMessage{},
 		},
 		app,
@@ -3006,6 +3065,7 @@ func RequestLoadPcap(pcapf string, displayFilter string, jump termshark.GlobalJu
 		ClearWormholeState{},
 		ClearMarksHandler{},
 		ManageSearchData{},
+		ManageAnnotations{},
 		CancelledMessage{},
 	}
 
@@ -3645,6 +3705,38 @@ func Build(tty string) (*gowid.App, error) {
 				openConvsUi(app)
 			},
 		},
+		menuutil.SimpleMenuItem{
+			Txt: "Export objects",
+			Key: gowid.MakeKey('o'),
+			CB: func(app gowid.IApp, w gowid.IWidget) {
+				multiMenu1Opener.CloseMenu(analysisMenu, app)
+				startExportObjects(app)
+			},
+		},
+		menuutil.SimpleMenuItem{
+			Txt: "Bookmarks and comments",
+			Key: gowid.MakeKey('b'),
+			CB: func(app gowid.IApp, w gowid.IWidget) {
+				multiMenu1Opener.CloseMenu(analysisMenu, app)
+				openAnnotations(nil, app)
+			},
+		},
+		menuutil.SimpleMenuItem{
+			Txt: "I/O graph",
+			Key: gowid.MakeKey('i'),
+			CB: func(app gowid.IApp, w gowid.IWidget) {
+				multiMenu1Opener.CloseMenu(analysisMenu, app)
+				openIOGraphSetup(app)
+			},
+		},
+		menuutil.SimpleMenuItem{
+			Txt: "Protocol hierarchy",
+			Key: gowid.MakeKey('h'),
+			CB: func(app gowid.IApp, w gowid.IWidget) {
+				multiMenu1Opener.CloseMenu(analysisMenu, app)
+				startProtocolHierarchy(app)
+			},
+		},
 	}
 
 	analysisMenuListBox, analysisMenuWidth := menuutil.MakeMenuWithHotKeys(analysisMenuItems, nil)
@@ -294,6 +294,12 @@ func DefaultPcapDir() string {
 	return path.Join(CacheDir(), "pcaps")
 }
 
+// NativeLoader is true when packets are decoded by the native loader rather
+// than by tshark. TSharkMissing is true when there is no tshark to run at
+// all, so nothing may fall back to it. Both are set once from main.
+var NativeLoader bool
+var TSharkMissing bool
+
 func TSharkBin() string {
 	return profiles.ConfString("main.tshark", "tshark")
 }
@@ -34,6 +34,7 @@ import (
 	"github.com/gcla/gowid/widgets/text"
 	"github.com/gcla/termshark/v2"
 	"github.com/gcla/termshark/v2/pkg/fields"
+	"github.com/gcla/termshark/v2/pkg/native"
 	"github.com/gcla/termshark/v2/widgets/appkeys"
 	"github.com/gdamore/tcell/v2"
 )
@@ -775,6 +776,23 @@ func (f *DisplayFilterValidator) Validate(filter string) {
 		return
 	}
 
+	// Anything the native dissectors can evaluate is valid; the rest can
+	// only be checked by tshark, if there is one.
+	if termshark.NativeLoader {
+		if _, err = native.ParseFilter(filter); err == nil {
+			if f.Valid != nil {
+				f.Valid.Call(filter)
+			}
+			return
+		}
+		if termshark.TSharkMissing {
+			if f.Invalid != nil {
+				f.Invalid.Call(filter)
+			}
+			return
+		}
+	}
+
 	f.Cmd = exec.Command(termshark.TSharkBin(), []string{"-Y", filter, "-r", termshark.CacheFile("empty.pcap")}...)
 	err = f.Cmd.Run()
 
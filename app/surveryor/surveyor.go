@@ -22,6 +22,8 @@ import (
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 	"golang.org/x/exp/rand"
+
+	"ghostshell/app/fingerprint"
 )
 
 const (
@@ -217,10 +219,11 @@ func incIP(ip net.IP) {
 	}
 }
 
-// -------------- Collect Host Details (Hostname, OS, Open Ports) --------------
+// -------------- Collect Host Details (Hostname, OS, Open Ports, Services) --------------
 
 func collectHostDetails(destination string, hosts []string) []string {
 	logger.Info("Collecting host details", zap.Int("count", len(hosts)))
+	engine := fingerprint.NewEngine(nil, nil)
 	var wg sync.WaitGroup
 	results := make([]string, len(hosts))
 	wg.Add(len(hosts))
@@ -233,7 +236,8 @@ func collectHostDetails(destination string, hosts []string) []string {
 			// do port scanning (placeholder)
 			time.Sleep(50 * time.Millisecond) // simulate
 
-			results[i] = fmt.Sprintf("%s|SomeHostname|Linux|Ports:80,443", host)
+			services := detectServices(engine, host, []int{80, 443})
+			results[i] = fmt.Sprintf("%s|SomeHostname|Linux|Ports:80,443|%s", host, services)
 		}(i, h)
 	}
 
@@ -242,6 +246,20 @@ func collectHostDetails(destination string, hosts []string) []string {
 	return results
 }
 
+// detectServices fingerprints the services on a host's ports and renders them
+// in port order, e.g. "22=ssh OpenSSH 9.6; 80=http nginx". Unreachable ports
+// are left out, and "|" is replaced since it separates the host fields.
+func detectServices(engine *fingerprint.Engine, host string, ports []int) string {
+	found := engine.IdentifyAll(context.Background(), host, ports, "tcp", 5)
+	parts := make([]string, 0, len(found))
+	for _, port := range ports {
+		if info, ok := found[port]; ok {
+			parts = append(parts, fmt.Sprintf("%d=%s", port, strings.ReplaceAll(info.String(), "|", "/")))
+		}
+	}
+	return strings.Join(parts, "; ")
+}
+
 // -------------- Traffic Generation --------------
 
 func generateTrafficConcurrently(destination string, hosts []string) {
@@ -327,7 +345,7 @@ func generatePDFReport(filePath, destination string, hosts []string) error {
 	pdf.Ln(5)
 
 	for _, h := range hosts {
-		// split into fields if we stored them as "IP|Hostname|OS|Ports..."
+		// split into fields if we stored them as "IP|Hostname|OS|Ports|Services"
 		fields := strings.Split(h, "|")
 		line := fmt.Sprintf("Host: %s", fields[0])
 		if len(fields) > 1 {
@@ -339,6 +357,9 @@ func generatePDFReport(filePath, destination string, hosts []string) error {
 		if len(fields) > 3 {
 			line += fmt.Sprintf(", %s", fields[3])
 		}
+		if len(fields) > 4 && fields[4] != "" {
+			line += fmt.Sprintf(", Services: %s", fields[4])
+		}
 		pdf.MultiCell(190, 6, line, "", "", false)
 	}
 
@@ -354,12 +375,12 @@ func generateCSVReport(filePath, destination string, hosts []string) error {
 	defer f.Close()
 
 	// minimal CSV
-	f.WriteString("IP,Hostname,OS,OpenPorts\n")
+	f.WriteString("IP,Hostname,OS,OpenPorts,Services\n")
 	for _, h := range hosts {
-		// parse the "IP|Hostname|OS|Ports" format
+		// parse the "IP|Hostname|OS|Ports|Services" format
 		fields := strings.Split(h, "|")
 		ip := fields[0]
-		hostname, osStr, ports := "", "", ""
+		hostname, osStr, ports, services := "", "", "", ""
 		if len(fields) > 1 {
 			hostname = fields[1]
 		}
@@ -369,7 +390,11 @@ func generateCSVReport(filePath, destination string, hosts []string) error {
 		if len(fields) > 3 {
 			ports = fields[3]
 		}
-		line := fmt.Sprintf("%s,%s,%s,%s\n", ip, hostname, osStr, ports)
+		if len(fields) > 4 {
+			// Service banners may contain commas and quotes
+			services = `"` + strings.ReplaceAll(fields[4], `"`, `""`) + `"`
+		}
+		line := fmt.Sprintf("%s,%s,%s,%s,%s\n", ip, hostname, osStr, ports, services)
 		f.WriteString(line)
 	}
 	return nil
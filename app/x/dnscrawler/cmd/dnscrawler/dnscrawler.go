@@ -8,12 +8,15 @@ import (
 	"os/signal"
 	"path/filepath"
 	"runtime"
+	"strings"
 	"sync"
 	"syscall"
 	"time"
 
 	"math/rand"
 
+	"ghostshell/app/x/dnscrawler"
+	"ghostshell/app/x/dnscrawler/dnsenum"
 	rl "github.com/gen2brain/raylib-go/raylib"
 	"github.com/jung-kurt/gofpdf"
 	"go.uber.org/zap"
@@ -127,45 +130,73 @@ func updateParticles(ps []*Particle) {
 
 // -------------- DNS Scanning --------------
 
-// simulateDNSCrawl is a stub concurrency-based DNS scanning
-func simulateDNSCrawl(ctx context.Context, wg *sync.WaitGroup, results *[]string, mu *sync.Mutex) {
+// crawlDNS enumerates every domain with the DNS engine and appends the
+// discovered records to results
+func crawlDNS(ctx context.Context, wg *sync.WaitGroup, engine *dnsenum.Engine, domains []string, results *[]string, mu *sync.Mutex) {
 	defer wg.Done()
-	logger.Info("DNS crawler started")
+	logger.Info("DNS crawler started", zap.Strings("domains", domains))
 
-	endpoints := []string{
-		"google.com", "example.com", "microsoft.com",
-		"ubuntu.com", "archlinux.org", "kubernetes.io",
-	}
-
-	idx := 0
-	for {
-		select {
-		case <-ctx.Done():
+	for _, domain := range domains {
+		if ctx.Err() != nil {
 			logger.Info("DNS crawler context canceled")
 			return
-		default:
 		}
-		if idx >= len(endpoints) {
-			idx = 0
+		domain = strings.TrimSpace(domain)
+		if domain == "" {
+			continue
 		}
-		ep := endpoints[idx]
-		// random success/fail
-		time.Sleep(800 * time.Millisecond)
-		if rand.Float32() < 0.4 {
-			line := fmt.Sprintf("%s => FAIL (no record found)", ep)
-			logger.Warn("DNS lookup fail", zap.String("endpoint", ep))
-			mu.Lock()
-			*results = append(*results, line)
-			mu.Unlock()
-		} else {
-			line := fmt.Sprintf("%s => OK (some IP addresses found)", ep)
-			logger.Info("DNS lookup success", zap.String("endpoint", ep))
-			mu.Lock()
-			*results = append(*results, line)
-			mu.Unlock()
+
+		records, err := engine.Enumerate(ctx, domain)
+		if err != nil {
+			logger.Warn("DNS enumeration incomplete", zap.String("domain", domain), zap.Error(err))
+		}
+
+		mu.Lock()
+		for _, r := range records {
+			*results = append(*results, fmt.Sprintf("%s %s %s [%s]", r.Host, r.Type, r.Value, r.Method))
 		}
-		idx++
+		mu.Unlock()
+		logger.Info("DNS enumeration finished", zap.String("domain", domain), zap.Int("records", len(records)))
+	}
+
+	logger.Info("DNS crawler finished")
+}
+
+// crackNSEC3 cracks a hash file written by -nsec3-out with the wordlist
+func crackNSEC3(path string, words []string) error {
+	if len(words) == 0 {
+		return fmt.Errorf("a wordlist is required to crack NSEC3 hashes")
+	}
+	records, err := dnsenum.CrackNSEC3File(path, words)
+	if err != nil {
+		return err
+	}
+	for _, r := range records {
+		fmt.Printf("%s %s %s [%s]\n", r.Host, r.Type, r.Value, r.Method)
 	}
+	logger.Info("NSEC3 cracking finished", zap.String("file", path), zap.Int("cracked", len(records)))
+	return nil
+}
+
+// writeNSEC3Hashes saves the NSEC3 chains collected during the crawl
+func writeNSEC3Hashes(path string, engine *dnsenum.Engine) error {
+	chains := engine.NSEC3Chains()
+	if len(chains) == 0 {
+		return nil
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create NSEC3 hash file: %w", err)
+	}
+	defer f.Close()
+
+	for _, chain := range chains {
+		if err := chain.WriteHashes(f); err != nil {
+			return fmt.Errorf("failed to write NSEC3 hashes: %w", err)
+		}
+	}
+	logger.Info("NSEC3 hashes written", zap.String("file", path), zap.Int("zones", len(chains)))
+	return nil
 }
 
 // -------------- Reports --------------
@@ -208,7 +239,7 @@ func writeCSV(path string, data []string) error {
 	defer w.Flush()
 
 	// Write header
-	if err := w.Write([]string{"DNS Endpoint => Status"}); err != nil {
+	if err := w.Write([]string{"DNS Record (host type value [method])"}); err != nil {
 		return err
 	}
 	for _, line := range data {
@@ -250,6 +281,31 @@ func main() {
 	defer logger.Sync()
 	logger.Info("Logger initialized")
 
+	options, err := dnscrawler.ParseInput()
+	if err != nil {
+		logger.Fatal("Invalid input", zap.Error(err))
+	}
+	var cfg *dnscrawler.Config
+	if options.ConfigFile != "" {
+		if cfg, err = dnscrawler.LoadConfig(options.ConfigFile); err != nil {
+			logger.Fatal("Failed to load config", zap.Error(err))
+		}
+	}
+	ec, err := dnscrawler.EngineConfig(options, cfg)
+	if err != nil {
+		logger.Fatal("Invalid DNS engine settings", zap.Error(err))
+	}
+	if options.NSEC3Crack != "" {
+		if err := crackNSEC3(options.NSEC3Crack, ec.Wordlist); err != nil {
+			logger.Fatal("Failed to crack NSEC3 hashes", zap.Error(err))
+		}
+		return
+	}
+	engine, err := dnsenum.NewEngine(ec, logger)
+	if err != nil {
+		logger.Fatal("Failed to create DNS engine", zap.Error(err))
+	}
+
 	// set up the Raylib window
 	rl.InitWindow(windowWidth, windowHeight, "DNS Crawler")
 	rl.SetTargetFPS(60)
@@ -272,7 +328,7 @@ func main() {
 	mu := sync.Mutex{}
 
 	wg.Add(1)
-	go simulateDNSCrawl(ctx, &wg, &results, &mu)
+	go crawlDNS(ctx, &wg, engine, options.Domains, &results, &mu)
 
 	// graceful shutdown if the user closes window or hits ESC
 	// or we can handle OS signals
@@ -296,6 +352,10 @@ func main() {
 		localTime := time.Now().Format("15:04:05")
 		rl.DrawTextEx(term.font, fmt.Sprintf("Local Time: %s", localTime), rl.NewVector2(40, 80), 20, 2, rl.White)
 		rl.DrawTextEx(term.font, "Press ESC to Exit", rl.NewVector2(40, 110), 20, 2, rl.LightGray)
+		mu.Lock()
+		found := len(results)
+		mu.Unlock()
+		rl.DrawTextEx(term.font, fmt.Sprintf("Records found: %d", found), rl.NewVector2(40, 140), 20, 2, rl.White)
 
 		// if user hits ESC
 		if rl.IsKeyPressed(rl.KeyEscape) {
@@ -312,6 +372,11 @@ func main() {
 	if err := generateReports(results); err != nil {
 		logger.Error("Failed to generate reports", zap.Error(err))
 	}
+	if options.NSEC3Out != "" {
+		if err := writeNSEC3Hashes(options.NSEC3Out, engine); err != nil {
+			logger.Error("Failed to save NSEC3 hashes", zap.Error(err))
+		}
+	}
 
 	logger.Info("Exiting application gracefully")
 }
@@ -4,15 +4,25 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"strings"
+	"time"
+
+	"ghostshell/app/x/dnscrawler/dnsenum"
 )
 
 type Config struct {
-	Resolvers []string `json:"resolvers"`
-	Retries   int      `json:"retries"`
+	Resolvers        []string `json:"resolvers"`
+	Retries          int      `json:"retries"`
+	Timeout          int      `json:"timeout"`           // Seconds per query
+	Wordlist         string   `json:"wordlist"`          // Brute force wordlist file
+	RecordTypes      []string `json:"record_types"`      // Record types queried per name
+	PermutationWords []string `json:"permutation_words"` // Words mixed into discovered names
+	MaxPermutations  int      `json:"max_permutations"`
+	MaxZoneWalk      int      `json:"max_zone_walk"` // Queries spent walking one zone
 }
 
-// loadConfig reads configuration from a JSON file
-func loadConfig(filePath string) (*Config, error) {
+// LoadConfig reads configuration from a JSON file
+func LoadConfig(filePath string) (*Config, error) {
 	if filePath == "" {
 		filePath = "config.json"
 	}
@@ -44,3 +54,66 @@ func loadConfig(filePath string) (*Config, error) {
 
 	return &cfg, nil
 }
+
+// EngineConfig combines the config file and command-line options into the
+// settings of the DNS enumeration engine. Options take precedence.
+func EngineConfig(options *Options, cfg *Config) (dnsenum.EngineConfig, error) {
+	ec := dnsenum.DefaultEngineConfig
+	if cfg != nil {
+		if len(cfg.Resolvers) > 0 {
+			ec.Resolvers = cfg.Resolvers
+		}
+		if cfg.Retries > 0 {
+			ec.Retries = cfg.Retries
+		}
+		if cfg.Timeout > 0 {
+			ec.Timeout = time.Duration(cfg.Timeout) * time.Second
+		}
+		if len(cfg.RecordTypes) > 0 {
+			ec.RecordTypes = cfg.RecordTypes
+		}
+		if len(cfg.PermutationWords) > 0 {
+			ec.PermutationWords = cfg.PermutationWords
+		}
+		if cfg.MaxPermutations > 0 {
+			ec.MaxPermutations = cfg.MaxPermutations
+		}
+		if cfg.MaxZoneWalk > 0 {
+			ec.MaxZoneWalk = cfg.MaxZoneWalk
+		}
+	}
+
+	var resolvers []string
+	for _, r := range options.Resolvers {
+		if r = strings.TrimSpace(r); r != "" {
+			resolvers = append(resolvers, r)
+		}
+	}
+	if len(resolvers) > 0 {
+		ec.Resolvers = resolvers
+	}
+	if options.Concurrency > 0 {
+		ec.Concurrency = options.Concurrency
+	}
+	if len(options.RecordTypes) > 0 {
+		ec.RecordTypes = options.RecordTypes
+	}
+	ec.Permutations = options.Permutations
+	ec.AXFR = options.AXFR
+	ec.FilterWildcards = options.FilterWildcards
+	ec.ZoneWalk = options.ZoneWalk
+
+	wordlist := options.Wordlist
+	if wordlist == "" && cfg != nil {
+		wordlist = cfg.Wordlist
+	}
+	if wordlist != "" {
+		words, err := linesInFile(wordlist)
+		if err != nil {
+			return ec, fmt.Errorf("failed to read wordlist: %w", err)
+		}
+		ec.Wordlist = words
+	}
+
+	return ec, nil
+}
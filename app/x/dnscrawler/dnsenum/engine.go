@@ -0,0 +1,408 @@
+package dnsenum
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+	"go.uber.org/zap"
+)
+
+// EngineConfig configures the DNS enumeration Engine.
+type EngineConfig struct {
+	Resolvers        []string      // Resolvers as "ip" or "ip:port"
+	Retries          int           // Extra attempts per query, each on the next resolver
+	Timeout          time.Duration // Timeout of a single query or zone transfer
+	Concurrency      int           // Names resolved in parallel
+	RecordTypes      []string      // Record types queried for every discovered name
+	Wordlist         []string      // Labels tried under the domain
+	Permutations     bool          // Resolve altdns-style mutations of discovered names
+	PermutationWords []string      // Words used for permutations
+	MaxPermutations  int           // Upper bound of permutation candidates (0 = unlimited)
+	AXFR             bool          // Attempt a zone transfer from every authoritative server
+	AXFRPort         int           // Port used for zone transfers
+	ZoneWalk         bool          // Walk NSEC chains and collect NSEC3 hashes
+	MaxZoneWalk      int           // Upper bound of zone walking queries
+	FilterWildcards  bool          // Drop names that only resolve to wildcard answers
+}
+
+// DefaultResolvers are the public resolvers queried when none are configured.
+var DefaultResolvers = []string{
+	"1.1.1.1:53", // Cloudflare
+	"8.8.8.8:53", // Google
+	"9.9.9.9:53", // Quad9
+}
+
+// DefaultEngineConfig provides default Engine settings.
+var DefaultEngineConfig = EngineConfig{
+	Resolvers:        DefaultResolvers,
+	Retries:          2,
+	Timeout:          5 * time.Second,
+	Concurrency:      50,
+	RecordTypes:      []string{"A", "AAAA", "CNAME", "MX", "NS", "TXT", "SOA", "SRV", "CAA"},
+	Permutations:     true,
+	PermutationWords: DefaultPermutationWords,
+	MaxPermutations:  10000,
+	AXFR:             true,
+	AXFRPort:         53,
+	ZoneWalk:         true,
+	MaxZoneWalk:      5000,
+	FilterWildcards:  true,
+}
+
+// Engine enumerates the records of a domain by querying known names,
+// attempting zone transfers, brute forcing a wordlist and resolving
+// permutations of everything found.
+type Engine struct {
+	config   EngineConfig
+	qtypes   []uint16
+	pool     *ResolverPool
+	wildcard *WildcardDetector
+	logger   *zap.Logger
+
+	mu     sync.Mutex
+	chains []*NSEC3Chain
+}
+
+// NewEngine creates an Engine. A nil logger disables logging.
+func NewEngine(config EngineConfig, logger *zap.Logger) (*Engine, error) {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = DefaultEngineConfig.Timeout
+	}
+	if config.Concurrency <= 0 {
+		config.Concurrency = DefaultEngineConfig.Concurrency
+	}
+	if len(config.RecordTypes) == 0 {
+		config.RecordTypes = DefaultEngineConfig.RecordTypes
+	}
+	if len(config.PermutationWords) == 0 {
+		config.PermutationWords = DefaultPermutationWords
+	}
+	if config.AXFRPort == 0 {
+		config.AXFRPort = 53
+	}
+
+	var qtypes []uint16
+	for _, name := range config.RecordTypes {
+		qtype, ok := dns.StringToType[strings.ToUpper(strings.TrimSpace(name))]
+		if !ok {
+			return nil, fmt.Errorf("unsupported DNS record type: %s", name)
+		}
+		qtypes = append(qtypes, qtype)
+	}
+
+	pool, err := NewResolverPool(config.Resolvers, config.Timeout, config.Retries)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Engine{
+		config:   config,
+		qtypes:   qtypes,
+		pool:     pool,
+		wildcard: NewWildcardDetector(pool, logger),
+		logger:   logger,
+	}, nil
+}
+
+// Enumerate discovers the records of domain. Records are de-duplicated and
+// sorted by host and type; each carries the method that first found it.
+func (e *Engine) Enumerate(ctx context.Context, domain string) ([]DNSRecord, error) {
+	domain = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(domain)), ".")
+	if domain == "" {
+		return nil, fmt.Errorf("domain is required")
+	}
+	e.logger.Info("Starting DNS enumeration", zap.String("domain", domain))
+
+	results := newRecordSet()
+
+	// Records of the domain itself
+	results.add(e.queryAll(ctx, domain, MethodQuery))
+
+	// Zone transfers from the authoritative servers
+	if e.config.AXFR {
+		results.add(e.transferZone(ctx, domain, results.values(domain, "NS")))
+	}
+
+	// DNSSEC zone walking
+	if e.config.ZoneWalk {
+		walk, err := e.WalkZone(ctx, domain)
+		if err != nil {
+			e.logger.Warn("Zone walk incomplete", zap.String("domain", domain), zap.Error(err))
+		}
+		// The walked names are queried before their NSEC records mark them as known
+		e.queryNames(ctx, walk.Names, MethodNSEC, results)
+		results.add(walk.Records)
+		if walk.NSEC3 != nil {
+			e.queryNames(ctx, walk.NSEC3.Cracked(), MethodNSEC3, results)
+			results.add(walk.NSEC3.Records(true))
+		}
+	}
+
+	// Wordlist brute force
+	var candidates []string
+	for _, word := range e.config.Wordlist {
+		word = strings.ToLower(strings.Trim(strings.TrimSpace(word), "."))
+		if word == "" || strings.HasPrefix(word, "#") {
+			continue
+		}
+		candidates = append(candidates, word+"."+domain)
+	}
+	e.resolveNames(ctx, domain, results.missing(candidates), MethodBruteForce, results)
+
+	// Permutations of everything discovered so far
+	if e.config.Permutations {
+		seeds := results.hosts(domain)
+		candidates := Permutations(seeds, domain, e.config.PermutationWords, e.config.MaxPermutations)
+		e.resolveNames(ctx, domain, results.missing(candidates), MethodPermutation, results)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return results.sorted(), err
+	}
+
+	records := results.sorted()
+	e.logger.Info("DNS enumeration completed", zap.String("domain", domain), zap.Int("records", len(records)))
+	return records, nil
+}
+
+// resolveNames resolves the candidate names concurrently and adds the records
+// of those that exist and are not wildcard answers.
+func (e *Engine) resolveNames(ctx context.Context, domain string, names []string, method string, results *recordSet) {
+	if len(names) == 0 {
+		return
+	}
+	e.logger.Info("Resolving candidate names", zap.String("domain", domain), zap.String("method", method), zap.Int("candidates", len(names)))
+
+	e.forEach(ctx, names, func(name string) {
+		if !e.exists(ctx, name) {
+			return
+		}
+		if e.config.FilterWildcards && e.wildcard.IsWildcard(name, domain) {
+			e.logger.Debug("Dropping wildcard answer", zap.String("host", name))
+			return
+		}
+		results.add(e.queryAll(ctx, name, method))
+	})
+}
+
+// queryNames queries every record type of names that are known to exist
+func (e *Engine) queryNames(ctx context.Context, names []string, method string, results *recordSet) {
+	e.forEach(ctx, results.missing(names), func(name string) {
+		results.add(e.queryAll(ctx, name, method))
+	})
+}
+
+// forEach calls fn for every name using the configured concurrency
+func (e *Engine) forEach(ctx context.Context, names []string, fn func(name string)) {
+	ForEach(ctx, names, e.config.Concurrency, fn)
+}
+
+// ForEach calls fn for every name from at most concurrency goroutines. Names
+// not yet handed out when ctx is done are skipped.
+func ForEach(ctx context.Context, names []string, concurrency int, fn func(name string)) {
+	jobs := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency && i < len(names); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for name := range jobs {
+				fn(name)
+			}
+		}()
+	}
+
+	for _, name := range names {
+		select {
+		case jobs <- name:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	close(jobs)
+	wg.Wait()
+}
+
+// exists reports whether name resolves at all (NOERROR, with or without data)
+func (e *Engine) exists(ctx context.Context, name string) bool {
+	resp, err := e.pool.Query(ctx, name, dns.TypeA)
+	if err != nil {
+		e.logger.Debug("Query failed", zap.String("host", name), zap.Error(err))
+		return false
+	}
+	return resp.Rcode == dns.RcodeSuccess
+}
+
+// queryAll queries every configured record type of name
+func (e *Engine) queryAll(ctx context.Context, name string, method string) []DNSRecord {
+	var records []DNSRecord
+	for _, qtype := range e.qtypes {
+		if ctx.Err() != nil {
+			break
+		}
+		resp, err := e.pool.Query(ctx, name, qtype)
+		if err != nil {
+			e.logger.Debug("Query failed", zap.String("host", name), zap.String("type", dns.TypeToString[qtype]), zap.Error(err))
+			continue
+		}
+		for _, rr := range resp.Answer {
+			records = append(records, recordFromRR(rr, method))
+		}
+	}
+	return records
+}
+
+// transferZone attempts an AXFR from each name server until one succeeds
+func (e *Engine) transferZone(ctx context.Context, domain string, nameServers []string) []DNSRecord {
+	for _, ns := range nameServers {
+		ips, err := e.pool.LookupA(ctx, ns)
+		if err != nil {
+			e.logger.Debug("Failed to resolve name server", zap.String("ns", ns), zap.Error(err))
+			continue
+		}
+		for _, ip := range ips {
+			server := net.JoinHostPort(ip, strconv.Itoa(e.config.AXFRPort))
+			records, err := e.axfr(domain, server)
+			if err != nil {
+				e.logger.Info("Zone transfer refused", zap.String("domain", domain), zap.String("server", server), zap.Error(err))
+				continue
+			}
+			e.logger.Info("Zone transfer succeeded", zap.String("domain", domain), zap.String("server", server), zap.Int("records", len(records)))
+			return records
+		}
+	}
+	return nil
+}
+
+// axfr performs a single zone transfer
+func (e *Engine) axfr(domain, server string) ([]DNSRecord, error) {
+	msg := new(dns.Msg)
+	msg.SetAxfr(dns.Fqdn(domain))
+
+	transfer := &dns.Transfer{
+		DialTimeout:  e.config.Timeout,
+		ReadTimeout:  e.config.Timeout,
+		WriteTimeout: e.config.Timeout,
+	}
+	envelopes, err := transfer.In(msg, server)
+	if err != nil {
+		return nil, err
+	}
+
+	var records []DNSRecord
+	for env := range envelopes {
+		if env.Error != nil {
+			return nil, env.Error
+		}
+		for _, rr := range env.RR {
+			records = append(records, recordFromRR(rr, MethodAXFR))
+		}
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("empty zone transfer")
+	}
+	return records, nil
+}
+
+// recordSet collects de-duplicated records from concurrent workers
+type recordSet struct {
+	mu      sync.Mutex
+	records map[string]DNSRecord
+	names   map[string]struct{}
+}
+
+func newRecordSet() *recordSet {
+	return &recordSet{
+		records: make(map[string]DNSRecord),
+		names:   make(map[string]struct{}),
+	}
+}
+
+func (s *recordSet) add(records []DNSRecord) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, r := range records {
+		if _, ok := s.records[r.Key()]; !ok {
+			s.records[r.Key()] = r
+		}
+		s.names[r.Host] = struct{}{}
+	}
+}
+
+// values returns the values of the host's records of the given type
+func (s *recordSet) values(host, rtype string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []string
+	for _, r := range s.records {
+		if r.Host == host && r.Type == rtype {
+			out = append(out, strings.TrimSuffix(r.Value, "."))
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// hosts returns the discovered names below domain
+func (s *recordSet) hosts(domain string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []string
+	for name := range s.names {
+		if strings.HasSuffix(name, "."+domain) {
+			out = append(out, name)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// missing returns the candidates that have no records yet
+func (s *recordSet) missing(candidates []string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []string
+	seen := make(map[string]struct{})
+	for _, name := range candidates {
+		if _, ok := s.names[name]; ok {
+			continue
+		}
+		if _, ok := seen[name]; ok {
+			continue
+		}
+		seen[name] = struct{}{}
+		out = append(out, name)
+	}
+	return out
+}
+
+func (s *recordSet) sorted() []DNSRecord {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]DNSRecord, 0, len(s.records))
+	for _, r := range s.records {
+		out = append(out, r)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Host != out[j].Host {
+			return out[i].Host < out[j].Host
+		}
+		if out[i].Type != out[j].Type {
+			return out[i].Type < out[j].Type
+		}
+		return out[i].Value < out[j].Value
+	})
+	return out
+}
@@ -0,0 +1,394 @@
+package dnsenum
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// testZones is the data served by the in-process authoritative server
+var testZones = map[string][]string{
+	"example.test.": {
+		"example.test. 300 IN SOA ns1.example.test. hostmaster.example.test. 1 3600 600 86400 300",
+		"example.test. 300 IN NS ns1.example.test.",
+		"example.test. 300 IN A 192.0.2.1",
+		"example.test. 300 IN MX 10 mail.example.test.",
+		"example.test. 300 IN TXT \"v=spf1 mx -all\"",
+		"ns1.example.test. 300 IN A 127.0.0.1",
+		"www.example.test. 300 IN CNAME web1.example.test.",
+		"web1.example.test. 300 IN A 192.0.2.10",
+		"web2.example.test. 300 IN A 192.0.2.11",
+		"mail.example.test. 300 IN A 192.0.2.20",
+		"dev-api.example.test. 300 IN A 192.0.2.30",
+		"api.example.test. 300 IN A 192.0.2.31",
+		"secret.example.test. 300 IN A 192.0.2.99",
+	},
+	"wild.test.": {
+		"wild.test. 300 IN SOA ns1.wild.test. hostmaster.wild.test. 1 3600 600 86400 300",
+		"wild.test. 300 IN NS ns1.wild.test.",
+		"ns1.wild.test. 300 IN A 127.0.0.1",
+		"*.wild.test. 300 IN A 198.51.100.7",
+		"www.wild.test. 300 IN A 198.51.100.80",
+	},
+}
+
+// testServer is a minimal authoritative server over testZones. Zone
+// transfers are only allowed for zones listed in axfr.
+type testServer struct {
+	zones map[string][]dns.RR
+	axfr  map[string]bool
+}
+
+func (s *testServer) ServeDNS(w dns.ResponseWriter, r *dns.Msg) {
+	q := r.Question[0]
+	name := strings.ToLower(q.Name)
+
+	m := new(dns.Msg)
+	m.SetReply(r)
+	m.Authoritative = true
+
+	var zone string
+	for origin := range s.zones {
+		if dns.IsSubDomain(origin, name) {
+			zone = origin
+		}
+	}
+	if zone == "" {
+		m.Rcode = dns.RcodeRefused
+		w.WriteMsg(m)
+		return
+	}
+
+	if q.Qtype == dns.TypeAXFR {
+		if !s.axfr[zone] || name != zone {
+			m.Rcode = dns.RcodeRefused
+			w.WriteMsg(m)
+			return
+		}
+		soa := s.zones[zone][0]
+		m.Answer = append([]dns.RR{soa}, s.zones[zone][1:]...)
+		m.Answer = append(m.Answer, soa)
+		w.WriteMsg(m)
+		return
+	}
+
+	exists := false
+	for _, rr := range s.zones[zone] {
+		if strings.ToLower(rr.Header().Name) != name {
+			continue
+		}
+		exists = true
+		if rr.Header().Rrtype == q.Qtype || rr.Header().Rrtype == dns.TypeCNAME {
+			m.Answer = append(m.Answer, rr)
+		}
+	}
+
+	// Follow in-zone CNAMEs
+	for i := 0; i < len(m.Answer); i++ {
+		if cname, ok := m.Answer[i].(*dns.CNAME); ok && q.Qtype != dns.TypeCNAME {
+			for _, rr := range s.zones[zone] {
+				if strings.EqualFold(rr.Header().Name, cname.Target) && rr.Header().Rrtype == q.Qtype {
+					m.Answer = append(m.Answer, rr)
+				}
+			}
+		}
+	}
+
+	if !exists {
+		wildcard := "*." + name[strings.Index(name, ".")+1:]
+		for _, rr := range s.zones[zone] {
+			if strings.ToLower(rr.Header().Name) == wildcard {
+				exists = true
+				if rr.Header().Rrtype == q.Qtype {
+					synth := dns.Copy(rr)
+					synth.Header().Name = q.Name
+					m.Answer = append(m.Answer, synth)
+				}
+			}
+		}
+	}
+
+	if !exists {
+		m.Rcode = dns.RcodeNameError
+		m.Ns = []dns.RR{s.zones[zone][0]}
+	}
+	w.WriteMsg(m)
+}
+
+// startTestServer serves testZones over UDP and TCP on the same loopback port
+func startTestServer(t *testing.T, axfr ...string) (addr string, port int) {
+	t.Helper()
+
+	handler := &testServer{zones: make(map[string][]dns.RR), axfr: make(map[string]bool)}
+	for origin, lines := range testZones {
+		for _, line := range lines {
+			rr, err := dns.NewRR(line)
+			if err != nil {
+				t.Fatalf("bad test record %q: %v", line, err)
+			}
+			handler.zones[origin] = append(handler.zones[origin], rr)
+		}
+	}
+	for _, zone := range axfr {
+		handler.axfr[dns.Fqdn(zone)] = true
+	}
+
+	var pc net.PacketConn
+	var ln net.Listener
+	for i := 0; i < 10; i++ {
+		var err error
+		if pc, err = net.ListenPacket("udp", "127.0.0.1:0"); err != nil {
+			t.Fatal(err)
+		}
+		port = pc.LocalAddr().(*net.UDPAddr).Port
+		if ln, err = net.Listen("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port))); err == nil {
+			break
+		}
+		pc.Close()
+		pc = nil
+	}
+	if pc == nil {
+		t.Fatal("could not bind UDP and TCP on the same port")
+	}
+
+	udp := &dns.Server{PacketConn: pc, Handler: handler}
+	tcp := &dns.Server{Listener: ln, Handler: handler}
+	go udp.ActivateAndServe()
+	go tcp.ActivateAndServe()
+	t.Cleanup(func() {
+		udp.Shutdown()
+		tcp.Shutdown()
+	})
+
+	return pc.LocalAddr().String(), port
+}
+
+func testEngine(t *testing.T, addr string, port int, modify func(*EngineConfig)) *Engine {
+	t.Helper()
+	config := DefaultEngineConfig
+	config.Resolvers = []string{addr}
+	config.Timeout = time.Second
+	config.Concurrency = 4
+	config.AXFR = false
+	config.AXFRPort = port
+	config.Permutations = false
+	if modify != nil {
+		modify(&config)
+	}
+	engine, err := NewEngine(config, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return engine
+}
+
+func findRecord(records []DNSRecord, host, rtype string) (DNSRecord, bool) {
+	for _, r := range records {
+		if r.Host == host && r.Type == rtype {
+			return r, true
+		}
+	}
+	return DNSRecord{}, false
+}
+
+func TestEngineBruteForce(t *testing.T) {
+	addr, port := startTestServer(t)
+	engine := testEngine(t, addr, port, func(c *EngineConfig) {
+		c.Wordlist = []string{"www", "mail", "missing", "# comment"}
+	})
+
+	records, err := engine.Enumerate(context.Background(), "example.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if r, ok := findRecord(records, "example.test", "MX"); !ok || r.Method != MethodQuery || r.Value != "10 mail.example.test." {
+		t.Errorf("apex MX = %+v, %v", r, ok)
+	}
+	if r, ok := findRecord(records, "www.example.test", "CNAME"); !ok || r.Method != MethodBruteForce || r.Value != "web1.example.test." {
+		t.Errorf("www CNAME = %+v, %v", r, ok)
+	}
+	if r, ok := findRecord(records, "web1.example.test", "A"); !ok || r.Value != "192.0.2.10" {
+		t.Errorf("CNAME target A = %+v, %v", r, ok)
+	}
+	if _, ok := findRecord(records, "mail.example.test", "A"); !ok {
+		t.Error("mail.example.test not found")
+	}
+	if _, ok := findRecord(records, "missing.example.test", "A"); ok {
+		t.Error("missing.example.test should not resolve")
+	}
+	if _, ok := findRecord(records, "secret.example.test", "A"); ok {
+		t.Error("secret.example.test is only reachable through AXFR")
+	}
+}
+
+func TestEnginePermutations(t *testing.T) {
+	addr, port := startTestServer(t)
+	engine := testEngine(t, addr, port, func(c *EngineConfig) {
+		c.Wordlist = []string{"web1", "api"}
+		c.Permutations = true
+		c.PermutationWords = []string{"dev"}
+	})
+
+	records, err := engine.Enumerate(context.Background(), "example.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, host := range []string{"web2.example.test", "dev-api.example.test"} {
+		r, ok := findRecord(records, host, "A")
+		if !ok {
+			t.Errorf("%s not found by permutation", host)
+			continue
+		}
+		if r.Method != MethodPermutation {
+			t.Errorf("%s method = %q, want %q", host, r.Method, MethodPermutation)
+		}
+	}
+}
+
+func TestEngineZoneTransfer(t *testing.T) {
+	addr, port := startTestServer(t, "example.test")
+	engine := testEngine(t, addr, port, func(c *EngineConfig) {
+		c.AXFR = true
+		c.Wordlist = []string{"secret"}
+	})
+
+	records, err := engine.Enumerate(context.Background(), "example.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, ok := findRecord(records, "secret.example.test", "A")
+	if !ok || r.Method != MethodAXFR {
+		t.Fatalf("secret.example.test = %+v, %v; want AXFR record", r, ok)
+	}
+	if _, ok := findRecord(records, "dev-api.example.test", "A"); !ok {
+		t.Error("zone transfer did not return every record")
+	}
+}
+
+func TestEngineZoneTransferRefused(t *testing.T) {
+	addr, port := startTestServer(t)
+	engine := testEngine(t, addr, port, func(c *EngineConfig) {
+		c.AXFR = true
+	})
+
+	records, err := engine.Enumerate(context.Background(), "example.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range records {
+		if r.Method == MethodAXFR {
+			t.Fatalf("unexpected AXFR record %+v", r)
+		}
+	}
+}
+
+func TestEngineWildcardFiltering(t *testing.T) {
+	addr, port := startTestServer(t)
+	engine := testEngine(t, addr, port, func(c *EngineConfig) {
+		c.Wordlist = []string{"www", "anything", "else"}
+	})
+
+	records, err := engine.Enumerate(context.Background(), "wild.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := findRecord(records, "www.wild.test", "A"); !ok {
+		t.Error("www.wild.test has its own address and must be kept")
+	}
+	for _, host := range []string{"anything.wild.test", "else.wild.test"} {
+		if _, ok := findRecord(records, host, "A"); ok {
+			t.Errorf("%s is a wildcard answer and must be dropped", host)
+		}
+	}
+
+	// Without filtering the wildcard answers are reported
+	engine = testEngine(t, addr, port, func(c *EngineConfig) {
+		c.Wordlist = []string{"anything"}
+		c.FilterWildcards = false
+	})
+	records, err = engine.Enumerate(context.Background(), "wild.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := findRecord(records, "anything.wild.test", "A"); !ok {
+		t.Error("anything.wild.test should be reported when wildcard filtering is off")
+	}
+}
+
+func TestWildcardDetectorPerDomain(t *testing.T) {
+	// a.test has a wildcard record; b.test's real host shares its address
+	wd := newWildcardDetector(nil, func(host string) ([]string, error) {
+		switch {
+		case strings.HasSuffix(host, ".a.test"), host == "www.b.test":
+			return []string{"192.0.2.1"}, nil
+		}
+		return nil, nil
+	})
+
+	if !wd.IsWildcard("anything.a.test", "a.test") {
+		t.Error("anything.a.test is a wildcard answer")
+	}
+	if wd.IsWildcard("www.b.test", "b.test") {
+		t.Error("www.b.test must not inherit a.test's wildcard addresses")
+	}
+}
+
+func TestResolverPoolRetriesNextResolver(t *testing.T) {
+	addr, _ := startTestServer(t)
+
+	// A resolver that never answers
+	dead, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dead.Close()
+
+	pool, err := NewResolverPool([]string{dead.LocalAddr().String(), addr}, 200*time.Millisecond, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ips, err := pool.LookupA(context.Background(), "mail.example.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ips) != 1 || ips[0] != "192.0.2.20" {
+		t.Fatalf("LookupA = %v", ips)
+	}
+
+	if _, err := NewResolverPool(nil, time.Second, 1); err == nil {
+		t.Error("expected an error for an empty resolver list")
+	}
+}
+
+func TestPermutations(t *testing.T) {
+	got := Permutations([]string{"web01.example.test", "api.example.test"}, "example.test", []string{"dev"}, 0)
+	want := []string{
+		"dev-api.example.test", "api-dev.example.test", "devapi.example.test", "apidev.example.test", "dev.api.example.test",
+		"web00.example.test", "web02.example.test",
+	}
+	set := make(map[string]bool)
+	for _, name := range got {
+		set[name] = true
+	}
+	for _, name := range want {
+		if !set[name] {
+			t.Errorf("missing permutation %s in %v", name, got)
+		}
+	}
+	if set["api.example.test"] {
+		t.Error("known names must not be returned")
+	}
+
+	if limited := Permutations([]string{"api.example.test"}, "example.test", []string{"dev", "qa"}, 3); len(limited) != 3 {
+		t.Errorf("limit not applied: %v", limited)
+	}
+}
@@ -0,0 +1,130 @@
+package dnsenum
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DefaultPermutationWords are the words mixed into discovered names when no
+// permutation wordlist is configured.
+var DefaultPermutationWords = []string{
+	"dev", "development", "stage", "staging", "test", "qa", "uat", "prod",
+	"api", "admin", "internal", "int", "beta", "old", "new", "backup", "v1", "v2",
+}
+
+// Permutations generates altdns-style mutations of the names discovered under
+// domain: words are joined to the leftmost label ("dev-api", "apidev"),
+// prepended as a new label ("dev.api") and numbers are counted up and down
+// ("web1" -> "web0", "web2"). Names already in names are not returned and at
+// most limit candidates are generated (0 means no limit).
+func Permutations(names []string, domain string, words []string, limit int) []string {
+	domain = strings.TrimSuffix(strings.ToLower(domain), ".")
+	suffix := "." + domain
+
+	seen := make(map[string]struct{}, len(names))
+	for _, name := range names {
+		seen[strings.TrimSuffix(strings.ToLower(name), ".")] = struct{}{}
+	}
+
+	var out []string
+	add := func(labels []string) bool {
+		for _, label := range labels {
+			if !validLabel(label) {
+				return true
+			}
+		}
+		candidate := strings.Join(labels, ".") + suffix
+		if _, ok := seen[candidate]; ok {
+			return true
+		}
+		seen[candidate] = struct{}{}
+		out = append(out, candidate)
+		return limit <= 0 || len(out) < limit
+	}
+
+	sorted := append([]string(nil), names...)
+	sort.Strings(sorted)
+
+	for _, name := range sorted {
+		name = strings.TrimSuffix(strings.ToLower(name), ".")
+		if !strings.HasSuffix(name, suffix) || strings.HasPrefix(name, "*.") {
+			continue
+		}
+		labels := strings.Split(strings.TrimSuffix(name, suffix), ".")
+		first, rest := labels[0], labels[1:]
+		with := func(label string) []string {
+			return append([]string{label}, rest...)
+		}
+
+		// Count numbers in the first label up and down
+		for _, label := range numberNeighbours(first) {
+			if !add(with(label)) {
+				return out
+			}
+		}
+
+		for _, word := range words {
+			word = strings.ToLower(strings.TrimSpace(word))
+			if word == "" || word == first {
+				continue
+			}
+			for _, label := range []string{word + "-" + first, first + "-" + word, word + first, first + word} {
+				if !add(with(label)) {
+					return out
+				}
+			}
+			if !add(append([]string{word}, labels...)) {
+				return out
+			}
+		}
+	}
+
+	return out
+}
+
+// numberNeighbours returns label with its last number decremented and incremented
+func numberNeighbours(label string) []string {
+	end := strings.LastIndexAny(label, "0123456789")
+	if end < 0 {
+		return nil
+	}
+	start := end
+	for start > 0 && label[start-1] >= '0' && label[start-1] <= '9' {
+		start--
+	}
+
+	digits := label[start : end+1]
+	n, err := strconv.Atoi(digits)
+	if err != nil {
+		return nil
+	}
+
+	var out []string
+	for _, m := range []int{n - 1, n + 1} {
+		if m < 0 {
+			continue
+		}
+		num := strconv.Itoa(m)
+		// Keep zero padding such as "web01" -> "web02"
+		if len(num) < len(digits) {
+			num = strings.Repeat("0", len(digits)-len(num)) + num
+		}
+		out = append(out, label[:start]+num+label[end+1:])
+	}
+	return out
+}
+
+// validLabel reports whether s is a usable hostname label
+func validLabel(s string) bool {
+	if s == "" || len(s) > 63 || s[0] == '-' || s[len(s)-1] == '-' {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,41 @@
+package dnsenum
+
+import (
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// Discovery methods recorded on each DNSRecord
+const (
+	MethodQuery       = "query"       // direct query of a known name
+	MethodBruteForce  = "bruteforce"  // wordlist label resolved under the domain
+	MethodPermutation = "permutation" // altdns-style mutation of a discovered name
+	MethodAXFR        = "axfr"        // returned by a zone transfer
+	MethodNSEC        = "nsec"        // walked from the zone's NSEC chain
+	MethodNSEC3       = "nsec3"       // NSEC3 hash collected or cracked offline
+)
+
+// DNSRecord represents a DNS record with host, type, and value.
+type DNSRecord struct {
+	Host   string
+	Type   string
+	Value  string
+	Method string // How the record was discovered, one of the Method constants
+}
+
+// Key identifies a record regardless of how it was discovered.
+func (r DNSRecord) Key() string {
+	return strings.ToLower(r.Host) + "|" + r.Type + "|" + r.Value
+}
+
+// recordFromRR converts a resource record into a DNSRecord.
+func recordFromRR(rr dns.RR, method string) DNSRecord {
+	hdr := rr.Header()
+	return DNSRecord{
+		Host:   strings.TrimSuffix(strings.ToLower(hdr.Name), "."),
+		Type:   dns.TypeToString[hdr.Rrtype],
+		Value:  strings.TrimSpace(strings.TrimPrefix(rr.String(), hdr.String())),
+		Method: method,
+	}
+}
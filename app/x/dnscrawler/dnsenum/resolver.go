@@ -0,0 +1,109 @@
+package dnsenum
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// ResolverPool spreads DNS queries over a set of resolvers. A failed attempt
+// (network error, SERVFAIL or REFUSED) is retried on the next resolver.
+type ResolverPool struct {
+	resolvers []string
+	retries   int
+	timeout   time.Duration
+	next      uint32
+}
+
+// NewResolverPool creates a pool over resolvers given as "ip" or "ip:port".
+func NewResolverPool(resolvers []string, timeout time.Duration, retries int) (*ResolverPool, error) {
+	var addrs []string
+	for _, r := range resolvers {
+		r = strings.TrimSpace(r)
+		if r == "" {
+			continue
+		}
+		if _, _, err := net.SplitHostPort(r); err != nil {
+			r = net.JoinHostPort(r, "53")
+		}
+		addrs = append(addrs, r)
+	}
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("at least one resolver is required")
+	}
+	if retries < 0 {
+		retries = 0
+	}
+
+	return &ResolverPool{
+		resolvers: addrs,
+		retries:   retries,
+		timeout:   timeout,
+	}, nil
+}
+
+// Resolvers returns the resolver addresses of the pool.
+func (p *ResolverPool) Resolvers() []string {
+	return p.resolvers
+}
+
+// Exchange sends msg to the pool's resolvers in turn until one answers or the
+// retries are exhausted. Truncated UDP answers are repeated over TCP.
+func (p *ResolverPool) Exchange(ctx context.Context, msg *dns.Msg) (*dns.Msg, error) {
+	var lastErr error
+	for attempt := 0; attempt <= p.retries; attempt++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		server := p.resolvers[int(atomic.AddUint32(&p.next, 1)-1)%len(p.resolvers)]
+		// dns.Client.ExchangeContext modifies its client, so clients are not shared
+		resp, _, err := (&dns.Client{Net: "udp", Timeout: p.timeout}).ExchangeContext(ctx, msg, server)
+		if err == nil && resp.Truncated {
+			resp, _, err = (&dns.Client{Net: "tcp", Timeout: p.timeout}).ExchangeContext(ctx, msg, server)
+		}
+		if err != nil {
+			lastErr = fmt.Errorf("%s: %w", server, err)
+			continue
+		}
+		if resp.Rcode == dns.RcodeServerFailure || resp.Rcode == dns.RcodeRefused {
+			lastErr = fmt.Errorf("%s: %s", server, dns.RcodeToString[resp.Rcode])
+			continue
+		}
+		return resp, nil
+	}
+
+	return nil, fmt.Errorf("query for %s failed after %d attempts: %w", msg.Question[0].Name, p.retries+1, lastErr)
+}
+
+// Query asks the pool for the records of the given type.
+func (p *ResolverPool) Query(ctx context.Context, name string, qtype uint16) (*dns.Msg, error) {
+	msg := new(dns.Msg)
+	msg.SetQuestion(dns.Fqdn(name), qtype)
+	msg.RecursionDesired = true
+	return p.Exchange(ctx, msg)
+}
+
+// LookupA returns the IPv4 addresses of host, following CNAMEs in the answer.
+func (p *ResolverPool) LookupA(ctx context.Context, host string) ([]string, error) {
+	resp, err := p.Query(ctx, host, dns.TypeA)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Rcode != dns.RcodeSuccess {
+		return nil, fmt.Errorf("lookup %s: %s", host, dns.RcodeToString[resp.Rcode])
+	}
+
+	var ips []string
+	for _, rr := range resp.Answer {
+		if a, ok := rr.(*dns.A); ok {
+			ips = append(ips, a.A.String())
+		}
+	}
+	return ips, nil
+}
@@ -0,0 +1,95 @@
+package dnsenum
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/rs/xid"
+	"go.uber.org/zap"
+)
+
+// wildcardProbes is the number of random names resolved per base domain
+const wildcardProbes = 3
+
+// WildcardDetector recognises answers from wildcard records by resolving
+// random names under each base domain once and remembering their addresses.
+type WildcardDetector struct {
+	logger *zap.Logger
+	lookup func(host string) ([]string, error)
+
+	mu        sync.Mutex
+	wildcards map[string]map[string]struct{} // base domain -> wildcard addresses
+}
+
+// NewWildcardDetector creates a WildcardDetector that resolves A records
+// through pool. A nil logger disables logging.
+func NewWildcardDetector(pool *ResolverPool, logger *zap.Logger) *WildcardDetector {
+	return newWildcardDetector(logger, func(host string) ([]string, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), pool.timeout*time.Duration(pool.retries+1))
+		defer cancel()
+		return pool.LookupA(ctx, host)
+	})
+}
+
+// newWildcardDetector creates a WildcardDetector that resolves A records with lookup
+func newWildcardDetector(logger *zap.Logger, lookup func(host string) ([]string, error)) *WildcardDetector {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	return &WildcardDetector{
+		logger:    logger,
+		lookup:    lookup,
+		wildcards: make(map[string]map[string]struct{}),
+	}
+}
+
+// IsWildcard reports whether host only resolves to addresses that random
+// names under baseDomain resolve to as well.
+func (wd *WildcardDetector) IsWildcard(host string, baseDomain string) bool {
+	ips, err := wd.lookup(host)
+	if err != nil {
+		wd.logger.Debug("Failed to resolve host", zap.String("host", host), zap.Error(err))
+		return false
+	}
+	if len(ips) == 0 {
+		return false
+	}
+
+	wildcards := wd.domainWildcards(baseDomain)
+	for _, ip := range ips {
+		if _, ok := wildcards[ip]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// domainWildcards returns the wildcard addresses of baseDomain, resolving
+// random names under it the first time the domain is seen.
+func (wd *WildcardDetector) domainWildcards(baseDomain string) map[string]struct{} {
+	wd.mu.Lock()
+	defer wd.mu.Unlock()
+
+	if wildcards, ok := wd.wildcards[baseDomain]; ok {
+		return wildcards
+	}
+
+	wildcards := make(map[string]struct{})
+	for i := 0; i < wildcardProbes; i++ {
+		name := xid.New().String() + "." + baseDomain
+		ips, err := wd.lookup(name)
+		if err != nil {
+			wd.logger.Debug("Failed to resolve random name", zap.String("name", name), zap.Error(err))
+			continue
+		}
+		for _, ip := range ips {
+			wildcards[ip] = struct{}{}
+		}
+	}
+	if len(wildcards) > 0 {
+		wd.logger.Info("Wildcard records detected", zap.String("domain", baseDomain), zap.Int("addresses", len(wildcards)))
+	}
+	wd.wildcards[baseDomain] = wildcards
+	return wildcards
+}
@@ -0,0 +1,456 @@
+package dnsenum
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/miekg/dns"
+	"github.com/rs/xid"
+	"go.uber.org/zap"
+)
+
+// Denial-of-existence schemes reported by ZoneWalk
+const (
+	DenialNone  = "none"
+	DenialNSEC  = "nsec"
+	DenialNSEC3 = "nsec3"
+)
+
+// ZoneWalk holds what the DNSSEC denial-of-existence records of a zone revealed
+type ZoneWalk struct {
+	Zone    string
+	Denial  string      // DenialNone, DenialNSEC or DenialNSEC3
+	Records []DNSRecord // The NSEC/NSEC3 records themselves
+	Names   []string    // Names walked from the NSEC chain
+	NSEC3   *NSEC3Chain // Hashes collected from an NSEC3 zone
+}
+
+// NSEC3Chain collects the hashed owner names of an NSEC3 signed zone together
+// with the parameters needed to crack them offline
+type NSEC3Chain struct {
+	Zone       string
+	Algorithm  uint8
+	Iterations uint16
+	Salt       string            // Hex encoded, empty when the zone uses no salt
+	Hashes     map[string]string // Hash -> cracked name ("" while unknown)
+
+	next   map[string]string // Owner hash -> next hash
+	owners []string          // Sorted owner hashes, rebuilt on change
+}
+
+// NewNSEC3Chain creates an empty chain for zone with the given parameters
+func NewNSEC3Chain(zone string, algorithm uint8, iterations uint16, salt string) *NSEC3Chain {
+	if salt == "-" {
+		salt = ""
+	}
+	return &NSEC3Chain{
+		Zone:       strings.TrimSuffix(strings.ToLower(zone), "."),
+		Algorithm:  algorithm,
+		Iterations: iterations,
+		Salt:       strings.ToUpper(salt),
+		Hashes:     make(map[string]string),
+		next:       make(map[string]string),
+	}
+}
+
+// add records an NSEC3 interval and reports whether it was new
+func (c *NSEC3Chain) add(owner, next string) bool {
+	owner, next = strings.ToUpper(owner), strings.ToUpper(next)
+	if _, ok := c.Hashes[owner]; !ok {
+		c.Hashes[owner] = ""
+	}
+	if _, ok := c.Hashes[next]; !ok {
+		c.Hashes[next] = ""
+	}
+	if _, ok := c.next[owner]; ok {
+		return false
+	}
+	c.next[owner] = next
+	c.owners = append(c.owners, owner)
+	sort.Strings(c.owners)
+	return true
+}
+
+// covered reports whether hash falls into an interval that is already known
+func (c *NSEC3Chain) covered(hash string) bool {
+	if len(c.owners) == 0 {
+		return false
+	}
+	// The interval starting at the greatest owner <= hash, wrapping around
+	i := sort.SearchStrings(c.owners, hash)
+	if i < len(c.owners) && c.owners[i] == hash {
+		return true
+	}
+	i--
+	if i < 0 {
+		i = len(c.owners) - 1
+	}
+	owner := c.owners[i]
+	next := c.next[owner]
+	if owner < next {
+		return hash > owner && hash < next
+	}
+	return hash > owner || hash < next
+}
+
+// Complete reports whether the collected intervals form a closed chain
+func (c *NSEC3Chain) Complete() bool {
+	if len(c.owners) == 0 {
+		return false
+	}
+	start := c.owners[0]
+	current := start
+	for i := 0; i < len(c.owners); i++ {
+		next, ok := c.next[current]
+		if !ok {
+			return false
+		}
+		if next == start {
+			return i == len(c.owners)-1
+		}
+		current = next
+	}
+	return false
+}
+
+// Hash returns the NSEC3 hash of name under the chain's parameters
+func (c *NSEC3Chain) Hash(name string) string {
+	return dns.HashName(dns.Fqdn(name), c.Algorithm, c.Iterations, c.Salt)
+}
+
+// Crack hashes every word as a label of the zone (and the zone apex itself)
+// and records the names whose hash is in the chain. It returns the number of
+// hashes newly cracked.
+func (c *NSEC3Chain) Crack(words []string) int {
+	names := []string{c.Zone}
+	for _, word := range words {
+		word = strings.ToLower(strings.Trim(strings.TrimSpace(word), "."))
+		if word == "" || strings.HasPrefix(word, "#") {
+			continue
+		}
+		names = append(names, word+"."+c.Zone)
+	}
+	return c.CrackNames(names)
+}
+
+// CrackNames is like Crack for fully qualified candidate names
+func (c *NSEC3Chain) CrackNames(names []string) int {
+	cracked := 0
+	for _, name := range names {
+		name = strings.TrimSuffix(strings.ToLower(name), ".")
+		hash := c.Hash(name)
+		if known, ok := c.Hashes[hash]; ok && known == "" {
+			c.Hashes[hash] = name
+			cracked++
+		}
+	}
+	return cracked
+}
+
+// Cracked returns the names recovered so far in sorted order
+func (c *NSEC3Chain) Cracked() []string {
+	var names []string
+	for _, name := range c.Hashes {
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Records returns one NSEC3 DNSRecord per hash, naming the cracked host when
+// known. With crackedOnly the hashes that are still unknown are left out.
+func (c *NSEC3Chain) Records(crackedOnly bool) []DNSRecord {
+	hashes := make([]string, 0, len(c.Hashes))
+	for hash := range c.Hashes {
+		hashes = append(hashes, hash)
+	}
+	sort.Strings(hashes)
+
+	salt := c.Salt
+	if salt == "" {
+		salt = "-"
+	}
+	records := make([]DNSRecord, 0, len(hashes))
+	for _, hash := range hashes {
+		host := c.Hashes[hash]
+		if host == "" {
+			if crackedOnly {
+				continue
+			}
+			host = strings.ToLower(hash) + "." + c.Zone
+		}
+		records = append(records, DNSRecord{
+			Host:   host,
+			Type:   "NSEC3",
+			Value:  fmt.Sprintf("%s %d %d %s", hash, c.Algorithm, c.Iterations, salt),
+			Method: MethodNSEC3,
+		})
+	}
+	return records
+}
+
+// WriteHashes writes the chain in hashcat's NSEC3 format
+// (hash:.zone:salt:iterations), one hash per line
+func (c *NSEC3Chain) WriteHashes(w io.Writer) error {
+	hashes := make([]string, 0, len(c.Hashes))
+	for hash := range c.Hashes {
+		hashes = append(hashes, hash)
+	}
+	sort.Strings(hashes)
+
+	for _, hash := range hashes {
+		if _, err := fmt.Fprintf(w, "%s:.%s:%s:%d\n", strings.ToLower(hash), c.Zone, strings.ToLower(c.Salt), c.Iterations); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReadNSEC3Hashes reads chains written by WriteHashes, one chain per zone
+func ReadNSEC3Hashes(r io.Reader) ([]*NSEC3Chain, error) {
+	chains := make(map[string]*NSEC3Chain)
+	var order []string
+
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		parts := strings.Split(text, ":")
+		if len(parts) != 4 {
+			return nil, fmt.Errorf("line %d: expected hash:.zone:salt:iterations", line)
+		}
+		iterations, err := strconv.ParseUint(parts[3], 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid iterations: %w", line, err)
+		}
+
+		zone := strings.TrimPrefix(parts[1], ".")
+		key := zone + "|" + parts[2] + "|" + parts[3]
+		chain, ok := chains[key]
+		if !ok {
+			chain = NewNSEC3Chain(zone, dns.SHA1, uint16(iterations), parts[2])
+			chains[key] = chain
+			order = append(order, key)
+		}
+		chain.Hashes[strings.ToUpper(parts[0])] = ""
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	out := make([]*NSEC3Chain, 0, len(order))
+	for _, key := range order {
+		out = append(out, chains[key])
+	}
+	return out, nil
+}
+
+// CrackNSEC3File cracks a hash file written by WriteHashes with the words and
+// returns the recovered names as DNSRecords
+func CrackNSEC3File(path string, words []string) ([]DNSRecord, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open hash file: %w", err)
+	}
+	defer file.Close()
+
+	chains, err := ReadNSEC3Hashes(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read hash file: %w", err)
+	}
+
+	var records []DNSRecord
+	for _, chain := range chains {
+		chain.Crack(words)
+		records = append(records, chain.Records(true)...)
+	}
+	return records, nil
+}
+
+// WalkZone enumerates zone through its DNSSEC denial-of-existence records:
+// NSEC chains are followed name by name, NSEC3 hashes are collected by
+// querying names that hash into still unknown intervals.
+func (e *Engine) WalkZone(ctx context.Context, zone string) (*ZoneWalk, error) {
+	zone = strings.TrimSuffix(strings.ToLower(zone), ".")
+	walk := &ZoneWalk{Zone: zone, Denial: DenialNone}
+
+	// A name that cannot exist tells which scheme the zone uses
+	resp, err := e.queryDNSSEC(ctx, xid.New().String()+"."+zone, dns.TypeA)
+	if err != nil {
+		return walk, err
+	}
+	for _, rr := range resp.Ns {
+		switch rr.(type) {
+		case *dns.NSEC:
+			walk.Denial = DenialNSEC
+		case *dns.NSEC3:
+			walk.Denial = DenialNSEC3
+		}
+	}
+
+	switch walk.Denial {
+	case DenialNSEC:
+		err = e.walkNSEC(ctx, walk)
+	case DenialNSEC3:
+		err = e.collectNSEC3(ctx, walk, resp)
+	}
+	e.logger.Info("Zone walk finished",
+		zap.String("zone", zone),
+		zap.String("denial", walk.Denial),
+		zap.Int("names", len(walk.Names)),
+		zap.Int("records", len(walk.Records)))
+	return walk, err
+}
+
+// walkNSEC follows the NSEC chain from the apex until it wraps around
+func (e *Engine) walkNSEC(ctx context.Context, walk *ZoneWalk) error {
+	seen := map[string]struct{}{walk.Zone: {}}
+	current := walk.Zone
+	for i := 0; e.config.MaxZoneWalk <= 0 || i < e.config.MaxZoneWalk; i++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		nsec, err := e.nsecOf(ctx, current)
+		if err != nil {
+			return err
+		}
+		if nsec == nil {
+			e.logger.Debug("NSEC chain broken", zap.String("name", current))
+			return nil
+		}
+		walk.Records = append(walk.Records, recordFromRR(nsec, MethodNSEC))
+
+		next := strings.TrimSuffix(strings.ToLower(nsec.NextDomain), ".")
+		if _, ok := seen[next]; ok || !dns.IsSubDomain(dns.Fqdn(walk.Zone), dns.Fqdn(next)) {
+			return nil
+		}
+		seen[next] = struct{}{}
+		walk.Names = append(walk.Names, next)
+		current = next
+	}
+	return nil
+}
+
+// nsecOf returns the NSEC record owned by name. Servers that do not answer
+// NSEC queries directly still return it as the proof for the name right after.
+func (e *Engine) nsecOf(ctx context.Context, name string) (*dns.NSEC, error) {
+	resp, err := e.queryDNSSEC(ctx, name, dns.TypeNSEC)
+	if err != nil {
+		return nil, err
+	}
+	if nsec := findNSEC(resp.Answer, name); nsec != nil {
+		return nsec, nil
+	}
+
+	resp, err = e.queryDNSSEC(ctx, "\\000."+name, dns.TypeA)
+	if err != nil {
+		return nil, err
+	}
+	return findNSEC(resp.Ns, name), nil
+}
+
+func findNSEC(rrs []dns.RR, owner string) *dns.NSEC {
+	for _, rr := range rrs {
+		if nsec, ok := rr.(*dns.NSEC); ok && strings.EqualFold(strings.TrimSuffix(nsec.Hdr.Name, "."), owner) {
+			return nsec
+		}
+	}
+	return nil
+}
+
+// collectNSEC3 queries names whose hash falls outside the known intervals
+// until the chain closes or the query budget is spent
+func (e *Engine) collectNSEC3(ctx context.Context, walk *ZoneWalk, first *dns.Msg) error {
+	var chain *NSEC3Chain
+	addFrom := func(resp *dns.Msg) bool {
+		added := false
+		for _, rr := range resp.Ns {
+			nsec3, ok := rr.(*dns.NSEC3)
+			if !ok {
+				continue
+			}
+			if chain == nil {
+				chain = NewNSEC3Chain(walk.Zone, nsec3.Hash, nsec3.Iterations, nsec3.Salt)
+			}
+			owner := strings.SplitN(nsec3.Hdr.Name, ".", 2)[0]
+			if chain.add(owner, nsec3.NextDomain) {
+				walk.Records = append(walk.Records, recordFromRR(nsec3, MethodNSEC3))
+				added = true
+			}
+		}
+		return added
+	}
+	addFrom(first)
+	if chain == nil {
+		return nil
+	}
+	walk.NSEC3 = chain
+
+	budget := e.config.MaxZoneWalk
+	if budget <= 0 {
+		budget = DefaultEngineConfig.MaxZoneWalk
+	}
+	for queries := 0; queries < budget && !chain.Complete(); queries++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		// Hash random labels locally until one lands in an unknown gap
+		var name string
+		for tries := 0; tries < 100000; tries++ {
+			candidate := xid.New().String() + "." + walk.Zone
+			if !chain.covered(chain.Hash(candidate)) {
+				name = candidate
+				break
+			}
+		}
+		if name == "" {
+			break
+		}
+
+		resp, err := e.queryDNSSEC(ctx, name, dns.TypeA)
+		if err != nil {
+			return err
+		}
+		addFrom(resp)
+	}
+
+	chain.Crack(e.config.Wordlist)
+	if e.config.Permutations {
+		chain.CrackNames(Permutations(chain.Cracked(), walk.Zone, e.config.PermutationWords, e.config.MaxPermutations))
+	}
+
+	e.mu.Lock()
+	e.chains = append(e.chains, chain)
+	e.mu.Unlock()
+	return nil
+}
+
+// NSEC3Chains returns the NSEC3 chains collected by the engine so far
+func (e *Engine) NSEC3Chains() []*NSEC3Chain {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]*NSEC3Chain(nil), e.chains...)
+}
+
+// queryDNSSEC queries with the DO bit set so denial records are returned
+func (e *Engine) queryDNSSEC(ctx context.Context, name string, qtype uint16) (*dns.Msg, error) {
+	msg := new(dns.Msg)
+	msg.SetQuestion(dns.Fqdn(name), qtype)
+	msg.RecursionDesired = true
+	msg.SetEdns0(4096, true)
+	return e.pool.Exchange(ctx, msg)
+}
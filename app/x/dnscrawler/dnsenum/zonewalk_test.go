@@ -0,0 +1,225 @@
+package dnsenum
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// signedServer serves a one-level zone with NSEC or NSEC3 denial of
+// existence. Signatures are left out since the walker does not validate.
+type signedServer struct {
+	zone   string   // FQDN of the zone
+	labels []string // Child labels, each owning an A record
+	nsec3  bool
+	salt   string
+	iter   uint16
+
+	// directNSEC answers NSEC queries; when false they get an empty answer
+	directNSEC bool
+}
+
+func (s *signedServer) names() []string {
+	names := []string{s.zone}
+	labels := append([]string(nil), s.labels...)
+	sort.Strings(labels)
+	for _, label := range labels {
+		names = append(names, label+"."+s.zone)
+	}
+	return names
+}
+
+func (s *signedServer) nsecFor(i int) dns.RR {
+	names := s.names()
+	next := names[(i+1)%len(names)]
+	rr, _ := dns.NewRR(names[i] + " 300 IN NSEC " + next + " A RRSIG NSEC")
+	return rr
+}
+
+func (s *signedServer) nsec3Chain() []*dns.NSEC3 {
+	var hashes []string
+	for _, name := range s.names() {
+		hashes = append(hashes, dns.HashName(name, dns.SHA1, s.iter, s.salt))
+	}
+	sort.Strings(hashes)
+
+	var chain []*dns.NSEC3
+	for i, hash := range hashes {
+		chain = append(chain, &dns.NSEC3{
+			Hdr:        dns.RR_Header{Name: hash + "." + s.zone, Rrtype: dns.TypeNSEC3, Class: dns.ClassINET, Ttl: 300},
+			Hash:       dns.SHA1,
+			Iterations: s.iter,
+			SaltLength: uint8(len(s.salt) / 2),
+			Salt:       s.salt,
+			HashLength: 20,
+			NextDomain: hashes[(i+1)%len(hashes)],
+			TypeBitMap: []uint16{dns.TypeA},
+		})
+	}
+	return chain
+}
+
+func (s *signedServer) ServeDNS(w dns.ResponseWriter, r *dns.Msg) {
+	q := r.Question[0]
+	name := strings.ToLower(q.Name)
+
+	m := new(dns.Msg)
+	m.SetReply(r)
+	m.Authoritative = true
+
+	names := s.names()
+	index := -1
+	for i, n := range names {
+		if n == name {
+			index = i
+		}
+	}
+
+	if index >= 0 {
+		switch {
+		case q.Qtype == dns.TypeNSEC && !s.nsec3 && s.directNSEC:
+			m.Answer = append(m.Answer, s.nsecFor(index))
+		case q.Qtype == dns.TypeA && index > 0:
+			rr, _ := dns.NewRR(name + " 300 IN A 192.0.2." + string(rune('1'+index)))
+			m.Answer = append(m.Answer, rr)
+		}
+		w.WriteMsg(m)
+		return
+	}
+
+	m.Rcode = dns.RcodeNameError
+	if s.nsec3 {
+		for _, rr := range s.nsec3Chain() {
+			if rr.Cover(name) {
+				m.Ns = append(m.Ns, rr)
+			}
+		}
+	} else {
+		// The closest existing ancestor, or the greatest name sorting before
+		// a missing child of the apex
+		owner := 0
+		for i, n := range names {
+			if i > 0 && (strings.HasSuffix(name, "."+n) || strings.TrimSuffix(name, "."+s.zone) > strings.TrimSuffix(n, "."+s.zone)) {
+				owner = i
+			}
+		}
+		m.Ns = append(m.Ns, s.nsecFor(owner))
+	}
+	w.WriteMsg(m)
+}
+
+func startSignedServer(t *testing.T, handler dns.Handler) string {
+	t.Helper()
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &dns.Server{PacketConn: pc, Handler: handler}
+	go server.ActivateAndServe()
+	t.Cleanup(func() { server.Shutdown() })
+	return pc.LocalAddr().String()
+}
+
+func walkEngine(t *testing.T, addr string, words []string) *Engine {
+	t.Helper()
+	config := DefaultEngineConfig
+	config.Resolvers = []string{addr}
+	config.Timeout = time.Second
+	config.Wordlist = words
+	config.AXFR = false
+	config.Permutations = false
+	engine, err := NewEngine(config, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return engine
+}
+
+func TestWalkZoneNSEC(t *testing.T) {
+	for _, direct := range []bool{true, false} {
+		server := &signedServer{zone: "signed.test.", labels: []string{"www", "mail", "vpn-internal"}, directNSEC: direct}
+		engine := walkEngine(t, startSignedServer(t, server), nil)
+
+		walk, err := engine.WalkZone(context.Background(), "signed.test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if walk.Denial != DenialNSEC {
+			t.Fatalf("denial = %q, want nsec", walk.Denial)
+		}
+		want := []string{"mail.signed.test", "vpn-internal.signed.test", "www.signed.test"}
+		if strings.Join(walk.Names, ",") != strings.Join(want, ",") {
+			t.Errorf("direct=%v: walked %v, want %v", direct, walk.Names, want)
+		}
+
+		records, err := engine.Enumerate(context.Background(), "signed.test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		r, ok := findRecord(records, "vpn-internal.signed.test", "A")
+		if !ok || r.Method != MethodNSEC {
+			t.Errorf("direct=%v: vpn-internal A = %+v, %v; want record found by nsec", direct, r, ok)
+		}
+	}
+}
+
+func TestWalkZoneNSEC3(t *testing.T) {
+	server := &signedServer{zone: "hashed.test.", labels: []string{"www", "mail", "jenkins"}, nsec3: true, salt: "AABBCCDD", iter: 5}
+	engine := walkEngine(t, startSignedServer(t, server), []string{"www", "jenkins", "ftp"})
+
+	walk, err := engine.WalkZone(context.Background(), "hashed.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if walk.Denial != DenialNSEC3 || walk.NSEC3 == nil {
+		t.Fatalf("denial = %q, want nsec3", walk.Denial)
+	}
+
+	chain := walk.NSEC3
+	if !chain.Complete() || len(chain.Hashes) != 4 {
+		t.Fatalf("collected %d hashes (complete=%v), want the full chain of 4", len(chain.Hashes), chain.Complete())
+	}
+	if chain.Iterations != 5 || chain.Salt != "AABBCCDD" {
+		t.Errorf("parameters = %d/%s", chain.Iterations, chain.Salt)
+	}
+	cracked := strings.Join(chain.Cracked(), ",")
+	if cracked != "hashed.test,jenkins.hashed.test,www.hashed.test" {
+		t.Errorf("cracked = %s", cracked)
+	}
+
+	records, err := engine.Enumerate(context.Background(), "hashed.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, ok := findRecord(records, "jenkins.hashed.test", "A")
+	if !ok || r.Method != MethodNSEC3 {
+		t.Errorf("jenkins A = %+v, %v; want record found by nsec3", r, ok)
+	}
+
+	// Round trip through the hash file and crack the rest offline
+	var buf bytes.Buffer
+	if err := chain.WriteHashes(&buf); err != nil {
+		t.Fatal(err)
+	}
+	chains, err := ReadNSEC3Hashes(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chains) != 1 || len(chains[0].Hashes) != 4 {
+		t.Fatalf("read back %d chains", len(chains))
+	}
+	if n := chains[0].Crack([]string{"mail", "smtp"}); n != 2 {
+		t.Errorf("offline crack found %d names, want mail and the apex", n)
+	}
+	for _, r := range chains[0].Records(true) {
+		if r.Method != MethodNSEC3 || r.Type != "NSEC3" {
+			t.Errorf("unexpected record %+v", r)
+		}
+	}
+}
@@ -7,32 +7,64 @@ import (
 )
 
 type Options struct {
-	Domains     []string
-	Resolvers   []string
-	Concurrency int
-	OutputFile  string
+	Domains         []string
+	Resolvers       []string
+	Concurrency     int
+	OutputFile      string
+	ConfigFile      string
+	Wordlist        string
+	RecordTypes     []string
+	Permutations    bool
+	AXFR            bool
+	FilterWildcards bool
+	ZoneWalk        bool
+	NSEC3Out        string // File receiving collected NSEC3 hashes
+	NSEC3Crack      string // Hash file to crack offline instead of crawling
 }
 
-// parseInput parses command-line arguments and validates input
-func parseInput() (*Options, error) {
+// ParseInput parses command-line arguments and validates input
+func ParseInput() (*Options, error) {
 	var domainList, resolvers, outputFile string
+	var configFile, wordlist, recordTypes string
+	var nsec3Out, nsec3Crack string
 	var concurrency int
+	var permutations, axfr, filterWildcards, zoneWalk bool
 
 	flag.StringVar(&domainList, "domains", "", "Comma-separated list of domains to query")
 	flag.StringVar(&resolvers, "resolvers", "", "Comma-separated list of DNS resolvers")
 	flag.StringVar(&outputFile, "output", "results.txt", "File to write results")
 	flag.IntVar(&concurrency, "concurrency", 10, "Number of concurrent queries")
+	flag.StringVar(&configFile, "config", "", "Path to a JSON configuration file")
+	flag.StringVar(&wordlist, "wordlist", "", "File with subdomain labels to brute force")
+	flag.StringVar(&recordTypes, "types", "", "Comma-separated record types to query (default: all common types)")
+	flag.BoolVar(&permutations, "permutations", true, "Resolve permutations of discovered names")
+	flag.BoolVar(&axfr, "axfr", true, "Attempt zone transfers from the authoritative servers")
+	flag.BoolVar(&filterWildcards, "wildcard-filter", true, "Drop names that only resolve to wildcard answers")
+	flag.BoolVar(&zoneWalk, "zonewalk", true, "Walk DNSSEC NSEC/NSEC3 chains of signed zones")
+	flag.StringVar(&nsec3Out, "nsec3-out", "", "File to write collected NSEC3 hashes to (hashcat format)")
+	flag.StringVar(&nsec3Crack, "nsec3-crack", "", "Crack an NSEC3 hash file offline with the wordlist and exit")
 	flag.Parse()
 
-	if domainList == "" {
+	if domainList == "" && nsec3Crack == "" {
 		return nil, fmt.Errorf("no domains provided")
 	}
 
 	options := &Options{
-		Domains:     strings.Split(domainList, ","),
-		Resolvers:   strings.Split(resolvers, ","),
-		Concurrency: concurrency,
-		OutputFile:  outputFile,
+		Domains:         strings.Split(domainList, ","),
+		Resolvers:       strings.Split(resolvers, ","),
+		Concurrency:     concurrency,
+		OutputFile:      outputFile,
+		ConfigFile:      configFile,
+		Wordlist:        wordlist,
+		Permutations:    permutations,
+		AXFR:            axfr,
+		FilterWildcards: filterWildcards,
+		ZoneWalk:        zoneWalk,
+		NSEC3Out:        nsec3Out,
+		NSEC3Crack:      nsec3Crack,
+	}
+	if recordTypes != "" {
+		options.RecordTypes = strings.Split(recordTypes, ",")
 	}
 
 	return options, nil
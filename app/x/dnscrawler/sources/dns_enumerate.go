@@ -242,13 +242,6 @@ func nativeDNSEnumerate(domain string) ([]DNSRecord, error) {
 	return records, nil
 }
 
-// DNSRecord represents a DNS record with host, type, and value.
-type DNSRecord struct {
-	Host  string
-	Type  string
-	Value string
-}
-
 // writeEncryptedResults writes encrypted scan results to the specified file.
 func (dq *DNSQuantum) writeEncryptedResults(outputPath string, encryptedData []string) error {
 	// Ensure the reporting directory exists
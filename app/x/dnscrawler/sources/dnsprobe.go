@@ -34,13 +34,6 @@ type DNSProbe struct {
 	scanResults  []DNSRecord
 }
 
-// DNSRecord represents a DNS record with host, type, and value.
-type DNSRecord struct {
-	Host  string
-	Type  string
-	Value string
-}
-
 // Options defines configuration options for DNSProbe.
 type Options struct {
 	Resolvers    []string
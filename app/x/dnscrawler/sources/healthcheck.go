@@ -18,13 +18,6 @@ const (
 	LogDir = "ghostshell/logging"
 )
 
-// DNSRecord represents a DNS record with host, type, and value.
-type DNSRecord struct {
-	Host  string
-	Type  string
-	Value string
-}
-
 // DoHealthCheck performs a system and network health check using native methods and Zap logger.
 func DoHealthCheck(configFilePath string) string {
 	// Initialize Zap logger
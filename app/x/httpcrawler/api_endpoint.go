@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"net/http"
 	"sync"
+
+	"ghostshell/app/fingerprint"
 )
 
 // APIEndpoint manages the HTTP API server
@@ -16,9 +18,10 @@ type APIEndpoint struct {
 
 // Result represents an HTTP probe result
 type Result struct {
-	URL    string `json:"url"`
-	Status int    `json:"status"`
-	Body   string `json:"body"`
+	URL     string                   `json:"url"`
+	Status  int                      `json:"status"`
+	Body    string                   `json:"body"`
+	Service *fingerprint.ServiceInfo `json:"service,omitempty"`
 }
 
 // NewAPIEndpoint creates a new APIEndpoint instance
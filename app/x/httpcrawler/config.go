@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+
+	"ghostshell/app/filterexpr"
 )
 
 type Config struct {
@@ -11,6 +13,7 @@ type Config struct {
 	Retries   int      `json:"retries"`
 	Timeout   int      `json:"timeout"`
 	UserAgent string   `json:"user_agent"`
+	Filter    string   `json:"filter"` // Expression selecting the results to report
 }
 
 // DefaultConfig provides default settings for the application
@@ -56,5 +59,11 @@ func LoadConfig(filePath string) (*Config, error) {
 		cfg.UserAgent = DefaultConfig.UserAgent
 	}
 
+	if cfg.Filter != "" {
+		if _, err := filterexpr.Compile(cfg.Filter, FilterSchema); err != nil {
+			return nil, fmt.Errorf("invalid filter in config file: %w", err)
+		}
+	}
+
 	return &cfg, nil
 }
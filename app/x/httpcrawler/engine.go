@@ -2,6 +2,7 @@ package httpcrawler
 
 import (
 	"context"
+	"fmt"
 	"sync"
 
 	"go.uber.org/zap"
@@ -12,6 +13,7 @@ type Runner struct {
 	options   *Options
 	config    *Config
 	httpProbe *HTTPProbe
+	filter    *Filter
 	logger    *zap.SugaredLogger
 }
 
@@ -19,6 +21,19 @@ type Runner struct {
 func NewRunner(options *Options, config *Config) (*Runner, error) {
 	httpProbe := NewHTTPProbe(config)
 
+	// The -filter flag takes precedence over the config file
+	expr := options.Filter
+	if expr == "" && config != nil {
+		expr = config.Filter
+	}
+	var filter *Filter
+	if expr != "" {
+		var err error
+		if filter, err = ParseFilter(expr); err != nil {
+			return nil, fmt.Errorf("invalid filter: %w", err)
+		}
+	}
+
 	// Initialize zap logger
 	logger, err := zap.NewProduction()
 	if err != nil {
@@ -30,6 +45,7 @@ func NewRunner(options *Options, config *Config) (*Runner, error) {
 		options:   options,
 		config:    config,
 		httpProbe: httpProbe,
+		filter:    filter,
 		logger:    sugar,
 	}, nil
 }
@@ -52,6 +68,9 @@ func (r *Runner) Run(ctx context.Context) error {
 					r.logger.Errorf("Error probing target %s: %v", target, err)
 					return
 				}
+				if r.filter != nil && !r.filter.Matches(&result) {
+					return
+				}
 				results <- result
 			}(target)
 		}
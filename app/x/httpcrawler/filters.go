@@ -3,13 +3,38 @@ package httpcrawler
 import (
 	"regexp"
 	"strings"
+
+	"ghostshell/app/filterexpr"
 )
 
+// FilterSchema lists the fields available to filter expressions on probe results
+var FilterSchema = filterexpr.Schema{
+	"url":            filterexpr.String,
+	"status":         filterexpr.Int,
+	"body":           filterexpr.String,
+	"content_length": filterexpr.Int,
+	"service":        filterexpr.String,
+	"product":        filterexpr.String,
+	"version":        filterexpr.String,
+	"tls":            filterexpr.Bool,
+}
+
 // Filter represents a filter for HTTP probe results
 type Filter struct {
 	StatusCodes []int
 	Regex       *regexp.Regexp
 	Content     string
+	Expression  *filterexpr.Expr
+}
+
+// ParseFilter compiles a filter expression such as
+// `status in [200..299] && body ~ "(?i)login"` into a Filter
+func ParseFilter(expr string) (*Filter, error) {
+	compiled, err := filterexpr.Compile(expr, FilterSchema)
+	if err != nil {
+		return nil, err
+	}
+	return &Filter{Expression: compiled}, nil
 }
 
 // Matches checks if a result matches the filter criteria
@@ -42,5 +67,27 @@ func (f *Filter) Matches(result *Result) bool {
 		}
 	}
 
+	// Check filter expression
+	if f.Expression != nil && !f.Expression.Match(resultValues(result)) {
+		return false
+	}
+
 	return true
 }
+
+// resultValues exposes a probe result to filter expressions
+func resultValues(result *Result) filterexpr.Values {
+	values := filterexpr.Values{
+		"url":            result.URL,
+		"status":         result.Status,
+		"body":           result.Body,
+		"content_length": len(result.Body),
+	}
+	if result.Service != nil {
+		values["service"] = result.Service.Service
+		values["product"] = result.Service.Product
+		values["version"] = result.Service.Version
+		values["tls"] = result.Service.Tunnel == "ssl"
+	}
+	return values
+}
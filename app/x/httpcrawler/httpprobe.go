@@ -4,13 +4,17 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"net/http/httputil"
 	"time"
+
+	"ghostshell/app/fingerprint"
 )
 
 // HTTPProbe handles HTTP probing for targets
 type HTTPProbe struct {
-	client *http.Client
-	config *Config
+	client      *http.Client
+	config      *Config
+	fingerprint *fingerprint.Engine
 }
 
 // NewHTTPProbe creates a new HTTPProbe instance
@@ -19,8 +23,9 @@ func NewHTTPProbe(config *Config) *HTTPProbe {
 		Timeout: time.Duration(config.Timeout) * time.Second,
 	}
 	return &HTTPProbe{
-		client: client,
-		config: config,
+		client:      client,
+		config:      config,
+		fingerprint: fingerprint.NewEngine(nil, nil),
 	}
 }
 
@@ -40,15 +45,24 @@ func (h *HTTPProbe) Probe(target string) (Result, error) {
 	}
 	defer response.Body.Close()
 
+	head, err := httputil.DumpResponse(response, false)
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to dump response headers: %w", err)
+	}
+
 	body, err := ioutil.ReadAll(response.Body)
 	if err != nil {
 		return Result{}, fmt.Errorf("failed to read response body: %w", err)
 	}
 
 	result := Result{
-		URL:    target,
-		Status: response.StatusCode,
-		Body:   string(body),
+		URL:     target,
+		Status:  response.StatusCode,
+		Body:    string(body),
+		Service: h.fingerprint.MatchResponse("tcp", "GetRequest", append(head, body...)),
+	}
+	if result.Service != nil && response.TLS != nil {
+		result.Service.Tunnel = "ssl"
 	}
 
 	return result, nil
@@ -10,6 +10,7 @@ type Options struct {
 	Targets     []string
 	OutputFile  string
 	Concurrency int
+	Filter      string
 }
 
 // parseInput parses command-line arguments and validates input
@@ -17,10 +18,12 @@ func parseInput() (*Options, error) {
 	var targets string
 	var outputFile string
 	var concurrency int
+	var filter string
 
 	flag.StringVar(&targets, "targets", "", "Comma-separated list of targets to probe")
 	flag.StringVar(&outputFile, "output", "results.txt", "File to write results")
 	flag.IntVar(&concurrency, "concurrency", 10, "Number of concurrent probes")
+	flag.StringVar(&filter, "filter", "", `Only report results matching an expression, e.g. 'status == 200 && body ~ "admin"'`)
 	flag.Parse()
 
 	if targets == "" {
@@ -31,6 +34,7 @@ func parseInput() (*Options, error) {
 		Targets:     strings.Split(targets, ","),
 		OutputFile:  outputFile,
 		Concurrency: concurrency,
+		Filter:      filter,
 	}
 
 	return options, nil
@@ -3,12 +3,15 @@ package httpcrawler
 import (
 	"fmt"
 	"os"
+
+	"ghostshell/app/fingerprint"
 )
 
 type Result struct {
-	URL    string
-	Status int
-	Body   string
+	URL     string
+	Status  int
+	Body    string
+	Service *fingerprint.ServiceInfo
 }
 
 // writeResults writes the results to a file or stdout
@@ -27,7 +30,11 @@ func writeResults(results <-chan Result, outputFile string) error {
 
 	// Write results
 	for result := range results {
-		output := fmt.Sprintf("URL: %s | Status: %d\n", result.URL, result.Status)
+		output := fmt.Sprintf("URL: %s | Status: %d", result.URL, result.Status)
+		if result.Service != nil {
+			output += fmt.Sprintf(" | Service: %s", result.Service)
+		}
+		output += "\n"
 		if file != nil {
 			if _, err := file.WriteString(output); err != nil {
 				return fmt.Errorf("failed to write to output file: %w", err)
@@ -0,0 +1,112 @@
+package subcrawler
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// ActiveConfig configures the active discovery stage
+type ActiveConfig struct {
+	Resolvers     []string
+	Concurrency   int           // Queries in flight
+	Timeout       time.Duration // Per query
+	Retries       int
+	MaxRounds     int // Re-seeding rounds (0 = until nothing new turns up)
+	MaxWords      int // Learned words used for mutations
+	MaxCandidates int // Candidates resolved per round (0 = unlimited)
+}
+
+// DefaultActiveConfig holds the default active stage settings
+var DefaultActiveConfig = ActiveConfig{
+	Resolvers:     []string{"1.1.1.1:53", "8.8.8.8:53", "9.9.9.9:53"},
+	Concurrency:   50,
+	Timeout:       3 * time.Second,
+	Retries:       2,
+	MaxRounds:     5,
+	MaxWords:      50,
+	MaxCandidates: 20000,
+}
+
+// ActiveStats summarizes an active discovery run
+type ActiveStats struct {
+	Rounds     int
+	Candidates int // Names resolved
+	Found      int // New names confirmed
+	Wildcards  int // Answers dropped as wildcard matches
+}
+
+// EnumerateActive mutates the passively found seeds of domain, resolves the
+// candidates and feeds every confirmed name back in until a round finds
+// nothing new. found is called for each new name as it is confirmed.
+func EnumerateActive(ctx context.Context, domain string, seeds []string, config ActiveConfig, found func(Resolution)) (ActiveStats, error) {
+	var stats ActiveStats
+
+	resolver, err := NewResolver(config.Resolvers, config.Concurrency, config.Timeout, config.Retries)
+	if err != nil {
+		return stats, err
+	}
+
+	domain = normalizeName(domain)
+	known := make(map[string]struct{})
+	var names []string
+	for _, seed := range seeds {
+		seed = normalizeName(seed)
+		if _, ok := known[seed]; ok || seed == "" {
+			continue
+		}
+		known[seed] = struct{}{}
+		names = append(names, seed)
+	}
+
+	// Candidates are only resolved once across all rounds
+	tried := make(map[string]struct{})
+	for config.MaxRounds <= 0 || stats.Rounds < config.MaxRounds {
+		if err := ctx.Err(); err != nil {
+			return stats, err
+		}
+
+		tokens := LearnTokens(names, domain)
+		var candidates []string
+		for _, candidate := range Mutate(names, domain, tokens, config.MaxWords, 0) {
+			if _, ok := tried[candidate]; ok {
+				continue
+			}
+			tried[candidate] = struct{}{}
+			candidates = append(candidates, candidate)
+			if config.MaxCandidates > 0 && len(candidates) >= config.MaxCandidates {
+				break
+			}
+		}
+		if len(candidates) == 0 {
+			break
+		}
+
+		stats.Rounds++
+		stats.Candidates += len(candidates)
+		resolved, wildcards := resolver.ResolveAll(ctx, domain, candidates)
+		stats.Wildcards += wildcards
+
+		var fresh int
+		for _, r := range resolved {
+			if _, ok := known[r.Host]; ok {
+				continue
+			}
+			known[r.Host] = struct{}{}
+			names = append(names, r.Host)
+			fresh++
+			if found != nil {
+				found(r)
+			}
+		}
+		stats.Found += fresh
+		if fresh == 0 {
+			break
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		return stats, fmt.Errorf("active enumeration interrupted: %w", err)
+	}
+	return stats, nil
+}
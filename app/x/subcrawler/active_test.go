@@ -0,0 +1,155 @@
+package subcrawler
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// testZone is served by the in-process resolver; every name below
+// cdn.example.test resolves through a wildcard
+var testZone = map[string]string{
+	"api-dev.example.test.": "192.0.2.1",
+	"api-stg.example.test.": "192.0.2.2",
+	"web01.example.test.":   "192.0.2.10",
+	"web02.example.test.":   "192.0.2.11",
+	"web03.example.test.":   "192.0.2.12",
+}
+
+const testWildcardAddr = "198.51.100.7"
+
+func serveTestZone(w dns.ResponseWriter, r *dns.Msg) {
+	q := r.Question[0]
+	name := strings.ToLower(q.Name)
+
+	m := new(dns.Msg)
+	m.SetReply(r)
+	ip, ok := testZone[name]
+	if !ok && strings.HasSuffix(name, ".cdn.example.test.") {
+		ip, ok = testWildcardAddr, true
+	}
+	if !ok {
+		m.Rcode = dns.RcodeNameError
+	} else if q.Qtype == dns.TypeA {
+		rr, _ := dns.NewRR(name + " 60 IN A " + ip)
+		m.Answer = append(m.Answer, rr)
+	}
+	w.WriteMsg(m)
+}
+
+func startTestResolver(t *testing.T) string {
+	t.Helper()
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &dns.Server{PacketConn: pc, Handler: dns.HandlerFunc(serveTestZone)}
+	go server.ActivateAndServe()
+	t.Cleanup(func() { server.Shutdown() })
+	return pc.LocalAddr().String()
+}
+
+func testActiveConfig(addr string) ActiveConfig {
+	config := DefaultActiveConfig
+	config.Resolvers = []string{addr}
+	config.Concurrency = 4
+	config.Timeout = time.Second
+	config.Retries = 0
+	return config
+}
+
+func TestResolver(t *testing.T) {
+	addr := startTestResolver(t)
+	resolver, err := NewResolver([]string{addr}, 4, time.Second, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	ips, err := resolver.Resolve(ctx, "web01.example.test")
+	if err != nil || !reflect.DeepEqual(ips, []string{"192.0.2.10"}) {
+		t.Errorf("Resolve(web01) = %v, %v", ips, err)
+	}
+	if ips, err := resolver.Resolve(ctx, "missing.example.test"); err != nil || ips != nil {
+		t.Errorf("a missing name should resolve to nothing, got %v, %v", ips, err)
+	}
+
+	if resolver.IsWildcard("web01.example.test", "example.test") {
+		t.Error("web01.example.test has its own address")
+	}
+	// The wildcard is found at any level between the host and the domain
+	if !resolver.IsWildcard("a.b.cdn.example.test", "example.test") {
+		t.Error("a.b.cdn.example.test is a wildcard answer")
+	}
+	if resolver.IsWildcard("web01.other.test", "example.test") {
+		t.Error("names outside the domain are never wildcards")
+	}
+
+	resolved, wildcards := resolver.ResolveAll(ctx, "example.test", []string{
+		"web02.example.test", "missing.example.test", "img.cdn.example.test", "api-stg.example.test",
+	})
+	want := []Resolution{
+		{Host: "api-stg.example.test", IPs: []string{"192.0.2.2"}},
+		{Host: "web02.example.test", IPs: []string{"192.0.2.11"}},
+	}
+	if !reflect.DeepEqual(resolved, want) || wildcards != 1 {
+		t.Errorf("ResolveAll = %v with %d wildcards", resolved, wildcards)
+	}
+
+	if _, err := NewResolver(nil, 1, time.Second, 0); err == nil {
+		t.Error("expected an empty resolver list to fail")
+	}
+}
+
+func TestEnumerateActiveRounds(t *testing.T) {
+	addr := startTestResolver(t)
+	seeds := []string{"API-Dev.example.test.", "web01.example.test", "img.cdn.example.test"}
+
+	var found []string
+	config := testActiveConfig(addr)
+	config.MaxRounds = 0
+	stats, err := EnumerateActive(context.Background(), "example.test", seeds, config, func(r Resolution) {
+		found = append(found, r.Host)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// web03 is only a neighbour of web02, which the first round confirms
+	want := []string{"api-stg.example.test", "web02.example.test", "web03.example.test"}
+	if !reflect.DeepEqual(found, want) {
+		t.Errorf("found %v, want %v", found, want)
+	}
+	if stats.Rounds != 3 || stats.Found != 3 || stats.Wildcards == 0 || stats.Candidates == 0 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+
+	// A single round stops before the re-seeded names are tried
+	found = nil
+	config.MaxRounds = 1
+	stats, err = EnumerateActive(context.Background(), "example.test", seeds, config, func(r Resolution) {
+		found = append(found, r.Host)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Rounds != 1 || !reflect.DeepEqual(found, want[:2]) {
+		t.Errorf("one round found %v with %+v", found, stats)
+	}
+}
+
+func TestEnumerateActiveCancelled(t *testing.T) {
+	addr := startTestResolver(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := EnumerateActive(ctx, "example.test", []string{"web01.example.test"}, testActiveConfig(addr), nil)
+	if err == nil {
+		t.Error("expected a cancelled context to stop the enumeration")
+	}
+}
@@ -19,9 +19,9 @@ import (
 	"go.uber.org/zap/zapcore"
 	"golang.org/x/exp/rand"
 
+	"ghostshell/app/x/subcrawler"
+
 	// Hypothetical references to your local modules
-	"ghostshell/app_suite/subcrawler/options"
-	"ghostshell/app_suite/subcrawler/output"
 	"ghostshell/app_suite/subcrawler/passive"
 
 	// Post-quantum placeholders
@@ -104,15 +104,28 @@ func updateParticles(ps []*Particle) {
 
 // -------------- Concurrency Subdomain Enumeration --------------
 
-func enumerateAllSources(options *options.Options, sources []passive.Source, results chan<- string) error {
+func enumerateAllSources(ctx context.Context, options *subcrawler.Options, sources []passive.Source, results chan<- string) error {
 	var wg sync.WaitGroup
+	defer close(results)
+
+	// Passive results are forwarded and kept as seeds for the active stage
+	passiveResults := make(chan string, 1000)
+	var seeds []string
+	forwarded := make(chan struct{})
+	go func() {
+		defer close(forwarded)
+		for r := range passiveResults {
+			seeds = append(seeds, r)
+			results <- r
+		}
+	}()
 
 	for _, src := range sources {
 		wg.Add(1)
 		go func(s passive.Source) {
 			defer wg.Done()
 			logger.Info("Enumerating source", zap.String("source", s.Name()))
-			if err := s.Enumerate(options.Domain, results); err != nil {
+			if err := s.Enumerate(options.Domain, passiveResults); err != nil {
 				logger.Warn("Error enumerating source", zap.String("source", s.Name()), zap.Error(err))
 			}
 		}(src)
@@ -120,7 +133,24 @@ func enumerateAllSources(options *options.Options, sources []passive.Source, res
 
 	// Wait for all
 	wg.Wait()
-	close(results)
+	close(passiveResults)
+	<-forwarded
+
+	if !options.Active {
+		return nil
+	}
+	logger.Info("Starting active enumeration", zap.String("domain", options.Domain), zap.Int("seeds", len(seeds)))
+	stats, err := subcrawler.EnumerateActive(ctx, options.Domain, seeds, options.ActiveConfig(), func(r subcrawler.Resolution) {
+		results <- r.Host
+	})
+	logger.Info("Active enumeration finished",
+		zap.Int("rounds", stats.Rounds),
+		zap.Int("candidates", stats.Candidates),
+		zap.Int("found", stats.Found),
+		zap.Int("wildcards", stats.Wildcards))
+	if err != nil {
+		return fmt.Errorf("active enumeration failed: %w", err)
+	}
 	return nil
 }
 
@@ -185,7 +215,7 @@ func main() {
 	logger.Info("Subcrawler starting...")
 
 	// 2) Parse options
-	opts, err := options.ParseOptions()
+	opts, err := subcrawler.ParseOptions()
 	if err != nil {
 		logger.Fatal("Error parsing options", zap.Error(err))
 	}
@@ -218,10 +248,17 @@ func main() {
 		logger.Fatal("Error initializing sources", zap.Error(err))
 	}
 
+	mainCtx, mainCancel := context.WithCancel(context.Background())
+	if opts.CTLogs {
+		ct := subcrawler.NewCTLogSource(opts.Checkpoints)
+		ct.Context = mainCtx
+		sources = append(sources, ct)
+	}
+
 	// concurrency scanning
 	resultsChan := make(chan string, 1000)
 	go func() {
-		if err := enumerateAllSources(opts, sources, resultsChan); err != nil {
+		if err := enumerateAllSources(mainCtx, opts, sources, resultsChan); err != nil {
 			logger.Warn("Error enumerating sources", zap.Error(err))
 		}
 	}()
@@ -240,8 +277,6 @@ func main() {
 	doneChan := make(chan os.Signal, 1)
 	signal.Notify(doneChan, os.Interrupt, syscall.SIGTERM)
 
-	mainCtx, mainCancel := context.WithCancel(context.Background())
-
 	// 7) Main loop
 	for !rl.WindowShouldClose() && mainCtx.Err() == nil {
 		select {
@@ -284,8 +319,8 @@ func main() {
 	}
 
 	// 8) Save final results
-	if err := output.SaveResults(uniqueResults, opts.OutputFile, reportDir); err != nil {
-		logger.Error("Error saving results with output package", zap.Error(err))
+	if err := subcrawler.SaveResults(uniqueResults, opts.OutputFile); err != nil {
+		logger.Error("Error saving results", zap.Error(err))
 	}
 
 	// 9) Generate CSV/PDF
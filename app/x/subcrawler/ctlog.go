@@ -0,0 +1,51 @@
+package subcrawler
+
+import (
+	"context"
+
+	"ghostshell/app/ctlog"
+)
+
+// CTLogSource is a PassiveSource reading Certificate Transparency logs
+// directly. Checkpoints make repeated runs read only new log entries.
+type CTLogSource struct {
+	Config         ctlog.Config
+	CheckpointFile string
+	Context        context.Context
+}
+
+// NewCTLogSource creates a CTLogSource over the default logs
+func NewCTLogSource(checkpointFile string) *CTLogSource {
+	return &CTLogSource{
+		Config:         ctlog.DefaultConfig,
+		CheckpointFile: checkpointFile,
+		Context:        context.Background(),
+	}
+}
+
+// Name returns the name of the source
+func (s *CTLogSource) Name() string {
+	return "ctlog"
+}
+
+// Enumerate sends the names below domain found in the logs to results
+func (s *CTLogSource) Enumerate(domain string, results chan<- string) error {
+	ctx := s.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	checkpoints, err := ctlog.LoadCheckpoints(s.CheckpointFile)
+	if err != nil {
+		return err
+	}
+	scanner, err := ctlog.NewScanner(s.Config, checkpoints)
+	if err != nil {
+		return err
+	}
+
+	_, err = scanner.Scan(ctx, []string{domain}, func(m ctlog.Match) {
+		results <- m.Name
+	})
+	return err
+}
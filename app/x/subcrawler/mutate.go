@@ -0,0 +1,257 @@
+package subcrawler
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+
+	"ghostshell/app/x/dnscrawler/dnsenum"
+)
+
+// EnvironmentLabels are the deployment stages swapped into each other when
+// one of them shows up in a discovered name
+var EnvironmentLabels = []string{
+	"dev", "development", "test", "qa", "uat", "stg", "stage", "staging",
+	"preprod", "prod", "production", "sandbox", "demo",
+}
+
+// Tokens are the building blocks learned from known subdomains
+type Tokens struct {
+	Words        map[string]int // Word frequency, numbers stripped
+	Numbers      map[string]int // Numbers seen, zero padding kept
+	Environments map[string]int // Words that are environment labels
+}
+
+// LearnTokens splits the labels of names below domain into words and numbers.
+// "api-dev2.eu" yields the words api, dev and eu, the number 2 and the
+// environment dev.
+func LearnTokens(names []string, domain string) *Tokens {
+	domain = normalizeName(domain)
+	envs := make(map[string]bool, len(EnvironmentLabels))
+	for _, env := range EnvironmentLabels {
+		envs[env] = true
+	}
+
+	t := &Tokens{
+		Words:        make(map[string]int),
+		Numbers:      make(map[string]int),
+		Environments: make(map[string]int),
+	}
+	for _, name := range names {
+		name = normalizeName(name)
+		if !strings.HasSuffix(name, "."+domain) {
+			continue
+		}
+		for _, label := range strings.Split(strings.TrimSuffix(name, "."+domain), ".") {
+			if label == "*" {
+				continue
+			}
+			for _, part := range strings.FieldsFunc(label, func(r rune) bool { return r == '-' || r == '_' }) {
+				word, number := splitNumber(part)
+				if number != "" {
+					t.Numbers[number]++
+				}
+				if len(word) < 2 {
+					continue
+				}
+				t.Words[word]++
+				if envs[word] {
+					t.Environments[word]++
+				}
+			}
+		}
+	}
+	return t
+}
+
+// TopWords returns at most n words, most frequent first
+func (t *Tokens) TopWords(n int) []string {
+	return topKeys(t.Words, n)
+}
+
+// TopNumbers returns at most n numbers, most frequent first
+func (t *Tokens) TopNumbers(n int) []string {
+	return topKeys(t.Numbers, n)
+}
+
+// topKeys returns the keys of counts ordered by count, then alphabetically
+func topKeys(counts map[string]int, n int) []string {
+	keys := make([]string, 0, len(counts))
+	for key := range counts {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if counts[keys[i]] != counts[keys[j]] {
+			return counts[keys[i]] > counts[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	if n > 0 && len(keys) > n {
+		keys = keys[:n]
+	}
+	return keys
+}
+
+// Mutate generates candidate names from the known names and the learned
+// tokens: environment labels are swapped for each other ("api-dev" ->
+// "api-stg"), words are swapped for other learned words ("api-dev" ->
+// "vpn-dev"), numbers for other learned numbers ("web01" -> "web07") and the
+// learned words are combined with every name and its numbers counted up and
+// down. Known names are never returned and at most
+// limit candidates are generated (0 means no limit).
+func Mutate(names []string, domain string, tokens *Tokens, maxWords, limit int) []string {
+	domain = normalizeName(domain)
+	suffix := "." + domain
+
+	seen := make(map[string]struct{}, len(names))
+	for _, name := range names {
+		seen[normalizeName(name)] = struct{}{}
+	}
+
+	var out []string
+	add := func(candidate string) bool {
+		if _, ok := seen[candidate]; !ok && validName(candidate, suffix) {
+			seen[candidate] = struct{}{}
+			out = append(out, candidate)
+		}
+		return limit <= 0 || len(out) < limit
+	}
+
+	words := tokens.TopWords(maxWords)
+	numbers := tokens.TopNumbers(maxWords)
+	envs := environments(tokens)
+
+	sorted := append([]string(nil), names...)
+	sort.Strings(sorted)
+
+	for _, name := range sorted {
+		name = normalizeName(name)
+		if !strings.HasSuffix(name, suffix) || strings.HasPrefix(name, "*.") {
+			continue
+		}
+		sub := strings.TrimSuffix(name, suffix)
+
+		for _, word := range wordsOf(sub) {
+			isEnv := Contains(envs, word)
+			replacements := words
+			if isEnv {
+				replacements = envs
+			}
+			for _, other := range replacements {
+				// Environments are only swapped with each other
+				if other == word || !isEnv && Contains(envs, other) {
+					continue
+				}
+				if !add(replaceToken(sub, word, other, false) + suffix) {
+					return out
+				}
+			}
+		}
+		for _, number := range numbersOf(sub) {
+			for _, other := range numbers {
+				if other == number {
+					continue
+				}
+				if !add(replaceToken(sub, number, other, true) + suffix) {
+					return out
+				}
+			}
+		}
+	}
+
+	// Combinations with the learned words and number neighbours
+	mixins := append(append([]string(nil), words...), envs...)
+	for _, candidate := range dnsenum.Permutations(names, domain, mixins, 0) {
+		if !add(candidate) {
+			return out
+		}
+	}
+	return out
+}
+
+// environments returns the learned environment labels, completed with the
+// usual ones once any environment has been seen
+func environments(tokens *Tokens) []string {
+	if len(tokens.Environments) == 0 {
+		return nil
+	}
+	envs := []string{"dev", "stg", "staging", "test", "qa", "uat", "prod"}
+	for env := range tokens.Environments {
+		if !Contains(envs, env) {
+			envs = append(envs, env)
+		}
+	}
+	sort.Strings(envs)
+	return envs
+}
+
+// wordsOf returns the distinct words of the labels in sub
+func wordsOf(sub string) []string {
+	var words []string
+	for _, part := range strings.FieldsFunc(sub, func(r rune) bool { return r == '.' || r == '-' || r == '_' }) {
+		if word, _ := splitNumber(part); len(word) >= 2 && !Contains(words, word) {
+			words = append(words, word)
+		}
+	}
+	return words
+}
+
+// numbersOf returns the distinct trailing numbers of the tokens in sub
+func numbersOf(sub string) []string {
+	var numbers []string
+	for _, part := range strings.FieldsFunc(sub, func(r rune) bool { return r == '.' || r == '-' || r == '_' }) {
+		if _, number := splitNumber(part); number != "" && !Contains(numbers, number) {
+			numbers = append(numbers, number)
+		}
+	}
+	return numbers
+}
+
+// replaceToken replaces the word (or with number set, the trailing number) of
+// every token of sub that matches old
+func replaceToken(sub, old, new string, number bool) string {
+	var b strings.Builder
+	token := func(s string) {
+		w, n := splitNumber(s)
+		switch {
+		case !number && w == old:
+			s = new + n
+		case number && n == old:
+			s = w + new
+		}
+		b.WriteString(s)
+	}
+
+	start := 0
+	for i := 0; i < len(sub); i++ {
+		if c := sub[i]; c == '.' || c == '-' || c == '_' {
+			token(sub[start:i])
+			b.WriteByte(c)
+			start = i + 1
+		}
+	}
+	token(sub[start:])
+	return b.String()
+}
+
+// splitNumber splits a trailing number off s: "web01" -> "web", "01"
+func splitNumber(s string) (string, string) {
+	i := len(s)
+	for i > 0 && unicode.IsDigit(rune(s[i-1])) {
+		i--
+	}
+	return s[:i], s[i:]
+}
+
+// validName reports whether candidate is a hostname below suffix
+func validName(candidate, suffix string) bool {
+	if !strings.HasSuffix(candidate, suffix) || len(candidate) > 253 {
+		return false
+	}
+	for _, label := range strings.Split(strings.TrimSuffix(candidate, suffix), ".") {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+	}
+	return true
+}
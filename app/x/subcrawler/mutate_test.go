@@ -0,0 +1,89 @@
+package subcrawler
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLearnTokens(t *testing.T) {
+	tokens := LearnTokens([]string{
+		"api-dev2.eu.example.test",
+		"API-prod.example.test.",
+		"web01.example.test",
+		"*.cdn.example.test",
+		"other.test",
+	}, "example.test")
+
+	wantWords := map[string]int{"api": 2, "dev": 1, "eu": 1, "prod": 1, "web": 1, "cdn": 1}
+	if !reflect.DeepEqual(tokens.Words, wantWords) {
+		t.Errorf("got words %v, want %v", tokens.Words, wantWords)
+	}
+	if !reflect.DeepEqual(tokens.Numbers, map[string]int{"2": 1, "01": 1}) {
+		t.Errorf("got numbers %v", tokens.Numbers)
+	}
+	if !reflect.DeepEqual(tokens.Environments, map[string]int{"dev": 1, "prod": 1}) {
+		t.Errorf("got environments %v", tokens.Environments)
+	}
+	if got := tokens.TopWords(2); !reflect.DeepEqual(got, []string{"api", "cdn"}) {
+		t.Errorf("TopWords(2) = %v", got)
+	}
+}
+
+func TestMutate(t *testing.T) {
+	names := []string{"api-dev.example.test", "vpn.example.test", "web01.example.test"}
+	candidates := Mutate(names, "example.test", LearnTokens(names, "example.test"), 10, 0)
+
+	got := make(map[string]bool, len(candidates))
+	for _, c := range candidates {
+		if got[c] {
+			t.Errorf("%s generated twice", c)
+		}
+		got[c] = true
+	}
+
+	for _, want := range []string{
+		"api-stg.example.test",   // environments are swapped for each other
+		"api-prod.example.test",  // and completed with the usual ones
+		"vpn-dev.example.test",   // words are swapped for other learned words
+		"web00.example.test",     // numbers are counted up and down
+		"web02.example.test",     // keeping their padding
+		"dev.vpn.example.test",   // learned words are prepended as labels
+		"web01-api.example.test", // and joined to the first label
+	} {
+		if !got[want] {
+			t.Errorf("expected candidate %s", want)
+		}
+	}
+	for _, unwanted := range []string{
+		"api-dev.example.test", // known names are never returned
+		"stg.example.test",     // plain words are not swapped for environments
+		"vpn.example.test",
+	} {
+		if got[unwanted] {
+			t.Errorf("unexpected candidate %s", unwanted)
+		}
+	}
+
+	if limited := Mutate(names, "example.test", LearnTokens(names, "example.test"), 10, 5); !reflect.DeepEqual(limited, candidates[:5]) {
+		t.Errorf("limit 5 returned %v, want %v", limited, candidates[:5])
+	}
+}
+
+func TestReplaceToken(t *testing.T) {
+	tests := []struct {
+		sub, old, new string
+		number        bool
+		want          string
+	}{
+		{"api-dev.eu", "dev", "stg", false, "api-stg.eu"},
+		{"dev2-api", "dev", "qa", false, "qa2-api"},
+		{"web01.web", "web", "app", false, "app01.app"},
+		{"web01-db01", "01", "07", true, "web07-db07"},
+		{"development", "dev", "qa", false, "development"},
+	}
+	for _, tt := range tests {
+		if got := replaceToken(tt.sub, tt.old, tt.new, tt.number); got != tt.want {
+			t.Errorf("replaceToken(%q, %q, %q) = %q, want %q", tt.sub, tt.old, tt.new, got, tt.want)
+		}
+	}
+}
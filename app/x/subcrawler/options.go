@@ -3,14 +3,21 @@ package subcrawler
 import (
 	"flag"
 	"fmt"
+	"strings"
 )
 
 // Options represents the user-provided options for Subcrawler
 // Includes domain, output file, and other settings
 type Options struct {
-	Domain     string
-	OutputFile string
-	Verbose    bool
+	Domain      string
+	OutputFile  string
+	Verbose     bool
+	Active      bool     // Run the permutation stage after passive enumeration
+	Resolvers   []string // Resolvers used by the active stage
+	Concurrency int      // Queries in flight during the active stage
+	MaxRounds   int      // Re-seeding rounds of the active stage
+	CTLogs      bool     // Read Certificate Transparency logs as a passive source
+	Checkpoints string   // File keeping the position reached in each CT log
 }
 
 // ParseOptions parses command-line arguments and returns an Options instance
@@ -18,19 +25,54 @@ func ParseOptions() (*Options, error) {
 	var domain string
 	var outputFile string
 	var verbose bool
+	var active, ctLogs bool
+	var checkpoints string
+	var resolvers string
+	var concurrency, maxRounds int
 
 	flag.StringVar(&domain, "domain", "", "Domain to enumerate subdomains for")
 	flag.StringVar(&outputFile, "output", "", "File to save results")
 	flag.BoolVar(&verbose, "verbose", false, "Enable verbose logging")
+	flag.BoolVar(&active, "active", false, "Resolve permutations of the passively found subdomains")
+	flag.StringVar(&resolvers, "resolvers", "", "Comma-separated list of DNS resolvers for the active stage")
+	flag.IntVar(&concurrency, "concurrency", DefaultActiveConfig.Concurrency, "Number of concurrent DNS queries in the active stage")
+	flag.BoolVar(&ctLogs, "ct", false, "Read Certificate Transparency logs directly")
+	flag.StringVar(&checkpoints, "ct-checkpoints", "ghostshell/ctlog/subcrawler_checkpoints.json", "File keeping the position reached in each CT log")
+	flag.IntVar(&maxRounds, "rounds", DefaultActiveConfig.MaxRounds, "Maximum re-seeding rounds of the active stage (0 = until nothing new is found)")
 	flag.Parse()
 
 	if domain == "" {
 		return nil, fmt.Errorf("domain is required")
 	}
 
-	return &Options{
-		Domain:     domain,
-		OutputFile: outputFile,
-		Verbose:    verbose,
-	}, nil
+	options := &Options{
+		Domain:      domain,
+		OutputFile:  outputFile,
+		Verbose:     verbose,
+		Active:      active,
+		Concurrency: concurrency,
+		MaxRounds:   maxRounds,
+		CTLogs:      ctLogs,
+		Checkpoints: checkpoints,
+	}
+	for _, r := range strings.Split(resolvers, ",") {
+		if r = strings.TrimSpace(r); r != "" {
+			options.Resolvers = append(options.Resolvers, r)
+		}
+	}
+
+	return options, nil
+}
+
+// ActiveConfig returns the active stage settings selected by the options
+func (o *Options) ActiveConfig() ActiveConfig {
+	config := DefaultActiveConfig
+	if len(o.Resolvers) > 0 {
+		config.Resolvers = o.Resolvers
+	}
+	if o.Concurrency > 0 {
+		config.Concurrency = o.Concurrency
+	}
+	config.MaxRounds = o.MaxRounds
+	return config
 }
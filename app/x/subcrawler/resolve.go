@@ -1,9 +1,127 @@
 package subcrawler
 
-// Resolver handles DNS resolution and wildcard detection
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"ghostshell/app/x/dnscrawler/dnsenum"
+	"github.com/miekg/dns"
+)
+
+// Resolver handles DNS resolution and wildcard detection over the dnscrawler
+// resolver pool
 
 type Resolver struct {
 	Resolvers []string
+
+	pool        *dnsenum.ResolverPool
+	wildcard    *dnsenum.WildcardDetector
+	concurrency int
+}
+
+// Resolution is a name confirmed by the resolver
+type Resolution struct {
+	Host string
+	IPs  []string
 }
 
-// NewResolve  and return validation  input-policy cache-Manager abstraction  		func
+// NewResolver creates a Resolver that runs at most concurrency queries at once
+// over the given resolvers.
+func NewResolver(resolvers []string, concurrency int, timeout time.Duration, retries int) (*Resolver, error) {
+	pool, err := dnsenum.NewResolverPool(resolvers, timeout, retries)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create resolver pool: %w", err)
+	}
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	return &Resolver{
+		Resolvers:   pool.Resolvers(),
+		pool:        pool,
+		wildcard:    dnsenum.NewWildcardDetector(pool, nil),
+		concurrency: concurrency,
+	}, nil
+}
+
+// Resolve returns the IPv4 addresses of host. A name that does not exist or
+// has no addresses returns no error and no addresses.
+func (r *Resolver) Resolve(ctx context.Context, host string) ([]string, error) {
+	resp, err := r.pool.Query(ctx, host, dns.TypeA)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Rcode != dns.RcodeSuccess {
+		return nil, nil
+	}
+
+	var ips []string
+	for _, rr := range resp.Answer {
+		if a, ok := rr.(*dns.A); ok {
+			ips = append(ips, a.A.String())
+		}
+	}
+	sort.Strings(ips)
+	return ips, nil
+}
+
+// IsWildcard reports whether host could be a wildcard answer at any level
+// between host and domain.
+func (r *Resolver) IsWildcard(host, domain string) bool {
+	host = normalizeName(host)
+	domain = normalizeName(domain)
+	if !strings.HasSuffix(host, "."+domain) {
+		return false
+	}
+
+	labels := strings.Split(strings.TrimSuffix(host, "."+domain), ".")
+	for i := 1; i <= len(labels); i++ {
+		parent := domain
+		if i < len(labels) {
+			parent = strings.Join(labels[i:], ".") + "." + domain
+		}
+		if r.wildcard.IsWildcard(host, parent) {
+			return true
+		}
+	}
+	return false
+}
+
+// ResolveAll resolves names below domain with at most the resolver's
+// concurrency in flight. Names that do not resolve or only return wildcard
+// answers are left out; the number of wildcard answers is returned as well.
+func (r *Resolver) ResolveAll(ctx context.Context, domain string, names []string) ([]Resolution, int) {
+	var (
+		mu         sync.Mutex
+		resolved   []Resolution
+		suppressed int
+	)
+
+	dnsenum.ForEach(ctx, names, r.concurrency, func(name string) {
+		ips, err := r.Resolve(ctx, name)
+		if err != nil || len(ips) == 0 {
+			return
+		}
+		if r.IsWildcard(name, domain) {
+			mu.Lock()
+			suppressed++
+			mu.Unlock()
+			return
+		}
+		mu.Lock()
+		resolved = append(resolved, Resolution{Host: name, IPs: ips})
+		mu.Unlock()
+	})
+
+	sort.Slice(resolved, func(i, j int) bool { return resolved[i].Host < resolved[j].Host })
+	return resolved, suppressed
+}
+
+// normalizeName lower-cases name and strips the trailing dot
+func normalizeName(name string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(name)), ".")
+}
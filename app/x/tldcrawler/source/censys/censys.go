@@ -7,8 +7,9 @@ import (
 
 	jsoniter "github.com/json-iterator/go"
 
+	"ghostshell/app/httpcache"
+	"ghostshell/app/x/tldcrawler/source"
 	"github.com/projectdiscovery/tldfinder/pkg/session"
-	"github.com/projectdiscovery/tldfinder/pkg/source"
 	"github.com/projectdiscovery/tldfinder/pkg/utils"
 	urlutil "github.com/projectdiscovery/utils/url"
 )
@@ -60,6 +61,7 @@ type Source struct {
 	errors    int
 	results   int
 	skipped   bool
+	cacheHits *httpcache.Hits
 }
 
 type apiKey struct {
@@ -71,6 +73,7 @@ func (s *Source) Run(ctx context.Context, query string, sess *session.Session) <
 	results := make(chan source.Result)
 	s.errors = 0
 	s.results = 0
+	ctx, s.cacheHits = httpcache.WithProvider(ctx, s.Name())
 
 	go func() {
 		defer func(startTime time.Time) {
@@ -177,6 +180,7 @@ func (s *Source) Statistics() source.Statistics {
 	return source.Statistics{
 		Errors:    s.errors,
 		Results:   s.results,
+		CacheHits: s.cacheHits.Count(),
 		TimeTaken: s.timeTaken,
 		Skipped:   s.skipped,
 	}
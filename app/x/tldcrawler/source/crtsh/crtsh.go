@@ -13,8 +13,9 @@ import (
 	jsoniter "github.com/json-iterator/go"
 	_ "github.com/lib/pq"
 
+	"ghostshell/app/httpcache"
+	"ghostshell/app/x/tldcrawler/source"
 	"github.com/projectdiscovery/tldfinder/pkg/session"
-	"github.com/projectdiscovery/tldfinder/pkg/source"
 	contextutil "github.com/projectdiscovery/utils/context"
 )
 
@@ -24,12 +25,14 @@ type Source struct {
 	timeTaken time.Duration
 	errors    int
 	results   int
+	cacheHits *httpcache.Hits
 }
 
 func (s *Source) Run(ctx context.Context, query string, sess *session.Session) <-chan source.Result {
 	results := make(chan source.Result)
 	s.errors = 0
 	s.results = 0
+	ctx, s.cacheHits = httpcache.WithProvider(ctx, s.Name())
 
 	go func() {
 		defer func(startTime time.Time) {
@@ -196,6 +199,7 @@ func (s *Source) Statistics() source.Statistics {
 	return source.Statistics{
 		Errors:    s.errors,
 		Results:   s.results,
+		CacheHits: s.cacheHits.Count(),
 		TimeTaken: s.timeTaken,
 	}
 }
@@ -0,0 +1,96 @@
+package ctlog
+
+import (
+	"context"
+	"time"
+
+	"ghostshell/app/ctlog"
+	"ghostshell/app/x/tldcrawler/source"
+	"github.com/projectdiscovery/tldfinder/pkg/session"
+)
+
+// CheckpointFile keeps the position reached in each log between runs
+var CheckpointFile = "ghostshell/ctlog/tldcrawler_checkpoints.json"
+
+// Source reads Certificate Transparency logs directly instead of going
+// through the crt.sh API. The zero value uses ctlog.DefaultConfig.
+type Source struct {
+	Config ctlog.Config
+
+	timeTaken time.Duration
+	errors    int
+	results   int
+}
+
+func (s *Source) Run(ctx context.Context, query string, _ *session.Session) <-chan source.Result {
+	results := make(chan source.Result)
+	s.errors = 0
+	s.results = 0
+
+	go func() {
+		defer func(startTime time.Time) {
+			s.timeTaken = time.Since(startTime)
+			close(results)
+		}(time.Now())
+
+		config := s.Config
+		if len(config.Logs) == 0 {
+			config = ctlog.DefaultConfig
+		}
+		checkpoints, err := ctlog.LoadCheckpoints(CheckpointFile)
+		if err != nil {
+			results <- source.Result{Source: s.Name(), Type: source.Error, Error: err}
+			s.errors++
+			return
+		}
+		scanner, err := ctlog.NewScanner(config, checkpoints)
+		if err != nil {
+			results <- source.Result{Source: s.Name(), Type: source.Error, Error: err}
+			s.errors++
+			return
+		}
+
+		_, err = scanner.Scan(ctx, []string{query}, func(m ctlog.Match) {
+			results <- source.Result{Source: s.Name(), Type: source.Domain, Value: m.Name}
+			s.results++
+		})
+		if err != nil {
+			results <- source.Result{Source: s.Name(), Type: source.Error, Error: err}
+			s.errors++
+		}
+	}()
+
+	return results
+}
+
+func (s *Source) Name() string {
+	return "ctlog"
+}
+
+func (s *Source) IsDefault() bool {
+	return false
+}
+
+func (s *Source) SupportedDiscoveryModes() []source.DiscoveryMode {
+	return []source.DiscoveryMode{source.DNSMode}
+}
+
+func (s *Source) DiscoveryType() source.DiscoveryType {
+	return source.Passive
+}
+
+func (s *Source) NeedsKey() bool {
+	return false
+}
+
+func (s *Source) AddApiKeys(_ []string) {
+	// no key needed
+}
+
+func (s *Source) Statistics() source.Statistics {
+	return source.Statistics{
+		Errors:    s.errors,
+		Results:   s.results,
+		TimeTaken: s.timeTaken,
+	}
+}
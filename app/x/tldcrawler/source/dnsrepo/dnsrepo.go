@@ -8,8 +8,9 @@ import (
 	"strings"
 	"time"
 
+	"ghostshell/app/httpcache"
+	"ghostshell/app/x/tldcrawler/source"
 	"github.com/projectdiscovery/tldfinder/pkg/session"
-	"github.com/projectdiscovery/tldfinder/pkg/source"
 	"github.com/projectdiscovery/tldfinder/pkg/utils"
 )
 
@@ -19,6 +20,7 @@ type Source struct {
 	errors    int
 	results   int
 	skipped   bool
+	cacheHits *httpcache.Hits
 }
 
 type DnsRepoResponse []struct {
@@ -29,6 +31,7 @@ func (s *Source) Run(ctx context.Context, query string, sess *session.Session) <
 	results := make(chan source.Result)
 	s.errors = 0
 	s.results = 0
+	ctx, s.cacheHits = httpcache.WithProvider(ctx, s.Name())
 
 	go func() {
 		defer func(startTime time.Time) {
@@ -104,6 +107,7 @@ func (s *Source) Statistics() source.Statistics {
 	return source.Statistics{
 		Errors:    s.errors,
 		Results:   s.results,
+		CacheHits: s.cacheHits.Count(),
 		TimeTaken: s.timeTaken,
 		Skipped:   s.skipped,
 	}
@@ -5,11 +5,12 @@ import (
 	"math"
 	"time"
 
+	"ghostshell/app/httpcache"
+	"ghostshell/app/x/tldcrawler/source"
 	"github.com/miekg/dns"
 	"github.com/projectdiscovery/dnsx/libs/dnsx"
 	"github.com/projectdiscovery/tldfinder/pkg/registry"
 	"github.com/projectdiscovery/tldfinder/pkg/session"
-	"github.com/projectdiscovery/tldfinder/pkg/source"
 	syncutil "github.com/projectdiscovery/utils/sync"
 )
 
@@ -21,12 +22,14 @@ type Source struct {
 	errors    int
 	results   int
 	skipped   bool
+	cacheHits *httpcache.Hits
 }
 
 func (s *Source) Run(ctx context.Context, query string, sess *session.Session) <-chan source.Result {
 	results := make(chan source.Result)
 	s.errors = 0
 	s.results = 0
+	ctx, s.cacheHits = httpcache.WithProvider(ctx, s.Name())
 
 	go func() {
 		defer func(startTime time.Time) {
@@ -115,6 +118,7 @@ func (s *Source) Statistics() source.Statistics {
 	return source.Statistics{
 		Errors:    s.errors,
 		Results:   s.results,
+		CacheHits: s.cacheHits.Count(),
 		TimeTaken: s.timeTaken,
 		Skipped:   s.skipped,
 	}
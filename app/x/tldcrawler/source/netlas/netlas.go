@@ -11,8 +11,9 @@ import (
 	"strconv"
 	"time"
 
+	"ghostshell/app/httpcache"
+	"ghostshell/app/x/tldcrawler/source"
 	"github.com/projectdiscovery/tldfinder/pkg/session"
-	"github.com/projectdiscovery/tldfinder/pkg/source"
 	"github.com/projectdiscovery/tldfinder/pkg/utils"
 )
 
@@ -46,12 +47,14 @@ type Source struct {
 	errors    int
 	results   int
 	skipped   bool
+	cacheHits *httpcache.Hits
 }
 
 func (s *Source) Run(ctx context.Context, query string, sess *session.Session) <-chan source.Result {
 	results := make(chan source.Result)
 	s.errors = 0
 	s.results = 0
+	ctx, s.cacheHits = httpcache.WithProvider(ctx, s.Name())
 
 	go func() {
 		defer func(startTime time.Time) {
@@ -183,6 +186,7 @@ func (s *Source) Statistics() source.Statistics {
 	return source.Statistics{
 		Errors:    s.errors,
 		Results:   s.results,
+		CacheHits: s.cacheHits.Count(),
 		TimeTaken: s.timeTaken,
 		Skipped:   s.skipped,
 	}
@@ -3,6 +3,7 @@ package source
 import (
 	"context"
 
+	"ghostshell/app/httpcache"
 	"github.com/projectdiscovery/tldfinder/pkg/session"
 )
 
@@ -51,3 +52,9 @@ const (
 	Active DiscoveryType = iota
 	Passive
 )
+
+// UseCache routes the requests of sess through cache. Sources tag their
+// requests with httpcache.WithProvider, so hits show up in Statistics.
+func UseCache(sess *session.Session, cache *httpcache.Cache) {
+	cache.Wrap(sess.Client.HTTPClient)
+}
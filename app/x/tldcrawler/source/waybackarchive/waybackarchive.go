@@ -7,8 +7,9 @@ import (
 	"net/url"
 	"time"
 
+	"ghostshell/app/httpcache"
+	"ghostshell/app/x/tldcrawler/source"
 	"github.com/projectdiscovery/tldfinder/pkg/session"
-	"github.com/projectdiscovery/tldfinder/pkg/source"
 	urlutil "github.com/projectdiscovery/utils/url"
 )
 
@@ -16,12 +17,14 @@ type Source struct {
 	timeTaken time.Duration
 	errors    int
 	results   int
+	cacheHits *httpcache.Hits
 }
 
 func (s *Source) Run(ctx context.Context, query string, sess *session.Session) <-chan source.Result {
 	results := make(chan source.Result)
 	s.errors = 0
 	s.results = 0
+	ctx, s.cacheHits = httpcache.WithProvider(ctx, s.Name())
 
 	go func() {
 		defer func(startTime time.Time) {
@@ -96,6 +99,7 @@ func (s *Source) Statistics() source.Statistics {
 	return source.Statistics{
 		Errors:    s.errors,
 		Results:   s.results,
+		CacheHits: s.cacheHits.Count(),
 		TimeTaken: s.timeTaken,
 	}
 }
@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"encoding/csv"
+	"errors"
 	"flag"
 	"fmt"
 	"net"
@@ -16,9 +17,27 @@ import (
 	"time"
 
 	"github.com/jung-kurt/gofpdf"
+	"github.com/projectdiscovery/ratelimit"
+	"github.com/projectdiscovery/tldfinder/pkg/session"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 
+	"ghostshell/app/apikeys"
+	"ghostshell/app/apikeys/keyfile"
+	"ghostshell/app/ctlog"
+	"ghostshell/app/httpcache"
+	"ghostshell/app/x/tldcrawler/source"
+	"ghostshell/app/x/tldcrawler/source/bufferover"
+	"ghostshell/app/x/tldcrawler/source/censys"
+	"ghostshell/app/x/tldcrawler/source/crtsh"
+	ctlogsource "ghostshell/app/x/tldcrawler/source/ctlog"
+	"ghostshell/app/x/tldcrawler/source/dnsrepo"
+	dnsx "ghostshell/app/x/tldcrawler/source/dnsx"
+	"ghostshell/app/x/tldcrawler/source/netlas"
+	"ghostshell/app/x/tldcrawler/source/waybackarchive"
+	"ghostshell/app/x/tldcrawler/source/whoisxmlapi"
+	"ghostshell/app/x/tldcrawler/source/whoxy"
+
 	// Post-quantum ephemeral references (Assumed to be implemented)
 	"ghostshell/oqs/oqs_vault"
 )
@@ -34,6 +53,52 @@ const (
 	MaxConcurrency = 100 // Number of concurrent workers for scanning
 )
 
+// passiveSources are the sources a domain can be looked up in
+var passiveSources = []source.Source{
+	&bufferover.Source{},
+	&censys.Source{},
+	&crtsh.Source{},
+	&ctlogsource.Source{},
+	&dnsrepo.Source{},
+	&dnsx.Source{},
+	&netlas.Source{},
+	&waybackarchive.Source{},
+	&whoisxmlapi.Source{},
+	&whoxy.Source{},
+}
+
+// sourceByName returns the registered source called name, or nil
+func sourceByName(name string) source.Source {
+	for _, s := range passiveSources {
+		if s.Name() == name {
+			return s
+		}
+	}
+	return nil
+}
+
+// configureKeys hands the API keys stored in path to the sources that need
+// them. Without a master key the sources run without keys.
+func (app *Application) configureKeys(path string) {
+	manager, err := keyfile.Open(path, app.Logger)
+	if errors.Is(err, keyfile.ErrNoMasterKey) {
+		app.Logger.Info("API key file not loaded", zap.String("reason", err.Error()))
+		return
+	}
+	if err != nil {
+		app.Logger.Warn("Failed to load API keys", zap.String("file", path), zap.Error(err))
+		return
+	}
+
+	keyed := make([]apikeys.KeyedSource, len(passiveSources))
+	for i, s := range passiveSources {
+		keyed[i] = s
+	}
+	if missing := manager.Configure(keyed...); len(missing) > 0 {
+		app.Logger.Info("Sources without an API key", zap.Strings("sources", missing))
+	}
+}
+
 // PortStatus represents the status of a port.
 type PortStatus struct {
 	Port       int
@@ -312,6 +377,119 @@ func (app *Application) EnumerateDomains(ctx context.Context, baseDomain string,
 	return nil
 }
 
+// IngestCTLogs adds the names below baseDomain found by the ctlog source.
+// Progress per log is kept in checkpointFile so that later runs only read new
+// entries.
+func (app *Application) IngestCTLogs(ctx context.Context, baseDomain string, logs []string, checkpointFile string) error {
+	app.Logger.Info("Starting CT log ingestion", zap.String("baseDomain", baseDomain), zap.Strings("logs", logs))
+
+	src, ok := sourceByName("ctlog").(*ctlogsource.Source)
+	if !ok {
+		return fmt.Errorf("ctlog source is not registered")
+	}
+	ctlogsource.CheckpointFile = checkpointFile
+	src.Config = ctlog.DefaultConfig
+	if len(logs) > 0 {
+		src.Config.Logs = logs
+	}
+
+	var errs []error
+	for result := range src.Run(ctx, baseDomain, nil) {
+		switch result.Type {
+		case source.Domain:
+			app.EnumeratedMux.Lock()
+			app.Enumerated[result.Value] = true
+			app.EnumeratedMux.Unlock()
+			app.Logger.Debug("Name found in CT log", zap.String("name", result.Value))
+		case source.Error:
+			errs = append(errs, result.Error)
+		}
+	}
+	stats := src.Statistics()
+	app.Logger.Info("CT log ingestion completed",
+		zap.Int("matches", stats.Results),
+		zap.Int("errors", stats.Errors),
+		zap.Duration("timeTaken", stats.TimeTaken),
+	)
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to read CT logs: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// QueryPassiveSources adds the names below baseDomain known to the passive
+// sources. The CT logs are left to IngestCTLogs. Requests go through cache,
+// so repeated runs don't spend API quota.
+func (app *Application) QueryPassiveSources(ctx context.Context, baseDomain string, cache *httpcache.Cache) error {
+	app.Logger.Info("Starting passive source lookup", zap.String("baseDomain", baseDomain))
+
+	limiter, err := ratelimit.NewMultiLimiter(ctx, &ratelimit.Options{Key: "default", IsUnlimited: true})
+	if err != nil {
+		return fmt.Errorf("failed to create rate limiter: %w", err)
+	}
+	var sources []source.Source
+	for _, s := range passiveSources {
+		if s.Name() == "ctlog" {
+			continue
+		}
+		if err := limiter.Add(&ratelimit.Options{Key: s.Name(), IsUnlimited: true}); err != nil {
+			return fmt.Errorf("failed to add rate limit for %s: %w", s.Name(), err)
+		}
+		sources = append(sources, s)
+	}
+
+	sess, err := session.NewSession(baseDomain, "", limiter, 30)
+	if err != nil {
+		return fmt.Errorf("failed to create session: %w", err)
+	}
+	source.UseCache(sess, cache)
+
+	var wg sync.WaitGroup
+	for _, s := range sources {
+		wg.Add(1)
+		go func(s source.Source) {
+			defer wg.Done()
+			for result := range s.Run(ctx, baseDomain, sess) {
+				switch result.Type {
+				case source.Domain:
+					app.EnumeratedMux.Lock()
+					app.Enumerated[result.Value] = true
+					app.EnumeratedMux.Unlock()
+				case source.Error:
+					app.Logger.Warn("Passive source error", zap.String("source", s.Name()), zap.Error(result.Error))
+				}
+			}
+			stats := s.Statistics()
+			app.Logger.Info("Passive source completed",
+				zap.String("source", s.Name()),
+				zap.Bool("skipped", stats.Skipped),
+				zap.Int("results", stats.Results),
+				zap.Int("errors", stats.Errors),
+				zap.Int("cacheHits", stats.CacheHits),
+				zap.Duration("timeTaken", stats.TimeTaken),
+			)
+		}(s)
+	}
+	wg.Wait()
+	return nil
+}
+
+// openCache creates the HTTP response cache selected by -cache
+func openCache(mode, dir string) (*httpcache.Cache, error) {
+	m, err := httpcache.ParseMode(mode)
+	if err != nil {
+		return nil, err
+	}
+	config := httpcache.DefaultConfig
+	config.Mode = m
+	config.Dir = dir
+	cache, err := httpcache.New(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open HTTP cache: %w", err)
+	}
+	return cache, nil
+}
+
 // generateWordlist generates a simple list of subdomains for enumeration.
 // In practice, use a comprehensive wordlist or integrate with a subdomain enumeration tool.
 func generateWordlist() []string {
@@ -438,6 +616,13 @@ func main() {
 	startPort := flag.Int("start-port", 1, "Start port for port scanning")
 	endPort := flag.Int("end-port", 1024, "End port for port scanning")
 	protocol := flag.String("protocol", "tcp", "Protocol for port scanning (tcp/udp)")
+	ctLogs := flag.Bool("ct", false, "Ingest names from Certificate Transparency logs")
+	ctLogList := flag.String("ct-logs", "", "Comma-separated CT log URLs (default: built-in list)")
+	ctCheckpoints := flag.String("ct-checkpoints", "ghostshell/ctlog/tldcrawler_checkpoints.json", "File keeping the position reached in each CT log")
+	keysFile := flag.String("keys", keyfile.DefaultFile, "Encrypted API key file for the sources (needs "+keyfile.MasterKeyEnv+")")
+	passive := flag.Bool("passive", false, "Look the domain up in the passive sources")
+	cacheMode := flag.String("cache", "off", "HTTP response cache for the passive sources: off, cache, record or replay")
+	cacheDir := flag.String("cache-dir", httpcache.DefaultConfig.Dir, "Directory of the HTTP response cache")
 	flag.Parse()
 
 	if *baseDomain == "" {
@@ -446,6 +631,14 @@ func main() {
 		os.Exit(1)
 	}
 
+	app.configureKeys(*keysFile)
+
+	cache, err := openCache(*cacheMode, *cacheDir)
+	if err != nil {
+		app.Logger.Error("Invalid cache settings", zap.Error(err))
+		os.Exit(1)
+	}
+
 	// Generate wordlist for subdomain enumeration
 	wordlist := generateWordlist()
 
@@ -460,6 +653,26 @@ func main() {
 		}
 	}()
 
+	if *passive {
+		if err := app.QueryPassiveSources(ctx, *baseDomain, cache); err != nil {
+			app.Logger.Error("Error during passive source lookup", zap.Error(err))
+		}
+	}
+
+	// Certificate Transparency runs alongside the enumeration and is waited
+	// for, since it usually takes longer than the wordlist
+	if *ctLogs {
+		var logs []string
+		for _, l := range strings.Split(*ctLogList, ",") {
+			if l = strings.TrimSpace(l); l != "" {
+				logs = append(logs, l)
+			}
+		}
+		if err := app.IngestCTLogs(ctx, *baseDomain, logs, *ctCheckpoints); err != nil {
+			app.Logger.Error("Error during CT log ingestion", zap.Error(err))
+		}
+	}
+
 	// Start port scanning after enumeration is done
 	// For simplicity, wait for enumeration to finish (could be optimized)
 	time.Sleep(2 * time.Second) // Replace with proper synchronization
@@ -4,12 +4,15 @@ import (
 	"net/http"
 	"sync"
 	"time"
+
+	"ghostshell/app/httpcache"
 )
 
 // Session provides an HTTP client with shared settings for reuse across sources.
 type Session struct {
 	Client *http.Client
 	Once   sync.Once
+	Cache  *httpcache.Cache // Set through UseCache
 }
 
 var defaultSession *Session
@@ -26,3 +29,9 @@ func GetDefaultSession() *Session {
 	}
 	return defaultSession
 }
+
+// UseCache routes the session requests through cache
+func (s *Session) UseCache(cache *httpcache.Cache) {
+	s.Cache = cache
+	cache.Wrap(s.Client)
+}
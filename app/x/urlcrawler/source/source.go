@@ -3,6 +3,7 @@ package source
 import (
 	"context"
 
+	"ghostshell/app/httpcache"
 	"github.com/projectdiscovery/urlfinder/pkg/session"
 )
 
@@ -28,3 +29,9 @@ type Source interface {
 	// Statistics returns the scrapping statistics for the source
 	Statistics() Statistics
 }
+
+// UseCache routes the requests of sess through cache. Sources tag their
+// requests with httpcache.WithProvider, so hits show up in Statistics.
+func UseCache(sess *session.Session, cache *httpcache.Cache) {
+	cache.Wrap(sess.Client.HTTPClient)
+}
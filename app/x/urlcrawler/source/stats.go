@@ -7,5 +7,6 @@ type Statistics struct {
 	TimeTaken time.Duration
 	Errors    int
 	Results   int
+	CacheHits int // Requests answered from the response cache
 	Skipped   bool
 }
@@ -7,9 +7,10 @@ import (
 	"strconv"
 	"time"
 
+	"ghostshell/app/httpcache"
+	"ghostshell/app/x/urlcrawler/source"
 	jsoniter "github.com/json-iterator/go"
 	"github.com/projectdiscovery/urlfinder/pkg/session"
-	"github.com/projectdiscovery/urlfinder/pkg/source"
 	"github.com/projectdiscovery/urlfinder/pkg/utils"
 	urlutil "github.com/projectdiscovery/utils/url"
 )
@@ -33,12 +34,14 @@ type Source struct {
 	timeTaken time.Duration
 	errors    int
 	results   int
+	cacheHits *httpcache.Hits
 }
 
 func (s *Source) Run(ctx context.Context, rootUrl string, sess *session.Session) <-chan source.Result {
 	results := make(chan source.Result)
 	s.errors = 0
 	s.results = 0
+	ctx, s.cacheHits = httpcache.WithProvider(ctx, s.Name())
 
 	go func() {
 		defer func(startTime time.Time) {
@@ -130,6 +133,7 @@ func (s *Source) Statistics() source.Statistics {
 	return source.Statistics{
 		Errors:    s.errors,
 		Results:   s.results,
+		CacheHits: s.cacheHits.Count(),
 		TimeTaken: s.timeTaken,
 	}
 }
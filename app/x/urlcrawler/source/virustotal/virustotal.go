@@ -6,8 +6,9 @@ import (
 	"fmt"
 	"time"
 
+	"ghostshell/app/httpcache"
+	"ghostshell/app/x/urlcrawler/source"
 	"github.com/projectdiscovery/urlfinder/pkg/session"
-	"github.com/projectdiscovery/urlfinder/pkg/source"
 	"github.com/projectdiscovery/urlfinder/pkg/utils"
 )
 
@@ -24,12 +25,14 @@ type Source struct {
 	timeTaken time.Duration
 	errors    int
 	results   int
+	cacheHits *httpcache.Hits
 }
 
 func (s *Source) Run(ctx context.Context, rootUrl string, sess *session.Session) <-chan source.Result {
 	results := make(chan source.Result)
 	s.errors = 0
 	s.results = 0
+	ctx, s.cacheHits = httpcache.WithProvider(ctx, s.Name())
 
 	go func() {
 		defer func(startTime time.Time) {
@@ -108,6 +111,7 @@ func (s *Source) Statistics() source.Statistics {
 	return source.Statistics{
 		Errors:    s.errors,
 		Results:   s.results,
+		CacheHits: s.cacheHits.Count(),
 		TimeTaken: s.timeTaken,
 	}
 }
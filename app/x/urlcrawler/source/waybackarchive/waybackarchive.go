@@ -8,20 +8,23 @@ import (
 	"strings"
 	"time"
 
+	"ghostshell/app/httpcache"
+	"ghostshell/app/x/urlcrawler/source"
 	"github.com/projectdiscovery/urlfinder/pkg/session"
-	"github.com/projectdiscovery/urlfinder/pkg/source"
 )
 
 type Source struct {
 	timeTaken time.Duration
 	errors    int
 	results   int
+	cacheHits *httpcache.Hits
 }
 
 func (s *Source) Run(ctx context.Context, rootUrl string, sess *session.Session) <-chan source.Result {
 	results := make(chan source.Result)
 	s.errors = 0
 	s.results = 0
+	ctx, s.cacheHits = httpcache.WithProvider(ctx, s.Name())
 
 	go func() {
 		defer func(startTime time.Time) {
@@ -83,6 +86,7 @@ func (s *Source) Statistics() source.Statistics {
 	return source.Statistics{
 		Errors:    s.errors,
 		Results:   s.results,
+		CacheHits: s.cacheHits.Count(),
 		TimeTaken: s.timeTaken,
 	}
 }
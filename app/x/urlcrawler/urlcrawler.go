@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"os"
@@ -14,14 +15,27 @@ import (
 
 	rl "github.com/gen2brain/raylib-go/raylib"
 	"github.com/jung-kurt/gofpdf"
+	"github.com/projectdiscovery/ratelimit"
+	urlsession "github.com/projectdiscovery/urlfinder/pkg/session"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 
+	"ghostshell/app/apikeys"
+	"ghostshell/app/apikeys/keyfile"
+	"ghostshell/app/httpcache"
+	"ghostshell/app/x/urlcrawler/source"
+	"ghostshell/app/x/urlcrawler/source/alienvault"
+	"ghostshell/app/x/urlcrawler/source/commoncrawl"
+	"ghostshell/app/x/urlcrawler/source/urlscan"
+	"ghostshell/app/x/urlcrawler/source/virustotal"
+	"ghostshell/app/x/urlcrawler/source/waybackarchive"
+
 	// Hypothetical references to local modules
 	"ghostshell/urlcrawler/config"
 	"ghostshell/urlcrawler/input"
 	"ghostshell/urlcrawler/output"
 	"ghostshell/urlcrawler/runner"
+	"ghostshell/urlcrawler/session"
 
 	// Post-quantum ephemeral placeholders
 	"ghostshell/oqs/oqs_vault"
@@ -38,6 +52,37 @@ const (
 
 var logger *zap.Logger
 
+// passiveSources are the sources URLs are collected from
+var passiveSources = []source.Source{
+	&alienvault.Source{},
+	&commoncrawl.Source{},
+	&urlscan.Source{},
+	&virustotal.Source{},
+	&waybackarchive.Source{},
+}
+
+// configureKeys hands the API keys stored in path to the sources that need
+// them. Without a master key the sources run without keys.
+func configureKeys(path string) {
+	manager, err := keyfile.Open(path, logger)
+	if errors.Is(err, keyfile.ErrNoMasterKey) {
+		logger.Info("API key file not loaded", zap.String("reason", err.Error()))
+		return
+	}
+	if err != nil {
+		logger.Warn("Failed to load API keys", zap.String("file", path), zap.Error(err))
+		return
+	}
+
+	keyed := make([]apikeys.KeyedSource, len(passiveSources))
+	for i, s := range passiveSources {
+		keyed[i] = s
+	}
+	if missing := manager.Configure(keyed...); len(missing) > 0 {
+		logger.Info("Sources without an API key", zap.Strings("sources", missing))
+	}
+}
+
 // -------------- Logging Setup --------------
 
 func setupLogger() (*zap.Logger, error) {
@@ -100,10 +145,11 @@ type Application struct {
 	InputHandler *input.Handler
 	OutputWriter *output.Writer
 	Runner       *runner.Runner
+	Cache        *httpcache.Cache
 	Logger       *zap.Logger
 }
 
-func NewApplication(configPath string) (*Application, error) {
+func NewApplication(configPath, keysFile string, cache *httpcache.Cache) (*Application, error) {
 	lg, err := setupLogger()
 	if err != nil {
 		return nil, fmt.Errorf("failed to initialize logger: %w", err)
@@ -116,6 +162,9 @@ func NewApplication(configPath string) (*Application, error) {
 	}
 
 	logger.Info("Initializing URL crawler...")
+	configureKeys(keysFile)
+	// The runner fetches through the default session
+	session.GetDefaultSession().UseCache(cache)
 
 	// Load config
 	cfg, err := config.LoadConfig(configPath)
@@ -141,6 +190,7 @@ func NewApplication(configPath string) (*Application, error) {
 		InputHandler: inp,
 		OutputWriter: out,
 		Runner:       rnr,
+		Cache:        cache,
 		Logger:       logger,
 	}, nil
 }
@@ -192,6 +242,74 @@ func (app *Application) Start(ctx context.Context) error {
 	return nil
 }
 
+// CollectURLs gathers the URLs the passive sources know for domain. Requests
+// go through the application cache, so repeated runs don't spend API quota.
+func (app *Application) CollectURLs(ctx context.Context, domain string) (map[string]bool, error) {
+	limiter, err := ratelimit.NewMultiLimiter(ctx, &ratelimit.Options{Key: "default", IsUnlimited: true})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create rate limiter: %w", err)
+	}
+	for _, s := range passiveSources {
+		if err := limiter.Add(&ratelimit.Options{Key: s.Name(), IsUnlimited: true}); err != nil {
+			return nil, fmt.Errorf("failed to add rate limit for %s: %w", s.Name(), err)
+		}
+	}
+	sess, err := urlsession.NewSession("", limiter, 30)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create session: %w", err)
+	}
+	source.UseCache(sess, app.Cache)
+
+	var (
+		wg sync.WaitGroup
+		mu sync.Mutex
+	)
+	found := make(map[string]bool)
+	for _, s := range passiveSources {
+		wg.Add(1)
+		go func(s source.Source) {
+			defer wg.Done()
+			for result := range s.Run(ctx, domain, sess) {
+				switch result.Type {
+				case source.Url:
+					mu.Lock()
+					found[result.Value] = true
+					mu.Unlock()
+				case source.Error:
+					app.Logger.Warn("Source error", zap.String("source", s.Name()), zap.Error(result.Error))
+				}
+			}
+			stats := s.Statistics()
+			app.Logger.Info("Source completed",
+				zap.String("source", s.Name()),
+				zap.Bool("skipped", stats.Skipped),
+				zap.Int("results", stats.Results),
+				zap.Int("errors", stats.Errors),
+				zap.Int("cacheHits", stats.CacheHits),
+				zap.Duration("timeTaken", stats.TimeTaken),
+			)
+		}(s)
+	}
+	wg.Wait()
+	return found, nil
+}
+
+// openCache creates the HTTP response cache selected by -cache
+func openCache(mode, dir string) (*httpcache.Cache, error) {
+	m, err := httpcache.ParseMode(mode)
+	if err != nil {
+		return nil, err
+	}
+	config := httpcache.DefaultConfig
+	config.Mode = m
+	config.Dir = dir
+	cache, err := httpcache.New(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open HTTP cache: %w", err)
+	}
+	return cache, nil
+}
+
 // generateReports as CSV/PDF or other
 func generateReports(app *Application, enumerated map[string]bool) error {
 	// Time-stamped files
@@ -229,14 +347,24 @@ func generateReports(app *Application, enumerated map[string]bool) error {
 }
 
 func main() {
-	var configPath string
+	var configPath, keysFile, domain, cacheMode, cacheDir string
 	flag.StringVar(&configPath, "config", "config.yaml", "Path to config file")
+	flag.StringVar(&keysFile, "keys", keyfile.DefaultFile, "Encrypted API key file for the sources (needs "+keyfile.MasterKeyEnv+")")
+	flag.StringVar(&domain, "domain", "", "Domain to collect known URLs for from the passive sources")
+	flag.StringVar(&cacheMode, "cache", "off", "HTTP response cache: off, cache, record or replay")
+	flag.StringVar(&cacheDir, "cache-dir", httpcache.DefaultConfig.Dir, "Directory of the HTTP response cache")
 	flag.Parse()
 
+	cache, err := openCache(cacheMode, cacheDir)
+	if err != nil {
+		fmt.Printf("Error opening cache: %v\n", err)
+		os.Exit(1)
+	}
+
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	app, err := NewApplication(configPath)
+	app, err := NewApplication(configPath, keysFile, cache)
 	if err != nil {
 		fmt.Printf("Error initializing app: %v\n", err)
 		os.Exit(1)
@@ -265,6 +393,14 @@ func main() {
 		"https://example.com": true,
 		"https://another.org": true,
 	}
+	if domain != "" {
+		found, err := app.CollectURLs(ctx, domain)
+		if err != nil {
+			app.Logger.Error("Failed to collect URLs", zap.Error(err))
+		} else {
+			enumerated = found
+		}
+	}
 
 	// Finally generate CSV/PDF
 	if err := generateReports(app, enumerated); err != nil {
@@ -5,6 +5,8 @@ import (
 	"os"
 
 	"gopkg.in/yaml.v3"
+
+	"ghostshell/app/filterexpr"
 )
 
 type Config struct {
@@ -13,6 +15,7 @@ type Config struct {
 	UserAgent    string   `yaml:"user_agent"`
 	MaxDepth     int      `yaml:"max_depth"`
 	OutputFormat string   `yaml:"output_format"`
+	Filter       string   `yaml:"filter"` // Expression selecting the URLs to report
 }
 
 // LoadConfig loads and parses a YAML configuration file
@@ -47,5 +50,11 @@ func LoadConfig(filePath string) (*Config, error) {
 		config.OutputFormat = "json" // Default output format
 	}
 
+	if config.Filter != "" {
+		if _, err := filterexpr.Compile(config.Filter, filterexpr.URLSchema); err != nil {
+			return nil, fmt.Errorf("invalid filter in config file: %w", err)
+		}
+	}
+
 	return &config, nil
 }
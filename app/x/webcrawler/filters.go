@@ -1,39 +1,33 @@
 package webcrawler
 
 import (
-	"regexp"
+	"ghostshell/app/filterexpr"
 )
 
-// Filter defines criteria for filtering crawl results
+// Filter selects the crawled URLs to report with an expression over
+// filterexpr.URLSchema, e.g. `host == "example.com" && ext != "png"`
 type Filter struct {
-	IncludePatterns []string
-	ExcludePatterns []string
-	MaxDepth        int
+	filterexpr.URLFilter
+	MaxDepth int
 }
 
-// Matches checks if a URL matches the include/exclude patterns
-func (f *Filter) Matches(url string, depth int) bool {
-	if depth > f.MaxDepth {
-		return false
+// ParseFilter compiles a filter expression into a Filter limited to maxDepth.
+// A maxDepth of 0 leaves the depth unbounded.
+func ParseFilter(expr string, maxDepth int) (*Filter, error) {
+	f := &Filter{MaxDepth: maxDepth}
+	if err := f.SetExpression(expr); err != nil {
+		return nil, err
 	}
+	return f, nil
+}
 
-	// Check exclude patterns
-	for _, pattern := range f.ExcludePatterns {
-		if matched, _ := regexp.MatchString(pattern, url); matched {
-			return false
-		}
+// Matches checks if a URL found at the given depth should be reported
+func (f *Filter) Matches(url string, depth int) bool {
+	if f == nil {
+		return true
 	}
-
-	// Check include patterns
-	if len(f.IncludePatterns) > 0 {
-		for _, pattern := range f.IncludePatterns {
-			if matched, _ := regexp.MatchString(pattern, url); matched {
-				return true
-			}
-		}
+	if f.MaxDepth > 0 && depth > f.MaxDepth {
 		return false
 	}
-
-	// Default to true if no include patterns are specified
-	return true
+	return f.MatchURL(url, depth)
 }
@@ -20,6 +20,8 @@ import (
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 
+	"ghostshell/app/filterexpr"
+
 	// Hypothetical references for your local modules
 
 	// Post-quantum ephemeral placeholders
@@ -110,6 +112,7 @@ type Options struct {
 	ConfigFile  string
 	Targets     []string
 	Concurrency int
+	Filter      filterexpr.URLFilter // -filter, selecting the URLs to report
 }
 
 func loadConfig(path string) (*Config, error) {
@@ -121,9 +124,11 @@ func parseInput() (*Options, error) {
 	var cfgFile string
 	var concurrency int
 	var targetsStr string
+	var filter string
 	flag.StringVar(&cfgFile, "config", "webcrawler_config.yaml", "Path to config file")
 	flag.IntVar(&concurrency, "concurrency", 5, "Number of concurrency workers")
 	flag.StringVar(&targetsStr, "targets", "https://example.com,https://test.com", "Comma-separated list of target URLs")
+	flag.StringVar(&filter, "filter", "", `Only report URLs matching an expression, e.g. 'host == "example.com" && ext != "png"'`)
 	flag.Parse()
 
 	if cfgFile == "" {
@@ -134,11 +139,15 @@ func parseInput() (*Options, error) {
 		targets[i] = strings.TrimSpace(targets[i])
 	}
 
-	return &Options{
+	options := &Options{
 		ConfigFile:  cfgFile,
 		Targets:     targets,
 		Concurrency: concurrency,
-	}, nil
+	}
+	if err := options.Filter.SetExpression(filter); err != nil {
+		return nil, fmt.Errorf("invalid -filter: %w", err)
+	}
+	return options, nil
 }
 
 // -------------- The Main Application --------------
@@ -201,6 +210,9 @@ func (app *Application) Start(ctx context.Context) error {
 	go func() {
 		defer wg.Done()
 		for r := range resultsChan {
+			if !app.Options.Filter.MatchURL(r, 0) {
+				continue
+			}
 			enumerated[r] = true
 			app.Logger.Info("Crawled result", zap.String("url", r))
 		}
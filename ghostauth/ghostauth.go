@@ -17,6 +17,8 @@ import (
 type UserKey struct {
 	PublicKey  string
 	PrivateKey string
+	// OpenSSH public keys the user may log in to the SSH server with, as authorized_keys lines
+	SSHAuthorizedKeys []string
 }
 
 // UserStorageManager defines the interface for loading and saving user keys.
@@ -0,0 +1,106 @@
+// File: ghostauth_ssh.go
+package ghostauth
+
+import (
+	"fmt"
+	"strings"
+
+	"go.uber.org/zap"
+	"golang.org/x/crypto/ssh"
+)
+
+// AddSSHAuthorizedKey lets a user log in to the SSH server with an OpenSSH
+// public key, given as an authorized_keys line. It returns the key's SHA256
+// fingerprint.
+func (ga *GhostAuth) AddSSHAuthorizedKey(username, authorizedKey string) (string, error) {
+	key, comment, _, _, err := ssh.ParseAuthorizedKey([]byte(authorizedKey))
+	if err != nil {
+		ga.errorHandler.HandleError("AddSSHAuthorizedKey", fmt.Sprintf("Invalid SSH public key for user: %s", username))
+		return "", fmt.Errorf("invalid SSH public key: %w", err)
+	}
+	fingerprint := ssh.FingerprintSHA256(key)
+
+	ga.mutex.Lock()
+	defer ga.mutex.Unlock()
+
+	userKey, exists := ga.userKeys[username]
+	if !exists {
+		ga.errorHandler.HandleError("AddSSHAuthorizedKey", fmt.Sprintf("User not found: %s", username))
+		return "", fmt.Errorf("user not found: %s", username)
+	}
+	for _, line := range userKey.SSHAuthorizedKeys {
+		if existing, _, _, _, err := ssh.ParseAuthorizedKey([]byte(line)); err == nil && ssh.FingerprintSHA256(existing) == fingerprint {
+			return fingerprint, nil
+		}
+	}
+
+	// Store the key in its canonical form, keeping its comment
+	line := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(key)))
+	if comment != "" {
+		line += " " + comment
+	}
+	previous := userKey
+	userKey.SSHAuthorizedKeys = append(append([]string(nil), userKey.SSHAuthorizedKeys...), line)
+	ga.userKeys[username] = userKey
+
+	if err := ga.userStorageManager.SaveUsers(ga.userKeys); err != nil {
+		// Keep memory in line with what was persisted
+		ga.userKeys[username] = previous
+		ga.errorHandler.HandleError("AddSSHAuthorizedKey", fmt.Sprintf("Failed to save user: %s", username))
+		return "", fmt.Errorf("failed to save user: %s", username)
+	}
+
+	ga.logger.Info("SSH key authorized.", zap.String("username", username), zap.String("fingerprint", fingerprint))
+	return fingerprint, nil
+}
+
+// RemoveSSHAuthorizedKey revokes the SSH public key with the given SHA256 fingerprint.
+func (ga *GhostAuth) RemoveSSHAuthorizedKey(username, fingerprint string) error {
+	ga.mutex.Lock()
+	defer ga.mutex.Unlock()
+
+	userKey, exists := ga.userKeys[username]
+	if !exists {
+		ga.errorHandler.HandleError("RemoveSSHAuthorizedKey", fmt.Sprintf("User not found: %s", username))
+		return fmt.Errorf("user not found: %s", username)
+	}
+
+	kept := make([]string, 0, len(userKey.SSHAuthorizedKeys))
+	removed := false
+	for _, line := range userKey.SSHAuthorizedKeys {
+		key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(line))
+		if err == nil && ssh.FingerprintSHA256(key) == fingerprint {
+			removed = true
+			continue
+		}
+		kept = append(kept, line)
+	}
+	if !removed {
+		return fmt.Errorf("SSH key %s not found for user: %s", fingerprint, username)
+	}
+	previous := userKey
+	userKey.SSHAuthorizedKeys = kept
+	ga.userKeys[username] = userKey
+
+	if err := ga.userStorageManager.SaveUsers(ga.userKeys); err != nil {
+		ga.userKeys[username] = previous
+		ga.errorHandler.HandleError("RemoveSSHAuthorizedKey", fmt.Sprintf("Failed to save user: %s", username))
+		return fmt.Errorf("failed to save user: %s", username)
+	}
+
+	ga.logger.Info("SSH key revoked.", zap.String("username", username), zap.String("fingerprint", fingerprint))
+	return nil
+}
+
+// SSHAuthorizedKeys returns the authorized_keys lines of a user's SSH public
+// keys, or nothing if the user doesn't exist.
+func (ga *GhostAuth) SSHAuthorizedKeys(username string) []string {
+	ga.mutex.Lock()
+	defer ga.mutex.Unlock()
+
+	userKey, exists := ga.userKeys[username]
+	if !exists {
+		return nil
+	}
+	return append([]string(nil), userKey.SSHAuthorizedKeys...)
+}
@@ -0,0 +1,50 @@
+// File: ghostauth_storage.go
+package ghostauth
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// FileUserStorage is a UserStorageManager that keeps users in a JSON file,
+// readable only by its owner since it holds private keys.
+type FileUserStorage struct {
+	Path string
+}
+
+// LoadUsers reads the users in the file into userKeys. A missing file holds no users.
+func (fs *FileUserStorage) LoadUsers(userKeys map[string]UserKey) error {
+	data, err := os.ReadFile(fs.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read users: %w", err)
+	}
+	if err := json.Unmarshal(data, &userKeys); err != nil {
+		return fmt.Errorf("failed to parse users: %w", err)
+	}
+	return nil
+}
+
+// SaveUsers replaces the file with userKeys.
+func (fs *FileUserStorage) SaveUsers(userKeys map[string]UserKey) error {
+	data, err := json.MarshalIndent(userKeys, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode users: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(fs.Path), 0700); err != nil {
+		return fmt.Errorf("failed to create users directory: %w", err)
+	}
+	tmp := fs.Path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write users: %w", err)
+	}
+	if err := os.Rename(tmp, fs.Path); err != nil {
+		return fmt.Errorf("failed to write users: %w", err)
+	}
+	return nil
+}
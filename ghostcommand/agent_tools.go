@@ -0,0 +1,125 @@
+// File: agent_tools.go
+package ghostcommand
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"ghostshell/ai"
+
+	"go.uber.org/zap"
+)
+
+// commandToolParameters is the JSON schema of every command's arguments.
+var commandToolParameters = map[string]interface{}{
+	"type": "object",
+	"properties": map[string]interface{}{
+		"args": map[string]interface{}{
+			"type":        "array",
+			"items":       map[string]interface{}{"type": "string"},
+			"description": "The command's parameters, in order.",
+		},
+	},
+}
+
+// AgentTools offers the CommandRouter's commands to an ai.Agent as tools. A
+// user only sees, and can only run, the commands they are authorized for,
+// and every agent step is recorded in the audit trail.
+type AgentTools struct {
+	router        *CommandRouter
+	authorization *CommandAuthorization
+	audit         *CommandAudit
+	logger        *zap.Logger
+}
+
+// NewAgentTools initializes and returns a new instance of AgentTools.
+func NewAgentTools(router *CommandRouter, authorization *CommandAuthorization, audit *CommandAudit, logger *zap.Logger) *AgentTools {
+	return &AgentTools{
+		router:        router,
+		authorization: authorization,
+		audit:         audit,
+		logger:        logger,
+	}
+}
+
+// NewAuditedAgentTools opens the audit trail at auditPath and attaches it to
+// router as well, so commands run directly and agent steps are recorded in
+// the same trail. The caller closes the returned CommandAudit on shutdown.
+func NewAuditedAgentTools(router *CommandRouter, authorization *CommandAuthorization, auditPath string, logger *zap.Logger) (*AgentTools, *CommandAudit, error) {
+	audit, err := NewCommandAudit(auditPath, logger)
+	if err != nil {
+		return nil, nil, err
+	}
+	router.SetAudit(audit)
+	return NewAgentTools(router, authorization, audit, logger), audit, nil
+}
+
+// NewAgent returns an agent that generates with the loaded model and runs
+// commands with the calling user's permissions.
+func (at *AgentTools) NewAgent(loader *ai.ModelLoader, config ai.AgentConfig) *ai.Agent {
+	return ai.NewAgent(loader, at, at, config)
+}
+
+// Tools returns the registered commands username is authorized to execute.
+func (at *AgentTools) Tools(username string) []ai.Tool {
+	var tools []ai.Tool
+	for _, cmd := range authorizedCommands(at.router, at.authorization, username) {
+		description := cmd.Description
+		if description == "" {
+			description = "Runs the GhostShell " + cmd.Name + " command."
+		}
+		tools = append(tools, ai.Tool{Name: cmd.Name, Description: description, Parameters: commandToolParameters})
+	}
+	return tools
+}
+
+// ExecuteTool executes the command named by call through the CommandRouter,
+// after checking username is authorized for it.
+func (at *AgentTools) ExecuteTool(ctx context.Context, username string, call ai.ToolCall) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	var args struct {
+		Args []string `json:"args"`
+	}
+	if call.Function.Arguments != "" {
+		if err := json.Unmarshal([]byte(call.Function.Arguments), &args); err != nil {
+			return "", fmt.Errorf("invalid arguments for %s: %w", call.Function.Name, err)
+		}
+	}
+
+	return executeAuthorized(at.router, at.authorization, at.logger, "agent", username, call.Function.Name, args.Args)
+}
+
+// RecordAgentStep records one step of an agent run in the audit trail.
+func (at *AgentTools) RecordAgentStep(step ai.AgentStep) {
+	if at.audit == nil {
+		return
+	}
+	entry := AuditEntry{
+		Time:     step.Started,
+		Source:   AuditSourceAgent,
+		Username: step.Username,
+		Command:  step.Tool,
+		Success:  step.Error == "",
+		Error:    step.Error,
+		Duration: step.Duration,
+		RunID:    step.RunID,
+		Step:     step.Step,
+		Kind:     step.Kind,
+		Output:   step.Output,
+	}
+	if step.Arguments != "" {
+		var args struct {
+			Args []string `json:"args"`
+		}
+		if json.Unmarshal([]byte(step.Arguments), &args) == nil {
+			entry.Parameters = args.Args
+		}
+	}
+	if err := at.audit.Record(entry); err != nil {
+		at.logger.Error("Failed to record agent step in audit trail.", zap.String("run_id", step.RunID), zap.Error(err))
+	}
+}
@@ -0,0 +1,43 @@
+// File: authorized_commands.go
+package ghostcommand
+
+import (
+	"fmt"
+
+	"go.uber.org/zap"
+)
+
+// authorizedCommands returns the router's commands username is authorized to execute.
+func authorizedCommands(router *CommandRouter, authorization *CommandAuthorization, username string) []CommandInfo {
+	var commands []CommandInfo
+	for _, cmd := range router.Commands() {
+		authorized, err := authorization.IsUserAuthorized(username, cmd.Name)
+		if err == nil && authorized {
+			commands = append(commands, cmd)
+		}
+	}
+	return commands
+}
+
+// executeAuthorized runs a command as username through the router, after
+// checking username is authorized for it. caller names who asked, such as
+// the agent or a remote shell, in the log.
+func executeAuthorized(router *CommandRouter, authorization *CommandAuthorization, logger *zap.Logger, caller, username, command string, parameters []string) (string, error) {
+	authorized, err := authorization.IsUserAuthorized(username, command)
+	if err != nil {
+		return "", fmt.Errorf("failed to check authorization: %w", err)
+	}
+	if !authorized {
+		logger.Warn("Unauthorized command.", zap.String("caller", caller), zap.String("username", username), zap.String("command", command))
+		return "", fmt.Errorf("user %s is not authorized to execute %s", username, command)
+	}
+
+	output, success, err := router.ExecuteCommandOutput(username, command, parameters)
+	if err != nil {
+		return output, err
+	}
+	if !success {
+		return output, fmt.Errorf("command %s failed", command)
+	}
+	return output, nil
+}
@@ -0,0 +1,111 @@
+// File: command_audit.go
+package ghostcommand
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Sources of audit entries.
+const (
+	AuditSourceCommand = "command" // executed through the CommandRouter
+	AuditSourceAgent   = "agent"   // a step of an AI agent run
+	AuditSourceVoice   = "voice"   // a spoken command
+)
+
+// maxAuditEntries is how many recent entries the audit trail keeps in memory.
+const maxAuditEntries = 1000
+
+// AuditEntry is one record in the command audit trail.
+type AuditEntry struct {
+	Time       time.Time     `json:"time"`
+	Source     string        `json:"source"`
+	Username   string        `json:"username"`
+	Command    string        `json:"command,omitempty"`
+	Parameters []string      `json:"parameters,omitempty"`
+	Success    bool          `json:"success"`
+	Error      string        `json:"error,omitempty"`
+	Duration   time.Duration `json:"duration_ns"`
+
+	// Agent steps only
+	RunID  string `json:"run_id,omitempty"`
+	Step   int    `json:"step,omitempty"`
+	Kind   string `json:"kind,omitempty"`   // "model" or "tool"
+	Output string `json:"output,omitempty"` // the model's text or the tool's output
+
+	// Voice commands only
+	Transcript string `json:"transcript,omitempty"`
+}
+
+// CommandAudit is an append-only record of executed commands and agent
+// steps, written as JSON lines to a file and kept in memory for review.
+type CommandAudit struct {
+	file    *os.File
+	encoder *json.Encoder
+	entries []AuditEntry
+	logger  *zap.Logger
+	mutex   sync.Mutex
+}
+
+// NewCommandAudit opens the audit trail at path, appending to it if it exists.
+// An empty path keeps the trail in memory only.
+func NewCommandAudit(path string, logger *zap.Logger) (*CommandAudit, error) {
+	audit := &CommandAudit{logger: logger}
+	if path == "" {
+		return audit, nil
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit trail: %w", err)
+	}
+	audit.file = file
+	audit.encoder = json.NewEncoder(file)
+	logger.Info("Opened command audit trail.", zap.String("path", path))
+	return audit, nil
+}
+
+// Record appends an entry to the audit trail.
+func (ca *CommandAudit) Record(entry AuditEntry) error {
+	if entry.Time.IsZero() {
+		entry.Time = time.Now()
+	}
+
+	ca.mutex.Lock()
+	defer ca.mutex.Unlock()
+
+	ca.entries = append(ca.entries, entry)
+	if len(ca.entries) > maxAuditEntries {
+		ca.entries = ca.entries[len(ca.entries)-maxAuditEntries:]
+	}
+	if ca.encoder != nil {
+		if err := ca.encoder.Encode(entry); err != nil {
+			return fmt.Errorf("failed to write audit entry: %w", err)
+		}
+	}
+	return nil
+}
+
+// Entries returns the most recent entries, oldest first.
+func (ca *CommandAudit) Entries() []AuditEntry {
+	ca.mutex.Lock()
+	defer ca.mutex.Unlock()
+	return append([]AuditEntry(nil), ca.entries...)
+}
+
+// Close closes the audit trail's file.
+func (ca *CommandAudit) Close() error {
+	ca.mutex.Lock()
+	defer ca.mutex.Unlock()
+	if ca.file == nil {
+		return nil
+	}
+	err := ca.file.Close()
+	ca.file, ca.encoder = nil, nil
+	return err
+}
@@ -3,8 +3,10 @@ package ghostcommand
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 	"sync"
+	"time"
 
 	"go.uber.org/zap"
 
@@ -49,10 +51,26 @@ type CryptoManager interface {
 // CommandHandler defines the type for command handler functions.
 type CommandHandlerFunc func(username string, output *string) bool
 
+// CommandArgsHandlerFunc is a command handler that also receives the command's parameters.
+type CommandArgsHandlerFunc func(username string, parameters []string, output *string) bool
+
+// CommandInfo describes a registered command.
+type CommandInfo struct {
+	Name        string
+	Description string
+}
+
+// registeredCommand is a command's handler and its description.
+type registeredCommand struct {
+	handler     CommandArgsHandlerFunc
+	description string
+}
+
 // CommandRouter manages the registration and execution of commands with quantum-safe encryption and authentication.
 type CommandRouter struct {
-	commandRegistry map[string]CommandHandlerFunc
+	commandRegistry map[string]registeredCommand
 	commandMutex    sync.Mutex
+	audit           *CommandAudit
 	errorHandler    ErrorHandler
 	ghostAuth       GhostAuth
 	cryptoManager   CryptoManager
@@ -86,7 +104,7 @@ func NewCommandRouter(
 	}
 
 	return &CommandRouter{
-		commandRegistry: make(map[string]CommandHandlerFunc),
+		commandRegistry: make(map[string]registeredCommand),
 		errorHandler:    handler,
 		ghostAuth:       ghostAuth,
 		cryptoManager:   cryptoManager,
@@ -123,6 +141,15 @@ func (cr *CommandRouter) Shutdown() {
 // RegisterCommand registers a command with its handler function.
 // Returns true if the command was registered successfully, false otherwise.
 func (cr *CommandRouter) RegisterCommand(commandName string, handler CommandHandlerFunc) (bool, error) {
+	return cr.RegisterCommandWithArgs(commandName, "", func(username string, _ []string, output *string) bool {
+		return handler(username, output)
+	})
+}
+
+// RegisterCommandWithArgs registers a command whose handler receives its parameters.
+// The description is shown to the AI agent when the command is offered as a tool.
+// Returns true if the command was registered successfully, false otherwise.
+func (cr *CommandRouter) RegisterCommandWithArgs(commandName, description string, handler CommandArgsHandlerFunc) (bool, error) {
 	cr.commandMutex.Lock()
 	defer cr.commandMutex.Unlock()
 
@@ -131,50 +158,103 @@ func (cr *CommandRouter) RegisterCommand(commandName string, handler CommandHand
 		return false, fmt.Errorf("command already registered: %s", commandName)
 	}
 
-	cr.commandRegistry[commandName] = handler
+	cr.commandRegistry[commandName] = registeredCommand{handler: handler, description: description}
 	cr.logger.Info("Registered command.", zap.String("command", commandName))
 	return true, nil
 }
 
+// Commands returns the registered commands, sorted by name.
+func (cr *CommandRouter) Commands() []CommandInfo {
+	cr.commandMutex.Lock()
+	defer cr.commandMutex.Unlock()
+
+	commands := make([]CommandInfo, 0, len(cr.commandRegistry))
+	for name, cmd := range cr.commandRegistry {
+		commands = append(commands, CommandInfo{Name: name, Description: cmd.description})
+	}
+	sort.Slice(commands, func(i, j int) bool { return commands[i].Name < commands[j].Name })
+	return commands
+}
+
+// SetAudit sets the audit trail that every command execution is recorded in.
+func (cr *CommandRouter) SetAudit(audit *CommandAudit) {
+	cr.commandMutex.Lock()
+	defer cr.commandMutex.Unlock()
+	cr.audit = audit
+}
+
 // ExecuteCommand executes a registered command with quantum-safe encryption and authentication.
 // It takes the username, command name, and parameters.
 // Returns true if the command was executed successfully, false otherwise.
 func (cr *CommandRouter) ExecuteCommand(username, commandName string, parameters []string) (bool, error) {
+	_, success, err := cr.ExecuteCommandOutput(username, commandName, parameters)
+	return success, err
+}
+
+// ExecuteCommandOutput is ExecuteCommand, also returning the output the handler wrote.
+func (cr *CommandRouter) ExecuteCommandOutput(username, commandName string, parameters []string) (string, bool, error) {
+	start := time.Now()
+	output, success, err := cr.executeCommand(username, commandName, parameters)
+
+	cr.commandMutex.Lock()
+	audit := cr.audit
+	cr.commandMutex.Unlock()
+	if audit != nil {
+		entry := AuditEntry{
+			Time:       start,
+			Source:     AuditSourceCommand,
+			Username:   username,
+			Command:    commandName,
+			Parameters: parameters,
+			Success:    success,
+			Duration:   time.Since(start),
+		}
+		if err != nil {
+			entry.Error = err.Error()
+		}
+		if recErr := audit.Record(entry); recErr != nil {
+			cr.logger.Error("Failed to record command in audit trail.", zap.String("command", commandName), zap.Error(recErr))
+		}
+	}
+	return output, success, err
+}
+
+func (cr *CommandRouter) executeCommand(username, commandName string, parameters []string) (string, bool, error) {
 	cr.logger.Info("Executing command.", zap.String("username", username), zap.String("command", commandName), zap.Strings("parameters", parameters))
 
 	// Authenticate the user
 	if !cr.AuthenticateUser(username) {
 		cr.errorHandler.HandleError("ExecuteCommand", "Authentication failed for user: "+username)
-		return false, fmt.Errorf("authentication failed for user: %s", username)
+		return "", false, fmt.Errorf("authentication failed for user: %s", username)
 	}
 
 	// Encrypt the command
 	encryptedCommand, err := cr.EncryptCommand(commandName, parameters)
 	if err != nil {
 		cr.errorHandler.HandleError("ExecuteCommand", "Failed to encrypt command.")
-		return false, fmt.Errorf("failed to encrypt command: %w", err)
+		return "", false, fmt.Errorf("failed to encrypt command: %w", err)
 	}
 
 	// Decrypt the command
 	decryptedCommandName, decryptedParameters, err := cr.DecryptCommand(encryptedCommand)
 	if err != nil {
 		cr.errorHandler.HandleError("ExecuteCommand", "Failed to decrypt command.")
-		return false, fmt.Errorf("failed to decrypt command: %w", err)
+		return "", false, fmt.Errorf("failed to decrypt command: %w", err)
 	}
 
 	// Find the command handler
 	cr.commandMutex.Lock()
-	handler, exists := cr.commandRegistry[decryptedCommandName]
+	cmd, exists := cr.commandRegistry[decryptedCommandName]
 	cr.commandMutex.Unlock()
 
 	if !exists {
 		cr.errorHandler.HandleError("ExecuteCommand", "Command not found: "+decryptedCommandName)
-		return false, fmt.Errorf("command not found: %s", decryptedCommandName)
+		return "", false, fmt.Errorf("command not found: %s", decryptedCommandName)
 	}
 
 	// Execute the command handler
 	var output string
-	success := handler(username, &output)
+	success := cmd.handler(username, decryptedParameters, &output)
 	if success {
 		cr.logger.Info("Command executed successfully.", zap.String("command", decryptedCommandName))
 	} else {
@@ -182,7 +262,7 @@ func (cr *CommandRouter) ExecuteCommand(username, commandName string, parameters
 		cr.logger.Error("Command execution failed.", zap.String("command", decryptedCommandName))
 	}
 
-	return success, nil
+	return output, success, nil
 }
 
 // AuthenticateUser authenticates a user using post-quantum signature verification.
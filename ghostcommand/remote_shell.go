@@ -0,0 +1,38 @@
+// File: remote_shell.go
+package ghostcommand
+
+import (
+	"go.uber.org/zap"
+)
+
+// RemoteShell runs the CommandRouter's commands typed into a remote login,
+// such as a GhostShell SSH session. A user only sees, and can only run, the
+// commands they are authorized for.
+type RemoteShell struct {
+	router        *CommandRouter
+	authorization *CommandAuthorization
+	logger        *zap.Logger
+}
+
+// NewRemoteShell initializes and returns a new instance of RemoteShell.
+func NewRemoteShell(router *CommandRouter, authorization *CommandAuthorization, logger *zap.Logger) *RemoteShell {
+	return &RemoteShell{
+		router:        router,
+		authorization: authorization,
+		logger:        logger,
+	}
+}
+
+// Commands returns the names of the commands username is authorized to execute.
+func (rs *RemoteShell) Commands(username string) []string {
+	var names []string
+	for _, cmd := range authorizedCommands(rs.router, rs.authorization, username) {
+		names = append(names, cmd.Name)
+	}
+	return names
+}
+
+// Execute runs a command as username, returning its output.
+func (rs *RemoteShell) Execute(username, command string, parameters []string) (string, error) {
+	return executeAuthorized(rs.router, rs.authorization, rs.logger, "remote shell", username, command, parameters)
+}
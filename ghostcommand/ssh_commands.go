@@ -0,0 +1,153 @@
+// File: ssh_commands.go
+package ghostcommand
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/crypto/ssh"
+)
+
+// SSHClient runs commands and transfers files on saved SSH connections.
+// It should be implemented by the sshmgmt.SSHManager struct.
+type SSHClient interface {
+	// Run runs a command on the named connection, returning its combined output.
+	Run(ctx context.Context, name, command string) (string, error)
+	// Upload copies a local file to the named connection's host over SFTP.
+	Upload(ctx context.Context, name, localPath, remotePath string) (int64, error)
+	// Download copies a file from the named connection's host over SFTP.
+	Download(ctx context.Context, name, remotePath, localPath string) (int64, error)
+	// ListDir lists a directory on the named connection's host over SFTP.
+	ListDir(ctx context.Context, name, remotePath string) ([]os.FileInfo, error)
+	// Disconnect closes the named connection.
+	Disconnect(name string) error
+}
+
+// SSHCommands exposes an SSHClient's connections as router commands.
+type SSHCommands struct {
+	client  SSHClient
+	timeout time.Duration
+	logger  *zap.Logger
+}
+
+// NewSSHCommands initializes and returns a new instance of SSHCommands.
+// Each command is cancelled after timeout.
+func NewSSHCommands(client SSHClient, timeout time.Duration, logger *zap.Logger) *SSHCommands {
+	return &SSHCommands{
+		client:  client,
+		timeout: timeout,
+		logger:  logger,
+	}
+}
+
+// Register registers ssh_run, ssh_upload, ssh_download, ssh_ls and
+// ssh_disconnect with the router.
+func (sc *SSHCommands) Register(router *CommandRouter) error {
+	commands := []struct {
+		name, description string
+		handler           CommandArgsHandlerFunc
+	}{
+		{"ssh_run", "Runs a shell command on a saved SSH connection. Args: connection, command...", sc.run},
+		{"ssh_upload", "Uploads a local file over SFTP. Args: connection, local path, remote path.", sc.upload},
+		{"ssh_download", "Downloads a remote file over SFTP. Args: connection, remote path, local path.", sc.download},
+		{"ssh_ls", "Lists a remote directory over SFTP. Args: connection, [remote path].", sc.list},
+		{"ssh_disconnect", "Closes a saved SSH connection. Args: connection.", sc.disconnect},
+	}
+	for _, cmd := range commands {
+		if _, err := router.RegisterCommandWithArgs(cmd.name, cmd.description, cmd.handler); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (sc *SSHCommands) run(username string, parameters []string, output *string) bool {
+	if len(parameters) < 2 {
+		*output = "usage: ssh_run <connection> <command...>"
+		return false
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), sc.timeout)
+	defer cancel()
+
+	result, err := sc.client.Run(ctx, parameters[0], strings.Join(parameters[1:], " "))
+	*output = result
+	var exitErr *ssh.ExitError
+	if errors.As(err, &exitErr) {
+		*output += fmt.Sprintf("exit status %d", exitErr.ExitStatus())
+		return false
+	}
+	return sc.result(username, "ssh_run", parameters[0], err, output)
+}
+
+func (sc *SSHCommands) upload(username string, parameters []string, output *string) bool {
+	if len(parameters) != 3 {
+		*output = "usage: ssh_upload <connection> <local path> <remote path>"
+		return false
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), sc.timeout)
+	defer cancel()
+
+	n, err := sc.client.Upload(ctx, parameters[0], parameters[1], parameters[2])
+	*output = fmt.Sprintf("uploaded %d bytes", n)
+	return sc.result(username, "ssh_upload", parameters[0], err, output)
+}
+
+func (sc *SSHCommands) download(username string, parameters []string, output *string) bool {
+	if len(parameters) != 3 {
+		*output = "usage: ssh_download <connection> <remote path> <local path>"
+		return false
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), sc.timeout)
+	defer cancel()
+
+	n, err := sc.client.Download(ctx, parameters[0], parameters[1], parameters[2])
+	*output = fmt.Sprintf("downloaded %d bytes", n)
+	return sc.result(username, "ssh_download", parameters[0], err, output)
+}
+
+func (sc *SSHCommands) list(username string, parameters []string, output *string) bool {
+	if len(parameters) < 1 || len(parameters) > 2 {
+		*output = "usage: ssh_ls <connection> [remote path]"
+		return false
+	}
+	remotePath := "."
+	if len(parameters) == 2 {
+		remotePath = parameters[1]
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), sc.timeout)
+	defer cancel()
+
+	entries, err := sc.client.ListDir(ctx, parameters[0], remotePath)
+	var lines []string
+	for _, entry := range entries {
+		lines = append(lines, fmt.Sprintf("%s %10d %s %s", entry.Mode(), entry.Size(), entry.ModTime().Format("2006-01-02 15:04"), entry.Name()))
+	}
+	*output = strings.Join(lines, "\n")
+	return sc.result(username, "ssh_ls", parameters[0], err, output)
+}
+
+func (sc *SSHCommands) disconnect(username string, parameters []string, output *string) bool {
+	if len(parameters) != 1 {
+		*output = "usage: ssh_disconnect <connection>"
+		return false
+	}
+	err := sc.client.Disconnect(parameters[0])
+	*output = "disconnected " + parameters[0]
+	return sc.result(username, "ssh_disconnect", parameters[0], err, output)
+}
+
+// result logs a failed command and puts its error in the output
+func (sc *SSHCommands) result(username, command, connection string, err error, output *string) bool {
+	if err == nil {
+		return true
+	}
+	sc.logger.Warn("SSH command failed.", zap.String("username", username), zap.String("command", command),
+		zap.String("connection", connection), zap.Error(err))
+	*output = err.Error()
+	return false
+}
@@ -0,0 +1,163 @@
+// File: voice_commands.go
+package ghostcommand
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+
+	"ghostshell/ai"
+
+	"go.uber.org/zap"
+)
+
+// ErrNoVoiceCommand is returned when a transcript doesn't name a registered command.
+var ErrNoVoiceCommand = errors.New("no command recognized")
+
+// VoiceResult is the outcome of one spoken command.
+type VoiceResult struct {
+	Transcript string    `json:"transcript"`
+	Command    string    `json:"command,omitempty"`
+	Parameters []string  `json:"parameters,omitempty"`
+	Output     string    `json:"output,omitempty"`
+	Success    bool      `json:"success"`
+	Reply      *ai.Audio `json:"-"` // the output spoken, if Speak is set
+}
+
+// VoiceCommands transcribes spoken commands and runs them through the
+// CommandRouter with the speaker's permissions. Every utterance is recorded
+// in the audit trail with its transcript.
+type VoiceCommands struct {
+	speech        ai.Speech
+	router        *CommandRouter
+	authorization *CommandAuthorization
+	audit         *CommandAudit
+	logger        *zap.Logger
+
+	// Speak makes HandleUtterance synthesize the command's output as a reply.
+	Speak bool
+}
+
+// NewVoiceCommands initializes and returns a new instance of VoiceCommands.
+func NewVoiceCommands(speech ai.Speech, router *CommandRouter, authorization *CommandAuthorization, audit *CommandAudit, logger *zap.Logger) *VoiceCommands {
+	return &VoiceCommands{
+		speech:        speech,
+		router:        router,
+		authorization: authorization,
+		audit:         audit,
+		logger:        logger,
+	}
+}
+
+// HandleUtterance transcribes audio and executes the command it names. The
+// command is the longest run of leading words matching a registered command,
+// joined with "_", "-" or nothing, so "scan ports 10.0.0.5" runs scan_ports;
+// the remaining words are its parameters.
+func (vc *VoiceCommands) HandleUtterance(ctx context.Context, username string, audio *ai.Audio) (*VoiceResult, error) {
+	start := time.Now()
+	transcript, err := vc.speech.Transcribe(ctx, audio)
+	if err != nil {
+		return nil, fmt.Errorf("failed to transcribe command: %w", err)
+	}
+	result := &VoiceResult{Transcript: transcript}
+
+	result.Command, result.Parameters = vc.match(transcript)
+	err = vc.execute(username, result)
+	vc.record(username, result, start, err)
+	if err != nil {
+		return result, err
+	}
+
+	if vc.Speak && result.Output != "" {
+		if result.Reply, err = vc.speech.Synthesize(ctx, result.Output); err != nil {
+			vc.logger.Warn("Failed to speak command output.", zap.String("command", result.Command), zap.Error(err))
+		}
+	}
+	return result, nil
+}
+
+func (vc *VoiceCommands) execute(username string, result *VoiceResult) error {
+	if result.Command == "" {
+		return fmt.Errorf("%w in %q", ErrNoVoiceCommand, result.Transcript)
+	}
+
+	authorized, err := vc.authorization.IsUserAuthorized(username, result.Command)
+	if err != nil {
+		return fmt.Errorf("failed to check authorization: %w", err)
+	}
+	if !authorized {
+		vc.logger.Warn("Unauthorized voice command.", zap.String("username", username), zap.String("command", result.Command))
+		return fmt.Errorf("user %s is not authorized to execute %s", username, result.Command)
+	}
+
+	output, success, err := vc.router.ExecuteCommandOutput(username, result.Command, result.Parameters)
+	result.Output, result.Success = output, success
+	if err != nil {
+		return err
+	}
+	if !success {
+		return fmt.Errorf("command %s failed", result.Command)
+	}
+	return nil
+}
+
+// match finds the registered command a transcript starts with, returning
+// its name as registered.
+func (vc *VoiceCommands) match(transcript string) (string, []string) {
+	words := voiceWords(transcript)
+	commands := make(map[string]string)
+	for _, cmd := range vc.router.Commands() {
+		commands[strings.ToLower(cmd.Name)] = cmd.Name
+	}
+
+	for n := len(words); n > 0; n-- {
+		for _, sep := range []string{"_", "-", ""} {
+			if name, ok := commands[strings.Join(words[:n], sep)]; ok {
+				return name, words[n:]
+			}
+		}
+	}
+	return "", nil
+}
+
+// voiceWords lowercases a transcript and splits it into words, dropping the
+// punctuation recognizers add but keeping the characters of addresses and
+// paths, such as dots, colons and slashes, inside a word.
+func voiceWords(transcript string) []string {
+	fields := strings.Fields(strings.ToLower(transcript))
+	words := fields[:0]
+	for _, field := range fields {
+		word := strings.TrimFunc(field, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '/'
+		})
+		if word != "" {
+			words = append(words, word)
+		}
+	}
+	return words
+}
+
+func (vc *VoiceCommands) record(username string, result *VoiceResult, start time.Time, err error) {
+	if vc.audit == nil {
+		return
+	}
+	entry := AuditEntry{
+		Time:       start,
+		Source:     AuditSourceVoice,
+		Username:   username,
+		Command:    result.Command,
+		Parameters: result.Parameters,
+		Success:    err == nil,
+		Duration:   time.Since(start),
+		Transcript: result.Transcript,
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	if recErr := vc.audit.Record(entry); recErr != nil {
+		vc.logger.Error("Failed to record voice command in audit trail.", zap.Error(recErr))
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"ghostshell/app/apikeys"
+	"ghostshell/app/apikeys/keyfile"
+)
+
+const keysUsage = `Usage: ghostshell keys <command> [flags]
+
+Commands:
+  status                                  show the health of every key
+  add -provider NAME -secret SECRET       store a key (two-value keys as "id:secret")
+  remove -provider NAME -label LABEL      delete a key
+  unbench -provider NAME -label LABEL     put a benched key back in rotation
+`
+
+// runKeysCommand implements "ghostshell keys" and returns the exit code
+func runKeysCommand(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, keysUsage)
+		return 2
+	}
+
+	command := args[0]
+	flags := flag.NewFlagSet("keys "+command, flag.ContinueOnError)
+	file := flags.String("file", keyfile.DefaultFile, "encrypted API key file")
+	providerName := flags.String("provider", "", "provider name, e.g. shodan")
+	label := flags.String("label", "", "key label")
+	secret := flags.String("secret", "", "key secret")
+	quota := flags.Int("quota", 0, "requests allowed per quota period (0 = not tracked)")
+	quotaPeriod := flags.Duration("quota-period", 0, "quota window, e.g. 720h")
+	if err := flags.Parse(args[1:]); err != nil {
+		return 2
+	}
+
+	manager, err := keyfile.Open(*file, nil)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	switch command {
+	case "status":
+		err = manager.WriteStatus(os.Stdout)
+	case "add":
+		err = manager.Add(*providerName, apikeys.Key{
+			Label:       *label,
+			Secret:      *secret,
+			Quota:       *quota,
+			QuotaPeriod: apikeys.Duration(*quotaPeriod),
+		})
+	case "remove":
+		err = manager.Remove(*providerName, *label)
+	case "unbench":
+		err = manager.Unbench(*providerName, *label)
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown keys command %q\n\n%s", command, keysUsage)
+		return 2
+	}
+	if err == nil && command != "status" {
+		err = manager.Save()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	return 0
+}
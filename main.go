@@ -89,6 +89,11 @@ func NewApplication() (*Application, error) {
 
 // main is the primary entry point for GhostShell
 func main() {
+	// Key management runs without starting the application
+	if len(os.Args) > 1 && os.Args[1] == "keys" {
+		os.Exit(runKeysCommand(os.Args[2:]))
+	}
+
 	// Instantiate app
 	app, err := NewApplication()
 	if err != nil {
@@ -195,6 +200,12 @@ func (app *Application) InitializeComponents() error {
 			errs = append(errs, fmt.Errorf("failed to create AI model loader: %w", err))
 		} else {
 			app.ModelLoader = mdl
+			if app.Metrics != nil {
+				inferenceMetrics := metrics.NewInferenceMetrics()
+				if regErr := app.Metrics.RegisterMetric(inferenceMetrics); regErr == nil {
+					app.ModelLoader.SetMetrics(inferenceMetrics)
+				}
+			}
 			if loadErr := app.ModelLoader.LoadModel(); loadErr != nil {
 				errs = append(errs, fmt.Errorf("failed to auto-load AI model: %w", loadErr))
 			}
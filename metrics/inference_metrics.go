@@ -0,0 +1,84 @@
+package metrics
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// InferenceMetrics counts AI generations, their tokens and latency. It is a
+// prometheus.Collector, so register it with MetricsManager.RegisterMetric, and
+// satisfies ai.InferenceRecorder, so pass it to ModelLoader.SetMetrics.
+type InferenceMetrics struct {
+	requestsCounterVec *prometheus.CounterVec
+	tokensCounterVec   *prometheus.CounterVec
+	latencyHistVec     *prometheus.HistogramVec
+	tokenRateGaugeVec  *prometheus.GaugeVec
+}
+
+// NewInferenceMetrics returns a pointer to a new InferenceMetrics object.
+func NewInferenceMetrics() *InferenceMetrics {
+	return &InferenceMetrics{
+		requestsCounterVec: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "ai_inference_requests_total",
+				Help: "Generation requests per backend, model and status (success or error).",
+			},
+			[]string{"backend", "model", "status"},
+		),
+		tokensCounterVec: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "ai_inference_tokens_total",
+				Help: "Tokens processed per backend, model and type (prompt or completion).",
+			},
+			[]string{"backend", "model", "type"},
+		),
+		latencyHistVec: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "ai_inference_latency_seconds",
+				Help:    "Time from sending a generation request to its last token.",
+				Buckets: prometheus.ExponentialBuckets(0.05, 2, 12), // 50ms to ~100s
+			},
+			[]string{"backend", "model"},
+		),
+		tokenRateGaugeVec: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "ai_inference_completion_tokens_per_second",
+				Help: "Completion tokens per second of the most recent generation.",
+			},
+			[]string{"backend", "model"},
+		),
+	}
+}
+
+// ObserveInference records one generation. Failed generations only count as
+// requests.
+func (im *InferenceMetrics) ObserveInference(backend, model string, promptTokens, completionTokens int, latency time.Duration, err error) {
+	if err != nil {
+		im.requestsCounterVec.WithLabelValues(backend, model, "error").Inc()
+		return
+	}
+	im.requestsCounterVec.WithLabelValues(backend, model, "success").Inc()
+	im.tokensCounterVec.WithLabelValues(backend, model, "prompt").Add(float64(promptTokens))
+	im.tokensCounterVec.WithLabelValues(backend, model, "completion").Add(float64(completionTokens))
+	im.latencyHistVec.WithLabelValues(backend, model).Observe(latency.Seconds())
+	if latency > 0 {
+		im.tokenRateGaugeVec.WithLabelValues(backend, model).Set(float64(completionTokens) / latency.Seconds())
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (im *InferenceMetrics) Describe(ch chan<- *prometheus.Desc) {
+	im.requestsCounterVec.Describe(ch)
+	im.tokensCounterVec.Describe(ch)
+	im.latencyHistVec.Describe(ch)
+	im.tokenRateGaugeVec.Describe(ch)
+}
+
+// Collect implements prometheus.Collector.
+func (im *InferenceMetrics) Collect(ch chan<- prometheus.Metric) {
+	im.requestsCounterVec.Collect(ch)
+	im.tokensCounterVec.Collect(ch)
+	im.latencyHistVec.Collect(ch)
+	im.tokenRateGaugeVec.Collect(ch)
+}
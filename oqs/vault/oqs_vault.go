@@ -5,6 +5,8 @@ import (
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"os"
+	"path/filepath"
 	"sync"
 	"time"
 
@@ -18,30 +20,37 @@ import (
 // Initialize logger with dynamic file naming
 var logger *zap.SugaredLogger
 
+// logDir receives the log files when it exists
+const logDir = "ghostshell/logging"
+
 func init() {
 	currentTime := time.Now().UTC().Format("20060102_150405")
 	logFileName1 := fmt.Sprintf("postquantumsecurity_log_%s.log", currentTime)
 	logFileName2 := fmt.Sprintf("vaultlog_%s.log", currentTime)
 
-	// Configure zap to write to both log files and stdout
+	// Configure zap to write to both log files and stdout. Without the log
+	// directory only stdout is used.
 	config := zap.NewProductionConfig()
-	config.OutputPaths = []string{
-		"logging/" + logFileName1, // Ensure logs are placed in ghostshell/logging
-		"logging/" + logFileName2,
-		"stdout", // Also write logs to the console
+	config.OutputPaths = []string{"stdout"}
+	if info, err := os.Stat(logDir); err == nil && info.IsDir() {
+		config.OutputPaths = append([]string{
+			filepath.Join(logDir, logFileName1),
+			filepath.Join(logDir, logFileName2),
+		}, config.OutputPaths...)
 	}
 
-	// Build the logger
+	// Build the logger, falling back to a no-op logger rather than failing
+	// the importing program
 	log, err := config.Build()
 	if err != nil {
-		panic(fmt.Sprintf("Failed to initialize logger: %v", err))
+		log = zap.NewNop()
 	}
 
 	// Set the global logger
 	logger = log.Sugar()
 
 	// Log initialization information
-	logger.Infof("Logger initialized with files: %s and %s", logFileName1, logFileName2)
+	logger.Infof("Logger initialized with outputs: %v", config.OutputPaths)
 }
 
 type OQS_STATUS int
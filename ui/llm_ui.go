@@ -1,83 +1,448 @@
-package core
+package ui
 
 import (
-	"errors"
+	"context"
 	"fmt"
-	"os"
+	"strings"
+	"sync"
+	"time"
 
-	llama "github.com/go-skynet/go-llama.cpp"
+	"ghostshell/ai"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
 )
 
-type LanguageModel struct {
-	modelPath     string
+// LLMPanel is a chat panel for the AI server. Replies stream in over
+// Server-Sent Events and are drawn as each token arrives. Conversations are
+// saved per engagement, and managed with commands typed at the prompt:
+//
+//	/new <engagement> [title]          start a conversation
+//	/open <engagement> <id>            resume one
+//	/list [engagement]                 list conversations
+//	/template <name> [var=value ...]   start one from a prompt template and send its prompt
+//	/export [md|json]                  export the conversation
+type LLMPanel struct {
+	client *ai.StreamClient
+	store  *ai.ConversationStore
+
+	// Fitting conversations to the model: the window, the reply's share of
+	// it, and whether old turns are dropped or summarized
 	contextWindow int
-	temperature   float32
-	maxTokens     int
+	params        ai.ControlParameters
+	strategy      string
+	templates     []ai.PromptTemplate
+
+	x, y, width, height int32
+	font                rl.Font
+	fontSize            float32
+	input               string
+	scrollOffset        int // lines scrolled up from the bottom
+
+	sendButton Button
+	stopButton Button
 
-	model   *llama.LLama
-	loading bool
-	ready   bool
+	// Written by the streaming goroutine, read when drawing
+	mu        sync.Mutex
+	conv      *ai.Conversation // completed turns, sent as context with each prompt
+	reply     strings.Builder  // assistant reply being streamed
+	status    string
+	streaming bool
+	cancel    context.CancelFunc
 }
 
-func NewLanguageModel(modelPath string) (*LanguageModel, error) {
-	if _, err := os.Stat(modelPath); errors.Is(err, os.ErrNotExist) {
-		return nil, fmt.Errorf("model file not found: %s", modelPath)
+// NewLLMPanel initializes a new LLMPanel talking to the server behind client,
+// saving conversations in store.
+func NewLLMPanel(client *ai.StreamClient, store *ai.ConversationStore, font rl.Font, x, y, width, height int32) *LLMPanel {
+	defaults := ai.GetDefaultConfig()
+	return &LLMPanel{
+		client:        client,
+		store:         store,
+		contextWindow: ai.DefaultContextWindow,
+		params:        defaults.ControlParams,
+		strategy:      defaults.Conversations.Strategy,
+		conv:          ai.NewConversation("", ""),
+		x:             x,
+		y:             y,
+		width:         width,
+		height:        height,
+		font:          font,
+		fontSize:      18,
+		status:        "Ready",
+		sendButton:    NewButton(x+width-260, y+height-50, 120, 40, "Send"),
+		stopButton:    NewButton(x+width-130, y+height-50, 120, 40, "Stop"),
 	}
+}
 
-	return &LanguageModel{
-		modelPath:     modelPath,
-		contextWindow: 2048,
-		temperature:   0.7,
-		maxTokens:     1024,
-	}, nil
+// SetContext sets the model's context window in tokens, the parameters
+// replies are budgeted for, and the strategy for turns that don't fit.
+func (p *LLMPanel) SetContext(window int, params ai.ControlParameters, strategy string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.contextWindow = window
+	p.params = params
+	p.strategy = strategy
 }
 
-func (lm *LanguageModel) LoadModel() error {
-	if lm.loading {
-		return errors.New("model is already loading")
+// Update handles typing, sending and cancelling.
+func (p *LLMPanel) Update() {
+	for {
+		typed := rl.GetCharPressed()
+		if typed == 0 {
+			break
+		}
+		if typed >= 32 {
+			p.input += string(rune(typed))
+		}
 	}
-	if lm.ready {
-		return errors.New("model is already loaded")
+	if rl.IsKeyPressed(rl.KeyBackspace) && len(p.input) > 0 {
+		runes := []rune(p.input)
+		p.input = string(runes[:len(runes)-1])
 	}
 
-	lm.loading = true
-	defer func() { lm.loading = false }()
+	// Scroll the transcript
+	if wheel := rl.GetMouseWheelMove(); wheel != 0 {
+		p.scrollOffset += int(wheel)
+		if p.scrollOffset < 0 {
+			p.scrollOffset = 0
+		}
+	}
 
-	var err error
-	lm.model, err = llama.New(lm.modelPath, llama.SetContext(lm.contextWindow))
-	if err != nil {
-		return fmt.Errorf("failed to load model: %v", err)
+	if rl.IsKeyPressed(rl.KeyEnter) || p.sendButton.Update() {
+		p.Send()
+	}
+	if p.stopButton.Update() {
+		p.Stop()
+	}
+}
+
+// Send runs a typed command, or streams a reply to the typed prompt with the
+// conversation so far as context.
+func (p *LLMPanel) Send() {
+	input := strings.TrimSpace(p.input)
+	if input == "" {
+		return
+	}
+	p.mu.Lock()
+	streaming := p.streaming
+	p.mu.Unlock()
+	if streaming {
+		return
+	}
+
+	p.input = ""
+	p.scrollOffset = 0
+	if strings.HasPrefix(input, "/") {
+		p.command(strings.Fields(input))
+		return
+	}
+	p.send(input)
+}
+
+// send streams a reply to prompt. Old turns are dropped or summarized to fit
+// the context window, and the conversation is saved when the reply is done.
+func (p *LLMPanel) send(prompt string) {
+	p.mu.Lock()
+	conv := p.conv
+	conv.AddUser(prompt)
+	params := p.params
+	if conv.Params != nil {
+		params = *conv.Params
 	}
+	window, strategy := p.contextWindow, p.strategy
+	ctx, cancel := context.WithCancel(context.Background())
+	p.cancel = cancel
+	p.streaming = true
+	p.reply.Reset()
+	p.status = "Sending..."
+	p.mu.Unlock()
 
-	lm.ready = true
-	return nil
+	go func() {
+		defer cancel()
+		var used *ai.ControlParameters
+		messages, err := conv.Prepare(ctx, window, params, strategy, serverModel{p.client}, nil)
+		var res *ai.GenerateResult
+		if err == nil {
+			req := ai.GenerateRequest{Messages: messages}
+			if conv.Params != nil {
+				req.Temperature, req.MaxTokens = &conv.Params.Temperature, &conv.Params.MaxTokens
+				req.TopP, req.TopK = &conv.Params.TopP, &conv.Params.TopK
+			}
+			res, err = p.client.Chat(ctx, req, func(ev ai.StreamEvent) error {
+				p.mu.Lock()
+				defer p.mu.Unlock()
+				switch ev.Type {
+				case "queued":
+					p.status = "Waiting for the model..."
+				case "token":
+					p.status = "Generating..."
+					p.reply.WriteString(ev.Content)
+				case "done":
+					used = ev.Params
+				}
+				return nil
+			})
+		}
+
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		p.streaming = false
+		p.cancel = nil
+		switch {
+		case res != nil:
+			conv.AddReply(res, used)
+		case p.reply.Len() > 0:
+			// Keep what arrived before the reply was stopped
+			conv.AddReply(&ai.GenerateResult{Text: p.reply.String(), FinishReason: "cancelled"}, used)
+		}
+		p.reply.Reset()
+		switch {
+		case ctx.Err() != nil:
+			p.status = "Stopped"
+		case err != nil:
+			p.status = "Error: " + err.Error()
+		default:
+			p.status = fmt.Sprintf("Done: %d tokens in %.1fs", res.CompletionTokens, res.Latency.Seconds())
+		}
+		if err := p.store.Save(conv); err != nil {
+			p.status = "Failed to save conversation: " + err.Error()
+		}
+	}()
 }
 
-func (lm *LanguageModel) RunInference(prompt string) (string, error) {
-	if !lm.ready {
-		return "", errors.New("model is not loaded or ready")
+// command runs a /command typed at the prompt.
+func (p *LLMPanel) command(args []string) {
+	setStatus := func(format string, a ...interface{}) {
+		p.mu.Lock()
+		p.status = fmt.Sprintf(format, a...)
+		p.mu.Unlock()
 	}
 
-	options := []llama.PredictOption{
-		llama.SetTemperature(lm.temperature),
-		llama.SetMaxTokens(lm.maxTokens),
-		llama.SetTopP(0.95),
+	switch args[0] {
+	case "/new":
+		if len(args) < 2 {
+			setStatus("Usage: /new <engagement> [title]")
+			return
+		}
+		conv := ai.NewConversation(args[1], strings.Join(args[2:], " "))
+		p.mu.Lock()
+		p.conv = conv
+		p.mu.Unlock()
+		setStatus("New conversation %s in %s", conv.ID, conv.Engagement)
+
+	case "/open":
+		if len(args) != 3 {
+			setStatus("Usage: /open <engagement> <id>")
+			return
+		}
+		conv, err := p.store.Load(args[1], args[2])
+		if err != nil {
+			setStatus("Error: %v", err)
+			return
+		}
+		p.mu.Lock()
+		p.conv = conv
+		p.mu.Unlock()
+		setStatus("Opened %q (%d messages, %d tokens)", conv.Title, len(conv.Messages), conv.Usage.PromptTokens+conv.Usage.CompletionTokens)
+
+	case "/list":
+		engagement := ""
+		if len(args) > 1 {
+			engagement = args[1]
+		}
+		list, err := p.store.List(engagement)
+		if err != nil {
+			setStatus("Error: %v", err)
+			return
+		}
+		var names []string
+		for _, c := range list {
+			names = append(names, fmt.Sprintf("%s/%s %q", c.Engagement, c.ID, c.Title))
+		}
+		if len(names) == 0 {
+			setStatus("No conversations")
+			return
+		}
+		setStatus("%s", strings.Join(names, "  "))
+
+	case "/template":
+		if len(args) < 2 {
+			setStatus("Usage: /template <name> [var=value ...]")
+			return
+		}
+		vars := make(map[string]string)
+		for _, arg := range args[2:] {
+			if name, value, ok := strings.Cut(arg, "="); ok {
+				vars[name] = value
+			}
+		}
+		p.startTemplate(args[1], vars)
+
+	case "/export":
+		format := "md"
+		if len(args) > 1 {
+			format = args[1]
+		}
+		p.mu.Lock()
+		conv := p.conv
+		p.mu.Unlock()
+		path, err := p.store.Export(conv, format)
+		if err != nil {
+			setStatus("Error: %v", err)
+			return
+		}
+		setStatus("Exported to %s", path)
+
+	default:
+		setStatus("Unknown command %s; try /new, /open, /list, /template or /export", args[0])
 	}
+}
+
+// startTemplate starts a conversation in the current engagement from a
+// template, fetching the templates from the server the first time, and sends
+// the template's prompt.
+func (p *LLMPanel) startTemplate(name string, vars map[string]string) {
+	p.mu.Lock()
+	templates := p.templates
+	engagement := p.conv.Engagement
+	p.mu.Unlock()
 
-	output, err := lm.model.Predict(prompt, options...)
+	if templates == nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		var err error
+		if templates, err = p.client.Templates(ctx); err != nil {
+			p.mu.Lock()
+			p.status = "Error: " + err.Error()
+			p.mu.Unlock()
+			return
+		}
+	}
+
+	conv := ai.NewConversation(engagement, "")
+	t, err := ai.FindTemplate(templates, name)
+	var prompt string
+	if err == nil {
+		prompt, err = conv.ApplyTemplate(*t, vars)
+	}
+	p.mu.Lock()
+	p.templates = templates
 	if err != nil {
-		return "", fmt.Errorf("failed to generate response: %v", err)
+		p.status = "Error: " + err.Error()
+		p.mu.Unlock()
+		return
 	}
+	conv.Title = t.Description
+	p.conv = conv
+	p.mu.Unlock()
 
-	return output, nil
+	if prompt != "" {
+		p.send(prompt)
+	}
 }
 
-func (lm *LanguageModel) IsReady() bool {
-	return lm.ready
+// serverModel summarizes old turns with the server's model.
+type serverModel struct {
+	client *ai.StreamClient
 }
 
-func (lm *LanguageModel) SetParameters(temperature float32, contextWindow int, maxTokens int) {
-	lm.temperature = temperature
-	lm.contextWindow = contextWindow
-	lm.maxTokens = maxTokens
+func (m serverModel) Generate(ctx context.Context, messages []ai.ChatMessage) (*ai.GenerateResult, error) {
+	return m.client.Chat(ctx, ai.GenerateRequest{Messages: messages}, nil)
+}
+
+// Stop cancels the reply being streamed, keeping what has arrived so far.
+func (p *LLMPanel) Stop() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.cancel != nil {
+		p.cancel()
+	}
+}
+
+// Draw renders the transcript, the streaming reply, the prompt and the buttons.
+func (p *LLMPanel) Draw() {
+	rl.DrawRectangle(p.x, p.y, p.width, p.height, rl.Color{R: 10, G: 10, B: 20, A: 230})
+	rl.DrawRectangleLines(p.x, p.y, p.width, p.height, rl.SkyBlue)
+
+	p.mu.Lock()
+	lines, colors := p.transcriptLines()
+	status := p.status
+	title := fmt.Sprintf("AI Assistant - %s / %s", p.conv.Engagement, p.conv.Title)
+	p.mu.Unlock()
+
+	rl.DrawTextEx(p.font, title, rl.Vector2{X: float32(p.x + 10), Y: float32(p.y + 8)}, 24, 2, rl.White)
+
+	// Transcript, bottom-aligned so the newest tokens stay in view
+	lineHeight := int32(p.fontSize) + 4
+	top := p.y + 40
+	bottom := p.y + p.height - 100
+	visible := int((bottom - top) / lineHeight)
+	end := len(lines) - p.scrollOffset
+	if end < 0 {
+		end = 0
+	}
+	start := end - visible
+	if start < 0 {
+		start = 0
+	}
+	for i := start; i < end; i++ {
+		pos := rl.Vector2{X: float32(p.x + 10), Y: float32(top + int32(i-start)*lineHeight)}
+		rl.DrawTextEx(p.font, lines[i], pos, p.fontSize, 1, colors[i])
+	}
+
+	rl.DrawTextEx(p.font, status, rl.Vector2{X: float32(p.x + 10), Y: float32(p.y + p.height - 90)}, 16, 1, rl.Gray)
+
+	// Prompt
+	inputBox := rl.Rectangle{X: float32(p.x + 10), Y: float32(p.y + p.height - 50), Width: float32(p.width - 280), Height: 40}
+	rl.DrawRectangleRec(inputBox, rl.Black)
+	rl.DrawRectangleLinesEx(inputBox, 1, rl.White)
+	rl.DrawTextEx(p.font, "> "+p.input, rl.Vector2{X: inputBox.X + 6, Y: inputBox.Y + 10}, p.fontSize, 1, rl.White)
+
+	p.sendButton.Draw()
+	p.stopButton.Draw()
+}
+
+// transcriptLines wraps every turn, and the reply being streamed, to the
+// panel's width. The caller holds p.mu.
+func (p *LLMPanel) transcriptLines() ([]string, []rl.Color) {
+	var lines []string
+	var colors []rl.Color
+	add := func(prefix, text string, color rl.Color) {
+		for _, line := range wrapText(p.font, prefix+text, p.fontSize, float32(p.width-20)) {
+			lines = append(lines, line)
+			colors = append(colors, color)
+		}
+	}
+	for _, m := range p.conv.Messages {
+		if m.Role == "user" {
+			add("You: ", m.Content, rl.SkyBlue)
+		} else {
+			add("AI: ", m.Content, rl.RayWhite)
+		}
+	}
+	if p.streaming {
+		add("AI: ", p.reply.String()+"_", rl.RayWhite)
+	}
+	return lines, colors
+}
+
+// wrapText breaks text into lines no wider than maxWidth, splitting at spaces
+// and at newlines in the text.
+func wrapText(font rl.Font, text string, fontSize, maxWidth float32) []string {
+	var lines []string
+	for _, paragraph := range strings.Split(text, "\n") {
+		line := ""
+		for _, word := range strings.Fields(paragraph) {
+			candidate := word
+			if line != "" {
+				candidate = line + " " + word
+			}
+			if line != "" && rl.MeasureTextEx(font, candidate, fontSize, 1).X > maxWidth {
+				lines = append(lines, line)
+				candidate = word
+			}
+			line = candidate
+		}
+		lines = append(lines, line)
+	}
+	return lines
 }
@@ -1,15 +1,32 @@
 package ui
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"os"
+	"strings"
+	"sync"
 	"time"
 
-	"yourproject/sshmgmt"
+	"ghostshell/app/ghostssh/sshmgmt"
 
 	rl "github.com/gen2brain/raylib-go/raylib"
+	"golang.org/x/crypto/ssh"
 )
 
+// sshOperationTimeout bounds each command or transfer started from the UI
+const sshOperationTimeout = 10 * time.Minute
+
 // SSHManagerUI handles the graphical interface for managing SSH connections.
+// A typed line runs on the selected connection, or is one of:
+//
+//	/save <name> <user@host[:port]> <keyfile> [-A] [-J jump,...]   save a connection
+//	/temp <user@host[:port]> <keyfile>                              add a temporary connection
+//	/put <local> [remote]                                           upload over SFTP
+//	/get <remote> [local]                                           download over SFTP
+//	/ls [remote]                                                    list a remote directory
+//	/report                                                         show the connections report
 type SSHManagerUI struct {
 	sshManager *sshmgmt.SSHManager
 
@@ -17,28 +34,36 @@ type SSHManagerUI struct {
 	font                rl.Font
 	connections         []sshmgmt.SSHConnection
 	selectedConnection  int
+	input               string
 
 	// UI Elements
-	saveButton   Button
-	deleteButton Button
-	tempButton   Button
-	listBox      ListBox
+	runButton        Button
+	deleteButton     Button
+	disconnectButton Button
+	listBox          ListBox
+
+	// Written by the goroutines running commands, read when drawing
+	mu      sync.Mutex
+	output  ScrollableLog
+	running int
 }
 
 // NewSSHManagerUI initializes a new SSHManagerUI instance.
 func NewSSHManagerUI(sshManager *sshmgmt.SSHManager, font rl.Font, x, y, width, height int32) *SSHManagerUI {
+	listWidth := (width - 60) / 3
 	return &SSHManagerUI{
-		sshManager:   sshManager,
-		x:            x,
-		y:            y,
-		width:        width,
-		height:       height,
-		font:         font,
-		connections:  sshManager.ListConnections(),
-		listBox:      NewListBox(x+20, y+60, width-40, height-140, font),
-		saveButton:   NewButton(x+20, y+height-60, 120, 40, "Save"),
-		deleteButton: NewButton(x+160, y+height-60, 120, 40, "Delete"),
-		tempButton:   NewButton(x+300, y+height-60, 120, 40, "Temp Connect"),
+		sshManager:       sshManager,
+		x:                x,
+		y:                y,
+		width:            width,
+		height:           height,
+		font:             font,
+		connections:      sshManager.ListConnections(),
+		listBox:          NewListBox(x+20, y+60, listWidth, height-180, font),
+		output:           NewScrollableLog(x+40+listWidth, y+60, width-60-listWidth, height-180, font),
+		runButton:        NewButton(x+20, y+height-60, 120, 40, "Run"),
+		deleteButton:     NewButton(x+160, y+height-60, 120, 40, "Delete"),
+		disconnectButton: NewButton(x+300, y+height-60, 120, 40, "Disconnect"),
 	}
 }
 
@@ -47,18 +72,46 @@ func (ui *SSHManagerUI) Update() {
 	// Update list of connections
 	ui.connections = ui.sshManager.ListConnections()
 	ui.listBox.Update(ui.connections)
+	ui.selectedConnection = ui.listBox.SelectedIndex
+
+	for {
+		typed := rl.GetCharPressed()
+		if typed == 0 {
+			break
+		}
+		if typed >= 32 {
+			ui.input += string(rune(typed))
+		}
+	}
+	if rl.IsKeyPressed(rl.KeyBackspace) && len(ui.input) > 0 {
+		runes := []rune(ui.input)
+		ui.input = string(runes[:len(runes)-1])
+	}
+
+	// Scroll the output
+	if wheel := rl.GetMouseWheelMove(); wheel != 0 {
+		ui.mu.Lock()
+		ui.output.scrollOffset -= int(wheel)
+		if last := len(ui.output.lines) - 1; ui.output.scrollOffset > last {
+			ui.output.scrollOffset = last
+		}
+		if ui.output.scrollOffset < 0 {
+			ui.output.scrollOffset = 0
+		}
+		ui.mu.Unlock()
+	}
 
 	// Handle button presses
-	if ui.saveButton.Update() {
-		ui.handleSaveConnection()
+	if rl.IsKeyPressed(rl.KeyEnter) || ui.runButton.Update() {
+		ui.handleInput()
 	}
 
 	if ui.deleteButton.Update() {
 		ui.handleDeleteConnection()
 	}
 
-	if ui.tempButton.Update() {
-		ui.handleTempConnection()
+	if ui.disconnectButton.Update() {
+		ui.handleDisconnect()
 	}
 }
 
@@ -72,51 +125,261 @@ func (ui *SSHManagerUI) Draw() {
 	// Draw List Box
 	ui.listBox.Draw()
 
+	// Draw Output
+	ui.mu.Lock()
+	ui.output.Draw()
+	running := ui.running
+	ui.mu.Unlock()
+
+	// Draw Input
+	inputY := ui.y + ui.height - 110
+	rl.DrawRectangle(ui.x+20, inputY, ui.width-40, 36, rl.Black)
+	rl.DrawRectangleLines(ui.x+20, inputY, ui.width-40, 36, rl.White)
+	prompt := "> "
+	if conn, ok := ui.selected(); ok {
+		prompt = conn.Name + "> "
+	}
+	rl.DrawTextEx(ui.font, prompt+ui.input+"_", rl.Vector2{X: float32(ui.x + 28), Y: float32(inputY + 8)}, 20, 2, rl.White)
+	if running > 0 {
+		rl.DrawTextEx(ui.font, fmt.Sprintf("%d running", running), rl.Vector2{X: float32(ui.x + 440), Y: float32(ui.y + ui.height - 50)}, 20, 2, rl.LightGray)
+	}
+
 	// Draw Buttons
-	ui.saveButton.Draw()
+	ui.runButton.Draw()
 	ui.deleteButton.Draw()
-	ui.tempButton.Draw()
+	ui.disconnectButton.Draw()
 }
 
-// handleSaveConnection handles saving a new SSH connection.
-func (ui *SSHManagerUI) handleSaveConnection() {
-	name := fmt.Sprintf("Connection_%d", time.Now().Unix())
-	address := "example.com:22"
-	username := "user"
-	privateKey := "PRIVATE_KEY_PLACEHOLDER"
+// selected returns the selected connection, if there is one.
+func (ui *SSHManagerUI) selected() (sshmgmt.SSHConnection, bool) {
+	if ui.selectedConnection >= 0 && ui.selectedConnection < len(ui.connections) {
+		return ui.connections[ui.selectedConnection], true
+	}
+	return sshmgmt.SSHConnection{}, false
+}
+
+// logf appends a line, or several, to the output and scrolls to the end.
+func (ui *SSHManagerUI) logf(format string, args ...interface{}) {
+	ui.mu.Lock()
+	defer ui.mu.Unlock()
+	text := strings.TrimRight(fmt.Sprintf(format, args...), "\n")
+	ui.output.lines = append(ui.output.lines, strings.Split(text, "\n")...)
+	if visible := int(ui.output.height) / 20; len(ui.output.lines) > visible {
+		ui.output.scrollOffset = len(ui.output.lines) - visible
+	}
+}
+
+// handleInput runs the typed command.
+func (ui *SSHManagerUI) handleInput() {
+	input := strings.TrimSpace(ui.input)
+	if input == "" {
+		return
+	}
+	ui.input = ""
+
+	if strings.HasPrefix(input, "/") {
+		ui.handleCommand(strings.Fields(input))
+		return
+	}
+	conn, ok := ui.selected()
+	if !ok {
+		ui.logf("No connection selected.")
+		return
+	}
+	ui.logf("%s$ %s", conn.Name, input)
+	ui.async(func(ctx context.Context) {
+		output, err := ui.sshManager.Run(ctx, conn.Name, input)
+		if output != "" {
+			ui.logf("%s", output)
+		}
+		var exitErr *ssh.ExitError
+		if errors.As(err, &exitErr) {
+			ui.logf("[exit status %d]", exitErr.ExitStatus())
+		} else if err != nil {
+			ui.logf("Error: %v", err)
+		}
+	})
+}
+
+// handleCommand runs a /command.
+func (ui *SSHManagerUI) handleCommand(args []string) {
+	switch args[0] {
+	case "/save":
+		ui.handleSaveConnection(args[1:])
+	case "/temp":
+		ui.handleTempConnection(args[1:])
+	case "/put", "/get", "/ls":
+		ui.handleTransfer(args)
+	case "/report":
+		for _, entry := range ui.sshManager.GenerateReport() {
+			ui.logf("%s", entry)
+		}
+	default:
+		ui.logf("Unknown command %s. Commands: /save /temp /put /get /ls /report", args[0])
+	}
+}
+
+// async runs fn in the background with a timeout.
+func (ui *SSHManagerUI) async(fn func(ctx context.Context)) {
+	ui.mu.Lock()
+	ui.running++
+	ui.mu.Unlock()
+	go func() {
+		defer func() {
+			ui.mu.Lock()
+			ui.running--
+			ui.mu.Unlock()
+		}()
+		ctx, cancel := context.WithTimeout(context.Background(), sshOperationTimeout)
+		defer cancel()
+		fn(ctx)
+	}()
+}
+
+// parseTarget splits user@host[:port].
+func parseTarget(target string) (username, address string, err error) {
+	i := strings.LastIndex(target, "@")
+	if i <= 0 || i == len(target)-1 {
+		return "", "", fmt.Errorf("expected user@host[:port], got %q", target)
+	}
+	return target[:i], target[i+1:], nil
+}
 
-	err := ui.sshManager.SaveConnection(name, address, username, privateKey, false)
+// handleSaveConnection handles saving a new SSH connection.
+func (ui *SSHManagerUI) handleSaveConnection(args []string) {
+	if len(args) < 3 {
+		ui.logf("Usage: /save <name> <user@host[:port]> <keyfile> [-A] [-J jump,...]")
+		return
+	}
+	username, address, err := parseTarget(args[1])
+	if err != nil {
+		ui.logf("Failed to save connection: %v", err)
+		return
+	}
+	privateKey, err := os.ReadFile(args[2])
 	if err != nil {
-		fmt.Println("Failed to save connection:", err)
+		ui.logf("Failed to read key: %v", err)
 		return
 	}
-	fmt.Println("Connection saved:", name)
+	conn := sshmgmt.SSHConnection{Name: args[0], Address: address, Username: username, PrivateKey: string(privateKey)}
+	for i := 3; i < len(args); i++ {
+		switch {
+		case args[i] == "-A":
+			conn.ForwardAgent = true
+		case args[i] == "-J" && i+1 < len(args):
+			i++
+			conn.JumpHosts = strings.Split(args[i], ",")
+		default:
+			ui.logf("Unknown option %s", args[i])
+			return
+		}
+	}
+
+	if err := ui.sshManager.SaveConnectionConfig(conn); err != nil {
+		ui.logf("Failed to save connection: %v", err)
+		return
+	}
+	ui.logf("Connection saved: %s", conn.Name)
 }
 
 // handleDeleteConnection handles deleting the selected SSH connection.
 func (ui *SSHManagerUI) handleDeleteConnection() {
-	if ui.listBox.SelectedIndex >= 0 && ui.listBox.SelectedIndex < len(ui.connections) {
-		selected := ui.connections[ui.listBox.SelectedIndex]
-		if err := ui.sshManager.DeleteConnection(selected.Name); err != nil {
-			fmt.Println("Failed to delete connection:", err)
+	selected, ok := ui.selected()
+	if !ok {
+		return
+	}
+	if err := ui.sshManager.DeleteConnection(selected.Name); err != nil {
+		ui.logf("Failed to delete connection: %v", err)
+		return
+	}
+	ui.logf("Connection deleted: %s", selected.Name)
+}
+
+// handleDisconnect closes the selected connection.
+func (ui *SSHManagerUI) handleDisconnect() {
+	selected, ok := ui.selected()
+	if !ok {
+		return
+	}
+	ui.async(func(ctx context.Context) {
+		if err := ui.sshManager.Disconnect(selected.Name); err != nil {
+			ui.logf("Failed to disconnect: %v", err)
 			return
 		}
-		fmt.Println("Connection deleted:", selected.Name)
-	}
+		ui.logf("Disconnected: %s", selected.Name)
+	})
 }
 
 // handleTempConnection creates a temporary connection.
-func (ui *SSHManagerUI) handleTempConnection() {
-	tempAddress := "temp.example.com:22"
-	tempUsername := "tempUser"
-	tempPrivateKey := "TEMP_PRIVATE_KEY"
+func (ui *SSHManagerUI) handleTempConnection(args []string) {
+	if len(args) != 2 {
+		ui.logf("Usage: /temp <user@host[:port]> <keyfile>")
+		return
+	}
+	username, address, err := parseTarget(args[0])
+	if err != nil {
+		ui.logf("Failed to create temporary connection: %v", err)
+		return
+	}
+	privateKey, err := os.ReadFile(args[1])
+	if err != nil {
+		ui.logf("Failed to read key: %v", err)
+		return
+	}
 
-	conn, err := ui.sshManager.CreateTempConnection(tempAddress, tempUsername, tempPrivateKey)
+	conn, err := ui.sshManager.CreateTempConnection(address, username, string(privateKey))
 	if err != nil {
-		fmt.Println("Failed to create temporary connection:", err)
+		ui.logf("Failed to create temporary connection: %v", err)
 		return
 	}
-	fmt.Printf("Temporary connection created: %s -> %s\n", conn.Name, conn.Address)
+	ui.logf("Temporary connection created: %s -> %s", conn.Name, conn.Address)
+}
+
+// handleTransfer runs /put, /get or /ls on the selected connection.
+func (ui *SSHManagerUI) handleTransfer(args []string) {
+	conn, ok := ui.selected()
+	if !ok {
+		ui.logf("No connection selected.")
+		return
+	}
+	arg := func(i int) string {
+		if i < len(args) {
+			return args[i]
+		}
+		return ""
+	}
+	if args[0] != "/ls" && len(args) < 2 {
+		ui.logf("Usage: /put <local> [remote], /get <remote> [local]")
+		return
+	}
+
+	ui.async(func(ctx context.Context) {
+		switch args[0] {
+		case "/put":
+			n, err := ui.sshManager.Upload(ctx, conn.Name, args[1], arg(2))
+			if err != nil {
+				ui.logf("Upload failed: %v", err)
+				return
+			}
+			ui.logf("Uploaded %s to %s (%d bytes)", args[1], conn.Name, n)
+		case "/get":
+			n, err := ui.sshManager.Download(ctx, conn.Name, args[1], arg(2))
+			if err != nil {
+				ui.logf("Download failed: %v", err)
+				return
+			}
+			ui.logf("Downloaded %s from %s (%d bytes)", args[1], conn.Name, n)
+		case "/ls":
+			entries, err := ui.sshManager.ListDir(ctx, conn.Name, arg(1))
+			if err != nil {
+				ui.logf("Listing failed: %v", err)
+				return
+			}
+			for _, entry := range entries {
+				ui.logf("%s %10d %s", entry.Mode(), entry.Size(), entry.Name())
+			}
+		}
+	})
 }
 
 // ListBox represents a scrollable list of items.
@@ -152,6 +415,12 @@ func (lb *ListBox) Update(items []sshmgmt.SSHConnection) {
 			lb.SelectedIndex = len(lb.items) - 1
 		}
 	}
+	if lb.SelectedIndex >= len(lb.items) {
+		lb.SelectedIndex = len(lb.items) - 1
+	}
+	if lb.SelectedIndex < 0 && len(lb.items) > 0 {
+		lb.SelectedIndex = 0
+	}
 }
 
 // Draw renders the list box.
@@ -174,6 +443,10 @@ func (lb *ListBox) Draw() {
 		if startIdx+i == lb.SelectedIndex {
 			color = rl.White
 		}
-		rl.DrawTextEx(lb.font, fmt.Sprintf("%s (%s)", item.Name, item.Address), rl.Vector2{X: float32(lb.x + 5), Y: float32(rowY)}, 20, 2, color)
+		label := fmt.Sprintf("%s (%s)", item.Name, item.Address)
+		if len(item.JumpHosts) > 0 {
+			label += " via " + strings.Join(item.JumpHosts, ",")
+		}
+		rl.DrawTextEx(lb.font, label, rl.Vector2{X: float32(lb.x + 5), Y: float32(rowY)}, 20, 2, color)
 	}
 }